@@ -90,6 +90,20 @@ func allMigratedModels() []interface{} {
 		&database.Team{},
 		&database.TeamMember{},
 		&database.TeamProvider{},
+		&database.LLMBudget{},
+		&database.LLMFallbackChain{},
+		&database.LLMRateLimit{},
+		&database.LLMCapturePolicy{},
+		&database.NotificationChannel{},
+		&database.NotificationRule{},
+		&database.UserSession{},
+		&database.APIToken{},
+		&database.UserRecoveryCode{},
+		&database.InstanceHostKey{},
+		&database.OrchestratorTarget{},
+		&database.PowerSchedule{},
+		&database.InstanceTemplate{},
+		&database.InstanceTemplateVersion{},
 	}
 }
 
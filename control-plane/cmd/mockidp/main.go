@@ -0,0 +1,46 @@
+// mockidp serves a throwaway OpenID Connect provider for trying the
+// dashboard SSO login locally. Every login is approved as the identity
+// given on the command line.
+//
+// Usage:
+//
+//	go run ./cmd/mockidp -username alice -groups claworc-admins,platform
+//
+// then start the control plane with
+//
+//	CLAWORC_OIDC_ISSUER=http://localhost:9998
+//	CLAWORC_OIDC_CLIENT_ID=claworc
+//	CLAWORC_OIDC_CLIENT_SECRET=secret
+//	CLAWORC_OIDC_ADMIN_GROUPS=claworc-admins
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9998", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9998", "issuer URL (must match how the control plane reaches this server)")
+	clientID := flag.String("client-id", "claworc", "OAuth client ID")
+	clientSecret := flag.String("client-secret", "secret", "OAuth client secret")
+	sub := flag.String("sub", "user-1", "subject claim")
+	username := flag.String("username", "alice", "preferred_username claim")
+	email := flag.String("email", "alice@example.com", "email claim")
+	groups := flag.String("groups", "", "comma-separated groups claim")
+	flag.Parse()
+
+	claims := map[string]interface{}{"sub": *sub, "preferred_username": *username, "email": *email}
+	if *groups != "" {
+		claims["groups"] = strings.Split(*groups, ",")
+	}
+	idp := mockidp.New(strings.TrimRight(*issuer, "/"), *clientID, *clientSecret)
+	idp.SetIdentity(claims, false)
+
+	log.Printf("mock OIDC provider at %s (client %q), logging everyone in as %q", *issuer, *clientID, *username)
+	log.Fatal(http.ListenAndServe(*addr, idp))
+}
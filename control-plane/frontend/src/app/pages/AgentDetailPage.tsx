@@ -209,7 +209,14 @@ export default function AgentDetailPage() {
   const logsHook = useInstanceLogs(instanceId, activeTab === "logs");
   const termHook = useTerminal(instanceId, terminalActivated && instance?.status === "running");
   const desktopHook = useDesktop(instanceId, chatActivated && chatViewMode === "chat-browser" && instance?.status === "running");
-  const chatHook = useChat(instanceId, chatActivated && instance?.status === "running");
+  // Connecting the chat to a hibernated agent wakes it. Only do that on
+  // request, so a tab left open does not wake it again by reconnecting.
+  const [wakeRequested, setWakeRequested] = useState(false);
+  useEffect(() => {
+    if (instance?.status === "running") setWakeRequested(false);
+  }, [instance?.status]);
+  const chatAvailable = instance?.status === "running" || (instance?.status === "hibernated" && wakeRequested);
+  const chatHook = useChat(instanceId, chatActivated && chatAvailable);
 
   // When the user hides the browser pane, also stop the on-demand browser pod
   // so we don't burn resources on something nobody can see. Re-enabling the
@@ -1204,13 +1211,13 @@ export default function AgentDetailPage() {
         <div
           ref={chatContainerRef}
           className={
-            instance.status === "running"
+            chatAvailable
               ? "bg-gray-900 rounded-lg border border-gray-700 overflow-hidden h-[calc(100vh-142px)] min-h-[400px] flex flex-col"
               : "h-[calc(100vh-142px)] min-h-[400px]"
           }
           style={activeTab !== "chat" ? { display: "none" } : undefined}
         >
-          {instance.status === "running" ? (
+          {chatAvailable ? (
             <>
               {/* Fullscreen / New Window bar */}
               <div className="flex items-center justify-end gap-2 px-3 py-1 bg-gray-800 border-b border-gray-700">
@@ -1277,7 +1284,21 @@ export default function AgentDetailPage() {
               </div>
             </>
           ) : (
-            <TabPlaceholder message="Agent must be running to use Chat." />
+            instance.status === "hibernated" ? (
+              <TabPlaceholder
+                message="Agent was hibernated after being idle."
+                action={
+                  <button
+                    onClick={() => setWakeRequested(true)}
+                    className="px-3 py-1.5 text-sm text-white bg-blue-600 rounded-md hover:bg-blue-700"
+                  >
+                    Wake up
+                  </button>
+                }
+              />
+            ) : (
+              <TabPlaceholder message="Agent must be running to use Chat." />
+            )
           )}
         </div>
       )}
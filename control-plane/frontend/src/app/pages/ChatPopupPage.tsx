@@ -40,7 +40,13 @@ function useHistoryFromOpener(instanceId: number): ChatMessage[] | undefined {
 function ChatPopupInner({ instanceId, initialMessages }: { instanceId: number; initialMessages: ChatMessage[] }) {
   const { data: instance, isLoading } = useInstance(instanceId);
   const [chatViewMode, setChatViewMode] = useChatViewMode(instanceId, instance?.browser_active);
-  const chatHook = useChat(instanceId, instance?.status === "running", initialMessages);
+  // A hibernated agent is woken by connecting the chat, on request only.
+  const [wakeRequested, setWakeRequested] = useState(false);
+  useEffect(() => {
+    if (instance?.status === "running") setWakeRequested(false);
+  }, [instance?.status]);
+  const chatAvailable = instance?.status === "running" || (instance?.status === "hibernated" && wakeRequested);
+  const chatHook = useChat(instanceId, chatAvailable, initialMessages);
   const desktopHook = useDesktop(instanceId, chatViewMode === "chat-browser" && instance?.status === "running");
 
   if (isLoading) {
@@ -51,7 +57,21 @@ function ChatPopupInner({ instanceId, initialMessages }: { instanceId: number; i
     return <div className="flex items-center justify-center h-screen bg-gray-900 text-gray-400">Agent not found.</div>;
   }
 
-  if (instance.status !== "running") {
+  if (instance.status === "hibernated" && !wakeRequested) {
+    return (
+      <div className="flex flex-col gap-3 items-center justify-center h-screen bg-gray-900 text-gray-400">
+        Agent was hibernated after being idle.
+        <button
+          onClick={() => setWakeRequested(true)}
+          className="px-3 py-1.5 text-sm text-white bg-blue-600 rounded-md hover:bg-blue-700"
+        >
+          Wake up
+        </button>
+      </div>
+    );
+  }
+
+  if (!chatAvailable) {
     return <div className="flex items-center justify-center h-screen bg-gray-900 text-gray-400">Agent must be running to use Chat.</div>;
   }
 
@@ -0,0 +1,106 @@
+import client from "./client";
+import type { InstanceDetail } from "@common/types/instance";
+
+export interface InstanceTemplateSpec {
+  cpu_request?: string;
+  cpu_limit?: string;
+  memory_request?: string;
+  memory_limit?: string;
+  storage_homebrew?: string;
+  storage_home?: string;
+  container_image?: string;
+  timezone?: string;
+  env_vars?: Record<string, string>;
+  enabled_providers?: number[];
+  shared_folder_ids?: number[];
+  skills?: string[];
+  placement_target?: string;
+}
+
+export interface InstanceTemplate {
+  id: number;
+  name: string;
+  description: string;
+  /** 0 = global template. */
+  team_id: number;
+  latest_version: number;
+  created_at: string;
+  updated_at: string;
+  spec: InstanceTemplateSpec;
+}
+
+export interface InstanceTemplateVersion {
+  id: number;
+  template_id: number;
+  version: number;
+  created_by: string;
+  created_at: string;
+  spec: InstanceTemplateSpec;
+}
+
+export interface InstanceTemplatePayload {
+  name?: string;
+  description?: string;
+  team_id?: number;
+  spec?: InstanceTemplateSpec;
+}
+
+export interface InstanceTemplateDiff {
+  template_id: number;
+  template_name: string;
+  version: number;
+  latest_version: number;
+  up_to_date: boolean;
+  changes: Record<string, { before: unknown; after: unknown }> | null;
+}
+
+export async function fetchInstanceTemplates(): Promise<InstanceTemplate[]> {
+  const res = await client.get("/instance-templates");
+  return res.data;
+}
+
+export async function fetchInstanceTemplate(id: number): Promise<InstanceTemplate> {
+  const res = await client.get(`/instance-templates/${id}`);
+  return res.data;
+}
+
+export async function fetchInstanceTemplateVersions(
+  id: number,
+): Promise<InstanceTemplateVersion[]> {
+  const res = await client.get(`/instance-templates/${id}/versions`);
+  return res.data;
+}
+
+export async function createInstanceTemplate(
+  data: InstanceTemplatePayload,
+): Promise<InstanceTemplate> {
+  const res = await client.post("/instance-templates", data);
+  return res.data;
+}
+
+export async function updateInstanceTemplate(
+  id: number,
+  data: InstanceTemplatePayload,
+): Promise<InstanceTemplate> {
+  const res = await client.put(`/instance-templates/${id}`, data);
+  return res.data;
+}
+
+export async function deleteInstanceTemplate(id: number): Promise<void> {
+  await client.delete(`/instance-templates/${id}`);
+}
+
+export async function createInstanceFromTemplate(
+  id: number,
+  data: { display_name: string; team_id?: number; version?: number },
+): Promise<InstanceDetail> {
+  const res = await client.post(`/instance-templates/${id}/instances`, data);
+  return res.data;
+}
+
+export async function fetchInstanceTemplateDiff(
+  instanceId: number,
+): Promise<InstanceTemplateDiff> {
+  const res = await client.get(`/instances/${instanceId}/template-diff`);
+  return res.data;
+}
@@ -104,6 +104,17 @@ export async function cloneInstance(
   return data;
 }
 
+export async function migrateInstance(
+  id: number,
+  target: string,
+): Promise<{ task_id: string }> {
+  const { data } = await client.post<{ task_id: string }>(
+    `/instances/${id}/migrate`,
+    { target },
+  );
+  return data;
+}
+
 export async function reorderInstances(orderedIds: number[]): Promise<void> {
   await client.put("/instances/reorder", { ordered_ids: orderedIds });
 }
@@ -0,0 +1,51 @@
+import client from "./client";
+
+export type PowerAction = "start" | "stop";
+
+export interface PowerSchedule {
+  id: number;
+  name: string;
+  action: PowerAction;
+  cron_expression: string;
+  instance_ids: number[];
+  team_ids: number[];
+  enabled: boolean;
+  last_result: string;
+  last_run_at?: string;
+  next_run_at?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface PowerSchedulePayload {
+  name?: string;
+  action?: PowerAction;
+  cron_expression?: string;
+  instance_ids?: number[];
+  team_ids?: number[];
+  enabled?: boolean;
+}
+
+export async function fetchPowerSchedules(): Promise<PowerSchedule[]> {
+  const res = await client.get("/power-schedules");
+  return res.data;
+}
+
+export async function createPowerSchedule(
+  data: PowerSchedulePayload,
+): Promise<PowerSchedule> {
+  const res = await client.post("/power-schedules", data);
+  return res.data;
+}
+
+export async function updatePowerSchedule(
+  id: number,
+  data: PowerSchedulePayload,
+): Promise<PowerSchedule> {
+  const res = await client.put(`/power-schedules/${id}`, data);
+  return res.data;
+}
+
+export async function deletePowerSchedule(id: number): Promise<void> {
+  await client.delete(`/power-schedules/${id}`);
+}
@@ -5,6 +5,9 @@ export type TaskType =
   | "instance.restart"
   | "instance.image_update"
   | "instance.clone"
+  | "instance.migrate"
+  | "instance.start"
+  | "instance.stop"
   | "backup.create"
   | "skill.deploy"
   | "browser.spawn"
@@ -6,6 +6,8 @@ export interface Team {
   description: string;
   member_count?: number;
   instance_count?: number;
+  /** Hibernate the team's idle instances after this many hours; 0 = never. */
+  hibernate_after_hours?: number;
 }
 
 export interface TeamMember {
@@ -30,7 +32,7 @@ export async function createTeam(payload: {
 
 export async function updateTeam(
   id: number,
-  payload: { name?: string; description?: string },
+  payload: { name?: string; description?: string; hibernate_after_hours?: number },
 ): Promise<Team> {
   const { data } = await client.put<Team>(`/teams/${id}`, payload);
   return data;
@@ -32,7 +32,9 @@ export default function ActionButtons({
   loading,
 }: ActionButtonsProps) {
   const [showConfirm, setShowConfirm] = useState(false);
-  const isStopped = instance.status === "stopped";
+  // Hibernated instances are stopped, but opening the Control UI wakes them.
+  const isHibernated = instance.status === "hibernated";
+  const isStopped = instance.status === "stopped" || isHibernated;
   const isRunning = instance.status === "running";
   const isRestarting = instance.status === "restarting";
   const isStopping = instance.status === "stopping";
@@ -58,8 +60,8 @@ export default function ActionButtons({
           target="_blank"
           rel="noopener noreferrer"
           title="Control UI"
-          aria-disabled={isUnavailable}
-          className={`p-1.5 text-gray-500 hover:text-teal-600 hover:bg-teal-50 rounded ${isUnavailable ? disabledLinkClass : ""}`}
+          aria-disabled={isUnavailable && !isHibernated}
+          className={`p-1.5 text-gray-500 hover:text-teal-600 hover:bg-teal-50 rounded ${isUnavailable && !isHibernated ? disabledLinkClass : ""}`}
         >
           <img src="/openclaw.svg" alt="Control UI" width={16} height={16} />
         </a>
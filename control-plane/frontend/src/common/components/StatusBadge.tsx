@@ -4,6 +4,7 @@ const statusStyles: Record<string, string> = {
   restarting: "bg-orange-100 text-orange-800",
   stopping: "bg-yellow-100 text-yellow-800",
   stopped: "bg-gray-100 text-gray-800",
+  hibernated: "bg-indigo-100 text-indigo-800",
   error: "bg-red-100 text-red-800",
   failed: "bg-red-100 text-red-800",
 };
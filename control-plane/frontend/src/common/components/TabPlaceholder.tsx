@@ -1,11 +1,15 @@
+import type { ReactNode } from "react";
+
 interface TabPlaceholderProps {
   message: string;
+  action?: ReactNode;
 }
 
-export function TabPlaceholder({ message }: TabPlaceholderProps) {
+export function TabPlaceholder({ message, action }: TabPlaceholderProps) {
   return (
-    <div className="flex items-center justify-center h-full text-gray-500 text-sm bg-white rounded-lg border border-gray-200">
+    <div className="flex flex-col gap-3 items-center justify-center h-full text-gray-500 text-sm bg-white rounded-lg border border-gray-200">
       {message}
+      {action}
     </div>
   );
 }
@@ -120,6 +120,13 @@ export function useChat(instanceId: number, enabled: boolean, initialMessages?:
           });
           break;
 
+        case "waking":
+          setMessages((prev) => [
+            ...prev,
+            { id: nextId(), role: "system", content: "Waking up hibernated instance...", timestamp: Date.now() },
+          ]);
+          break;
+
         case "chat":
           setMessages((prev) => [
             ...prev,
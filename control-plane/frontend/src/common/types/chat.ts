@@ -12,6 +12,11 @@ export interface GatewayConnectedFrame {
   type: "connected";
 }
 
+/** Sent before "connected" while the backend wakes a hibernated instance */
+export interface GatewayWakingFrame {
+  type: "waking";
+}
+
 export interface GatewayChatFrame {
   type: "chat";
   role: "agent" | "user";
@@ -48,6 +53,7 @@ export interface GatewayResponseFrame {
 
 export type GatewayFrame =
   | GatewayConnectedFrame
+  | GatewayWakingFrame
   | GatewayChatFrame
   | GatewayAgentFrame
   | GatewayErrorFrame
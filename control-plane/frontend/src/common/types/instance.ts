@@ -8,7 +8,7 @@ export interface Instance {
   id: number;
   name: string;
   display_name: string;
-  status: "creating" | "running" | "restarting" | "stopping" | "stopped" | "error";
+  status: "creating" | "running" | "restarting" | "stopping" | "stopped" | "hibernated" | "error";
   status_message?: string;
   cpu_request: string;
   cpu_limit: string;
@@ -36,6 +36,8 @@ export interface Instance {
   restarting?: boolean;
   live_image_info?: string;
   allowed_source_ips: string;
+  forward_ports: string;
+  placement_target: string;
   enabled_providers: number[];
   instance_providers: LLMProvider[];
   control_url: string;
@@ -58,6 +60,13 @@ export interface Instance {
   affinity: string;
   service_account_annotations: Record<string, string>;
   ports: PortSpec[];
+  /** Auto-hibernation override; null/absent uses the team's policy, 0 = never. */
+  hibernate_after_hours?: number | null;
+  /** Last chat, terminal, SSH gateway, webhook or LLM activity. */
+  last_activity_at?: string;
+  /** Instance template and version this instance was created from. */
+  template_id?: number;
+  template_version?: number;
 }
 
 export interface PortSpec {
@@ -92,12 +101,14 @@ export interface InstanceCreatePayload {
   browser_idle_minutes?: number;
   browser_storage?: string;
   team_id?: number;
+  placement_target?: string;
   pod_annotations?: Record<string, string>;
   node_selector?: Record<string, string>;
   tolerations?: Toleration[];
   affinity?: string;
   service_account_annotations?: Record<string, string>;
   ports?: PortSpec[];
+  hibernate_after_hours?: number;
 }
 
 export interface Toleration {
@@ -115,6 +126,7 @@ export interface InstanceUpdatePayload {
   timezone?: string;
   user_agent?: string;
   allowed_source_ips?: string;
+  forward_ports?: string;
   enabled_providers?: number[];
   display_name?: string;
   cpu_request?: string;
@@ -135,6 +147,8 @@ export interface InstanceUpdatePayload {
   affinity?: string;
   service_account_annotations?: Record<string, string>;
   ports?: PortSpec[];
+  /** Admins and team managers; a negative value reverts to the team's policy. */
+  hibernate_after_hours?: number;
 }
 
 export interface InstanceStats {
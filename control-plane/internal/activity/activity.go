@@ -0,0 +1,82 @@
+// Package activity records when each instance was last used (chat, terminal,
+// SSH gateway, webhook or LLM call) for auto-hibernation. See
+// docs/hibernation.md.
+//
+// Touch is called on hot paths such as every chat message and LLM request,
+// so it only updates an in-memory map; Flush writes the latest timestamps to
+// instances.last_activity_at.
+package activity
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// FlushInterval is how often Start writes pending timestamps to the database.
+const FlushInterval = 30 * time.Second
+
+var (
+	mu      sync.Mutex
+	pending = map[uint]time.Time{}
+)
+
+// Touch records activity on an instance now. Zero IDs are ignored.
+func Touch(instanceID uint) {
+	if instanceID == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	mu.Lock()
+	pending[instanceID] = now
+	mu.Unlock()
+}
+
+// Flush writes pending timestamps to the database. Timestamps that fail to
+// write are kept for the next flush unless newer activity replaced them.
+func Flush() {
+	mu.Lock()
+	batch := pending
+	pending = map[uint]time.Time{}
+	mu.Unlock()
+	if len(batch) == 0 || database.DB == nil {
+		return
+	}
+
+	for id, at := range batch {
+		err := database.DB.Model(&database.Instance{}).Where("id = ?", id).
+			UpdateColumn("last_activity_at", at).Error
+		if err == nil {
+			continue
+		}
+		log.Printf("activity: record instance %d: %v", id, err)
+		mu.Lock()
+		if _, newer := pending[id]; !newer {
+			pending[id] = at
+		}
+		mu.Unlock()
+	}
+}
+
+// Start flushes every FlushInterval until ctx is done, then flushes once
+// more. Call the returned cancel function to stop it.
+func Start(ctx context.Context) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				Flush()
+				return
+			case <-ticker.C:
+				Flush()
+			}
+		}
+	}()
+	return cancel
+}
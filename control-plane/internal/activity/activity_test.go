@@ -0,0 +1,56 @@
+package activity
+
+import (
+	"fmt"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:activity_%s_%p?mode=memory&cache=shared", t.Name(), t)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Instance{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev })
+}
+
+func TestFlush_WritesLatestTouch(t *testing.T) {
+	setupTestDB(t)
+	inst := database.Instance{Name: "bot-idle", DisplayName: "Idle", Status: "running"}
+	if err := database.DB.Create(&inst).Error; err != nil {
+		t.Fatalf("create instance: %v", err)
+	}
+	updatedAt := inst.UpdatedAt
+
+	Touch(inst.ID)
+	Touch(0)
+	Flush()
+
+	var got database.Instance
+	database.DB.First(&got, inst.ID)
+	if got.LastActivityAt == nil {
+		t.Fatal("last_activity_at not set")
+	}
+	if !got.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("updated_at changed from %v to %v; activity must not bump it", updatedAt, got.UpdatedAt)
+	}
+
+	mu.Lock()
+	left := len(pending)
+	mu.Unlock()
+	if left != 0 {
+		t.Errorf("pending = %d after flush, want 0", left)
+	}
+}
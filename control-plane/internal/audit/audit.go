@@ -0,0 +1,253 @@
+// Package audit records changes made through the dashboard and REST API.
+//
+// Every mutating request (POST, PUT, PATCH, DELETE) that passes through
+// Middleware becomes an Entry: who (actor and source IP), what (action and
+// target) and how it ended (HTTP status). Handlers enrich the entry through
+// the request with SetAction, SetTarget and SetChange, the last of which
+// stores a field-level before/after diff. SSH access events stay in the
+// sshaudit package; this log covers control-plane state.
+//
+// Like sshaudit, a retention policy purges old entries from a background
+// goroutine.
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entry is the GORM model for the audit_events table.
+type Entry struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	Actor      string    `gorm:"index" json:"actor"`
+	Action     string    `gorm:"not null;index" json:"action"`
+	TargetType string    `gorm:"index" json:"target_type"`
+	TargetID   string    `gorm:"index" json:"target_id"`
+	TargetName string    `json:"target_name"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	SourceIP   string    `json:"source_ip"`
+	Changes    Changes   `gorm:"type:text" json:"changes,omitempty"`
+}
+
+// TableName overrides the GORM table name.
+func (Entry) TableName() string {
+	return "audit_events"
+}
+
+// Change is the before and after value of one field. A nil side means the
+// field did not exist (create or delete).
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes maps field names to their change; stored as JSON text.
+type Changes map[string]Change
+
+// Value implements driver.Valuer.
+func (c Changes) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (c *Changes) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("audit: unsupported changes column type")
+	}
+	if len(b) == 0 {
+		*c = nil
+		return nil
+	}
+	return json.Unmarshal(b, c)
+}
+
+// Logger manages the dashboard/API audit log.
+type Logger struct {
+	db            *gorm.DB
+	retentionDays int
+	mu            sync.RWMutex
+}
+
+// NewLogger creates a Logger and auto-migrates the audit table.
+// retentionDays controls how long entries are kept (0 = no automatic cleanup).
+func NewLogger(db *gorm.DB, retentionDays int) (*Logger, error) {
+	if err := db.AutoMigrate(&Entry{}); err != nil {
+		return nil, err
+	}
+	return &Logger{
+		db:            db,
+		retentionDays: retentionDays,
+	}, nil
+}
+
+// SetRetentionDays updates the retention policy at runtime.
+func (l *Logger) SetRetentionDays(days int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retentionDays = days
+}
+
+// RetentionDays returns the current retention policy in days.
+func (l *Logger) RetentionDays() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.retentionDays
+}
+
+// Log records an entry.
+func (l *Logger) Log(e *Entry) {
+	if err := l.db.Create(e).Error; err != nil {
+		log.Printf("audit: failed to log %s: %v", e.Action, err)
+	}
+}
+
+// QueryOptions controls filtering and pagination for audit queries. Action
+// matches exactly unless it ends in "*", which matches a prefix.
+type QueryOptions struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+func (l *Logger) filter(opts QueryOptions) *gorm.DB {
+	q := l.db.Model(&Entry{})
+	if opts.Actor != "" {
+		q = q.Where("actor = ?", opts.Actor)
+	}
+	if prefix, ok := strings.CutSuffix(opts.Action, "*"); ok {
+		q = q.Where("action LIKE ? ESCAPE '\\'", escapeLike(prefix)+"%")
+	} else if opts.Action != "" {
+		q = q.Where("action = ?", opts.Action)
+	}
+	if opts.TargetType != "" {
+		q = q.Where("target_type = ?", opts.TargetType)
+	}
+	if opts.TargetID != "" {
+		q = q.Where("target_id = ?", opts.TargetID)
+	}
+	if !opts.Since.IsZero() {
+		q = q.Where("created_at >= ?", opts.Since)
+	}
+	if !opts.Until.IsZero() {
+		q = q.Where("created_at < ?", opts.Until)
+	}
+	return q
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Query returns entries matching the given options, newest first.
+func (l *Logger) Query(opts QueryOptions) ([]Entry, int64, error) {
+	q := l.filter(opts)
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var entries []Entry
+	err := q.Order("created_at DESC, id DESC").Limit(limit).Offset(opts.Offset).Find(&entries).Error
+	return entries, total, err
+}
+
+// Each calls fn for every entry matching opts (Limit and Offset apply),
+// newest first, without loading them all at once. It stops at the first
+// error fn returns.
+func (l *Logger) Each(opts QueryOptions, fn func(*Entry) error) error {
+	q := l.filter(opts).Order("created_at DESC, id DESC")
+	if opts.Limit > 0 {
+		q = q.Limit(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		q = q.Offset(opts.Offset)
+	}
+	rows, err := q.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		if err := l.db.ScanRows(rows, &e); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// PurgeOlderThan deletes entries older than the given duration.
+// Returns the number of entries deleted.
+func (l *Logger) PurgeOlderThan(d time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-d)
+	result := l.db.Where("created_at < ?", cutoff).Delete(&Entry{})
+	return result.RowsAffected, result.Error
+}
+
+// StartRetentionCleanup starts a background goroutine that purges old
+// entries at startup and then daily. Call the returned cancel function to
+// stop it.
+func (l *Logger) StartRetentionCleanup(ctx context.Context) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if days := l.RetentionDays(); days > 0 {
+				deleted, err := l.PurgeOlderThan(time.Duration(days) * 24 * time.Hour)
+				if err != nil {
+					log.Printf("audit: retention cleanup error: %v", err)
+				} else if deleted > 0 {
+					log.Printf("audit: purged %d audit entries older than %d days", deleted, days)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return cancel
+}
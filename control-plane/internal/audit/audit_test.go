@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestLogger(t *testing.T) *Logger {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	l, err := NewLogger(db, 30)
+	if err != nil {
+		t.Fatalf("new logger: %v", err)
+	}
+	return l
+}
+
+func TestDiff(t *testing.T) {
+	type provider struct {
+		Name      string    `json:"name"`
+		APIKey    string    `json:"api_key"`
+		Models    []string  `json:"models"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	before := provider{Name: "openai", APIKey: "enc-1", Models: []string{"a"}, UpdatedAt: time.Unix(1, 0)}
+	after := provider{Name: "openai", APIKey: "enc-2", Models: []string{"a", "b"}, UpdatedAt: time.Unix(2, 0)}
+
+	changes := Diff(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v, want api_key and models", changes)
+	}
+	if c := changes["api_key"]; c.Before != Redacted || c.After != Redacted {
+		t.Errorf("api_key change = %+v, want redacted values", c)
+	}
+	if c := changes["models"]; len(c.After.([]interface{})) != 2 {
+		t.Errorf("models change = %+v", c)
+	}
+
+	created := Diff(nil, map[string]string{"role": "admin", "password": ""})
+	if c := created["role"]; c.Before != nil || c.After != "admin" {
+		t.Errorf("create diff = %v", created)
+	}
+	if c := created["password"]; c.After != "" {
+		t.Errorf("empty secret should stay empty, got %v", c.After)
+	}
+	if Diff(before, before) != nil {
+		t.Error("identical values should produce no changes")
+	}
+}
+
+func TestMiddlewareRecordsMutations(t *testing.T) {
+	l := newTestLogger(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware(l, func(*http.Request) string { return "alice" }))
+	r.Get("/api/v1/teams/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Delete("/api/v1/teams/{id}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Put("/api/v1/users/{userId}/role", func(w http.ResponseWriter, r *http.Request) {
+		SetAction(r, "user.role_change")
+		SetTarget(r, "user", 7, "bob")
+		SetChange(r, map[string]string{"role": "user"}, map[string]string{"role": "admin"})
+		http.Error(w, "nope", http.StatusForbidden)
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/v1/teams/3", nil),
+		httptest.NewRequest("DELETE", "/api/v1/teams/3/members/9", nil),
+		httptest.NewRequest("PUT", "/api/v1/users/7/role", nil),
+	} {
+		req.RemoteAddr = "203.0.113.5:4711"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entries, total, err := l.Query(QueryOptions{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("total = %d, want 2 (GET is not audited)", total)
+	}
+
+	role, member := entries[0], entries[1]
+	if member.Action != "DELETE /api/v1/teams/{id}/members/{userId}" || member.TargetType != "team" ||
+		member.TargetID != "3" || member.Status != http.StatusNoContent || member.Actor != "alice" ||
+		member.SourceIP != "203.0.113.5" {
+		t.Errorf("derived entry = %+v", member)
+	}
+	if role.Action != "user.role_change" || role.TargetType != "user" || role.TargetID != "7" ||
+		role.TargetName != "bob" || role.Status != http.StatusForbidden {
+		t.Errorf("annotated entry = %+v", role)
+	}
+	if c := role.Changes["role"]; c.Before != "user" || c.After != "admin" {
+		t.Errorf("changes = %v", role.Changes)
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	l := newTestLogger(t)
+	l.Log(&Entry{Actor: "alice", Action: "instance.create", TargetType: "instance", TargetID: "1"})
+	l.Log(&Entry{Actor: "alice", Action: "instance.delete", TargetType: "instance", TargetID: "1"})
+	l.Log(&Entry{Actor: "bob", Action: "settings.update", TargetType: "settings"})
+	l.Log(&Entry{Actor: "bob", Action: "instance_x", TargetType: "other"})
+
+	cases := []struct {
+		opts QueryOptions
+		want int64
+	}{
+		{QueryOptions{Actor: "alice"}, 2},
+		{QueryOptions{Action: "instance.*"}, 2},
+		{QueryOptions{Action: "instance_*"}, 1}, // "_" is literal, not a LIKE wildcard
+		{QueryOptions{Action: "settings.update"}, 1},
+		{QueryOptions{TargetType: "instance", TargetID: "1"}, 2},
+		{QueryOptions{Since: time.Now().Add(time.Hour)}, 0},
+		{QueryOptions{Until: time.Now().Add(time.Hour)}, 4},
+	}
+	for _, tc := range cases {
+		if _, total, err := l.Query(tc.opts); err != nil || total != tc.want {
+			t.Errorf("Query(%+v) total = %d, %v; want %d", tc.opts, total, err, tc.want)
+		}
+	}
+
+	var ids []uint
+	l.Each(QueryOptions{Actor: "bob"}, func(e *Entry) error {
+		ids = append(ids, e.ID)
+		return nil
+	})
+	if len(ids) != 2 || ids[0] != 4 || ids[1] != 3 {
+		t.Errorf("Each ids = %v, want [4 3]", ids)
+	}
+}
+
+func TestPurgeOlderThan(t *testing.T) {
+	l := newTestLogger(t)
+	l.Log(&Entry{Action: "old", CreatedAt: time.Now().Add(-40 * 24 * time.Hour)})
+	l.Log(&Entry{Action: "new"})
+
+	deleted, err := l.PurgeOlderThan(time.Duration(l.RetentionDays()) * 24 * time.Hour)
+	if err != nil || deleted != 1 {
+		t.Fatalf("purge = %d, %v; want 1", deleted, err)
+	}
+	entries, _, _ := l.Query(QueryOptions{})
+	if len(entries) != 1 || entries[0].Action != "new" {
+		t.Errorf("remaining = %+v", entries)
+	}
+}
@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Redacted replaces the values of secret fields in Changes.
+const Redacted = "[redacted]"
+
+// secretFieldParts mark a field as secret when its name contains one of
+// them. Secret fields are recorded as changed, never with their values.
+var secretFieldParts = []string{"password", "secret", "token", "api_key", "private_key", "env_vars"}
+
+// ignoredFields change on every write and would drown out real changes.
+var ignoredFields = map[string]bool{"updated_at": true, "last_activity_at": true}
+
+type contextKey struct{}
+
+// record collects what a handler says about the request being audited.
+type record struct {
+	mu    sync.Mutex
+	entry Entry
+}
+
+func recordFrom(r *http.Request) *record {
+	rec, _ := r.Context().Value(contextKey{}).(*record)
+	return rec
+}
+
+// SetAction names the request's action, e.g. "instance.create". Without it
+// the action is the method and route pattern ("POST /api/v1/teams").
+func SetAction(r *http.Request, action string) {
+	if rec := recordFrom(r); rec != nil {
+		rec.mu.Lock()
+		rec.entry.Action = action
+		rec.mu.Unlock()
+	}
+}
+
+// SetTarget identifies the object the request changes. Without it the target
+// is guessed from the route: the type from the path segment before the first
+// URL parameter (singular), the ID from that parameter.
+func SetTarget(r *http.Request, targetType string, targetID interface{}, name string) {
+	if rec := recordFrom(r); rec != nil {
+		rec.mu.Lock()
+		rec.entry.TargetType = targetType
+		rec.entry.TargetID = fmt.Sprint(targetID)
+		rec.entry.TargetName = name
+		rec.mu.Unlock()
+	}
+}
+
+// SetChange records the target's state before and after the request. Either
+// side may be nil (create, delete). Both are compared as JSON objects, field
+// by field; see Diff.
+func SetChange(r *http.Request, before, after interface{}) {
+	if rec := recordFrom(r); rec != nil {
+		changes := Diff(before, after)
+		rec.mu.Lock()
+		rec.entry.Changes = changes
+		rec.mu.Unlock()
+	}
+}
+
+// Diff returns the fields that differ between before and after, each
+// marshalled to a JSON object (a non-object value is compared as the field
+// "value"). Secret fields are recorded with Redacted in place of both values.
+func Diff(before, after interface{}) Changes {
+	b, a := toFields(before), toFields(after)
+	changes := Changes{}
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[k] = Change{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: av}
+		}
+	}
+	for k, c := range changes {
+		if ignoredFields[k] {
+			delete(changes, k)
+		} else if isSecretField(k) {
+			changes[k] = Change{Before: redact(c.Before), After: redact(c.After)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func toFields(v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return map[string]interface{}{"value": fmt.Sprint(v)}
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) == nil {
+		return fields
+	}
+	var value interface{}
+	json.Unmarshal(raw, &value)
+	return map[string]interface{}{"value": value}
+}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range secretFieldParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return Redacted
+}
+
+// Middleware records every mutating request as an Entry once the handler
+// returns. actor resolves the authenticated user's name, so the middleware
+// must run after authentication. A nil Logger disables it.
+func Middleware(l *Logger, actor func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &record{}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), contextKey{}, rec)))
+
+			rec.mu.Lock()
+			e := rec.entry
+			rec.mu.Unlock()
+			e.Actor = actor(r)
+			e.Method = r.Method
+			e.Path = r.URL.Path
+			e.Status = sw.status
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			e.SourceIP = sourceIP(r)
+			pattern, typ, id := routeTarget(r)
+			if e.Action == "" {
+				e.Action = r.Method + " " + pattern
+			}
+			if e.TargetType == "" {
+				e.TargetType, e.TargetID = typ, id
+			}
+			l.Log(&e)
+		})
+	}
+}
+
+// routeTarget derives the route pattern and a default target from chi's
+// routing state: "/api/v1/teams/{id}/members" gives type "team" and the
+// value of {id}.
+func routeTarget(r *http.Request) (pattern, targetType, targetID string) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return r.URL.Path, "", ""
+	}
+	pattern = rctx.RoutePattern()
+	segments := strings.Split(strings.TrimPrefix(pattern, "/api/v1"), "/")
+	var last string
+	for _, seg := range segments {
+		if strings.HasPrefix(seg, "{") {
+			name := strings.Trim(seg, "{}")
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name = name[:i]
+			}
+			return pattern, singular(last), rctx.URLParam(name)
+		}
+		if seg != "" && seg != "*" {
+			last = seg
+		}
+	}
+	return pattern, singular(last), ""
+}
+
+func singular(s string) string {
+	if strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss") {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// sourceIP is the client address; chi's RealIP middleware has already
+// applied X-Forwarded-For / X-Real-IP to RemoteAddr.
+func sourceIP(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+	return r.RemoteAddr
+}
+
+// statusWriter remembers the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
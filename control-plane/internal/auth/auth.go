@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"sort"
 	"sync"
 	"time"
 
@@ -27,80 +29,211 @@ func CheckPassword(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-type sessionEntry struct {
-	UserID    uint
-	ExpiresAt time.Time
+// Session is one dashboard login. ID is the hex SHA-256 of the cookie
+// token, so it can be shown to the user and stored without being usable as
+// a credential.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     uint      `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
 }
 
+// SessionBackend persists sessions for a SessionStore. Implementations must
+// be safe for concurrent use. All IDs are token hashes (see Session).
+type SessionBackend interface {
+	Save(s Session) error
+	Load(id string) (Session, bool)
+	Touch(id string, at time.Time)
+	Delete(id string)
+	// DeleteByUserID removes every session of userID except exceptID
+	// (empty for none).
+	DeleteByUserID(userID uint, exceptID string)
+	ListByUserID(userID uint) []Session
+	DeleteExpired(now time.Time)
+}
+
+// touchInterval limits how often Get writes LastSeenAt back to the backend.
+const touchInterval = time.Minute
+
+// SessionStore issues and resolves session cookie tokens on top of a
+// SessionBackend.
 type SessionStore struct {
-	mu       sync.RWMutex
-	sessions map[string]sessionEntry
+	backend SessionBackend
 }
 
+// NewSessionStore returns a store that keeps sessions in process memory.
+// They are lost on restart and not shared between replicas.
 func NewSessionStore() *SessionStore {
-	return &SessionStore{
-		sessions: make(map[string]sessionEntry),
-	}
+	return NewSessionStoreWithBackend(NewMemorySessionBackend())
+}
+
+// NewSessionStoreWithBackend returns a store persisting to backend.
+func NewSessionStoreWithBackend(backend SessionBackend) *SessionStore {
+	return &SessionStore{backend: backend}
+}
+
+// HashSessionToken returns the session ID for a cookie token.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *SessionStore) Create(userID uint) (string, error) {
+	return s.CreateWithInfo(userID, "", "")
+}
+
+// CreateWithInfo starts a session and returns its cookie token. userAgent
+// and ip are kept so the user can recognise the session when listing them.
+func (s *SessionStore) CreateWithInfo(userID uint, userAgent, ip string) (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	id := hex.EncodeToString(b)
-	s.mu.Lock()
-	s.sessions[id] = sessionEntry{
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(SessionDuration),
+	token := hex.EncodeToString(b)
+	now := time.Now()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	err := s.backend.Save(Session{
+		ID:         HashSessionToken(token),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionDuration),
+	})
+	if err != nil {
+		return "", err
 	}
-	s.mu.Unlock()
-	return id, nil
+	return token, nil
 }
 
-func (s *SessionStore) Get(sessionID string) (uint, bool) {
-	s.mu.RLock()
-	entry, ok := s.sessions[sessionID]
-	s.mu.RUnlock()
-	if !ok || time.Now().After(entry.ExpiresAt) {
+func (s *SessionStore) Get(token string) (uint, bool) {
+	id := HashSessionToken(token)
+	sess, ok := s.backend.Load(id)
+	now := time.Now()
+	if !ok || now.After(sess.ExpiresAt) {
 		return 0, false
 	}
-	return entry.UserID, true
+	if now.Sub(sess.LastSeenAt) >= touchInterval {
+		s.backend.Touch(id, now)
+	}
+	return sess.UserID, true
 }
 
-func (s *SessionStore) Delete(sessionID string) {
-	s.mu.Lock()
-	delete(s.sessions, sessionID)
-	s.mu.Unlock()
+func (s *SessionStore) Delete(token string) {
+	s.backend.Delete(HashSessionToken(token))
 }
 
 func (s *SessionStore) DeleteByUserID(userID uint) {
-	s.mu.Lock()
-	for id, entry := range s.sessions {
-		if entry.UserID == userID {
-			delete(s.sessions, id)
+	s.backend.DeleteByUserID(userID, "")
+}
+
+func (s *SessionStore) DeleteByUserIDExcept(userID uint, exceptToken string) {
+	s.backend.DeleteByUserID(userID, HashSessionToken(exceptToken))
+}
+
+// ListByUserID returns the user's unexpired sessions, newest first.
+func (s *SessionStore) ListByUserID(userID uint) []Session {
+	now := time.Now()
+	var out []Session
+	for _, sess := range s.backend.ListByUserID(userID) {
+		if now.Before(sess.ExpiresAt) {
+			out = append(out, sess)
 		}
 	}
-	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
 }
 
-func (s *SessionStore) DeleteByUserIDExcept(userID uint, exceptSessionID string) {
-	s.mu.Lock()
-	for id, entry := range s.sessions {
-		if entry.UserID == userID && id != exceptSessionID {
-			delete(s.sessions, id)
-		}
+// Revoke deletes the session with the given ID if it belongs to userID and
+// reports whether it did.
+func (s *SessionStore) Revoke(userID uint, id string) bool {
+	sess, ok := s.backend.Load(id)
+	if !ok || sess.UserID != userID {
+		return false
 	}
-	s.mu.Unlock()
+	s.backend.Delete(id)
+	return true
 }
 
 func (s *SessionStore) Cleanup() {
-	now := time.Now()
-	s.mu.Lock()
-	for id, entry := range s.sessions {
-		if now.After(entry.ExpiresAt) {
-			delete(s.sessions, id)
+	s.backend.DeleteExpired(time.Now())
+}
+
+// memorySessionBackend keeps sessions in a map.
+type memorySessionBackend struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionBackend returns an in-process SessionBackend.
+func NewMemorySessionBackend() SessionBackend {
+	return &memorySessionBackend{sessions: make(map[string]Session)}
+}
+
+func (m *memorySessionBackend) Save(s Session) error {
+	m.mu.Lock()
+	m.sessions[s.ID] = s
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memorySessionBackend) Load(id string) (Session, bool) {
+	m.mu.RLock()
+	s, ok := m.sessions[id]
+	m.mu.RUnlock()
+	return s, ok
+}
+
+func (m *memorySessionBackend) Touch(id string, at time.Time) {
+	m.mu.Lock()
+	if s, ok := m.sessions[id]; ok {
+		s.LastSeenAt = at
+		m.sessions[id] = s
+	}
+	m.mu.Unlock()
+}
+
+func (m *memorySessionBackend) Delete(id string) {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+}
+
+func (m *memorySessionBackend) DeleteByUserID(userID uint, exceptID string) {
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID {
+			delete(m.sessions, id)
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *memorySessionBackend) ListByUserID(userID uint) []Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (m *memorySessionBackend) DeleteExpired(now time.Time) {
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
 		}
 	}
-	s.mu.Unlock()
+	m.mu.Unlock()
 }
@@ -46,6 +46,16 @@ func TestCheckPassword_EmptyPassword(t *testing.T) {
 	}
 }
 
+// expireSession backdates the session for token in a memory-backed store.
+func expireSession(store *SessionStore, token string) {
+	mem := store.backend.(*memorySessionBackend)
+	mem.mu.Lock()
+	entry := mem.sessions[HashSessionToken(token)]
+	entry.ExpiresAt = time.Now().Add(-1 * time.Second)
+	mem.sessions[entry.ID] = entry
+	mem.mu.Unlock()
+}
+
 func TestSessionStore_CreateAndGet(t *testing.T) {
 	t.Parallel()
 	store := NewSessionStore()
@@ -81,11 +91,7 @@ func TestSessionStore_GetExpiredSession(t *testing.T) {
 	sessionID, _ := store.Create(1)
 
 	// Manually expire the session
-	store.mu.Lock()
-	entry := store.sessions[sessionID]
-	entry.ExpiresAt = time.Now().Add(-1 * time.Second)
-	store.sessions[sessionID] = entry
-	store.mu.Unlock()
+	expireSession(store, sessionID)
 
 	_, ok := store.Get(sessionID)
 	if ok {
@@ -152,11 +158,7 @@ func TestSessionStore_Cleanup(t *testing.T) {
 	valid, _ := store.Create(2)
 
 	// Expire one session
-	store.mu.Lock()
-	entry := store.sessions[expired]
-	entry.ExpiresAt = time.Now().Add(-1 * time.Second)
-	store.sessions[expired] = entry
-	store.mu.Unlock()
+	expireSession(store, expired)
 
 	store.Cleanup()
 
@@ -204,3 +206,37 @@ func TestSessionCreate_UniqueIDs(t *testing.T) {
 		seen[id] = true
 	}
 }
+
+func TestSessionStore_ListAndRevoke(t *testing.T) {
+	t.Parallel()
+	store := NewSessionStore()
+	mine, _ := store.CreateWithInfo(10, "Firefox", "203.0.113.7")
+	other, _ := store.Create(10)
+	theirs, _ := store.Create(20)
+
+	sessions := store.ListByUserID(10)
+	if len(sessions) != 2 {
+		t.Fatalf("ListByUserID returned %d sessions, want 2", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.ID == mine || s.ID == other {
+			t.Fatal("session ID must not be the cookie token")
+		}
+	}
+
+	if store.Revoke(10, HashSessionToken(theirs)) {
+		t.Error("Revoke succeeded for another user's session")
+	}
+	if !store.Revoke(10, HashSessionToken(other)) {
+		t.Error("Revoke failed for own session")
+	}
+	if _, ok := store.Get(other); ok {
+		t.Error("revoked session still valid")
+	}
+	if _, ok := store.Get(mine); !ok {
+		t.Error("unrelated session was revoked")
+	}
+	if got := store.ListByUserID(10); len(got) != 1 || got[0].UserAgent != "Firefox" || got[0].IPAddress != "203.0.113.7" {
+		t.Errorf("remaining sessions = %+v", got)
+	}
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// GroupMapping turns directory group names into a Claworc role and team
+// memberships.
+type GroupMapping struct {
+	// AdminGroups grant the admin role. When empty the role of existing
+	// users is left alone and new users get "user".
+	AdminGroups []string
+	Teams       []TeamMapping
+	// CreateTeams creates mapped teams that do not exist yet instead of
+	// skipping them.
+	CreateTeams bool
+}
+
+// TeamMapping makes members of Group members of Team with Role.
+type TeamMapping struct {
+	Group string
+	Team  string
+	Role  string // database.TeamRoleUser or database.TeamRoleManager
+}
+
+// ParseTeamMappings parses "group=Team Name:role" entries separated by ";".
+// Role defaults to user.
+func ParseTeamMappings(raw string) ([]TeamMapping, error) {
+	var out []TeamMapping
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, rest, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("team mapping %q: want group=team[:role]", entry)
+		}
+		team, role := rest, database.TeamRoleUser
+		if i := strings.LastIndex(rest, ":"); i >= 0 {
+			team, role = rest[:i], strings.TrimSpace(rest[i+1:])
+		}
+		if role != database.TeamRoleUser && role != database.TeamRoleManager {
+			return nil, fmt.Errorf("team mapping %q: role must be user or manager", entry)
+		}
+		if team = strings.TrimSpace(team); team == "" {
+			return nil, fmt.Errorf("team mapping %q: missing team name", entry)
+		}
+		out = append(out, TeamMapping{Group: strings.TrimSpace(group), Team: team, Role: role})
+	}
+	return out, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// memberOfAny reports whether any of groups is in allowed.
+func memberOfAny(groups, allowed []string) bool {
+	for _, g := range groups {
+		if containsFold(allowed, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUserNotProvisioned is returned by ProvisionExternalUser when the user
+// does not exist and automatic creation is off, or the username belongs to
+// an account from another source.
+var ErrUserNotProvisioned = errors.New("no matching Claworc account")
+
+// ExternalIdentity is a user as asserted by an external directory.
+type ExternalIdentity struct {
+	Source     string // e.g. "oidc"
+	ExternalID string
+	Username   string
+	Groups     []string
+}
+
+// ProvisionOptions control how ProvisionExternalUser matches and creates
+// accounts.
+type ProvisionOptions struct {
+	AutoCreate bool
+	// LinkByUsername lets an identity claim an existing local account with
+	// the same username on first login. Only safe when the directory
+	// controls usernames.
+	LinkByUsername bool
+	Mapping        GroupMapping
+}
+
+// ProvisionExternalUser finds or creates the Claworc user for id, then
+// applies the group mapping to its role and team memberships. A matched
+// user that directory sync had disabled is enabled again, since the
+// directory has just vouched for it.
+func ProvisionExternalUser(id ExternalIdentity, opts ProvisionOptions) (*database.User, error) {
+	var user database.User
+	err := database.DB.Where("auth_source = ? AND external_id = ?", id.Source, id.ExternalID).First(&user).Error
+	switch {
+	case err == nil:
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		existing, lookupErr := database.GetUserByUsername(id.Username)
+		switch {
+		case lookupErr == nil:
+			if !opts.LinkByUsername || existing.AuthSource != "local" {
+				return nil, fmt.Errorf("%w: username %q is already taken", ErrUserNotProvisioned, id.Username)
+			}
+			if err := database.DB.Model(existing).Updates(map[string]interface{}{
+				"auth_source": id.Source, "external_id": id.ExternalID, "password_hash": "",
+			}).Error; err != nil {
+				return nil, err
+			}
+			log.Printf("auth: linked %s identity %q to existing user %q", id.Source, id.ExternalID, existing.Username)
+			user = *existing
+			user.AuthSource, user.ExternalID = id.Source, id.ExternalID
+		case errors.Is(lookupErr, gorm.ErrRecordNotFound):
+			if !opts.AutoCreate {
+				return nil, ErrUserNotProvisioned
+			}
+			user = database.User{
+				Username:   id.Username,
+				Role:       "user",
+				AuthSource: id.Source,
+				ExternalID: id.ExternalID,
+			}
+			if err := database.CreateUser(&user); err != nil {
+				return nil, err
+			}
+			log.Printf("auth: provisioned %s user %q", id.Source, user.Username)
+		default:
+			return nil, lookupErr
+		}
+	default:
+		return nil, err
+	}
+
+	if user.Disabled {
+		if err := database.DB.Model(&user).Update("disabled", false).Error; err != nil {
+			return nil, err
+		}
+		user.Disabled = false
+		log.Printf("auth: re-enabled %s user %q", id.Source, user.Username)
+	}
+	if err := ApplyGroupMapping(&user, id.Groups, opts.Mapping); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ApplyGroupMapping sets user's role from m.AdminGroups and reconciles its
+// membership of every team named in m.Teams. Teams not named in the mapping
+// are left alone so memberships granted in the UI survive.
+func ApplyGroupMapping(user *database.User, groups []string, m GroupMapping) error {
+	if len(m.AdminGroups) > 0 {
+		role := "user"
+		for _, g := range groups {
+			if containsFold(m.AdminGroups, g) {
+				role = "admin"
+				break
+			}
+		}
+		if role != user.Role {
+			if err := database.DB.Model(user).Update("role", role).Error; err != nil {
+				return err
+			}
+			user.Role = role
+		}
+	}
+
+	// Highest role per mapped team: manager beats user beats none.
+	desired := map[string]string{}
+	for _, tm := range m.Teams {
+		if _, seen := desired[tm.Team]; !seen {
+			desired[tm.Team] = ""
+		}
+		if containsFold(groups, tm.Group) && desired[tm.Team] != database.TeamRoleManager {
+			desired[tm.Team] = tm.Role
+		}
+	}
+	for name, role := range desired {
+		var team database.Team
+		if err := database.DB.Where("name = ?", name).First(&team).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if !m.CreateTeams {
+				log.Printf("auth: group mapping refers to unknown team %q, skipping", name)
+				continue
+			}
+			if role == "" {
+				continue
+			}
+			team = database.Team{Name: name}
+			if err := database.CreateTeam(&team); err != nil {
+				return err
+			}
+			log.Printf("auth: created team %q from group mapping", name)
+		}
+		if database.GetTeamRole(user.ID, team.ID) == role {
+			continue
+		}
+		if err := database.SetTeamMember(team.ID, user.ID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncResult summarizes one directory sync.
+type SyncResult struct {
+	Checked     int    `json:"checked"`
+	Reenabled   int    `json:"reenabled"`
+	DisabledIDs []uint `json:"disabled_user_ids"`
+}
+
+// SyncExternalUsers reconciles the users of one auth source against a full
+// listing of the directory. Users present in it (and, when allowed is set,
+// still in an allowed group) get their role and teams re-mapped and are
+// re-enabled if needed; the rest are disabled. Users are not created here,
+// only on their first login.
+//
+// An empty listing is treated as an error rather than a directory with no
+// users, so a misconfigured search base cannot lock everyone out.
+func SyncExternalUsers(source string, directory []ExternalIdentity, allowed []string, m GroupMapping) (*SyncResult, error) {
+	var users []database.User
+	if err := database.DB.Where("auth_source = ?", source).Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	res := &SyncResult{}
+	if len(users) == 0 {
+		return res, nil
+	}
+	if len(directory) == 0 {
+		return nil, errors.New("directory returned no users, refusing to disable every account")
+	}
+	byID := make(map[string]ExternalIdentity, len(directory))
+	for _, id := range directory {
+		byID[id.ExternalID] = id
+	}
+
+	for i := range users {
+		user := &users[i]
+		res.Checked++
+		id, found := byID[user.ExternalID]
+		if !found || (len(allowed) > 0 && !memberOfAny(id.Groups, allowed)) {
+			if !user.Disabled {
+				if err := database.DB.Model(user).Update("disabled", true).Error; err != nil {
+					return nil, err
+				}
+				log.Printf("auth: disabled %s user %q, no longer in the directory", source, user.Username)
+				res.DisabledIDs = append(res.DisabledIDs, user.ID)
+			}
+			continue
+		}
+		if user.Disabled {
+			if err := database.DB.Model(user).Update("disabled", false).Error; err != nil {
+				return nil, err
+			}
+			user.Disabled = false
+			res.Reenabled++
+		}
+		if err := ApplyGroupMapping(user, id.Groups, m); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupUserDB(t *testing.T) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:users_%s_%p?mode=memory&cache=shared", t.Name(), t)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&database.User{}, &database.Team{}, &database.TeamMember{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev })
+}
+
+func TestParseTeamMappings(t *testing.T) {
+	got, err := ParseTeamMappings(" eng=Engineering ; eng-leads=Engineering:manager;ops=Platform Ops:user ")
+	if err != nil {
+		t.Fatalf("ParseTeamMappings: %v", err)
+	}
+	want := []TeamMapping{
+		{Group: "eng", Team: "Engineering", Role: database.TeamRoleUser},
+		{Group: "eng-leads", Team: "Engineering", Role: database.TeamRoleManager},
+		{Group: "ops", Team: "Platform Ops", Role: database.TeamRoleUser},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"noequals", "=Team", "g=Team:owner", "g=:user"} {
+		if _, err := ParseTeamMappings(bad); err == nil {
+			t.Errorf("ParseTeamMappings(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestProvisionExternalUser_CreatesAndMatchesBySubject(t *testing.T) {
+	setupUserDB(t)
+	opts := ProvisionOptions{AutoCreate: true}
+	id := ExternalIdentity{Source: "oidc", ExternalID: "iss|1", Username: "alice"}
+
+	first, err := ProvisionExternalUser(id, opts)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if first.AuthSource != "oidc" || first.Role != "user" || first.PasswordHash != "" {
+		t.Errorf("created user = %+v", first)
+	}
+
+	// A renamed account at the IdP still maps to the same user.
+	id.Username = "alice.smith"
+	second, err := ProvisionExternalUser(id, opts)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("second login created user %d, want %d", second.ID, first.ID)
+	}
+}
+
+func TestProvisionExternalUser_LocalUsernameCollision(t *testing.T) {
+	setupUserDB(t)
+	local := &database.User{Username: "bob", PasswordHash: "x", Role: "admin"}
+	if err := database.CreateUser(local); err != nil {
+		t.Fatal(err)
+	}
+	id := ExternalIdentity{Source: "oidc", ExternalID: "iss|2", Username: "bob"}
+
+	if _, err := ProvisionExternalUser(id, ProvisionOptions{AutoCreate: true}); !errors.Is(err, ErrUserNotProvisioned) {
+		t.Fatalf("err = %v, want ErrUserNotProvisioned", err)
+	}
+
+	linked, err := ProvisionExternalUser(id, ProvisionOptions{LinkByUsername: true})
+	if err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if linked.ID != local.ID {
+		t.Errorf("linked user %d, want %d", linked.ID, local.ID)
+	}
+	reloaded, _ := database.GetUserByUsername("bob")
+	if reloaded.AuthSource != "oidc" || reloaded.PasswordHash != "" || reloaded.Role != "admin" {
+		t.Errorf("after link: %+v", reloaded)
+	}
+}
+
+func TestProvisionExternalUser_NoAutoCreate(t *testing.T) {
+	setupUserDB(t)
+	_, err := ProvisionExternalUser(ExternalIdentity{Source: "oidc", ExternalID: "iss|3", Username: "carol"}, ProvisionOptions{})
+	if !errors.Is(err, ErrUserNotProvisioned) {
+		t.Fatalf("err = %v, want ErrUserNotProvisioned", err)
+	}
+}
+
+func TestApplyGroupMapping(t *testing.T) {
+	setupUserDB(t)
+	eng := &database.Team{Name: "Engineering"}
+	if err := database.CreateTeam(eng); err != nil {
+		t.Fatal(err)
+	}
+	user := &database.User{Username: "dave", Role: "user"}
+	if err := database.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	m := GroupMapping{
+		AdminGroups: []string{"claworc-admins"},
+		Teams: []TeamMapping{
+			{Group: "eng", Team: "Engineering", Role: database.TeamRoleUser},
+			{Group: "eng-leads", Team: "Engineering", Role: database.TeamRoleManager},
+			{Group: "ghosts", Team: "Missing", Role: database.TeamRoleUser},
+		},
+	}
+
+	if err := ApplyGroupMapping(user, []string{"CLAWORC-ADMINS", "eng", "eng-leads", "ghosts"}, m); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if user.Role != "admin" {
+		t.Errorf("role = %q, want admin", user.Role)
+	}
+	if r := database.GetTeamRole(user.ID, eng.ID); r != database.TeamRoleManager {
+		t.Errorf("team role = %q, want manager", r)
+	}
+
+	// Dropping out of the groups demotes and removes the membership.
+	if err := ApplyGroupMapping(user, []string{"other"}, m); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if user.Role != "user" {
+		t.Errorf("role = %q, want user", user.Role)
+	}
+	if r := database.GetTeamRole(user.ID, eng.ID); r != "" {
+		t.Errorf("team role = %q, want none", r)
+	}
+}
+
+func TestApplyGroupMapping_CreateTeams(t *testing.T) {
+	setupUserDB(t)
+	user := &database.User{Username: "erin", Role: "user"}
+	if err := database.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	m := GroupMapping{
+		Teams: []TeamMapping{
+			{Group: "ops", Team: "Platform Ops", Role: database.TeamRoleUser},
+			{Group: "sales", Team: "Sales", Role: database.TeamRoleUser},
+		},
+		CreateTeams: true,
+	}
+	if err := ApplyGroupMapping(user, []string{"ops"}, m); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var team database.Team
+	if err := database.DB.Where("name = ?", "Platform Ops").First(&team).Error; err != nil {
+		t.Fatalf("team not created: %v", err)
+	}
+	if r := database.GetTeamRole(user.ID, team.ID); r != database.TeamRoleUser {
+		t.Errorf("team role = %q, want user", r)
+	}
+	// A team nobody maps into is not created just to stay empty.
+	var n int64
+	database.DB.Model(&database.Team{}).Where("name = ?", "Sales").Count(&n)
+	if n != 0 {
+		t.Errorf("Sales team created without members")
+	}
+}
+
+func TestSyncExternalUsers(t *testing.T) {
+	setupUserDB(t)
+	eng := &database.Team{Name: "Engineering"}
+	if err := database.CreateTeam(eng); err != nil {
+		t.Fatal(err)
+	}
+	mk := func(name, extID string, disabled bool) *database.User {
+		u := &database.User{Username: name, Role: "user", AuthSource: "ldap", ExternalID: extID, Disabled: disabled}
+		if err := database.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	kept := mk("kept", "uuid-1", false)
+	gone := mk("gone", "uuid-2", false)
+	back := mk("back", "uuid-3", true)
+	local := &database.User{Username: "local", PasswordHash: "x", Role: "user"}
+	if err := database.CreateUser(local); err != nil {
+		t.Fatal(err)
+	}
+
+	m := GroupMapping{Teams: []TeamMapping{{Group: "eng", Team: "Engineering", Role: database.TeamRoleUser}}}
+	dir := []ExternalIdentity{
+		{Source: "ldap", ExternalID: "uuid-1", Username: "kept", Groups: []string{"claworc", "eng"}},
+		{Source: "ldap", ExternalID: "uuid-3", Username: "back", Groups: []string{"claworc"}},
+		{Source: "ldap", ExternalID: "uuid-4", Username: "new", Groups: []string{"claworc"}},
+	}
+	res, err := SyncExternalUsers("ldap", dir, []string{"claworc"}, m)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Checked != 3 || res.Reenabled != 1 || fmt.Sprint(res.DisabledIDs) != fmt.Sprint([]uint{gone.ID}) {
+		t.Errorf("result = %+v", res)
+	}
+	for _, tc := range []struct {
+		user     *database.User
+		disabled bool
+	}{{kept, false}, {gone, true}, {back, false}, {local, false}} {
+		u, _ := database.GetUserByID(tc.user.ID)
+		if u.Disabled != tc.disabled {
+			t.Errorf("%s disabled = %v, want %v", u.Username, u.Disabled, tc.disabled)
+		}
+	}
+	if r := database.GetTeamRole(kept.ID, eng.ID); r != database.TeamRoleUser {
+		t.Errorf("kept team role = %q, want user", r)
+	}
+	if _, err := database.GetUserByUsername("new"); err == nil {
+		t.Errorf("sync created a user; users should only be created on login")
+	}
+
+	// Leaving the allowed groups disables too.
+	dir[0].Groups = []string{"eng"}
+	res, err = SyncExternalUsers("ldap", dir, []string{"claworc"}, m)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if fmt.Sprint(res.DisabledIDs) != fmt.Sprint([]uint{kept.ID}) {
+		t.Errorf("disabled = %v, want [%d]", res.DisabledIDs, kept.ID)
+	}
+
+	if _, err := SyncExternalUsers("ldap", nil, nil, m); err == nil {
+		t.Errorf("empty directory listing should be refused")
+	}
+}
+
+func TestProvisionExternalUser_ReenablesDisabledUser(t *testing.T) {
+	setupUserDB(t)
+	u := &database.User{Username: "frank", Role: "user", AuthSource: "ldap", ExternalID: "uuid-9", Disabled: true}
+	if err := database.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ProvisionExternalUser(ExternalIdentity{Source: "ldap", ExternalID: "uuid-9", Username: "frank"}, ProvisionOptions{})
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	if got.Disabled {
+		t.Errorf("user still disabled after directory login")
+	}
+}
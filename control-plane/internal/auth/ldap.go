@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+)
+
+// AuthSourceLDAP marks users provisioned through an LDAP directory.
+const AuthSourceLDAP = "ldap"
+
+// ldapTimeout bounds every directory round trip so a hung server cannot
+// stall a login request.
+const ldapTimeout = 10 * time.Second
+
+// LDAPConfig configures password authentication against an LDAP or Active
+// Directory server.
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// BindDN and BindPassword are the service account used to look users
+	// and groups up. Empty BindDN searches anonymously.
+	BindDN        string
+	BindPassword  string
+	UserBaseDN    string
+	UserFilter    string // {username} is replaced with the escaped login name
+	UsernameAttr  string
+	IDAttr        string // stable identifier; the entry DN when missing
+	GroupBaseDN   string // empty: groups come from the memberOf attribute
+	GroupFilter   string // {dn} and {username} are replaced, escaped
+	GroupNameAttr string
+	AllowedGroups []string
+	SyncInterval  time.Duration
+	ProvisionOpts ProvisionOptions
+}
+
+// LDAP is the configured directory, or nil when LDAP login is off.
+var LDAP *LDAPConfig
+
+// InitLDAP builds LDAP from config.Cfg. The directory is not contacted
+// until the first login or sync.
+func InitLDAP() error {
+	cfg := config.Cfg
+	if cfg.LDAPURL == "" {
+		LDAP = nil
+		return nil
+	}
+	if cfg.LDAPUserBaseDN == "" {
+		return errors.New("CLAWORC_LDAP_USER_BASE_DN is required when CLAWORC_LDAP_URL is set")
+	}
+	if !strings.Contains(cfg.LDAPUserFilter, "{username}") {
+		return errors.New("CLAWORC_LDAP_USER_FILTER must contain {username}")
+	}
+	teams, err := ParseTeamMappings(cfg.LDAPTeamMappings)
+	if err != nil {
+		return fmt.Errorf("CLAWORC_LDAP_TEAM_MAPPINGS: %w", err)
+	}
+	LDAP = &LDAPConfig{
+		URL:                cfg.LDAPURL,
+		StartTLS:           cfg.LDAPStartTLS,
+		InsecureSkipVerify: cfg.LDAPInsecureSkipVerify,
+		BindDN:             cfg.LDAPBindDN,
+		BindPassword:       cfg.LDAPBindPassword,
+		UserBaseDN:         cfg.LDAPUserBaseDN,
+		UserFilter:         cfg.LDAPUserFilter,
+		UsernameAttr:       cfg.LDAPUsernameAttribute,
+		IDAttr:             cfg.LDAPIDAttribute,
+		GroupBaseDN:        cfg.LDAPGroupBaseDN,
+		GroupFilter:        cfg.LDAPGroupFilter,
+		GroupNameAttr:      cfg.LDAPGroupNameAttribute,
+		AllowedGroups:      cfg.LDAPAllowedGroups,
+		SyncInterval:       cfg.LDAPSyncInterval,
+		ProvisionOpts: ProvisionOptions{
+			AutoCreate:     cfg.LDAPAutoCreate,
+			LinkByUsername: cfg.LDAPLinkByUsername,
+			Mapping: GroupMapping{
+				AdminGroups: cfg.LDAPAdminGroups,
+				Teams:       teams,
+				CreateTeams: cfg.LDAPCreateTeams,
+			},
+		},
+	}
+	return nil
+}
+
+// ErrLDAPInvalidCredentials is returned by Authenticate for an unknown user
+// or a wrong password; the two are deliberately indistinguishable.
+var ErrLDAPInvalidCredentials = errors.New("invalid username or password")
+
+// ErrLDAPGroupDenied is returned when the user is in none of the allowed
+// groups.
+var ErrLDAPGroupDenied = errors.New("not a member of an allowed group")
+
+// connect dials the server and binds as the service account.
+func (c *LDAPConfig) connect() (*ldap.Conn, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	conn, err := ldap.DialURL(c.URL,
+		ldap.DialWithTLSConfig(tlsCfg),
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+	if c.StartTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	if err := c.serviceBind(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *LDAPConfig) serviceBind(conn *ldap.Conn) error {
+	var err error
+	if c.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(c.BindDN, c.BindPassword)
+	}
+	if err != nil {
+		return fmt.Errorf("ldap service bind: %w", err)
+	}
+	return nil
+}
+
+func (c *LDAPConfig) userAttributes() []string {
+	attrs := []string{c.UsernameAttr}
+	if c.IDAttr != "" {
+		attrs = append(attrs, c.IDAttr)
+	}
+	if c.GroupBaseDN == "" {
+		attrs = append(attrs, "memberOf")
+	}
+	return attrs
+}
+
+// Authenticate checks username and password against the directory and
+// returns the identity it asserts. The user is looked up with the service
+// account, then bound as itself to verify the password.
+func (c *LDAPConfig) Authenticate(username, password string) (*ExternalIdentity, error) {
+	// An empty password turns a simple bind into an unauthenticated bind,
+	// which many servers accept for any DN.
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		c.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		expandFilter(c.UserFilter, map[string]string{"username": ldap.EscapeFilter(username)}),
+		c.userAttributes(), nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	id, err := c.identityFor(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+	if len(c.AllowedGroups) > 0 && !memberOfAny(id.Groups, c.AllowedGroups) {
+		return nil, ErrLDAPGroupDenied
+	}
+	return id, nil
+}
+
+// ListUsers returns every user matched by the user filter, with groups.
+// It is the input to SyncExternalUsers.
+func (c *LDAPConfig) ListUsers() ([]ExternalIdentity, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		c.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		expandFilter(c.UserFilter, map[string]string{"username": "*"}),
+		c.userAttributes(), nil), 500)
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	out := make([]ExternalIdentity, 0, len(res.Entries))
+	for _, entry := range res.Entries {
+		id, err := c.identityFor(conn, entry)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *id)
+	}
+	return out, nil
+}
+
+// identityFor maps a user entry to an ExternalIdentity, looking its groups
+// up on conn, which must be bound as the service account.
+func (c *LDAPConfig) identityFor(conn *ldap.Conn, entry *ldap.Entry) (*ExternalIdentity, error) {
+	id := &ExternalIdentity{
+		Source:     AuthSourceLDAP,
+		ExternalID: entryID(entry, c.IDAttr),
+		Username:   strings.TrimSpace(entry.GetAttributeValue(c.UsernameAttr)),
+	}
+	if id.Username == "" {
+		return nil, fmt.Errorf("ldap entry %q has no %s attribute", entry.DN, c.UsernameAttr)
+	}
+	if len(id.Username) > 64 {
+		return nil, fmt.Errorf("username %q is longer than 64 characters", id.Username)
+	}
+
+	if c.GroupBaseDN == "" {
+		for _, dn := range entry.GetAttributeValues("memberOf") {
+			if name := groupNameFromDN(dn); name != "" {
+				id.Groups = append(id.Groups, name)
+			}
+		}
+		return id, nil
+	}
+	res, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		c.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		expandFilter(c.GroupFilter, map[string]string{
+			"dn":       ldap.EscapeFilter(entry.DN),
+			"username": ldap.EscapeFilter(id.Username),
+		}),
+		[]string{c.GroupNameAttr}, nil), 500)
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search: %w", err)
+	}
+	for _, g := range res.Entries {
+		if name := g.GetAttributeValue(c.GroupNameAttr); name != "" {
+			id.Groups = append(id.Groups, name)
+		}
+	}
+	return id, nil
+}
+
+// expandFilter replaces {name} placeholders in filter. Values must already
+// be escaped by the caller.
+func expandFilter(filter string, values map[string]string) string {
+	for k, v := range values {
+		filter = strings.ReplaceAll(filter, "{"+k+"}", v)
+	}
+	return filter
+}
+
+// entryID returns the entry's stable identifier. Binary values such as
+// Active Directory's objectGUID are hex-encoded; without the attribute the
+// DN is used, which does not survive renames.
+func entryID(entry *ldap.Entry, attr string) string {
+	if attr != "" {
+		if raw := entry.GetRawAttributeValue(attr); len(raw) > 0 {
+			if utf8.Valid(raw) {
+				return string(raw)
+			}
+			return hex.EncodeToString(raw)
+		}
+	}
+	return strings.ToLower(entry.DN)
+}
+
+// groupNameFromDN returns the value of the first RDN of a group DN, e.g.
+// "admins" for "cn=admins,ou=groups,dc=example,dc=com".
+func groupNameFromDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return ""
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestExpandFilter(t *testing.T) {
+	got := expandFilter("(&(objectClass=person)(uid={username}))",
+		map[string]string{"username": ldap.EscapeFilter("a*)(uid=*")})
+	want := `(&(objectClass=person)(uid=a\2a\29\28uid=\2a))`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	got = expandFilter("(|(member={dn})(memberUid={username}))",
+		map[string]string{"dn": "uid=bob,dc=x", "username": "bob"})
+	if got != "(|(member=uid=bob,dc=x)(memberUid=bob))" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestGroupNameFromDN(t *testing.T) {
+	for dn, want := range map[string]string{
+		"cn=claworc-admins,ou=groups,dc=example,dc=com": "claworc-admins",
+		"CN=Domain Users,CN=Users,DC=corp,DC=local":     "Domain Users",
+		"not a dn": "",
+	} {
+		if got := groupNameFromDN(dn); got != want {
+			t.Errorf("groupNameFromDN(%q) = %q, want %q", dn, got, want)
+		}
+	}
+}
+
+func TestEntryID(t *testing.T) {
+	entry := ldap.NewEntry("uid=Bob,ou=people,dc=example,dc=com", map[string][]string{
+		"entryUUID":  {"5f1c-uuid"},
+		"objectGUID": {string([]byte{0xff, 0x00, 0x10})},
+	})
+	if got := entryID(entry, "entryUUID"); got != "5f1c-uuid" {
+		t.Errorf("text id = %q", got)
+	}
+	if got := entryID(entry, "objectGUID"); got != "ff0010" {
+		t.Errorf("binary id = %q, want hex", got)
+	}
+	if got := entryID(entry, "missing"); got != "uid=bob,ou=people,dc=example,dc=com" {
+		t.Errorf("fallback id = %q, want lowercased DN", got)
+	}
+}
+
+func TestLDAPAuthenticate_RejectsEmptyPassword(t *testing.T) {
+	// Must fail before dialing: an empty password would be an
+	// unauthenticated bind that many servers accept.
+	c := &LDAPConfig{URL: "ldap://127.0.0.1:1"}
+	if _, err := c.Authenticate("alice", ""); err != ErrLDAPInvalidCredentials {
+		t.Errorf("err = %v, want ErrLDAPInvalidCredentials", err)
+	}
+}
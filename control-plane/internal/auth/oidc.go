@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+)
+
+// AuthSourceOIDC marks users provisioned through OpenID Connect.
+const AuthSourceOIDC = "oidc"
+
+// OIDCConfig configures the OpenID Connect login flow.
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	Scopes        []string
+	UsernameClaim string
+	GroupsClaim   string
+	AllowedGroups []string
+	ProvisionOpts ProvisionOptions
+	ProviderName  string
+	RedirectURL   string // empty: derived from the request by the handler
+	mu            sync.Mutex
+	provider      *oidc.Provider
+}
+
+// OIDC is the configured provider, or nil when SSO is off.
+var OIDC *OIDCConfig
+
+// InitOIDC builds OIDC from config.Cfg. Discovery is deferred to the first
+// login so an unreachable IdP does not stop the control plane from booting.
+func InitOIDC() error {
+	cfg := config.Cfg
+	if cfg.OIDCIssuer == "" {
+		OIDC = nil
+		return nil
+	}
+	if cfg.OIDCClientID == "" {
+		return errors.New("CLAWORC_OIDC_CLIENT_ID is required when CLAWORC_OIDC_ISSUER is set")
+	}
+	teams, err := ParseTeamMappings(cfg.OIDCTeamMappings)
+	if err != nil {
+		return fmt.Errorf("CLAWORC_OIDC_TEAM_MAPPINGS: %w", err)
+	}
+	OIDC = &OIDCConfig{
+		Issuer:        cfg.OIDCIssuer,
+		ClientID:      cfg.OIDCClientID,
+		ClientSecret:  cfg.OIDCClientSecret,
+		Scopes:        cfg.OIDCScopes,
+		UsernameClaim: cfg.OIDCUsernameClaim,
+		GroupsClaim:   cfg.OIDCGroupsClaim,
+		AllowedGroups: cfg.OIDCAllowedGroups,
+		ProviderName:  cfg.OIDCProviderName,
+		RedirectURL:   cfg.OIDCRedirectURL,
+		ProvisionOpts: ProvisionOptions{
+			AutoCreate:     cfg.OIDCAutoCreate,
+			LinkByUsername: cfg.OIDCLinkByUsername,
+			Mapping:        GroupMapping{AdminGroups: cfg.OIDCAdminGroups, Teams: teams},
+		},
+	}
+	return nil
+}
+
+// discover fetches and caches the issuer's discovery document. A failed
+// attempt is retried on the next login.
+func (c *OIDCConfig) discover(ctx context.Context) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	p, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	c.provider = p
+	return p, nil
+}
+
+func (c *OIDCConfig) oauth2Config(p *oidc.Provider, redirectURL string) *oauth2.Config {
+	scopes := c.Scopes
+	if !containsFold(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint:     p.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// OIDCFlow is the per-login state kept in a short-lived cookie between the
+// redirect to the IdP and the callback.
+type OIDCFlow struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Redirect string `json:"r"`
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewOIDCFlow starts a login: it returns the IdP authorization URL (auth
+// code flow with PKCE S256 and a nonce) and the state to keep until the
+// callback.
+func (c *OIDCConfig) NewOIDCFlow(ctx context.Context, redirectURL, returnTo string) (string, *OIDCFlow, error) {
+	p, err := c.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	flow := &OIDCFlow{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: returnTo,
+	}
+	u := c.oauth2Config(p, redirectURL).AuthCodeURL(flow.State,
+		oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+	return u, flow, nil
+}
+
+// ErrOIDCGroupDenied is returned when the user is in none of the allowed
+// groups.
+var ErrOIDCGroupDenied = errors.New("not a member of an allowed group")
+
+// CompleteOIDCFlow exchanges the authorization code, verifies the ID token
+// and returns the identity it asserts. Groups come from the ID token, or
+// from the userinfo endpoint when the token does not carry them.
+func (c *OIDCConfig) CompleteOIDCFlow(ctx context.Context, redirectURL, code string, flow *OIDCFlow) (*ExternalIdentity, error) {
+	p, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oc := c.oauth2Config(p, redirectURL)
+	tok, err := oc.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange: %w", err)
+	}
+	rawID, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idTok, err := p.Verifier(&oidc.Config{ClientID: c.ClientID}).Verify(ctx, rawID)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if idTok.Nonce != flow.Nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idTok.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+	if _, ok := claims[c.GroupsClaim]; !ok && p.UserInfoEndpoint() != "" {
+		if info, err := p.UserInfo(ctx, oauth2.StaticTokenSource(tok)); err == nil {
+			var extra map[string]interface{}
+			if info.Claims(&extra) == nil {
+				for k, v := range extra {
+					if _, exists := claims[k]; !exists {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	id := &ExternalIdentity{
+		Source:     AuthSourceOIDC,
+		ExternalID: idTok.Issuer + "|" + idTok.Subject,
+		Username:   claimString(claims, c.UsernameClaim),
+		Groups:     claimStrings(claims, c.GroupsClaim),
+	}
+	if id.Username == "" {
+		id.Username = claimString(claims, "email")
+	}
+	if id.Username == "" {
+		id.Username = idTok.Subject
+	}
+	if len(id.Username) > 64 {
+		return nil, fmt.Errorf("username %q is longer than 64 characters", id.Username)
+	}
+	if len(c.AllowedGroups) > 0 && !memberOfAny(id.Groups, c.AllowedGroups) {
+		return nil, ErrOIDCGroupDenied
+	}
+	return id, nil
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return strings.TrimSpace(s)
+}
+
+// claimStrings reads a claim that IdPs send either as a string array or as
+// a single (possibly comma-separated) string.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth/mockidp"
+)
+
+const testRedirectURL = "http://claworc.test/api/v1/auth/oidc/callback"
+
+func startMockIdP(t *testing.T) (*mockidp.IdP, *OIDCConfig) {
+	t.Helper()
+	idp := mockidp.New("", "claworc", "secret")
+	srv := httptest.NewServer(idp)
+	t.Cleanup(srv.Close)
+	idp.Issuer = srv.URL
+	return idp, &OIDCConfig{
+		Issuer:        srv.URL,
+		ClientID:      "claworc",
+		ClientSecret:  "secret",
+		Scopes:        []string{"profile", "email"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+	}
+}
+
+// runFlow drives the browser side: follow the authorization URL and return
+// the code and state from the redirect back to Claworc.
+func runFlow(t *testing.T, c *OIDCConfig) (code string, flow *OIDCFlow) {
+	t.Helper()
+	authURL, flow, err := c.NewOIDCFlow(context.Background(), testRedirectURL, "/instances")
+	if err != nil {
+		t.Fatalf("NewOIDCFlow: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", resp.StatusCode)
+	}
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	if loc.Query().Get("state") != flow.State {
+		t.Fatalf("state = %q, want %q", loc.Query().Get("state"), flow.State)
+	}
+	return loc.Query().Get("code"), flow
+}
+
+func TestOIDCFlow_CompletesWithPKCE(t *testing.T) {
+	idp, c := startMockIdP(t)
+	idp.SetIdentity(map[string]interface{}{
+		"sub": "abc", "preferred_username": "alice", "groups": []string{"eng", "admins"},
+	}, false)
+
+	code, flow := runFlow(t, c)
+	id, err := c.CompleteOIDCFlow(context.Background(), testRedirectURL, code, flow)
+	if err != nil {
+		t.Fatalf("CompleteOIDCFlow: %v", err)
+	}
+	if id.Username != "alice" || id.ExternalID != c.Issuer+"|abc" || len(id.Groups) != 2 {
+		t.Errorf("identity = %+v", id)
+	}
+}
+
+func TestOIDCFlow_WrongVerifierRejected(t *testing.T) {
+	_, c := startMockIdP(t)
+	code, flow := runFlow(t, c)
+	flow.Verifier = "not-the-verifier-not-the-verifier-not-the-verifier"
+	if _, err := c.CompleteOIDCFlow(context.Background(), testRedirectURL, code, flow); err == nil {
+		t.Fatal("exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCFlow_GroupsFromUserinfo(t *testing.T) {
+	idp, c := startMockIdP(t)
+	idp.SetIdentity(map[string]interface{}{
+		"sub": "abc", "email": "bob@example.com", "groups": []string{"eng"},
+	}, true)
+
+	code, flow := runFlow(t, c)
+	id, err := c.CompleteOIDCFlow(context.Background(), testRedirectURL, code, flow)
+	if err != nil {
+		t.Fatalf("CompleteOIDCFlow: %v", err)
+	}
+	if id.Username != "bob@example.com" {
+		t.Errorf("username = %q, want email fallback", id.Username)
+	}
+	if len(id.Groups) != 1 || id.Groups[0] != "eng" {
+		t.Errorf("groups = %v, want [eng] from userinfo", id.Groups)
+	}
+}
+
+func TestOIDCFlow_AllowedGroups(t *testing.T) {
+	idp, c := startMockIdP(t)
+	c.AllowedGroups = []string{"claworc-users"}
+	idp.SetIdentity(map[string]interface{}{"sub": "abc", "groups": []string{"eng"}}, false)
+
+	code, flow := runFlow(t, c)
+	_, err := c.CompleteOIDCFlow(context.Background(), testRedirectURL, code, flow)
+	if !errors.Is(err, ErrOIDCGroupDenied) {
+		t.Fatalf("err = %v, want ErrOIDCGroupDenied", err)
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// dbSessionBackend stores sessions in the user_sessions table of the main
+// database (SQLite, Postgres or MySQL), so logins survive restarts and every
+// replica sharing the database sees the same sessions.
+type dbSessionBackend struct {
+	db *gorm.DB
+}
+
+// NewDBSessionBackend returns a SessionBackend backed by db.
+func NewDBSessionBackend(db *gorm.DB) SessionBackend {
+	return &dbSessionBackend{db: db}
+}
+
+func toSession(row database.UserSession) Session {
+	return Session{
+		ID:         row.ID,
+		UserID:     row.UserID,
+		UserAgent:  row.UserAgent,
+		IPAddress:  row.IPAddress,
+		CreatedAt:  row.CreatedAt,
+		LastSeenAt: row.LastSeenAt,
+		ExpiresAt:  row.ExpiresAt,
+	}
+}
+
+func (b *dbSessionBackend) Save(s Session) error {
+	return b.db.Create(&database.UserSession{
+		ID:         s.ID,
+		UserID:     s.UserID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}).Error
+}
+
+func (b *dbSessionBackend) Load(id string) (Session, bool) {
+	var rows []database.UserSession
+	if err := b.db.Where("id = ?", id).Limit(1).Find(&rows).Error; err != nil {
+		log.Printf("session store: load: %v", err)
+		return Session{}, false
+	}
+	if len(rows) == 0 {
+		return Session{}, false
+	}
+	return toSession(rows[0]), true
+}
+
+func (b *dbSessionBackend) Touch(id string, at time.Time) {
+	if err := b.db.Model(&database.UserSession{}).Where("id = ?", id).Update("last_seen_at", at).Error; err != nil {
+		log.Printf("session store: touch: %v", err)
+	}
+}
+
+func (b *dbSessionBackend) Delete(id string) {
+	if err := b.db.Where("id = ?", id).Delete(&database.UserSession{}).Error; err != nil {
+		log.Printf("session store: delete: %v", err)
+	}
+}
+
+func (b *dbSessionBackend) DeleteByUserID(userID uint, exceptID string) {
+	q := b.db.Where("user_id = ?", userID)
+	if exceptID != "" {
+		q = q.Where("id <> ?", exceptID)
+	}
+	if err := q.Delete(&database.UserSession{}).Error; err != nil {
+		log.Printf("session store: delete user %d sessions: %v", userID, err)
+	}
+}
+
+func (b *dbSessionBackend) ListByUserID(userID uint) []Session {
+	var rows []database.UserSession
+	if err := b.db.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		log.Printf("session store: list: %v", err)
+		return nil
+	}
+	out := make([]Session, len(rows))
+	for i, row := range rows {
+		out[i] = toSession(row)
+	}
+	return out
+}
+
+func (b *dbSessionBackend) DeleteExpired(now time.Time) {
+	if err := b.db.Where("expires_at < ?", now).Delete(&database.UserSession{}).Error; err != nil {
+		log.Printf("session store: cleanup: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func openSessionDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:sessions_%s_%p?mode=memory&cache=shared", t.Name(), t)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&database.UserSession{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestDBSessionBackend_SurvivesRestart(t *testing.T) {
+	db := openSessionDB(t)
+	token, err := NewSessionStoreWithBackend(NewDBSessionBackend(db)).CreateWithInfo(7, "curl/8", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var row database.UserSession
+	db.First(&row)
+	if row.ID != HashSessionToken(token) {
+		t.Errorf("stored ID = %q, want token hash", row.ID)
+	}
+
+	// A second store on the same database, as after a restart or on
+	// another replica, sees the session.
+	store := NewSessionStoreWithBackend(NewDBSessionBackend(db))
+	if uid, ok := store.Get(token); !ok || uid != 7 {
+		t.Fatalf("Get = %d, %v; want 7, true", uid, ok)
+	}
+	if got := store.ListByUserID(7); len(got) != 1 || got[0].UserAgent != "curl/8" {
+		t.Errorf("ListByUserID = %+v", got)
+	}
+
+	store.Delete(token)
+	if _, ok := store.Get(token); ok {
+		t.Error("Get returned true after Delete")
+	}
+}
+
+func TestDBSessionBackend_DeleteByUserAndCleanup(t *testing.T) {
+	db := openSessionDB(t)
+	store := NewSessionStoreWithBackend(NewDBSessionBackend(db))
+	keep, _ := store.Create(1)
+	drop, _ := store.Create(1)
+	other, _ := store.Create(2)
+	expired, _ := store.Create(3)
+	db.Model(&database.UserSession{}).Where("id = ?", HashSessionToken(expired)).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	store.DeleteByUserIDExcept(1, keep)
+	if _, ok := store.Get(drop); ok {
+		t.Error("session should have been deleted")
+	}
+	if _, ok := store.Get(keep); !ok {
+		t.Error("excepted session should remain")
+	}
+	if _, ok := store.Get(other); !ok {
+		t.Error("another user's session should remain")
+	}
+	if _, ok := store.Get(expired); ok {
+		t.Error("expired session should not resolve")
+	}
+
+	store.Cleanup()
+	var n int64
+	db.Model(&database.UserSession{}).Count(&n)
+	if n != 2 {
+		t.Errorf("sessions after cleanup = %d, want 2 (keep, other)", n)
+	}
+}
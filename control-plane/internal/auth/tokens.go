@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// AuthSourceService marks API-only service accounts. They have no password
+// and authenticate exclusively with API tokens.
+const AuthSourceService = "service"
+
+// APITokenPrefix starts every API token, so leaked tokens are easy to spot
+// in logs and secret scanners.
+const APITokenPrefix = "clw_"
+
+// API token scopes. A token acts as its owner and can never exceed the
+// owner's role; scopes only narrow what it may touch.
+const (
+	ScopeInstancesRead  = "instances:read"
+	ScopeInstancesWrite = "instances:write" // implies instances:read
+	ScopeBackups        = "backups"
+	ScopeLLMAdmin       = "llm:admin"
+	ScopeAll            = "all" // everything the owner can do
+)
+
+// Scopes lists every valid scope, for validation and the UI.
+var Scopes = []string{ScopeInstancesRead, ScopeInstancesWrite, ScopeBackups, ScopeLLMAdmin, ScopeAll}
+
+// IsValidScope reports whether s is a known scope.
+func IsValidScope(s string) bool {
+	for _, v := range Scopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateAPIToken returns a new random token and the hash to store for it.
+func GenerateAPIToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashSessionToken(token), nil
+}
+
+// ScopeAllows reports whether a token holding granted may make a request
+// that needs required. An empty required scope is satisfied by any token.
+func ScopeAllows(granted []string, required string) bool {
+	if required == "" {
+		return true
+	}
+	for _, g := range granted {
+		if g == ScopeAll || g == required {
+			return true
+		}
+		if g == ScopeInstancesWrite && required == ScopeInstancesRead {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiredScope returns the scope a token needs for method and path
+// (with or without the /api/v1 prefix). Anything not covered by a narrower
+// scope, including token management itself, needs ScopeAll, so a scoped
+// token cannot mint a broader one.
+func RequiredScope(method, path string) string {
+	p := strings.TrimPrefix(path, "/api/v1")
+	read := method == http.MethodGet || method == http.MethodHead
+	switch {
+	case p == "/auth/me":
+		return ""
+	// The Control UI proxy and desktop take arbitrary trailing paths, so
+	// they go first: a path naming backups or LLM routes under them is
+	// still the instance's UI.
+	case strings.HasPrefix(p, "/openclaw/"), interactiveInstancePath(p):
+		return ScopeInstancesWrite
+	case underPath(p, "/backups"), underPath(p, "/backup-schedules"), instanceSubresource(p) == "backups":
+		return ScopeBackups
+	case strings.HasPrefix(p, "/llm/"), instanceSubresource(p) == "llm-fallbacks", instanceSubresource(p) == "llm-capture":
+		return ScopeLLMAdmin
+	case strings.HasPrefix(p, "/instances"), strings.HasPrefix(p, "/tasks"):
+		if read {
+			return ScopeInstancesRead
+		}
+		return ScopeInstancesWrite
+	case p == "/teams" && read:
+		return ScopeInstancesRead
+	}
+	return ScopeAll
+}
+
+// underPath reports whether p is prefix itself or a path below it.
+func underPath(p, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// instanceSubresource returns the segment after /instances/{id}/ in p, or
+// "" when p is not below an instance.
+func instanceSubresource(p string) string {
+	rest, ok := strings.CutPrefix(p, "/instances/")
+	if !ok {
+		return ""
+	}
+	_, sub, _ := strings.Cut(rest, "/")
+	sub, _, _ = strings.Cut(sub, "/")
+	return sub
+}
+
+// interactiveInstancePath reports whether p is an instance route that is a
+// GET or WebSocket upgrade but drives the instance: the chat, the terminal
+// and the desktop. Like the Control UI proxy they need write access.
+func interactiveInstancePath(p string) bool {
+	rest, ok := strings.CutPrefix(p, "/instances/")
+	if !ok {
+		return false
+	}
+	_, sub, _ := strings.Cut(rest, "/")
+	return sub == "chat" || sub == "terminal" || strings.HasPrefix(sub, "desktop/")
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIToken(t *testing.T) {
+	tok, hash, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(tok, APITokenPrefix) || len(tok) < 40 {
+		t.Errorf("token = %q", tok)
+	}
+	if hash != HashSessionToken(tok) {
+		t.Errorf("hash does not match token")
+	}
+	other, _, _ := GenerateAPIToken()
+	if other == tok {
+		t.Errorf("tokens repeat")
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	for _, tc := range []struct {
+		method, path, want string
+	}{
+		{"GET", "/api/v1/auth/me", ""},
+		{"GET", "/api/v1/instances", ScopeInstancesRead},
+		{"GET", "/api/v1/instances/3/logs", ScopeInstancesRead},
+		{"POST", "/api/v1/instances/3/restart", ScopeInstancesWrite},
+		{"DELETE", "/api/v1/instances/3", ScopeInstancesWrite},
+		{"GET", "/api/v1/tasks/abc", ScopeInstancesRead},
+		{"GET", "/api/v1/teams", ScopeInstancesRead},
+		{"POST", "/api/v1/teams", ScopeAll},
+		{"GET", "/openclaw/3/", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/chat", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/terminal", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/terminal/sessions", ScopeInstancesRead},
+		{"GET", "/api/v1/instances/3/desktop/vnc.html", ScopeInstancesWrite},
+		{"POST", "/api/v1/instances/3/backups", ScopeBackups},
+		{"GET", "/api/v1/backups/7/download", ScopeBackups},
+		{"PUT", "/api/v1/backup-schedules/1", ScopeBackups},
+		{"GET", "/api/v1/llm/usage", ScopeLLMAdmin},
+		{"PUT", "/api/v1/instances/3/llm-fallbacks/2", ScopeLLMAdmin},
+		{"GET", "/api/v1/backups", ScopeBackups},
+		{"POST", "/api/v1/backups/7/restore", ScopeBackups},
+		{"GET", "/api/v1/instances/3/llm-capture", ScopeLLMAdmin},
+		{"POST", "/api/v1/auth/tokens", ScopeAll},
+		{"GET", "/api/v1/users", ScopeAll},
+	} {
+		if got := RequiredScope(tc.method, tc.path); got != tc.want {
+			t.Errorf("RequiredScope(%s %s) = %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+// Paths that merely contain "backup" or "llm-" must not let a narrow token
+// into the Control UI proxy, the desktop or unrelated routes.
+func TestRequiredScope_NoSubstringBypass(t *testing.T) {
+	for _, tc := range []struct {
+		method, path, want string
+	}{
+		{"GET", "/openclaw/3/backup", ScopeInstancesWrite},
+		{"POST", "/openclaw/3/api/backups/run", ScopeInstancesWrite},
+		{"GET", "/openclaw/3/llm-settings", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/desktop/backup.html", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/desktop/llm-config", ScopeInstancesWrite},
+		{"POST", "/api/v1/instances/3/files/backup.tar", ScopeInstancesWrite},
+		{"GET", "/api/v1/instances/3/llm-other", ScopeInstancesRead},
+		{"GET", "/api/v1/backupsx", ScopeAll},
+		{"GET", "/api/v1/settings/llm-defaults", ScopeAll},
+	} {
+		if got := RequiredScope(tc.method, tc.path); got != tc.want {
+			t.Errorf("RequiredScope(%s %s) = %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+	if ScopeAllows([]string{ScopeBackups}, RequiredScope("GET", "/openclaw/3/backup")) ||
+		ScopeAllows([]string{ScopeLLMAdmin}, RequiredScope("GET", "/openclaw/3/llm-x")) {
+		t.Error("SECURITY: a backups or llm:admin token reaches the Control UI proxy")
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	for _, tc := range []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{nil, "", true},
+		{[]string{ScopeInstancesRead}, ScopeInstancesRead, true},
+		{[]string{ScopeInstancesRead}, ScopeInstancesWrite, false},
+		{[]string{ScopeInstancesWrite}, ScopeInstancesRead, true},
+		{[]string{ScopeBackups}, ScopeLLMAdmin, false},
+		{[]string{ScopeBackups, ScopeLLMAdmin}, ScopeLLMAdmin, true},
+		{[]string{ScopeAll}, ScopeAll, true},
+		{[]string{ScopeInstancesWrite, ScopeBackups, ScopeLLMAdmin}, ScopeAll, false},
+	} {
+		if got := ScopeAllows(tc.granted, tc.required); got != tc.want {
+			t.Errorf("ScopeAllows(%v, %q) = %v, want %v", tc.granted, tc.required, got, tc.want)
+		}
+	}
+}
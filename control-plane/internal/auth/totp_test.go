@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	enr, err := GenerateTOTP("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enr.URL, "otpauth://totp/Claworc:alice?") || !strings.Contains(enr.URL, "secret="+enr.Secret) {
+		t.Errorf("URL = %q", enr.URL)
+	}
+	if !strings.HasPrefix(enr.QRCodePNG, "data:image/png;base64,") {
+		t.Errorf("QR code is not a PNG data URL")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	enr, _ := GenerateTOTP("alice")
+	now := time.Unix(1_700_000_000, 0)
+
+	for _, skew := range []time.Duration{0, -30 * time.Second, 30 * time.Second} {
+		code, _ := totp.GenerateCode(enr.Secret, now.Add(skew))
+		step, ok := ValidateTOTP(enr.Secret, code, now)
+		if !ok {
+			t.Errorf("skew %v: code rejected", skew)
+		}
+		if want := now.Add(skew).Unix() / 30; step != want {
+			t.Errorf("skew %v: step = %d, want %d", skew, step, want)
+		}
+	}
+
+	old, _ := totp.GenerateCode(enr.Secret, now.Add(-2*time.Minute))
+	if _, ok := ValidateTOTP(enr.Secret, old, now); ok {
+		t.Errorf("stale code accepted")
+	}
+	if _, ok := ValidateTOTP(enr.Secret, "", now); ok {
+		t.Errorf("empty code accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, c := range codes {
+		if len(c) != 11 || c[5] != '-' {
+			t.Errorf("code %q is not XXXXX-XXXXX", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+		if HashRecoveryCode(c) != hashes[i] {
+			t.Errorf("hash mismatch for %q", c)
+		}
+	}
+	// Entry is forgiving about case, dashes and spaces.
+	loose := strings.ToLower(strings.Replace(codes[0], "-", " ", 1))
+	if HashRecoveryCode(loose) != hashes[0] {
+		t.Errorf("normalised code %q did not match", loose)
+	}
+}
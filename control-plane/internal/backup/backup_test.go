@@ -22,6 +22,7 @@ import (
 
 type mockOrch struct {
 	streamFn func(ctx context.Context, name string, cmd []string, stdout io.Writer) (string, int, error)
+	execFn   func(ctx context.Context, name string, cmd []string) (string, string, int, error)
 }
 
 func (m *mockOrch) Initialize(_ context.Context) error                                  { return nil }
@@ -37,11 +38,13 @@ func (m *mockOrch) RestartInstance(_ context.Context, _ string, _ orchestrator.C
 func (m *mockOrch) GetInstanceStatus(_ context.Context, _ string) (string, error) {
 	return "running", nil
 }
+func (m *mockOrch) InstanceExists(_ context.Context, _ string) (bool, error)         { return true, nil }
 func (m *mockOrch) GetInstanceImageInfo(_ context.Context, _ string) (string, error) { return "", nil }
 func (m *mockOrch) UpdateInstanceConfig(_ context.Context, _, _ string) error        { return nil }
 func (m *mockOrch) CloneVolumes(_ context.Context, _, _ string) error                { return nil }
 func (m *mockOrch) ConfigureSSHAccess(_ context.Context, _ uint, _ string) error     { return nil }
 func (m *mockOrch) GetSSHAddress(_ context.Context, _ uint) (string, int, error)     { return "", 0, nil }
+func (m *mockOrch) ReadSSHHostKeys(_ context.Context, _ uint) ([]string, error)      { return nil, nil }
 func (m *mockOrch) UpdateResources(_ context.Context, _ string, _ orchestrator.UpdateResourcesParams) error {
 	return nil
 }
@@ -51,7 +54,10 @@ func (m *mockOrch) GetContainerStats(_ context.Context, _ string) (*orchestrator
 func (m *mockOrch) UpdateImage(_ context.Context, _ string, _ orchestrator.CreateParams) error {
 	return nil
 }
-func (m *mockOrch) ExecInInstance(_ context.Context, _ string, _ []string) (string, string, int, error) {
+func (m *mockOrch) ExecInInstance(ctx context.Context, name string, cmd []string) (string, string, int, error) {
+	if m.execFn != nil {
+		return m.execFn(ctx, name, cmd)
+	}
 	return "", "", 0, nil
 }
 func (m *mockOrch) StreamExecInInstance(ctx context.Context, name string, cmd []string, stdout io.Writer) (string, int, error) {
@@ -63,9 +69,9 @@ func (m *mockOrch) StreamExecInInstance(ctx context.Context, name string, cmd []
 func (m *mockOrch) UpdatePlacementConfig(_ context.Context, _ string, _ orchestrator.UpdatePlacementParams) error {
 	return nil
 }
-func (m *mockOrch) DeleteSharedVolume(_ context.Context, _ uint) error { return nil }
-func (m *mockOrch) CloneVolume(_ context.Context, _, _ string) error    { return nil }
-func (m *mockOrch) VolumeNameFor(name, suffix string) string            { return name + "-" + suffix }
+func (m *mockOrch) DeleteSharedVolume(_ context.Context, _ uint) error                  { return nil }
+func (m *mockOrch) CloneVolume(_ context.Context, _, _ string) error                    { return nil }
+func (m *mockOrch) VolumeNameFor(name, suffix string) string                            { return name + "-" + suffix }
 func (m *mockOrch) Apply(_ context.Context, _ orchestrator.WorkloadSpec) error          { return nil }
 func (m *mockOrch) DeleteWorkload(_ context.Context, _ orchestrator.WorkloadSpec) error { return nil }
 func (m *mockOrch) EnsureSSHAccess(_ context.Context, _, _ string) error                { return nil }
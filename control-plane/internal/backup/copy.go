@@ -0,0 +1,47 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+)
+
+// CopyPaths copies the given paths from the instance named instanceName on
+// src to the same-named instance on dst, using the same tar/exec path as
+// backups and restores. Nothing is staged on the control plane: the tar
+// stream is gzipped and uploaded to dst while it is being read from src.
+// Both instances must be running.
+func CopyPaths(ctx context.Context, src, dst orchestrator.ContainerOrchestrator, instanceName string, paths []string) error {
+	pr, pw := io.Pipe()
+	srcErr := make(chan error, 1)
+	go func() {
+		gw := gzip.NewWriter(pw)
+		stderr, exitCode, err := src.StreamExecInInstance(ctx, instanceName, buildTarCommand(paths), gw)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("stream exec: %w", err)
+		// tar may exit with code 1 for "file changed as we read it" — acceptable
+		case exitCode > 1:
+			err = fmt.Errorf("tar exited with code %d: %s", exitCode, stderr)
+		default:
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+		srcErr <- err
+	}()
+
+	err := extractArchive(ctx, dst, instanceName, pr)
+	// If the upload stopped early, fail the source's pending writes so its
+	// exec returns instead of blocking on the pipe.
+	pr.Close()
+	if readErr := <-srcErr; err == nil && readErr != nil {
+		err = readErr
+	}
+	if err != nil {
+		return fmt.Errorf("copy %s: %w", instanceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// uploadRecorder is the destination side of a copy: it decodes the base64
+// chunks written by extractArchive and records whether extraction ran.
+type uploadRecorder struct {
+	archive   bytes.Buffer
+	extracted bool
+}
+
+func (u *uploadRecorder) exec(_ context.Context, _ string, cmd []string) (string, string, int, error) {
+	sh := cmd[2]
+	switch {
+	case strings.HasPrefix(sh, "echo '"):
+		encoded := strings.TrimPrefix(sh, "echo '")
+		encoded = encoded[:strings.Index(encoded, "'")]
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", err.Error(), 1, nil
+		}
+		u.archive.Write(raw)
+	case strings.HasPrefix(sh, "tar xzf"):
+		u.extracted = true
+	}
+	return "", "", 0, nil
+}
+
+func TestCopyPaths_StreamsArchiveToDestination(t *testing.T) {
+	// Incompressible and larger than one chunk, written in small pieces the
+	// way an exec stream delivers it.
+	payload := make([]byte, 150*1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	var srcCmd []string
+	src := &mockOrch{
+		streamFn: func(_ context.Context, _ string, cmd []string, stdout io.Writer) (string, int, error) {
+			srcCmd = cmd
+			for p := payload; len(p) > 0; p = p[min(len(p), 1000):] {
+				stdout.Write(p[:min(len(p), 1000)])
+			}
+			return "", 1, nil
+		},
+	}
+	rec := &uploadRecorder{}
+	dst := &mockOrch{execFn: rec.exec}
+
+	if err := CopyPaths(context.Background(), src, dst, "bot", []string{"/home/claworc"}); err != nil {
+		t.Fatalf("CopyPaths: %v", err)
+	}
+	if !strings.Contains(srcCmd[2], "/home/claworc") {
+		t.Errorf("source tar command = %q, want the requested path", srcCmd[2])
+	}
+	if !rec.extracted {
+		t.Error("archive was not extracted on the destination")
+	}
+	gr, err := gzip.NewReader(&rec.archive)
+	if err != nil {
+		t.Fatalf("uploaded archive is not gzip: %v", err)
+	}
+	got, _ := io.ReadAll(gr)
+	if !bytes.Equal(got, payload) {
+		t.Errorf("uploaded %d bytes, want the %d bytes tar wrote", len(got), len(payload))
+	}
+}
+
+func TestCopyPaths_SourceFailureSkipsExtract(t *testing.T) {
+	src := &mockOrch{
+		streamFn: func(_ context.Context, _ string, _ []string, stdout io.Writer) (string, int, error) {
+			stdout.Write([]byte("partial"))
+			return "tar: write error", 2, nil
+		},
+	}
+	rec := &uploadRecorder{}
+	dst := &mockOrch{execFn: rec.exec}
+
+	err := CopyPaths(context.Background(), src, dst, "bot", []string{"/home/claworc"})
+	if err == nil || !strings.Contains(err.Error(), "code 2") {
+		t.Fatalf("err = %v, want the tar exit code", err)
+	}
+	if rec.extracted {
+		t.Error("a truncated archive must not be extracted")
+	}
+}
+
+func TestCopyPaths_UploadFailureStopsSource(t *testing.T) {
+	src := &mockOrch{
+		streamFn: func(_ context.Context, _ string, _ []string, stdout io.Writer) (string, int, error) {
+			chunk := make([]byte, 64*1024)
+			for {
+				if _, err := stdout.Write(chunk); err != nil {
+					return "", 0, err
+				}
+			}
+		},
+	}
+	dst := &mockOrch{execFn: func(_ context.Context, _ string, cmd []string) (string, string, int, error) {
+		if strings.HasPrefix(cmd[2], "echo '") {
+			return "", "No space left on device", 1, nil
+		}
+		return "", "", 0, nil
+	}}
+
+	err := CopyPaths(context.Background(), src, dst, "bot", []string{"/home/claworc"})
+	if err == nil || !strings.Contains(err.Error(), "No space left") {
+		t.Fatalf("err = %v, want the destination's write error", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -46,6 +47,13 @@ func restoreArchive(ctx context.Context, orch orchestrator.ContainerOrchestrator
 	}
 	defer f.Close()
 
+	return extractArchive(ctx, orch, instanceName, f)
+}
+
+// extractArchive uploads the tar.gz stream r to the container and extracts it
+// into the root filesystem. r may be a pipe: it is read until EOF, and any
+// other read error aborts the upload.
+func extractArchive(ctx context.Context, orch orchestrator.ContainerOrchestrator, instanceName string, r io.Reader) error {
 	tmpPath := "/tmp/_claworc_restore.tar.gz"
 
 	// Clean up any leftover temp file
@@ -56,7 +64,7 @@ func restoreArchive(ctx context.Context, orch orchestrator.ContainerOrchestrator
 	buf := make([]byte, chunkSize)
 
 	for {
-		n, readErr := f.Read(buf)
+		n, readErr := io.ReadFull(r, buf)
 		if n > 0 {
 			encoded := base64.StdEncoding.EncodeToString(buf[:n])
 			cmd := fmt.Sprintf("echo '%s' | base64 -d >> %s", encoded, tmpPath)
@@ -68,9 +76,12 @@ func restoreArchive(ctx context.Context, orch orchestrator.ContainerOrchestrator
 				return fmt.Errorf("write chunk failed (exit %d): %s", exitCode, stderr)
 			}
 		}
-		if readErr != nil {
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
 			break
 		}
+		if readErr != nil {
+			return fmt.Errorf("read archive: %w", readErr)
+		}
 	}
 
 	// Extract and clean up
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/notify"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
 	"github.com/robfig/cron/v3"
 )
@@ -81,6 +83,13 @@ func executeSchedule(ctx context.Context, orch orchestrator.ContainerOrchestrato
 		}
 		if _, err := CreateFullBackup(ctx, orch, inst.Name, inst.ID, 0, "scheduled", paths); err != nil {
 			log.Printf("backup scheduler: schedule %d: backup for instance %s failed: %v", s.ID, inst.Name, err)
+			notify.Publish(notify.Event{
+				Type:       notify.EventBackupFailed,
+				InstanceID: inst.ID,
+				Title:      "Scheduled backup failed",
+				Message:    err.Error(),
+				Details:    map[string]string{"schedule_id": strconv.FormatUint(uint64(s.ID), 10)},
+			})
 		}
 	}
 
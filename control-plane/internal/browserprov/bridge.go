@@ -93,6 +93,15 @@ func (b *BrowserBridge) Close() {
 	}
 }
 
+// providerName labels an instance's session with the provider serving it;
+// the local provider reports the backend that instance runs on.
+func providerName(p Provider, instanceID uint) string {
+	if l, ok := p.(*LocalProvider); ok {
+		return l.NameFor(instanceID)
+	}
+	return p.Name()
+}
+
 // EnsureSession is the single entry point: it returns when the provider's
 // session is in StatusRunning. If a session is already running, returns
 // immediately. If a spawn task is already inflight for this instance, blocks
@@ -107,7 +116,7 @@ func (b *BrowserBridge) EnsureSession(ctx context.Context, instanceID, userID ui
 		// Refresh DB row so the reaper doesn't miss a recently-created session.
 		_ = database.UpsertBrowserSession(&database.BrowserSession{
 			InstanceID: instanceID,
-			Provider:   b.provider.Name(),
+			Provider:   providerName(b.provider, instanceID),
 			Status:     "running",
 			LastUsedAt: time.Now().UTC(),
 		})
@@ -301,7 +310,7 @@ func (b *BrowserBridge) doSpawn(ctx context.Context, h *taskmanager.Handle, inst
 	now := time.Now().UTC()
 	_ = database.UpsertBrowserSession(&database.BrowserSession{
 		InstanceID: instanceID,
-		Provider:   b.provider.Name(),
+		Provider:   providerName(b.provider, instanceID),
 		Status:     "starting",
 		Image:      image,
 		PodName:    inst.Name + "-browser",
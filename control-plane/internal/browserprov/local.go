@@ -101,6 +101,15 @@ func (p *LocalProvider) Name() string {
 	return p.orch.BackendName()
 }
 
+// NameFor is Name for one instance: the backend that instance runs on,
+// which differs from the default backend for placement-target instances.
+func (p *LocalProvider) NameFor(instanceID uint) string {
+	if p.orch == nil {
+		return "local"
+	}
+	return orchestrator.BackendNameFor(p.orch, instanceID)
+}
+
 func (p *LocalProvider) Capabilities() Capabilities {
 	return Capabilities{
 		SupportsVNC:               true,
@@ -221,7 +230,7 @@ func (p *LocalProvider) EnsureSession(ctx context.Context, instanceID uint, para
 	host, port, _ := p.orch.WorkloadSSHAddress(ctx, browserWorkloadName(name))
 	return &Session{
 		InstanceID:  instanceID,
-		Provider:    p.Name(),
+		Provider:    p.NameFor(instanceID),
 		Status:      StatusRunning,
 		Image:       params.Image,
 		PodName:     browserWorkloadName(name),
@@ -106,7 +106,7 @@ func (m *Migrator) run(ctx context.Context, h *taskmanager.Handle, instanceID ui
 
 	provider, _ := database.GetSetting("default_browser_provider")
 	if provider == "" || provider == "auto" {
-		provider = m.orch.BackendName()
+		provider = orchestrator.BackendNameFor(m.orch, instanceID)
 	}
 
 	// Capture pre-migration values so we can revert the row if anything below
@@ -33,6 +33,15 @@ type Settings struct {
 	// LLM gateway settings
 	LLMGatewayPort int    `envconfig:"LLM_GATEWAY_PORT" default:"40001"`
 	LLMResponseLog string `envconfig:"LLM_RESPONSE_LOG" default:""`
+	// LLMFallbackTimeout bounds how long the gateway waits for response
+	// headers from a provider that still has fallback hops behind it before
+	// moving on to the next hop. The last hop in a chain uses the regular
+	// upstream timeout.
+	LLMFallbackTimeout time.Duration `envconfig:"LLM_FALLBACK_TIMEOUT" default:"60s"`
+	// LLMCacheMaxMB caps the memory used by the gateway response cache.
+	// Least recently used entries are evicted beyond it. Caching itself is
+	// enabled per provider (cache_ttl_seconds).
+	LLMCacheMaxMB int `envconfig:"LLM_CACHE_MAX_MB" default:"256"`
 
 	// SSH gateway settings. The gateway lets users `ssh <user>+<instance>@host`
 	// and be bridged onto the control plane's existing SSH connection to that
@@ -47,6 +56,73 @@ type Settings struct {
 	// on every frame received, so an actively-streaming agent is never cut off;
 	// only a genuine stall trips it.
 	WebhookIdleTimeout time.Duration `envconfig:"WEBHOOK_IDLE_TIMEOUT" default:"120s"`
+
+	// MetricsToken, when set, is required as a bearer token on GET /metrics.
+	// Empty leaves the endpoint open, for scrapers on a trusted network.
+	MetricsToken string `envconfig:"METRICS_TOKEN" default:""`
+
+	// OpenTelemetry tracing. OTLPEndpoint is an OTLP/HTTP collector URL
+	// (e.g. http://otel-collector:4318); empty disables tracing. OTLPHeaders
+	// are sent with every export, as key:value pairs separated by commas.
+	OTLPEndpoint       string            `envconfig:"OTLP_ENDPOINT" default:""`
+	OTLPHeaders        map[string]string `envconfig:"OTLP_HEADERS" default:""`
+	TracingServiceName string            `envconfig:"TRACING_SERVICE_NAME" default:"claworc-control-plane"`
+	TracingSampleRatio float64           `envconfig:"TRACING_SAMPLE_RATIO" default:"1"`
+
+	// SessionBackend selects where dashboard login sessions live: "database"
+	// (survives restarts, shared by replicas) or "memory".
+	SessionBackend string `envconfig:"SESSION_BACKEND" default:"database"`
+
+	// OpenID Connect single sign-on. Setting OIDCIssuer enables it.
+	// OIDCRedirectURL defaults to <request origin>/api/v1/auth/oidc/callback.
+	// OIDCTeamMappings is "group=Team Name:role" entries separated by ";"
+	// (role is user or manager, default user). See docs/auth.md.
+	OIDCIssuer         string   `envconfig:"OIDC_ISSUER" default:""`
+	OIDCClientID       string   `envconfig:"OIDC_CLIENT_ID" default:""`
+	OIDCClientSecret   string   `envconfig:"OIDC_CLIENT_SECRET" default:""`
+	OIDCRedirectURL    string   `envconfig:"OIDC_REDIRECT_URL" default:""`
+	OIDCScopes         []string `envconfig:"OIDC_SCOPES" default:"openid,profile,email"`
+	OIDCProviderName   string   `envconfig:"OIDC_PROVIDER_NAME" default:"SSO"`
+	OIDCUsernameClaim  string   `envconfig:"OIDC_USERNAME_CLAIM" default:"preferred_username"`
+	OIDCGroupsClaim    string   `envconfig:"OIDC_GROUPS_CLAIM" default:"groups"`
+	OIDCAllowedGroups  []string `envconfig:"OIDC_ALLOWED_GROUPS" default:""`
+	OIDCAdminGroups    []string `envconfig:"OIDC_ADMIN_GROUPS" default:""`
+	OIDCTeamMappings   string   `envconfig:"OIDC_TEAM_MAPPINGS" default:""`
+	OIDCAutoCreate     bool     `envconfig:"OIDC_AUTO_CREATE" default:"true"`
+	OIDCLinkByUsername bool     `envconfig:"OIDC_LINK_BY_USERNAME" default:"false"`
+
+	// LDAP / Active Directory password authentication. Setting LDAPURL
+	// enables it. Filters take {username} and, for groups, {dn}
+	// placeholders. With an empty LDAPGroupBaseDN groups are read from the
+	// user's memberOf attribute. LDAPSyncInterval of 0 disables the
+	// periodic directory sync. See docs/auth.md.
+	LDAPURL                string        `envconfig:"LDAP_URL" default:""`
+	LDAPStartTLS           bool          `envconfig:"LDAP_START_TLS" default:"false"`
+	LDAPInsecureSkipVerify bool          `envconfig:"LDAP_INSECURE_SKIP_VERIFY" default:"false"`
+	LDAPBindDN             string        `envconfig:"LDAP_BIND_DN" default:""`
+	LDAPBindPassword       string        `envconfig:"LDAP_BIND_PASSWORD" default:""`
+	LDAPUserBaseDN         string        `envconfig:"LDAP_USER_BASE_DN" default:""`
+	LDAPUserFilter         string        `envconfig:"LDAP_USER_FILTER" default:"(&(objectClass=person)(uid={username}))"`
+	LDAPUsernameAttribute  string        `envconfig:"LDAP_USERNAME_ATTRIBUTE" default:"uid"`
+	LDAPIDAttribute        string        `envconfig:"LDAP_ID_ATTRIBUTE" default:"entryUUID"`
+	LDAPGroupBaseDN        string        `envconfig:"LDAP_GROUP_BASE_DN" default:""`
+	LDAPGroupFilter        string        `envconfig:"LDAP_GROUP_FILTER" default:"(member={dn})"`
+	LDAPGroupNameAttribute string        `envconfig:"LDAP_GROUP_NAME_ATTRIBUTE" default:"cn"`
+	LDAPAllowedGroups      []string      `envconfig:"LDAP_ALLOWED_GROUPS" default:""`
+	LDAPAdminGroups        []string      `envconfig:"LDAP_ADMIN_GROUPS" default:""`
+	LDAPTeamMappings       string        `envconfig:"LDAP_TEAM_MAPPINGS" default:""`
+	LDAPCreateTeams        bool          `envconfig:"LDAP_CREATE_TEAMS" default:"true"`
+	LDAPAutoCreate         bool          `envconfig:"LDAP_AUTO_CREATE" default:"true"`
+	LDAPLinkByUsername     bool          `envconfig:"LDAP_LINK_BY_USERNAME" default:"false"`
+	LDAPSyncInterval       time.Duration `envconfig:"LDAP_SYNC_INTERVAL" default:"1h"`
+
+	// SMTP relay for email notification channels. Empty SMTPHost disables
+	// email delivery; webhook and Slack channels work without it.
+	SMTPHost     string `envconfig:"SMTP_HOST" default:""`
+	SMTPPort     int    `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME" default:""`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD" default:""`
+	SMTPFrom     string `envconfig:"SMTP_FROM" default:""`
 }
 
 var Cfg Settings
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// ParseAPITokenScopes splits an APIToken.Scopes value.
+func ParseAPITokenScopes(raw string) []string {
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ListAPITokens returns the tokens owned by userID, newest first.
+func ListAPITokens(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	if err := DB.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the token whose TokenHash is hash, or
+// gorm.ErrRecordNotFound.
+func GetAPITokenByHash(hash string) (*APIToken, error) {
+	var t APIToken
+	if err := DB.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateAPIToken inserts t.
+func CreateAPIToken(t *APIToken) error {
+	return DB.Create(t).Error
+}
+
+// DeleteAPIToken removes a token owned by userID and returns the deleted
+// row, or gorm.ErrRecordNotFound.
+func DeleteAPIToken(userID, tokenID uint) (*APIToken, error) {
+	var t APIToken
+	if err := DB.Where("id = ? AND user_id = ?", tokenID, userID).First(&t).Error; err != nil {
+		return nil, err
+	}
+	if err := DB.Delete(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TouchAPIToken records a use of the token.
+func TouchAPIToken(id uint, ip string) {
+	now := time.Now()
+	DB.Model(&APIToken{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_used_at": &now,
+		"last_used_ip": ip,
+	})
+}
+
+// ListServiceAccounts returns users with AuthSource "service".
+func ListServiceAccounts() ([]User, error) {
+	var users []User
+	if err := DB.Where("auth_source = ?", "service").Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,17 @@
+package database
+
+import "strconv"
+
+// AuditRetentionSetting is how many days dashboard/API audit entries are
+// kept ("0" = forever).
+const AuditRetentionSetting = "audit_retention_days"
+
+// AuditRetentionDays returns AuditRetentionSetting, defaulting to 365.
+func AuditRetentionDays() int {
+	if v, err := GetSetting(AuditRetentionSetting); err == nil {
+		if d, err := strconv.Atoi(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 365
+}
@@ -155,6 +155,7 @@ func seedDefaults() error {
 		"default_models":               "[]",
 		"ssh_key_rotation_policy_days": "90",
 		"ssh_audit_retention_days":     "90",
+		"llm_capture_retention_days":   "30",
 		"default_timezone":             "America/New_York",
 		"default_user_agent":           "",
 		"default_env_vars":             "{}",
@@ -237,6 +238,8 @@ func CreateUser(user *User) error {
 func DeleteUser(id uint) error {
 	DB.Where("user_id = ?", id).Delete(&UserInstance{})
 	DB.Where("user_id = ?", id).Delete(&WebAuthnCredential{})
+	DB.Where("user_id = ?", id).Delete(&APIToken{})
+	DB.Where("user_id = ?", id).Delete(&UserRecoveryCode{})
 	return DB.Delete(&User{}, id).Error
 }
 
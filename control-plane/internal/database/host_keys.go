@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HostKeyStore persists pinned instance SSH host keys. It satisfies
+// sshproxy.HostKeyStore.
+type HostKeyStore struct{}
+
+// LoadHostKey returns the pinned key for instanceID in authorized_keys
+// format, or "" when none is pinned.
+func (HostKeyStore) LoadHostKey(instanceID uint) (string, error) {
+	hk, err := GetInstanceHostKey(instanceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hk.PublicKey, nil
+}
+
+// SaveHostKey pins key for instanceID and clears any pending key.
+func (HostKeyStore) SaveHostKey(instanceID uint, key, fingerprint, source string) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "instance_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"public_key":          key,
+			"fingerprint":         fingerprint,
+			"source":              source,
+			"pending_key":         "",
+			"pending_fingerprint": "",
+			"pending_seen_at":     nil,
+			"updated_at":          time.Now(),
+		}),
+	}).Create(&InstanceHostKey{
+		InstanceID:  instanceID,
+		PublicKey:   key,
+		Fingerprint: fingerprint,
+		Source:      source,
+	}).Error
+}
+
+// RecordHostKeyMismatch parks a rejected key on the instance's row so an
+// admin can review and accept it.
+func (HostKeyStore) RecordHostKeyMismatch(instanceID uint, key, fingerprint string) error {
+	now := time.Now()
+	return DB.Model(&InstanceHostKey{}).Where("instance_id = ?", instanceID).Updates(map[string]interface{}{
+		"pending_key":         key,
+		"pending_fingerprint": fingerprint,
+		"pending_seen_at":     &now,
+	}).Error
+}
+
+// DeleteHostKey forgets the pinned key for instanceID.
+func (HostKeyStore) DeleteHostKey(instanceID uint) error {
+	return DB.Where("instance_id = ?", instanceID).Delete(&InstanceHostKey{}).Error
+}
+
+// GetInstanceHostKey returns the host key row for instanceID, or
+// gorm.ErrRecordNotFound.
+func GetInstanceHostKey(instanceID uint) (*InstanceHostKey, error) {
+	var hk InstanceHostKey
+	if err := DB.Where("instance_id = ?", instanceID).First(&hk).Error; err != nil {
+		return nil, err
+	}
+	return &hk, nil
+}
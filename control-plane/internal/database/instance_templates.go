@@ -0,0 +1,99 @@
+package database
+
+import "gorm.io/gorm"
+
+// ListInstanceTemplates returns the global templates plus those of the given
+// teams, or every template when all is true, ordered by name.
+func ListInstanceTemplates(teamIDs []uint, all bool) ([]InstanceTemplate, error) {
+	var templates []InstanceTemplate
+	q := DB.Order("name")
+	if !all {
+		if len(teamIDs) > 0 {
+			q = q.Where("team_id = 0 OR team_id IN ?", teamIDs)
+		} else {
+			q = q.Where("team_id = 0")
+		}
+	}
+	if err := q.Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetInstanceTemplate returns the template with the given ID, or
+// gorm.ErrRecordNotFound.
+func GetInstanceTemplate(id uint) (*InstanceTemplate, error) {
+	var t InstanceTemplate
+	if err := DB.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetInstanceTemplateVersion returns one version of a template, or
+// gorm.ErrRecordNotFound.
+func GetInstanceTemplateVersion(templateID uint, version int) (*InstanceTemplateVersion, error) {
+	var v InstanceTemplateVersion
+	if err := DB.Where("template_id = ? AND version = ?", templateID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListInstanceTemplateVersions returns a template's versions, newest first.
+func ListInstanceTemplateVersions(templateID uint) ([]InstanceTemplateVersion, error) {
+	var versions []InstanceTemplateVersion
+	if err := DB.Where("template_id = ?", templateID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// CreateInstanceTemplate inserts t together with its first version.
+func CreateInstanceTemplate(t *InstanceTemplate, spec InstanceTemplateSpec, createdBy string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		t.LatestVersion = 1
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return tx.Create(&InstanceTemplateVersion{
+			TemplateID: t.ID,
+			Version:    1,
+			Spec:       EncodeInstanceTemplateSpec(spec),
+			CreatedBy:  createdBy,
+		}).Error
+	})
+}
+
+// AddInstanceTemplateVersion stores spec as the next version of t and
+// updates t.LatestVersion.
+func AddInstanceTemplateVersion(t *InstanceTemplate, spec InstanceTemplateSpec, createdBy string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&InstanceTemplateVersion{}).Where("template_id = ?", t.ID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&InstanceTemplateVersion{
+			TemplateID: t.ID,
+			Version:    latest + 1,
+			Spec:       EncodeInstanceTemplateSpec(spec),
+			CreatedBy:  createdBy,
+		}).Error; err != nil {
+			return err
+		}
+		t.LatestVersion = latest + 1
+		return tx.Model(t).Update("latest_version", t.LatestVersion).Error
+	})
+}
+
+// DeleteInstanceTemplate removes a template and all its versions. Instances
+// created from it keep their template_id and template_version.
+func DeleteInstanceTemplate(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", id).Delete(&InstanceTemplateVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&InstanceTemplate{}, id).Error
+	})
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database/models"
+)
+
+// Budget scope re-exports so callers can write database.BudgetScopeTeam.
+const (
+	BudgetScopeInstance = models.BudgetScopeInstance
+	BudgetScopeTeam     = models.BudgetScopeTeam
+	BudgetScopeProvider = models.BudgetScopeProvider
+)
+
+// IsValidBudgetScope reports whether scope is one of the supported budget
+// scopes.
+func IsValidBudgetScope(scope string) bool {
+	switch scope {
+	case BudgetScopeInstance, BudgetScopeTeam, BudgetScopeProvider:
+		return true
+	}
+	return false
+}
+
+// ListLLMBudgets returns every configured budget ordered by scope then
+// scope ID.
+func ListLLMBudgets() ([]LLMBudget, error) {
+	var budgets []LLMBudget
+	if err := DB.Order("scope, scope_id").Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// GetLLMBudget returns the budget for the given scope, or
+// gorm.ErrRecordNotFound when none is configured.
+func GetLLMBudget(scope string, scopeID uint) (*LLMBudget, error) {
+	var b LLMBudget
+	if err := DB.Where("scope = ? AND scope_id = ?", scope, scopeID).First(&b).Error; err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// UpsertLLMBudget creates or replaces the limits for b.Scope/b.ScopeID.
+// ResetAt is left untouched on update so editing a cap does not also clear
+// accumulated spend.
+func UpsertLLMBudget(b *LLMBudget) error {
+	if err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "scope_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"daily_limit_usd", "monthly_limit_usd", "total_limit_usd", "warn_percent", "updated_at"}),
+	}).Create(b).Error; err != nil {
+		return err
+	}
+	// On conflict the primary key in b is not populated by every driver;
+	// reload so callers get the canonical row.
+	stored, err := GetLLMBudget(b.Scope, b.ScopeID)
+	if err != nil {
+		return err
+	}
+	*b = *stored
+	return nil
+}
+
+// ResetLLMBudget stamps ResetAt with the current time so spend recorded
+// before now no longer counts against any of the budget's windows.
+func ResetLLMBudget(scope string, scopeID uint) error {
+	now := time.Now().UTC()
+	res := DB.Model(&LLMBudget{}).Where("scope = ? AND scope_id = ?", scope, scopeID).Update("reset_at", &now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteLLMBudget removes the budget for the given scope.
+func DeleteLLMBudget(scope string, scopeID uint) error {
+	res := DB.Where("scope = ? AND scope_id = ?", scope, scopeID).Delete(&LLMBudget{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// BudgetsForRequest returns every budget that applies to a gateway request
+// from instanceID (in teamID) routed to providerID. teamID may be zero when
+// the instance's team could not be resolved.
+func BudgetsForRequest(instanceID, teamID, providerID uint) ([]LLMBudget, error) {
+	var budgets []LLMBudget
+	err := DB.Where("(scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?)",
+		BudgetScopeInstance, instanceID,
+		BudgetScopeTeam, teamID,
+		BudgetScopeProvider, providerID,
+	).Find(&budgets).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return budgets, nil
+}
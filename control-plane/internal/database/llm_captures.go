@@ -0,0 +1,159 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetLLMCapturePolicy returns the capture policy of an instance, or
+// gorm.ErrRecordNotFound when none is configured.
+func GetLLMCapturePolicy(instanceID uint) (*LLMCapturePolicy, error) {
+	var p LLMCapturePolicy
+	if err := DB.Where("instance_id = ?", instanceID).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListLLMCapturePolicies returns every capture policy ordered by instance.
+func ListLLMCapturePolicies() ([]LLMCapturePolicy, error) {
+	var policies []LLMCapturePolicy
+	if err := DB.Order("instance_id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// UpsertLLMCapturePolicy creates or replaces the capture policy of
+// p.InstanceID.
+func UpsertLLMCapturePolicy(p *LLMCapturePolicy) error {
+	if err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "redact_pii", "redact_patterns", "retention_days", "updated_at"}),
+	}).Create(p).Error; err != nil {
+		return err
+	}
+	stored, err := GetLLMCapturePolicy(p.InstanceID)
+	if err != nil {
+		return err
+	}
+	*p = *stored
+	return nil
+}
+
+// DeleteLLMCapturePolicy removes the capture policy of an instance. Captures
+// already stored are kept until retention removes them.
+func DeleteLLMCapturePolicy(instanceID uint) error {
+	res := DB.Where("instance_id = ?", instanceID).Delete(&LLMCapturePolicy{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// LLMCaptureFilter narrows SearchLLMCaptures. Zero values don't filter.
+// Query is a substring matched against both bodies.
+type LLMCaptureFilter struct {
+	InstanceID uint
+	ProviderID uint
+	Model      string
+	StatusCode int
+	Query      string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+// SearchLLMCaptures returns matching captures newest first, without their
+// bodies, and the total number of matches.
+func SearchLLMCaptures(f LLMCaptureFilter) ([]LLMCapture, int64, error) {
+	q := LogsDB.Model(&LLMCapture{})
+	if f.InstanceID != 0 {
+		q = q.Where("instance_id = ?", f.InstanceID)
+	}
+	if f.ProviderID != 0 {
+		q = q.Where("provider_id = ?", f.ProviderID)
+	}
+	if f.Model != "" {
+		q = q.Where("model_id = ?", f.Model)
+	}
+	if f.StatusCode != 0 {
+		q = q.Where("status_code = ?", f.StatusCode)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("requested_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("requested_at < ?", f.Until)
+	}
+	if f.Query != "" {
+		like := "%" + escapeLike(f.Query) + "%"
+		q = q.Where("(request_body LIKE ? ESCAPE '!' OR response_body LIKE ? ESCAPE '!')", like, like)
+	}
+
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var captures []LLMCapture
+	if err := q.Omit("request_body", "response_body", "request_headers").
+		Order("id DESC").Limit(f.Limit).Offset(f.Offset).Find(&captures).Error; err != nil {
+		return nil, 0, err
+	}
+	return captures, total, nil
+}
+
+// escapeLike escapes LIKE wildcards so a search term matches literally.
+// '!' is the escape character because a backslash needs different quoting
+// in MySQL than in SQLite and Postgres.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// GetLLMCapture returns one capture with its bodies.
+func GetLLMCapture(id uint) (*LLMCapture, error) {
+	var c LLMCapture
+	if err := LogsDB.First(&c, id).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// PurgeLLMCaptures deletes captures older than their retention: the
+// instance's own retention from overrides when present, defaultDays for
+// every other instance. A retention of 0 days keeps captures forever.
+func PurgeLLMCaptures(defaultDays int, overrides map[uint]int) (int64, error) {
+	now := time.Now().UTC()
+	var deleted int64
+	ids := make([]uint, 0, len(overrides))
+	for instanceID, days := range overrides {
+		ids = append(ids, instanceID)
+		if days <= 0 {
+			continue
+		}
+		res := LogsDB.Where("instance_id = ? AND requested_at < ?", instanceID, now.AddDate(0, 0, -days)).Delete(&LLMCapture{})
+		if res.Error != nil {
+			return deleted, res.Error
+		}
+		deleted += res.RowsAffected
+	}
+	if defaultDays > 0 {
+		q := LogsDB.Where("requested_at < ?", now.AddDate(0, 0, -defaultDays))
+		if len(ids) > 0 {
+			q = q.Where("instance_id NOT IN ?", ids)
+		}
+		res := q.Delete(&LLMCapture{})
+		if res.Error != nil {
+			return deleted, res.Error
+		}
+		deleted += res.RowsAffected
+	}
+	return deleted, nil
+}
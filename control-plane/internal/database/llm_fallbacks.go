@@ -0,0 +1,61 @@
+package database
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListLLMFallbackChains returns every fallback chain configured for an
+// instance, ordered by primary provider.
+func ListLLMFallbackChains(instanceID uint) ([]LLMFallbackChain, error) {
+	var chains []LLMFallbackChain
+	if err := DB.Where("instance_id = ?", instanceID).Order("provider_id").Find(&chains).Error; err != nil {
+		return nil, err
+	}
+	return chains, nil
+}
+
+// GetLLMFallbackChain returns the chain for an instance's primary provider,
+// or gorm.ErrRecordNotFound when none is configured.
+func GetLLMFallbackChain(instanceID, providerID uint) (*LLMFallbackChain, error) {
+	var c LLMFallbackChain
+	if err := DB.Where("instance_id = ? AND provider_id = ?", instanceID, providerID).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SetLLMFallbackChain creates or replaces the hops tried after providerID
+// fails for instanceID.
+func SetLLMFallbackChain(instanceID, providerID uint, hops []FallbackHop) (*LLMFallbackChain, error) {
+	if hops == nil {
+		hops = []FallbackHop{}
+	}
+	raw, err := json.Marshal(hops)
+	if err != nil {
+		return nil, err
+	}
+	c := LLMFallbackChain{InstanceID: instanceID, ProviderID: providerID, Hops: string(raw)}
+	if err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instance_id"}, {Name: "provider_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hops", "updated_at"}),
+	}).Create(&c).Error; err != nil {
+		return nil, err
+	}
+	return GetLLMFallbackChain(instanceID, providerID)
+}
+
+// DeleteLLMFallbackChain removes the chain for an instance's primary
+// provider.
+func DeleteLLMFallbackChain(instanceID, providerID uint) error {
+	res := DB.Where("instance_id = ? AND provider_id = ?", instanceID, providerID).Delete(&LLMFallbackChain{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
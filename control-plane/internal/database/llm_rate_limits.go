@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database/models"
+)
+
+// Rate limit scope and mode re-exports so callers can write
+// database.RateLimitScopeKey.
+const (
+	RateLimitScopeKey      = models.RateLimitScopeKey
+	RateLimitScopeInstance = models.RateLimitScopeInstance
+	RateLimitScopeProvider = models.RateLimitScopeProvider
+
+	RateLimitModeReject = models.RateLimitModeReject
+	RateLimitModeQueue  = models.RateLimitModeQueue
+)
+
+// IsValidRateLimitScope reports whether scope is one of the supported rate
+// limit scopes.
+func IsValidRateLimitScope(scope string) bool {
+	switch scope {
+	case RateLimitScopeKey, RateLimitScopeInstance, RateLimitScopeProvider:
+		return true
+	}
+	return false
+}
+
+// ListLLMRateLimits returns every configured rate limit ordered by scope
+// then scope ID.
+func ListLLMRateLimits() ([]LLMRateLimit, error) {
+	var limits []LLMRateLimit
+	if err := DB.Order("scope, scope_id").Find(&limits).Error; err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// GetLLMRateLimit returns the rate limit for the given scope, or
+// gorm.ErrRecordNotFound when none is configured.
+func GetLLMRateLimit(scope string, scopeID uint) (*LLMRateLimit, error) {
+	var l LLMRateLimit
+	if err := DB.Where("scope = ? AND scope_id = ?", scope, scopeID).First(&l).Error; err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// UpsertLLMRateLimit creates or replaces the limits for l.Scope/l.ScopeID.
+func UpsertLLMRateLimit(l *LLMRateLimit) error {
+	if err := DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "scope"}, {Name: "scope_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"requests_per_minute", "tokens_per_minute", "max_concurrent", "mode", "queue_timeout_seconds", "updated_at",
+		}),
+	}).Create(l).Error; err != nil {
+		return err
+	}
+	stored, err := GetLLMRateLimit(l.Scope, l.ScopeID)
+	if err != nil {
+		return err
+	}
+	*l = *stored
+	return nil
+}
+
+// DeleteLLMRateLimit removes the rate limit for the given scope.
+func DeleteLLMRateLimit(scope string, scopeID uint) error {
+	res := DB.Where("scope = ? AND scope_id = ?", scope, scopeID).Delete(&LLMRateLimit{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RateLimitsForRequest returns every rate limit that applies to a gateway
+// request made with virtual key keyID by instanceID to providerID.
+func RateLimitsForRequest(keyID, instanceID, providerID uint) ([]LLMRateLimit, error) {
+	var limits []LLMRateLimit
+	err := DB.Where("(scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?)",
+		RateLimitScopeKey, keyID,
+		RateLimitScopeInstance, instanceID,
+		RateLimitScopeProvider, providerID,
+	).Order("scope, scope_id").Find(&limits).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// RateLimitsForProvider returns the provider-scoped rate limit for
+// providerID, if any, as a slice so it can be passed wherever
+// RateLimitsForRequest's result is accepted.
+func RateLimitsForProvider(providerID uint) ([]LLMRateLimit, error) {
+	var limits []LLMRateLimit
+	if err := DB.Where("scope = ? AND scope_id = ?", RateLimitScopeProvider, providerID).Find(&limits).Error; err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
@@ -19,10 +19,10 @@ func InitLogsDB(dataPath string) error {
 
 	if resolved.ShareConn {
 		// Postgres / MySQL: re-use the main connection. AutoMigrate the logs
-		// model onto the same DB so llm_request_logs lives alongside everything
+		// models onto the same DB so llm_request_logs lives alongside everything
 		// else.
 		LogsDB = DB
-		if err := LogsDB.AutoMigrate(&LLMRequestLog{}); err != nil {
+		if err := LogsDB.AutoMigrate(&LLMRequestLog{}, &LLMCapture{}); err != nil {
 			return fmt.Errorf("auto-migrate logs DB: %w", err)
 		}
 		return nil
@@ -41,7 +41,7 @@ func InitLogsDB(dataPath string) error {
 		return fmt.Errorf("open logs database: %w", err)
 	}
 
-	if err := LogsDB.AutoMigrate(&LLMRequestLog{}); err != nil {
+	if err := LogsDB.AutoMigrate(&LLMRequestLog{}, &LLMCapture{}); err != nil {
 		return fmt.Errorf("auto-migrate logs DB: %w", err)
 	}
 
@@ -63,5 +63,19 @@ func AutoMigrateAll(gdb interface {
 		&models.TeamProvider{},
 		&models.WebhookApiKey{},
 		&models.WebhookLog{},
+		&models.LLMBudget{},
+		&models.LLMFallbackChain{},
+		&models.LLMRateLimit{},
+		&models.LLMCapturePolicy{},
+		&models.NotificationChannel{},
+		&models.NotificationRule{},
+		&models.UserSession{},
+		&models.APIToken{},
+		&models.UserRecoveryCode{},
+		&models.InstanceHostKey{},
+		&models.OrchestratorTarget{},
+		&models.PowerSchedule{},
+		&models.InstanceTemplate{},
+		&models.InstanceTemplateVersion{},
 	)
 }
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 00012_noop_llm_budgets: registry placeholder for the llm_budgets table
+// backing per-instance, per-team and per-provider LLM spend caps enforced
+// by the gateway.
+//
+// The table is purely additive and created by AutoMigrateAll on boot (see
+// docs/migrations.md). This no-op exists only to satisfy the CI
+// "Migration Drift Check" guard, which requires a new migration file
+// whenever internal/database/models changes.
+func init() {
+	register(&goose.Migration{
+		Version: 12,
+		Source:  "00012_noop_llm_budgets.go",
+		UpFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+		DownFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+	})
+}
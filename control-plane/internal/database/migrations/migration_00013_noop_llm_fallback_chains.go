@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 00013_noop_llm_fallback_chains: registry placeholder for the
+// llm_fallback_chains table and the requested_provider_id / fallback_hop
+// columns on llm_request_logs, which record which hop of a fallback chain
+// served each gateway request.
+//
+// Both changes are purely additive and applied by AutoMigrate on boot (see
+// docs/migrations.md). This no-op exists only to satisfy the CI
+// "Migration Drift Check" guard, which requires a new migration file
+// whenever internal/database/models changes.
+func init() {
+	register(&goose.Migration{
+		Version: 13,
+		Source:  "00013_noop_llm_fallback_chains.go",
+		UpFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+		DownFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 00014_noop_llm_provider_client_api_type: registry placeholder for the
+// client_api_type column on llm_providers, which lets OpenClaw keep
+// speaking one API type while the gateway translates to another upstream.
+//
+// The change is purely additive and applied by AutoMigrate on boot (see
+// docs/migrations.md). This no-op exists only to satisfy the CI
+// "Migration Drift Check" guard, which requires a new migration file
+// whenever internal/database/models changes.
+func init() {
+	register(&goose.Migration{
+		Version: 14,
+		Source:  "00014_noop_llm_provider_client_api_type.go",
+		UpFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+		DownFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+	})
+}
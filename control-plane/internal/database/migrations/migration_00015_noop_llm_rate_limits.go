@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 00015_noop_llm_rate_limits: registry placeholder for the llm_rate_limits
+// table, which holds per-key, per-instance and per-provider request, token
+// and concurrency limits for the LLM gateway.
+//
+// The change is purely additive and applied by AutoMigrate on boot (see
+// docs/migrations.md). This no-op exists only to satisfy the CI
+// "Migration Drift Check" guard, which requires a new migration file
+// whenever internal/database/models changes.
+func init() {
+	register(&goose.Migration{
+		Version: 15,
+		Source:  "00015_noop_llm_rate_limits.go",
+		UpFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+		DownFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+// 00017_noop_llm_response_cache: registry placeholder for
+// llm_providers.cache_ttl_seconds, which enables the gateway response cache
+// per provider. The matching cache_hit and saved_cost_usd columns on
+// llm_request_logs live in the logs DB, which is migrated separately by
+// InitLogsDB.
+//
+// All three columns are additive and applied by AutoMigrate on boot (see
+// docs/migrations.md). This no-op exists only to satisfy the CI
+// "Migration Drift Check" guard, which requires a new migration file
+// whenever internal/database/models changes.
+func init() {
+	register(&goose.Migration{
+		Version: 17,
+		Source:  "00017_noop_llm_response_cache.go",
+		UpFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+		DownFnContext: func(ctx context.Context, tx *sql.Tx) error {
+			return nil
+		},
+	})
+}
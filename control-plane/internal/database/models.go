@@ -9,32 +9,50 @@ import "github.com/gluk-w/claworc/control-plane/internal/database/models"
 // types via the GORM Migrator without an import cycle.
 
 type (
-	Skill              = models.Skill
-	Instance           = models.Instance
-	Team               = models.Team
-	TeamMember         = models.TeamMember
-	TeamProvider       = models.TeamProvider
-	BrowserSession     = models.BrowserSession
-	ProviderModel      = models.ProviderModel
-	ProviderModelCost  = models.ProviderModelCost
-	LLMProvider        = models.LLMProvider
-	LLMGatewayKey      = models.LLMGatewayKey
-	LLMRequestLog      = models.LLMRequestLog
-	Setting            = models.Setting
-	User               = models.User
-	UserInstance       = models.UserInstance
-	Backup             = models.Backup
-	BackupSchedule     = models.BackupSchedule
-	SharedFolder       = models.SharedFolder
-	KanbanBoard        = models.KanbanBoard
-	KanbanTask         = models.KanbanTask
-	KanbanComment      = models.KanbanComment
-	KanbanArtifact     = models.KanbanArtifact
-	InstanceSoul       = models.InstanceSoul
-	WebAuthnCredential = models.WebAuthnCredential
-	UserSSHKey         = models.UserSSHKey
-	WebhookApiKey      = models.WebhookApiKey
-	WebhookLog         = models.WebhookLog
+	Skill               = models.Skill
+	Instance            = models.Instance
+	Team                = models.Team
+	TeamMember          = models.TeamMember
+	TeamProvider        = models.TeamProvider
+	BrowserSession      = models.BrowserSession
+	ProviderModel       = models.ProviderModel
+	ProviderModelCost   = models.ProviderModelCost
+	LLMProvider         = models.LLMProvider
+	LLMGatewayKey       = models.LLMGatewayKey
+	LLMRequestLog       = models.LLMRequestLog
+	LLMBudget           = models.LLMBudget
+	LLMFallbackChain    = models.LLMFallbackChain
+	LLMRateLimit        = models.LLMRateLimit
+	LLMCapturePolicy    = models.LLMCapturePolicy
+	LLMCapture          = models.LLMCapture
+	FallbackHop         = models.FallbackHop
+	Setting             = models.Setting
+	User                = models.User
+	UserInstance        = models.UserInstance
+	Backup              = models.Backup
+	BackupSchedule      = models.BackupSchedule
+	SharedFolder        = models.SharedFolder
+	KanbanBoard         = models.KanbanBoard
+	KanbanTask          = models.KanbanTask
+	KanbanComment       = models.KanbanComment
+	KanbanArtifact      = models.KanbanArtifact
+	InstanceSoul        = models.InstanceSoul
+	WebAuthnCredential  = models.WebAuthnCredential
+	UserSSHKey          = models.UserSSHKey
+	UserSession         = models.UserSession
+	APIToken            = models.APIToken
+	UserRecoveryCode    = models.UserRecoveryCode
+	InstanceHostKey     = models.InstanceHostKey
+	WebhookApiKey       = models.WebhookApiKey
+	WebhookLog          = models.WebhookLog
+	NotificationChannel = models.NotificationChannel
+	NotificationRule    = models.NotificationRule
+	OrchestratorTarget  = models.OrchestratorTarget
+	PowerSchedule       = models.PowerSchedule
+
+	InstanceTemplate        = models.InstanceTemplate
+	InstanceTemplateVersion = models.InstanceTemplateVersion
+	InstanceTemplateSpec    = models.InstanceTemplateSpec
 )
 
 // Helper re-exports keep `database.ParseTeamIDs(...)` etc. working for
@@ -44,6 +62,14 @@ func IsLegacyEmbedded(image string) bool { return models.IsLegacyEmbedded(image)
 
 func ParseProviderModels(raw string) []ProviderModel { return models.ParseProviderModels(raw) }
 
+func ParseFallbackHops(raw string) []FallbackHop { return models.ParseFallbackHops(raw) }
+
+func ParseRedactPatterns(raw string) []string { return models.ParseRedactPatterns(raw) }
+
+func ParseNotificationEventTypes(raw string) []string {
+	return models.ParseNotificationEventTypes(raw)
+}
+
 func ParseSharedFolderInstanceIDs(raw string) []uint {
 	return models.ParseSharedFolderInstanceIDs(raw)
 }
@@ -54,4 +80,12 @@ func EncodeSharedFolderInstanceIDs(ids []uint) string {
 
 func ParseTeamIDs(raw string) []uint { return models.ParseTeamIDs(raw) }
 
+func ParseInstanceTemplateSpec(raw string) InstanceTemplateSpec {
+	return models.ParseInstanceTemplateSpec(raw)
+}
+
+func EncodeInstanceTemplateSpec(spec InstanceTemplateSpec) string {
+	return models.EncodeInstanceTemplateSpec(spec)
+}
+
 func EncodeTeamIDs(ids []uint) string { return models.EncodeTeamIDs(ids) }
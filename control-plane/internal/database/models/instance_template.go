@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// InstanceTemplate is a saved, versioned set of instance settings used to
+// create new instances. TeamID 0 makes it global; otherwise only that team's
+// instances can be created from it. The settings themselves live in
+// InstanceTemplateVersion rows: every change to them adds a version, so an
+// instance can be compared with the latest version of its template.
+type InstanceTemplate struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name          string    `gorm:"not null" json:"name"`
+	Description   string    `gorm:"type:text;default:''" json:"description"`
+	TeamID        uint      `gorm:"not null;default:0;index" json:"team_id"` // 0 = global
+	LatestVersion int       `gorm:"not null;default:1" json:"latest_version"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// InstanceTemplateVersion is one immutable version of a template's
+// settings. Spec is a JSON InstanceTemplateSpec.
+type InstanceTemplateVersion struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID uint      `gorm:"not null;uniqueIndex:idx_template_version" json:"template_id"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_template_version" json:"version"`
+	Spec       string    `gorm:"type:text;not null;default:'{}'" json:"-"`
+	CreatedBy  string    `gorm:"default:''" json:"created_by"` // username
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// InstanceTemplateSpec holds the settings a template applies on create.
+// Empty fields fall back to the same global defaults as a hand-made
+// instance. EnvVars values are Fernet-encrypted, like Instance.EnvVars.
+type InstanceTemplateSpec struct {
+	CPURequest       string            `json:"cpu_request,omitempty"`
+	CPULimit         string            `json:"cpu_limit,omitempty"`
+	MemoryRequest    string            `json:"memory_request,omitempty"`
+	MemoryLimit      string            `json:"memory_limit,omitempty"`
+	StorageHomebrew  string            `json:"storage_homebrew,omitempty"`
+	StorageHome      string            `json:"storage_home,omitempty"`
+	ContainerImage   string            `json:"container_image,omitempty"`
+	Timezone         string            `json:"timezone,omitempty"`
+	EnvVars          map[string]string `json:"env_vars,omitempty"`
+	EnabledProviders []uint            `json:"enabled_providers,omitempty"`
+	SharedFolderIDs  []uint            `json:"shared_folder_ids,omitempty"`
+	Skills           []string          `json:"skills,omitempty"` // library skill slugs
+	PlacementTarget  string            `json:"placement_target,omitempty"`
+}
+
+// ParseInstanceTemplateSpec deserializes a version's Spec field.
+func ParseInstanceTemplateSpec(raw string) InstanceTemplateSpec {
+	var spec InstanceTemplateSpec
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &spec)
+	}
+	return spec
+}
+
+// EncodeInstanceTemplateSpec serializes spec for the Spec field.
+func EncodeInstanceTemplateSpec(spec InstanceTemplateSpec) string {
+	b, _ := json.Marshal(spec)
+	return string(b)
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Budget scopes. A budget row caps spend for exactly one instance, team or
+// provider; all budgets that match a request are checked, so an instance in
+// a capped team using a capped provider is subject to all three.
+const (
+	BudgetScopeInstance = "instance"
+	BudgetScopeTeam     = "team"
+	BudgetScopeProvider = "provider"
+)
+
+// LLMBudget caps LLM spend (as recorded in LLMRequestLog.CostUSD) for a
+// single scope. Each limit is optional: zero means "no cap" for that window.
+// Daily and monthly windows are calendar-aligned in UTC; the total window
+// runs from ResetAt (or the beginning of time when nil) onward.
+//
+// ResetAt also acts as a floor for the daily and monthly windows, so an
+// admin reset immediately unblocks a scope that tripped any cap.
+//
+// WarnPercent is the soft threshold: once spend in any window crosses that
+// percentage of its cap the gateway logs a warning and tags responses with
+// an X-Claworc-Budget-Warning header, but still forwards the request. Zero
+// disables the soft warning. No GORM default on purpose: with one, an
+// explicit 0 would be silently replaced on insert.
+type LLMBudget struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope           string     `gorm:"not null;size:16;uniqueIndex:idx_llm_budget_scope" json:"scope"` // instance|team|provider
+	ScopeID         uint       `gorm:"not null;uniqueIndex:idx_llm_budget_scope" json:"scope_id"`
+	DailyLimitUSD   float64    `gorm:"not null;default:0" json:"daily_limit_usd"`
+	MonthlyLimitUSD float64    `gorm:"not null;default:0" json:"monthly_limit_usd"`
+	TotalLimitUSD   float64    `gorm:"not null;default:0" json:"total_limit_usd"`
+	WarnPercent     int        `gorm:"not null" json:"warn_percent"`
+	ResetAt         *time.Time `json:"reset_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LLMFallbackChain is an ordered list of backup upstreams the gateway tries
+// when the primary provider behind an instance's virtual key fails with a
+// 429, a 5xx or a transport error/timeout. A chain is keyed by the instance
+// and the primary provider, so each virtual key of an instance can have its
+// own chain.
+//
+// Hops holds a JSON []FallbackHop. A hop whose api_type differs from the
+// primary's has its request and response bodies translated by the gateway.
+type LLMFallbackChain struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	InstanceID uint      `gorm:"not null;uniqueIndex:idx_llm_fallback_chain" json:"instance_id"`
+	ProviderID uint      `gorm:"not null;uniqueIndex:idx_llm_fallback_chain" json:"provider_id"` // primary provider
+	Hops       string    `gorm:"type:text;not null;default:'[]'" json:"-"`                       // JSON []FallbackHop
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// FallbackHop is one entry of LLMFallbackChain.Hops. An empty Model keeps
+// the model the client asked for.
+type FallbackHop struct {
+	ProviderID uint   `json:"provider_id"`
+	Model      string `json:"model,omitempty"`
+}
+
+// ParseFallbackHops deserializes the raw JSON hops field.
+func ParseFallbackHops(raw string) []FallbackHop {
+	if raw == "" || raw == "[]" {
+		return []FallbackHop{}
+	}
+	var hops []FallbackHop
+	json.Unmarshal([]byte(raw), &hops)
+	if hops == nil {
+		return []FallbackHop{}
+	}
+	return hops
+}
+
+// Rate limit scopes. A key limit applies to one LLMGatewayKey (one instance
+// talking to one provider); instance and provider limits are shared by every
+// key of that instance or provider. All limits matching a request apply.
+const (
+	RateLimitScopeKey      = "key"
+	RateLimitScopeInstance = "instance"
+	RateLimitScopeProvider = "provider"
+)
+
+// What the gateway does with a request that would exceed a rate limit.
+const (
+	RateLimitModeReject = "reject"
+	RateLimitModeQueue  = "queue"
+)
+
+// LLMRateLimit throttles gateway traffic for a single scope with token
+// buckets. RequestsPerMinute and TokensPerMinute refill continuously, so a
+// full bucket allows a burst of one minute's worth. MaxConcurrent caps
+// requests in flight, streams included. Zero disables that dimension.
+//
+// Tokens are counted after the response (input, cached input and output),
+// so one large request can take the token bucket negative; new requests
+// wait until it refills above zero.
+//
+// In queue mode a request that would exceed the limit waits up to
+// QueueTimeoutSeconds (0 means the gateway default) before being rejected.
+type LLMRateLimit struct {
+	ID                  uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope               string    `gorm:"not null;size:16;uniqueIndex:idx_llm_rate_limit_scope" json:"scope"` // key|instance|provider
+	ScopeID             uint      `gorm:"not null;uniqueIndex:idx_llm_rate_limit_scope" json:"scope_id"`
+	RequestsPerMinute   int       `gorm:"not null;default:0" json:"requests_per_minute"`
+	TokensPerMinute     int       `gorm:"not null;default:0" json:"tokens_per_minute"`
+	MaxConcurrent       int       `gorm:"not null;default:0" json:"max_concurrent"`
+	Mode                string    `gorm:"not null;size:16;default:'reject'" json:"mode"` // reject|queue
+	QueueTimeoutSeconds int       `gorm:"not null;default:0" json:"queue_timeout_seconds"`
+	CreatedAt           time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LLMCapturePolicy opts one instance into full capture of its gateway
+// traffic. Captured exchanges are stored as LLMCapture rows in the logs DB
+// after redaction: the built-in PII patterns when RedactPII is set, plus
+// every regex in RedactPatterns.
+//
+// RetentionDays overrides the llm_capture_retention_days setting for this
+// instance's captures; 0 uses the setting. No GORM defaults on the bools on
+// purpose: with one, an explicit false would be replaced on insert.
+type LLMCapturePolicy struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	InstanceID     uint      `gorm:"not null;uniqueIndex" json:"instance_id"`
+	Enabled        bool      `gorm:"not null" json:"enabled"`
+	RedactPII      bool      `gorm:"not null" json:"redact_pii"`
+	RedactPatterns string    `gorm:"type:text;not null;default:'[]'" json:"-"` // JSON []string
+	RetentionDays  int       `gorm:"not null;default:0" json:"retention_days"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ParseRedactPatterns deserializes the raw JSON redact patterns field.
+func ParseRedactPatterns(raw string) []string {
+	var patterns []string
+	json.Unmarshal([]byte(raw), &patterns)
+	if patterns == nil {
+		return []string{}
+	}
+	return patterns
+}
+
+// LLMCapture is one captured gateway exchange: the request as the client
+// sent it and the response as the client received it, both already
+// redacted. Lives in the logs DB next to LLMRequestLog. Bodies are cut at
+// the gateway's capture limit and the *Truncated flags say so.
+type LLMCapture struct {
+	ID                uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	InstanceID        uint      `gorm:"not null;index" json:"instance_id"`
+	ProviderID        uint      `gorm:"not null" json:"provider_id"` // provider behind the virtual key
+	FallbackHop       int       `gorm:"not null;default:0" json:"fallback_hop"`
+	ModelID           string    `gorm:"size:255;not null;default:''" json:"model_id"`
+	Method            string    `gorm:"size:10;not null" json:"method"`
+	Path              string    `gorm:"size:1024;not null" json:"path"`
+	Query             string    `gorm:"size:1024;not null;default:''" json:"query"`
+	RequestHeaders    string    `gorm:"type:text" json:"-"` // JSON map[string]string, auth headers removed
+	RequestBody       string    `gorm:"size:16777215" json:"request_body,omitempty"`
+	RequestTruncated  bool      `gorm:"not null" json:"request_truncated"`
+	StatusCode        int       `gorm:"not null" json:"status_code"`
+	ResponseBody      string    `gorm:"size:16777215" json:"response_body,omitempty"`
+	ResponseTruncated bool      `gorm:"not null" json:"response_truncated"`
+	LatencyMs         int64     `gorm:"not null" json:"latency_ms"`
+	RequestedAt       time.Time `gorm:"not null;index" json:"requested_at"`
+}
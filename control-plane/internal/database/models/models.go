@@ -78,6 +78,8 @@ type Instance struct {
 	DefaultModel     string `gorm:"default:''" json:"-"`
 	LogPaths         string `gorm:"type:text;default:''" json:"log_paths"`          // JSON: {"openclaw":"/custom/path.log",...}
 	AllowedSourceIPs string `gorm:"type:text;default:''" json:"allowed_source_ips"` // Comma-separated IPs/CIDRs for SSH connection restrictions
+	ForwardPorts     string `gorm:"type:text;default:''" json:"forward_ports"`      // Ports/ranges ("3000,8000-8100") reachable via SSH gateway -L; empty = none
+	PlacementTarget  string `gorm:"default:'';index" json:"placement_target"`       // OrchestratorTarget name; empty = default backend (orchestrator_backend setting)
 	EnabledProviders string `gorm:"type:text;default:'[]'" json:"-"`                // JSON array of LLMProvider IDs enabled for this instance
 	Timezone         string `gorm:"default:''" json:"timezone"`
 	UserAgent        string `gorm:"default:''" json:"user_agent"`
@@ -97,6 +99,19 @@ type Instance struct {
 	// their own ingress-routable port.
 	Ports     string `gorm:"type:text;default:'[]'" json:"ports"` // JSON []orchestrator.PortSpec
 	SortOrder int    `gorm:"not null;default:0" json:"sort_order"`
+
+	// Auto-hibernation. HibernateAfterHours overrides the team's policy
+	// (nil = use the team's, 0 = never). LastActivityAt is the last chat,
+	// terminal, SSH gateway, webhook or LLM call, see internal/activity.
+	HibernateAfterHours *int       `json:"hibernate_after_hours,omitempty"`
+	LastActivityAt      *time.Time `json:"last_activity_at,omitempty"`
+
+	// Template the instance was created from, see InstanceTemplate. Both are
+	// kept when the template changes or is deleted; TemplateVersion is the
+	// version used at creation.
+	TemplateID      *uint `gorm:"index" json:"template_id,omitempty"`
+	TemplateVersion int   `gorm:"not null;default:0" json:"template_version,omitempty"`
+
 	// On-demand browser-pod fields. Only consulted when ContainerImage does
 	// not match IsLegacyEmbedded(). All four are optional and fall back to
 	// admin-level defaults from the settings table.
@@ -118,8 +133,12 @@ type Team struct {
 	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name        string    `gorm:"uniqueIndex;not null;size:100" json:"name"`
 	Description string    `json:"description"`
+	Require2FA  bool      `gorm:"column:require_2fa;not null;default:false" json:"require_2fa"`
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	// HibernateAfterHours stops the team's running instances after this
+	// many hours without activity; 0 = never. Instances may override it.
+	HibernateAfterHours int `gorm:"not null;default:0" json:"hibernate_after_hours"`
 }
 
 // TeamMember associates a User with a Team and assigns a per-team Role.
@@ -199,6 +218,14 @@ type LLMProvider struct {
 	APIType    string `gorm:"size:100;default:'openai-completions'" json:"api_type"`
 	APIKey     string `gorm:"type:text;default:''" json:"-"`   // Fernet-encrypted upstream API key
 	Models     string `gorm:"type:text;default:'[]'" json:"-"` // JSON []ProviderModel
+	// ClientAPIType is the API type declared to OpenClaw when it differs from
+	// the upstream APIType; the gateway translates between the two. Empty
+	// means OpenClaw speaks APIType directly.
+	ClientAPIType string `gorm:"size:100;default:''" json:"client_api_type"`
+	// CacheTTLSeconds enables the gateway response cache for this provider:
+	// identical requests within the TTL are answered from memory instead of
+	// upstream. 0 disables caching.
+	CacheTTLSeconds int `gorm:"not null;default:0" json:"cache_ttl_seconds"`
 	// OAuth credentials for providers that authenticate via OAuth instead of a
 	// static API key (currently: openai-codex-responses against ChatGPT).
 	// All four are zero-valued for static-key providers. Explicit column names
@@ -250,6 +277,18 @@ type LLMRequestLog struct {
 	LatencyMs         int64     `gorm:"not null"`
 	ErrorMessage      string    `gorm:"type:text"`
 	RequestedAt       time.Time `gorm:"not null;index"`
+	// RequestedProviderID is the provider behind the virtual key the client
+	// used; ProviderID is the one that actually served the request. They
+	// differ when a fallback chain kicked in, and FallbackHop records which
+	// hop answered (0 = primary). RequestedProviderID is 0 on rows written
+	// before fallback chains existed.
+	RequestedProviderID uint `gorm:"not null;default:0"`
+	FallbackHop         int  `gorm:"not null;default:0"`
+	// CacheHit marks a request answered from the gateway response cache.
+	// Such rows have CostUSD 0; SavedCostUSD is what the cached response
+	// cost when it was fetched from upstream.
+	CacheHit     bool    `gorm:"not null;default:false"`
+	SavedCostUSD float64 `gorm:"not null;default:0"`
 }
 
 type Setting struct {
@@ -258,12 +297,26 @@ type Setting struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+// User is a dashboard account. AuthSource says where it authenticates:
+// "local" (password and passkeys), an external directory such as "oidc"
+// or "ldap", or "service" for API-only service accounts. ExternalID is the directory's stable identifier for the user
+// (for OIDC, issuer + "|" + subject); it is empty for local users. Disabled
+// is set by directory sync for users removed from the directory and blocks
+// every login.
 type User struct {
 	ID                 uint       `gorm:"primaryKey;autoIncrement" json:"id"`
 	Username           string     `gorm:"uniqueIndex;not null;size:64" json:"username"`
 	PasswordHash       string     `gorm:"not null" json:"-"`
 	Role               string     `gorm:"not null;default:user" json:"role"`
 	CanCreateInstances bool       `gorm:"not null;default:false" json:"can_create_instances"`
+	AuthSource         string     `gorm:"not null;size:16;default:local" json:"auth_source"` // local|oidc|ldap|service
+	ExternalID         string     `gorm:"size:255;index" json:"-"`
+	Disabled           bool       `gorm:"not null;default:false" json:"disabled"`
+	TOTPSecret         string     `gorm:"type:text" json:"-"` // Fernet-encrypted base32 secret
+	TOTPEnabled        bool       `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep       int64      `gorm:"not null;default:0" json:"-"` // last accepted time step, blocks replay
+	TOTPSetupUntil     *time.Time `json:"totp_setup_until,omitempty"`  // admin-granted window for first enrollment after a password-only login
+	SFTPMaxUploadMB    int        `gorm:"not null;default:0" json:"sftp_max_upload_mb"`
 	LastLoginAt        *time.Time `json:"last_login_at,omitempty"`
 	CreatedAt          time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt          time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
@@ -448,6 +501,66 @@ type WebAuthnCredential struct {
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
+// UserSession is a dashboard login held by the database session backend,
+// so sessions survive restarts and are shared between replicas. ID is the
+// hex SHA-256 of the cookie token; the token itself is never stored.
+type UserSession struct {
+	ID         string    `gorm:"primaryKey;size:64" json:"id"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	UserAgent  string    `gorm:"type:text" json:"user_agent"`
+	IPAddress  string    `gorm:"size:64" json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// APIToken is a bearer token for the REST API, owned by a user or a
+// service account (a User with AuthSource "service"). Requests made with it
+// act as the owner, further limited to Scopes, a comma-separated list. ID
+// plus Prefix identify the token in listings; only the hex SHA-256 of the
+// token is stored, so it is shown exactly once, at creation.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null;size:128" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex;not null;size:64" json:"-"`
+	Scopes     string     `gorm:"type:text;not null" json:"-"`
+	CreatedBy  uint       `json:"created_by"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `gorm:"size:64" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// UserRecoveryCode is a single-use fallback for a user's TOTP second
+// factor. Only the hex SHA-256 of the code is stored; UsedAt is set when it
+// is redeemed. Codes are regenerated as a set, replacing the previous one.
+type UserRecoveryCode struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;size:64" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// InstanceHostKey pins the SSH host key of an instance's agent container so
+// trust-on-first-use survives control-plane restarts. PublicKey is in
+// authorized_keys format. When a different key is presented and cannot be
+// confirmed through the orchestrator, it is parked in the Pending* fields
+// until an admin accepts it.
+type InstanceHostKey struct {
+	InstanceID         uint       `gorm:"primaryKey" json:"instance_id"`
+	PublicKey          string     `gorm:"type:text;not null" json:"public_key"`
+	Fingerprint        string     `gorm:"size:128" json:"fingerprint"`
+	Source             string     `gorm:"size:16;not null;default:tofu" json:"source"` // tofu|orchestrator|admin
+	PendingKey         string     `gorm:"type:text" json:"pending_key,omitempty"`
+	PendingFingerprint string     `gorm:"size:128" json:"pending_fingerprint,omitempty"`
+	PendingSeenAt      *time.Time `json:"pending_seen_at,omitempty"`
+	CreatedAt          time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 // UserSSHKey is a public key a user authenticates with against the inbound
 // SSH gateway. The private key is never stored — it is generated on demand
 // and handed to the user exactly once (or the user uploads their own pubkey).
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification channel types.
+const (
+	NotificationChannelWebhook = "webhook"
+	NotificationChannelSlack   = "slack"
+	NotificationChannelEmail   = "email"
+)
+
+// NotificationChannel is an outbound destination for fleet events: a
+// generic HTTP webhook (JSON body, HMAC-signed when Secret is set), a
+// Slack-compatible incoming webhook, or an email address list sent via the
+// SMTP relay in config.
+//
+// Secret is the webhook signing secret, encrypted at rest with the Fernet
+// helpers in utils/crypto.go. EmailTo is a comma-separated address list and
+// only applies to email channels. LastError/LastSentAt reflect the most
+// recent delivery attempt so the admin UI can surface broken channels. No
+// GORM default on Enabled on purpose: with one, an explicit false would be
+// replaced on insert.
+type NotificationChannel struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Type       string     `gorm:"not null;size:16" json:"type"` // webhook|slack|email
+	URL        string     `gorm:"type:text;default:''" json:"url"`
+	Secret     string     `gorm:"type:text;default:''" json:"-"` // Fernet-encrypted
+	EmailTo    string     `gorm:"type:text;default:''" json:"email_to"`
+	Enabled    bool       `gorm:"not null" json:"enabled"`
+	LastError  string     `gorm:"type:text;default:''" json:"last_error"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// NotificationRule subscribes a channel to event types. TeamID scopes the
+// rule to events about instances in that team; nil matches every event,
+// including fleet-wide ones with no instance (e.g. SSH key rotation).
+// EventTypes is a JSON array of event type names; ["*"] matches all.
+type NotificationRule struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChannelID  uint      `gorm:"not null;index" json:"channel_id"`
+	TeamID     *uint     `gorm:"index" json:"team_id"`
+	EventTypes string    `gorm:"type:text;not null;default:'[]'" json:"-"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ParseNotificationEventTypes decodes a NotificationRule.EventTypes value.
+func ParseNotificationEventTypes(raw string) []string {
+	var types []string
+	json.Unmarshal([]byte(raw), &types)
+	if types == nil {
+		return []string{}
+	}
+	return types
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Orchestrator target backends.
+const (
+	OrchestratorTargetKubernetes = "kubernetes"
+	OrchestratorTargetDocker     = "docker"
+)
+
+// OrchestratorTarget is a named placement target: a Kubernetes cluster or a
+// Docker host with its own credentials, used alongside the default backend
+// chosen by the orchestrator_backend setting. Instances are bound to a
+// target by name (Instance.PlacementTarget), so Name cannot change once set.
+//
+// Kubernetes targets use Kubeconfig (encrypted at rest with the Fernet
+// helpers in utils/crypto.go) and KubeContext; with no kubeconfig the
+// control plane's own in-cluster or default kubeconfig is used with
+// KubeContext applied. Namespace falls back to CLAWORC_K8S_NAMESPACE.
+//
+// Docker targets use DockerHost (e.g. tcp://10.0.0.5:2376), with optional
+// TLS client credentials; DockerTLSKey is encrypted like Kubeconfig.
+// SSHHost is the address on that host the control plane can reach: instance
+// sshd ports are published on it and dialled there instead of loopback.
+type OrchestratorTarget struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name          string    `gorm:"uniqueIndex;not null" json:"name"`
+	Backend       string    `gorm:"not null;size:16" json:"backend"` // kubernetes|docker
+	Kubeconfig    string    `gorm:"type:text;default:''" json:"-"`   // Fernet-encrypted YAML
+	KubeContext   string    `gorm:"default:''" json:"kube_context"`
+	Namespace     string    `gorm:"default:''" json:"namespace"`
+	DockerHost    string    `gorm:"default:''" json:"docker_host"`
+	DockerTLSCA   string    `gorm:"type:text;default:''" json:"docker_tls_ca"`   // PEM
+	DockerTLSCert string    `gorm:"type:text;default:''" json:"docker_tls_cert"` // PEM
+	DockerTLSKey  string    `gorm:"type:text;default:''" json:"-"`               // Fernet-encrypted PEM
+	SSHHost       string    `gorm:"default:''" json:"ssh_host"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Power schedule actions.
+const (
+	PowerActionStart = "start"
+	PowerActionStop  = "stop"
+)
+
+// PowerSchedule starts or stops instances on a cron schedule, e.g. to keep
+// them running during business hours only. Like BackupSchedule it covers
+// explicit instances (InstanceIDs) and whole teams (TeamIDs); teams are
+// expanded when the schedule fires, so new instances in a covered team are
+// included. Both are JSON arrays of uint IDs.
+//
+// CronExpression is evaluated in UTC unless it starts with a CRON_TZ=
+// prefix. NextRunAt is nil while the schedule is disabled.
+type PowerSchedule struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string `gorm:"not null" json:"name"`
+	Action         string `gorm:"not null;size:8" json:"action"` // start|stop
+	CronExpression string `gorm:"not null" json:"cron_expression"`
+	InstanceIDs    string `gorm:"type:text;default:'[]'" json:"-"`
+	TeamIDs        string `gorm:"type:text;default:'[]'" json:"-"`
+	// No GORM `default` tag on Enabled: with one, an explicit false would be
+	// replaced by the DB default on insert (see SharedFolder.ReadOnly).
+	Enabled bool `json:"enabled"`
+	// LastResult summarises the last run, e.g. "stopped 3, skipped 1 busy".
+	LastResult string     `gorm:"type:text;default:''" json:"last_result"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt  *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database/models"
+)
+
+// Notification channel type re-exports so callers can write
+// database.NotificationChannelWebhook.
+const (
+	NotificationChannelWebhook = models.NotificationChannelWebhook
+	NotificationChannelSlack   = models.NotificationChannelSlack
+	NotificationChannelEmail   = models.NotificationChannelEmail
+)
+
+// IsValidNotificationChannelType reports whether t is a supported channel
+// type.
+func IsValidNotificationChannelType(t string) bool {
+	switch t {
+	case NotificationChannelWebhook, NotificationChannelSlack, NotificationChannelEmail:
+		return true
+	}
+	return false
+}
+
+// ListNotificationChannels returns every channel ordered by ID.
+func ListNotificationChannels() ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	if err := DB.Order("id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// GetNotificationChannel returns the channel with the given ID, or
+// gorm.ErrRecordNotFound.
+func GetNotificationChannel(id uint) (*NotificationChannel, error) {
+	var c NotificationChannel
+	if err := DB.First(&c, id).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteNotificationChannel removes a channel together with its rules.
+func DeleteNotificationChannel(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&NotificationChannel{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("channel_id = ?", id).Delete(&NotificationRule{}).Error
+	})
+}
+
+// ListNotificationRules returns every rule ordered by channel then ID.
+func ListNotificationRules() ([]NotificationRule, error) {
+	var rules []NotificationRule
+	if err := DB.Order("channel_id, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// DeleteNotificationRule removes a rule by ID.
+func DeleteNotificationRule(id uint) error {
+	res := DB.Delete(&NotificationRule{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
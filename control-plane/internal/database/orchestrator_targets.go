@@ -0,0 +1,50 @@
+package database
+
+import "github.com/gluk-w/claworc/control-plane/internal/database/models"
+
+// Orchestrator target backend re-exports.
+const (
+	OrchestratorTargetKubernetes = models.OrchestratorTargetKubernetes
+	OrchestratorTargetDocker     = models.OrchestratorTargetDocker
+)
+
+// DefaultPlacementTarget is the name the API uses for the default backend
+// (an empty Instance.PlacementTarget). It cannot be used as a target name.
+const DefaultPlacementTarget = "default"
+
+// ListOrchestratorTargets returns every target ordered by name.
+func ListOrchestratorTargets() ([]OrchestratorTarget, error) {
+	var targets []OrchestratorTarget
+	if err := DB.Order("name").Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// GetOrchestratorTarget returns the target with the given ID, or
+// gorm.ErrRecordNotFound.
+func GetOrchestratorTarget(id uint) (*OrchestratorTarget, error) {
+	var t OrchestratorTarget
+	if err := DB.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetOrchestratorTargetByName returns the named target, or
+// gorm.ErrRecordNotFound.
+func GetOrchestratorTargetByName(name string) (*OrchestratorTarget, error) {
+	var t OrchestratorTarget
+	if err := DB.Where("name = ?", name).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CountInstancesOnTarget returns how many instances are bound to the named
+// target.
+func CountInstancesOnTarget(name string) (int64, error) {
+	var n int64
+	err := DB.Model(&Instance{}).Where("placement_target = ?", name).Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database/models"
+)
+
+// Power schedule action re-exports.
+const (
+	PowerActionStart = models.PowerActionStart
+	PowerActionStop  = models.PowerActionStop
+)
+
+// ListPowerSchedules returns every power schedule ordered by name.
+func ListPowerSchedules() ([]PowerSchedule, error) {
+	var schedules []PowerSchedule
+	if err := DB.Order("name").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// GetPowerSchedule returns the schedule with the given ID, or
+// gorm.ErrRecordNotFound.
+func GetPowerSchedule(id uint) (*PowerSchedule, error) {
+	var s PowerSchedule
+	if err := DB.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListDuePowerSchedules returns the enabled schedules whose next run is at
+// or before now.
+func ListDuePowerSchedules(now time.Time) ([]PowerSchedule, error) {
+	var schedules []PowerSchedule
+	if err := DB.Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Order("id").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// ListPowerScheduleInstances returns the instances a schedule covers: those
+// listed explicitly plus every instance currently in one of its teams.
+func ListPowerScheduleInstances(s PowerSchedule) ([]Instance, error) {
+	ids := ParseTeamIDs(s.InstanceIDs)
+	teamIDs := ParseTeamIDs(s.TeamIDs)
+	var instances []Instance
+	if len(ids) == 0 && len(teamIDs) == 0 {
+		return instances, nil
+	}
+	q := DB.Order("id")
+	switch {
+	case len(ids) > 0 && len(teamIDs) > 0:
+		q = q.Where("id IN ? OR team_id IN ?", ids, teamIDs)
+	case len(ids) > 0:
+		q = q.Where("id IN ?", ids)
+	default:
+		q = q.Where("team_id IN ?", teamIDs)
+	}
+	if err := q.Find(&instances).Error; err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
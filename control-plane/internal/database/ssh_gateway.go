@@ -0,0 +1,13 @@
+package database
+
+// GatewayPortForwardingSetting is the admin toggle ("true"/"false") that
+// allows direct-tcpip port forwarding through the SSH gateway. Off unless
+// set; each instance additionally needs a non-empty ForwardPorts allowlist.
+const GatewayPortForwardingSetting = "ssh_gateway_port_forwarding"
+
+// GatewayPortForwardingEnabled reports whether GatewayPortForwardingSetting
+// is on.
+func GatewayPortForwardingEnabled() bool {
+	v, _ := GetSetting(GatewayPortForwardingSetting)
+	return v == "true"
+}
@@ -0,0 +1,32 @@
+package database
+
+import "strconv"
+
+// Terminal recording settings. Recording itself is enabled by
+// CLAWORC_TERMINAL_RECORDING_DIR; these tune it at runtime.
+const (
+	// TerminalRecordingRetentionSetting is how many days recordings are kept
+	// ("0" = forever).
+	TerminalRecordingRetentionSetting = "terminal_recording_retention_days"
+	// TerminalRecordingInputSetting ("true"/"false") also records keystrokes.
+	// Off by default: input includes anything typed, passwords too.
+	TerminalRecordingInputSetting = "terminal_recording_input"
+)
+
+// TerminalRecordingRetentionDays returns TerminalRecordingRetentionSetting,
+// defaulting to 90.
+func TerminalRecordingRetentionDays() int {
+	if v, err := GetSetting(TerminalRecordingRetentionSetting); err == nil {
+		if d, err := strconv.Atoi(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return 90
+}
+
+// TerminalRecordingInputEnabled reports whether TerminalRecordingInputSetting
+// is on.
+func TerminalRecordingInputEnabled() bool {
+	v, _ := GetSetting(TerminalRecordingInputSetting)
+	return v == "true"
+}
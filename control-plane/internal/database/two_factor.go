@@ -0,0 +1,139 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Require2FARolesSetting holds a comma-separated list of global roles
+// ("admin", "user") whose members must use a second factor.
+const Require2FARolesSetting = "require_2fa_roles"
+
+// Require2FARoles returns the roles listed in Require2FARolesSetting.
+func Require2FARoles() []string {
+	raw, _ := GetSetting(Require2FARolesSetting)
+	var out []string
+	for _, r := range strings.Split(raw, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// UserRequires2FA reports whether policy obliges user to log in with a
+// second factor, either through their global role or through membership of
+// a team with Require2FA set. Service accounts are exempt; they have no
+// interactive login.
+func UserRequires2FA(user *User) bool {
+	if user.AuthSource == "service" {
+		return false
+	}
+	for _, r := range Require2FARoles() {
+		if r == user.Role {
+			return true
+		}
+	}
+	var n int64
+	DB.Model(&TeamMember{}).
+		Joins("JOIN teams ON teams.id = team_members.team_id").
+		Where("team_members.user_id = ? AND teams.require_2fa = ?", user.ID, true).
+		Count(&n)
+	return n > 0
+}
+
+// UserHasPasskey reports whether the user has registered a WebAuthn
+// credential.
+func UserHasPasskey(userID uint) bool {
+	var n int64
+	DB.Model(&WebAuthnCredential{}).Where("user_id = ?", userID).Count(&n)
+	return n > 0
+}
+
+// SetUserTOTPSecret stores a pending (not yet enabled) encrypted secret.
+func SetUserTOTPSecret(userID uint, encrypted string) error {
+	return DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error
+}
+
+// EnableUserTOTP turns TOTP on and records the step of the code that
+// confirmed enrollment.
+func EnableUserTOTP(userID uint, step int64) error {
+	return DB.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_enabled":     true,
+		"totp_last_step":   step,
+		"totp_setup_until": nil,
+	}).Error
+}
+
+// DisableUserTOTP clears the secret and every recovery code.
+func DisableUserTOTP(userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&UserRecoveryCode{}).Error
+	})
+}
+
+// AdvanceUserTOTPStep records step as the last accepted one. It only
+// succeeds when step is newer than the stored value, so a code can be used
+// once even under concurrent logins.
+func AdvanceUserTOTPStep(userID uint, step int64) bool {
+	res := DB.Model(&User{}).Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for hashes.
+func ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			if err := tx.Create(&UserRecoveryCode{UserID: userID, CodeHash: h}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes remain.
+func CountUnusedRecoveryCodes(userID uint) int64 {
+	var n int64
+	DB.Model(&UserRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&n)
+	return n
+}
+
+// RedeemRecoveryCode marks the unused code with hash as used. It reports
+// false when no such code exists.
+func RedeemRecoveryCode(userID uint, hash string) bool {
+	now := time.Now()
+	res := DB.Model(&UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", &now)
+	return res.Error == nil && res.RowsAffected > 0
+}
+
+// SetUserTOTPSetupWindow opens the window in which a user that policy
+// obliges to use 2FA may enroll TOTP after a password-only login, or
+// closes it when until is nil.
+func SetUserTOTPSetupWindow(userID uint, until *time.Time) error {
+	return DB.Model(&User{}).Where("id = ?", userID).Update("totp_setup_until", until).Error
+}
+
+// TOTPSetupAllowed reports whether user's enrollment window is open at now.
+func TOTPSetupAllowed(user *User, now time.Time) bool {
+	return user.TOTPSetupUntil != nil && now.Before(*user.TOTPSetupUntil)
+}
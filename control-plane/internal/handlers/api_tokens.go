@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/middleware"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+)
+
+const (
+	defaultAPITokenDays = 90
+	maxAPITokenDays     = 365
+)
+
+type apiTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Expired    bool       `json:"expired"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is the secret itself, present only in the create response.
+	Token string `json:"token,omitempty"`
+}
+
+func toAPITokenResponse(t *database.APIToken) apiTokenResponse {
+	scopes := database.ParseAPITokenScopes(t.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return apiTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  t.ExpiresAt,
+		Expired:    time.Now().After(t.ExpiresAt),
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func listTokensFor(w http.ResponseWriter, owner *database.User) {
+	tokens, err := database.ListAPITokens(owner.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list API tokens")
+		return
+	}
+	out := make([]apiTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		out = append(out, toAPITokenResponse(&tokens[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func createTokenFor(w http.ResponseWriter, r *http.Request, owner *database.User) {
+	var body struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > 128 {
+		writeError(w, http.StatusBadRequest, "Name is required (max 128 characters)")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	for _, s := range body.Scopes {
+		if !auth.IsValidScope(s) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope %q (valid: %s)", s, strings.Join(auth.Scopes, ", ")))
+			return
+		}
+	}
+	if body.ExpiresInDays == 0 {
+		body.ExpiresInDays = defaultAPITokenDays
+	}
+	if body.ExpiresInDays < 1 || body.ExpiresInDays > maxAPITokenDays {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 1 and %d", maxAPITokenDays))
+		return
+	}
+
+	token, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	t := &database.APIToken{
+		UserID:    owner.ID,
+		Name:      body.Name,
+		Prefix:    token[:len(auth.APITokenPrefix)+6],
+		TokenHash: hash,
+		Scopes:    strings.Join(body.Scopes, ","),
+		ExpiresAt: time.Now().Add(time.Duration(body.ExpiresInDays) * 24 * time.Hour),
+	}
+	if creator := middleware.GetUser(r); creator != nil {
+		t.CreatedBy = creator.ID
+	}
+	if err := database.CreateAPIToken(t); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+
+	auditLog(sshaudit.EventAPITokenCreated, 0, getUsername(r),
+		fmt.Sprintf("token %d %q for %s, scopes=%s, expires=%s",
+			t.ID, t.Name, owner.Username, t.Scopes, t.ExpiresAt.Format(time.RFC3339)))
+
+	resp := toAPITokenResponse(t)
+	resp.Token = token
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func revokeTokenFor(w http.ResponseWriter, r *http.Request, owner *database.User) {
+	tokenID, err := strconv.Atoi(chi.URLParam(r, "tokenId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+	t, err := database.DeleteAPIToken(owner.ID, uint(tokenID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "API token not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to revoke API token")
+		return
+	}
+	auditLog(sshaudit.EventAPITokenRevoked, 0, getUsername(r),
+		fmt.Sprintf("token %d %q of %s", t.ID, t.Name, owner.Username))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMyAPITokens handles GET /api/v1/auth/tokens.
+func ListMyAPITokens(w http.ResponseWriter, r *http.Request) {
+	listTokensFor(w, middleware.GetUser(r))
+}
+
+// CreateMyAPIToken handles POST /api/v1/auth/tokens. The token secret is
+// only returned in this response.
+func CreateMyAPIToken(w http.ResponseWriter, r *http.Request) {
+	createTokenFor(w, r, middleware.GetUser(r))
+}
+
+// RevokeMyAPIToken handles DELETE /api/v1/auth/tokens/{tokenId}.
+func RevokeMyAPIToken(w http.ResponseWriter, r *http.Request) {
+	revokeTokenFor(w, r, middleware.GetUser(r))
+}
+
+// ListAPITokenScopes handles GET /api/v1/auth/tokens/scopes.
+func ListAPITokenScopes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, auth.Scopes)
+}
+
+// serviceAccountFromURL loads the service account named by {userId}, writing
+// a 404 when the user does not exist or is not a service account.
+func serviceAccountFromURL(w http.ResponseWriter, r *http.Request) *database.User {
+	id, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return nil
+	}
+	user, err := database.GetUserByID(uint(id))
+	if err != nil || user.AuthSource != auth.AuthSourceService {
+		writeError(w, http.StatusNotFound, "Service account not found")
+		return nil
+	}
+	return user
+}
+
+// ListServiceAccounts handles GET /api/v1/service-accounts.
+func ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	users, err := database.ListServiceAccounts()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list service accounts")
+		return
+	}
+	if users == nil {
+		users = []database.User{}
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// CreateServiceAccount handles POST /api/v1/service-accounts. Service
+// accounts have no password; team access is granted through the regular
+// team membership endpoints.
+func CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	body.Username = strings.TrimSpace(body.Username)
+	if body.Username == "" || len(body.Username) > 64 {
+		writeError(w, http.StatusBadRequest, "Username is required (max 64 characters)")
+		return
+	}
+	if body.Role == "" {
+		body.Role = "user"
+	}
+	if body.Role != "admin" && body.Role != "user" {
+		writeError(w, http.StatusBadRequest, "Role must be 'admin' or 'user'")
+		return
+	}
+
+	user := &database.User{
+		Username:   body.Username,
+		Role:       body.Role,
+		AuthSource: auth.AuthSourceService,
+	}
+	if err := database.CreateUser(user); err != nil {
+		writeError(w, http.StatusConflict, "Username already exists")
+		return
+	}
+	auditLog(sshaudit.EventServiceAccountCreated, 0, getUsername(r),
+		fmt.Sprintf("service account %q (role %s)", user.Username, user.Role))
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// DeleteServiceAccount handles DELETE /api/v1/service-accounts/{userId}.
+// Its tokens go with it.
+func DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	user := serviceAccountFromURL(w, r)
+	if user == nil {
+		return
+	}
+	if err := database.DeleteUser(user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete service account")
+		return
+	}
+	auditLog(sshaudit.EventServiceAccountDeleted, 0, getUsername(r),
+		fmt.Sprintf("service account %q", user.Username))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListServiceAccountTokens handles GET /api/v1/service-accounts/{userId}/tokens.
+func ListServiceAccountTokens(w http.ResponseWriter, r *http.Request) {
+	if user := serviceAccountFromURL(w, r); user != nil {
+		listTokensFor(w, user)
+	}
+}
+
+// CreateServiceAccountToken handles POST /api/v1/service-accounts/{userId}/tokens.
+func CreateServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	if user := serviceAccountFromURL(w, r); user != nil {
+		createTokenFor(w, r, user)
+	}
+}
+
+// RevokeServiceAccountToken handles
+// DELETE /api/v1/service-accounts/{userId}/tokens/{tokenId}.
+func RevokeServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	if user := serviceAccountFromURL(w, r); user != nil {
+		revokeTokenFor(w, r, user)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupAPITokenTest(t *testing.T) {
+	t.Helper()
+	setupAuthTest(t)
+	database.DB.AutoMigrate(&database.APIToken{})
+}
+
+func tokenRequest(method, path string, user *database.User, params map[string]string, body interface{}) *http.Request {
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, path, bytes.NewReader(b))
+	} else {
+		r = httptest.NewRequest(method, path, nil)
+	}
+	return withChiAndUser(r, user, params)
+}
+
+func TestAPITokens_CreateListRevoke(t *testing.T) {
+	setupAPITokenTest(t)
+	alice := createUserWithPassword(t, "alice", "p", "user")
+
+	w := httptest.NewRecorder()
+	CreateMyAPIToken(w, tokenRequest("POST", "/api/v1/auth/tokens", alice, nil, map[string]any{
+		"name": "ci", "scopes": []string{"instances:read"}, "expires_in_days": 7,
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body.String())
+	}
+	var created apiTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Token, auth.APITokenPrefix) || !strings.HasPrefix(created.Token, created.Prefix) {
+		t.Errorf("token %q, prefix %q", created.Token, created.Prefix)
+	}
+
+	stored, err := database.GetAPITokenByHash(auth.HashSessionToken(created.Token))
+	if err != nil || stored.UserID != alice.ID {
+		t.Fatalf("stored token: %+v, %v", stored, err)
+	}
+
+	w = httptest.NewRecorder()
+	ListMyAPITokens(w, tokenRequest("GET", "/api/v1/auth/tokens", alice, nil, nil))
+	if strings.Contains(w.Body.String(), created.Token) {
+		t.Errorf("list leaks the token secret")
+	}
+	var listed []apiTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].Scopes[0] != "instances:read" {
+		t.Errorf("listed = %+v", listed)
+	}
+
+	// Another user cannot revoke it.
+	bob := createUserWithPassword(t, "bob", "p", "user")
+	id := fmt.Sprint(created.ID)
+	w = httptest.NewRecorder()
+	RevokeMyAPIToken(w, tokenRequest("DELETE", "/api/v1/auth/tokens/"+id, bob, map[string]string{"tokenId": id}, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("foreign revoke status = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	RevokeMyAPIToken(w, tokenRequest("DELETE", "/api/v1/auth/tokens/"+id, alice, map[string]string{"tokenId": id}, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("revoke status = %d, want 204", w.Code)
+	}
+	if _, err := database.GetAPITokenByHash(auth.HashSessionToken(created.Token)); err == nil {
+		t.Errorf("token still present after revoke")
+	}
+}
+
+func TestAPITokens_Validation(t *testing.T) {
+	setupAPITokenTest(t)
+	alice := createUserWithPassword(t, "alice", "p", "user")
+
+	for _, body := range []map[string]any{
+		{"name": "", "scopes": []string{"all"}},
+		{"name": "x", "scopes": []string{}},
+		{"name": "x", "scopes": []string{"root"}},
+		{"name": "x", "scopes": []string{"all"}, "expires_in_days": 1000},
+	} {
+		w := httptest.NewRecorder()
+		CreateMyAPIToken(w, tokenRequest("POST", "/api/v1/auth/tokens", alice, nil, body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %v: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestServiceAccounts(t *testing.T) {
+	setupAPITokenTest(t)
+	admin := createUserWithPassword(t, "admin", "p", "admin")
+
+	w := httptest.NewRecorder()
+	CreateServiceAccount(w, tokenRequest("POST", "/api/v1/service-accounts", admin, nil, map[string]any{"username": "deploy-bot"}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body.String())
+	}
+	var sa database.User
+	json.Unmarshal(w.Body.Bytes(), &sa)
+	if sa.AuthSource != auth.AuthSourceService || sa.Role != "user" {
+		t.Errorf("service account = %+v", sa)
+	}
+
+	// Service accounts cannot log in with a password.
+	w = httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "deploy-bot", "password": "x"}))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("service account login status = %d, want 401", w.Code)
+	}
+
+	id := fmt.Sprint(sa.ID)
+	w = httptest.NewRecorder()
+	CreateServiceAccountToken(w, tokenRequest("POST", "/api/v1/service-accounts/"+id+"/tokens", admin,
+		map[string]string{"userId": id}, map[string]any{"name": "deploy", "scopes": []string{"instances:write"}}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("token status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Regular users are not service accounts.
+	adminID := fmt.Sprint(admin.ID)
+	w = httptest.NewRecorder()
+	ListServiceAccountTokens(w, tokenRequest("GET", "/api/v1/service-accounts/"+adminID+"/tokens", admin,
+		map[string]string{"userId": adminID}, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("non-service-account status = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	DeleteServiceAccount(w, tokenRequest("DELETE", "/api/v1/service-accounts/"+id, admin, map[string]string{"userId": id}, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	var n int64
+	database.DB.Model(&database.APIToken{}).Where("user_id = ?", sa.ID).Count(&n)
+	if n != 0 {
+		t.Errorf("%d tokens survived their service account", n)
+	}
+}
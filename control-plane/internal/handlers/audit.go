@@ -1,15 +1,28 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 )
 
 // AuditLog is set from main.go during init.
 var AuditLog *sshaudit.Auditor
 
+// AuditEvents is the dashboard/API change log, set from main.go during init.
+var AuditEvents *audit.Logger
+
+// maxAuditExport caps how many entries one export returns.
+const maxAuditExport = 100000
+
 // GetAuditLogs handles GET /api/v1/audit-logs (admin only).
 // Query parameters:
 //   - instance_id (optional): filter by instance
@@ -71,3 +84,172 @@ func GetAuditLogs(w http.ResponseWriter, r *http.Request) {
 		"total":   total,
 	})
 }
+
+// auditEventQuery parses the filters shared by ListAuditEvents and
+// ExportAuditEvents. On error it has already written the response.
+func auditEventQuery(w http.ResponseWriter, r *http.Request) (audit.QueryOptions, bool) {
+	q := r.URL.Query()
+	opts := audit.QueryOptions{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		if v := q.Get(f.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid "+f.name+" (want RFC 3339, e.g. 2026-01-02T15:04:05Z)")
+				return opts, false
+			}
+			*f.dst = t
+		}
+	}
+	return opts, true
+}
+
+// ListAuditEvents handles GET /api/v1/audit-events (admin only).
+// Query parameters:
+//   - actor, target_type, target_id (optional): exact filters
+//   - action (optional): exact, or a prefix when it ends in "*"
+//   - since, until (optional): RFC 3339 time bounds
+//   - limit (optional): number of entries per page (default 100)
+//   - offset (optional): pagination offset
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if AuditEvents == nil {
+		writeError(w, http.StatusServiceUnavailable, "Audit logging not initialized")
+		return
+	}
+	opts, ok := auditEventQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		opts.Limit = limit
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		opts.Offset = offset
+	}
+
+	entries, total, err := AuditEvents.Query(opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to query audit events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+	})
+}
+
+// ExportAuditEvents handles GET /api/v1/audit-events/export (admin only).
+// It takes the ListAuditEvents filters plus format=csv (default) or json,
+// and returns every matching entry (newest first, at most maxAuditExport)
+// as a download.
+func ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if AuditEvents == nil {
+		writeError(w, http.StatusServiceUnavailable, "Audit logging not initialized")
+		return
+	}
+	opts, ok := auditEventQuery(w, r)
+	if !ok {
+		return
+	}
+	opts.Limit = maxAuditExport
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		writeError(w, http.StatusBadRequest, "format must be 'csv' or 'json'")
+		return
+	}
+
+	filename := "audit-events-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var err error
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = writeAuditJSON(w, opts)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = writeAuditCSV(w, opts)
+	}
+	if err != nil {
+		// Headers are gone; the truncated download is all we can signal.
+		log.Printf("Audit export failed: %v", err)
+	}
+}
+
+// writeAuditJSON streams entries as a JSON array.
+func writeAuditJSON(w http.ResponseWriter, opts audit.QueryOptions) error {
+	enc := json.NewEncoder(w)
+	sep := "["
+	err := AuditEvents.Each(opts, func(e *audit.Entry) error {
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		sep = ","
+		return enc.Encode(e)
+	})
+	if sep == "[" {
+		io.WriteString(w, "[")
+	}
+	io.WriteString(w, "]\n")
+	return err
+}
+
+// writeAuditCSV streams entries as CSV, one row per entry with the changes
+// as a JSON column.
+func writeAuditCSV(w http.ResponseWriter, opts audit.QueryOptions) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor", "source_ip", "action", "target_type", "target_id",
+		"target_name", "method", "path", "status", "changes"})
+	err := AuditEvents.Each(opts, func(e *audit.Entry) error {
+		changes := ""
+		if len(e.Changes) > 0 {
+			b, _ := json.Marshal(e.Changes)
+			changes = string(b)
+		}
+		return cw.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10), e.CreatedAt.UTC().Format(time.RFC3339), csvSafe(e.Actor), e.SourceIP,
+			csvSafe(e.Action), e.TargetType, csvSafe(e.TargetID), csvSafe(e.TargetName), e.Method, csvSafe(e.Path),
+			strconv.Itoa(e.Status), changes,
+		})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return err
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user-supplied
+// values (instance names, usernames) as formulas.
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
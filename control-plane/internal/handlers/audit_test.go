@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 )
@@ -325,3 +329,121 @@ func TestGetAuditLogs_ResponseFormat(t *testing.T) {
 		t.Error("response missing 'total' field")
 	}
 }
+
+func setupAuditEventsTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	l, err := audit.NewLogger(database.DB, 365)
+	if err != nil {
+		t.Fatalf("new audit logger: %v", err)
+	}
+	AuditEvents = l
+	t.Cleanup(func() { AuditEvents = nil })
+}
+
+// serveAudited runs h behind the audit middleware, as main.go wires it.
+func serveAudited(h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	audit.Middleware(AuditEvents, getUsername)(h).ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateProvider_AuditsRedactedKeyChange(t *testing.T) {
+	setupAuditEventsTest(t)
+	database.DB.AutoMigrate(&database.LLMProvider{})
+	p := database.LLMProvider{Key: "openai", Name: "OpenAI", BaseURL: "https://api.openai.com/v1"}
+	database.DB.Create(&p)
+
+	user := createTestUser(t, "admin")
+	req := buildRequest(t, "PUT", "/api/v1/llm/providers/1", user, map[string]string{"id": fmt.Sprint(p.ID)})
+	req.Body = io.NopCloser(strings.NewReader(`{"name":"OpenAI prod","api_key":"sk-live-123"}`))
+	if w := serveAudited(UpdateProvider, req); w.Code != http.StatusOK {
+		t.Fatalf("update provider: %d %s", w.Code, w.Body.String())
+	}
+
+	entries, _, _ := AuditEvents.Query(audit.QueryOptions{Action: "provider.update"})
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	e := entries[0]
+	if e.Actor != user.Username || e.TargetType != "provider" || e.TargetID != fmt.Sprint(p.ID) || e.TargetName != "openai" {
+		t.Errorf("entry = %+v", e)
+	}
+	if c := e.Changes["name"]; c.Before != "OpenAI" || c.After != "OpenAI prod" {
+		t.Errorf("name change = %+v", c)
+	}
+	if c, ok := e.Changes["api_key"]; !ok || c.After != audit.Redacted {
+		t.Errorf("api_key change = %+v, want redacted", c)
+	}
+	raw, _ := json.Marshal(e)
+	if strings.Contains(string(raw), "sk-live-123") {
+		t.Error("audit entry leaks the API key")
+	}
+}
+
+func TestListAuditEvents_Filters(t *testing.T) {
+	setupAuditEventsTest(t)
+	AuditEvents.Log(&audit.Entry{Actor: "alice", Action: "instance.create", TargetType: "instance", TargetID: "1"})
+	AuditEvents.Log(&audit.Entry{Actor: "bob", Action: "settings.update", TargetType: "settings"})
+
+	user := createTestUser(t, "admin")
+	w := httptest.NewRecorder()
+	ListAuditEvents(w, buildRequest(t, "GET", "/api/v1/audit-events?actor=alice&action=instance.*", user, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result struct {
+		Entries []audit.Entry `json:"entries"`
+		Total   int64         `json:"total"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Total != 1 || result.Entries[0].Action != "instance.create" {
+		t.Errorf("result = %+v", result)
+	}
+
+	w = httptest.NewRecorder()
+	ListAuditEvents(w, buildRequest(t, "GET", "/api/v1/audit-events?since=yesterday", user, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: expected 400, got %d", w.Code)
+	}
+}
+
+func TestExportAuditEvents(t *testing.T) {
+	setupAuditEventsTest(t)
+	AuditEvents.Log(&audit.Entry{Actor: "alice", Action: "instance.create", TargetName: "=HYPERLINK(\"x\")",
+		Changes: audit.Changes{"name": {After: "bot"}}})
+	AuditEvents.Log(&audit.Entry{Actor: "bob", Action: "settings.update"})
+	user := createTestUser(t, "admin")
+
+	w := httptest.NewRecorder()
+	ExportAuditEvents(w, buildRequest(t, "GET", "/api/v1/audit-events/export", user, nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv export: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "id" || rows[2][2] != "alice" {
+		t.Fatalf("csv rows = %q", rows)
+	}
+	if rows[2][7] != `'=HYPERLINK("x")` || rows[2][11] != `{"name":{"before":null,"after":"bot"}}` {
+		t.Errorf("csv row = %q", rows[2])
+	}
+
+	w = httptest.NewRecorder()
+	ExportAuditEvents(w, buildRequest(t, "GET", "/api/v1/audit-events/export?format=json&actor=bob", user, nil))
+	var entries []audit.Entry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("parse json export: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "bob" {
+		t.Errorf("json export = %+v", entries)
+	}
+
+	w = httptest.NewRecorder()
+	ExportAuditEvents(w, buildRequest(t, "GET", "/api/v1/audit-events/export?format=json&actor=nobody", user, nil))
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("empty json export = %q", w.Body.String())
+	}
+}
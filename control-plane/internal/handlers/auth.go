@@ -13,6 +13,7 @@ import (
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-webauthn/webauthn/protocol"
 )
 
@@ -61,6 +62,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		// TOTPCode is a code from the user's authenticator app or one of
+		// their recovery codes; required when TOTP is enabled.
+		TOTPCode string `json:"totp_code"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -72,13 +76,16 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := database.GetUserByUsername(body.Username)
-	if err != nil || !auth.CheckPassword(body.Password, user.PasswordHash) {
-		writeError(w, http.StatusUnauthorized, "Invalid username or password")
+	user, status, msg := authenticatePassword(body.Username, body.Password)
+	if user == nil {
+		writeError(w, status, msg)
+		return
+	}
+	if !checkLoginSecondFactor(w, r, user, body.TOTPCode) {
 		return
 	}
 
-	sessionID, err := SessionStore.Create(user.ID)
+	sessionID, err := SessionStore.CreateWithInfo(user.ID, r.UserAgent(), sourceIPOf(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create session")
 		return
@@ -94,6 +101,51 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// authenticatePassword checks a username/password pair against the local
+// bcrypt hash, or against the LDAP directory for LDAP users and for
+// usernames Claworc does not know yet. On failure it returns a nil user
+// with the HTTP status and message to report.
+func authenticatePassword(username, password string) (*database.User, int, string) {
+	user, err := database.GetUserByUsername(username)
+	if err == nil && user.AuthSource != auth.AuthSourceLDAP {
+		if auth.CheckPassword(password, user.PasswordHash) {
+			if user.Disabled {
+				return nil, http.StatusForbidden, "Account is disabled"
+			}
+			return user, 0, ""
+		}
+		// A local account may be taken over by its directory namesake
+		// when linking is enabled; otherwise the password is just wrong.
+		if auth.LDAP == nil || !auth.LDAP.ProvisionOpts.LinkByUsername || user.AuthSource != "local" {
+			return nil, http.StatusUnauthorized, "Invalid username or password"
+		}
+	}
+	if auth.LDAP == nil {
+		return nil, http.StatusUnauthorized, "Invalid username or password"
+	}
+
+	id, err := auth.LDAP.Authenticate(username, password)
+	switch {
+	case err == nil:
+	case errors.Is(err, auth.ErrLDAPInvalidCredentials):
+		return nil, http.StatusUnauthorized, "Invalid username or password"
+	case errors.Is(err, auth.ErrLDAPGroupDenied):
+		return nil, http.StatusForbidden, "Your account is not allowed to use Claworc"
+	default:
+		log.Printf("ldap login %q: %v", username, err)
+		return nil, http.StatusBadGateway, "Directory server unavailable"
+	}
+	user, err = auth.ProvisionExternalUser(*id, auth.LDAP.ProvisionOpts)
+	if err != nil {
+		log.Printf("ldap login: provision %q: %v", id.Username, err)
+		if errors.Is(err, auth.ErrUserNotProvisioned) {
+			return nil, http.StatusForbidden, "No Claworc account for " + id.Username
+		}
+		return nil, http.StatusInternalServerError, "Failed to provision user"
+	}
+	return user, 0, ""
+}
+
 func Logout(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(auth.SessionCookie)
 	if err == nil {
@@ -191,7 +243,7 @@ func SetupCreateAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionID, err := SessionStore.Create(user.ID)
+	sessionID, err := SessionStore.CreateWithInfo(user.ID, r.UserAgent(), sourceIPOf(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create session")
 		return
@@ -263,6 +315,68 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+type sessionResponse struct {
+	auth.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions handles GET /api/v1/auth/sessions. It returns the caller's
+// active dashboard sessions, marking the one making the request.
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	current := ""
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil {
+		current = auth.HashSessionToken(cookie.Value)
+	}
+	sessions := SessionStore.ListByUserID(user.ID)
+	out := make([]sessionResponse, len(sessions))
+	for i, s := range sessions {
+		out[i] = sessionResponse{Session: s, Current: s.ID == current}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// RevokeSession handles DELETE /api/v1/auth/sessions/{sessionId}. Users can
+// only revoke their own sessions; revoking the current one also clears the
+// cookie.
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	id := chi.URLParam(r, "sessionId")
+	if !SessionStore.Revoke(user.ID, id) {
+		writeError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil && auth.HashSessionToken(cookie.Value) == id {
+		clearSessionCookie(w, r)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessions handles DELETE /api/v1/auth/sessions. It signs the
+// caller out everywhere except the current session.
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	cookie, err := r.Cookie(auth.SessionCookie)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "No current session")
+		return
+	}
+	SessionStore.DeleteByUserIDExcept(user.ID, cookie.Value)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // WebAuthn handlers
 
 func WebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
@@ -382,8 +496,12 @@ func WebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "User not found")
 		return
 	}
+	if user.Disabled {
+		writeError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
 
-	sessionID, err := SessionStore.Create(user.ID)
+	sessionID, err := SessionStore.CreateWithInfo(user.ID, r.UserAgent(), sourceIPOf(r))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create session")
 		return
@@ -103,6 +103,39 @@ func TestLogin_UnknownUser(t *testing.T) {
 	}
 }
 
+func TestLogin_DisabledUser(t *testing.T) {
+	setupAuthTest(t)
+	user := createUserWithPassword(t, "alice", "secret123", "admin")
+	database.DB.Model(user).Update("disabled", true)
+
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{
+		"username": "alice",
+		"password": "secret123",
+	}))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestLogin_LDAPUserWithoutDirectory(t *testing.T) {
+	setupAuthTest(t)
+	user := createUserWithPassword(t, "alice", "secret123", "user")
+	database.DB.Model(user).Update("auth_source", auth.AuthSourceLDAP)
+
+	// A stale local hash must never authenticate a directory user.
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{
+		"username": "alice",
+		"password": "secret123",
+	}))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
+
 func TestLogin_EmptyBody(t *testing.T) {
 	setupAuthTest(t)
 
@@ -322,3 +355,69 @@ func TestGetCurrentUser_NoUser(t *testing.T) {
 		t.Errorf("status = %d, want 401", w.Code)
 	}
 }
+
+// --- Sessions ---
+
+func TestListSessions_MarksCurrent(t *testing.T) {
+	setupAuthTest(t)
+	user := createUserWithPassword(t, "alice", "p", "user")
+	current, _ := SessionStore.CreateWithInfo(user.ID, "Firefox", "203.0.113.7")
+	SessionStore.Create(user.ID)
+	bob := createUserWithPassword(t, "bob", "p", "user")
+	SessionStore.Create(bob.ID)
+
+	req := withChiAndUser(httptest.NewRequest("GET", "/api/v1/auth/sessions", nil), user, nil)
+	req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: current})
+	w := httptest.NewRecorder()
+	ListSessions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var sessions []sessionResponse
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(sessions))
+	}
+	currents := 0
+	for _, s := range sessions {
+		if s.Current {
+			currents++
+			if s.UserAgent != "Firefox" || s.IPAddress != "203.0.113.7" {
+				t.Errorf("current session = %+v", s)
+			}
+		}
+	}
+	if currents != 1 {
+		t.Errorf("%d sessions marked current, want 1", currents)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	setupAuthTest(t)
+	user := createUserWithPassword(t, "alice", "p", "user")
+	bob := createUserWithPassword(t, "bob", "p", "user")
+	mine, _ := SessionStore.Create(user.ID)
+	theirs, _ := SessionStore.Create(bob.ID)
+
+	revoke := func(token string) int {
+		id := auth.HashSessionToken(token)
+		req := withChiAndUser(httptest.NewRequest("DELETE", "/api/v1/auth/sessions/"+id, nil), user, map[string]string{"sessionId": id})
+		w := httptest.NewRecorder()
+		RevokeSession(w, req)
+		return w.Code
+	}
+
+	if code := revoke(theirs); code != http.StatusNotFound {
+		t.Errorf("revoking another user's session: status = %d, want 404", code)
+	}
+	if _, ok := SessionStore.Get(theirs); !ok {
+		t.Error("another user's session was revoked")
+	}
+	if code := revoke(mine); code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", code)
+	}
+	if _, ok := SessionStore.Get(mine); ok {
+		t.Error("session still valid after revoke")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/backup"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
@@ -269,6 +270,14 @@ func RestoreBackupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.SetAction(r, "backup.restore")
+	audit.SetTarget(r, "backup", b.ID, b.InstanceName)
+	audit.SetChange(r, nil, map[string]interface{}{
+		"source_instance_id": b.InstanceID,
+		"target_instance_id": inst.ID,
+		"target_instance":    inst.Name,
+	})
+
 	orch := orchestrator.Get()
 	if orch == nil {
 		WriteOrchestratorUnavailable(w)
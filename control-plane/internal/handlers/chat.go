@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/coder/websocket"
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
@@ -51,6 +52,16 @@ func ChatProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if inst.Status == StatusHibernated {
+		wakingMsg, _ := json.Marshal(map[string]string{"type": "waking"})
+		clientConn.Write(ctx, websocket.MessageText, wakingMsg)
+		if err := WakeInstance(ctx, &inst); err != nil {
+			clientConn.Close(4503, truncate("Failed to wake instance: "+err.Error(), 120))
+			return
+		}
+	}
+	activity.Touch(inst.ID)
+
 	// Get gateway tunnel port
 	port, err := getTunnelPort(uint(id), "gateway")
 	if err != nil {
@@ -146,6 +157,7 @@ func ChatProxy(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			activity.Touch(inst.ID)
 			gwJSON, _ := json.Marshal(gwFrame)
 			log.Printf("[chat] Browser→Gateway: %s", string(gwJSON))
 			if err := gwConn.Write(relayCtx, websocket.MessageText, gwJSON); err != nil {
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
@@ -18,7 +19,7 @@ const connectingPageTmpl = `<!DOCTYPE html>
 <head>
 <meta charset="utf-8">
 <meta name="viewport" content="width=device-width, initial-scale=1">
-<title>Connecting to OpenClaw...</title>
+<title>{{.Heading}}...</title>
 <style>
   body { display:flex; justify-content:center; align-items:center; min-height:100vh; margin:0; background:#0f172a; color:#e2e8f0; font-family:system-ui,sans-serif; }
   .box { text-align:center; }
@@ -33,8 +34,8 @@ const connectingPageTmpl = `<!DOCTYPE html>
 <body>
 <div class="box">
   <div class="spinner"></div>
-  <h1>Connecting to OpenClaw&hellip;</h1>
-  <p>The agent is starting up. This page will refresh automatically.</p>
+  <h1>{{.Heading}}&hellip;</h1>
+  <p>{{.Message}} This page will refresh automatically.</p>
   <a href="/instances/{{.InstanceID}}#logs">View instance logs</a>
 </div>
 <script>
@@ -47,11 +48,26 @@ setInterval(function(){
 
 var connectingPageTemplate = template.Must(template.New("connecting").Parse(connectingPageTmpl))
 
+type connectingPage struct {
+	InstanceID int
+	Heading    string
+	Message    string
+}
+
 func writeConnectingPage(w http.ResponseWriter, instanceID int) {
+	writeStatusPage(w, connectingPage{instanceID, "Connecting to OpenClaw", "The agent is starting up."})
+}
+
+// writeWakingPage is shown while a hibernated instance is started again.
+func writeWakingPage(w http.ResponseWriter, instanceID int) {
+	writeStatusPage(w, connectingPage{instanceID, "Waking up OpenClaw", "The agent was hibernated after being idle and is starting again."})
+}
+
+func writeStatusPage(w http.ResponseWriter, page connectingPage) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Retry-After", "1")
 	w.WriteHeader(http.StatusServiceUnavailable)
-	connectingPageTemplate.Execute(w, struct{ InstanceID int }{instanceID})
+	connectingPageTemplate.Execute(w, page)
 }
 
 // ControlProxy proxies HTTP and WebSocket requests to the gateway service
@@ -68,6 +84,28 @@ func ControlProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Wake a hibernated instance, and look up the gateway token so we can
+	// inject it into upstream WebSocket requests
+	var gatewayToken string
+	var inst database.Instance
+	if err := database.DB.First(&inst, id).Error; err == nil {
+		if inst.Status == StatusHibernated {
+			beginWake(inst)
+			if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				writeError(w, http.StatusServiceUnavailable, "Instance is waking up")
+				return
+			}
+			writeWakingPage(w, id)
+			return
+		}
+		activity.Touch(inst.ID)
+		if inst.GatewayToken != "" {
+			if tok, err := utils.Decrypt(inst.GatewayToken); err == nil && tok != "" {
+				gatewayToken = tok
+			}
+		}
+	}
+
 	info, err := getTunnelPortInfo(uint(id), "gateway")
 	if err != nil {
 		// WebSocket clients can't display HTML — return plain error
@@ -79,15 +117,6 @@ func ControlProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Look up gateway token so we can inject it into upstream WebSocket requests
-	var gatewayToken string
-	var inst database.Instance
-	if err := database.DB.First(&inst, id).Error; err == nil && inst.GatewayToken != "" {
-		if tok, err := utils.Decrypt(inst.GatewayToken); err == nil && tok != "" {
-			gatewayToken = tok
-		}
-	}
-
 	wildcardPath := chi.URLParam(r, "*")
 	// Forward the full path including the basePath prefix so that the gateway
 	// (when configured with gateway.controlUi.basePath) can match the request.
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+// StatusHibernated is the instance status set when the hibernation job
+// stopped an idle instance. Unlike "stopped", the next chat connect, webhook
+// call or SSH gateway login starts it again. See docs/hibernation.md.
+const StatusHibernated = "hibernated"
+
+// wakeTimeout bounds how long a wake may take to report running.
+var wakeTimeout = 5 * time.Minute
+
+// StartHibernationJob starts a background goroutine that stops idle
+// instances every minute, according to each instance's or team's
+// hibernate_after_hours. It returns a cancel function to stop the job.
+func StartHibernationJob(ctx context.Context) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hibernateIdleInstances(ctx, time.Now().UTC())
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// hibernateAfter returns the idle period after which inst is hibernated, or
+// 0 if it never is. The instance's setting overrides its team's.
+func hibernateAfter(inst *database.Instance, teamHours map[uint]int) time.Duration {
+	hours := teamHours[inst.TeamID]
+	if inst.HibernateAfterHours != nil {
+		hours = *inst.HibernateAfterHours
+	}
+	if hours <= 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// idleSince returns when inst was last used. Starting or updating an
+// instance counts as use, so one that was just started by hand is not
+// hibernated straight away.
+func idleSince(inst *database.Instance) time.Time {
+	since := inst.UpdatedAt
+	if inst.LastActivityAt != nil && inst.LastActivityAt.After(since) {
+		since = *inst.LastActivityAt
+	}
+	return since
+}
+
+func hibernateIdleInstances(ctx context.Context, now time.Time) {
+	activity.Flush()
+
+	var teams []database.Team
+	if err := database.DB.Where("hibernate_after_hours > 0").Find(&teams).Error; err != nil {
+		log.Printf("Hibernation job: list teams: %v", err)
+		return
+	}
+	teamHours := make(map[uint]int, len(teams))
+	for _, t := range teams {
+		teamHours[t.ID] = t.HibernateAfterHours
+	}
+
+	var instances []database.Instance
+	if err := database.DB.Where("status = ?", "running").Find(&instances).Error; err != nil {
+		log.Printf("Hibernation job: list instances: %v", err)
+		return
+	}
+	for i := range instances {
+		inst := &instances[i]
+		after := hibernateAfter(inst, teamHours)
+		idle := now.Sub(idleSince(inst))
+		if after == 0 || idle < after {
+			continue
+		}
+		if err := hibernateInstance(ctx, inst); err != nil {
+			log.Printf("Hibernation job: instance %s: %v", utils.SanitizeForLog(inst.Name), err)
+			continue
+		}
+		log.Printf("Hibernated instance %s after %s without activity", utils.SanitizeForLog(inst.Name), idle.Round(time.Minute))
+	}
+}
+
+// hibernateInstance stops inst the way StopInstance does and marks it
+// hibernated. It claims the instance for the stop, so a migration or
+// scheduled power change cannot start underneath it, and leaves the status
+// alone if someone else changed it in the meantime.
+func hibernateInstance(ctx context.Context, inst *database.Instance) error {
+	if holder, ok := claimInstance(inst.ID, opHibernate); !ok {
+		return fmt.Errorf("%s in progress", holder)
+	}
+	defer releaseInstance(inst.ID)
+	if err := stopInstanceWorkload(ctx, inst); err != nil {
+		return err
+	}
+	return database.DB.Model(&database.Instance{}).
+		Where("id = ? AND status = ?", inst.ID, "running").
+		Updates(map[string]interface{}{
+			"status":     StatusHibernated,
+			"updated_at": time.Now().UTC(),
+		}).Error
+}
+
+// stopInstanceWorkload closes inst's SSH connection and tunnels, stops its
+// browser session and stops the container on the instance's own backend,
+// leaving the status to the caller.
+func stopInstanceWorkload(ctx context.Context, inst *database.Instance) error {
+	orch, err := orchestrator.ForTarget(inst.PlacementTarget)
+	if err != nil {
+		return err
+	}
+
+	if SSHMgr != nil {
+		SSHMgr.CancelReconnection(inst.ID)
+	}
+	if TunnelMgr != nil {
+		if err := TunnelMgr.StopTunnelsForInstance(inst.ID); err != nil {
+			log.Printf("Failed to stop tunnels for instance %d: %v", inst.ID, err)
+		}
+	}
+	cancelActiveBrowserSpawn(inst.ID)
+	if BrowserStopper != nil {
+		if err := BrowserStopper.StopSession(ctx, inst.ID); err != nil {
+			log.Printf("Failed to stop browser for instance %d: %v", inst.ID, err)
+		}
+		_ = database.UpdateBrowserSessionStatus(inst.ID, "stopped", "")
+	}
+
+	if err := orch.StopInstance(ctx, inst.Name); err != nil {
+		return fmt.Errorf("stop: %w", err)
+	}
+	return nil
+}
+
+type wakeCall struct {
+	done chan struct{}
+	err  error
+}
+
+var (
+	wakeMu sync.Mutex
+	wakes  = map[uint]*wakeCall{}
+)
+
+// beginWake starts waking inst in the background, or returns the wake
+// already in flight for it.
+func beginWake(inst database.Instance) *wakeCall {
+	wakeMu.Lock()
+	defer wakeMu.Unlock()
+	if c, ok := wakes[inst.ID]; ok {
+		return c
+	}
+	c := &wakeCall{done: make(chan struct{})}
+	wakes[inst.ID] = c
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), wakeTimeout)
+		defer cancel()
+		c.err = wakeInstance(ctx, inst)
+		if c.err != nil {
+			log.Printf("Failed to wake instance %s: %v", utils.SanitizeForLog(inst.Name), c.err)
+		}
+		wakeMu.Lock()
+		delete(wakes, inst.ID)
+		wakeMu.Unlock()
+		close(c.done)
+	}()
+	return c
+}
+
+// WakeInstance starts a hibernated instance and waits until it is running
+// and its tunnels are up. Concurrent callers share one wake; canceling ctx
+// stops waiting but not the wake itself.
+func WakeInstance(ctx context.Context, inst *database.Instance) error {
+	c := beginWake(*inst)
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func wakeInstance(ctx context.Context, inst database.Instance) error {
+	orch := orchestrator.Get()
+	if orch == nil {
+		return errors.New("no orchestrator available")
+	}
+	// Count the wake as activity before the status flips, so the next
+	// hibernation pass does not stop the instance again.
+	activity.Touch(inst.ID)
+	res := database.DB.Model(&database.Instance{}).
+		Where("id = ? AND status = ?", inst.ID, StatusHibernated).
+		Updates(map[string]interface{}{
+			"status":     "running",
+			"updated_at": time.Now().UTC(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Started by someone else in the meantime.
+		return nil
+	}
+
+	if err := orch.StartInstance(ctx, inst.Name); err != nil {
+		database.DB.Model(&database.Instance{}).Where("id = ?", inst.ID).
+			Update("status", StatusHibernated)
+		return fmt.Errorf("start: %w", err)
+	}
+	if !waitForRunning(ctx, orch, inst.Name, wakeTimeout) {
+		return errors.New("instance did not become ready")
+	}
+	if TunnelMgr != nil {
+		if err := TunnelMgr.StartTunnelsForInstance(ctx, inst.ID, orch); err != nil {
+			return fmt.Errorf("start tunnels: %w", err)
+		}
+	}
+	log.Printf("Woke hibernated instance %s", utils.SanitizeForLog(inst.Name))
+	return nil
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+)
+
+// hibernationBackend records which workloads were stopped and started.
+type hibernationBackend struct {
+	mockOrchestrator
+
+	mu      sync.Mutex
+	stopped map[string]bool
+	starts  int
+	onStop  func() // runs during StopInstance, if set
+}
+
+func (m *hibernationBackend) StopInstance(_ context.Context, name string) error {
+	if m.onStop != nil {
+		m.onStop()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped[name] = true
+	return nil
+}
+
+func (m *hibernationBackend) StartInstance(_ context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.stopped, name)
+	m.starts++
+	return nil
+}
+
+func (m *hibernationBackend) GetInstanceStatus(_ context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped[name] {
+		return "stopped", nil
+	}
+	return "running", nil
+}
+
+func setupHibernationTest(t *testing.T) *hibernationBackend {
+	t.Helper()
+	setupTestDB(t)
+	if err := database.DB.AutoMigrate(&database.Team{}); err != nil {
+		t.Fatalf("automigrate teams: %v", err)
+	}
+	// Drop activity recorded by earlier tests against the empty database,
+	// so it is not applied to this test's instances.
+	activity.Flush()
+	orch := &hibernationBackend{stopped: map[string]bool{}}
+	orchestrator.Set(orch)
+	t.Cleanup(func() { orchestrator.Set(nil) })
+	return orch
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestHibernateIdleInstances_Policy(t *testing.T) {
+	orch := setupHibernationTest(t)
+	team := database.Team{Name: "ops", HibernateAfterHours: 4}
+	database.DB.Create(&team)
+	other := database.Team{Name: "dev"}
+	database.DB.Create(&other)
+
+	now := time.Now().UTC()
+	idle := now.Add(-5 * time.Hour)
+	want := map[string]string{}
+	for _, tc := range []struct {
+		name   string
+		team   uint
+		hours  *int
+		lastAt *time.Time
+		want   string
+	}{
+		{"bot-team-idle", team.ID, nil, &idle, StatusHibernated},
+		{"bot-team-never-used", team.ID, nil, nil, StatusHibernated},
+		{"bot-team-recent", team.ID, nil, &now, "running"},
+		{"bot-override-never", team.ID, intPtr(0), &idle, "running"},
+		{"bot-override-longer", team.ID, intPtr(8), &idle, "running"},
+		{"bot-override-shorter", other.ID, intPtr(2), &idle, StatusHibernated},
+		{"bot-no-policy", other.ID, nil, &idle, "running"},
+	} {
+		inst := database.Instance{Name: tc.name, DisplayName: tc.name, Status: "running", TeamID: tc.team, HibernateAfterHours: tc.hours, LastActivityAt: tc.lastAt}
+		database.DB.Create(&inst)
+		database.DB.Model(&inst).UpdateColumn("updated_at", idle)
+		want[tc.name] = tc.want
+	}
+
+	hibernateIdleInstances(context.Background(), now)
+
+	var instances []database.Instance
+	database.DB.Find(&instances)
+	for _, inst := range instances {
+		if inst.Status != want[inst.Name] {
+			t.Errorf("%s: status = %q, want %q", inst.Name, inst.Status, want[inst.Name])
+		}
+		if stopped := orch.stopped[inst.Name]; stopped != (want[inst.Name] == StatusHibernated) {
+			t.Errorf("%s: stopped = %v", inst.Name, stopped)
+		}
+	}
+}
+
+func TestHibernateIdleInstances_RecentUpdateCountsAsActivity(t *testing.T) {
+	orch := setupHibernationTest(t)
+	idle := time.Now().UTC().Add(-5 * time.Hour)
+	inst := database.Instance{Name: "bot-restarted", DisplayName: "Restarted", Status: "running", HibernateAfterHours: intPtr(1), LastActivityAt: &idle}
+	database.DB.Create(&inst)
+
+	hibernateIdleInstances(context.Background(), time.Now().UTC())
+
+	if orch.stopped[inst.Name] {
+		t.Error("an instance started or updated within the idle period must not be hibernated")
+	}
+}
+
+func TestHibernateInstance_SkipsClaimedInstance(t *testing.T) {
+	orch := setupHibernationTest(t)
+	inst := createTestInstance(t, "bot-moving", "Moving")
+	claimInstance(inst.ID, opMigration)
+	t.Cleanup(func() { releaseInstance(inst.ID) })
+
+	if err := hibernateInstance(context.Background(), &inst); err == nil || !strings.Contains(err.Error(), opMigration) {
+		t.Errorf("err = %v, want the migration named", err)
+	}
+	if orch.stopped[inst.Name] {
+		t.Error("an instance claimed by a migration must not be stopped")
+	}
+	if holder, _ := instanceOps.Load(inst.ID); holder != opMigration {
+		t.Errorf("claim = %v, want the migration's kept", holder)
+	}
+}
+
+func TestHibernateInstance_KeepsStatusChangedDuringStop(t *testing.T) {
+	orch := setupHibernationTest(t)
+	inst := createTestInstance(t, "bot-busy", "Busy")
+	orch.onStop = func() {
+		if _, held := instanceOps.Load(inst.ID); !held {
+			t.Error("the instance is not claimed during the stop")
+		}
+		database.DB.Model(&database.Instance{}).Where("id = ?", inst.ID).Update("status", "stopping")
+	}
+
+	if err := hibernateInstance(context.Background(), &inst); err != nil {
+		t.Fatalf("hibernate: %v", err)
+	}
+	var got database.Instance
+	database.DB.First(&got, inst.ID)
+	if got.Status != "stopping" {
+		t.Errorf("status = %q, want the concurrent change kept", got.Status)
+	}
+	if _, held := instanceOps.Load(inst.ID); held {
+		t.Error("the claim was not released")
+	}
+}
+
+func TestHibernateInstance_StopsOnPlacementTarget(t *testing.T) {
+	def := setupHibernationTest(t)
+	eu := &hibernationBackend{stopped: map[string]bool{}}
+	orchestrator.SetTarget("eu", eu)
+	t.Cleanup(func() { orchestrator.SetTarget("eu", nil) })
+	inst := database.Instance{Name: "bot-eu", DisplayName: "EU", Status: "running", PlacementTarget: "eu"}
+	database.DB.Create(&inst)
+
+	if err := hibernateInstance(context.Background(), &inst); err != nil {
+		t.Fatalf("hibernate: %v", err)
+	}
+	if !eu.stopped[inst.Name] || def.stopped[inst.Name] {
+		t.Errorf("stopped on eu=%v default=%v, want only the instance's own backend", eu.stopped[inst.Name], def.stopped[inst.Name])
+	}
+}
+
+func TestResolveStatus_Hibernated(t *testing.T) {
+	setupHibernationTest(t)
+	inst := createTestInstance(t, "bot-sleepy", "Sleepy")
+	inst.Status = StatusHibernated
+
+	if got := resolveStatus(&inst, "stopped"); got != StatusHibernated {
+		t.Errorf("resolveStatus(stopped) = %q, want %q", got, StatusHibernated)
+	}
+	if got := resolveStatus(&inst, "running"); got != "running" {
+		t.Errorf("resolveStatus(running) = %q, want running", got)
+	}
+}
+
+func TestWakeInstance(t *testing.T) {
+	orch := setupHibernationTest(t)
+	inst := createTestInstance(t, "bot-sleepy", "Sleepy")
+	if err := hibernateInstance(context.Background(), &inst); err != nil {
+		t.Fatalf("hibernate: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := WakeInstance(context.Background(), &inst); err != nil {
+				t.Errorf("wake: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var got database.Instance
+	database.DB.First(&got, inst.ID)
+	if got.Status != "running" {
+		t.Errorf("status = %q, want running", got.Status)
+	}
+	if orch.starts != 1 {
+		t.Errorf("starts = %d, want one start for concurrent wakes", orch.starts)
+	}
+}
+
+func TestControlProxy_WakesHibernatedInstance(t *testing.T) {
+	orch := setupHibernationTest(t)
+	inst := createTestInstance(t, "bot-sleepy", "Sleepy")
+	if err := hibernateInstance(context.Background(), &inst); err != nil {
+		t.Fatalf("hibernate: %v", err)
+	}
+
+	id := fmt.Sprint(inst.ID)
+	w := httptest.NewRecorder()
+	ControlProxy(w, buildRequest(t, "GET", "/openclaw/"+id+"/", createTestUser(t, "admin"), map[string]string{"id": id}))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "Waking up") {
+		t.Fatalf("status = %d, want the waking page (body: %.200s)", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var got database.Instance
+		database.DB.First(&got, inst.ID)
+		wakeMu.Lock()
+		pending := len(wakes)
+		wakeMu.Unlock()
+		if got.Status == "running" && pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance not woken: status %q", got.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if orch.starts != 1 {
+		t.Errorf("starts = %d, want 1", orch.starts)
+	}
+}
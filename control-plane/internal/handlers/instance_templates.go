@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/middleware"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// Instance templates: saved, versioned instance settings scoped globally or
+// to a team. See docs/instance-templates.md.
+
+type instanceTemplateResponse struct {
+	database.InstanceTemplate
+	Spec database.InstanceTemplateSpec `json:"spec"` // latest version, env vars decrypted
+}
+
+type instanceTemplateVersionResponse struct {
+	database.InstanceTemplateVersion
+	Spec database.InstanceTemplateSpec `json:"spec"`
+}
+
+// decryptTemplateSpec returns spec with plaintext env var values, as shown
+// in API responses and applied on create.
+func decryptTemplateSpec(spec database.InstanceTemplateSpec) database.InstanceTemplateSpec {
+	spec.EnvVars = decryptEnvVars(spec.EnvVars)
+	return spec
+}
+
+func latestTemplateSpec(t database.InstanceTemplate) database.InstanceTemplateSpec {
+	v, err := database.GetInstanceTemplateVersion(t.ID, t.LatestVersion)
+	if err != nil {
+		return database.InstanceTemplateSpec{}
+	}
+	return decryptTemplateSpec(database.ParseInstanceTemplateSpec(v.Spec))
+}
+
+// templateSpecState flattens a decrypted spec for audit.Diff, which compares
+// and redacts top-level fields only: env var values are redacted under
+// env_vars while their names stay visible.
+type templateSpecState struct {
+	database.InstanceTemplateSpec
+	EnvVarNames []string `json:"env_var_names,omitempty"`
+}
+
+func newTemplateSpecState(spec database.InstanceTemplateSpec) templateSpecState {
+	names := make([]string, 0, len(spec.EnvVars))
+	for k := range spec.EnvVars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return templateSpecState{InstanceTemplateSpec: spec, EnvVarNames: names}
+}
+
+type instanceTemplateAuditState struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	TeamID      uint   `json:"team_id"`
+	Version     int    `json:"version"`
+	templateSpecState
+}
+
+func newInstanceTemplateAuditState(resp instanceTemplateResponse) instanceTemplateAuditState {
+	return instanceTemplateAuditState{
+		Name:              resp.Name,
+		Description:       resp.Description,
+		TeamID:            resp.TeamID,
+		Version:           resp.LatestVersion,
+		templateSpecState: newTemplateSpecState(resp.Spec),
+	}
+}
+
+// canManageTemplate reports whether the caller may change t: admins for
+// global templates, admins or the team's managers for team templates. The
+// same check decides who may create instances from a team template.
+func canManageTemplate(r *http.Request, t database.InstanceTemplate) bool {
+	if t.TeamID == 0 {
+		user := middleware.GetUser(r)
+		return user != nil && user.Role == "admin"
+	}
+	return middleware.CanManageTeam(r, t.TeamID)
+}
+
+// ListInstanceTemplates handles GET /api/v1/instance-templates. Admins see
+// every template, others the global ones and those of teams they manage.
+func ListInstanceTemplates(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var teamIDs []uint
+	if user.Role != "admin" {
+		ids, err := database.UserManagedTeamIDs(user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to list instance templates")
+			return
+		}
+		teamIDs = ids
+	}
+	templates, err := database.ListInstanceTemplates(teamIDs, user.Role == "admin")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list instance templates")
+		return
+	}
+	out := make([]instanceTemplateResponse, len(templates))
+	for i, t := range templates {
+		out[i] = instanceTemplateResponse{InstanceTemplate: t, Spec: latestTemplateSpec(t)}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GetInstanceTemplate handles GET /api/v1/instance-templates/{id}.
+func GetInstanceTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadInstanceTemplate(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, instanceTemplateResponse{InstanceTemplate: *t, Spec: latestTemplateSpec(*t)})
+}
+
+// ListInstanceTemplateVersions handles
+// GET /api/v1/instance-templates/{id}/versions, newest first.
+func ListInstanceTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadInstanceTemplate(w, r)
+	if !ok {
+		return
+	}
+	versions, err := database.ListInstanceTemplateVersions(t.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list template versions")
+		return
+	}
+	out := make([]instanceTemplateVersionResponse, len(versions))
+	for i, v := range versions {
+		out[i] = instanceTemplateVersionResponse{
+			InstanceTemplateVersion: v,
+			Spec:                    decryptTemplateSpec(database.ParseInstanceTemplateSpec(v.Spec)),
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// instanceTemplateRequest is the body for create and update. Spec carries
+// plaintext env var values; on update a nil Spec keeps the current version
+// and a changed one adds a version. TeamID is only read on create.
+type instanceTemplateRequest struct {
+	Name        *string                        `json:"name"`
+	Description *string                        `json:"description"`
+	TeamID      uint                           `json:"team_id"`
+	Spec        *database.InstanceTemplateSpec `json:"spec"`
+}
+
+// validateTemplateSpec checks spec and returns it with encrypted env vars.
+func validateTemplateSpec(r *http.Request, spec database.InstanceTemplateSpec) (database.InstanceTemplateSpec, string) {
+	if err := ValidateResourceQuantities(ResourceQuantities{
+		CPURequest:      spec.CPURequest,
+		CPULimit:        spec.CPULimit,
+		MemoryRequest:   spec.MemoryRequest,
+		MemoryLimit:     spec.MemoryLimit,
+		StorageHome:     spec.StorageHome,
+		StorageHomebrew: spec.StorageHomebrew,
+	}); err != nil {
+		return spec, err.Error()
+	}
+	for name := range spec.EnvVars {
+		if err := ValidateEnvVarName(name); err != nil {
+			return spec, err.Error()
+		}
+	}
+
+	spec.PlacementTarget = strings.TrimSpace(spec.PlacementTarget)
+	if spec.PlacementTarget == database.DefaultPlacementTarget {
+		spec.PlacementTarget = ""
+	}
+	if spec.PlacementTarget != "" {
+		if _, err := database.GetOrchestratorTargetByName(spec.PlacementTarget); err != nil {
+			return spec, fmt.Sprintf("Unknown placement target '%s'", spec.PlacementTarget)
+		}
+	}
+	if len(spec.EnabledProviders) > 0 {
+		var n int64
+		database.DB.Model(&database.LLMProvider{}).Where("id IN ?", spec.EnabledProviders).Count(&n)
+		if int(n) != len(spec.EnabledProviders) {
+			return spec, "enabled_providers contains an unknown provider"
+		}
+	}
+	for _, slug := range spec.Skills {
+		var n int64
+		database.DB.Model(&database.Skill{}).Where("slug = ?", slug).Count(&n)
+		if n == 0 {
+			return spec, fmt.Sprintf("Unknown skill '%s'", slug)
+		}
+	}
+	user := middleware.GetUser(r)
+	for _, id := range spec.SharedFolderIDs {
+		sf, err := database.GetSharedFolder(id)
+		if err != nil {
+			return spec, fmt.Sprintf("Unknown shared folder %d", id)
+		}
+		if !canAttachSharedFolder(user, sf) {
+			return spec, fmt.Sprintf("Not allowed to attach shared folder %d", id)
+		}
+	}
+
+	if len(spec.EnvVars) > 0 {
+		encoded, err := encodeEncryptedEnvVars(spec.EnvVars)
+		if err != nil {
+			return spec, "Failed to encrypt env vars"
+		}
+		spec.EnvVars = decodeEncryptedEnvVarsJSON(encoded)
+	}
+	return spec, ""
+}
+
+// CreateInstanceTemplate handles POST /api/v1/instance-templates. A team_id
+// of 0 creates a global template (admin only).
+func CreateInstanceTemplate(w http.ResponseWriter, r *http.Request) {
+	var body instanceTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	t := database.InstanceTemplate{TeamID: body.TeamID}
+	if body.Name != nil {
+		t.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Description != nil {
+		t.Description = *body.Description
+	}
+	if t.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if t.TeamID != 0 {
+		if _, err := database.GetTeam(t.TeamID); err != nil {
+			writeError(w, http.StatusBadRequest, "Unknown team")
+			return
+		}
+	}
+	if !canManageTemplate(r, t) {
+		writeError(w, http.StatusForbidden, "Only admins can create global templates, and team managers their team's")
+		return
+	}
+	var spec database.InstanceTemplateSpec
+	if body.Spec != nil {
+		spec = *body.Spec
+	}
+	stored, msg := validateTemplateSpec(r, spec)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := database.CreateInstanceTemplate(&t, stored, getUsername(r)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create instance template")
+		return
+	}
+
+	resp := instanceTemplateResponse{InstanceTemplate: t, Spec: decryptTemplateSpec(stored)}
+	audit.SetAction(r, "instance_template.create")
+	audit.SetTarget(r, "instance_template", t.ID, t.Name)
+	audit.SetChange(r, nil, newInstanceTemplateAuditState(resp))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateInstanceTemplate handles PUT /api/v1/instance-templates/{id}. Name
+// and description change in place; a changed spec is stored as a new
+// version. Instances created from earlier versions are not changed.
+func UpdateInstanceTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadInstanceTemplate(w, r)
+	if !ok {
+		return
+	}
+	if !canManageTemplate(r, *t) {
+		writeError(w, http.StatusForbidden, "Not allowed to change this template")
+		return
+	}
+	var body instanceTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	before := instanceTemplateResponse{InstanceTemplate: *t, Spec: latestTemplateSpec(*t)}
+
+	updates := map[string]interface{}{}
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			writeError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		updates["name"] = name
+	}
+	if body.Description != nil {
+		updates["description"] = *body.Description
+	}
+	if body.Spec != nil {
+		stored, msg := validateTemplateSpec(r, *body.Spec)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		if audit.Diff(newTemplateSpecState(before.Spec), newTemplateSpecState(decryptTemplateSpec(stored))) != nil {
+			if err := database.AddInstanceTemplateVersion(t, stored, getUsername(r)); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to save template version")
+				return
+			}
+		}
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(t).Updates(updates).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update instance template")
+			return
+		}
+	}
+
+	updated, _ := database.GetInstanceTemplate(t.ID)
+	resp := instanceTemplateResponse{InstanceTemplate: *updated, Spec: latestTemplateSpec(*updated)}
+	audit.SetAction(r, "instance_template.update")
+	audit.SetTarget(r, "instance_template", t.ID, updated.Name)
+	audit.SetChange(r, newInstanceTemplateAuditState(before), newInstanceTemplateAuditState(resp))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteInstanceTemplate handles DELETE /api/v1/instance-templates/{id}.
+func DeleteInstanceTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadInstanceTemplate(w, r)
+	if !ok {
+		return
+	}
+	if !canManageTemplate(r, *t) {
+		writeError(w, http.StatusForbidden, "Not allowed to delete this template")
+		return
+	}
+	before := instanceTemplateResponse{InstanceTemplate: *t, Spec: latestTemplateSpec(*t)}
+	if err := database.DeleteInstanceTemplate(t.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete instance template")
+		return
+	}
+
+	audit.SetAction(r, "instance_template.delete")
+	audit.SetTarget(r, "instance_template", t.ID, t.Name)
+	audit.SetChange(r, newInstanceTemplateAuditState(before), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type instanceFromTemplateRequest struct {
+	DisplayName string `json:"display_name"`
+	TeamID      *uint  `json:"team_id"` // defaults to the template's team
+	Version     int    `json:"version"` // 0 = latest
+}
+
+// CreateInstanceFromTemplate handles POST /api/v1/instance-templates/{id}/instances.
+// It creates an instance the way CreateInstance does from the template
+// version's settings, attaches the version's shared folders and deploys its
+// skills once the instance is up.
+func CreateInstanceFromTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadInstanceTemplate(w, r)
+	if !ok {
+		return
+	}
+	var req instanceFromTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	teamID := t.TeamID
+	if req.TeamID != nil {
+		teamID = *req.TeamID
+	}
+	if t.TeamID != 0 && teamID != t.TeamID {
+		writeError(w, http.StatusBadRequest, "This template can only be used for its own team")
+		return
+	}
+	version := t.LatestVersion
+	if req.Version > 0 {
+		version = req.Version
+	}
+	v, err := database.GetInstanceTemplateVersion(t.ID, version)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Template version %d not found", version))
+		return
+	}
+	spec := decryptTemplateSpec(database.ParseInstanceTemplateSpec(v.Spec))
+	// The folders were checked against whoever saved the version; the
+	// caller needs the same access, or a global template would attach a
+	// team's instance to an admin's folders. Deleted folders are skipped
+	// by attachSharedFolders.
+	user := middleware.GetUser(r)
+	for _, id := range spec.SharedFolderIDs {
+		sf, err := database.GetSharedFolder(id)
+		if err == nil && !canAttachSharedFolder(user, sf) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("Not allowed to attach shared folder %d", id))
+			return
+		}
+	}
+
+	body := instanceCreateRequest{
+		DisplayName:      req.DisplayName,
+		CPURequest:       spec.CPURequest,
+		CPULimit:         spec.CPULimit,
+		MemoryRequest:    spec.MemoryRequest,
+		MemoryLimit:      spec.MemoryLimit,
+		StorageHomebrew:  spec.StorageHomebrew,
+		StorageHome:      spec.StorageHome,
+		EnabledProviders: spec.EnabledProviders,
+		EnvVarsSet:       spec.EnvVars,
+		TeamID:           &teamID,
+		PlacementTarget:  spec.PlacementTarget,
+		template:         t,
+		templateVersion:  v.Version,
+		sharedFolderIDs:  spec.SharedFolderIDs,
+		skills:           spec.Skills,
+	}
+	if spec.ContainerImage != "" {
+		body.ContainerImage = &spec.ContainerImage
+	}
+	if spec.Timezone != "" {
+		body.Timezone = &spec.Timezone
+	}
+	createInstance(w, r, body)
+}
+
+// canAttachSharedFolder reports whether user may attach instances to sf:
+// only the folder's owner or an admin may.
+func canAttachSharedFolder(user *database.User, sf *database.SharedFolder) bool {
+	return user != nil && (user.Role == "admin" || sf.OwnerID == user.ID)
+}
+
+// attachSharedFolders adds instanceID to each folder's instances. Folders
+// deleted since the template was saved are skipped.
+func attachSharedFolders(instanceID uint, folderIDs []uint) {
+	for _, id := range folderIDs {
+		sf, err := database.GetSharedFolder(id)
+		if err != nil {
+			log.Printf("Instance %d: shared folder %d not attached: %v", instanceID, id, err)
+			continue
+		}
+		ids := database.ParseSharedFolderInstanceIDs(sf.InstanceIDs)
+		attached := false
+		for _, existing := range ids {
+			attached = attached || existing == instanceID
+		}
+		if attached {
+			continue
+		}
+		ids = append(ids, instanceID)
+		if err := database.DB.Model(sf).Update("instance_ids", database.EncodeSharedFolderInstanceIDs(ids)).Error; err != nil {
+			log.Printf("Instance %d: failed to attach shared folder %d: %v", instanceID, id, err)
+		}
+	}
+}
+
+// deployTemplateSkills deploys the given library skills to a new instance,
+// one skill.deploy task each. Called from the create task once SSH is up.
+func deployTemplateSkills(inst database.Instance, slugs []string, userID uint) {
+	for _, slug := range slugs {
+		fileMap, err := buildSkillFileMap(context.Background(), slug, "library", "")
+		if err != nil {
+			log.Printf("Instance %s: skill %s not deployed: %v", utils.SanitizeForLog(inst.Name), utils.SanitizeForLog(slug), err)
+			continue
+		}
+		if TaskMgr != nil {
+			startSkillDeployTask(userID, inst.ID, slug, fileMap)
+			continue
+		}
+		if res := deployToInstance(inst.ID, slug, fileMap); res.Status != "ok" {
+			log.Printf("Instance %s: skill %s not deployed: %s", utils.SanitizeForLog(inst.Name), utils.SanitizeForLog(slug), res.Error)
+		}
+	}
+}
+
+type instanceTemplateDiffResponse struct {
+	TemplateID    uint          `json:"template_id"`
+	TemplateName  string        `json:"template_name"`
+	Version       int           `json:"version"`
+	LatestVersion int           `json:"latest_version"`
+	UpToDate      bool          `json:"up_to_date"`
+	Changes       audit.Changes `json:"changes"`
+}
+
+// GetInstanceTemplateDiff handles GET /api/v1/instances/{id}/template-diff:
+// what changed in the instance's template between the version it was
+// created from and the latest one. Env var values are redacted.
+func GetInstanceTemplateDiff(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return
+	}
+	if !middleware.CanAccessInstance(r, uint(id)) {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	var inst database.Instance
+	if err := database.DB.First(&inst, id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Instance not found")
+		return
+	}
+	if inst.TemplateID == nil {
+		writeError(w, http.StatusNotFound, "Instance was not created from a template")
+		return
+	}
+	t, err := database.GetInstanceTemplate(*inst.TemplateID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Template has been deleted")
+		return
+	}
+	from, err := database.GetInstanceTemplateVersion(t.ID, inst.TemplateVersion)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Template version %d not found", inst.TemplateVersion))
+		return
+	}
+
+	changes := audit.Diff(
+		newTemplateSpecState(decryptTemplateSpec(database.ParseInstanceTemplateSpec(from.Spec))),
+		newTemplateSpecState(latestTemplateSpec(*t)),
+	)
+	writeJSON(w, http.StatusOK, instanceTemplateDiffResponse{
+		TemplateID:    t.ID,
+		TemplateName:  t.Name,
+		Version:       inst.TemplateVersion,
+		LatestVersion: t.LatestVersion,
+		UpToDate:      inst.TemplateVersion == t.LatestVersion,
+		Changes:       changes,
+	})
+}
+
+func loadInstanceTemplate(w http.ResponseWriter, r *http.Request) (*database.InstanceTemplate, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid template ID")
+		return nil, false
+	}
+	// Team templates of other teams are hidden rather than forbidden.
+	t, err := database.GetInstanceTemplate(uint(id))
+	if err != nil || (t.TeamID != 0 && !canManageTemplate(r, *t)) {
+		writeError(w, http.StatusNotFound, "Instance template not found")
+		return nil, false
+	}
+	return t, true
+}
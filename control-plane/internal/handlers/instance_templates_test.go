@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+)
+
+func setupInstanceTemplatesTest(t *testing.T) *database.User {
+	t.Helper()
+	setupTestDB(t)
+	if err := database.DB.AutoMigrate(&database.Team{}, &database.TeamMember{}, &database.SharedFolder{},
+		&database.LLMProvider{}, &database.Skill{}, &database.OrchestratorTarget{},
+		&database.InstanceTemplate{}, &database.InstanceTemplateVersion{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	return createTestUser(t, "admin")
+}
+
+func templateRequest(user *database.User, method, path string, params map[string]string, body interface{}) *http.Request {
+	r := notificationRequest(method, path, params, body)
+	return withChiAndUser(r, user, params)
+}
+
+func TestInstanceTemplate_VersionsOnlyOnSpecChange(t *testing.T) {
+	admin := setupInstanceTemplatesTest(t)
+
+	w := httptest.NewRecorder()
+	CreateInstanceTemplate(w, templateRequest(admin, "POST", "/api/v1/instance-templates", nil, map[string]any{
+		"name": "research",
+		"spec": map[string]any{"cpu_request": "500m", "env_vars": map[string]string{"API_KEY": "s3cret"}},
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var created instanceTemplateResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.LatestVersion != 1 || created.Spec.EnvVars["API_KEY"] != "s3cret" {
+		t.Fatalf("created = %+v, want version 1 with decrypted env var", created)
+	}
+	v1, _ := database.GetInstanceTemplateVersion(created.ID, 1)
+	if strings.Contains(v1.Spec, "s3cret") {
+		t.Fatal("stored spec contains the plaintext env var")
+	}
+
+	id := fmt.Sprint(created.ID)
+	params := map[string]string{"id": id}
+	update := func(body map[string]any) instanceTemplateResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		UpdateInstanceTemplate(w, templateRequest(admin, "PUT", "/api/v1/instance-templates/"+id, params, body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("update status = %d, body: %s", w.Code, w.Body.String())
+		}
+		var resp instanceTemplateResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	same := update(map[string]any{
+		"spec": map[string]any{"cpu_request": "500m", "env_vars": map[string]string{"API_KEY": "s3cret"}},
+	})
+	if same.LatestVersion != 1 {
+		t.Errorf("identical spec: latest_version = %d, want 1", same.LatestVersion)
+	}
+	renamed := update(map[string]any{"name": "research bots"})
+	if renamed.LatestVersion != 1 || renamed.Name != "research bots" {
+		t.Errorf("rename = %+v, want name changed and version 1", renamed)
+	}
+	changed := update(map[string]any{
+		"spec": map[string]any{"cpu_request": "1", "env_vars": map[string]string{"API_KEY": "s3cret"}},
+	})
+	if changed.LatestVersion != 2 || changed.Spec.CPURequest != "1" {
+		t.Errorf("changed spec = %+v, want version 2 with cpu_request 1", changed)
+	}
+
+	w = httptest.NewRecorder()
+	UpdateInstanceTemplate(w, templateRequest(admin, "PUT", "/api/v1/instance-templates/"+id, params, map[string]any{
+		"spec": map[string]any{"memory_limit": "lots"},
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid spec status = %d, want 400", w.Code)
+	}
+
+	versions, _ := database.ListInstanceTemplateVersions(created.ID)
+	if len(versions) != 2 || versions[0].Version != 2 || versions[0].CreatedBy != admin.Username {
+		t.Errorf("versions = %+v, want 2 newest first by %s", versions, admin.Username)
+	}
+}
+
+func TestInstanceTemplate_TeamScope(t *testing.T) {
+	setupInstanceTemplatesTest(t)
+	ops := database.Team{Name: "ops"}
+	dev := database.Team{Name: "dev"}
+	database.DB.Create(&ops)
+	database.DB.Create(&dev)
+	manager := &database.User{Username: "ops-manager", PasswordHash: "unused", Role: "user"}
+	other := &database.User{Username: "dev-manager", PasswordHash: "unused", Role: "user"}
+	database.DB.Create(manager)
+	database.DB.Create(other)
+	database.DB.Create(&database.TeamMember{TeamID: ops.ID, UserID: manager.ID, Role: database.TeamRoleManager})
+	database.DB.Create(&database.TeamMember{TeamID: dev.ID, UserID: other.ID, Role: database.TeamRoleManager})
+
+	w := httptest.NewRecorder()
+	CreateInstanceTemplate(w, templateRequest(manager, "POST", "/api/v1/instance-templates", nil, map[string]any{"name": "global"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("global create by team manager status = %d, want 403", w.Code)
+	}
+	w = httptest.NewRecorder()
+	CreateInstanceTemplate(w, templateRequest(manager, "POST", "/api/v1/instance-templates", nil, map[string]any{"name": "ops", "team_id": ops.ID}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("team create status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var created instanceTemplateResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = httptest.NewRecorder()
+	ListInstanceTemplates(w, templateRequest(other, "GET", "/api/v1/instance-templates", nil, nil))
+	if strings.Contains(w.Body.String(), `"name":"ops"`) {
+		t.Errorf("other team's manager sees the template: %s", w.Body.String())
+	}
+	id := fmt.Sprint(created.ID)
+	w = httptest.NewRecorder()
+	GetInstanceTemplate(w, templateRequest(other, "GET", "/api/v1/instance-templates/"+id, map[string]string{"id": id}, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("other team's manager get status = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	ListInstanceTemplates(w, templateRequest(manager, "GET", "/api/v1/instance-templates", nil, nil))
+	if !strings.Contains(w.Body.String(), `"name":"ops"`) {
+		t.Errorf("team manager does not see the template: %s", w.Body.String())
+	}
+}
+
+func TestCreateInstanceFromTemplate_ChecksCallerFolderAccess(t *testing.T) {
+	admin := setupInstanceTemplatesTest(t)
+	team := database.Team{Name: "ops"}
+	database.DB.Create(&team)
+	manager := &database.User{Username: "ops-manager", PasswordHash: "unused", Role: "user"}
+	database.DB.Create(manager)
+	database.DB.Create(&database.TeamMember{TeamID: team.ID, UserID: manager.ID, Role: database.TeamRoleManager})
+	folder := database.SharedFolder{Name: "admin-docs", MountPath: "/shared/admin", OwnerID: admin.ID}
+	database.DB.Create(&folder)
+
+	w := httptest.NewRecorder()
+	CreateInstanceTemplate(w, templateRequest(admin, "POST", "/api/v1/instance-templates", nil, map[string]any{
+		"name": "global", "spec": map[string]any{"shared_folder_ids": []uint{folder.ID}},
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create template status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var tmpl instanceTemplateResponse
+	json.Unmarshal(w.Body.Bytes(), &tmpl)
+	id := fmt.Sprint(tmpl.ID)
+
+	w = httptest.NewRecorder()
+	CreateInstanceFromTemplate(w, templateRequest(manager, "POST", "/api/v1/instance-templates/"+id+"/instances", map[string]string{"id": id}, map[string]any{
+		"display_name": "Ops bot", "team_id": team.ID,
+	}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("team manager status = %d, want 403 (%s)", w.Code, w.Body.String())
+	}
+	var n int64
+	database.DB.Model(&database.Instance{}).Where("display_name = ?", "Ops bot").Count(&n)
+	stored, _ := database.GetSharedFolder(folder.ID)
+	if ids := database.ParseSharedFolderInstanceIDs(stored.InstanceIDs); n != 0 || len(ids) != 0 {
+		t.Errorf("instances = %d, folder instances = %v; want nothing created or attached", n, ids)
+	}
+}
+
+func TestCreateInstanceFromTemplate_RecordsVersionAndDiffs(t *testing.T) {
+	admin := setupInstanceTemplatesTest(t)
+	tm := withTaskMgr(t)
+	database.DB.Create(&database.Team{Name: "default"})
+	team := database.Team{Name: "ops"}
+	database.DB.Create(&team)
+	folder := database.SharedFolder{Name: "docs", MountPath: "/shared/docs", OwnerID: admin.ID}
+	database.DB.Create(&folder)
+
+	w := httptest.NewRecorder()
+	CreateInstanceTemplate(w, templateRequest(admin, "POST", "/api/v1/instance-templates", nil, map[string]any{
+		"name": "ops", "team_id": team.ID,
+		"spec": map[string]any{
+			"cpu_request": "500m", "timezone": "Europe/Berlin",
+			"env_vars":          map[string]string{"API_KEY": "s3cret"},
+			"shared_folder_ids": []uint{folder.ID},
+		},
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create template status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var tmpl instanceTemplateResponse
+	json.Unmarshal(w.Body.Bytes(), &tmpl)
+	id := fmt.Sprint(tmpl.ID)
+	params := map[string]string{"id": id}
+
+	w = httptest.NewRecorder()
+	CreateInstanceFromTemplate(w, templateRequest(admin, "POST", "/api/v1/instance-templates/"+id+"/instances", params, map[string]any{
+		"display_name": "Ops bot", "team_id": 1,
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("other team status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	CreateInstanceFromTemplate(w, templateRequest(admin, "POST", "/api/v1/instance-templates/"+id+"/instances", params, map[string]any{
+		"display_name": "Ops bot",
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create from template status = %d, body: %s", w.Code, w.Body.String())
+	}
+	// No orchestrator is set, so the create task fails fast; wait for it
+	// before the test database goes away.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tm.List(taskmanager.Filter{Type: taskmanager.TaskInstanceCreate, OnlyActive: true})) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("create task did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var inst database.Instance
+	database.DB.Where("display_name = ?", "Ops bot").First(&inst)
+	if inst.TemplateID == nil || *inst.TemplateID != tmpl.ID || inst.TemplateVersion != 1 {
+		t.Errorf("instance template = %v/%d, want %d/1", inst.TemplateID, inst.TemplateVersion, tmpl.ID)
+	}
+	if inst.TeamID != team.ID || inst.CPURequest != "500m" || inst.Timezone != "Europe/Berlin" {
+		t.Errorf("instance = team %d cpu %q tz %q, want template settings", inst.TeamID, inst.CPURequest, inst.Timezone)
+	}
+	if got := LoadInstanceEnvVars(inst)["API_KEY"]; got != "s3cret" {
+		t.Errorf("instance API_KEY = %q, want s3cret", got)
+	}
+	stored, _ := database.GetSharedFolder(folder.ID)
+	if ids := database.ParseSharedFolderInstanceIDs(stored.InstanceIDs); len(ids) != 1 || ids[0] != inst.ID {
+		t.Errorf("shared folder instances = %v, want [%d]", ids, inst.ID)
+	}
+
+	w = httptest.NewRecorder()
+	UpdateInstanceTemplate(w, templateRequest(admin, "PUT", "/api/v1/instance-templates/"+id, params, map[string]any{
+		"spec": map[string]any{
+			"cpu_request": "1", "timezone": "Europe/Berlin",
+			"env_vars":          map[string]string{"API_KEY": "rotated"},
+			"shared_folder_ids": []uint{folder.ID},
+		},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update template status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	instID := fmt.Sprint(inst.ID)
+	w = httptest.NewRecorder()
+	GetInstanceTemplateDiff(w, templateRequest(admin, "GET", "/api/v1/instances/"+instID+"/template-diff", map[string]string{"id": instID}, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "s3cret") || strings.Contains(w.Body.String(), "rotated") {
+		t.Errorf("diff leaks env var values: %s", w.Body.String())
+	}
+	var diff instanceTemplateDiffResponse
+	json.Unmarshal(w.Body.Bytes(), &diff)
+	if diff.Version != 1 || diff.LatestVersion != 2 || diff.UpToDate {
+		t.Errorf("diff = %+v, want version 1 of 2", diff)
+	}
+	_, cpu := diff.Changes["cpu_request"]
+	_, env := diff.Changes["env_vars"]
+	if len(diff.Changes) != 2 || !cpu || !env {
+		t.Errorf("diff changes = %v, want cpu_request and env_vars", diff.Changes)
+	}
+}
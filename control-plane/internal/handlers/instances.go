@@ -15,11 +15,13 @@ import (
 	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/sshgateway"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
 	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
@@ -123,6 +125,12 @@ type instanceCreateRequest struct {
 	BrowserIdleMinutes *int              `json:"browser_idle_minutes"`
 	BrowserStorage     *string           `json:"browser_storage"`
 	TeamID             *uint             `json:"team_id"`
+	// PlacementTarget names the OrchestratorTarget (cluster or Docker host)
+	// to run on; empty or "default" means the default backend.
+	PlacementTarget string `json:"placement_target"`
+	// HibernateAfterHours overrides the team's auto-hibernation policy:
+	// nil or negative uses the team's, 0 never hibernates.
+	HibernateAfterHours *int `json:"hibernate_after_hours"`
 	// Pod placement overrides (admin only). nil means "use the configured
 	// global default" (resolvePlacementDefaults); an explicit value, including
 	// an empty map/slice, overrides it for this instance from creation.
@@ -134,6 +142,14 @@ type instanceCreateRequest struct {
 	// semantics as the placement fields above.
 	ServiceAccountAnnotations *map[string]string       `json:"service_account_annotations"`
 	Ports                     *[]orchestrator.PortSpec `json:"ports"`
+
+	// Set by CreateInstanceFromTemplate, never decoded from the body: the
+	// template version the instance is created from, and the shared folders
+	// to attach and library skills to deploy once it is up.
+	template        *database.InstanceTemplate
+	templateVersion int
+	sharedFolderIDs []uint
+	skills          []string
 }
 
 type modelsResponse struct {
@@ -171,6 +187,8 @@ type instanceResponse struct {
 	LiveImageInfo             *string                   `json:"live_image_info,omitempty"`
 	StatusMessage             string                    `json:"status_message,omitempty"`
 	AllowedSourceIPs          string                    `json:"allowed_source_ips"`
+	ForwardPorts              string                    `json:"forward_ports"`
+	PlacementTarget           string                    `json:"placement_target"`
 	EnabledProviders          []uint                    `json:"enabled_providers"`
 	InstanceProviders         []providerResp            `json:"instance_providers"`
 	ControlURL                string                    `json:"control_url"`
@@ -191,6 +209,10 @@ type instanceResponse struct {
 	Affinity                  string                    `json:"affinity"`
 	ServiceAccountAnnotations map[string]string         `json:"service_account_annotations"`
 	Ports                     []orchestrator.PortSpec   `json:"ports"`
+	HibernateAfterHours       *int                      `json:"hibernate_after_hours"`
+	LastActivityAt            string                    `json:"last_activity_at,omitempty"`
+	TemplateID                *uint                     `json:"template_id,omitempty"`
+	TemplateVersion           int                       `json:"template_version,omitempty"`
 }
 
 func generateName(displayName string) string {
@@ -259,6 +281,7 @@ func computeEffectiveModels(mc modelsConfig) []string {
 }
 
 // GatewayProvider holds the virtual auth key, API type, and models for a gateway provider.
+// APIType is the type OpenClaw speaks: the provider's client_api_type when set.
 type GatewayProvider struct {
 	Key        string
 	APIType    string
@@ -360,9 +383,13 @@ func resolveGatewayProviders(inst database.Instance) map[string]GatewayProvider
 		if !ok {
 			continue
 		}
+		apiType := p.APIType
+		if p.ClientAPIType != "" {
+			apiType = p.ClientAPIType
+		}
 		result[p.Key] = GatewayProvider{
 			Key:        gk,
-			APIType:    p.APIType,
+			APIType:    apiType,
 			Models:     database.ParseProviderModels(p.Models),
 			CatalogKey: p.Provider,
 		}
@@ -511,6 +538,10 @@ func instanceToResponse(inst database.Instance, status string) instanceResponse
 	if ports == nil {
 		ports = []orchestrator.PortSpec{}
 	}
+	var lastActivityAt string
+	if inst.LastActivityAt != nil {
+		lastActivityAt = formatTimestamp(*inst.LastActivityAt)
+	}
 
 	return instanceResponse{
 		ID:                        inst.ID,
@@ -538,6 +569,8 @@ func instanceToResponse(inst database.Instance, status string) instanceResponse
 		EnvVars:                   envVarsPlain,
 		HasEnvOverride:            len(envVarsPlain) > 0,
 		AllowedSourceIPs:          inst.AllowedSourceIPs,
+		ForwardPorts:              inst.ForwardPorts,
+		PlacementTarget:           inst.PlacementTarget,
 		EnabledProviders:          enabledProviders,
 		InstanceProviders:         instProviderResps,
 		ControlURL:                fmt.Sprintf("/openclaw/%d/", inst.ID),
@@ -558,10 +591,18 @@ func instanceToResponse(inst database.Instance, status string) instanceResponse
 		Affinity:                  inst.Affinity,
 		ServiceAccountAnnotations: serviceAccountAnnotations,
 		Ports:                     ports,
+		HibernateAfterHours:       inst.HibernateAfterHours,
+		LastActivityAt:            lastActivityAt,
+		TemplateID:                inst.TemplateID,
+		TemplateVersion:           inst.TemplateVersion,
 	}
 }
 
 func resolveStatus(inst *database.Instance, orchStatus string) string {
+	if inst.Status == StatusHibernated && orchStatus == "stopped" {
+		return StatusHibernated
+	}
+
 	if inst.Status == "stopping" {
 		if orchStatus == "stopped" {
 			database.DB.Model(inst).Updates(map[string]interface{}{
@@ -669,6 +710,7 @@ func restartInstanceAsyncWithToast(inst database.Instance, userID uint, title, m
 	// Stop SSH tunnels; they will be recreated by the background manager
 	if SSHMgr != nil {
 		SSHMgr.CancelReconnection(inst.ID)
+		SSHMgr.ClearHostKey(inst.ID)
 	}
 	if TunnelMgr != nil {
 		if err := TunnelMgr.StopTunnelsForInstance(inst.ID); err != nil {
@@ -878,13 +920,40 @@ func ListInstances(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, responses)
 }
 
+// instanceAuditState is the audited view of an instance: the model plus the
+// fields it hides from JSON. audit.Diff redacts the secret ones.
+type instanceAuditState struct {
+	database.Instance
+	BraveAPIKey      string `json:"brave_api_key"`
+	EnvVars          string `json:"env_vars"`
+	DefaultModel     string `json:"default_model"`
+	EnabledProviders string `json:"enabled_providers"`
+	ModelsConfig     string `json:"models_config"`
+}
+
+func newInstanceAuditState(inst database.Instance) instanceAuditState {
+	return instanceAuditState{
+		Instance:         inst,
+		BraveAPIKey:      inst.BraveAPIKey,
+		EnvVars:          inst.EnvVars,
+		DefaultModel:     inst.DefaultModel,
+		EnabledProviders: inst.EnabledProviders,
+		ModelsConfig:     inst.ModelsConfig,
+	}
+}
+
 func CreateInstance(w http.ResponseWriter, r *http.Request) {
 	var body instanceCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	createInstance(w, r, body)
+}
 
+// createInstance validates body, stores the instance and starts creating its
+// container as a task, then writes the response.
+func createInstance(w http.ResponseWriter, r *http.Request, body instanceCreateRequest) {
 	if body.DisplayName == "" {
 		writeError(w, http.StatusBadRequest, "display_name is required")
 		return
@@ -942,6 +1011,22 @@ func CreateInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	placementTarget := strings.TrimSpace(body.PlacementTarget)
+	if placementTarget == database.DefaultPlacementTarget {
+		placementTarget = ""
+	}
+	if placementTarget != "" {
+		if _, err := database.GetOrchestratorTargetByName(placementTarget); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown placement target '%s'", placementTarget))
+			return
+		}
+	}
+
+	var hibernateAfterHours *int
+	if body.HibernateAfterHours != nil && *body.HibernateAfterHours >= 0 {
+		hibernateAfterHours = body.HibernateAfterHours
+	}
+
 	name := generateName(body.DisplayName)
 
 	// Check uniqueness
@@ -1099,18 +1184,29 @@ func CreateInstance(w http.ResponseWriter, r *http.Request) {
 		BrowserIdleMinutes:        browserIdleMinutes,
 		BrowserStorage:            browserStorage,
 		TeamID:                    teamID,
+		PlacementTarget:           placementTarget,
 		PodAnnotations:            podAnnotations,
 		NodeSelector:              nodeSelector,
 		Tolerations:               tolerations,
 		Affinity:                  affinity,
 		ServiceAccountAnnotations: serviceAccountAnnotations,
 		Ports:                     ports,
+		HibernateAfterHours:       hibernateAfterHours,
+	}
+	if body.template != nil {
+		inst.TemplateID = &body.template.ID
+		inst.TemplateVersion = body.templateVersion
 	}
 
 	if err := database.DB.Create(&inst).Error; err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create instance")
 		return
 	}
+	// Attach before the container is created so its first start mounts them.
+	attachSharedFolders(inst.ID, body.sharedFolderIDs)
+	audit.SetAction(r, "instance.create")
+	audit.SetTarget(r, "instance", inst.ID, inst.DisplayName)
+	audit.SetChange(r, nil, newInstanceAuditState(inst))
 
 	// Auto-assign the new instance to the creator if they are a non-admin user.
 	// Admins implicitly access all instances and don't need a UserInstance row.
@@ -1150,7 +1246,8 @@ func CreateInstance(w http.ResponseWriter, r *http.Request) {
 	initialProvidersJSON, _ := buildOpenClawProvidersJSON(models, gatewayProviders, config.Cfg.LLMGatewayPort)
 
 	// Launch container creation asynchronously (image pull can take minutes)
-	startInstanceTask(taskmanager.TaskInstanceCreate, inst.ID, callerID(r), inst.DisplayName,
+	userID := callerID(r)
+	startInstanceTask(taskmanager.TaskInstanceCreate, inst.ID, userID, inst.DisplayName,
 		fmt.Sprintf("Creating instance %s", inst.DisplayName),
 		func(ctx context.Context) {
 			orch := orchestrator.Get()
@@ -1205,6 +1302,7 @@ func CreateInstance(w http.ResponseWriter, r *http.Request) {
 				Affinity:                  inst.Affinity,
 				ServiceAccountAnnotations: placement.ServiceAccountAnnotations,
 				Ports:                     placement.Ports,
+				SharedFolderMounts:        getSharedFolderMounts(inst.ID),
 				OnProgress:                func(msg string) { setStatusMessage(inst.ID, msg) },
 			})
 			if err != nil {
@@ -1228,6 +1326,7 @@ func CreateInstance(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			ConfigureInstance(ctx, orch, sshproxy.NewSSHInstance(sshClient), inst.Name, models, gatewayProviders, config.Cfg.LLMGatewayPort)
+			deployTemplateSkills(inst, body.skills, userID)
 		})
 
 	var totalInstances int64
@@ -1297,6 +1396,7 @@ type instanceUpdateRequest struct {
 	Timezone                  *string                    `json:"timezone"`
 	UserAgent                 *string                    `json:"user_agent"`
 	AllowedSourceIPs          *string                    `json:"allowed_source_ips"` // admin only: comma-separated IPs/CIDRs
+	ForwardPorts              *string                    `json:"forward_ports"`      // admin only: SSH gateway -L ports/ranges
 	EnabledProviders          *[]uint                    `json:"enabled_providers"`  // admin only: LLM gateway provider IDs
 	DisplayName               *string                    `json:"display_name"`       // admin only
 	CPURequest                *string                    `json:"cpu_request"`        // admin only
@@ -1317,6 +1417,7 @@ type instanceUpdateRequest struct {
 	Affinity                  *string                    `json:"affinity"`                    // admin only; raw JSON
 	ServiceAccountAnnotations *map[string]string         `json:"service_account_annotations"` // admin only
 	Ports                     *[]orchestrator.PortSpec   `json:"ports"`                       // admin only
+	HibernateAfterHours       *int                       `json:"hibernate_after_hours"`       // admins and team managers; negative = team's policy
 }
 
 func UpdateInstance(w http.ResponseWriter, r *http.Request) {
@@ -1337,6 +1438,16 @@ func UpdateInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.SetAction(r, "instance.update")
+	audit.SetTarget(r, "instance", inst.ID, inst.DisplayName)
+	before := newInstanceAuditState(inst)
+	defer func() {
+		var after database.Instance
+		if database.DB.First(&after, inst.ID).Error == nil {
+			audit.SetChange(r, before, newInstanceAuditState(after))
+		}
+	}()
+
 	var body instanceUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -1412,6 +1523,20 @@ func UpdateInstance(w http.ResponseWriter, r *http.Request) {
 		database.DB.Model(&inst).Update("browser_idle_minutes", body.BrowserIdleMinutes)
 	}
 
+	// Auto-hibernation override. JSON null cannot be told apart from an
+	// absent field, so a negative value clears it back to the team's policy.
+	if body.HibernateAfterHours != nil {
+		if !middleware.CanMutateInstance(r, inst.ID) {
+			writeError(w, http.StatusForbidden, "Only admins or team managers can change hibernation")
+			return
+		}
+		if *body.HibernateAfterHours < 0 {
+			database.DB.Model(&inst).Update("hibernate_after_hours", nil)
+		} else {
+			database.DB.Model(&inst).Update("hibernate_after_hours", *body.HibernateAfterHours)
+		}
+	}
+
 	// Update allowed source IPs (admin only)
 	if body.AllowedSourceIPs != nil {
 		user := middleware.GetUser(r)
@@ -1429,6 +1554,27 @@ func UpdateInstance(w http.ResponseWriter, r *http.Request) {
 		database.DB.Model(&inst).Update("allowed_source_ips", *body.AllowedSourceIPs)
 	}
 
+	// Update SSH gateway port-forward allowlist (admin only)
+	if body.ForwardPorts != nil {
+		user := middleware.GetUser(r)
+		if user == nil || user.Role != "admin" {
+			writeError(w, http.StatusForbidden, "Only admins can configure port forwarding")
+			return
+		}
+		if _, err := sshgateway.ParsePortAllowlist(*body.ForwardPorts); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid forward ports: %v", err))
+			return
+		}
+		database.DB.Model(&inst).Update("forward_ports", strings.TrimSpace(*body.ForwardPorts))
+		if SSHMgr != nil {
+			go func(id uint) {
+				if err := SSHMgr.RefreshPermitOpen(id); err != nil {
+					log.Printf("Failed to update sshd PermitOpen for instance %d: %v", id, err)
+				}
+			}(inst.ID)
+		}
+	}
+
 	// Update models config
 	if body.Models != nil {
 		if body.Models.Disabled == nil {
@@ -1868,6 +2014,9 @@ func DeleteInstance(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "Instance not found")
 		return
 	}
+	audit.SetAction(r, "instance.delete")
+	audit.SetTarget(r, "instance", inst.ID, inst.DisplayName)
+	audit.SetChange(r, newInstanceAuditState(inst), nil)
 
 	// Stop SSH tunnels and close connection before deleting
 	if SSHMgr != nil {
@@ -1902,8 +2051,10 @@ func DeleteInstance(w http.ResponseWriter, r *http.Request) {
 	// Delete instance-specific providers (API key is on the provider row)
 	database.DB.Where("instance_id = ?", inst.ID).Delete(&database.LLMProvider{})
 
-	// Delete associated gateway keys
+	// Delete associated gateway keys and fallback chains
 	database.DB.Where("instance_id = ?", inst.ID).Delete(&database.LLMGatewayKey{})
+	database.DB.Where("instance_id = ?", inst.ID).Delete(&database.LLMFallbackChain{})
+	database.DB.Where("instance_id = ?", inst.ID).Delete(&database.InstanceHostKey{})
 	database.DB.Delete(&inst)
 	var remaining int64
 	database.DB.Model(&database.Instance{}).Count(&remaining)
@@ -2214,19 +2365,25 @@ func CloneInstance(w http.ResponseWriter, r *http.Request) {
 		BrowserStorage:     src.BrowserStorage,
 		BrowserActive:      src.BrowserActive,
 		// Carry over placement/service config so the clone schedules and is
-		// reachable the same way the original is.
+		// reachable the same way the original is. Volumes are cloned within
+		// one backend, so the clone stays on the source's placement target.
+		PlacementTarget:           src.PlacementTarget,
 		PodAnnotations:            src.PodAnnotations,
 		NodeSelector:              src.NodeSelector,
 		Tolerations:               src.Tolerations,
 		Affinity:                  src.Affinity,
 		ServiceAccountAnnotations: src.ServiceAccountAnnotations,
 		Ports:                     src.Ports,
+		HibernateAfterHours:       src.HibernateAfterHours,
 	}
 
 	if err := database.DB.Create(&inst).Error; err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create cloned instance")
 		return
 	}
+	audit.SetAction(r, "instance.clone")
+	audit.SetTarget(r, "instance", inst.ID, inst.DisplayName)
+	audit.SetChange(r, map[string]uint{"cloned_from": src.ID}, newInstanceAuditState(inst))
 	// GORM's `default:true` on BrowserActive overrides the explicit `false`
 	// passed in via Create (false is the Go zero value, so the column is
 	// omitted from the INSERT and the DB-level default kicks in). Patch it
@@ -2388,6 +2545,7 @@ func cloneOnCancel(instanceID uint, cloneName string) taskmanager.OnCancel {
 		// teardown in DeleteInstance so a canceled clone leaves no rows behind.
 		database.DB.Where("instance_id = ?", instanceID).Delete(&database.LLMProvider{})
 		database.DB.Where("instance_id = ?", instanceID).Delete(&database.LLMGatewayKey{})
+		database.DB.Where("instance_id = ?", instanceID).Delete(&database.LLMFallbackChain{})
 		// Detach the cancelled clone from any shared folders it inherited so
 		// no dangling reference is left behind after the row is deleted.
 		if folders, ferr := database.GetSharedFoldersForInstance(instanceID); ferr == nil {
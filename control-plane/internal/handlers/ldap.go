@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+)
+
+// runLDAPSync reconciles LDAP users with the directory and signs out the
+// users it disabled.
+func runLDAPSync() (*auth.SyncResult, error) {
+	entries, err := auth.LDAP.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	res, err := auth.SyncExternalUsers(auth.AuthSourceLDAP, entries, auth.LDAP.AllowedGroups, auth.LDAP.ProvisionOpts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	if SessionStore != nil {
+		for _, id := range res.DisabledIDs {
+			SessionStore.DeleteByUserID(id)
+		}
+	}
+	return res, nil
+}
+
+// StartLDAPSyncJob starts a background goroutine that syncs LDAP users with
+// the directory every CLAWORC_LDAP_SYNC_INTERVAL. It does nothing when LDAP
+// is off or the interval is 0. It returns a cancel function to stop the job.
+func StartLDAPSyncJob(ctx context.Context) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	if auth.LDAP == nil || auth.LDAP.SyncInterval <= 0 {
+		return cancel
+	}
+
+	go func() {
+		ticker := time.NewTicker(auth.LDAP.SyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				res, err := runLDAPSync()
+				if err != nil {
+					log.Printf("LDAP sync job: %v", err)
+					continue
+				}
+				if len(res.DisabledIDs) > 0 || res.Reenabled > 0 {
+					log.Printf("LDAP sync job: checked %d users, disabled %d, re-enabled %d",
+						res.Checked, len(res.DisabledIDs), res.Reenabled)
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// SyncLDAP handles POST /api/v1/ldap/sync: an admin-triggered directory
+// sync, returning what changed.
+func SyncLDAP(w http.ResponseWriter, r *http.Request) {
+	if auth.LDAP == nil {
+		writeError(w, http.StatusNotFound, "LDAP is not configured")
+		return
+	}
+	res, err := runLDAPSync()
+	if err != nil {
+		log.Printf("LDAP sync: %v", err)
+		writeError(w, http.StatusBadGateway, "Directory sync failed: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
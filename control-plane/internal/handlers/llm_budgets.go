@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// defaultBudgetWarnPercent is applied when a budget is saved without an
+// explicit warn_percent.
+const defaultBudgetWarnPercent = 80
+
+type budgetRequest struct {
+	DailyLimitUSD   float64 `json:"daily_limit_usd"`
+	MonthlyLimitUSD float64 `json:"monthly_limit_usd"`
+	TotalLimitUSD   float64 `json:"total_limit_usd"`
+	WarnPercent     *int    `json:"warn_percent"`
+}
+
+// budgetScopeParams parses and validates the {scope}/{scopeId} URL params.
+func budgetScopeParams(w http.ResponseWriter, r *http.Request) (string, uint, bool) {
+	scope := chi.URLParam(r, "scope")
+	if !database.IsValidBudgetScope(scope) {
+		writeError(w, http.StatusBadRequest, "scope must be one of instance, team, provider")
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "scopeId"), 10, 32)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, "Invalid scope ID")
+		return "", 0, false
+	}
+	return scope, uint(id), true
+}
+
+// budgetScopeExists reports whether the instance, team or provider a budget
+// targets is present in the main DB.
+func budgetScopeExists(scope string, id uint) bool {
+	var count int64
+	switch scope {
+	case database.BudgetScopeInstance:
+		database.DB.Model(&database.Instance{}).Where("id = ?", id).Count(&count)
+	case database.BudgetScopeTeam:
+		database.DB.Model(&database.Team{}).Where("id = ?", id).Count(&count)
+	case database.BudgetScopeProvider:
+		database.DB.Model(&database.LLMProvider{}).Where("id = ?", id).Count(&count)
+	}
+	return count > 0
+}
+
+// ListLLMBudgets returns every configured budget with its current spend.
+func ListLLMBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := database.ListLLMBudgets()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list budgets")
+		return
+	}
+	out := make([]llmgateway.BudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		st, err := llmgateway.GetBudgetStatus(b)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to compute budget spend")
+			return
+		}
+		out = append(out, st)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GetLLMBudget returns a single budget with its current spend.
+func GetLLMBudget(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := budgetScopeParams(w, r)
+	if !ok {
+		return
+	}
+	b, err := database.GetLLMBudget(scope, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Budget not found")
+		return
+	}
+	st, err := llmgateway.GetBudgetStatus(*b)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to compute budget spend")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// SetLLMBudget creates or replaces the caps for a scope. Limits of 0 leave
+// that window uncapped.
+func SetLLMBudget(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := budgetScopeParams(w, r)
+	if !ok {
+		return
+	}
+	var body budgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.DailyLimitUSD < 0 || body.MonthlyLimitUSD < 0 || body.TotalLimitUSD < 0 {
+		writeError(w, http.StatusBadRequest, "limits must not be negative")
+		return
+	}
+	warn := defaultBudgetWarnPercent
+	if body.WarnPercent != nil {
+		warn = *body.WarnPercent
+	}
+	if warn < 0 || warn > 100 {
+		writeError(w, http.StatusBadRequest, "warn_percent must be between 0 and 100")
+		return
+	}
+	if !budgetScopeExists(scope, id) {
+		writeError(w, http.StatusNotFound, scope+" not found")
+		return
+	}
+
+	b := database.LLMBudget{
+		Scope:           scope,
+		ScopeID:         id,
+		DailyLimitUSD:   body.DailyLimitUSD,
+		MonthlyLimitUSD: body.MonthlyLimitUSD,
+		TotalLimitUSD:   body.TotalLimitUSD,
+		WarnPercent:     warn,
+	}
+	if err := database.UpsertLLMBudget(&b); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save budget")
+		return
+	}
+	st, err := llmgateway.GetBudgetStatus(b)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to compute budget spend")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// ResetLLMBudget zeroes accumulated spend for a budget by moving its reset
+// point to now. Caps are kept.
+func ResetLLMBudget(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := budgetScopeParams(w, r)
+	if !ok {
+		return
+	}
+	if err := database.ResetLLMBudget(scope, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Budget not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to reset budget")
+		return
+	}
+	b, err := database.GetLLMBudget(scope, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load budget")
+		return
+	}
+	st, err := llmgateway.GetBudgetStatus(*b)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to compute budget spend")
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// DeleteLLMBudget removes all caps for a scope.
+func DeleteLLMBudget(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := budgetScopeParams(w, r)
+	if !ok {
+		return
+	}
+	if err := database.DeleteLLMBudget(scope, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Budget not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete budget")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
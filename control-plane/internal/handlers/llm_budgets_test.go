@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupBudgetTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.Team{}, &database.LLMProvider{}, &database.LLMBudget{}, &database.LLMRequestLog{})
+	prevLogs := database.LogsDB
+	database.LogsDB = database.DB
+	t.Cleanup(func() { database.LogsDB = prevLogs })
+}
+
+func budgetRequestFor(t *testing.T, method, scope, id string, body interface{}) *http.Request {
+	t.Helper()
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, "/api/v1/llm/budgets/"+scope+"/"+id, bytes.NewReader(b))
+	} else {
+		r = httptest.NewRequest(method, "/api/v1/llm/budgets/"+scope+"/"+id, nil)
+	}
+	return withChiAndUser(r, nil, map[string]string{"scope": scope, "scopeId": id})
+}
+
+func TestSetLLMBudget_CreateAndUpdate(t *testing.T) {
+	setupBudgetTest(t)
+	inst := createTestInstance(t, "bot-a", "A")
+	id := fmt.Sprint(inst.ID)
+
+	w := httptest.NewRecorder()
+	SetLLMBudget(w, budgetRequestFor(t, "PUT", "instance", id, map[string]any{"daily_limit_usd": 5}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body: %s", w.Code, w.Body.String())
+	}
+	b, err := database.GetLLMBudget("instance", inst.ID)
+	if err != nil {
+		t.Fatalf("budget not saved: %v", err)
+	}
+	if b.DailyLimitUSD != 5 || b.WarnPercent != defaultBudgetWarnPercent {
+		t.Errorf("budget = %+v, want daily 5, warn %d", b, defaultBudgetWarnPercent)
+	}
+
+	w = httptest.NewRecorder()
+	SetLLMBudget(w, budgetRequestFor(t, "PUT", "instance", id, map[string]any{"monthly_limit_usd": 20, "warn_percent": 0}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", w.Code, w.Body.String())
+	}
+	b, _ = database.GetLLMBudget("instance", inst.ID)
+	if b.DailyLimitUSD != 0 || b.MonthlyLimitUSD != 20 || b.WarnPercent != 0 {
+		t.Errorf("after update = %+v, want daily 0, monthly 20, warn 0", b)
+	}
+	var count int64
+	database.DB.Model(&database.LLMBudget{}).Count(&count)
+	if count != 1 {
+		t.Errorf("budget rows = %d, want 1", count)
+	}
+}
+
+func TestSetLLMBudget_Validation(t *testing.T) {
+	setupBudgetTest(t)
+	inst := createTestInstance(t, "bot-a", "A")
+
+	tests := []struct {
+		name  string
+		scope string
+		id    string
+		body  map[string]any
+		want  int
+	}{
+		{"bad scope", "user", fmt.Sprint(inst.ID), map[string]any{}, http.StatusBadRequest},
+		{"bad id", "instance", "abc", map[string]any{}, http.StatusBadRequest},
+		{"negative", "instance", fmt.Sprint(inst.ID), map[string]any{"daily_limit_usd": -1}, http.StatusBadRequest},
+		{"warn too high", "instance", fmt.Sprint(inst.ID), map[string]any{"warn_percent": 101}, http.StatusBadRequest},
+		{"missing target", "team", "42", map[string]any{"daily_limit_usd": 1}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			SetLLMBudget(w, budgetRequestFor(t, "PUT", tt.scope, tt.id, tt.body))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResetAndDeleteLLMBudget(t *testing.T) {
+	setupBudgetTest(t)
+	inst := createTestInstance(t, "bot-a", "A")
+	id := fmt.Sprint(inst.ID)
+	database.LogsDB.Create(&database.LLMRequestLog{InstanceID: inst.ID, CostUSD: 3, StatusCode: 200, RequestedAt: time.Now().Add(-time.Minute)})
+	if err := database.UpsertLLMBudget(&database.LLMBudget{Scope: "instance", ScopeID: inst.ID, TotalLimitUSD: 2, WarnPercent: 80}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	GetLLMBudget(w, budgetRequestFor(t, "GET", "instance", id, nil))
+	body := parseResponse(t, w)
+	if body["exceeded"] != true {
+		t.Fatalf("expected exceeded before reset, got %v", body)
+	}
+
+	w = httptest.NewRecorder()
+	ResetLLMBudget(w, budgetRequestFor(t, "POST", "instance", id, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset status = %d, body: %s", w.Code, w.Body.String())
+	}
+	body = parseResponse(t, w)
+	if body["exceeded"] != false {
+		t.Errorf("expected not exceeded after reset, got %v", body)
+	}
+
+	w = httptest.NewRecorder()
+	DeleteLLMBudget(w, budgetRequestFor(t, "DELETE", "instance", id, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	DeleteLLMBudget(w, budgetRequestFor(t, "DELETE", "instance", id, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type capturePolicyRequest struct {
+	Enabled        bool     `json:"enabled"`
+	RedactPII      *bool    `json:"redact_pii"`
+	RedactPatterns []string `json:"redact_patterns"`
+	RetentionDays  int      `json:"retention_days"`
+}
+
+type capturePolicyResponse struct {
+	InstanceID     uint     `json:"instance_id"`
+	Enabled        bool     `json:"enabled"`
+	RedactPII      bool     `json:"redact_pii"`
+	RedactPatterns []string `json:"redact_patterns"`
+	RetentionDays  int      `json:"retention_days"`
+	UpdatedAt      string   `json:"updated_at,omitempty"`
+}
+
+func toCapturePolicyResponse(p database.LLMCapturePolicy) capturePolicyResponse {
+	resp := capturePolicyResponse{
+		InstanceID:     p.InstanceID,
+		Enabled:        p.Enabled,
+		RedactPII:      p.RedactPII,
+		RedactPatterns: database.ParseRedactPatterns(p.RedactPatterns),
+		RetentionDays:  p.RetentionDays,
+	}
+	if !p.UpdatedAt.IsZero() {
+		resp.UpdatedAt = formatTimestamp(p.UpdatedAt)
+	}
+	return resp
+}
+
+// captureInstanceParam parses {id} and checks the instance exists.
+func captureInstanceParam(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return 0, false
+	}
+	var count int64
+	database.DB.Model(&database.Instance{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		writeError(w, http.StatusNotFound, "Instance not found")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetInstanceCapturePolicy returns an instance's capture policy. Instances
+// without one report capture disabled.
+func GetInstanceCapturePolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := captureInstanceParam(w, r)
+	if !ok {
+		return
+	}
+	p, err := database.GetLLMCapturePolicy(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeJSON(w, http.StatusOK, toCapturePolicyResponse(database.LLMCapturePolicy{InstanceID: id, RedactPII: true, RedactPatterns: "[]"}))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load capture policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, toCapturePolicyResponse(*p))
+}
+
+// SetInstanceCapturePolicy creates or replaces an instance's capture policy.
+// PII redaction defaults to on when redact_pii is omitted.
+func SetInstanceCapturePolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := captureInstanceParam(w, r)
+	if !ok {
+		return
+	}
+	var body capturePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.RetentionDays < 0 {
+		writeError(w, http.StatusBadRequest, "retention_days must be >= 0")
+		return
+	}
+	if err := llmgateway.ValidateRedactPatterns(body.RedactPatterns); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	redactPII := true
+	if body.RedactPII != nil {
+		redactPII = *body.RedactPII
+	}
+	if body.RedactPatterns == nil {
+		body.RedactPatterns = []string{}
+	}
+	patterns, _ := json.Marshal(body.RedactPatterns)
+
+	p := database.LLMCapturePolicy{
+		InstanceID:     id,
+		Enabled:        body.Enabled,
+		RedactPII:      redactPII,
+		RedactPatterns: string(patterns),
+		RetentionDays:  body.RetentionDays,
+	}
+	if err := database.UpsertLLMCapturePolicy(&p); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save capture policy")
+		return
+	}
+	writeJSON(w, http.StatusOK, toCapturePolicyResponse(p))
+}
+
+// DeleteInstanceCapturePolicy disables capture for an instance. Stored
+// captures are kept until retention removes them.
+func DeleteInstanceCapturePolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return
+	}
+	if err := database.DeleteLLMCapturePolicy(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Capture policy not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete capture policy")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SearchLLMCaptures lists captured exchanges, newest first, without bodies.
+// Filters: instance_id, provider_id, model, status, q (substring of either
+// body), since/until (RFC 3339), limit (default 50, max 500), offset.
+func SearchLLMCaptures(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := database.LLMCaptureFilter{Model: q.Get("model"), Query: q.Get("q"), Limit: 50}
+	for name, dst := range map[string]*uint{"instance_id": &f.InstanceID, "provider_id": &f.ProviderID} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = uint(n)
+		}
+	}
+	for name, dst := range map[string]*int{"status": &f.StatusCode, "limit": &f.Limit, "offset": &f.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = n
+		}
+	}
+	if f.Limit == 0 {
+		f.Limit = 50
+	}
+	if f.Limit > 500 {
+		f.Limit = 500
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid "+name+": expected RFC 3339")
+				return
+			}
+			*dst = t.UTC()
+		}
+	}
+
+	captures, total, err := database.SearchLLMCaptures(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to search captures")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"captures": captures,
+		"total":    total,
+	})
+}
+
+// capturedExchange is a capture with its request headers decoded.
+type capturedExchange struct {
+	database.LLMCapture
+	RequestHeaders map[string]string `json:"request_headers"`
+}
+
+// loadCapture parses {captureId} and loads the capture.
+func loadCapture(w http.ResponseWriter, r *http.Request) (*database.LLMCapture, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "captureId"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid capture ID")
+		return nil, false
+	}
+	c, err := database.GetLLMCapture(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Capture not found")
+		return nil, false
+	}
+	return c, true
+}
+
+// GetLLMCapture returns one captured exchange with both bodies.
+func GetLLMCapture(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadCapture(w, r)
+	if !ok {
+		return
+	}
+	out := capturedExchange{LLMCapture: *c, RequestHeaders: map[string]string{}}
+	json.Unmarshal([]byte(c.RequestHeaders), &out.RequestHeaders)
+	writeJSON(w, http.StatusOK, out)
+}
+
+// ReplayLLMCapture sends a captured request through the gateway again and
+// returns the new response. The replay is a regular gateway request and is
+// logged (and captured) like one.
+func ReplayLLMCapture(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadCapture(w, r)
+	if !ok {
+		return
+	}
+	res, err := llmgateway.ReplayCapture(r.Context(), c)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
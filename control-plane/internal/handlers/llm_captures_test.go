@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupCaptureTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.LLMCapturePolicy{}, &database.LLMCapture{})
+	prevLogs := database.LogsDB
+	database.LogsDB = database.DB
+	t.Cleanup(func() { database.LogsDB = prevLogs })
+}
+
+func capturePolicyRequestFor(t *testing.T, method, id string, body interface{}) *http.Request {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	r := httptest.NewRequest(method, "/api/v1/instances/"+id+"/llm-capture", bytes.NewReader(b))
+	return withChiAndUser(r, nil, map[string]string{"id": id})
+}
+
+func TestSetInstanceCapturePolicy(t *testing.T) {
+	setupCaptureTest(t)
+	inst := createTestInstance(t, "bot-a", "A")
+	id := fmt.Sprint(inst.ID)
+
+	w := httptest.NewRecorder()
+	GetInstanceCapturePolicy(w, capturePolicyRequestFor(t, "GET", id, nil))
+	var got capturePolicyResponse
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.Enabled || !got.RedactPII {
+		t.Errorf("default policy = %d %+v", w.Code, got)
+	}
+
+	w = httptest.NewRecorder()
+	SetInstanceCapturePolicy(w, capturePolicyRequestFor(t, "PUT", id, map[string]any{"enabled": true, "redact_patterns": []string{`acct-\d+`}, "retention_days": 7}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	p, err := database.GetLLMCapturePolicy(inst.ID)
+	if err != nil || !p.Enabled || !p.RedactPII || p.RetentionDays != 7 || p.RedactPatterns != `["acct-\\d+"]` {
+		t.Errorf("policy = %+v, err %v", p, err)
+	}
+
+	w = httptest.NewRecorder()
+	SetInstanceCapturePolicy(w, capturePolicyRequestFor(t, "PUT", id, map[string]any{"enabled": true, "redact_pii": false}))
+	p, _ = database.GetLLMCapturePolicy(inst.ID)
+	if w.Code != http.StatusOK || p.RedactPII || p.RedactPatterns != "[]" {
+		t.Errorf("explicit redact_pii=false: %d %+v", w.Code, p)
+	}
+
+	w = httptest.NewRecorder()
+	SetInstanceCapturePolicy(w, capturePolicyRequestFor(t, "PUT", id, map[string]any{"redact_patterns": []string{"("}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid regex: status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	SetInstanceCapturePolicy(w, capturePolicyRequestFor(t, "PUT", "999", map[string]any{"enabled": true}))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing instance: status = %d", w.Code)
+	}
+}
+
+func TestSearchLLMCaptures(t *testing.T) {
+	setupCaptureTest(t)
+	now := time.Now().UTC()
+	for _, c := range []database.LLMCapture{
+		{InstanceID: 1, Method: "POST", Path: "/chat/completions", ModelID: "a", StatusCode: 200, RequestBody: `{"q":"refund 50%"}`, RequestedAt: now},
+		{InstanceID: 1, Method: "POST", Path: "/chat/completions", ModelID: "b", StatusCode: 429, RequestBody: `{"q":"refund 50 dollars"}`, RequestedAt: now},
+		{InstanceID: 2, Method: "POST", Path: "/v1/messages", ModelID: "a", StatusCode: 200, ResponseBody: `refund 50%`, RequestedAt: now},
+	} {
+		database.LogsDB.Create(&c)
+	}
+
+	search := func(query string) (int, []database.LLMCapture, int64) {
+		w := httptest.NewRecorder()
+		SearchLLMCaptures(w, httptest.NewRequest("GET", "/api/v1/llm/captures?"+query, nil))
+		var out struct {
+			Captures []database.LLMCapture `json:"captures"`
+			Total    int64                 `json:"total"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out.Captures, out.Total
+	}
+
+	if code, list, total := search("q=50%25"); code != 200 || total != 2 || len(list) != 2 || list[0].ID != 3 {
+		t.Errorf("q=50%%: %d %d %+v", code, total, list)
+	}
+	if _, list, total := search("instance_id=1&status=429"); total != 1 || list[0].ModelID != "b" {
+		t.Errorf("filter: %d %+v", total, list)
+	}
+	if _, list, total := search("limit=1"); total != 3 || len(list) != 1 || list[0].RequestBody != "" {
+		t.Errorf("limit: %d %+v", total, list)
+	}
+	if code, _, _ := search("since=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("bad since: status = %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	GetLLMCapture(w, withChiAndUser(httptest.NewRequest("GET", "/api/v1/llm/captures/2", nil), nil, map[string]string{"captureId": "2"}))
+	var ex capturedExchange
+	json.Unmarshal(w.Body.Bytes(), &ex)
+	if w.Code != http.StatusOK || ex.RequestBody != `{"q":"refund 50 dollars"}` {
+		t.Errorf("get capture: %d %+v", w.Code, ex)
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// maxFallbackHops caps the length of a fallback chain so a misconfigured
+// chain cannot multiply a single request into many upstream calls.
+const maxFallbackHops = 5
+
+type fallbackChainResponse struct {
+	InstanceID uint                   `json:"instance_id"`
+	ProviderID uint                   `json:"provider_id"`
+	Hops       []database.FallbackHop `json:"hops"`
+	UpdatedAt  string                 `json:"updated_at"`
+}
+
+func toFallbackChainResponse(c database.LLMFallbackChain) fallbackChainResponse {
+	return fallbackChainResponse{
+		InstanceID: c.InstanceID,
+		ProviderID: c.ProviderID,
+		Hops:       database.ParseFallbackHops(c.Hops),
+		UpdatedAt:  formatTimestamp(c.UpdatedAt),
+	}
+}
+
+// fallbackChainParams parses {id} and {providerId}.
+func fallbackChainParams(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	instID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return 0, 0, false
+	}
+	provID, err := strconv.Atoi(chi.URLParam(r, "providerId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid provider ID")
+		return 0, 0, false
+	}
+	return uint(instID), uint(provID), true
+}
+
+// usableProvider loads a provider and checks that instanceID may route
+// through it: global providers and the instance's own are allowed.
+func usableProvider(instanceID, providerID uint) (*database.LLMProvider, error) {
+	var p database.LLMProvider
+	if err := database.DB.First(&p, providerID).Error; err != nil {
+		return nil, fmt.Errorf("provider %d not found", providerID)
+	}
+	if p.InstanceID != nil && *p.InstanceID != instanceID {
+		return nil, fmt.Errorf("provider %d belongs to another instance", providerID)
+	}
+	return &p, nil
+}
+
+// ListInstanceFallbackChains returns every fallback chain for an instance.
+func ListInstanceFallbackChains(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return
+	}
+	if !middleware.CanAccessInstance(r, uint(id)) {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	chains, err := database.ListLLMFallbackChains(uint(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list fallback chains")
+		return
+	}
+	result := make([]fallbackChainResponse, len(chains))
+	for i, c := range chains {
+		result[i] = toFallbackChainResponse(c)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// SetInstanceFallbackChain replaces the ordered hops tried when the given
+// primary provider fails for the instance.
+func SetInstanceFallbackChain(w http.ResponseWriter, r *http.Request) {
+	instID, provID, ok := fallbackChainParams(w, r)
+	if !ok {
+		return
+	}
+	if !middleware.CanMutateInstance(r, instID) {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	var inst database.Instance
+	if err := database.DB.First(&inst, instID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Instance not found")
+		return
+	}
+	var body struct {
+		Hops []database.FallbackHop `json:"hops"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(body.Hops) == 0 {
+		writeError(w, http.StatusBadRequest, "hops must not be empty; use DELETE to remove the chain")
+		return
+	}
+	if len(body.Hops) > maxFallbackHops {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d fallback hops are allowed", maxFallbackHops))
+		return
+	}
+	if _, err := usableProvider(instID, provID); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, h := range body.Hops {
+		if h.ProviderID == provID && h.Model == "" {
+			writeError(w, http.StatusBadRequest, "a hop on the primary provider must name a different model")
+			return
+		}
+		if _, err := usableProvider(instID, h.ProviderID); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	chain, err := database.SetLLMFallbackChain(instID, provID, body.Hops)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save fallback chain")
+		return
+	}
+	writeJSON(w, http.StatusOK, toFallbackChainResponse(*chain))
+}
+
+// DeleteInstanceFallbackChain removes the chain for a primary provider.
+func DeleteInstanceFallbackChain(w http.ResponseWriter, r *http.Request) {
+	instID, provID, ok := fallbackChainParams(w, r)
+	if !ok {
+		return
+	}
+	if !middleware.CanMutateInstance(r, instID) {
+		writeError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+	if err := database.DeleteLLMFallbackChain(instID, provID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Fallback chain not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete fallback chain")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
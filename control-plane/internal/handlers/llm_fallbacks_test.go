@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func fallbackRequest(t *testing.T, method string, user *database.User, instID, provID uint, body interface{}) *http.Request {
+	t.Helper()
+	url := fmt.Sprintf("/api/v1/instances/%d/llm-fallbacks/%d", instID, provID)
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, url, bytes.NewReader(b))
+	} else {
+		r = httptest.NewRequest(method, url, nil)
+	}
+	return withChiAndUser(r, user, map[string]string{"id": fmt.Sprint(instID), "providerId": fmt.Sprint(provID)})
+}
+
+func TestSetInstanceFallbackChain(t *testing.T) {
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.LLMProvider{}, &database.LLMFallbackChain{})
+	admin := createTestUser(t, "admin")
+	inst := createTestInstance(t, "bot-a", "A")
+	other := createTestInstance(t, "bot-b", "B")
+
+	primary := database.LLMProvider{Key: "anthropic", Name: "Anthropic", BaseURL: "https://api.anthropic.com", APIType: "anthropic-messages"}
+	backup := database.LLMProvider{Key: "openai", Name: "OpenAI", BaseURL: "https://api.openai.com/v1"}
+	private := database.LLMProvider{Key: "mine", Name: "Mine", BaseURL: "http://x", InstanceID: &other.ID}
+	for _, p := range []*database.LLMProvider{&primary, &backup, &private} {
+		if err := database.DB.Create(p).Error; err != nil {
+			t.Fatalf("create provider: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	SetInstanceFallbackChain(w, fallbackRequest(t, "PUT", admin, inst.ID, primary.ID, map[string]any{
+		"hops": []map[string]any{{"provider_id": backup.ID, "model": "gpt-4o"}},
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	chain, err := database.GetLLMFallbackChain(inst.ID, primary.ID)
+	if err != nil {
+		t.Fatalf("chain not saved: %v", err)
+	}
+	hops := database.ParseFallbackHops(chain.Hops)
+	if len(hops) != 1 || hops[0].ProviderID != backup.ID || hops[0].Model != "gpt-4o" {
+		t.Errorf("hops = %+v", hops)
+	}
+
+	bad := []struct {
+		name string
+		hops []map[string]any
+	}{
+		{"empty", []map[string]any{}},
+		{"other instance's provider", []map[string]any{{"provider_id": private.ID}}},
+		{"missing provider", []map[string]any{{"provider_id": 999}}},
+		{"same provider same model", []map[string]any{{"provider_id": primary.ID}}},
+	}
+	for _, tc := range bad {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			SetInstanceFallbackChain(w, fallbackRequest(t, "PUT", admin, inst.ID, primary.ID, map[string]any{"hops": tc.hops}))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+
+	w = httptest.NewRecorder()
+	DeleteInstanceFallbackChain(w, fallbackRequest(t, "DELETE", admin, inst.ID, primary.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", w.Code)
+	}
+}
+
+func TestSetInstanceFallbackChain_Forbidden(t *testing.T) {
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.LLMProvider{}, &database.LLMFallbackChain{})
+	user := createTestUser(t, "user")
+	inst := createTestInstance(t, "bot-a", "A")
+
+	w := httptest.NewRecorder()
+	SetInstanceFallbackChain(w, fallbackRequest(t, "PUT", user, inst.ID, 1, map[string]any{"hops": []map[string]any{{"provider_id": 2}}}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// maxRateQueueTimeoutSeconds bounds how long a queued gateway request may
+// wait; past that the agent's own HTTP client is likely to give up anyway.
+const maxRateQueueTimeoutSeconds = 600
+
+type rateLimitRequest struct {
+	RequestsPerMinute   int    `json:"requests_per_minute"`
+	TokensPerMinute     int    `json:"tokens_per_minute"`
+	MaxConcurrent       int    `json:"max_concurrent"`
+	Mode                string `json:"mode"`
+	QueueTimeoutSeconds int    `json:"queue_timeout_seconds"`
+}
+
+// rateLimitScopeParams parses and validates the {scope}/{scopeId} URL params.
+func rateLimitScopeParams(w http.ResponseWriter, r *http.Request) (string, uint, bool) {
+	scope := chi.URLParam(r, "scope")
+	if !database.IsValidRateLimitScope(scope) {
+		writeError(w, http.StatusBadRequest, "scope must be one of key, instance, provider")
+		return "", 0, false
+	}
+	id, err := strconv.ParseUint(chi.URLParam(r, "scopeId"), 10, 32)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, "Invalid scope ID")
+		return "", 0, false
+	}
+	return scope, uint(id), true
+}
+
+// rateLimitScopeExists reports whether the virtual key, instance or
+// provider a rate limit targets is present in the main DB.
+func rateLimitScopeExists(scope string, id uint) bool {
+	var count int64
+	switch scope {
+	case database.RateLimitScopeKey:
+		database.DB.Model(&database.LLMGatewayKey{}).Where("id = ?", id).Count(&count)
+	case database.RateLimitScopeInstance:
+		database.DB.Model(&database.Instance{}).Where("id = ?", id).Count(&count)
+	case database.RateLimitScopeProvider:
+		database.DB.Model(&database.LLMProvider{}).Where("id = ?", id).Count(&count)
+	}
+	return count > 0
+}
+
+// listRateLimitStatuses returns every configured rate limit with its live
+// usage.
+func listRateLimitStatuses() ([]llmgateway.RateLimitStatus, error) {
+	limits, err := database.ListLLMRateLimits()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]llmgateway.RateLimitStatus, 0, len(limits))
+	for _, l := range limits {
+		out = append(out, llmgateway.GetRateLimitStatus(l))
+	}
+	return out, nil
+}
+
+// ListLLMRateLimits returns every configured rate limit with its live usage.
+func ListLLMRateLimits(w http.ResponseWriter, r *http.Request) {
+	out, err := listRateLimitStatuses()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list rate limits")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GetLLMRateLimit returns a single rate limit with its live usage.
+func GetLLMRateLimit(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := rateLimitScopeParams(w, r)
+	if !ok {
+		return
+	}
+	l, err := database.GetLLMRateLimit(scope, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Rate limit not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, llmgateway.GetRateLimitStatus(*l))
+}
+
+// SetLLMRateLimit creates or replaces the limits for a scope. Limits of 0
+// leave that dimension uncapped.
+func SetLLMRateLimit(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := rateLimitScopeParams(w, r)
+	if !ok {
+		return
+	}
+	var body rateLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.RequestsPerMinute < 0 || body.TokensPerMinute < 0 || body.MaxConcurrent < 0 {
+		writeError(w, http.StatusBadRequest, "limits must not be negative")
+		return
+	}
+	if body.Mode == "" {
+		body.Mode = database.RateLimitModeReject
+	}
+	if body.Mode != database.RateLimitModeReject && body.Mode != database.RateLimitModeQueue {
+		writeError(w, http.StatusBadRequest, "mode must be reject or queue")
+		return
+	}
+	if body.QueueTimeoutSeconds < 0 || body.QueueTimeoutSeconds > maxRateQueueTimeoutSeconds {
+		writeError(w, http.StatusBadRequest, "queue_timeout_seconds must be between 0 and 600")
+		return
+	}
+	if !rateLimitScopeExists(scope, id) {
+		writeError(w, http.StatusNotFound, scope+" not found")
+		return
+	}
+
+	l := database.LLMRateLimit{
+		Scope:               scope,
+		ScopeID:             id,
+		RequestsPerMinute:   body.RequestsPerMinute,
+		TokensPerMinute:     body.TokensPerMinute,
+		MaxConcurrent:       body.MaxConcurrent,
+		Mode:                body.Mode,
+		QueueTimeoutSeconds: body.QueueTimeoutSeconds,
+	}
+	if err := database.UpsertLLMRateLimit(&l); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save rate limit")
+		return
+	}
+	writeJSON(w, http.StatusOK, llmgateway.GetRateLimitStatus(l))
+}
+
+// DeleteLLMRateLimit removes all limits for a scope.
+func DeleteLLMRateLimit(w http.ResponseWriter, r *http.Request) {
+	scope, id, ok := rateLimitScopeParams(w, r)
+	if !ok {
+		return
+	}
+	if err := database.DeleteLLMRateLimit(scope, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Rate limit not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete rate limit")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
+)
+
+func setupRateLimitTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.LLMProvider{}, &database.LLMGatewayKey{}, &database.LLMRateLimit{})
+}
+
+func rateLimitRequestFor(t *testing.T, method, scope, id string, body interface{}) *http.Request {
+	t.Helper()
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, "/api/v1/llm/rate-limits/"+scope+"/"+id, bytes.NewReader(b))
+	} else {
+		r = httptest.NewRequest(method, "/api/v1/llm/rate-limits/"+scope+"/"+id, nil)
+	}
+	return withChiAndUser(r, nil, map[string]string{"scope": scope, "scopeId": id})
+}
+
+func TestSetLLMRateLimit_CreateAndUpdate(t *testing.T) {
+	setupRateLimitTest(t)
+	key := database.LLMGatewayKey{InstanceID: 1, ProviderID: 1, GatewayKey: "claworc-vk-x"}
+	database.DB.Create(&key)
+	id := fmt.Sprint(key.ID)
+
+	w := httptest.NewRecorder()
+	SetLLMRateLimit(w, rateLimitRequestFor(t, "PUT", "key", id, map[string]any{"requests_per_minute": 60, "max_concurrent": 2}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var st llmgateway.RateLimitStatus
+	json.Unmarshal(w.Body.Bytes(), &st)
+	if st.Limit.Mode != "reject" || st.RequestsRemaining != 60 {
+		t.Errorf("status = %+v", st)
+	}
+
+	w = httptest.NewRecorder()
+	SetLLMRateLimit(w, rateLimitRequestFor(t, "PUT", "key", id, map[string]any{"tokens_per_minute": 1000, "mode": "queue", "queue_timeout_seconds": 10}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", w.Code, w.Body.String())
+	}
+	l, _ := database.GetLLMRateLimit("key", key.ID)
+	if l.RequestsPerMinute != 0 || l.TokensPerMinute != 1000 || l.Mode != "queue" || l.QueueTimeoutSeconds != 10 {
+		t.Errorf("limit = %+v", l)
+	}
+
+	w = httptest.NewRecorder()
+	ListLLMRateLimits(w, httptest.NewRequest("GET", "/api/v1/llm/rate-limits", nil))
+	var list []llmgateway.RateLimitStatus
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].TokensRemaining != 1000 {
+		t.Errorf("list = %+v", list)
+	}
+
+	w = httptest.NewRecorder()
+	DeleteLLMRateLimit(w, rateLimitRequestFor(t, "DELETE", "key", id, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", w.Code)
+	}
+}
+
+func TestSetLLMRateLimit_Validation(t *testing.T) {
+	setupRateLimitTest(t)
+	p := database.LLMProvider{Key: "p", Name: "P"}
+	database.DB.Create(&p)
+	id := fmt.Sprint(p.ID)
+
+	cases := []struct {
+		name  string
+		scope string
+		id    string
+		body  map[string]any
+		want  int
+	}{
+		{"bad scope", "team", id, map[string]any{}, http.StatusBadRequest},
+		{"negative", "provider", id, map[string]any{"requests_per_minute": -1}, http.StatusBadRequest},
+		{"bad mode", "provider", id, map[string]any{"mode": "drop"}, http.StatusBadRequest},
+		{"timeout too long", "provider", id, map[string]any{"mode": "queue", "queue_timeout_seconds": 601}, http.StatusBadRequest},
+		{"missing provider", "provider", "999", map[string]any{"max_concurrent": 1}, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		SetLLMRateLimit(w, rateLimitRequestFor(t, "PUT", tc.scope, tc.id, tc.body))
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
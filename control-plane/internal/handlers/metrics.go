@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+)
+
+var metricSSHEvents = metrics.NewCounterVec("claworc_ssh_connection_events_total",
+	"SSH connection events (connected, disconnected, reconnecting, reconnected, reconnect_failed, key_uploaded) by instance.",
+	"instance_id", "type")
+
+// allConnectionStates is every state exported by claworc_ssh_connection_state,
+// so each instance always reports one 1 and the rest 0.
+var allConnectionStates = []sshproxy.ConnectionState{
+	sshproxy.StateDisconnected,
+	sshproxy.StateConnecting,
+	sshproxy.StateConnected,
+	sshproxy.StateReconnecting,
+	sshproxy.StateFailed,
+}
+
+// allTaskStates is every state exported by claworc_tasks.
+var allTaskStates = []taskmanager.State{
+	taskmanager.StateRunning,
+	taskmanager.StateSucceeded,
+	taskmanager.StateFailed,
+	taskmanager.StateCanceled,
+}
+
+// RegisterMetrics hooks SSH connection events into the metrics registry and
+// adds the scrape-time collector for SSH, tunnel, task, backup and
+// inventory metrics. Call once from main.go after SSHMgr and TaskMgr are set.
+func RegisterMetrics() {
+	if SSHMgr != nil {
+		SSHMgr.OnEvent(func(ev sshproxy.ConnectionEvent) {
+			metricSSHEvents.Inc(idLabel(ev.InstanceID), string(ev.Type))
+		})
+	}
+	metrics.RegisterCollector(collectMetrics)
+}
+
+func idLabel(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func collectMetrics() []metrics.Family {
+	var out []metrics.Family
+	out = append(out, collectSSHMetrics()...)
+	out = append(out, collectTunnelMetrics()...)
+	out = append(out, collectTaskMetrics()...)
+	out = append(out, collectDBMetrics()...)
+	return out
+}
+
+func collectSSHMetrics() []metrics.Family {
+	if SSHMgr == nil {
+		return nil
+	}
+	state := metrics.Family{Name: "claworc_ssh_connection_state", Type: metrics.TypeGauge,
+		Help: "1 for the current SSH connection state of each instance, 0 for the others."}
+	for id, cur := range SSHMgr.GetAllConnectionStates() {
+		for _, s := range allConnectionStates {
+			v := 0.0
+			if s == cur {
+				v = 1
+			}
+			state.Samples = append(state.Samples, metrics.Sample{Labels: []string{"instance_id", idLabel(id), "state", s.String()}, Value: v})
+		}
+	}
+
+	checks := metrics.Family{Name: "claworc_ssh_health_checks_total", Type: metrics.TypeCounter,
+		Help: "SSH health checks on the current connection by instance and result."}
+	uptime := metrics.Family{Name: "claworc_ssh_connection_uptime_seconds", Type: metrics.TypeGauge,
+		Help: "Seconds since the current SSH connection to each instance was established."}
+	// Index rather than range by value: ConnectionMetrics carries a mutex.
+	all := SSHMgr.GetAllMetrics()
+	for id := range all {
+		inst := idLabel(id)
+		checks.Samples = append(checks.Samples,
+			metrics.Sample{Labels: []string{"instance_id", inst, "result", "success"}, Value: float64(all[id].SuccessfulChecks)},
+			metrics.Sample{Labels: []string{"instance_id", inst, "result", "failure"}, Value: float64(all[id].FailedChecks)})
+		if connectedAt := all[id].ConnectedAt; !connectedAt.IsZero() {
+			uptime.Samples = append(uptime.Samples, metrics.Sample{Labels: []string{"instance_id", inst}, Value: time.Since(connectedAt).Seconds()})
+		}
+	}
+	return []metrics.Family{state, checks, uptime}
+}
+
+func collectTunnelMetrics() []metrics.Family {
+	if TunnelMgr == nil {
+		return nil
+	}
+	up := metrics.Family{Name: "claworc_tunnel_up", Type: metrics.TypeGauge,
+		Help: "1 when the tunnel is active, 0 otherwise, by instance and tunnel label."}
+	checks := metrics.Family{Name: "claworc_tunnel_health_checks_total", Type: metrics.TypeCounter,
+		Help: "Tunnel health checks by instance, tunnel label and result."}
+	bytes := metrics.Family{Name: "claworc_tunnel_bytes_total", Type: metrics.TypeCounter,
+		Help: "Bytes copied through tunnels by instance, tunnel label and direction (to_instance, from_instance)."}
+	reconnects := metrics.Family{Name: "claworc_tunnel_reconnects_total", Type: metrics.TypeCounter,
+		Help: "Tunnel reconnections by instance."}
+	for id, tunnels := range TunnelMgr.GetAllTunnelMetrics() {
+		inst := idLabel(id)
+		var reconn int64
+		for _, t := range tunnels {
+			v := 0.0
+			if t.Status == "active" {
+				v = 1
+			}
+			up.Samples = append(up.Samples, metrics.Sample{Labels: []string{"instance_id", inst, "label", t.Label}, Value: v})
+			checks.Samples = append(checks.Samples,
+				metrics.Sample{Labels: []string{"instance_id", inst, "label", t.Label, "result", "success"}, Value: float64(t.SuccessfulChecks)},
+				metrics.Sample{Labels: []string{"instance_id", inst, "label", t.Label, "result", "failure"}, Value: float64(t.FailedChecks)})
+			bytes.Samples = append(bytes.Samples,
+				metrics.Sample{Labels: []string{"instance_id", inst, "label", t.Label, "direction", "to_instance"}, Value: float64(t.BytesToInstance)},
+				metrics.Sample{Labels: []string{"instance_id", inst, "label", t.Label, "direction", "from_instance"}, Value: float64(t.BytesFromInstance)})
+			reconn = t.ReconnectionCount
+		}
+		reconnects.Samples = append(reconnects.Samples, metrics.Sample{Labels: []string{"instance_id", inst}, Value: float64(reconn)})
+	}
+	return []metrics.Family{up, checks, bytes, reconnects}
+}
+
+func collectTaskMetrics() []metrics.Family {
+	if TaskMgr == nil {
+		return nil
+	}
+	type key struct {
+		typ   taskmanager.TaskType
+		state taskmanager.State
+	}
+	counts := map[key]int{}
+	types := map[taskmanager.TaskType]bool{}
+	for _, t := range TaskMgr.List(taskmanager.Filter{}) {
+		counts[key{t.Type, t.State}]++
+		types[t.Type] = true
+	}
+	f := metrics.Family{Name: "claworc_tasks", Type: metrics.TypeGauge,
+		Help: "Tasks held by the task manager by type and state. Finished tasks are kept for a short retention window."}
+	for typ := range types {
+		for _, s := range allTaskStates {
+			f.Samples = append(f.Samples, metrics.Sample{Labels: []string{"type", string(typ), "state", string(s)}, Value: float64(counts[key{typ, s}])})
+		}
+	}
+	return []metrics.Family{f}
+}
+
+func collectDBMetrics() []metrics.Family {
+	if database.DB == nil {
+		return nil
+	}
+	var out []metrics.Family
+
+	var byStatus []struct {
+		Status string
+		N      int64
+	}
+	if err := database.DB.Model(&database.Backup{}).Select("status, COUNT(*) AS n").Group("status").Scan(&byStatus).Error; err != nil {
+		log.Printf("metrics: count backups: %v", err)
+	} else {
+		f := metrics.Family{Name: "claworc_backups", Type: metrics.TypeGauge, Help: "Backups by status."}
+		for _, b := range byStatus {
+			f.Samples = append(f.Samples, metrics.Sample{Labels: []string{"status", b.Status}, Value: float64(b.N)})
+		}
+		out = append(out, f)
+	}
+
+	var last []database.Backup
+	latest := database.DB.Model(&database.Backup{}).Select("MAX(id)").Where("status = ?", "completed").Group("instance_id")
+	if err := database.DB.Where("id IN (?)", latest).Find(&last).Error; err != nil {
+		log.Printf("metrics: latest backups: %v", err)
+	} else {
+		size := metrics.Family{Name: "claworc_backup_last_size_bytes", Type: metrics.TypeGauge,
+			Help: "Size of the most recent completed backup by instance."}
+		dur := metrics.Family{Name: "claworc_backup_last_duration_seconds", Type: metrics.TypeGauge,
+			Help: "Duration of the most recent completed backup by instance."}
+		ts := metrics.Family{Name: "claworc_backup_last_success_timestamp_seconds", Type: metrics.TypeGauge,
+			Help: "Unix time the most recent completed backup finished, by instance."}
+		for _, b := range last {
+			inst := []string{"instance_id", idLabel(b.InstanceID)}
+			size.Samples = append(size.Samples, metrics.Sample{Labels: inst, Value: float64(b.SizeBytes)})
+			if b.CompletedAt != nil {
+				dur.Samples = append(dur.Samples, metrics.Sample{Labels: inst, Value: b.CompletedAt.Sub(b.CreatedAt).Seconds()})
+				ts.Samples = append(ts.Samples, metrics.Sample{Labels: inst, Value: float64(b.CompletedAt.Unix())})
+			}
+		}
+		out = append(out, size, dur, ts)
+	}
+
+	var instances []database.Instance
+	if err := database.DB.Select("id", "name", "status").Find(&instances).Error; err != nil {
+		log.Printf("metrics: list instances: %v", err)
+	} else {
+		f := metrics.Family{Name: "claworc_instance_info", Type: metrics.TypeGauge,
+			Help: "Always 1; maps instance_id to the instance name and status for joins."}
+		for _, i := range instances {
+			f.Samples = append(f.Samples, metrics.Sample{Labels: []string{"instance_id", idLabel(i.ID), "name", i.Name, "status", i.Status}, Value: 1})
+		}
+		out = append(out, f)
+	}
+
+	var providers []database.LLMProvider
+	if err := database.DB.Find(&providers).Error; err != nil {
+		log.Printf("metrics: list providers: %v", err)
+	} else {
+		f := metrics.Family{Name: "claworc_llm_provider_info", Type: metrics.TypeGauge,
+			Help: "Always 1; maps provider_id to the provider key and name for joins."}
+		for _, p := range providers {
+			f.Samples = append(f.Samples, metrics.Sample{Labels: []string{"provider_id", idLabel(p.ID), "key", p.Key, "name", p.Name}, Value: 1})
+		}
+		out = append(out, f)
+	}
+	return out
+}
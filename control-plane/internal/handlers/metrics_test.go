@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+)
+
+func TestCollectMetrics(t *testing.T) {
+	setupTestDB(t)
+	if err := database.DB.AutoMigrate(&database.Backup{}, &database.LLMProvider{}); err != nil {
+		t.Fatalf("auto-migrate: %v", err)
+	}
+	inst := createTestInstance(t, "bot-metrics", "Metrics")
+	database.DB.Create(&database.LLMProvider{Key: "openai", Name: "OpenAI"})
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	older := start.Add(-time.Hour)
+	done := start.Add(90 * time.Second)
+	database.DB.Create(&database.Backup{InstanceID: inst.ID, Status: "completed", SizeBytes: 10, CreatedAt: older.Add(-time.Minute), CompletedAt: &older})
+	database.DB.Create(&database.Backup{InstanceID: inst.ID, Status: "completed", SizeBytes: 2048, CreatedAt: start, CompletedAt: &done})
+	database.DB.Create(&database.Backup{InstanceID: inst.ID, Status: "failed"})
+
+	SSHMgr = sshproxy.NewSSHManager(nil, "")
+	SSHMgr.SetConnectionState(inst.ID, sshproxy.StateConnected, "test")
+	TaskMgr = taskmanager.New(taskmanager.Config{})
+	release := make(chan struct{})
+	TaskMgr.Start(taskmanager.StartOpts{Type: taskmanager.TaskBackupCreate, Title: "backup", Run: func(ctx context.Context, h *taskmanager.Handle) error {
+		<-release
+		return nil
+	}})
+	defer func() {
+		close(release)
+		SSHMgr, TaskMgr = nil, nil
+	}()
+
+	r := metrics.NewRegistry()
+	r.RegisterCollector(collectMetrics)
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+
+	id := idLabel(inst.ID)
+	for _, want := range []string{
+		`claworc_ssh_connection_state{instance_id="` + id + `",state="connected"} 1`,
+		`claworc_ssh_connection_state{instance_id="` + id + `",state="failed"} 0`,
+		`claworc_tasks{type="backup.create",state="running"} 1`,
+		`claworc_tasks{type="backup.create",state="failed"} 0`,
+		`claworc_backups{status="completed"} 2`,
+		`claworc_backups{status="failed"} 1`,
+		`claworc_backup_last_size_bytes{instance_id="` + id + `"} 2048`,
+		`claworc_backup_last_duration_seconds{instance_id="` + id + `"} 90`,
+		`claworc_instance_info{instance_id="` + id + `",name="bot-metrics",status="running"} 1`,
+		`claworc_llm_provider_info{provider_id="1",key="openai",name="OpenAI"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
+	"github.com/gluk-w/claworc/control-plane/internal/backup"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+// migrationPaths are the volume contents copied to the destination backend:
+// the agent's home and the Homebrew prefix.
+var migrationPaths = backup.ResolvePaths([]string{"HOME", "Homebrew"})
+
+// migrationReadyTimeout bounds how long the destination workload may take to
+// report running, both after creation and after the post-copy restart.
+var migrationReadyTimeout = 10 * time.Minute
+
+// quiesceCommand stops the agent's writers in the source container, the
+// OpenClaw gateway and cron, so nothing changes under the copy; sshd stays
+// up for the tar exec. resumeCommand restarts them when a migration rolls
+// back. The services are s6-overlay longruns of the agent image.
+var (
+	quiesceCommand = []string{"sh", "-c",
+		"/command/s6-svc -wd -T 60000 -d /run/service/svc-openclaw && /command/s6-svc -wd -T 60000 -d /run/service/svc-cron"}
+	resumeCommand = []string{"sh", "-c",
+		"/command/s6-svc -u /run/service/svc-openclaw; /command/s6-svc -u /run/service/svc-cron"}
+)
+
+// instanceOps holds the IDs of instances with an exclusive operation in
+// flight, a migration, a scheduled power change or a hibernation, mapped to
+// its name. Each claims the instance here before it looks at it, so they
+// never interleave.
+var instanceOps sync.Map
+
+const (
+	opMigration   = "migration"
+	opPowerChange = "scheduled power change"
+	opHibernate   = "hibernation"
+)
+
+// claimInstance marks op as running on the instance. If another operation
+// holds it, claimInstance returns that operation's name and false.
+func claimInstance(id uint, op string) (string, bool) {
+	if holder, loaded := instanceOps.LoadOrStore(id, op); loaded {
+		return holder.(string), false
+	}
+	return op, true
+}
+
+// releaseInstance ends the operation claimed with claimInstance.
+func releaseInstance(id uint) {
+	instanceOps.Delete(id)
+}
+
+type migrateInstanceRequest struct {
+	Target string `json:"target"`
+}
+
+// MigrateInstance handles POST /api/v1/instances/{id}/migrate. It moves a
+// running instance to another placement target ("default" or "" for the
+// default backend) as a TaskInstanceMigrate task and returns the task ID.
+// The instance row is kept, so its name, UUID, gateway keys, webhooks and
+// backups stay the same; only placement_target changes once the copy is done.
+func MigrateInstance(w http.ResponseWriter, r *http.Request) {
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return
+	}
+	var body migrateInstanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	target := strings.TrimSpace(body.Target)
+	if target == database.DefaultPlacementTarget {
+		target = ""
+	}
+	if target == inst.PlacementTarget {
+		writeError(w, http.StatusBadRequest, "Instance is already on this placement target")
+		return
+	}
+	if target != "" {
+		if _, err := database.GetOrchestratorTargetByName(target); err != nil {
+			writeError(w, http.StatusBadRequest, "Unknown placement target")
+			return
+		}
+	}
+	if inst.Status != "running" {
+		writeError(w, http.StatusConflict, "Instance must be running to migrate")
+		return
+	}
+	src, err := orchestrator.ForTarget(inst.PlacementTarget)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	dst, err := orchestrator.ForTarget(target)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if holder, ok := claimInstance(inst.ID, opMigration); !ok {
+		writeError(w, http.StatusConflict, fmt.Sprintf("A %s is already running for this instance", holder))
+		return
+	}
+
+	audit.SetAction(r, "instance.migrate")
+	audit.SetTarget(r, "instance", inst.ID, inst.DisplayName)
+	audit.SetChange(r, map[string]string{"placement_target": inst.PlacementTarget}, map[string]string{"placement_target": target})
+
+	migrated := *inst
+	taskID := startInstanceTaskFull(taskmanager.TaskInstanceMigrate, inst.ID, callerID(r), inst.DisplayName,
+		"Migrating instance",
+		fmt.Sprintf("Moving %s to %s", inst.DisplayName, placementLabel(target)),
+		nil,
+		func(ctx context.Context) {
+			defer releaseInstance(migrated.ID)
+			if err := migrateInstance(ctx, migrated, src, dst, target); err != nil {
+				log.Printf("Failed to migrate instance %d: %v", migrated.ID, err)
+				setStatusMessage(migrated.ID, fmt.Sprintf("Failed: %v", err))
+				return
+			}
+			clearStatusMessage(migrated.ID)
+		})
+	writeJSON(w, http.StatusAccepted, map[string]string{"task_id": taskID})
+}
+
+func placementLabel(target string) string {
+	if target == "" {
+		return "the default backend"
+	}
+	return fmt.Sprintf("target %s", target)
+}
+
+// migrateInstance creates the workload on dst, quiesces the source, copies
+// the volume contents from src, switches the instance's binding and removes
+// the source workload. Nothing named after the instance may exist on dst
+// beforehand. Until the binding is switched the instance stays on src, and
+// any failure after the create deletes the workload on dst and restarts the
+// source's services. After the switch nothing is rolled back: a source workload that
+// cannot be deleted is only logged.
+func migrateInstance(ctx context.Context, inst database.Instance, src, dst orchestrator.ContainerOrchestrator, target string) (err error) {
+	// Refuse to touch a workload or volumes that already exist on the
+	// destination, running or stopped, e.g. when both targets point at the
+	// same Docker host. Rollback only deletes what this migration created.
+	exists, err := dst.InstanceExists(ctx, inst.Name)
+	if err != nil {
+		return fmt.Errorf("check destination: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("a workload or volumes named %s already exist on the destination", inst.Name)
+	}
+	created, quiesced := false, false
+	defer func() {
+		if err == nil {
+			return
+		}
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Minute)
+		defer cancel()
+		if created {
+			if delErr := dst.DeleteInstance(cleanupCtx, inst.Name); delErr != nil {
+				log.Printf("migrate %d: roll back destination workload: %v", inst.ID, delErr)
+			}
+		}
+		if quiesced {
+			if _, stderr, code, execErr := src.ExecInInstance(cleanupCtx, inst.Name, resumeCommand); execErr != nil || code != 0 {
+				log.Printf("migrate %d: restart source services: exit %d: %v %s", inst.ID, code, execErr, stderr)
+			}
+		}
+	}()
+
+	params := buildCreateParams(inst)
+	params.OnProgress = func(msg string) { setStatusMessage(inst.ID, msg) }
+	setStatusMessage(inst.ID, "Creating instance on the destination...")
+	// A failed create is not rolled back: what it left cannot be told apart
+	// from resources another create made under the same name since the
+	// check above, so they are left for the admin to remove.
+	if err := dst.CreateInstance(ctx, params); err != nil {
+		return fmt.Errorf("create on destination (remove anything named %s left there before retrying): %w", inst.Name, err)
+	}
+	created = true
+	if !waitForRunning(ctx, dst, inst.Name, migrationReadyTimeout) {
+		return errors.New("destination instance did not become ready")
+	}
+
+	// Stop the source's writers so the copy is complete: anything the agent
+	// wrote during a live copy would be lost once the source is deleted.
+	setStatusMessage(inst.ID, "Stopping the agent on the source...")
+	quiesced = true
+	if _, stderr, code, err := src.ExecInInstance(ctx, inst.Name, quiesceCommand); err != nil {
+		return fmt.Errorf("stop agent on source: %w", err)
+	} else if code != 0 {
+		return fmt.Errorf("stop agent on source: exit %d: %s", code, strings.TrimSpace(stderr))
+	}
+
+	setStatusMessage(inst.ID, "Copying volumes...")
+	if err := backup.CopyPaths(ctx, src, dst, inst.Name, migrationPaths); err != nil {
+		return err
+	}
+	// Restart so the agent starts from the copied home instead of the empty
+	// one it booted with.
+	setStatusMessage(inst.ID, "Restarting instance on the destination...")
+	if err := dst.RestartInstance(ctx, inst.Name, params); err != nil {
+		return fmt.Errorf("restart on destination: %w", err)
+	}
+	if !waitForRunning(ctx, dst, inst.Name, migrationReadyTimeout) {
+		return errors.New("destination instance did not become ready after the copy")
+	}
+
+	// The browser profile volume is not copied. Remove the browser pod while
+	// the binding still routes to the source so it does not outlive it there;
+	// the next session starts on the destination.
+	cancelActiveBrowserSpawn(inst.ID)
+	if BrowserAdmin != nil {
+		if err := BrowserAdmin.DeleteBrowserPod(ctx, inst.ID); err != nil {
+			log.Printf("migrate %d: delete browser pod for %s: %v", inst.ID, utils.SanitizeForLog(inst.Name), err)
+		}
+	}
+	_ = database.UpdateBrowserSessionStatus(inst.ID, "stopped", "")
+
+	setStatusMessage(inst.ID, "Switching to the destination...")
+	if err := database.DB.Model(&database.Instance{}).Where("id = ?", inst.ID).Updates(map[string]interface{}{
+		"placement_target": target,
+		"updated_at":       time.Now().UTC(),
+	}).Error; err != nil {
+		return fmt.Errorf("switch placement target: %w", err)
+	}
+
+	// Drop the connection, tunnels and pinned host key of the source
+	// workload; the background managers reconnect to the destination. The
+	// connection is closed again after the key is cleared, so one opened
+	// in between does not keep carrying gateway, terminal or tunnel traffic
+	// to the source.
+	if SSHMgr != nil {
+		SSHMgr.CancelReconnection(inst.ID)
+		SSHMgr.ClearHostKey(inst.ID)
+		if err := SSHMgr.Close(inst.ID); err != nil {
+			log.Printf("migrate %d: close source connection: %v", inst.ID, err)
+		}
+	}
+	if TunnelMgr != nil {
+		if err := TunnelMgr.StopTunnelsForInstance(inst.ID); err != nil {
+			log.Printf("migrate %d: stop tunnels: %v", inst.ID, err)
+		}
+	}
+
+	setStatusMessage(inst.ID, "Removing the source instance...")
+	if err := src.DeleteInstance(context.WithoutCancel(ctx), inst.Name); err != nil {
+		log.Printf("migrate %d: delete source workload %s: %v", inst.ID, utils.SanitizeForLog(inst.Name), err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+)
+
+// migrationBackend is one side of a migration. It tracks whether the
+// workload exists and records the shell commands run on it.
+type migrationBackend struct {
+	mockOrchestrator
+
+	mu         sync.Mutex
+	exists     bool
+	stopped    bool // exists, but its workload is stopped
+	deletes    int
+	restarts   int
+	commands   []string
+	chunkFail  bool
+	createFail bool // leaves a partial workload behind and fails
+}
+
+func (m *migrationBackend) CreateInstance(_ context.Context, _ orchestrator.CreateParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exists = true
+	if m.createFail {
+		return errors.New("PVC already exists")
+	}
+	return nil
+}
+
+func (m *migrationBackend) DeleteInstance(_ context.Context, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exists = false
+	m.deletes++
+	return nil
+}
+
+func (m *migrationBackend) RestartInstance(_ context.Context, _ string, _ orchestrator.CreateParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restarts++
+	return nil
+}
+
+func (m *migrationBackend) GetInstanceStatus(_ context.Context, _ string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.exists && !m.stopped {
+		return "running", nil
+	}
+	return "stopped", nil
+}
+
+func (m *migrationBackend) InstanceExists(_ context.Context, _ string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exists, nil
+}
+
+func (m *migrationBackend) ExecInInstance(_ context.Context, _ string, cmd []string) (string, string, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, cmd[len(cmd)-1])
+	if m.chunkFail && strings.HasPrefix(cmd[len(cmd)-1], "echo '") {
+		return "", "No space left on device", 1, nil
+	}
+	return "", "", 0, nil
+}
+
+func (m *migrationBackend) StreamExecInInstance(_ context.Context, _ string, _ []string, stdout io.Writer) (string, int, error) {
+	stdout.Write([]byte("home contents"))
+	return "", 0, nil
+}
+
+func (m *migrationBackend) extracted() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.commands {
+		if strings.HasPrefix(c, "tar xzf") {
+			return true
+		}
+	}
+	return false
+}
+
+func setupMigrationTest(t *testing.T) (src, dst *migrationBackend, inst database.Instance) {
+	t.Helper()
+	setupOrchestratorTargetsTest(t)
+	database.DB.Create(&database.OrchestratorTarget{Name: "eu", Backend: database.OrchestratorTargetKubernetes})
+	src = &migrationBackend{exists: true}
+	dst = &migrationBackend{}
+	orchestrator.Set(src)
+	orchestrator.SetTarget("eu", dst)
+	t.Cleanup(func() {
+		orchestrator.SetTarget("eu", nil)
+		orchestrator.Set(nil)
+	})
+	return src, dst, createTestInstance(t, "bot-mover", "Mover")
+}
+
+func TestMigrateInstance_Validation(t *testing.T) {
+	_, _, inst := setupMigrationTest(t)
+	stopped := createTestInstance(t, "bot-stopped", "Stopped")
+	database.DB.Model(&stopped).Update("status", "stopped")
+
+	for _, tc := range []struct {
+		inst   database.Instance
+		target string
+		want   int
+	}{
+		{inst, "default", http.StatusBadRequest},
+		{inst, "us", http.StatusBadRequest},
+		{stopped, "eu", http.StatusConflict},
+	} {
+		id := fmt.Sprint(tc.inst.ID)
+		w := httptest.NewRecorder()
+		MigrateInstance(w, notificationRequest("POST", "/api/v1/instances/"+id+"/migrate", map[string]string{"id": id}, map[string]string{"target": tc.target}))
+		if w.Code != tc.want {
+			t.Errorf("migrate %s to %q: status = %d, want %d (%s)", tc.inst.Name, tc.target, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
+
+func TestMigrateInstance_RefusedDuringPowerChange(t *testing.T) {
+	_, _, inst := setupMigrationTest(t)
+	claimInstance(inst.ID, opPowerChange)
+	t.Cleanup(func() { releaseInstance(inst.ID) })
+
+	id := fmt.Sprint(inst.ID)
+	w := httptest.NewRecorder()
+	MigrateInstance(w, notificationRequest("POST", "/api/v1/instances/"+id+"/migrate", map[string]string{"id": id}, map[string]string{"target": "eu"}))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), opPowerChange) {
+		t.Errorf("status = %d, body %s; want 409 naming the power change", w.Code, w.Body.String())
+	}
+}
+
+func TestMigrateInstance_SwitchesBinding(t *testing.T) {
+	src, dst, inst := setupMigrationTest(t)
+
+	id := fmt.Sprint(inst.ID)
+	w := httptest.NewRecorder()
+	MigrateInstance(w, notificationRequest("POST", "/api/v1/instances/"+id+"/migrate", map[string]string{"id": id}, map[string]string{"target": "eu"}))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var got database.Instance
+		database.DB.First(&got, inst.ID)
+		if got.PlacementTarget == "eu" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("placement_target = %q, want eu (status: %s)", got.PlacementTarget, getStatusMessage(inst.ID))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if _, busy := instanceOps.Load(inst.ID); !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("migration did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if !dst.extracted() || dst.restarts != 1 {
+		t.Errorf("destination: extracted=%v restarts=%d, want the copy extracted and one restart", dst.extracted(), dst.restarts)
+	}
+	if src.deletes != 1 || dst.deletes != 0 {
+		t.Errorf("deletes: source=%d destination=%d, want only the source removed", src.deletes, dst.deletes)
+	}
+	if want := quiesceCommand[len(quiesceCommand)-1]; len(src.commands) != 1 || src.commands[0] != want {
+		t.Errorf("source commands = %q, want only the quiesce before the copy", src.commands)
+	}
+	var got database.Instance
+	database.DB.First(&got, inst.ID)
+	if got.UUID != inst.UUID || got.Name != inst.Name {
+		t.Errorf("instance identity changed: %+v", got)
+	}
+}
+
+func TestMigrateInstance_RollsBackOnCopyFailure(t *testing.T) {
+	src, dst, inst := setupMigrationTest(t)
+	dst.chunkFail = true
+
+	err := migrateInstance(context.Background(), inst, src, dst, "eu")
+	if err == nil || !strings.Contains(err.Error(), "No space left") {
+		t.Fatalf("err = %v, want the destination's write error", err)
+	}
+	if dst.exists || dst.deletes != 1 {
+		t.Errorf("destination exists=%v deletes=%d, want it rolled back", dst.exists, dst.deletes)
+	}
+	if src.deletes != 0 || !src.exists {
+		t.Error("the source workload must be kept on failure")
+	}
+	quiesce, resume := quiesceCommand[len(quiesceCommand)-1], resumeCommand[len(resumeCommand)-1]
+	if len(src.commands) != 2 || src.commands[0] != quiesce || src.commands[1] != resume {
+		t.Errorf("source commands = %q, want the agent stopped and restarted", src.commands)
+	}
+	var got database.Instance
+	database.DB.First(&got, inst.ID)
+	if got.PlacementTarget != "" {
+		t.Errorf("placement_target = %q, want the binding unchanged", got.PlacementTarget)
+	}
+}
+
+func TestMigrateInstance_KeepsResourcesOfFailedCreate(t *testing.T) {
+	src, dst, inst := setupMigrationTest(t)
+	dst.createFail = true
+
+	err := migrateInstance(context.Background(), inst, src, dst, "eu")
+	if err == nil || !strings.Contains(err.Error(), inst.Name) {
+		t.Fatalf("err = %v, want the leftover named", err)
+	}
+	if dst.deletes != 0 {
+		t.Error("a failed create must not be rolled back: it may be another create's workload")
+	}
+	if len(src.commands) != 0 {
+		t.Errorf("source commands = %q, want the agent left running", src.commands)
+	}
+}
+
+func TestMigrateInstance_ClosesSourceConnection(t *testing.T) {
+	src, dst, inst := setupMigrationTest(t)
+	pub, priv, err := sshproxy.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("generate key pair: %v", err)
+	}
+	signer, err := sshproxy.ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatalf("parse private key: %v", err)
+	}
+	addr, stop := fileTestSSHServer(t, signer.PublicKey(), newFileTestFS())
+	defer stop()
+	mgr := sshproxy.NewSSHManager(signer, string(pub))
+	prev := SSHMgr
+	SSHMgr = mgr
+	t.Cleanup(func() {
+		mgr.CloseAll()
+		SSHMgr = prev
+	})
+	host, portStr, _ := net.SplitHostPort(addr)
+	var port int
+	fmt.Sscanf(portStr, "%d", &port)
+	if _, err := mgr.Connect(context.Background(), inst.ID, host, port); err != nil {
+		t.Fatalf("SSH connect: %v", err)
+	}
+
+	if err := migrateInstance(context.Background(), inst, src, dst, "eu"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, ok := mgr.GetConnection(inst.ID); ok {
+		t.Error("the connection to the source is still open after the switch")
+	}
+}
+
+func TestMigrateInstance_RefusesExistingDestinationWorkload(t *testing.T) {
+	for _, stopped := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stopped=%v", stopped), func(t *testing.T) {
+			src, dst, inst := setupMigrationTest(t)
+			dst.exists, dst.stopped = true, stopped
+
+			if err := migrateInstance(context.Background(), inst, src, dst, "eu"); err == nil {
+				t.Fatal("expected an error for an existing destination workload")
+			}
+			if dst.deletes != 0 || !dst.exists {
+				t.Error("an existing destination workload must not be deleted")
+			}
+		})
+	}
+}
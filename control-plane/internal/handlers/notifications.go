@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/notify"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+type notificationChannelResponse struct {
+	database.NotificationChannel
+	HasSecret bool `json:"has_secret"`
+}
+
+func notificationChannelToResponse(c database.NotificationChannel) notificationChannelResponse {
+	return notificationChannelResponse{NotificationChannel: c, HasSecret: c.Secret != ""}
+}
+
+type notificationRuleResponse struct {
+	database.NotificationRule
+	EventTypes []string `json:"event_types"`
+}
+
+func notificationRuleToResponse(r database.NotificationRule) notificationRuleResponse {
+	return notificationRuleResponse{NotificationRule: r, EventTypes: database.ParseNotificationEventTypes(r.EventTypes)}
+}
+
+// ListNotificationEventTypes handles GET /api/v1/notifications/event-types.
+func ListNotificationEventTypes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, notify.EventTypes)
+}
+
+// ListNotificationChannels handles GET /api/v1/notifications/channels.
+func ListNotificationChannels(w http.ResponseWriter, r *http.Request) {
+	channels, err := database.ListNotificationChannels()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list notification channels")
+		return
+	}
+	out := make([]notificationChannelResponse, len(channels))
+	for i, c := range channels {
+		out[i] = notificationChannelToResponse(c)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// notificationChannelRequest is the body for create and update. On update
+// a nil Secret keeps the stored one and an empty string clears it.
+type notificationChannelRequest struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	URL     string  `json:"url"`
+	Secret  *string `json:"secret"`
+	EmailTo string  `json:"email_to"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// validate checks the fields that apply to body.Type.
+func (body *notificationChannelRequest) validate() string {
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return "name is required"
+	}
+	if !database.IsValidNotificationChannelType(body.Type) {
+		return "type must be webhook, slack or email"
+	}
+	if body.Type == database.NotificationChannelEmail {
+		if strings.TrimSpace(body.EmailTo) == "" {
+			return "email_to is required for email channels"
+		}
+		return ""
+	}
+	u, err := url.Parse(body.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url must be an http(s) URL"
+	}
+	return ""
+}
+
+// CreateNotificationChannel handles POST /api/v1/notifications/channels.
+func CreateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var body notificationChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	c := database.NotificationChannel{
+		Name:    body.Name,
+		Type:    body.Type,
+		URL:     body.URL,
+		EmailTo: body.EmailTo,
+		Enabled: body.Enabled == nil || *body.Enabled,
+	}
+	if body.Secret != nil && *body.Secret != "" {
+		enc, err := utils.Encrypt(*body.Secret)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to encrypt secret")
+			return
+		}
+		c.Secret = enc
+	}
+	if err := database.DB.Create(&c).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create notification channel")
+		return
+	}
+	writeJSON(w, http.StatusCreated, notificationChannelToResponse(c))
+}
+
+// UpdateNotificationChannel handles PUT /api/v1/notifications/channels/{id}.
+func UpdateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadNotificationChannel(w, r)
+	if !ok {
+		return
+	}
+	var body notificationChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := body.validate(); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	updates := map[string]interface{}{
+		"name":     body.Name,
+		"type":     body.Type,
+		"url":      body.URL,
+		"email_to": body.EmailTo,
+	}
+	if body.Enabled != nil {
+		updates["enabled"] = *body.Enabled
+	}
+	if body.Secret != nil {
+		enc := ""
+		if *body.Secret != "" {
+			var err error
+			if enc, err = utils.Encrypt(*body.Secret); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to encrypt secret")
+				return
+			}
+		}
+		updates["secret"] = enc
+	}
+	if err := database.DB.Model(c).Updates(updates).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update notification channel")
+		return
+	}
+	updated, _ := database.GetNotificationChannel(c.ID)
+	writeJSON(w, http.StatusOK, notificationChannelToResponse(*updated))
+}
+
+// DeleteNotificationChannel handles DELETE /api/v1/notifications/channels/{id}.
+// The channel's rules are deleted with it.
+func DeleteNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+	if err := database.DeleteNotificationChannel(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Notification channel not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete notification channel")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestNotificationChannel handles POST /api/v1/notifications/channels/{id}/test.
+// It sends a sample event synchronously, bypassing rules, throttling and
+// retries, and reports the delivery error if any.
+func TestNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	c, ok := loadNotificationChannel(w, r)
+	if !ok {
+		return
+	}
+	ev := notify.Event{
+		Type:    "test",
+		Title:   "Test notification",
+		Message: "This is a test notification from Claworc.",
+		Time:    time.Now().UTC(),
+	}
+	if err := notify.Send(r.Context(), *c, ev); err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func loadNotificationChannel(w http.ResponseWriter, r *http.Request) (*database.NotificationChannel, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid channel ID")
+		return nil, false
+	}
+	c, err := database.GetNotificationChannel(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Notification channel not found")
+		return nil, false
+	}
+	return c, true
+}
+
+// ListNotificationRules handles GET /api/v1/notifications/rules.
+func ListNotificationRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := database.ListNotificationRules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list notification rules")
+		return
+	}
+	out := make([]notificationRuleResponse, len(rules))
+	for i, rule := range rules {
+		out[i] = notificationRuleToResponse(rule)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+type notificationRuleRequest struct {
+	ChannelID  uint     `json:"channel_id"`
+	TeamID     *uint    `json:"team_id"`
+	EventTypes []string `json:"event_types"`
+}
+
+// CreateNotificationRule handles POST /api/v1/notifications/rules. A nil
+// team_id subscribes the channel to events from every team.
+func CreateNotificationRule(w http.ResponseWriter, r *http.Request) {
+	var body notificationRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err := database.GetNotificationChannel(body.ChannelID); err != nil {
+		writeError(w, http.StatusBadRequest, "Unknown channel_id")
+		return
+	}
+	if body.TeamID != nil {
+		if _, err := database.GetTeam(*body.TeamID); err != nil {
+			writeError(w, http.StatusBadRequest, "Unknown team_id")
+			return
+		}
+	}
+	if len(body.EventTypes) == 0 {
+		writeError(w, http.StatusBadRequest, "event_types is required")
+		return
+	}
+	for _, t := range body.EventTypes {
+		if !notify.IsValidEventType(t) {
+			writeError(w, http.StatusBadRequest, "Unknown event type: "+t)
+			return
+		}
+	}
+	types, _ := json.Marshal(body.EventTypes)
+	rule := database.NotificationRule{ChannelID: body.ChannelID, TeamID: body.TeamID, EventTypes: string(types)}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create notification rule")
+		return
+	}
+	writeJSON(w, http.StatusCreated, notificationRuleToResponse(rule))
+}
+
+// DeleteNotificationRule handles DELETE /api/v1/notifications/rules/{id}.
+func DeleteNotificationRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+	if err := database.DeleteNotificationRule(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Notification rule not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete notification rule")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+func setupNotificationsTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.Team{}, &database.NotificationChannel{}, &database.NotificationRule{})
+}
+
+func notificationRequest(method, path string, params map[string]string, body interface{}) *http.Request {
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, path, bytes.NewReader(b))
+	} else {
+		r = httptest.NewRequest(method, path, nil)
+	}
+	return withChiAndUser(r, nil, params)
+}
+
+func TestNotificationChannel_SecretIsEncryptedAndKept(t *testing.T) {
+	setupNotificationsTest(t)
+
+	w := httptest.NewRecorder()
+	CreateNotificationChannel(w, notificationRequest("POST", "/api/v1/notifications/channels", nil, map[string]any{
+		"name": "ops", "type": "webhook", "url": "https://hooks.example.com/claworc", "secret": "s3cret",
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "s3cret") {
+		t.Fatal("response leaks the secret")
+	}
+	var created notificationChannelResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !created.HasSecret || !created.Enabled {
+		t.Errorf("created = %+v", created)
+	}
+
+	id := fmt.Sprint(created.ID)
+	w = httptest.NewRecorder()
+	UpdateNotificationChannel(w, notificationRequest("PUT", "/api/v1/notifications/channels/"+id, map[string]string{"id": id}, map[string]any{
+		"name": "ops-renamed", "type": "webhook", "url": "https://hooks.example.com/claworc", "enabled": false,
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", w.Code, w.Body.String())
+	}
+	c, _ := database.GetNotificationChannel(created.ID)
+	if c.Name != "ops-renamed" || c.Enabled {
+		t.Errorf("channel = %+v", c)
+	}
+	if secret, err := utils.Decrypt(c.Secret); err != nil || secret != "s3cret" {
+		t.Errorf("stored secret = %q, %v; want it kept", secret, err)
+	}
+}
+
+func TestCreateNotificationChannel_Validation(t *testing.T) {
+	setupNotificationsTest(t)
+	for _, body := range []map[string]any{
+		{"name": "", "type": "slack", "url": "https://hooks.slack.com/x"},
+		{"name": "a", "type": "pager", "url": "https://example.com"},
+		{"name": "a", "type": "webhook", "url": "ftp://example.com"},
+		{"name": "a", "type": "email"},
+	} {
+		w := httptest.NewRecorder()
+		CreateNotificationChannel(w, notificationRequest("POST", "/api/v1/notifications/channels", nil, body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestNotificationRules_CreateAndCascadeDelete(t *testing.T) {
+	setupNotificationsTest(t)
+	ch := database.NotificationChannel{Name: "slack", Type: "slack", URL: "https://hooks.slack.com/x", Enabled: true}
+	database.DB.Create(&ch)
+
+	w := httptest.NewRecorder()
+	CreateNotificationRule(w, notificationRequest("POST", "/api/v1/notifications/rules", nil, map[string]any{
+		"channel_id": ch.ID, "event_types": []string{"instance.crashed"},
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown event type: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	CreateNotificationRule(w, notificationRequest("POST", "/api/v1/notifications/rules", nil, map[string]any{
+		"channel_id": ch.ID, "team_id": 99, "event_types": []string{"*"},
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown team: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	CreateNotificationRule(w, notificationRequest("POST", "/api/v1/notifications/rules", nil, map[string]any{
+		"channel_id": ch.ID, "event_types": []string{"backup.failed", "instance.unreachable"},
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	var rule notificationRuleResponse
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if rule.TeamID != nil || len(rule.EventTypes) != 2 {
+		t.Errorf("rule = %+v", rule)
+	}
+
+	id := fmt.Sprint(ch.ID)
+	w = httptest.NewRecorder()
+	DeleteNotificationChannel(w, notificationRequest("DELETE", "/api/v1/notifications/channels/"+id, map[string]string{"id": id}, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d", w.Code)
+	}
+	if rules, _ := database.ListNotificationRules(); len(rules) != 0 {
+		t.Errorf("rules left after channel delete: %+v", rules)
+	}
+}
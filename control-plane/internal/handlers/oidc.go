@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// oidcFlowCookie carries state, nonce and PKCE verifier from the login
+// redirect to the callback. Keeping it client-side means the callback can
+// land on any replica.
+const oidcFlowCookie = "claworc_oidc_flow"
+
+const oidcCallbackPath = "/api/v1/auth/oidc/callback"
+
+// GetOIDCConfig handles GET /api/v1/auth/oidc/config so the login page can
+// decide whether to show the SSO button.
+func GetOIDCConfig(w http.ResponseWriter, r *http.Request) {
+	if auth.OIDC == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": true, "name": auth.OIDC.ProviderName})
+}
+
+// oidcRedirectURL is the callback URL registered with the IdP: the
+// configured one, or this request's origin plus the callback path.
+func oidcRedirectURL(r *http.Request) string {
+	if auth.OIDC.RedirectURL != "" {
+		return auth.OIDC.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if p := r.Header.Get("X-Forwarded-Proto"); p == "https" || p == "http" {
+		scheme = p
+	}
+	return scheme + "://" + r.Host + oidcCallbackPath
+}
+
+// safeReturnPath only allows same-origin absolute paths, so the login flow
+// cannot be used as an open redirect.
+func safeReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// OIDCLogin handles GET /api/v1/auth/oidc/login?redirect=/path. It
+// redirects the browser to the IdP.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if auth.OIDC == nil {
+		writeError(w, http.StatusNotFound, "SSO is not configured")
+		return
+	}
+	authURL, flow, err := auth.OIDC.NewOIDCFlow(r.Context(), oidcRedirectURL(r), safeReturnPath(r.URL.Query().Get("redirect")))
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		writeError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+	raw, _ := json.Marshal(flow)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(raw),
+		Path:     "/api/v1/auth/oidc",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback handles the IdP redirect back: it validates state, completes
+// the code exchange, provisions the user and starts a dashboard session.
+// Failures send the browser to the login page with an sso_error message.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	fail := func(msg string) {
+		http.Redirect(w, r, "/login?sso_error="+url.QueryEscape(msg), http.StatusFound)
+	}
+	if auth.OIDC == nil {
+		fail("SSO is not configured")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/api/v1/auth/oidc", MaxAge: -1, HttpOnly: true})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		log.Printf("oidc callback: provider returned %s: %s", e, q.Get("error_description"))
+		fail("Sign-in was rejected by the identity provider")
+		return
+	}
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		fail("Sign-in expired, please try again")
+		return
+	}
+	var flow auth.OIDCFlow
+	raw, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || json.Unmarshal(raw, &flow) != nil || flow.State == "" || flow.State != q.Get("state") {
+		fail("Sign-in expired, please try again")
+		return
+	}
+
+	id, err := auth.OIDC.CompleteOIDCFlow(r.Context(), oidcRedirectURL(r), q.Get("code"), &flow)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		if errors.Is(err, auth.ErrOIDCGroupDenied) {
+			fail("Your account is not allowed to use Claworc")
+			return
+		}
+		fail("Sign-in failed")
+		return
+	}
+	user, err := auth.ProvisionExternalUser(*id, auth.OIDC.ProvisionOpts)
+	if err != nil {
+		log.Printf("oidc callback: provision %q: %v", id.Username, err)
+		if errors.Is(err, auth.ErrUserNotProvisioned) {
+			fail("No Claworc account for " + id.Username)
+			return
+		}
+		fail("Sign-in failed")
+		return
+	}
+
+	sessionID, err := SessionStore.CreateWithInfo(user.ID, r.UserAgent(), sourceIPOf(r))
+	if err != nil {
+		fail("Failed to create session")
+		return
+	}
+	_ = database.TouchUserLastLogin(user.ID)
+	setSessionCookie(w, r, sessionID)
+	http.Redirect(w, r, safeReturnPath(flow.Redirect), http.StatusFound)
+}
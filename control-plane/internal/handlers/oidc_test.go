@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+	"github.com/gluk-w/claworc/control-plane/internal/auth/mockidp"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupOIDCTest(t *testing.T) *mockidp.IdP {
+	t.Helper()
+	setupAuthTest(t)
+	idp := mockidp.New("", "claworc", "secret")
+	srv := httptest.NewServer(idp)
+	t.Cleanup(srv.Close)
+	idp.Issuer = srv.URL
+	auth.OIDC = &auth.OIDCConfig{
+		Issuer:        srv.URL,
+		ClientID:      "claworc",
+		ClientSecret:  "secret",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		ProviderName:  "Mock",
+		ProvisionOpts: auth.ProvisionOptions{
+			AutoCreate: true,
+			Mapping:    auth.GroupMapping{AdminGroups: []string{"admins"}},
+		},
+	}
+	t.Cleanup(func() { auth.OIDC = nil })
+	return idp
+}
+
+// oidcRoundTrip runs OIDCLogin, lets the mock IdP approve, and feeds the
+// resulting redirect into OIDCCallback.
+func oidcRoundTrip(t *testing.T, returnTo string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/login?redirect="+url.QueryEscape(returnTo), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body.String())
+	}
+	var flowCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcFlowCookie {
+			flowCookie = c
+		}
+	}
+	if flowCookie == nil {
+		t.Fatal("login did not set the flow cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	callback := resp.Header.Get("Location")
+	if !strings.HasPrefix(callback, "http://example.com"+oidcCallbackPath) {
+		t.Fatalf("IdP redirected to %q", callback)
+	}
+
+	req := httptest.NewRequest("GET", callback, nil)
+	req.AddCookie(flowCookie)
+	w = httptest.NewRecorder()
+	OIDCCallback(w, req)
+	return w
+}
+
+func TestGetOIDCConfig(t *testing.T) {
+	w := httptest.NewRecorder()
+	GetOIDCConfig(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/config", nil))
+	if !strings.Contains(w.Body.String(), `"enabled":false`) {
+		t.Errorf("disabled body = %s", w.Body.String())
+	}
+
+	setupOIDCTest(t)
+	w = httptest.NewRecorder()
+	GetOIDCConfig(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/config", nil))
+	if !strings.Contains(w.Body.String(), `"name":"Mock"`) {
+		t.Errorf("enabled body = %s", w.Body.String())
+	}
+}
+
+func TestOIDCCallback_ProvisionsUserAndStartsSession(t *testing.T) {
+	idp := setupOIDCTest(t)
+	idp.SetIdentity(map[string]interface{}{
+		"sub": "s-1", "preferred_username": "erin", "groups": []string{"admins"},
+	}, false)
+
+	w := oidcRoundTrip(t, "/instances/5")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/instances/5" {
+		t.Fatalf("callback = %d -> %q", w.Code, w.Header().Get("Location"))
+	}
+	var session string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.SessionCookie {
+			session = c.Value
+		}
+	}
+	userID, ok := SessionStore.Get(session)
+	if !ok {
+		t.Fatal("callback did not create a session")
+	}
+	user, err := database.GetUserByUsername("erin")
+	if err != nil {
+		t.Fatalf("user not provisioned: %v", err)
+	}
+	if user.ID != userID || user.Role != "admin" || user.AuthSource != auth.AuthSourceOIDC {
+		t.Errorf("user = %+v, session user = %d", user, userID)
+	}
+}
+
+func TestOIDCCallback_RejectsOpenRedirectAndBadState(t *testing.T) {
+	setupOIDCTest(t)
+	w := oidcRoundTrip(t, "//evil.example/")
+	if loc := w.Header().Get("Location"); loc != "/" {
+		t.Errorf("return path = %q, want /", loc)
+	}
+
+	req := httptest.NewRequest("GET", oidcCallbackPath+"?code=x&state=forged", nil)
+	req.AddCookie(&http.Cookie{Name: oidcFlowCookie, Value: "eyJzIjoicmVhbCJ9"})
+	w = httptest.NewRecorder()
+	OIDCCallback(w, req)
+	if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "/login?sso_error=") {
+		t.Errorf("forged state redirected to %q", loc)
+	}
+}
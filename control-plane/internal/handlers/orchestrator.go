@@ -1,9 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
 )
 
 // GetOrchestratorStatus returns the current init status snapshot.
@@ -11,10 +24,287 @@ func GetOrchestratorStatus(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, orchestrator.Status())
 }
 
-// ReinitializeOrchestrator re-runs InitOrchestrator and returns the new status.
-// Lets operators recover after fixing Docker/Kubernetes availability without
-// restarting the control plane.
+// ReinitializeOrchestrator re-runs InitOrchestrator and InitTargets and
+// returns the new status. Lets operators recover after fixing Docker/Kubernetes
+// availability without restarting the control plane.
 func ReinitializeOrchestrator(w http.ResponseWriter, r *http.Request) {
 	_ = orchestrator.InitOrchestrator(r.Context())
+	_ = orchestrator.InitTargets(r.Context())
 	writeJSON(w, http.StatusOK, orchestrator.Status())
 }
+
+var targetNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*[a-z0-9]$|^[a-z0-9]$`)
+
+type orchestratorTargetResponse struct {
+	database.OrchestratorTarget
+	HasKubeconfig   bool                       `json:"has_kubeconfig"`
+	HasDockerTLSKey bool                       `json:"has_docker_tls_key"`
+	Status          *orchestrator.TargetStatus `json:"status,omitempty"`
+}
+
+func orchestratorTargetToResponse(t database.OrchestratorTarget) orchestratorTargetResponse {
+	resp := orchestratorTargetResponse{
+		OrchestratorTarget: t,
+		HasKubeconfig:      t.Kubeconfig != "",
+		HasDockerTLSKey:    t.DockerTLSKey != "",
+	}
+	for _, st := range orchestrator.Status().Targets {
+		if st.Name == t.Name {
+			st := st
+			resp.Status = &st
+			break
+		}
+	}
+	return resp
+}
+
+// ListOrchestratorTargets handles GET /api/v1/orchestrator/targets.
+func ListOrchestratorTargets(w http.ResponseWriter, r *http.Request) {
+	targets, err := database.ListOrchestratorTargets()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list orchestrator targets")
+		return
+	}
+	out := make([]orchestratorTargetResponse, len(targets))
+	for i, t := range targets {
+		out[i] = orchestratorTargetToResponse(t)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// orchestratorTargetRequest is the body for create and update. On update
+// a nil Kubeconfig or DockerTLSKey keeps the stored one and an empty string
+// clears it. Name and backend cannot change once created.
+type orchestratorTargetRequest struct {
+	Name          string  `json:"name"`
+	Backend       string  `json:"backend"`
+	Kubeconfig    *string `json:"kubeconfig"`
+	KubeContext   string  `json:"kube_context"`
+	Namespace     string  `json:"namespace"`
+	DockerHost    string  `json:"docker_host"`
+	DockerTLSCA   string  `json:"docker_tls_ca"`
+	DockerTLSCert string  `json:"docker_tls_cert"`
+	DockerTLSKey  *string `json:"docker_tls_key"`
+	SSHHost       string  `json:"ssh_host"`
+}
+
+// validate checks the fields that apply to body.Backend. hasKey reports
+// whether a TLS key is stored already (update) so a certificate can be
+// changed without resending it.
+func (body *orchestratorTargetRequest) validate(hasKey bool) string {
+	body.Name = strings.TrimSpace(body.Name)
+	if !targetNameRegex.MatchString(body.Name) || len(body.Name) > 63 {
+		return "name must be lowercase letters, digits and hyphens (max 63)"
+	}
+	if body.Name == database.DefaultPlacementTarget {
+		return fmt.Sprintf("%q is reserved for the default backend", database.DefaultPlacementTarget)
+	}
+	switch body.Backend {
+	case database.OrchestratorTargetKubernetes:
+		return ""
+	case database.OrchestratorTargetDocker:
+	default:
+		return "backend must be kubernetes or docker"
+	}
+	body.DockerHost = strings.TrimSpace(body.DockerHost)
+	if !strings.HasPrefix(body.DockerHost, "tcp://") && !strings.HasPrefix(body.DockerHost, "unix://") {
+		return "docker_host must be a tcp:// or unix:// address"
+	}
+	if body.DockerTLSKey != nil {
+		hasKey = *body.DockerTLSKey != ""
+	}
+	if (body.DockerTLSCert != "") != hasKey {
+		return "docker_tls_cert and docker_tls_key must be set together"
+	}
+	if body.SSHHost != "" && net.ParseIP(body.SSHHost) == nil {
+		return "ssh_host must be an IP address"
+	}
+	return ""
+}
+
+// encryptOptional encrypts a non-empty secret; nil stays nil.
+func encryptOptional(v *string) (*string, error) {
+	if v == nil || *v == "" {
+		return v, nil
+	}
+	enc, err := utils.Encrypt(*v)
+	if err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
+// CreateOrchestratorTarget handles POST /api/v1/orchestrator/targets. The
+// new target is connected before responding; its status shows whether that
+// worked.
+func CreateOrchestratorTarget(w http.ResponseWriter, r *http.Request) {
+	var body orchestratorTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if msg := body.validate(false); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if _, err := database.GetOrchestratorTargetByName(body.Name); err == nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Orchestrator target '%s' already exists", body.Name))
+		return
+	}
+	kubeconfig, err := encryptOptional(body.Kubeconfig)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt kubeconfig")
+		return
+	}
+	tlsKey, err := encryptOptional(body.DockerTLSKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt TLS key")
+		return
+	}
+
+	t := database.OrchestratorTarget{
+		Name:          body.Name,
+		Backend:       body.Backend,
+		KubeContext:   body.KubeContext,
+		Namespace:     body.Namespace,
+		DockerHost:    body.DockerHost,
+		DockerTLSCA:   body.DockerTLSCA,
+		DockerTLSCert: body.DockerTLSCert,
+		SSHHost:       body.SSHHost,
+	}
+	if kubeconfig != nil {
+		t.Kubeconfig = *kubeconfig
+	}
+	if tlsKey != nil {
+		t.DockerTLSKey = *tlsKey
+	}
+	if err := database.DB.Create(&t).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create orchestrator target")
+		return
+	}
+	_ = orchestrator.InitTargets(r.Context())
+
+	resp := orchestratorTargetToResponse(t)
+	audit.SetAction(r, "orchestrator_target.create")
+	audit.SetTarget(r, "orchestrator_target", t.ID, t.Name)
+	audit.SetChange(r, nil, targetAuditState(resp))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateOrchestratorTarget handles PUT /api/v1/orchestrator/targets/{id} and
+// reconnects the target with the new settings.
+func UpdateOrchestratorTarget(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadOrchestratorTarget(w, r)
+	if !ok {
+		return
+	}
+	var body orchestratorTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.Name == "" {
+		body.Name = t.Name
+	}
+	if body.Backend == "" {
+		body.Backend = t.Backend
+	}
+	if body.Name != t.Name || body.Backend != t.Backend {
+		writeError(w, http.StatusBadRequest, "name and backend cannot be changed")
+		return
+	}
+	if msg := body.validate(t.DockerTLSKey != ""); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	updates := map[string]interface{}{
+		"kube_context":    body.KubeContext,
+		"namespace":       body.Namespace,
+		"docker_host":     body.DockerHost,
+		"docker_tls_ca":   body.DockerTLSCA,
+		"docker_tls_cert": body.DockerTLSCert,
+		"ssh_host":        body.SSHHost,
+	}
+	kubeconfig, err := encryptOptional(body.Kubeconfig)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt kubeconfig")
+		return
+	}
+	if kubeconfig != nil {
+		updates["kubeconfig"] = *kubeconfig
+	}
+	tlsKey, err := encryptOptional(body.DockerTLSKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt TLS key")
+		return
+	}
+	if tlsKey != nil {
+		updates["docker_tls_key"] = *tlsKey
+	}
+	before := orchestratorTargetToResponse(*t)
+	if err := database.DB.Model(t).Updates(updates).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update orchestrator target")
+		return
+	}
+	_ = orchestrator.InitTargets(r.Context())
+
+	updated, _ := database.GetOrchestratorTarget(t.ID)
+	resp := orchestratorTargetToResponse(*updated)
+	audit.SetAction(r, "orchestrator_target.update")
+	audit.SetTarget(r, "orchestrator_target", t.ID, t.Name)
+	audit.SetChange(r, targetAuditState(before), targetAuditState(resp))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// targetAuditState drops the connection status, which is not a setting.
+func targetAuditState(resp orchestratorTargetResponse) orchestratorTargetResponse {
+	resp.Status = nil
+	return resp
+}
+
+// DeleteOrchestratorTarget handles DELETE /api/v1/orchestrator/targets/{id}.
+// A target that still has instances bound to it cannot be deleted.
+func DeleteOrchestratorTarget(w http.ResponseWriter, r *http.Request) {
+	t, ok := loadOrchestratorTarget(w, r)
+	if !ok {
+		return
+	}
+	n, err := database.CountInstancesOnTarget(t.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to check instances on target")
+		return
+	}
+	if n > 0 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("%d instance(s) still run on target '%s'", n, t.Name))
+		return
+	}
+	if err := database.DB.Delete(t).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete orchestrator target")
+		return
+	}
+	_ = orchestrator.InitTargets(r.Context())
+
+	audit.SetAction(r, "orchestrator_target.delete")
+	audit.SetTarget(r, "orchestrator_target", t.ID, t.Name)
+	audit.SetChange(r, targetAuditState(orchestratorTargetToResponse(*t)), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadOrchestratorTarget(w http.ResponseWriter, r *http.Request) (*database.OrchestratorTarget, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid target ID")
+		return nil, false
+	}
+	t, err := database.GetOrchestratorTarget(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "Orchestrator target not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to load orchestrator target")
+		return nil, false
+	}
+	return t, true
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+func setupOrchestratorTargetsTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.Team{}, &database.OrchestratorTarget{})
+}
+
+func TestCreateOrchestratorTarget_Validation(t *testing.T) {
+	setupOrchestratorTargetsTest(t)
+
+	for _, body := range []map[string]any{
+		{"name": "default", "backend": "kubernetes"},
+		{"name": "EU West", "backend": "kubernetes"},
+		{"name": "eu", "backend": "nomad"},
+		{"name": "edge", "backend": "docker"},
+		{"name": "edge", "backend": "docker", "docker_host": "tcp://10.0.0.5:2376", "docker_tls_cert": "cert"},
+		{"name": "edge", "backend": "docker", "docker_host": "tcp://10.0.0.5:2376", "ssh_host": "edge.local"},
+	} {
+		w := httptest.NewRecorder()
+		CreateOrchestratorTarget(w, notificationRequest("POST", "/api/v1/orchestrator/targets", nil, body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("create %v: status = %d, want 400 (%s)", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestOrchestratorTarget_CreateUpdateDelete(t *testing.T) {
+	setupOrchestratorTargetsTest(t)
+
+	w := httptest.NewRecorder()
+	CreateOrchestratorTarget(w, notificationRequest("POST", "/api/v1/orchestrator/targets", nil, map[string]any{
+		"name": "eu", "backend": "kubernetes", "kubeconfig": "not: [a kubeconfig", "namespace": "claworc-eu",
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "a kubeconfig") {
+		t.Fatal("response leaks the kubeconfig")
+	}
+	var created orchestratorTargetResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !created.HasKubeconfig || created.Status == nil || created.Status.Available {
+		t.Errorf("created = %+v, want a stored kubeconfig that failed to connect", created)
+	}
+	stored, _ := database.GetOrchestratorTarget(created.ID)
+	if plain, err := utils.Decrypt(stored.Kubeconfig); err != nil || plain != "not: [a kubeconfig" {
+		t.Errorf("stored kubeconfig = %q, %v", plain, err)
+	}
+
+	id := fmt.Sprint(created.ID)
+	w = httptest.NewRecorder()
+	UpdateOrchestratorTarget(w, notificationRequest("PUT", "/api/v1/orchestrator/targets/"+id, map[string]string{"id": id}, map[string]any{
+		"name": "asia", "backend": "kubernetes",
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("rename status = %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	UpdateOrchestratorTarget(w, notificationRequest("PUT", "/api/v1/orchestrator/targets/"+id, map[string]string{"id": id}, map[string]any{
+		"kube_context": "eu-west-1",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, body: %s", w.Code, w.Body.String())
+	}
+	stored, _ = database.GetOrchestratorTarget(created.ID)
+	if stored.KubeContext != "eu-west-1" || stored.Namespace != "" || stored.Kubeconfig == "" {
+		t.Errorf("after update = %+v, want context set and kubeconfig kept", stored)
+	}
+
+	inst := createTestInstance(t, "bot-eu", "EU")
+	database.DB.Model(&inst).Update("placement_target", "eu")
+	w = httptest.NewRecorder()
+	DeleteOrchestratorTarget(w, notificationRequest("DELETE", "/api/v1/orchestrator/targets/"+id, map[string]string{"id": id}, nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("delete with bound instance status = %d, want 409", w.Code)
+	}
+
+	database.DB.Delete(&inst)
+	w = httptest.NewRecorder()
+	DeleteOrchestratorTarget(w, notificationRequest("DELETE", "/api/v1/orchestrator/targets/"+id, map[string]string{"id": id}, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateInstance_UnknownPlacementTarget(t *testing.T) {
+	setupOrchestratorTargetsTest(t)
+	team := database.Team{Name: "Default Team"}
+	database.DB.Create(&team)
+
+	w := httptest.NewRecorder()
+	CreateInstance(w, notificationRequest("POST", "/api/v1/instances", nil, map[string]any{
+		"display_name": "EU bot", "team_id": team.ID, "placement_target": "eu",
+	}))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "placement target") {
+		t.Errorf("status = %d, body: %s; want 400 for an unknown target", w.Code, w.Body.String())
+	}
+}
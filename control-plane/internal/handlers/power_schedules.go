@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
+	"github.com/gluk-w/claworc/control-plane/internal/backup"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// StartPowerScheduleExecutor starts a background goroutine that checks power
+// schedules every minute and starts or stops the instances of due ones. See
+// docs/power-schedules.md. It returns a cancel function to stop the job.
+func StartPowerScheduleExecutor(ctx context.Context) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				executeDuePowerSchedules(ctx, time.Now().UTC())
+			}
+		}
+	}()
+
+	return cancel
+}
+
+func executeDuePowerSchedules(ctx context.Context, now time.Time) {
+	schedules, err := database.ListDuePowerSchedules(now)
+	if err != nil {
+		log.Printf("Power scheduler: list schedules: %v", err)
+		return
+	}
+	for _, s := range schedules {
+		result := runPowerSchedule(ctx, s)
+		log.Printf("Power schedule %s: %s", utils.SanitizeForLog(s.Name), result)
+
+		updates := map[string]interface{}{
+			"last_run_at": &now,
+			"last_result": result,
+		}
+		if next, err := backup.ComputeNextRun(s.CronExpression); err == nil {
+			updates["next_run_at"] = &next
+		} else {
+			updates["next_run_at"] = nil
+		}
+		if err := database.DB.Model(&database.PowerSchedule{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+			log.Printf("Power scheduler: schedule %d: %v", s.ID, err)
+		}
+	}
+}
+
+type powerDecision int
+
+const (
+	powerAct powerDecision = iota
+	powerAlready
+	powerBusy
+)
+
+// runPowerSchedule starts a task for every covered instance that is not in
+// the target state yet and returns a summary for PowerSchedule.LastResult.
+// Instances that are busy (another task, a migration or a wake in flight,
+// or a transitional status) are skipped until the next run. Each instance
+// is claimed before the decision, and the claim is held until its task
+// ends, so a migration cannot start in between.
+func runPowerSchedule(ctx context.Context, s database.PowerSchedule) string {
+	instances, err := database.ListPowerScheduleInstances(s)
+	if err != nil {
+		return "Failed: " + err.Error()
+	}
+	var acted, already, busy int
+	for i := range instances {
+		inst := instances[i]
+		if _, ok := claimInstance(inst.ID, opPowerChange); !ok {
+			busy++
+			continue
+		}
+		switch decidePower(ctx, &inst, s.Action) {
+		case powerAct:
+			startPowerTask(s, inst)
+			acted++
+			continue
+		case powerAlready:
+			already++
+		default:
+			busy++
+		}
+		releaseInstance(inst.ID)
+	}
+	verb := "stopped"
+	if s.Action == database.PowerActionStart {
+		verb = "started"
+	}
+	return fmt.Sprintf("%s %d of %d instance(s); %d already %s, %d busy", verb, acted, len(instances), already, verb, busy)
+}
+
+// decidePower reports whether inst should be started or stopped now. The
+// caller holds the instance's claim.
+func decidePower(ctx context.Context, inst *database.Instance, action string) powerDecision {
+	if instanceBusy(inst.ID) {
+		return powerBusy
+	}
+	status := inst.Status
+	if orch := orchestrator.Get(); orch != nil {
+		if orchStatus, err := orch.GetInstanceStatus(ctx, inst.Name); err == nil {
+			status = resolveStatus(inst, orchStatus)
+		}
+	}
+	switch {
+	case action == database.PowerActionStop && status == "running":
+		return powerAct
+	case action == database.PowerActionStop && (status == "stopped" || status == "stopping" || status == StatusHibernated):
+		return powerAlready
+	case action == database.PowerActionStart && (status == "stopped" || status == StatusHibernated):
+		return powerAct
+	case action == database.PowerActionStart && status == "running":
+		return powerAlready
+	}
+	return powerBusy
+}
+
+// instanceBusy reports whether another operation is under way on the
+// instance: a task or a wake. Migrations are excluded by the claim.
+func instanceBusy(id uint) bool {
+	wakeMu.Lock()
+	_, waking := wakes[id]
+	wakeMu.Unlock()
+	if waking {
+		return true
+	}
+	return TaskMgr != nil && len(TaskMgr.List(taskmanager.Filter{InstanceID: id, OnlyActive: true})) > 0
+}
+
+// startPowerTask starts or stops inst as a system task, so the run shows up
+// in the tasks list. ResourceID is the schedule ID. The instance's claim is
+// released when the work ends.
+func startPowerTask(s database.PowerSchedule, inst database.Instance) {
+	taskType, title, work := taskmanager.TaskInstanceStop, "Stopping instance %s", powerStopInstance
+	if s.Action == database.PowerActionStart {
+		taskType, title, work = taskmanager.TaskInstanceStart, "Starting instance %s", powerStartInstance
+	}
+	if TaskMgr == nil {
+		go func() {
+			defer releaseInstance(inst.ID)
+			if err := work(context.Background(), inst); err != nil {
+				log.Printf("Power schedule %s: instance %s: %v", utils.SanitizeForLog(s.Name), utils.SanitizeForLog(inst.Name), err)
+			}
+		}()
+		return
+	}
+	TaskMgr.Start(taskmanager.StartOpts{
+		Type:         taskType,
+		InstanceID:   inst.ID,
+		ResourceID:   strconv.FormatUint(uint64(s.ID), 10),
+		ResourceName: inst.DisplayName,
+		Title:        fmt.Sprintf(title, inst.DisplayName),
+		Run: func(ctx context.Context, h *taskmanager.Handle) error {
+			defer releaseInstance(inst.ID)
+			h.UpdateMessage(fmt.Sprintf("Power schedule %q", s.Name))
+			return work(ctx, inst)
+		},
+	})
+}
+
+// powerStopInstance stops inst the way the Stop button does.
+func powerStopInstance(ctx context.Context, inst database.Instance) error {
+	if err := stopInstanceWorkload(ctx, &inst); err != nil {
+		return err
+	}
+	return database.DB.Model(&inst).Updates(map[string]interface{}{
+		"status":     "stopping",
+		"updated_at": time.Now().UTC(),
+	}).Error
+}
+
+// powerStartInstance starts inst, waking it if it is hibernated, and waits
+// until it is running.
+func powerStartInstance(ctx context.Context, inst database.Instance) error {
+	if inst.Status == StatusHibernated {
+		return WakeInstance(ctx, &inst)
+	}
+	orch := orchestrator.Get()
+	if orch == nil {
+		return errors.New("no orchestrator available")
+	}
+	if err := orch.StartInstance(ctx, inst.Name); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if err := database.DB.Model(&inst).Updates(map[string]interface{}{
+		"status":     "running",
+		"updated_at": time.Now().UTC(),
+	}).Error; err != nil {
+		return err
+	}
+	if !waitForRunning(ctx, orch, inst.Name, wakeTimeout) {
+		return errors.New("instance did not become ready")
+	}
+	return nil
+}
+
+type powerScheduleResponse struct {
+	database.PowerSchedule
+	InstanceIDs []uint `json:"instance_ids"`
+	TeamIDs     []uint `json:"team_ids"`
+}
+
+func powerScheduleToResponse(s database.PowerSchedule) powerScheduleResponse {
+	return powerScheduleResponse{
+		PowerSchedule: s,
+		InstanceIDs:   database.ParseTeamIDs(s.InstanceIDs),
+		TeamIDs:       database.ParseTeamIDs(s.TeamIDs),
+	}
+}
+
+// powerScheduleAuditState drops the run bookkeeping, which is not a setting.
+func powerScheduleAuditState(resp powerScheduleResponse) powerScheduleResponse {
+	resp.LastResult = ""
+	resp.LastRunAt = nil
+	resp.NextRunAt = nil
+	return resp
+}
+
+// ListPowerSchedules handles GET /api/v1/power-schedules.
+func ListPowerSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := database.ListPowerSchedules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list power schedules")
+		return
+	}
+	out := make([]powerScheduleResponse, len(schedules))
+	for i, s := range schedules {
+		out[i] = powerScheduleToResponse(s)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// powerScheduleRequest is the body for create and update. On update every
+// nil field keeps its stored value.
+type powerScheduleRequest struct {
+	Name           *string `json:"name"`
+	Action         *string `json:"action"`
+	CronExpression *string `json:"cron_expression"`
+	InstanceIDs    *[]uint `json:"instance_ids"`
+	TeamIDs        *[]uint `json:"team_ids"`
+	Enabled        *bool   `json:"enabled"`
+}
+
+// apply validates body against s and copies the set fields into it.
+func (body *powerScheduleRequest) apply(s *database.PowerSchedule) string {
+	if body.Name != nil {
+		s.Name = strings.TrimSpace(*body.Name)
+	}
+	if s.Name == "" {
+		return "name is required"
+	}
+	if body.Action != nil {
+		s.Action = *body.Action
+	}
+	if s.Action != database.PowerActionStart && s.Action != database.PowerActionStop {
+		return "action must be start or stop"
+	}
+	if body.CronExpression != nil {
+		s.CronExpression = strings.TrimSpace(*body.CronExpression)
+	}
+	if _, err := backup.ComputeNextRun(s.CronExpression); err != nil {
+		return "Invalid cron expression: " + err.Error()
+	}
+	if body.InstanceIDs != nil {
+		var n int64
+		database.DB.Model(&database.Instance{}).Where("id IN ?", *body.InstanceIDs).Count(&n)
+		if len(*body.InstanceIDs) > 0 && int(n) != len(*body.InstanceIDs) {
+			return "instance_ids contains an unknown instance"
+		}
+		s.InstanceIDs = database.EncodeTeamIDs(*body.InstanceIDs)
+	}
+	if body.TeamIDs != nil {
+		var n int64
+		database.DB.Model(&database.Team{}).Where("id IN ?", *body.TeamIDs).Count(&n)
+		if len(*body.TeamIDs) > 0 && int(n) != len(*body.TeamIDs) {
+			return "team_ids contains an unknown team"
+		}
+		s.TeamIDs = database.EncodeTeamIDs(*body.TeamIDs)
+	}
+	if len(database.ParseTeamIDs(s.InstanceIDs)) == 0 && len(database.ParseTeamIDs(s.TeamIDs)) == 0 {
+		return "instance_ids or team_ids is required"
+	}
+	if body.Enabled != nil {
+		s.Enabled = *body.Enabled
+	}
+	s.NextRunAt = nil
+	if s.Enabled {
+		next, _ := backup.ComputeNextRun(s.CronExpression)
+		s.NextRunAt = &next
+	}
+	return ""
+}
+
+// CreatePowerSchedule handles POST /api/v1/power-schedules. New schedules
+// are enabled unless the body says otherwise.
+func CreatePowerSchedule(w http.ResponseWriter, r *http.Request) {
+	var body powerScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	s := database.PowerSchedule{Enabled: true, InstanceIDs: "[]", TeamIDs: "[]"}
+	if msg := body.apply(&s); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := database.DB.Create(&s).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create power schedule")
+		return
+	}
+
+	resp := powerScheduleToResponse(s)
+	audit.SetAction(r, "power_schedule.create")
+	audit.SetTarget(r, "power_schedule", s.ID, s.Name)
+	audit.SetChange(r, nil, powerScheduleAuditState(resp))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// UpdatePowerSchedule handles PUT /api/v1/power-schedules/{id}. Changing the
+// cron expression or enabling the schedule recomputes its next run.
+func UpdatePowerSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := loadPowerSchedule(w, r)
+	if !ok {
+		return
+	}
+	var body powerScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	before := powerScheduleToResponse(*s)
+	if msg := body.apply(s); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := database.DB.Model(s).Select("name", "action", "cron_expression", "instance_ids", "team_ids", "enabled", "next_run_at").
+		Updates(s).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update power schedule")
+		return
+	}
+
+	updated, _ := database.GetPowerSchedule(s.ID)
+	resp := powerScheduleToResponse(*updated)
+	audit.SetAction(r, "power_schedule.update")
+	audit.SetTarget(r, "power_schedule", s.ID, s.Name)
+	audit.SetChange(r, powerScheduleAuditState(before), powerScheduleAuditState(resp))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeletePowerSchedule handles DELETE /api/v1/power-schedules/{id}. Tasks
+// already started by the schedule run to completion.
+func DeletePowerSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := loadPowerSchedule(w, r)
+	if !ok {
+		return
+	}
+	if err := database.DB.Delete(s).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete power schedule")
+		return
+	}
+
+	audit.SetAction(r, "power_schedule.delete")
+	audit.SetTarget(r, "power_schedule", s.ID, s.Name)
+	audit.SetChange(r, powerScheduleAuditState(powerScheduleToResponse(*s)), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadPowerSchedule(w http.ResponseWriter, r *http.Request) (*database.PowerSchedule, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid schedule ID")
+		return nil, false
+	}
+	s, err := database.GetPowerSchedule(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Power schedule not found")
+		return nil, false
+	}
+	return s, true
+}
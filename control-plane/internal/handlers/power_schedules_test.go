@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+)
+
+func setupPowerScheduleTest(t *testing.T) (*hibernationBackend, *taskmanager.Manager) {
+	t.Helper()
+	orch := setupHibernationTest(t)
+	if err := database.DB.AutoMigrate(&database.PowerSchedule{}); err != nil {
+		t.Fatalf("automigrate power schedules: %v", err)
+	}
+	return orch, withTaskMgr(t)
+}
+
+func createPowerSchedule(t *testing.T, s database.PowerSchedule) database.PowerSchedule {
+	t.Helper()
+	due := time.Now().UTC().Add(-time.Minute)
+	s.CronExpression = "0 18 * * 1-5"
+	s.Enabled = true
+	s.NextRunAt = &due
+	if err := database.DB.Create(&s).Error; err != nil {
+		t.Fatalf("create power schedule: %v", err)
+	}
+	return s
+}
+
+func waitForPowerTasks(t *testing.T, tm *taskmanager.Manager, taskType taskmanager.TaskType) []taskmanager.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tm.List(taskmanager.Filter{Type: taskType, OnlyActive: true})) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("power tasks did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return tm.List(taskmanager.Filter{Type: taskType})
+}
+
+func TestExecuteDuePowerSchedules_StopsTeamAndSkipsBusy(t *testing.T) {
+	orch, tm := setupPowerScheduleTest(t)
+	database.DB.Create(&database.Team{Name: "default"})
+	team := database.Team{Name: "ops"}
+	database.DB.Create(&team)
+
+	running := database.Instance{Name: "bot-running", DisplayName: "Running", Status: "running", TeamID: team.ID}
+	stopped := database.Instance{Name: "bot-stopped", DisplayName: "Stopped", Status: "stopped", TeamID: team.ID}
+	migrating := database.Instance{Name: "bot-migrating", DisplayName: "Migrating", Status: "running", TeamID: team.ID}
+	explicit := createTestInstance(t, "bot-explicit", "Explicit")
+	other := createTestInstance(t, "bot-other", "Other")
+	for _, inst := range []*database.Instance{&running, &stopped, &migrating} {
+		database.DB.Create(inst)
+	}
+	orch.stopped[stopped.Name] = true
+	claimInstance(migrating.ID, opMigration)
+	t.Cleanup(func() { releaseInstance(migrating.ID) })
+
+	s := createPowerSchedule(t, database.PowerSchedule{
+		Name:        "evening",
+		Action:      database.PowerActionStop,
+		InstanceIDs: database.EncodeTeamIDs([]uint{explicit.ID}),
+		TeamIDs:     database.EncodeTeamIDs([]uint{team.ID}),
+	})
+
+	executeDuePowerSchedules(context.Background(), time.Now().UTC())
+	tasks := waitForPowerTasks(t, tm, taskmanager.TaskInstanceStop)
+
+	for name, want := range map[string]bool{running.Name: true, explicit.Name: true, migrating.Name: false, other.Name: false} {
+		if orch.stopped[name] != want {
+			t.Errorf("%s: stopped = %v, want %v", name, orch.stopped[name], want)
+		}
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("tasks = %d, want 2", len(tasks))
+	}
+	for _, id := range []uint{running.ID, explicit.ID, stopped.ID} {
+		if holder, held := instanceOps.Load(id); held {
+			t.Errorf("instance %d still claimed by %v after its power task", id, holder)
+		}
+	}
+	for _, task := range tasks {
+		if task.State != taskmanager.StateSucceeded || task.ResourceID != fmt.Sprint(s.ID) || task.UserID != 0 {
+			t.Errorf("task %+v: want a succeeded system task for schedule %d", task, s.ID)
+		}
+	}
+
+	got, _ := database.GetPowerSchedule(s.ID)
+	if want := "stopped 2 of 4 instance(s); 1 already stopped, 1 busy"; got.LastResult != want {
+		t.Errorf("last_result = %q, want %q", got.LastResult, want)
+	}
+	if got.LastRunAt == nil || got.NextRunAt == nil || !got.NextRunAt.After(time.Now()) {
+		t.Errorf("run times not advanced: last %v, next %v", got.LastRunAt, got.NextRunAt)
+	}
+}
+
+func TestExecuteDuePowerSchedules_StartWakesHibernated(t *testing.T) {
+	orch, tm := setupPowerScheduleTest(t)
+	sleepy := createTestInstance(t, "bot-sleepy", "Sleepy")
+	if err := hibernateInstance(context.Background(), &sleepy); err != nil {
+		t.Fatalf("hibernate: %v", err)
+	}
+	stopped := database.Instance{Name: "bot-stopped", DisplayName: "Stopped", Status: "stopped"}
+	database.DB.Create(&stopped)
+	orch.stopped[stopped.Name] = true
+
+	createPowerSchedule(t, database.PowerSchedule{
+		Name:        "morning",
+		Action:      database.PowerActionStart,
+		InstanceIDs: database.EncodeTeamIDs([]uint{sleepy.ID, stopped.ID}),
+	})
+
+	executeDuePowerSchedules(context.Background(), time.Now().UTC())
+	waitForPowerTasks(t, tm, taskmanager.TaskInstanceStart)
+
+	var instances []database.Instance
+	database.DB.Find(&instances)
+	for _, inst := range instances {
+		if inst.Status != "running" {
+			t.Errorf("%s: status = %q, want running", inst.Name, inst.Status)
+		}
+	}
+	if orch.starts != 2 {
+		t.Errorf("starts = %d, want 2", orch.starts)
+	}
+}
+
+func TestExecuteDuePowerSchedules_IgnoresDisabled(t *testing.T) {
+	orch, _ := setupPowerScheduleTest(t)
+	inst := createTestInstance(t, "bot-running", "Running")
+	s := createPowerSchedule(t, database.PowerSchedule{
+		Name:        "off",
+		Action:      database.PowerActionStop,
+		InstanceIDs: database.EncodeTeamIDs([]uint{inst.ID}),
+	})
+	database.DB.Model(&s).Update("enabled", false)
+
+	executeDuePowerSchedules(context.Background(), time.Now().UTC())
+
+	if orch.stopped[inst.Name] {
+		t.Error("a disabled schedule must not run")
+	}
+}
+
+func TestCreatePowerSchedule_Validation(t *testing.T) {
+	setupPowerScheduleTest(t)
+	inst := createTestInstance(t, "bot-running", "Running")
+
+	for _, tc := range []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"bad action", map[string]interface{}{"name": "x", "action": "pause", "cron_expression": "0 9 * * *", "instance_ids": []uint{inst.ID}}, http.StatusBadRequest},
+		{"bad cron", map[string]interface{}{"name": "x", "action": "start", "cron_expression": "nine am", "instance_ids": []uint{inst.ID}}, http.StatusBadRequest},
+		{"no targets", map[string]interface{}{"name": "x", "action": "start", "cron_expression": "0 9 * * *"}, http.StatusBadRequest},
+		{"unknown instance", map[string]interface{}{"name": "x", "action": "start", "cron_expression": "0 9 * * *", "instance_ids": []uint{999}}, http.StatusBadRequest},
+		{"ok", map[string]interface{}{"name": "x", "action": "start", "cron_expression": "CRON_TZ=Europe/Berlin 0 9 * * 1-5", "instance_ids": []uint{inst.ID}}, http.StatusCreated},
+	} {
+		w := httptest.NewRecorder()
+		CreatePowerSchedule(w, notificationRequest("POST", "/api/v1/power-schedules", nil, tc.body))
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.name, w.Code, tc.want, w.Body.String())
+		}
+	}
+
+	schedules, _ := database.ListPowerSchedules()
+	if len(schedules) != 1 || !schedules[0].Enabled || schedules[0].NextRunAt == nil {
+		t.Fatalf("schedules = %+v, want one enabled schedule with a next run", schedules)
+	}
+
+	w := httptest.NewRecorder()
+	id := fmt.Sprint(schedules[0].ID)
+	UpdatePowerSchedule(w, notificationRequest("PUT", "/api/v1/power-schedules/"+id, map[string]string{"id": id}, map[string]interface{}{"enabled": false}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable: status = %d (%s)", w.Code, w.Body.String())
+	}
+	got, _ := database.GetPowerSchedule(schedules[0].ID)
+	if got.Enabled || got.NextRunAt != nil {
+		t.Errorf("disabled schedule: enabled %v, next run %v", got.Enabled, got.NextRunAt)
+	}
+}
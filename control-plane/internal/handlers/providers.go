@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
@@ -297,6 +298,13 @@ type providerRequest struct {
 	APIKey     string                   `json:"api_key"`
 	InstanceID *uint                    `json:"instance_id,omitempty"` // non-nil = instance-specific provider
 	OAuth      *providerOAuthRequest    `json:"oauth,omitempty"`       // present for openai-codex-responses create/reconnect
+
+	// ClientAPIType is the API type declared to OpenClaw when the gateway
+	// should translate to api_type. Pointer so updates can clear it with "".
+	ClientAPIType *string `json:"client_api_type,omitempty"`
+
+	// CacheTTLSeconds enables the gateway response cache; 0 disables it.
+	CacheTTLSeconds *int `json:"cache_ttl_seconds,omitempty"`
 }
 
 // providerOAuthRequest carries the client-side PKCE verifier and the redirect
@@ -343,6 +351,8 @@ type providerResp struct {
 	Name           string                   `json:"name"`
 	BaseURL        string                   `json:"base_url"`
 	APIType        string                   `json:"api_type"`
+	ClientAPIType  string                   `json:"client_api_type,omitempty"`
+	CacheTTL       int                      `json:"cache_ttl_seconds"`
 	MaskedAPIKey   string                   `json:"masked_api_key"`
 	Models         []database.ProviderModel `json:"models"`
 	OAuthConnected bool                     `json:"oauth_connected"`
@@ -352,6 +362,18 @@ type providerResp struct {
 	UpdatedAt      string                   `json:"updated_at"`
 }
 
+// validateClientAPIType checks that the gateway can translate between the
+// API type OpenClaw will speak and the provider's upstream API type.
+func validateClientAPIType(clientAPIType, apiType string) error {
+	if clientAPIType == "" {
+		return nil
+	}
+	if !llmgateway.CanTranslate(clientAPIType, apiType) {
+		return fmt.Errorf("client_api_type %s cannot be translated to api_type %s", clientAPIType, apiType)
+	}
+	return nil
+}
+
 func toProviderResp(p database.LLMProvider) providerResp {
 	var masked string
 	if p.APIKey != "" {
@@ -367,6 +389,8 @@ func toProviderResp(p database.LLMProvider) providerResp {
 		Name:           p.Name,
 		BaseURL:        p.BaseURL,
 		APIType:        p.APIType,
+		ClientAPIType:  p.ClientAPIType,
+		CacheTTL:       p.CacheTTLSeconds,
 		MaskedAPIKey:   masked,
 		Models:         database.ParseProviderModels(p.Models),
 		OAuthConnected: p.OAuthRefreshToken != "" && p.OAuthExpiresAt > 0,
@@ -412,6 +436,27 @@ func ListInstanceProviders(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
+// providerAuditState is the audited view of a provider: the model plus the
+// encrypted credentials it hides from JSON, so that key edits show up in the
+// diff (audit.Diff redacts their values).
+type providerAuditState struct {
+	database.LLMProvider
+	APIKey            string `json:"api_key"`
+	Models            string `json:"models"`
+	OAuthAccessToken  string `json:"oauth_access_token"`
+	OAuthRefreshToken string `json:"oauth_refresh_token"`
+}
+
+func newProviderAuditState(p database.LLMProvider) providerAuditState {
+	return providerAuditState{
+		LLMProvider:       p,
+		APIKey:            p.APIKey,
+		Models:            p.Models,
+		OAuthAccessToken:  p.OAuthAccessToken,
+		OAuthRefreshToken: p.OAuthRefreshToken,
+	}
+}
+
 func CreateProvider(w http.ResponseWriter, r *http.Request) {
 	var body providerRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -456,6 +501,20 @@ func CreateProvider(w http.ResponseWriter, r *http.Request) {
 		APIType:  apiType,
 		Models:   string(modelsJSON),
 	}
+	if body.ClientAPIType != nil {
+		p.ClientAPIType = *body.ClientAPIType
+	}
+	if err := validateClientAPIType(p.ClientAPIType, p.APIType); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.CacheTTLSeconds != nil {
+		if *body.CacheTTLSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "cache_ttl_seconds must be >= 0")
+			return
+		}
+		p.CacheTTLSeconds = *body.CacheTTLSeconds
+	}
 	if apiKey := strings.TrimSpace(body.APIKey); apiKey != "" {
 		encrypted, err := utils.Encrypt(apiKey)
 		if err != nil {
@@ -493,6 +552,9 @@ func CreateProvider(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusConflict, "Provider key already exists")
 		return
 	}
+	audit.SetAction(r, "provider.create")
+	audit.SetTarget(r, "provider", p.ID, p.Key)
+	audit.SetChange(r, nil, newProviderAuditState(p))
 
 	var totalProviders int64
 	database.DB.Model(&database.LLMProvider{}).Count(&totalProviders)
@@ -538,6 +600,10 @@ func UpdateProvider(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	audit.SetAction(r, "provider.update")
+	audit.SetTarget(r, "provider", p.ID, p.Key)
+	before := newProviderAuditState(p)
+
 	var body providerRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -553,6 +619,20 @@ func UpdateProvider(w http.ResponseWriter, r *http.Request) {
 	if body.APIType != "" {
 		p.APIType = body.APIType
 	}
+	if body.ClientAPIType != nil {
+		p.ClientAPIType = *body.ClientAPIType
+	}
+	if err := validateClientAPIType(p.ClientAPIType, p.APIType); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.CacheTTLSeconds != nil {
+		if *body.CacheTTLSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "cache_ttl_seconds must be >= 0")
+			return
+		}
+		p.CacheTTLSeconds = *body.CacheTTLSeconds
+	}
 	if body.Models != nil {
 		modelsJSON, _ := json.Marshal(body.Models)
 		p.Models = string(modelsJSON)
@@ -586,7 +666,10 @@ func UpdateProvider(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "Failed to update provider")
 		return
 	}
+	audit.SetChange(r, before, newProviderAuditState(p))
 
+	// Cached responses may depend on the old URL, models or credentials.
+	llmgateway.ClearResponseCache(p.ID)
 	pushProviderUpdateToInstances(uint(id))
 	writeJSON(w, http.StatusOK, toProviderResp(p))
 }
@@ -837,11 +920,19 @@ func DeleteProvider(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	audit.SetAction(r, "provider.delete")
+	audit.SetTarget(r, "provider", p.ID, p.Key)
+	audit.SetChange(r, newProviderAuditState(p), nil)
+
 	ownerInstanceID := p.InstanceID
 
-	// Cascade-delete gateway keys (API key is on the provider row itself)
+	// Cascade-delete gateway keys (API key is on the provider row itself) and
+	// any fallback chains this provider was the primary for. Hops pointing at
+	// it elsewhere are skipped by the gateway once the row is gone.
 	database.DB.Where("provider_id = ?", id).Delete(&database.LLMGatewayKey{})
+	database.DB.Where("provider_id = ?", id).Delete(&database.LLMFallbackChain{})
 	database.DB.Delete(&p)
+	llmgateway.ClearResponseCache(p.ID)
 
 	var remaining int64
 	database.DB.Model(&database.LLMProvider{}).Count(&remaining)
@@ -909,6 +1000,10 @@ type UsageTotals struct {
 	CachedInputTokens int64   `json:"cached_input_tokens"`
 	OutputTokens      int64   `json:"output_tokens"`
 	CostUSD           float64 `json:"cost_usd"`
+	// CacheHits counts requests answered from the gateway response cache;
+	// SavedCostUSD is what they would have cost upstream.
+	CacheHits    int     `json:"cache_hits"`
+	SavedCostUSD float64 `json:"saved_cost_usd"`
 }
 
 type UsageInstanceInfo struct {
@@ -939,6 +1034,10 @@ type UsageStatsResponse struct {
 	Providers   []UsageProviderInfo `json:"providers"`
 	Teams       []UsageTeamInfo     `json:"teams"`
 	Granularity string              `json:"granularity"`
+
+	// RateLimits is the live state of every gateway rate limit. It is not
+	// affected by the date range or filters.
+	RateLimits []llmgateway.RateLimitStatus `json:"rate_limits"`
 }
 
 func GetUsageStats(w http.ResponseWriter, r *http.Request) {
@@ -1047,10 +1146,12 @@ func GetUsageStats(w http.ResponseWriter, r *http.Request) {
 		OutputTokens      int64
 		CostUSD           float64
 		RequestedAt       time.Time
+		CacheHit          bool
+		SavedCostUSD      float64
 	}
 	var rawRows []rawRow
 	if err := query.
-		Select("instance_id, provider_id, model_id, input_tokens, cached_input_tokens, output_tokens, cost_usd, requested_at").
+		Select("instance_id, provider_id, model_id, input_tokens, cached_input_tokens, output_tokens, cost_usd, requested_at, cache_hit, saved_cost_usd").
 		Scan(&rawRows).Error; err != nil {
 		writeError(w, http.StatusInternalServerError, "query usage logs: "+err.Error())
 		return
@@ -1063,6 +1164,8 @@ func GetUsageStats(w http.ResponseWriter, r *http.Request) {
 		CachedInputTokens int64
 		OutputTokens      int64
 		CostUSD           float64
+		CacheHits         int
+		SavedCostUSD      float64
 	}
 	addAgg := func(a *aggRow, r *rawRow) {
 		a.TotalRequests++
@@ -1070,6 +1173,10 @@ func GetUsageStats(w http.ResponseWriter, r *http.Request) {
 		a.CachedInputTokens += r.CachedInputTokens
 		a.OutputTokens += r.OutputTokens
 		a.CostUSD += r.CostUSD
+		if r.CacheHit {
+			a.CacheHits++
+			a.SavedCostUSD += r.SavedCostUSD
+		}
 	}
 
 	byInstance := map[uint]*aggRow{}
@@ -1151,6 +1258,8 @@ func GetUsageStats(w http.ResponseWriter, r *http.Request) {
 		resp.Total.CachedInputTokens += agg.CachedInputTokens
 		resp.Total.OutputTokens += agg.OutputTokens
 		resp.Total.CostUSD += agg.CostUSD
+		resp.Total.CacheHits += agg.CacheHits
+		resp.Total.SavedCostUSD += agg.SavedCostUSD
 	}
 	sort.Slice(resp.ByInstance, func(i, j int) bool {
 		return resp.ByInstance[i].CostUSD > resp.ByInstance[j].CostUSD
@@ -1218,6 +1327,10 @@ func GetUsageStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp.Granularity = granularity
+	resp.RateLimits, _ = listRateLimitStatuses()
+	if resp.RateLimits == nil {
+		resp.RateLimits = []llmgateway.RateLimitStatus{}
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -1305,6 +1418,14 @@ type usageLogResponse struct {
 	LatencyMs         int64   `json:"latency_ms"`
 	ErrorMessage      string  `json:"error_message,omitempty"`
 	RequestedAt       string  `json:"requested_at"`
+	// RequestedProviderID is the provider behind the virtual key; it differs
+	// from ProviderID when a fallback hop served the request.
+	RequestedProviderID uint `json:"requested_provider_id"`
+	FallbackHop         int  `json:"fallback_hop"`
+	// CacheHit marks a response served from the gateway cache; SavedCostUSD
+	// is the upstream cost it avoided.
+	CacheHit     bool    `json:"cache_hit"`
+	SavedCostUSD float64 `json:"saved_cost_usd"`
 }
 
 func GetUsageLogs(w http.ResponseWriter, r *http.Request) {
@@ -1364,19 +1485,26 @@ func GetUsageLogs(w http.ResponseWriter, r *http.Request) {
 	result := make([]usageLogResponse, len(logs))
 	for i, l := range logs {
 		result[i] = usageLogResponse{
-			ID:                l.ID,
-			InstanceID:        l.InstanceID,
-			ProviderID:        l.ProviderID,
-			ProviderKey:       providerKeys[l.ProviderID],
-			ModelID:           l.ModelID,
-			InputTokens:       l.InputTokens,
-			OutputTokens:      l.OutputTokens,
-			CachedInputTokens: l.CachedInputTokens,
-			CostUSD:           l.CostUSD,
-			StatusCode:        l.StatusCode,
-			LatencyMs:         l.LatencyMs,
-			ErrorMessage:      l.ErrorMessage,
-			RequestedAt:       formatTimestamp(l.RequestedAt),
+			ID:                  l.ID,
+			InstanceID:          l.InstanceID,
+			ProviderID:          l.ProviderID,
+			ProviderKey:         providerKeys[l.ProviderID],
+			ModelID:             l.ModelID,
+			InputTokens:         l.InputTokens,
+			OutputTokens:        l.OutputTokens,
+			CachedInputTokens:   l.CachedInputTokens,
+			CostUSD:             l.CostUSD,
+			StatusCode:          l.StatusCode,
+			LatencyMs:           l.LatencyMs,
+			ErrorMessage:        l.ErrorMessage,
+			RequestedAt:         formatTimestamp(l.RequestedAt),
+			RequestedProviderID: l.RequestedProviderID,
+			FallbackHop:         l.FallbackHop,
+			CacheHit:            l.CacheHit,
+			SavedCostUSD:        l.SavedCostUSD,
+		}
+		if result[i].RequestedProviderID == 0 {
+			result[i].RequestedProviderID = l.ProviderID
 		}
 	}
 	writeJSON(w, http.StatusOK, result)
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func postProvider(t *testing.T, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/api/v1/llm/providers", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	CreateProvider(w, req)
+	return w
+}
+
+func TestCreateProvider_ClientAPIType(t *testing.T) {
+	setupProvidersTestDB(t)
+
+	w := postProvider(t, map[string]interface{}{
+		"key":             "claude",
+		"name":            "Claude",
+		"base_url":        "https://api.anthropic.com",
+		"api_type":        "anthropic-messages",
+		"client_api_type": "openai-completions",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body.String())
+	}
+	var resp providerResp
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ClientAPIType != "openai-completions" {
+		t.Errorf("client_api_type = %q", resp.ClientAPIType)
+	}
+	var p database.LLMProvider
+	database.DB.First(&p, "key = ?", "claude")
+	if p.ClientAPIType != "openai-completions" {
+		t.Errorf("stored client_api_type = %q", p.ClientAPIType)
+	}
+}
+
+func TestCreateProvider_UntranslatableClientAPIType(t *testing.T) {
+	setupProvidersTestDB(t)
+
+	w := postProvider(t, map[string]interface{}{
+		"key":             "local",
+		"name":            "Local",
+		"base_url":        "http://localhost:11434",
+		"api_type":        "ollama",
+		"client_api_type": "openai-completions",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body=%s", w.Code, w.Body.String())
+	}
+	var count int64
+	database.DB.Model(&database.LLMProvider{}).Count(&count)
+	if count != 0 {
+		t.Errorf("provider rows = %d, want 0", count)
+	}
+}
+
+func TestUpdateProvider_ClearsClientAPIType(t *testing.T) {
+	setupProvidersTestDB(t)
+	p := database.LLMProvider{Key: "g", Name: "G", APIType: "google-generative-ai", ClientAPIType: "anthropic-messages"}
+	database.DB.Create(&p)
+
+	req := httptest.NewRequest("PUT", "/api/v1/llm/providers/x", bytes.NewReader([]byte(`{"client_api_type":""}`)))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", fmt.Sprint(p.ID))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	UpdateProvider(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body.String())
+	}
+	database.DB.First(&p, p.ID)
+	if p.ClientAPIType != "" {
+		t.Errorf("client_api_type = %q, want cleared", p.ClientAPIType)
+	}
+}
+
+func TestCreateProvider_CacheTTL(t *testing.T) {
+	setupProvidersTestDB(t)
+
+	w := postProvider(t, map[string]interface{}{
+		"key": "bad", "name": "Bad", "base_url": "https://api.openai.com", "cache_ttl_seconds": -1,
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("negative ttl: status = %d, want 400", w.Code)
+	}
+
+	w = postProvider(t, map[string]interface{}{
+		"key": "openai", "name": "OpenAI", "base_url": "https://api.openai.com", "cache_ttl_seconds": 300,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body.String())
+	}
+	var resp providerResp
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.CacheTTL != 300 {
+		t.Errorf("cache_ttl_seconds = %d, want 300", resp.CacheTTL)
+	}
+}
+
+func TestGetUsageStats_CacheSavings(t *testing.T) {
+	setupProvidersTestDB(t)
+	if err := database.DB.AutoMigrate(&database.LLMRequestLog{}); err != nil {
+		t.Fatalf("auto-migrate: %v", err)
+	}
+	database.LogsDB = database.DB
+	t.Cleanup(func() { database.LogsDB = nil })
+
+	now := time.Now().UTC()
+	database.LogsDB.Create(&database.LLMRequestLog{InstanceID: 1, ProviderID: 1, ModelID: "m", StatusCode: 200, CostUSD: 0.5, RequestedAt: now})
+	database.LogsDB.Create(&database.LLMRequestLog{InstanceID: 1, ProviderID: 1, ModelID: "m", StatusCode: 200, CacheHit: true, SavedCostUSD: 0.5, RequestedAt: now})
+	database.LogsDB.Create(&database.LLMRequestLog{InstanceID: 2, ProviderID: 1, ModelID: "m", StatusCode: 200, CacheHit: true, SavedCostUSD: 0.25, RequestedAt: now})
+
+	w := httptest.NewRecorder()
+	GetUsageStats(w, httptest.NewRequest("GET", "/api/v1/llm/usage", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d body=%s", w.Code, w.Body.String())
+	}
+	var resp UsageStatsResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Total.TotalRequests != 3 || resp.Total.CacheHits != 2 || resp.Total.CostUSD != 0.5 || resp.Total.SavedCostUSD != 0.75 {
+		t.Errorf("totals = %+v", resp.Total)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// Recordings is set from main.go when CLAWORC_TERMINAL_RECORDING_DIR is
+// configured; nil means terminal recording is disabled.
+var Recordings *sshterminal.Recordings
+
+// ListInstanceRecordings returns the web terminal and SSH gateway session
+// recordings of an instance, newest first.
+func ListInstanceRecordings(w http.ResponseWriter, r *http.Request) {
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return
+	}
+	recs, err := Recordings.List(inst.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list recordings")
+		return
+	}
+	if recs == nil {
+		recs = []sshterminal.RecordingInfo{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":    Recordings != nil,
+		"recordings": recs,
+	})
+}
+
+// openInstanceRecording opens the {recordingId} recording of the {id}
+// instance, writing the error response itself when it cannot.
+func openInstanceRecording(w http.ResponseWriter, r *http.Request) (io.ReadCloser, uint, string, bool) {
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return nil, 0, "", false
+	}
+	id := chi.URLParam(r, "recordingId")
+	f, err := Recordings.Open(inst.ID, id)
+	if errors.Is(err, sshterminal.ErrRecordingNotFound) {
+		writeError(w, http.StatusNotFound, "Recording not found")
+		return nil, 0, "", false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to open recording")
+		return nil, 0, "", false
+	}
+	return f, inst.ID, id, true
+}
+
+// DownloadInstanceRecording returns a recording as an asciicast v2 file.
+func DownloadInstanceRecording(w http.ResponseWriter, r *http.Request) {
+	f, instID, id, ok := openInstanceRecording(w, r)
+	if !ok {
+		return
+	}
+	defer f.Close()
+	auditLog(sshaudit.EventRecordingAccessed, instID, getUsername(r), fmt.Sprintf("downloaded, recording=%s", id))
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".cast"))
+	io.Copy(w, f)
+}
+
+// ReplayInstanceRecording streams a recording in real time: the header line
+// first, then each event line when its timestamp is reached. Query
+// parameters: speed (playback multiplier, default 1) and max_idle (longest
+// pause in seconds, default 2; 0 keeps original pauses).
+func ReplayInstanceRecording(w http.ResponseWriter, r *http.Request) {
+	speed := 1.0
+	if v := r.URL.Query().Get("speed"); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil || s <= 0 || s > 100 {
+			writeError(w, http.StatusBadRequest, "speed must be a number between 0 and 100")
+			return
+		}
+		speed = s
+	}
+	maxIdle := 2 * time.Second
+	if v := r.URL.Query().Get("max_idle"); v != "" {
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil || s < 0 {
+			writeError(w, http.StatusBadRequest, "max_idle must be a non-negative number of seconds")
+			return
+		}
+		maxIdle = time.Duration(s * float64(time.Second))
+	}
+
+	f, instID, id, ok := openInstanceRecording(w, r)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+	auditLog(sshaudit.EventRecordingAccessed, instID, getUsername(r), fmt.Sprintf("replayed, recording=%s", id))
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := sshterminal.Replay(r.Context(), f, w, speed, maxIdle, flusher.Flush); err != nil && r.Context().Err() == nil {
+		log.Printf("Recording replay %s failed: %v", id, err)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
+)
+
+func TestInstanceRecordings(t *testing.T) {
+	setupTestDB(t)
+	Recordings = sshterminal.NewRecordings(t.TempDir())
+	t.Cleanup(func() { Recordings = nil })
+	inst := createTestInstance(t, "bot-rec", "Rec")
+	other := createTestInstance(t, "bot-other", "Other")
+	user := createTestUser(t, "admin")
+
+	rec, err := Recordings.Start(sshterminal.RecordingMeta{
+		Source: sshterminal.RecordingSourceTerminal, InstanceID: inst.ID, SessionID: "abcdef12-3456", User: "admin",
+	}, "", 80, 24, nil)
+	if err != nil {
+		t.Fatalf("start recording: %v", err)
+	}
+	rec.Output([]byte("$ ls\r\n"))
+	rec.Close()
+
+	params := map[string]string{"id": fmt.Sprintf("%d", inst.ID)}
+	w := httptest.NewRecorder()
+	ListInstanceRecordings(w, buildRequest(t, "GET", "/", user, params))
+	var list struct {
+		Enabled    bool                        `json:"enabled"`
+		Recordings []sshterminal.RecordingInfo `json:"recordings"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || !list.Enabled || len(list.Recordings) != 1 || list.Recordings[0].ID != rec.ID {
+		t.Fatalf("list: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	params["recordingId"] = rec.ID
+	w = httptest.NewRecorder()
+	DownloadInstanceRecording(w, buildRequest(t, "GET", "/", user, params))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"o","$ ls\r\n"]`) {
+		t.Fatalf("download: status %d, body %s", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, rec.ID+".cast") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	w = httptest.NewRecorder()
+	ReplayInstanceRecording(w, buildRequest(t, "GET", "/?speed=10&max_idle=0.1", user, params))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 2 {
+		t.Fatalf("replay: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ReplayInstanceRecording(w, buildRequest(t, "GET", "/?speed=-1", user, params))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("replay with bad speed: status = %d, want 400", w.Code)
+	}
+
+	// A recording is only reachable through its own instance.
+	params["id"] = fmt.Sprintf("%d", other.ID)
+	w = httptest.NewRecorder()
+	DownloadInstanceRecording(w, buildRequest(t, "GET", "/", user, params))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("download via other instance: status = %d, want 404", w.Code)
+	}
+}
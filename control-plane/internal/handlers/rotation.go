@@ -6,11 +6,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/notify"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 	"github.com/gluk-w/claworc/control-plane/internal/sshkeys"
@@ -44,6 +46,7 @@ func RotateSSHKey(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result, err := sshkeys.RotateGlobalKeyPair(r.Context(), config.Cfg.DataPath, instances, orch, SSHMgr)
+	notifyRotation(result, err)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Key rotation failed: "+err.Error())
 		return
@@ -150,6 +153,7 @@ func checkAndRotateKeys(ctx context.Context) {
 	}
 
 	result, err := sshkeys.RotateGlobalKeyPair(ctx, config.Cfg.DataPath, instances, orch, SSHMgr)
+	notifyRotation(result, err)
 	if err != nil {
 		log.Printf("SSH key rotation job: rotation failed: %v", err)
 		return
@@ -176,3 +180,31 @@ func checkAndRotateKeys(ctx context.Context) {
 			result.OldFingerprint, result.NewFingerprint,
 			successCount, len(result.InstanceStatuses)))
 }
+
+// notifyRotation publishes ssh_key_rotation.failed when a rotation errored
+// or left some instances on the old key.
+func notifyRotation(result *sshkeys.RotationResult, err error) {
+	if err != nil {
+		notify.Publish(notify.Event{
+			Type:    notify.EventKeyRotationFailed,
+			Title:   "SSH key rotation failed",
+			Message: err.Error(),
+		})
+		return
+	}
+	if result == nil || result.FullSuccess {
+		return
+	}
+	var failed []string
+	for _, s := range result.InstanceStatuses {
+		if !s.Success {
+			failed = append(failed, fmt.Sprintf("%s: %s", s.Name, s.Error))
+		}
+	}
+	notify.Publish(notify.Event{
+		Type:    notify.EventKeyRotationFailed,
+		Title:   fmt.Sprintf("SSH key rotation failed on %d of %d instances", len(failed), len(result.InstanceStatuses)),
+		Message: strings.Join(failed, "\n"),
+		Details: map[string]string{"new_fingerprint": result.NewFingerprint},
+	})
+}
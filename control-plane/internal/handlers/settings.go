@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
 )
@@ -35,6 +38,11 @@ var plainSettings = []string{
 	"default_user_agent",
 	"default_models",
 	"analytics_consent",
+	database.Require2FARolesSetting,
+	database.GatewayPortForwardingSetting,
+	database.TerminalRecordingRetentionSetting,
+	database.TerminalRecordingInputSetting,
+	database.AuditRetentionSetting,
 }
 
 func getAllSettings() map[string]string {
@@ -140,6 +148,11 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	audit.SetAction(r, "settings.update")
+	audit.SetTarget(r, "settings", "", "")
+	before := getAllSettings()
+	defer func() { audit.SetChange(r, before, getAllSettings()) }()
+
 	resourceFromRaw := func(key string) string {
 		if v, ok := raw[key]; ok {
 			if s, ok := v.(string); ok {
@@ -260,6 +273,29 @@ func UpdateSettings(w http.ResponseWriter, r *http.Request) {
 				database.SetSetting(key, strVal)
 				continue
 			}
+			if key == database.Require2FARolesSetting {
+				roles, ok := normalizeRequire2FARoles(strVal)
+				if !ok {
+					writeError(w, http.StatusBadRequest, "require_2fa_roles may only list 'admin' and 'user'")
+					return
+				}
+				strVal = roles
+			}
+			if (key == database.GatewayPortForwardingSetting || key == database.TerminalRecordingInputSetting) &&
+				strVal != "true" && strVal != "false" {
+				writeError(w, http.StatusBadRequest, key+" must be 'true' or 'false'")
+				return
+			}
+			if key == database.TerminalRecordingRetentionSetting || key == database.AuditRetentionSetting {
+				d, err := strconv.Atoi(strVal)
+				if err != nil || d < 0 {
+					writeError(w, http.StatusBadRequest, key+" must be a non-negative number of days")
+					return
+				}
+				if key == database.AuditRetentionSetting && AuditEvents != nil {
+					AuditEvents.SetRetentionDays(d)
+				}
+			}
 			database.SetSetting(key, strVal)
 		}
 	}
@@ -328,3 +364,22 @@ func parseEnvVarsDelta(raw map[string]interface{}) (map[string]string, []string,
 	}
 	return set, unset, nil
 }
+
+// normalizeRequire2FARoles validates a comma-separated role list for the
+// require_2fa_roles setting and returns it trimmed and deduplicated.
+func normalizeRequire2FARoles(raw string) (string, bool) {
+	var out []string
+	seen := map[string]bool{}
+	for _, r := range strings.Split(raw, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		if r != "admin" && r != "user" {
+			return "", false
+		}
+		seen[r] = true
+		out = append(out, r)
+	}
+	return strings.Join(out, ","), true
+}
@@ -313,3 +313,26 @@ func TestUpdateSettings_EnvVars_NoOpSetSkipsRestart(t *testing.T) {
 		t.Errorf("no-op save must not restart anyone: %v", resp["restarting_instances"])
 	}
 }
+
+func TestUpdateSettings_GatewayPortForwarding(t *testing.T) {
+	setupSettingsTest(t)
+
+	w := httptest.NewRecorder()
+	UpdateSettings(w, postJSON("/api/v1/settings", map[string]string{
+		database.GatewayPortForwardingSetting: "yes",
+	}))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	UpdateSettings(w, postJSON("/api/v1/settings", map[string]string{
+		database.GatewayPortForwardingSetting: "true",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !database.GatewayPortForwardingEnabled() {
+		t.Error("port forwarding not enabled")
+	}
+}
@@ -101,14 +101,14 @@ func pathWithinAllowlist(p string, allowed []string) bool {
 }
 
 // ensureHostPathDir creates the host bind-mount source directory (recursively)
-// if it does not yet exist. It only applies to the Docker backend, where the
-// control plane shares the host filesystem; on Kubernetes the path lives on the
-// node and is created/managed there. The caller must have already validated the
+// if it does not yet exist. It only applies to a Docker default backend, where
+// the control plane shares the host filesystem; on Kubernetes or a placement
+// target the path lives on that node or host and is created/managed there. The caller must have already validated the
 // path against the allowlist. Returns ok=false with a user-facing message if the
 // directory cannot be created or is occupied by a non-directory.
 func ensureHostPathDir(hostPath string) (ok bool, msg string) {
-	orch := orchestrator.Get()
-	if orch == nil || orch.BackendName() != "docker" {
+	orch, err := orchestrator.ForTarget("")
+	if err != nil || orch.BackendName() != "docker" {
 		return true, ""
 	}
 	if info, err := os.Stat(hostPath); err == nil {
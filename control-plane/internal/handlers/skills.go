@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
@@ -819,6 +820,14 @@ func DeploySkill(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	audit.SetAction(r, "skill.deploy")
+	audit.SetTarget(r, "skill", slug, slug)
+	audit.SetChange(r, nil, map[string]interface{}{
+		"instance_ids": req.InstanceIDs,
+		"source":       req.Source,
+		"version":      req.Version,
+	})
+
 	fileMap, err := buildSkillFileMap(r.Context(), slug, req.Source, req.Version)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "Failed to load skill: "+err.Error())
@@ -866,40 +875,44 @@ func DeploySkill(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for _, instID := range req.InstanceIDs {
-		instanceID := instID
-		var displayName, instanceLabel string
-		var inst database.Instance
-		if err := database.DB.Select("display_name").First(&inst, instanceID).Error; err == nil {
-			displayName = fmt.Sprintf("%s — %s", inst.DisplayName, slug)
-			instanceLabel = inst.DisplayName
-		} else {
-			displayName = fmt.Sprintf("instance %d — %s", instanceID, slug)
-			instanceLabel = fmt.Sprintf("instance %d", instanceID)
-		}
-		taskID := TaskMgr.Start(taskmanager.StartOpts{
-			Type:         taskmanager.TaskSkillDeploy,
-			InstanceID:   instanceID,
-			UserID:       callerID(r),
-			ResourceID:   slug,
-			ResourceName: displayName,
-			Title:        fmt.Sprintf("Deploying %s to %s", slug, instanceLabel),
-			Run: func(ctx context.Context, h *taskmanager.Handle) error {
-				h.UpdateMessage("uploading skill files")
-				result := deployToInstance(instanceID, slug, fileMap)
-				if result.Status != "ok" {
-					if result.Error != "" {
-						return fmt.Errorf("%s", result.Error)
-					}
-					return fmt.Errorf("deploy failed")
-				}
-				return nil
-			},
-		})
-		taskIDs = append(taskIDs, taskID)
+		taskIDs = append(taskIDs, startSkillDeployTask(callerID(r), instID, slug, fileMap))
 	}
 	writeJSON(w, http.StatusAccepted, map[string]interface{}{"task_ids": taskIDs})
 }
 
+// startSkillDeployTask registers a skill.deploy task that uploads fileMap to
+// one instance and returns the task ID. TaskMgr must be set.
+func startSkillDeployTask(userID, instanceID uint, slug string, fileMap map[string][]byte) string {
+	var displayName, instanceLabel string
+	var inst database.Instance
+	if err := database.DB.Select("display_name").First(&inst, instanceID).Error; err == nil {
+		displayName = fmt.Sprintf("%s — %s", inst.DisplayName, slug)
+		instanceLabel = inst.DisplayName
+	} else {
+		displayName = fmt.Sprintf("instance %d — %s", instanceID, slug)
+		instanceLabel = fmt.Sprintf("instance %d", instanceID)
+	}
+	return TaskMgr.Start(taskmanager.StartOpts{
+		Type:         taskmanager.TaskSkillDeploy,
+		InstanceID:   instanceID,
+		UserID:       userID,
+		ResourceID:   slug,
+		ResourceName: displayName,
+		Title:        fmt.Sprintf("Deploying %s to %s", slug, instanceLabel),
+		Run: func(ctx context.Context, h *taskmanager.Handle) error {
+			h.UpdateMessage("uploading skill files")
+			result := deployToInstance(instanceID, slug, fileMap)
+			if result.Status != "ok" {
+				if result.Error != "" {
+					return fmt.Errorf("%s", result.Error)
+				}
+				return fmt.Errorf("deploy failed")
+			}
+			return nil
+		},
+	})
+}
+
 // computeMissingEnvVars returns the subset of requiredEnvVars that is neither
 // defined globally nor per-instance. Missing env vars are a warning, not a
 // failure — the deploy still proceeds.
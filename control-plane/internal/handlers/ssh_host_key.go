@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// hostKeyInstance resolves the {id} URL param to an instance, writing the
+// error response itself when it cannot.
+func instanceFromURL(w http.ResponseWriter, r *http.Request) (*database.Instance, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid instance ID")
+		return nil, false
+	}
+	var inst database.Instance
+	if err := database.DB.First(&inst, id).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Instance not found")
+		return nil, false
+	}
+	return &inst, true
+}
+
+// GetInstanceHostKey returns the pinned SSH host key for an instance and
+// any pending key that was rejected as a mismatch.
+func GetInstanceHostKey(w http.ResponseWriter, r *http.Request) {
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return
+	}
+	hk, err := database.GetInstanceHostKey(inst.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, "No host key pinned for this instance")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load host key")
+		return
+	}
+	writeJSON(w, http.StatusOK, hk)
+}
+
+// AcceptInstanceHostKey replaces the pinned host key with the pending key
+// recorded by the last mismatch. The next reconnect attempt uses it.
+func AcceptInstanceHostKey(w http.ResponseWriter, r *http.Request) {
+	if SSHMgr == nil {
+		writeError(w, http.StatusServiceUnavailable, "SSH manager not initialized")
+		return
+	}
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return
+	}
+	hk, err := database.GetInstanceHostKey(inst.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusInternalServerError, "Failed to load host key")
+		return
+	}
+	if hk == nil || hk.PendingKey == "" {
+		writeError(w, http.StatusConflict, "No pending host key to accept")
+		return
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hk.PendingKey))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Pending host key is unparseable")
+		return
+	}
+
+	previous := hk.Fingerprint
+	if err := SSHMgr.SetHostKey(inst.ID, key, sshproxy.HostKeySourceAdmin); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save host key")
+		return
+	}
+	auditLog(sshaudit.EventHostKeyPinned, inst.ID, getUsername(r),
+		fmt.Sprintf("accepted host key %s (replacing %s)", ssh.FingerprintSHA256(key), previous))
+
+	hk, err = database.GetInstanceHostKey(inst.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load host key")
+		return
+	}
+	writeJSON(w, http.StatusOK, hk)
+}
+
+// ForgetInstanceHostKey drops the pinned host key so the next connection
+// pins afresh (from the orchestrator where possible, otherwise on first use).
+func ForgetInstanceHostKey(w http.ResponseWriter, r *http.Request) {
+	inst, ok := instanceFromURL(w, r)
+	if !ok {
+		return
+	}
+	if SSHMgr != nil {
+		SSHMgr.ClearHostKey(inst.ID)
+	} else if err := (database.HostKeyStore{}).DeleteHostKey(inst.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete host key")
+		return
+	}
+	auditLog(sshaudit.EventHostKeyCleared, inst.ID, getUsername(r), "pinned host key forgotten")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"golang.org/x/crypto/ssh"
+)
+
+func testHostKeyLine(t *testing.T) (string, string) {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("ssh public key: %v", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))), ssh.FingerprintSHA256(key)
+}
+
+func setupHostKeyTest(t *testing.T) (database.Instance, *database.User) {
+	t.Helper()
+	setupTestDB(t)
+	database.DB.AutoMigrate(&database.InstanceHostKey{})
+
+	mgr := sshproxy.NewSSHManager(nil, "")
+	mgr.SetHostKeyStore(database.HostKeyStore{})
+	SSHMgr = mgr
+	t.Cleanup(func() { SSHMgr = nil })
+
+	return createTestInstance(t, "bot-hostkey", "Host Key"), createTestUser(t, "admin")
+}
+
+func TestAcceptInstanceHostKey(t *testing.T) {
+	inst, user := setupHostKeyTest(t)
+	params := map[string]string{"id": fmt.Sprintf("%d", inst.ID)}
+	store := database.HostKeyStore{}
+
+	oldKey, oldFP := testHostKeyLine(t)
+	newKey, newFP := testHostKeyLine(t)
+	if err := store.SaveHostKey(inst.ID, oldKey, oldFP, sshproxy.HostKeySourceTOFU); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// Nothing pending yet.
+	w := httptest.NewRecorder()
+	AcceptInstanceHostKey(w, buildRequest(t, "POST", "/", user, params))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("accept without pending: status = %d, want 409", w.Code)
+	}
+
+	if err := store.RecordHostKeyMismatch(inst.ID, newKey, newFP); err != nil {
+		t.Fatalf("record mismatch: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	GetInstanceHostKey(w, buildRequest(t, "GET", "/", user, params))
+	if w.Code != http.StatusOK {
+		t.Fatalf("get: status = %d, body %s", w.Code, w.Body.String())
+	}
+	var hk database.InstanceHostKey
+	json.Unmarshal(w.Body.Bytes(), &hk)
+	if hk.Fingerprint != oldFP || hk.PendingFingerprint != newFP {
+		t.Fatalf("get: fingerprint %q pending %q", hk.Fingerprint, hk.PendingFingerprint)
+	}
+
+	w = httptest.NewRecorder()
+	AcceptInstanceHostKey(w, buildRequest(t, "POST", "/", user, params))
+	if w.Code != http.StatusOK {
+		t.Fatalf("accept: status = %d, body %s", w.Code, w.Body.String())
+	}
+	hk = database.InstanceHostKey{}
+	json.Unmarshal(w.Body.Bytes(), &hk)
+	if hk.PublicKey != newKey || hk.Source != sshproxy.HostKeySourceAdmin || hk.PendingKey != "" {
+		t.Fatalf("accept: got %+v", hk)
+	}
+}
+
+func TestForgetInstanceHostKey(t *testing.T) {
+	inst, user := setupHostKeyTest(t)
+	params := map[string]string{"id": fmt.Sprintf("%d", inst.ID)}
+
+	key, fp := testHostKeyLine(t)
+	if err := (database.HostKeyStore{}).SaveHostKey(inst.ID, key, fp, sshproxy.HostKeySourceTOFU); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	ForgetInstanceHostKey(w, buildRequest(t, "DELETE", "/", user, params))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("forget: status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	GetInstanceHostKey(w, buildRequest(t, "GET", "/", user, params))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("get after forget: status = %d, want 404", w.Code)
+	}
+}
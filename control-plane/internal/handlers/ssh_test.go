@@ -182,6 +182,9 @@ func (m *mockOrchestrator) RestartInstance(_ context.Context, _ string, _ orches
 func (m *mockOrchestrator) GetInstanceStatus(_ context.Context, _ string) (string, error) {
 	return "running", nil
 }
+func (m *mockOrchestrator) InstanceExists(_ context.Context, _ string) (bool, error) {
+	return true, nil
+}
 func (m *mockOrchestrator) GetInstanceImageInfo(_ context.Context, _ string) (string, error) {
 	return "", nil
 }
@@ -199,6 +202,9 @@ func (m *mockOrchestrator) GetSSHAddress(_ context.Context, id uint) (string, in
 	}
 	return m.sshHost, m.sshPort, nil
 }
+func (m *mockOrchestrator) ReadSSHHostKeys(_ context.Context, _ uint) ([]string, error) {
+	return nil, nil
+}
 func (m *mockOrchestrator) UpdateResources(_ context.Context, _ string, _ orchestrator.UpdateResourcesParams) error {
 	return nil
 }
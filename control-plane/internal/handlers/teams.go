@@ -15,8 +15,11 @@ type teamResponse struct {
 	ID            uint   `json:"id"`
 	Name          string `json:"name"`
 	Description   string `json:"description"`
+	Require2FA    bool   `json:"require_2fa"`
 	MemberCount   int64  `json:"member_count"`
 	InstanceCount int64  `json:"instance_count"`
+
+	HibernateAfterHours int `json:"hibernate_after_hours"`
 }
 
 func teamToResponse(t database.Team) teamResponse {
@@ -24,6 +27,9 @@ func teamToResponse(t database.Team) teamResponse {
 		ID:          t.ID,
 		Name:        t.Name,
 		Description: t.Description,
+		Require2FA:  t.Require2FA,
+
+		HibernateAfterHours: t.HibernateAfterHours,
 	}
 }
 
@@ -97,6 +103,12 @@ func ListTeams(w http.ResponseWriter, r *http.Request) {
 type teamCreateRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Require2FA blocks password-only logins for team members. Nil leaves
+	// the current value unchanged on update.
+	Require2FA *bool `json:"require_2fa"`
+	// HibernateAfterHours stops the team's idle instances after this many
+	// hours (0 = never). Nil leaves the current value unchanged on update.
+	HibernateAfterHours *int `json:"hibernate_after_hours"`
 }
 
 // CreateTeam creates a new team (admin-only).
@@ -112,6 +124,16 @@ func CreateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	t := database.Team{Name: body.Name, Description: body.Description}
+	if body.Require2FA != nil {
+		t.Require2FA = *body.Require2FA
+	}
+	if body.HibernateAfterHours != nil {
+		if *body.HibernateAfterHours < 0 {
+			writeError(w, http.StatusBadRequest, "hibernate_after_hours must not be negative")
+			return
+		}
+		t.HibernateAfterHours = *body.HibernateAfterHours
+	}
 	if err := database.CreateTeam(&t); err != nil {
 		writeError(w, http.StatusBadRequest, "Failed to create team: "+err.Error())
 		return
@@ -119,7 +141,8 @@ func CreateTeam(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, teamToResponse(t))
 }
 
-// UpdateTeam updates a team's name/description (admin-only).
+// UpdateTeam updates a team's name, description, 2FA requirement and
+// hibernation policy (admin-only).
 func UpdateTeam(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -136,6 +159,16 @@ func UpdateTeam(w http.ResponseWriter, r *http.Request) {
 		updates["name"] = name
 	}
 	updates["description"] = body.Description
+	if body.Require2FA != nil {
+		updates["require_2fa"] = *body.Require2FA
+	}
+	if body.HibernateAfterHours != nil {
+		if *body.HibernateAfterHours < 0 {
+			writeError(w, http.StatusBadRequest, "hibernate_after_hours must not be negative")
+			return
+		}
+		updates["hibernate_after_hours"] = *body.HibernateAfterHours
+	}
 	if err := database.UpdateTeam(uint(id), updates); err != nil {
 		writeError(w, http.StatusBadRequest, "Failed to update team: "+err.Error())
 		return
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/coder/websocket"
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
@@ -31,10 +33,12 @@ const terminalRateBurst = 200
 // sessions persist after WebSocket disconnect and support reconnection.
 var TermSessionMgr *sshterminal.SessionManager
 
-type termResizeMsg struct {
-	Type string `json:"type"`
-	Cols uint16 `json:"cols"`
-	Rows uint16 `json:"rows"`
+// termClientMsg is a text (control) message from a terminal client.
+type termClientMsg struct {
+	Type     string `json:"type"`
+	Cols     uint16 `json:"cols"`
+	Rows     uint16 `json:"rows"`
+	ViewerID string `json:"viewer_id,omitempty"` // hand_off target
 }
 
 // TerminalWSProxy handles WebSocket connections for interactive terminal sessions.
@@ -42,6 +46,8 @@ type termResizeMsg struct {
 // Query parameters:
 //   - session_id: (optional) reconnect to an existing detached session. If omitted
 //     or the referenced session doesn't exist, a new session is created.
+//   - mode: (optional) "view" joins session_id as a read-only viewer alongside
+//     the client in control; see handleManagedTerminal.
 //
 // When TermSessionMgr is set, sessions persist after WebSocket disconnect and
 // output is buffered in a scrollback history. On reconnect the scrollback is
@@ -94,10 +100,11 @@ func TerminalWSProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	activity.Touch(inst.ID)
 	if TermSessionMgr != nil {
 		handleManagedTerminal(ctx, clientConn, r, sshClient, inst.ID)
 	} else {
-		handleLegacyTerminal(ctx, clientConn, sshClient)
+		handleLegacyTerminal(ctx, clientConn, sshClient, inst.ID)
 	}
 }
 
@@ -138,9 +145,22 @@ func (tb *tokenBucket) allow() bool {
 }
 
 // handleManagedTerminal uses SessionManager for session persistence, multiple
-// concurrent sessions, history replay, and optional recording.
+// concurrent sessions, history replay, shared viewing, and optional recording.
+//
+// A session can have any number of viewers but only one holds input control.
+// Connecting with mode=view joins an existing session read-only; any other
+// connection creates a session or reconnects to one nobody controls. Text
+// messages from the client, besides "resize":
+//   - {"type":"request_control"}: ask the controller for input control
+//   - {"type":"take_control"}: take control when nobody holds it
+//   - {"type":"hand_off","viewer_id":"..."}: controller passes control on
+//
+// The server sends {"type":"viewers",...} whenever the viewer list or the
+// controller changes.
 func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *http.Request, sshClient *ssh.Client, instanceID uint) {
 	sessionID := r.URL.Query().Get("session_id")
+	viewOnly := r.URL.Query().Get("mode") == "view"
+	username := getUsername(r)
 
 	var ms *sshterminal.ManagedSession
 
@@ -150,48 +170,76 @@ func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *h
 		if ms != nil && ms.InstanceID != instanceID {
 			ms = nil // wrong instance
 		}
-		if ms != nil && ms.IsAttached() {
+		if ms != nil && !viewOnly && ms.HasController() {
 			clientConn.Close(4409, "Session already attached")
 			return
 		}
 	}
+	if ms == nil && viewOnly {
+		clientConn.Close(4404, "Session not found")
+		return
+	}
 
 	// Create a new session if needed
 	if ms == nil {
 		var createErr error
-		ms, createErr = TermSessionMgr.CreateSession(sshClient, instanceID, "su - claworc")
+		ms, createErr = TermSessionMgr.CreateSessionAs(sshClient, instanceID, "su - claworc", username)
 		if createErr != nil {
 			log.Printf("Terminal session creation failed for instance %d: %v", instanceID, createErr)
 			clientConn.Close(4500, "Failed to start shell")
 			return
 		}
 		log.Printf("Terminal session created: session=%s instance=%d", ms.ID, instanceID)
-		auditLog(sshaudit.EventTerminalSession, instanceID, getUsername(r), fmt.Sprintf("session_started, session_id=%s", ms.ID))
-	} else {
+		details := fmt.Sprintf("session_started, session_id=%s", ms.ID)
+		if recID := ms.RecordingID(); recID != "" {
+			details += ", recording=" + recID
+		}
+		auditLog(sshaudit.EventTerminalSession, instanceID, username, details)
+	} else if !viewOnly {
 		log.Printf("Terminal session reconnected: session=%s instance=%d", ms.ID, instanceID)
-		auditLog(sshaudit.EventTerminalSession, instanceID, getUsername(r), fmt.Sprintf("session_reconnected, session_id=%s", ms.ID))
+		auditLog(sshaudit.EventTerminalSession, instanceID, username, fmt.Sprintf("session_reconnected, session_id=%s", ms.ID))
 	}
 
+	viewer, history, err := ms.Join(username, !viewOnly)
+	if err != nil {
+		clientConn.Close(4409, "Session already attached")
+		return
+	}
+	if viewOnly {
+		log.Printf("Terminal viewer joined: session=%s instance=%d viewer=%s", ms.ID, instanceID, viewer.ID)
+		auditLog(sshaudit.EventTerminalSession, instanceID, username,
+			fmt.Sprintf("viewer_joined, session_id=%s, viewer_id=%s, read_only", ms.ID, viewer.ID))
+	}
+	defer func() {
+		held := viewer.HasControl()
+		viewer.Leave()
+		event := "session_detached"
+		if viewOnly {
+			event = "viewer_left"
+		}
+		details := fmt.Sprintf("%s, session_id=%s, viewer_id=%s", event, ms.ID, viewer.ID)
+		if held {
+			details += ", control_released"
+		}
+		log.Printf("Terminal session detached: session=%s instance=%d viewer=%s", ms.ID, instanceID, viewer.ID)
+		auditLog(sshaudit.EventTerminalSession, instanceID, username, details)
+	}()
+
 	clientConn.SetReadLimit(1024 * 1024)
 
-	// Send session ID to client so it can reconnect later
-	sessionInfo, _ := json.Marshal(map[string]string{
+	// Send session and viewer IDs to the client so it can reconnect later
+	// and address hand-offs
+	sessionInfo, _ := json.Marshal(map[string]interface{}{
 		"type":       "session_info",
 		"session_id": ms.ID,
+		"viewer_id":  viewer.ID,
+		"read_only":  viewOnly,
 	})
 	if err := clientConn.Write(ctx, websocket.MessageText, sessionInfo); err != nil {
 		return
 	}
 
-	// Attach and replay history
-	wsWriter := &wsOutputWriter{conn: clientConn, ctx: ctx}
-	history := ms.Attach(wsWriter)
-	defer func() {
-		ms.Detach()
-		log.Printf("Terminal session detached: session=%s instance=%d", ms.ID, instanceID)
-		auditLog(sshaudit.EventTerminalSession, instanceID, getUsername(r), fmt.Sprintf("session_detached, session_id=%s", ms.ID))
-	}()
-
+	// Replay history, then relay live output and viewer-list changes
 	if len(history) > 0 {
 		if err := clientConn.Write(ctx, websocket.MessageBinary, history); err != nil {
 			return
@@ -201,12 +249,33 @@ func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *h
 	relayCtx, relayCancel := context.WithCancel(ctx)
 	defer relayCancel()
 
-	// Watch for session SSH process termination
+	// Session output and viewer updates -> Browser. Ends when the session's
+	// SSH process exits or the viewer is dropped for falling behind.
 	go func() {
-		select {
-		case <-ms.Done():
-			relayCancel()
-		case <-relayCtx.Done():
+		defer relayCancel()
+		for {
+			select {
+			case data := <-viewer.Output():
+				if err := clientConn.Write(relayCtx, websocket.MessageBinary, data); err != nil {
+					return
+				}
+			case <-viewer.Changed():
+				msg, _ := json.Marshal(map[string]interface{}{
+					"type":      "viewers",
+					"viewer_id": viewer.ID,
+					"control":   viewer.HasControl(),
+					"viewers":   ms.Viewers(),
+				})
+				if err := clientConn.Write(relayCtx, websocket.MessageText, msg); err != nil {
+					return
+				}
+			case <-viewer.Done():
+				return
+			case <-ms.Done():
+				return
+			case <-relayCtx.Done():
+				return
+			}
 		}
 	}()
 
@@ -233,15 +302,22 @@ func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *h
 					log.Printf("Terminal input message too large: session=%s size=%d limit=%d", ms.ID, len(data), sshterminal.MaxInputMessageSize)
 					continue
 				}
-				if _, err := ms.WriteInput(data); err != nil {
+				// Input from viewers without control is dropped
+				if _, err := viewer.WriteInput(data); err == nil {
+					activity.Touch(instanceID)
+				} else if !errors.Is(err, sshterminal.ErrNotController) {
 					return
 				}
-			} else {
-				var msg termResizeMsg
-				if err := json.Unmarshal(data, &msg); err != nil {
-					continue
-				}
-				if msg.Type == "resize" && msg.Cols > 0 && msg.Rows > 0 {
+				continue
+			}
+
+			var msg termClientMsg
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
 					// Clamp resize dimensions to safe upper bounds
 					cols := msg.Cols
 					rows := msg.Rows
@@ -251,7 +327,20 @@ func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *h
 					if rows > sshterminal.MaxResizeRows {
 						rows = sshterminal.MaxResizeRows
 					}
-					ms.Resize(cols, rows)
+					viewer.Resize(cols, rows)
+				}
+			case "request_control":
+				viewer.RequestControl()
+			case "take_control":
+				if viewer.TakeControl() == nil {
+					auditLog(sshaudit.EventTerminalSession, instanceID, username,
+						fmt.Sprintf("control_taken, session_id=%s, viewer_id=%s", ms.ID, viewer.ID))
+				}
+			case "hand_off":
+				if to, err := viewer.HandOff(msg.ViewerID); err == nil {
+					auditLog(sshaudit.EventTerminalSession, instanceID, username,
+						fmt.Sprintf("control_transferred, session_id=%s, from=%s (%s), to=%s (%s)",
+							ms.ID, username, viewer.ID, to.User, to.ID))
 				}
 			}
 		}
@@ -261,7 +350,7 @@ func handleManagedTerminal(ctx context.Context, clientConn *websocket.Conn, r *h
 }
 
 // handleLegacyTerminal creates an ephemeral session destroyed on disconnect.
-func handleLegacyTerminal(ctx context.Context, clientConn *websocket.Conn, sshClient *ssh.Client) {
+func handleLegacyTerminal(ctx context.Context, clientConn *websocket.Conn, sshClient *ssh.Client, instanceID uint) {
 	session, err := sshterminal.CreateInteractiveSession(sshClient, "su - claworc")
 	if err != nil {
 		log.Printf("Legacy terminal session creation failed: %v", err)
@@ -319,8 +408,9 @@ func handleLegacyTerminal(ctx context.Context, clientConn *websocket.Conn, sshCl
 				if _, err := session.Stdin.Write(data); err != nil {
 					return
 				}
+				activity.Touch(instanceID)
 			} else {
-				var msg termResizeMsg
+				var msg termClientMsg
 				if err := json.Unmarshal(data, &msg); err != nil {
 					continue
 				}
@@ -343,19 +433,6 @@ func handleLegacyTerminal(ctx context.Context, clientConn *websocket.Conn, sshCl
 	clientConn.Close(websocket.StatusNormalClosure, "")
 }
 
-// wsOutputWriter wraps a WebSocket connection to implement io.Writer.
-type wsOutputWriter struct {
-	conn *websocket.Conn
-	ctx  context.Context
-}
-
-func (w *wsOutputWriter) Write(p []byte) (int, error) {
-	if err := w.conn.Write(w.ctx, websocket.MessageBinary, p); err != nil {
-		return 0, err
-	}
-	return len(p), nil
-}
-
 // ListTerminalSessions returns the active terminal sessions for an instance.
 func ListTerminalSessions(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
@@ -379,10 +456,11 @@ func ListTerminalSessions(w http.ResponseWriter, r *http.Request) {
 	sessions := TermSessionMgr.ListSessions(uint(id))
 
 	type sessionResponse struct {
-		ID        string `json:"id"`
-		Shell     string `json:"shell"`
-		Attached  bool   `json:"attached"`
-		CreatedAt string `json:"created_at"`
+		ID        string                   `json:"id"`
+		Shell     string                   `json:"shell"`
+		Attached  bool                     `json:"attached"`
+		Viewers   []sshterminal.ViewerInfo `json:"viewers"`
+		CreatedAt string                   `json:"created_at"`
 	}
 
 	resp := make([]sessionResponse, len(sessions))
@@ -391,6 +469,7 @@ func ListTerminalSessions(w http.ResponseWriter, r *http.Request) {
 			ID:        s.ID,
 			Shell:     s.Shell,
 			Attached:  s.IsAttached(),
+			Viewers:   s.Viewers(),
 			CreatedAt: s.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
 		}
 	}
@@ -289,7 +289,7 @@ func TestTerminalWSProxy_ResizeMessage(t *testing.T) {
 	readUntilWS(t, conn, ctx, "PTY:true", 3*time.Second)
 
 	// Send resize control message as text JSON
-	resizeMsg, _ := json.Marshal(termResizeMsg{
+	resizeMsg, _ := json.Marshal(termClientMsg{
 		Type: "resize",
 		Cols: 120,
 		Rows: 40,
@@ -432,7 +432,7 @@ func TestTerminalWSProxy_MultipleResizes(t *testing.T) {
 	}
 
 	for _, r := range resizes {
-		msg, _ := json.Marshal(termResizeMsg{Type: "resize", Cols: r.cols, Rows: r.rows})
+		msg, _ := json.Marshal(termClientMsg{Type: "resize", Cols: r.cols, Rows: r.rows})
 		if err := conn.Write(ctx, websocket.MessageText, msg); err != nil {
 			t.Fatalf("write resize %dx%d: %v", r.cols, r.rows, err)
 		}
@@ -738,7 +738,7 @@ func TestTerminalWSProxy_InvalidResizeIgnored(t *testing.T) {
 	readUntilWS(t, conn, ctx, "PTY:true", 3*time.Second)
 
 	// Send resize with zero dimensions (should be ignored per handler code)
-	zeroResize, _ := json.Marshal(termResizeMsg{Type: "resize", Cols: 0, Rows: 0})
+	zeroResize, _ := json.Marshal(termClientMsg{Type: "resize", Cols: 0, Rows: 0})
 	if err := conn.Write(ctx, websocket.MessageText, zeroResize); err != nil {
 		t.Fatalf("write zero resize: %v", err)
 	}
@@ -871,10 +871,13 @@ func readSessionInfoWS(t *testing.T, conn *websocket.Conn, ctx context.Context)
 		}
 
 		if msgType == websocket.MessageText {
-			var info map[string]string
+			var info struct {
+				Type      string `json:"type"`
+				SessionID string `json:"session_id"`
+			}
 			if err := json.Unmarshal(data, &info); err == nil {
-				if info["type"] == "session_info" && info["session_id"] != "" {
-					return info["session_id"]
+				if info.Type == "session_info" && info.SessionID != "" {
+					return info.SessionID
 				}
 			}
 		}
@@ -1179,6 +1182,88 @@ func TestManagedTerminal_SessionAlreadyAttached(t *testing.T) {
 	conn1.Close(websocket.StatusNormalClosure, "")
 }
 
+// readViewersWS reads messages until a viewers update satisfying ok arrives.
+func readViewersWS(t *testing.T, conn *websocket.Conn, ctx context.Context, ok func(control bool, viewers []sshterminal.ViewerInfo) bool) (viewerID string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		readCtx, readCancel := context.WithTimeout(ctx, 2*time.Second)
+		msgType, data, err := conn.Read(readCtx)
+		readCancel()
+		if err != nil {
+			t.Fatalf("read error waiting for viewers update: %v", err)
+		}
+		if msgType != websocket.MessageText {
+			continue
+		}
+		var msg struct {
+			Type     string                   `json:"type"`
+			ViewerID string                   `json:"viewer_id"`
+			Control  bool                     `json:"control"`
+			Viewers  []sshterminal.ViewerInfo `json:"viewers"`
+		}
+		if json.Unmarshal(data, &msg) == nil && msg.Type == "viewers" && ok(msg.Control, msg.Viewers) {
+			return msg.ViewerID
+		}
+	}
+	t.Fatal("timeout waiting for viewers update")
+	return ""
+}
+
+func TestManagedTerminal_ReadOnlyViewerAndHandOff(t *testing.T) {
+	proxyServer, _ := setupManagedTerminalTest(t)
+
+	wsURL := strings.Replace(proxyServer.URL, "http://", "ws://", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial owner: %v", err)
+	}
+	defer owner.CloseNow()
+	sessionID := readSessionInfoWS(t, owner, ctx)
+	readUntilWS(t, owner, ctx, "PTY:true", 3*time.Second)
+
+	// Viewing a session that does not exist is refused
+	missing, _, err := websocket.Dial(ctx, wsURL+"?mode=view&session_id=nope", nil)
+	if err == nil {
+		if _, _, err := missing.Read(ctx); websocket.CloseStatus(err) != 4404 {
+			t.Errorf("view of unknown session: close status = %v, want 4404", websocket.CloseStatus(err))
+		}
+		missing.CloseNow()
+	}
+
+	viewer, _, err := websocket.Dial(ctx, wsURL+"?mode=view&session_id="+sessionID, nil)
+	if err != nil {
+		t.Fatalf("dial viewer: %v", err)
+	}
+	defer viewer.CloseNow()
+	if got := readSessionInfoWS(t, viewer, ctx); got != sessionID {
+		t.Fatalf("viewer joined session %q, want %q", got, sessionID)
+	}
+	viewerID := readViewersWS(t, viewer, ctx, func(_ bool, vs []sshterminal.ViewerInfo) bool { return len(vs) == 2 })
+
+	// The viewer sees the controller's output, and its own input is dropped
+	owner.Write(ctx, websocket.MessageBinary, []byte("from_owner"))
+	readUntilWS(t, viewer, ctx, "echo:from_owner", 3*time.Second)
+	viewer.Write(ctx, websocket.MessageBinary, []byte("from_viewer"))
+	owner.Write(ctx, websocket.MessageBinary, []byte("marker"))
+	if out := readUntilWS(t, owner, ctx, "echo:marker", 3*time.Second); strings.Contains(out, "from_viewer") {
+		t.Error("read-only viewer input reached the terminal")
+	}
+
+	// Hand control to the viewer; its input now reaches the terminal
+	handOff, _ := json.Marshal(termClientMsg{Type: "hand_off", ViewerID: viewerID})
+	owner.Write(ctx, websocket.MessageText, handOff)
+	readViewersWS(t, viewer, ctx, func(control bool, _ []sshterminal.ViewerInfo) bool { return control })
+	viewer.Write(ctx, websocket.MessageBinary, []byte("viewer_typed"))
+	readUntilWS(t, owner, ctx, "echo:viewer_typed", 3*time.Second)
+
+	viewer.Close(websocket.StatusNormalClosure, "")
+	owner.Close(websocket.StatusNormalClosure, "")
+}
+
 // --- Security Hardening Tests ---
 
 func TestTokenBucket_RateLimiting(t *testing.T) {
@@ -1253,7 +1338,7 @@ func TestManagedTerminal_ResizeClamped(t *testing.T) {
 	readUntilWS(t, conn, ctx, "PTY:true", 3*time.Second)
 
 	// Send resize with dimensions exceeding max — should be clamped
-	hugeResize, _ := json.Marshal(termResizeMsg{Type: "resize", Cols: 9999, Rows: 9999})
+	hugeResize, _ := json.Marshal(termClientMsg{Type: "resize", Cols: 9999, Rows: 9999})
 	if err := conn.Write(ctx, websocket.MessageText, hugeResize); err != nil {
 		t.Fatalf("write huge resize: %v", err)
 	}
@@ -1305,7 +1390,7 @@ func TestManagedTerminal_ResizeAfterReconnect(t *testing.T) {
 	readUntilWS(t, conn2, ctx2, "PTY:true", 3*time.Second)
 
 	// Resize should work after reconnect
-	resizeMsg, _ := json.Marshal(termResizeMsg{Type: "resize", Cols: 100, Rows: 30})
+	resizeMsg, _ := json.Marshal(termClientMsg{Type: "resize", Cols: 100, Rows: 30})
 	if err := conn2.Write(ctx2, websocket.MessageText, resizeMsg); err != nil {
 		t.Fatalf("write resize: %v", err)
 	}
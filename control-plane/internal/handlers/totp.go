@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/gluk-w/claworc/control-plane/internal/auth"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/middleware"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+// totpSetupTTL bounds how long a password-verified user has to enroll TOTP
+// when policy blocks their login until they do.
+const totpSetupTTL = 10 * time.Minute
+
+const totpSetupPrefix = "totp-setup:"
+
+// defaultTOTPSetupWindow is how long an admin-opened enrollment window
+// stays open when no duration is given, and after ResetUserTOTP.
+const defaultTOTPSetupWindow = 24 * time.Hour
+
+// maxTOTPSetupAttempts bounds setup enroll/enable calls per user within
+// totpSetupTTL, so a setup token cannot be used to guess codes.
+const maxTOTPSetupAttempts = 10
+
+var totpSetupAttempts = struct {
+	sync.Mutex
+	m map[uint][]time.Time
+}{m: map[uint][]time.Time{}}
+
+// allowTOTPSetupAttempt records a setup call for userID and reports
+// whether it is within maxTOTPSetupAttempts.
+func allowTOTPSetupAttempt(userID uint) bool {
+	totpSetupAttempts.Lock()
+	defer totpSetupAttempts.Unlock()
+	cutoff := time.Now().Add(-totpSetupTTL)
+	recent := totpSetupAttempts.m[userID][:0]
+	for _, t := range totpSetupAttempts.m[userID] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= maxTOTPSetupAttempts {
+		totpSetupAttempts.m[userID] = recent
+		return false
+	}
+	totpSetupAttempts.m[userID] = append(recent, time.Now())
+	return true
+}
+
+// checkLoginSecondFactor enforces TOTP and the 2FA policy on a password
+// login that has already passed the password check. It writes the error
+// response and returns false when the login must not proceed.
+//
+// Users with TOTP enabled must supply a valid code (or recovery code).
+// Users whom policy obliges to use 2FA but who have no TOTP are refused:
+// passkey holders are told to sign in with their passkey. Everyone else
+// gets a short-lived setup token for the public enrollment endpoints, but
+// only while an admin has opened an enrollment window for them, since the
+// password alone must not be enough to choose the second factor.
+func checkLoginSecondFactor(w http.ResponseWriter, r *http.Request, user *database.User, code string) bool {
+	if user.TOTPEnabled {
+		if strings.TrimSpace(code) == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"detail":        "Two-factor code required",
+				"totp_required": true,
+			})
+			return false
+		}
+		if !verifySecondFactor(user, code) {
+			writeError(w, http.StatusUnauthorized, "Invalid two-factor code")
+			return false
+		}
+		return true
+	}
+	if !database.UserRequires2FA(user) {
+		return true
+	}
+	if database.UserHasPasskey(user.ID) {
+		writeError(w, http.StatusForbidden, "Two-factor authentication is required; sign in with your passkey")
+		return false
+	}
+	now := time.Now()
+	if !database.TOTPSetupAllowed(user, now) {
+		auditLog(sshaudit.EventTOTPSetupRefused, 0, user.Username, "no enrollment window, source_ip="+sourceIPOf(r))
+		writeError(w, http.StatusForbidden, "Two-factor authentication is required; ask an admin to allow authenticator setup for your account")
+		return false
+	}
+	expires := now.Add(totpSetupTTL)
+	if user.TOTPSetupUntil.Before(expires) {
+		expires = *user.TOTPSetupUntil
+	}
+	token, err := utils.Encrypt(fmt.Sprintf("%s%d:%d", totpSetupPrefix, user.ID, expires.Unix()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start two-factor setup")
+		return false
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"detail":              "Two-factor authentication is required; set up an authenticator app to continue",
+		"totp_setup_required": true,
+		"setup_token":         token,
+	})
+	return false
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery
+// code. Each TOTP code and each recovery code works exactly once.
+func verifySecondFactor(user *database.User, code string) bool {
+	if !user.TOTPEnabled {
+		return false
+	}
+	secret, err := utils.Decrypt(user.TOTPSecret)
+	if err != nil || secret == "" {
+		return false
+	}
+	if step, ok := auth.ValidateTOTP(secret, code, time.Now()); ok {
+		return database.AdvanceUserTOTPStep(user.ID, step)
+	}
+	if database.RedeemRecoveryCode(user.ID, auth.HashRecoveryCode(code)) {
+		auditLog(sshaudit.EventTOTPRecoveryCodeUsed, 0, user.Username,
+			fmt.Sprintf("%d recovery codes left", database.CountUnusedRecoveryCodes(user.ID)))
+		return true
+	}
+	return false
+}
+
+// userFromSetupToken resolves a setup token issued by
+// checkLoginSecondFactor, writing the error response on failure.
+func userFromSetupToken(w http.ResponseWriter, token string) *database.User {
+	plain, err := utils.Decrypt(token)
+	rest, found := strings.CutPrefix(plain, totpSetupPrefix)
+	if err != nil || !found {
+		writeError(w, http.StatusUnauthorized, "Invalid setup token")
+		return nil
+	}
+	idStr, expStr, _ := strings.Cut(rest, ":")
+	id, err1 := strconv.ParseUint(idStr, 10, 64)
+	exp, err2 := strconv.ParseInt(expStr, 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > exp {
+		writeError(w, http.StatusUnauthorized, "Setup token expired; sign in again")
+		return nil
+	}
+	user, err := database.GetUserByID(uint(id))
+	if err != nil || user.Disabled {
+		writeError(w, http.StatusUnauthorized, "Invalid setup token")
+		return nil
+	}
+	if user.TOTPEnabled {
+		writeError(w, http.StatusConflict, "Two-factor authentication is already set up; sign in again")
+		return nil
+	}
+	if !database.TOTPSetupAllowed(user, time.Now()) {
+		writeError(w, http.StatusForbidden, "Two-factor setup is no longer allowed; ask an admin to allow it again")
+		return nil
+	}
+	if !allowTOTPSetupAttempt(user.ID) {
+		writeError(w, http.StatusTooManyRequests, "Too many two-factor setup attempts; try again later")
+		return nil
+	}
+	return user
+}
+
+// startTOTPEnrollment generates a pending secret for user and writes the
+// provisioning details.
+func startTOTPEnrollment(w http.ResponseWriter, user *database.User) {
+	enr, err := auth.GenerateTOTP(user.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate TOTP secret")
+		return
+	}
+	encrypted, err := utils.Encrypt(enr.Secret)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encrypt TOTP secret")
+		return
+	}
+	if err := database.SetUserTOTPSecret(user.ID, encrypted); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save TOTP secret")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":      enr.Secret,
+		"otpauth_url": enr.URL,
+		"qr_png":      enr.QRCodePNG,
+	})
+}
+
+// finishTOTPEnrollment confirms the pending secret with code, enables TOTP
+// and issues recovery codes. It writes the error response and returns nil
+// on failure.
+func finishTOTPEnrollment(w http.ResponseWriter, r *http.Request, user *database.User, code string) []string {
+	secret, err := utils.Decrypt(user.TOTPSecret)
+	if err != nil || secret == "" {
+		writeError(w, http.StatusBadRequest, "No pending TOTP enrollment; start one first")
+		return nil
+	}
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid code")
+		return nil
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return nil
+	}
+	if err := database.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save recovery codes")
+		return nil
+	}
+	if err := database.EnableUserTOTP(user.ID, step); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to enable TOTP")
+		return nil
+	}
+	auditLog(sshaudit.EventTOTPEnabled, 0, user.Username, "source_ip="+sourceIPOf(r))
+	return codes
+}
+
+// reloadUser returns a fresh copy of the authenticated user, since the
+// context copy predates any TOTP changes made in this request.
+func reloadUser(w http.ResponseWriter, r *http.Request) *database.User {
+	u := middleware.GetUser(r)
+	if u == nil {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return nil
+	}
+	user, err := database.GetUserByID(u.ID)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "User not found")
+		return nil
+	}
+	return user
+}
+
+// GetTOTPStatus handles GET /api/v1/auth/totp.
+func GetTOTPStatus(w http.ResponseWriter, r *http.Request) {
+	user := reloadUser(w, r)
+	if user == nil {
+		return
+	}
+	resp := map[string]interface{}{
+		"enabled":     user.TOTPEnabled,
+		"required":    database.UserRequires2FA(user),
+		"has_passkey": database.UserHasPasskey(user.ID),
+	}
+	if user.TOTPEnabled {
+		resp["recovery_codes_remaining"] = database.CountUnusedRecoveryCodes(user.ID)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// EnrollTOTP handles POST /api/v1/auth/totp/enroll. It returns a new secret
+// and its otpauth:// provisioning URI; TOTP stays off until EnableTOTP
+// confirms a code generated from it.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user := reloadUser(w, r)
+	if user == nil {
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, http.StatusConflict, "TOTP is already enabled; disable it first")
+		return
+	}
+	startTOTPEnrollment(w, user)
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// EnableTOTP handles POST /api/v1/auth/totp/enable. The recovery codes are
+// only returned in this response.
+func EnableTOTP(w http.ResponseWriter, r *http.Request) {
+	user := reloadUser(w, r)
+	if user == nil {
+		return
+	}
+	var body totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if user.TOTPEnabled {
+		writeError(w, http.StatusConflict, "TOTP is already enabled")
+		return
+	}
+	if codes := finishTOTPEnrollment(w, r, user, body.Code); codes != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+	}
+}
+
+// DisableTOTP handles POST /api/v1/auth/totp/disable. It needs a current
+// code, and is refused while policy requires 2FA and the user has no
+// passkey to fall back on.
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user := reloadUser(w, r)
+	if user == nil {
+		return
+	}
+	var body totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !user.TOTPEnabled {
+		writeError(w, http.StatusBadRequest, "TOTP is not enabled")
+		return
+	}
+	if database.UserRequires2FA(user) && !database.UserHasPasskey(user.ID) {
+		writeError(w, http.StatusForbidden, "Two-factor authentication is required for your account; register a passkey before disabling TOTP")
+		return
+	}
+	if !verifySecondFactor(user, body.Code) {
+		writeError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+	if err := database.DisableUserTOTP(user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to disable TOTP")
+		return
+	}
+	auditLog(sshaudit.EventTOTPDisabled, 0, user.Username, "by user")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes handles POST /api/v1/auth/totp/recovery-codes,
+// replacing every existing recovery code.
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := reloadUser(w, r)
+	if user == nil {
+		return
+	}
+	var body totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !user.TOTPEnabled {
+		writeError(w, http.StatusBadRequest, "TOTP is not enabled")
+		return
+	}
+	if !verifySecondFactor(user, body.Code) {
+		writeError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+	if err := database.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save recovery codes")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+type totpSetupRequest struct {
+	SetupToken string `json:"setup_token"`
+	Code       string `json:"code"`
+}
+
+// SetupEnrollTOTP handles POST /api/v1/auth/totp/setup/enroll: the
+// unauthenticated counterpart of EnrollTOTP for users whose login was
+// blocked pending 2FA setup.
+func SetupEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	var body totpSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if user := userFromSetupToken(w, body.SetupToken); user != nil {
+		auditLog(sshaudit.EventTOTPSetupAttempt, 0, user.Username, "enroll, source_ip="+sourceIPOf(r))
+		startTOTPEnrollment(w, user)
+	}
+}
+
+// SetupEnableTOTP handles POST /api/v1/auth/totp/setup/enable. On success
+// TOTP is enabled, the login completes with a new session and the
+// recovery codes are returned alongside the user.
+func SetupEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	var body totpSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user := userFromSetupToken(w, body.SetupToken)
+	if user == nil {
+		return
+	}
+	codes := finishTOTPEnrollment(w, r, user, body.Code)
+	if codes == nil {
+		auditLog(sshaudit.EventTOTPSetupAttempt, 0, user.Username, "enable failed, source_ip="+sourceIPOf(r))
+		return
+	}
+
+	sessionID, err := SessionStore.CreateWithInfo(user.ID, r.UserAgent(), sourceIPOf(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	_ = database.TouchUserLastLogin(user.ID)
+	setSessionCookie(w, r, sessionID)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":             user.ID,
+		"username":       user.Username,
+		"role":           user.Role,
+		"recovery_codes": codes,
+	})
+}
+
+// ResetUserTOTP handles DELETE /api/v1/users/{userId}/totp (admin): turns
+// off TOTP for a user who lost their authenticator and recovery codes.
+// If policy requires 2FA they will be asked to enroll again at next login,
+// so an enrollment window of defaultTOTPSetupWindow is opened as well.
+func ResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := database.GetUserByID(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err := database.DisableUserTOTP(user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to reset TOTP")
+		return
+	}
+	auditLog(sshaudit.EventTOTPDisabled, 0, getUsername(r), "reset for "+user.Username)
+	until := time.Now().Add(defaultTOTPSetupWindow).UTC()
+	if err := database.SetUserTOTPSetupWindow(user.ID, &until); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to open TOTP setup window")
+		return
+	}
+	auditLog(sshaudit.EventTOTPSetupAllowed, 0, getUsername(r), fmt.Sprintf("for %s until %s", user.Username, until.Format(time.RFC3339)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AllowUserTOTPSetup handles PUT /api/v1/users/{userId}/totp/setup-window
+// (admin): lets a user whom policy obliges to use 2FA enroll TOTP after a
+// password-only login for the next `hours` (default 24, at most 168).
+// `hours: 0` closes the window.
+func AllowUserTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var body struct {
+		Hours *int `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	window := defaultTOTPSetupWindow
+	if body.Hours != nil {
+		if *body.Hours < 0 || *body.Hours > 168 {
+			writeError(w, http.StatusBadRequest, "hours must be between 0 and 168")
+			return
+		}
+		window = time.Duration(*body.Hours) * time.Hour
+	}
+	user, err := database.GetUserByID(uint(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.TOTPEnabled && window > 0 {
+		writeError(w, http.StatusConflict, "TOTP is already enabled for this user; reset it first")
+		return
+	}
+
+	var until *time.Time
+	detail := "closed for " + user.Username
+	if window > 0 {
+		t := time.Now().Add(window).UTC()
+		until = &t
+		detail = fmt.Sprintf("for %s until %s", user.Username, t.Format(time.RFC3339))
+	}
+	if err := database.SetUserTOTPSetupWindow(user.ID, until); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update TOTP setup window")
+		return
+	}
+	auditLog(sshaudit.EventTOTPSetupAllowed, 0, getUsername(r), detail)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"totp_setup_until": until})
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func setupTOTPTest(t *testing.T) {
+	t.Helper()
+	setupAuthTest(t)
+	database.DB.AutoMigrate(&database.UserRecoveryCode{}, &database.Team{}, &database.TeamMember{}, &database.WebAuthnCredential{})
+	totpSetupAttempts.Lock()
+	totpSetupAttempts.m = map[uint][]time.Time{}
+	totpSetupAttempts.Unlock()
+}
+
+// enrollTOTPFor enrolls and enables TOTP for user, returning the secret and
+// the recovery codes. The confirming code is taken from the previous time
+// step so a code for the current step is still fresh for the caller.
+func enrollTOTPFor(t *testing.T, user *database.User) (string, []string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	EnrollTOTP(w, tokenRequest("POST", "/api/v1/auth/totp/enroll", user, nil, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("enroll status = %d: %s", w.Code, w.Body.String())
+	}
+	var enr map[string]string
+	json.Unmarshal(w.Body.Bytes(), &enr)
+
+	code, _ := totp.GenerateCode(enr["secret"], time.Now().Add(-30*time.Second))
+	w = httptest.NewRecorder()
+	EnableTOTP(w, tokenRequest("POST", "/api/v1/auth/totp/enable", user, nil, map[string]string{"code": code}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return enr["secret"], resp.RecoveryCodes
+}
+
+func TestLogin_TOTP(t *testing.T) {
+	setupTOTPTest(t)
+	alice := createUserWithPassword(t, "alice", "pw", "user")
+	secret, recovery := enrollTOTPFor(t, alice)
+	if len(recovery) == 0 {
+		t.Fatal("no recovery codes issued")
+	}
+
+	login := func(code string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "alice", "password": "pw", "totp_code": code}))
+		return w
+	}
+
+	w := login("")
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusUnauthorized || body["totp_required"] != true {
+		t.Errorf("no code: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := login("000000"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: status = %d, want 401", w.Code)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if w := login(code); w.Code != http.StatusOK {
+		t.Errorf("valid code: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := login(code); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: status = %d, want 401", w.Code)
+	}
+
+	if w := login(recovery[0]); w.Code != http.StatusOK {
+		t.Errorf("recovery code: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := login(recovery[0]); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status = %d, want 401", w.Code)
+	}
+	if n := database.CountUnusedRecoveryCodes(alice.ID); n != int64(len(recovery)-1) {
+		t.Errorf("unused recovery codes = %d, want %d", n, len(recovery)-1)
+	}
+}
+
+func TestLogin_Require2FAByRole(t *testing.T) {
+	setupTOTPTest(t)
+	createUserWithPassword(t, "root", "pw", "admin")
+	createUserWithPassword(t, "bob", "pw", "user")
+	database.SetSetting(database.Require2FARolesSetting, "admin")
+
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "bob", "password": "pw"}))
+	if w.Code != http.StatusOK {
+		t.Errorf("user login status = %d, want 200", w.Code)
+	}
+
+	// Without an admin-opened window the password alone gets no setup token.
+	w = httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "root", "password": "pw"}))
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "setup_token") {
+		t.Fatalf("admin login without window: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	allowTOTPSetupFor(t, "root")
+
+	w = httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "root", "password": "pw"}))
+	var blocked struct {
+		SetupRequired bool   `json:"totp_setup_required"`
+		SetupToken    string `json:"setup_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &blocked)
+	if w.Code != http.StatusForbidden || !blocked.SetupRequired || blocked.SetupToken == "" {
+		t.Fatalf("admin login: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("blocked login set a cookie")
+	}
+
+	// Enroll through the public setup endpoints with the token.
+	w = httptest.NewRecorder()
+	SetupEnrollTOTP(w, postJSON("/api/v1/auth/totp/setup/enroll", map[string]string{"setup_token": blocked.SetupToken}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup enroll status = %d: %s", w.Code, w.Body.String())
+	}
+	var enr map[string]string
+	json.Unmarshal(w.Body.Bytes(), &enr)
+	code, _ := totp.GenerateCode(enr["secret"], time.Now())
+	w = httptest.NewRecorder()
+	SetupEnableTOTP(w, postJSON("/api/v1/auth/totp/setup/enable", map[string]string{"setup_token": blocked.SetupToken, "code": code}))
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) == 0 {
+		t.Fatalf("setup enable status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The token cannot be used to re-enroll once TOTP is on.
+	w = httptest.NewRecorder()
+	SetupEnrollTOTP(w, postJSON("/api/v1/auth/totp/setup/enroll", map[string]string{"setup_token": blocked.SetupToken}))
+	if w.Code != http.StatusConflict {
+		t.Errorf("re-enroll status = %d, want 409", w.Code)
+	}
+}
+
+// allowTOTPSetupFor opens the default enrollment window for username as an
+// admin would.
+func allowTOTPSetupFor(t *testing.T, username string) {
+	t.Helper()
+	user, _ := database.GetUserByUsername(username)
+	id := fmt.Sprint(user.ID)
+	w := httptest.NewRecorder()
+	AllowUserTOTPSetup(w, tokenRequest("PUT", "/api/v1/users/"+id+"/totp/setup-window", nil, map[string]string{"userId": id}, map[string]any{}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("allow setup status = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTOTPSetup_PasswordAloneCannotEnroll(t *testing.T) {
+	setupTOTPTest(t)
+	createUserWithPassword(t, "root", "pw", "admin")
+	database.SetSetting(database.Require2FARolesSetting, "admin")
+	allowTOTPSetupFor(t, "root")
+
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "root", "password": "pw"}))
+	var blocked struct {
+		SetupToken string `json:"setup_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &blocked)
+	w = httptest.NewRecorder()
+	SetupEnrollTOTP(w, postJSON("/api/v1/auth/totp/setup/enroll", map[string]string{"setup_token": blocked.SetupToken}))
+	var enr map[string]string
+	json.Unmarshal(w.Body.Bytes(), &enr)
+
+	// Closing the window invalidates setup tokens already handed out.
+	user, _ := database.GetUserByUsername("root")
+	id := fmt.Sprint(user.ID)
+	w = httptest.NewRecorder()
+	AllowUserTOTPSetup(w, tokenRequest("PUT", "/api/v1/users/"+id+"/totp/setup-window", nil, map[string]string{"userId": id}, map[string]any{"hours": 0}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("close window status = %d: %s", w.Code, w.Body.String())
+	}
+	code, _ := totp.GenerateCode(enr["secret"], time.Now())
+	w = httptest.NewRecorder()
+	SetupEnableTOTP(w, postJSON("/api/v1/auth/totp/setup/enable", map[string]string{"setup_token": blocked.SetupToken, "code": code}))
+	if w.Code != http.StatusForbidden || len(w.Result().Cookies()) != 0 {
+		t.Errorf("enable after window closed: status = %d: %s", w.Code, w.Body.String())
+	}
+	if u, _ := database.GetUserByID(user.ID); u.TOTPEnabled {
+		t.Error("TOTP enabled without an open window")
+	}
+}
+
+func TestTOTPSetup_RateLimited(t *testing.T) {
+	setupTOTPTest(t)
+	createUserWithPassword(t, "root", "pw", "admin")
+	database.SetSetting(database.Require2FARolesSetting, "admin")
+	allowTOTPSetupFor(t, "root")
+
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "root", "password": "pw"}))
+	var blocked struct {
+		SetupToken string `json:"setup_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &blocked)
+	var last int
+	for i := 0; i <= maxTOTPSetupAttempts; i++ {
+		w = httptest.NewRecorder()
+		SetupEnableTOTP(w, postJSON("/api/v1/auth/totp/setup/enable", map[string]string{"setup_token": blocked.SetupToken, "code": "000000"}))
+		last = w.Code
+	}
+	if last != http.StatusTooManyRequests {
+		t.Errorf("attempt %d status = %d, want 429", maxTOTPSetupAttempts+1, last)
+	}
+}
+
+func TestLogin_Require2FAByTeam(t *testing.T) {
+	setupTOTPTest(t)
+	bob := createUserWithPassword(t, "bob", "pw", "user")
+	team := database.Team{Name: "ops", Require2FA: true}
+	database.CreateTeam(&team)
+	database.SetTeamMember(team.ID, bob.ID, "user")
+
+	w := httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "bob", "password": "pw"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("team member without 2FA: status = %d, want 403", w.Code)
+	}
+
+	// A passkey satisfies the policy, but not through the password form.
+	database.SaveWebAuthnCredential(&database.WebAuthnCredential{ID: "cred", UserID: bob.ID, PublicKey: []byte{1}})
+	w = httptest.NewRecorder()
+	Login(w, postJSON("/api/v1/auth/login", map[string]string{"username": "bob", "password": "pw"}))
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusForbidden || body["setup_token"] != nil {
+		t.Errorf("passkey holder: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDisableTOTP_BlockedByPolicy(t *testing.T) {
+	setupTOTPTest(t)
+	admin := createUserWithPassword(t, "root", "pw", "admin")
+	secret, _ := enrollTOTPFor(t, admin)
+	database.SetSetting(database.Require2FARolesSetting, "admin")
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	w := httptest.NewRecorder()
+	DisableTOTP(w, tokenRequest("POST", "/api/v1/auth/totp/disable", admin, nil, map[string]string{"code": code}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("disable under policy: status = %d, want 403", w.Code)
+	}
+
+	database.SetSetting(database.Require2FARolesSetting, "")
+	w = httptest.NewRecorder()
+	DisableTOTP(w, tokenRequest("POST", "/api/v1/auth/totp/disable", admin, nil, map[string]string{"code": code}))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("disable status = %d: %s", w.Code, w.Body.String())
+	}
+	u, _ := database.GetUserByID(admin.ID)
+	if u.TOTPEnabled || u.TOTPSecret != "" || database.CountUnusedRecoveryCodes(admin.ID) != 0 {
+		t.Errorf("TOTP state not cleared: %+v", u)
+	}
+}
+
+func TestNormalizeRequire2FARoles(t *testing.T) {
+	if got, ok := normalizeRequire2FARoles(" admin, user,admin,"); !ok || got != "admin,user" {
+		t.Errorf("got %q, %v", got, ok)
+	}
+	if _, ok := normalizeRequire2FARoles("admin,root"); ok {
+		t.Errorf("unknown role accepted")
+	}
+}
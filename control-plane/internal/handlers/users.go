@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/auth"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
@@ -77,13 +78,14 @@ func ListUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type userResponse struct {
-		ID          uint          `json:"id"`
-		Username    string        `json:"username"`
-		Role        string        `json:"role"`
-		LastLoginAt string        `json:"last_login_at"`
-		CreatedAt   string        `json:"created_at"`
-		Teams       []teamRef     `json:"teams"`
-		Instances   []instanceRef `json:"instances"`
+		ID              uint          `json:"id"`
+		Username        string        `json:"username"`
+		Role            string        `json:"role"`
+		LastLoginAt     string        `json:"last_login_at"`
+		CreatedAt       string        `json:"created_at"`
+		Teams           []teamRef     `json:"teams"`
+		Instances       []instanceRef `json:"instances"`
+		SFTPMaxUploadMB int           `json:"sftp_max_upload_mb"` // SSH gateway upload cap, 0 = unlimited
 	}
 	result := make([]userResponse, 0, len(users))
 	for _, u := range users {
@@ -100,13 +102,14 @@ func ListUsers(w http.ResponseWriter, r *http.Request) {
 			ins = []instanceRef{}
 		}
 		result = append(result, userResponse{
-			ID:          u.ID,
-			Username:    u.Username,
-			Role:        u.Role,
-			LastLoginAt: lastLogin,
-			CreatedAt:   formatTimestamp(u.CreatedAt),
-			Teams:       t,
-			Instances:   ins,
+			ID:              u.ID,
+			Username:        u.Username,
+			Role:            u.Role,
+			LastLoginAt:     lastLogin,
+			CreatedAt:       formatTimestamp(u.CreatedAt),
+			Teams:           t,
+			Instances:       ins,
+			SFTPMaxUploadMB: u.SFTPMaxUploadMB,
 		})
 	}
 
@@ -152,6 +155,9 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusConflict, "Username already exists")
 		return
 	}
+	audit.SetAction(r, "user.create")
+	audit.SetTarget(r, "user", user.ID, user.Username)
+	audit.SetChange(r, nil, user)
 
 	var totalUsers int64
 	database.DB.Model(&database.User{}).Count(&totalUsers)
@@ -184,10 +190,16 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var before database.User
+	database.DB.First(&before, id)
+	audit.SetAction(r, "user.delete")
+	audit.SetTarget(r, "user", id, before.Username)
+
 	if err := database.DeleteUser(uint(id)); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
+	audit.SetChange(r, before, nil)
 
 	// Invalidate all sessions for the deleted user
 	SessionStore.DeleteByUserID(uint(id))
@@ -227,16 +239,56 @@ func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var user database.User
+	database.DB.First(&user, id)
+	audit.SetAction(r, "user.role_change")
+	audit.SetTarget(r, "user", id, user.Username)
+
 	if err := database.DB.Model(&database.User{}).Where("id = ?", id).Update("role", body.Role).Error; err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to update role")
 		return
 	}
+	audit.SetChange(r, map[string]string{"role": user.Role}, map[string]string{"role": body.Role})
 
 	analyticsTrackUserUpdated(r, uint(id))
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// UpdateUserSFTPLimit sets the largest file (in MB) the user may upload
+// through the SSH gateway. 0 removes the limit.
+func UpdateUserSFTPLimit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var body struct {
+		MaxUploadMB int `json:"max_upload_mb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if body.MaxUploadMB < 0 {
+		writeError(w, http.StatusBadRequest, "max_upload_mb must be 0 (unlimited) or positive")
+		return
+	}
+
+	res := database.DB.Model(&database.User{}).Where("id = ?", id).Update("sftp_max_upload_mb", body.MaxUploadMB)
+	if res.Error != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update upload limit")
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"sftp_max_upload_mb": body.MaxUploadMB})
+}
+
 // analyticsTrackUserUpdated emits a user_updated event with the canonical
 // prop set used for both permission and role updates.
 func analyticsTrackUserUpdated(r *http.Request, userID uint) {
@@ -280,3 +280,37 @@ func TestResetUserPassword_EmptyPassword(t *testing.T) {
 		t.Errorf("status = %d, want 400", w.Code)
 	}
 }
+
+func TestUpdateUserSFTPLimit(t *testing.T) {
+	setupAuthTest(t)
+	admin := createUserWithPassword(t, "admin", "p", "admin")
+	target := createUserWithPassword(t, "user", "p", "user")
+
+	req := postJSON("/api/v1/users/"+fmt.Sprint(target.ID)+"/sftp-limit", map[string]int{"max_upload_mb": -1})
+	req = withChiAndUser(req, admin, map[string]string{"userId": fmt.Sprint(target.ID)})
+	w := httptest.NewRecorder()
+	UpdateUserSFTPLimit(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative limit: status = %d, want 400", w.Code)
+	}
+
+	req = postJSON("/api/v1/users/"+fmt.Sprint(target.ID)+"/sftp-limit", map[string]int{"max_upload_mb": 50})
+	req = withChiAndUser(req, admin, map[string]string{"userId": fmt.Sprint(target.ID)})
+	w = httptest.NewRecorder()
+	UpdateUserSFTPLimit(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	updated, _ := database.GetUserByID(target.ID)
+	if updated.SFTPMaxUploadMB != 50 {
+		t.Errorf("sftp_max_upload_mb = %d, want 50", updated.SFTPMaxUploadMB)
+	}
+
+	req = postJSON("/api/v1/users/9999/sftp-limit", map[string]int{"max_upload_mb": 1})
+	req = withChiAndUser(req, admin, map[string]string{"userId": "9999"})
+	w = httptest.NewRecorder()
+	UpdateUserSFTPLimit(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status = %d, want 404", w.Code)
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const webhookSessionPrefix = "claworc-webhook-"
@@ -43,6 +45,10 @@ type WebhookAttachment struct {
 // HTTP request context — its cancellation (client disconnect) or deadline
 // (client HTTP timeout) terminates the call.
 func RunWebhookBridge(ctx context.Context, instanceID uint, sessionName, message string, attachments []WebhookAttachment) (reply string, err error) {
+	ctx, span := tracing.Start(ctx, "webhook.bridge", tracing.InstanceID(instanceID),
+		attribute.Int("webhook.attachments", len(attachments)))
+	defer func() { tracing.End(span, err) }()
+
 	if sessionName == "" {
 		return "", fmt.Errorf("session_name is required")
 	}
@@ -94,7 +100,9 @@ func RunWebhookBridge(ctx context.Context, instanceID uint, sessionName, message
 	}
 
 	dialCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	dialCtx, dialSpan := tracing.Start(dialCtx, "webhook.bridge.dial_gateway")
 	gwConn, err := sshproxy.DialGateway(dialCtx, port, gatewayToken)
+	tracing.End(dialSpan, err)
 	cancel()
 	if err != nil {
 		return "", fmt.Errorf("dial gateway: %w", err)
@@ -129,6 +137,12 @@ func RunWebhookBridge(ctx context.Context, instanceID uint, sessionName, message
 		idle = 120 * time.Second
 	}
 
+	// The wait span covers the agent's whole turn, from chat.send until the
+	// lifecycle end frame; its events mark the first and last frames seen.
+	_, waitSpan := tracing.Start(ctx, "webhook.bridge.await_reply")
+	defer waitSpan.End()
+	sawFirst := false
+
 	var assistantText string
 	for {
 		readCtx, cancel := context.WithTimeout(ctx, idle)
@@ -152,6 +166,10 @@ func RunWebhookBridge(ctx context.Context, instanceID uint, sessionName, message
 		if msg["type"] != "event" {
 			continue
 		}
+		if !sawFirst {
+			waitSpan.AddEvent("first event")
+			sawFirst = true
+		}
 		payload, _ := msg["payload"].(map[string]any)
 		if payload == nil {
 			continue
@@ -171,6 +189,7 @@ func RunWebhookBridge(ctx context.Context, instanceID uint, sessionName, message
 			if eventData != nil {
 				phase, _ := eventData["phase"].(string)
 				if phase == "end" {
+					waitSpan.SetAttributes(attribute.Int("webhook.reply_bytes", len(assistantText)))
 					log.Printf("[webhook-bridge] instance=%d session=%s done bytes=%d", instanceID, utils.SanitizeForLog(sessionName), len(assistantText))
 					return assistantText, nil
 				}
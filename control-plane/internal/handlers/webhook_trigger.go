@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
 	"github.com/go-chi/chi/v5"
@@ -258,6 +259,16 @@ func runWebhookRequest(w http.ResponseWriter, r *http.Request, isPrivate bool) {
 	database.DB.Model(&database.WebhookApiKey{}).Where("id = ?", key.ID).
 		Update("last_used_at", &now)
 
+	activity.Touch(inst.ID)
+	if inst.Status == StatusHibernated {
+		if err := WakeInstance(r.Context(), &inst); err != nil {
+			logRow.StatusCode = http.StatusServiceUnavailable
+			logRow.ErrorMessage = "wake: " + err.Error()
+			http.Error(w, "instance is hibernated and failed to wake", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
 	reply, err := runWebhookBridge(r.Context(), inst.ID, call.SessionName, call.Message, call.Attachments)
 	if err != nil {
 		logRow.StatusCode = http.StatusBadGateway
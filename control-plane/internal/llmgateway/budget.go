@@ -0,0 +1,215 @@
+// budget.go enforces LLMBudget spend caps. Spend is the sum of
+// LLMRequestLog.CostUSD in llm-logs.db, so caps are only as accurate as the
+// cost config on each provider's models — unpriced models never count.
+
+package llmgateway
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// BudgetWindow is the spend state of one window (daily, monthly or total)
+// of a budget. LimitUSD == 0 means the window is uncapped.
+type BudgetWindow struct {
+	LimitUSD float64   `json:"limit_usd"`
+	SpentUSD float64   `json:"spent_usd"`
+	Since    time.Time `json:"since"`
+	// ResetsAt is when the window rolls over; nil for the total window.
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// Exceeded reports whether the window has a cap and spend has reached it.
+func (w BudgetWindow) Exceeded() bool {
+	return w.LimitUSD > 0 && w.SpentUSD >= w.LimitUSD
+}
+
+// Percent returns spend as a percentage of the cap, or 0 when uncapped.
+func (w BudgetWindow) Percent() float64 {
+	if w.LimitUSD <= 0 {
+		return 0
+	}
+	return w.SpentUSD / w.LimitUSD * 100
+}
+
+// BudgetStatus is a budget together with its current spend in every window.
+type BudgetStatus struct {
+	Budget  database.LLMBudget `json:"budget"`
+	Daily   BudgetWindow       `json:"daily"`
+	Monthly BudgetWindow       `json:"monthly"`
+	Total   BudgetWindow       `json:"total"`
+	// Exceeded is true when any capped window is at or over its limit.
+	Exceeded bool `json:"exceeded"`
+	// Warning is true when any capped window has crossed WarnPercent but
+	// none is exceeded.
+	Warning bool `json:"warning"`
+}
+
+// windows returns the three windows in a fixed order with their names, for
+// callers that need to iterate.
+func (s *BudgetStatus) windows() []struct {
+	name string
+	w    BudgetWindow
+} {
+	return []struct {
+		name string
+		w    BudgetWindow
+	}{{"daily", s.Daily}, {"monthly", s.Monthly}, {"total", s.Total}}
+}
+
+// budgetNow is overridable in tests.
+var budgetNow = func() time.Time { return time.Now().UTC() }
+
+// GetBudgetStatus computes the current spend of b in each window.
+func GetBudgetStatus(b database.LLMBudget) (BudgetStatus, error) {
+	now := budgetNow()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	totalStart := time.Time{}
+	if b.ResetAt != nil {
+		reset := b.ResetAt.UTC()
+		totalStart = reset
+		if reset.After(dayStart) {
+			dayStart = reset
+		}
+		if reset.After(monthStart) {
+			monthStart = reset
+		}
+	}
+
+	st := BudgetStatus{
+		Budget:  b,
+		Daily:   BudgetWindow{LimitUSD: b.DailyLimitUSD, Since: dayStart, ResetsAt: &dayEnd},
+		Monthly: BudgetWindow{LimitUSD: b.MonthlyLimitUSD, Since: monthStart, ResetsAt: &monthEnd},
+		Total:   BudgetWindow{LimitUSD: b.TotalLimitUSD, Since: totalStart},
+	}
+
+	if database.LogsDB == nil {
+		return st, nil
+	}
+	q := database.LogsDB.Model(&database.LLMRequestLog{})
+	switch b.Scope {
+	case database.BudgetScopeInstance:
+		q = q.Where("instance_id = ?", b.ScopeID)
+	case database.BudgetScopeProvider:
+		q = q.Where("provider_id = ?", b.ScopeID)
+	case database.BudgetScopeTeam:
+		// LogsDB may be a separate database, so resolve team → instance IDs
+		// in main and filter by IN-set (same approach as GetUsageStats).
+		var ids []uint
+		if err := database.DB.Model(&database.Instance{}).
+			Where("team_id = ?", b.ScopeID).Pluck("id", &ids).Error; err != nil {
+			return st, fmt.Errorf("resolve team instances: %w", err)
+		}
+		if len(ids) == 0 {
+			return st, nil
+		}
+		q = q.Where("instance_id IN ?", ids)
+	default:
+		return st, fmt.Errorf("unknown budget scope %q", b.Scope)
+	}
+
+	// One scan for all three windows. CASE/SUM/COALESCE are portable across
+	// SQLite, Postgres and MySQL.
+	var sums struct {
+		Daily   float64
+		Monthly float64
+		Total   float64
+	}
+	if err := q.Where("requested_at >= ?", totalStart).Select(
+		"COALESCE(SUM(CASE WHEN requested_at >= ? THEN cost_usd ELSE 0 END), 0) AS daily, "+
+			"COALESCE(SUM(CASE WHEN requested_at >= ? THEN cost_usd ELSE 0 END), 0) AS monthly, "+
+			"COALESCE(SUM(cost_usd), 0) AS total",
+		dayStart, monthStart,
+	).Scan(&sums).Error; err != nil {
+		return st, fmt.Errorf("sum spend: %w", err)
+	}
+	st.Daily.SpentUSD = sums.Daily
+	st.Monthly.SpentUSD = sums.Monthly
+	st.Total.SpentUSD = sums.Total
+
+	for _, win := range st.windows() {
+		if win.w.Exceeded() {
+			st.Exceeded = true
+		} else if b.WarnPercent > 0 && win.w.LimitUSD > 0 && win.w.Percent() >= float64(b.WarnPercent) {
+			st.Warning = true
+		}
+	}
+	if st.Exceeded {
+		st.Warning = false
+	}
+	return st, nil
+}
+
+// budgetBreach describes the first exceeded window found for a request.
+type budgetBreach struct {
+	scope   string
+	scopeID uint
+	window  string
+	limit   float64
+	// retryAfter is the time until the window rolls over; zero for the
+	// total window, which only an admin reset clears.
+	retryAfter time.Duration
+}
+
+func (b *budgetBreach) message() string {
+	return fmt.Sprintf("LLM budget exceeded: %s %s limit of $%.2f reached", b.scope, b.window, b.limit)
+}
+
+// budgetWarned de-duplicates soft-warning log lines to one per budget,
+// window and period.
+var budgetWarned sync.Map
+
+// checkBudgets evaluates every budget that applies to a request from
+// instanceID routed to providerID. It returns the first breach (nil when
+// the request may proceed) and a list of human-readable soft warnings.
+//
+// Errors loading or summing budgets fail open: a broken logs DB must not
+// take down every agent, and the failure is logged.
+func checkBudgets(instanceID, providerID uint) (*budgetBreach, []string) {
+	if database.DB == nil {
+		return nil, nil
+	}
+	var teamID uint
+	database.DB.Model(&database.Instance{}).Select("team_id").Where("id = ?", instanceID).Scan(&teamID)
+
+	budgets, err := database.BudgetsForRequest(instanceID, teamID, providerID)
+	if err != nil {
+		log.Printf("[gateway] budget lookup failed (allowing request): %v", err)
+		return nil, nil
+	}
+
+	var warnings []string
+	now := budgetNow()
+	for _, b := range budgets {
+		st, err := GetBudgetStatus(b)
+		if err != nil {
+			log.Printf("[gateway] budget %d status failed (allowing request): %v", b.ID, err)
+			continue
+		}
+		for _, win := range st.windows() {
+			if win.w.Exceeded() {
+				breach := &budgetBreach{scope: b.Scope, scopeID: b.ScopeID, window: win.name, limit: win.w.LimitUSD}
+				if win.w.ResetsAt != nil {
+					breach.retryAfter = win.w.ResetsAt.Sub(now)
+				}
+				return breach, nil
+			}
+			if b.WarnPercent > 0 && win.w.LimitUSD > 0 && win.w.Percent() >= float64(b.WarnPercent) {
+				warnings = append(warnings, fmt.Sprintf("%s %s %.0f%%", b.Scope, win.name, win.w.Percent()))
+				key := fmt.Sprintf("%d:%s:%s", b.ID, win.name, win.w.Since.Format(time.RFC3339))
+				if _, dup := budgetWarned.LoadOrStore(key, struct{}{}); !dup {
+					log.Printf("[gateway] budget warning: %s %d %s spend $%.4f of $%.2f (%.0f%%)",
+						b.Scope, b.ScopeID, win.name, win.w.SpentUSD, win.w.LimitUSD, win.w.Percent())
+				}
+			}
+		}
+	}
+	return nil, warnings
+}
@@ -0,0 +1,197 @@
+package llmgateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// mustSpend records a successful request costing costUSD at the given time.
+func mustSpend(t *testing.T, instanceID, providerID uint, costUSD float64, at time.Time) {
+	t.Helper()
+	if err := database.LogsDB.Create(&database.LLMRequestLog{
+		InstanceID:  instanceID,
+		ProviderID:  providerID,
+		ModelID:     "m",
+		CostUSD:     costUSD,
+		StatusCode:  200,
+		RequestedAt: at,
+	}).Error; err != nil {
+		t.Fatalf("create usage log: %v", err)
+	}
+}
+
+func mustBudget(t *testing.T, b database.LLMBudget) database.LLMBudget {
+	t.Helper()
+	if err := database.UpsertLLMBudget(&b); err != nil {
+		t.Fatalf("upsert budget: %v", err)
+	}
+	return b
+}
+
+// fixBudgetNow pins budgetNow for the duration of the test.
+func fixBudgetNow(t *testing.T, now time.Time) {
+	t.Helper()
+	prev := budgetNow
+	budgetNow = func() time.Time { return now }
+	t.Cleanup(func() { budgetNow = prev })
+}
+
+func TestGetBudgetStatus_Windows(t *testing.T) {
+	setupDB(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	fixBudgetNow(t, now)
+
+	mustSpend(t, 1, 9, 1.0, now.Add(-time.Hour))     // today
+	mustSpend(t, 1, 9, 2.0, now.AddDate(0, 0, -3))   // this month
+	mustSpend(t, 1, 9, 4.0, now.AddDate(0, -2, 0))   // earlier
+	mustSpend(t, 2, 9, 100.0, now.Add(-time.Minute)) // other instance
+
+	b := mustBudget(t, database.LLMBudget{
+		Scope: database.BudgetScopeInstance, ScopeID: 1,
+		DailyLimitUSD: 10, MonthlyLimitUSD: 10, TotalLimitUSD: 10, WarnPercent: 50,
+	})
+	st, err := GetBudgetStatus(b)
+	if err != nil {
+		t.Fatalf("GetBudgetStatus: %v", err)
+	}
+	if st.Daily.SpentUSD != 1 || st.Monthly.SpentUSD != 3 || st.Total.SpentUSD != 7 {
+		t.Errorf("spend = %v/%v/%v, want 1/3/7", st.Daily.SpentUSD, st.Monthly.SpentUSD, st.Total.SpentUSD)
+	}
+	if st.Exceeded {
+		t.Error("expected not exceeded")
+	}
+	if !st.Warning {
+		t.Error("expected warning at 70% of total with warn_percent=50")
+	}
+
+	// Provider scope sums across instances.
+	pb := mustBudget(t, database.LLMBudget{Scope: database.BudgetScopeProvider, ScopeID: 9, DailyLimitUSD: 50})
+	pst, err := GetBudgetStatus(pb)
+	if err != nil {
+		t.Fatalf("GetBudgetStatus provider: %v", err)
+	}
+	if pst.Daily.SpentUSD != 101 || !pst.Exceeded {
+		t.Errorf("provider daily = %v exceeded=%v, want 101/true", pst.Daily.SpentUSD, pst.Exceeded)
+	}
+}
+
+func TestGetBudgetStatus_ResetAtFloorsAllWindows(t *testing.T) {
+	setupDB(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	fixBudgetNow(t, now)
+
+	mustSpend(t, 1, 9, 5.0, now.Add(-2*time.Hour))
+	mustSpend(t, 1, 9, 1.0, now.Add(-10*time.Minute))
+
+	reset := now.Add(-time.Hour)
+	b := mustBudget(t, database.LLMBudget{Scope: database.BudgetScopeInstance, ScopeID: 1, DailyLimitUSD: 5})
+	b.ResetAt = &reset
+	st, err := GetBudgetStatus(b)
+	if err != nil {
+		t.Fatalf("GetBudgetStatus: %v", err)
+	}
+	if st.Daily.SpentUSD != 1 || st.Total.SpentUSD != 1 {
+		t.Errorf("after reset daily=%v total=%v, want 1/1", st.Daily.SpentUSD, st.Total.SpentUSD)
+	}
+	if st.Exceeded {
+		t.Error("reset should clear the breach")
+	}
+}
+
+func TestHandleProxy_BudgetExceeded_DialectError(t *testing.T) {
+	cases := []struct {
+		apiType string
+		check   func(t *testing.T, body map[string]any)
+	}{
+		{"anthropic-messages", func(t *testing.T, body map[string]any) {
+			if body["type"] != "error" {
+				t.Errorf("type = %v, want error", body["type"])
+			}
+			e, _ := body["error"].(map[string]any)
+			if e["type"] != "rate_limit_error" {
+				t.Errorf("error.type = %v, want rate_limit_error", e["type"])
+			}
+		}},
+		{"openai-completions", func(t *testing.T, body map[string]any) {
+			e, _ := body["error"].(map[string]any)
+			if e["code"] != "budget_exceeded" {
+				t.Errorf("error.code = %v, want budget_exceeded", e["code"])
+			}
+		}},
+		{"google-generative-ai", func(t *testing.T, body map[string]any) {
+			e, _ := body["error"].(map[string]any)
+			if e["status"] != "RESOURCE_EXHAUSTED" || e["code"] != float64(429) {
+				t.Errorf("error = %v, want RESOURCE_EXHAUSTED/429", e)
+			}
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.apiType, func(t *testing.T) {
+			upstreamCalled := false
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalled = true
+				w.Write([]byte(`{}`))
+			}))
+			defer upstream.Close()
+
+			setupDB(t)
+			now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+			fixBudgetNow(t, now)
+			p := mustProvider(t, "p", tc.apiType, upstream.URL)
+			token := mustGatewayKey(t, 1, p.ID)
+			mustSpend(t, 1, p.ID, 2.0, now.Add(-time.Minute))
+			mustBudget(t, database.LLMBudget{Scope: database.BudgetScopeInstance, ScopeID: 1, DailyLimitUSD: 1})
+
+			rr := doRequest(t, "POST", "/v1/messages", map[string]string{"Authorization": "Bearer " + token})
+			if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d, want 429", rr.Code)
+			}
+			if upstreamCalled {
+				t.Error("upstream must not be called when over budget")
+			}
+			if ra := rr.Header().Get("Retry-After"); ra == "" {
+				t.Error("expected Retry-After for a daily cap")
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			tc.check(t, body)
+
+			var logged database.LLMRequestLog
+			database.LogsDB.Where("status_code = ?", http.StatusTooManyRequests).First(&logged)
+			if !strings.Contains(logged.ErrorMessage, "budget exceeded") {
+				t.Errorf("rejection not logged: %+v", logged)
+			}
+		})
+	}
+}
+
+func TestHandleProxy_BudgetWarningHeader(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	fixBudgetNow(t, now)
+	p := mustProvider(t, "p", "openai-completions", upstream.URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	mustSpend(t, 1, p.ID, 9.0, now.Add(-time.Minute))
+	mustBudget(t, database.LLMBudget{Scope: database.BudgetScopeProvider, ScopeID: p.ID, MonthlyLimitUSD: 10, WarnPercent: 80})
+
+	rr := doRequest(t, "POST", "/v1/chat/completions", map[string]string{"Authorization": "Bearer " + token})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+	if got := rr.Header().Get("X-Claworc-Budget-Warning"); !strings.Contains(got, "provider monthly 90%") {
+		t.Errorf("X-Claworc-Budget-Warning = %q", got)
+	}
+}
@@ -0,0 +1,259 @@
+// cache.go answers repeated requests from an in-memory response cache.
+// Caching is enabled per provider with LLMProvider.CacheTTLSeconds. Entries
+// are keyed on the provider, the request path and the normalized request
+// body, and hold the response exactly as the client received it (after any
+// dialect translation), so a cached stream is replayed as the same SSE
+// events. The cache is shared by every instance using the provider, lives
+// in this control-plane process and starts empty after a restart.
+
+package llmgateway
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// maxCacheEntryBytes caps a single cached response; larger responses are
+// passed through uncached. A var so tests can shrink it.
+var maxCacheEntryBytes = 4 << 20
+
+// cacheNow is overridable in tests.
+var cacheNow = func() time.Time { return time.Now() }
+
+// cacheIgnoredFields are top-level request fields left out of the cache
+// key: they identify the caller and do not change the response.
+var cacheIgnoredFields = []string{"user", "metadata"}
+
+// cacheEntry is one cached response.
+type cacheEntry struct {
+	key                 string
+	requestedProviderID uint
+	// providerID served the original request; it differs from
+	// requestedProviderID when a fallback hop answered.
+	providerID        uint
+	model             string
+	contentType       string
+	body              []byte
+	inputTokens       int
+	outputTokens      int
+	cachedInputTokens int
+	costUSD           float64
+	expires           time.Time
+}
+
+// responseCache is an LRU of cacheEntry bounded by total body size.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front = most recently used
+	size    int
+	// maxBytes overrides CLAWORC_LLM_CACHE_MAX_MB when non-zero.
+	maxBytes int
+}
+
+var respCache = newResponseCache()
+
+func newResponseCache() *responseCache {
+	return &responseCache{entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+func (c *responseCache) limit() int {
+	if c.maxBytes > 0 {
+		return c.maxBytes
+	}
+	return config.Cfg.LLMCacheMaxMB << 20
+}
+
+// get returns the live entry for key, or nil. Expired entries are dropped.
+func (c *responseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if !cacheNow().Before(e.expires) {
+		c.remove(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e
+}
+
+// put stores e, replacing any entry with the same key, and evicts the least
+// recently used entries until the cache fits its size limit.
+func (c *responseCache) put(e *cacheEntry) {
+	maxBytes := c.limit()
+	if len(e.body) > maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += len(e.body)
+	for c.size > maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops el. Callers hold c.mu.
+func (c *responseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= len(e.body)
+}
+
+// ClearResponseCache drops every cached response for requests made against
+// providerID. Called when a provider is changed or deleted so its cache
+// does not outlive its configuration.
+func ClearResponseCache(providerID uint) {
+	c := respCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cacheEntry).requestedProviderID == providerID {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+// cacheTTLFor returns the response cache TTL of a provider, 0 when caching
+// is disabled. Lookup errors disable caching for the request.
+func cacheTTLFor(providerID uint) time.Duration {
+	if database.DB == nil {
+		return 0
+	}
+	var ttl int
+	if err := database.DB.Model(&database.LLMProvider{}).Where("id = ?", providerID).
+		Select("cache_ttl_seconds").Scan(&ttl).Error; err != nil || ttl <= 0 {
+		return 0
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// cacheBypassed reports whether the client asked not to be served from (or
+// stored in) the cache with Cache-Control: no-cache or no-store.
+func cacheBypassed(r *http.Request) bool {
+	cc := strings.ToLower(r.Header.Get("Cache-Control"))
+	return strings.Contains(cc, "no-cache") || strings.Contains(cc, "no-store")
+}
+
+// responseCacheKey hashes the provider, path, query and normalized body of
+// a request. Normalizing decodes the JSON body and re-encodes it with
+// sorted keys and without cacheIgnoredFields, so formatting and key order
+// do not matter. Only POST requests with a JSON object body are cacheable.
+func responseCacheKey(providerID uint, r *http.Request, body []byte) (string, bool) {
+	if r.Method != http.MethodPost {
+		return "", false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var req map[string]interface{}
+	if err := dec.Decode(&req); err != nil {
+		return "", false
+	}
+	for _, f := range cacheIgnoredFields {
+		delete(req, f)
+	}
+	normalized, err := json.Marshal(req)
+	if err != nil {
+		return "", false
+	}
+	query := r.URL.Query()
+	query.Del("key")
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n", providerID, r.URL.Path, query.Encode())
+	h.Write(normalized)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// cacheable reports whether a response captured by cw may be stored.
+// Streams are only kept when usage was reported, which every dialect sends
+// in its final events, so a stream cut off midway is never cached.
+func cacheable(cw *captureWriter, status int, errMsg string, outputTokens int) bool {
+	if status != http.StatusOK || errMsg != "" || cw.truncated {
+		return false
+	}
+	if strings.Contains(cw.Header().Get("Content-Type"), "text/event-stream") {
+		return outputTokens > 0
+	}
+	return true
+}
+
+// serveCached writes a cached response. Streams are written one SSE event
+// at a time with a flush after each, like a live stream.
+func serveCached(w http.ResponseWriter, e *cacheEntry) {
+	streaming := strings.Contains(e.contentType, "text/event-stream")
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Claworc-Cache", "HIT")
+	if streaming {
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	w.WriteHeader(http.StatusOK)
+	if !streaming {
+		w.Write(e.body) //nolint:errcheck
+		return
+	}
+	flusher, canFlush := w.(http.Flusher)
+	rest := e.body
+	for len(rest) > 0 {
+		n := bytes.Index(rest, []byte("\n\n"))
+		if n < 0 {
+			n = len(rest)
+		} else {
+			n += 2
+		}
+		if _, err := w.Write(rest[:n]); err != nil {
+			return
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+		rest = rest[n:]
+	}
+}
+
+// logCacheHit records a cache hit in llm-logs.db with the tokens of the
+// cached response, zero cost, and the original cost as SavedCostUSD.
+func logCacheHit(instanceID, requestedProviderID uint, e *cacheEntry, latencyMs int64) {
+	observeRequest(instanceID, e.providerID, e.model, e.inputTokens, e.outputTokens, e.cachedInputTokens, 0, http.StatusOK, latencyMs)
+	observeCacheHit(instanceID, e.providerID, e.model, e.costUSD)
+	if database.LogsDB == nil {
+		return
+	}
+	if err := database.LogsDB.Create(&database.LLMRequestLog{
+		InstanceID:          instanceID,
+		ProviderID:          e.providerID,
+		ModelID:             e.model,
+		InputTokens:         e.inputTokens,
+		OutputTokens:        e.outputTokens,
+		CachedInputTokens:   e.cachedInputTokens,
+		StatusCode:          http.StatusOK,
+		LatencyMs:           latencyMs,
+		RequestedAt:         time.Now().UTC(),
+		RequestedProviderID: requestedProviderID,
+		CacheHit:            true,
+		SavedCostUSD:        e.costUSD,
+	}).Error; err != nil {
+		log.Printf("[gateway] failed to write usage log: %v", err)
+	}
+}
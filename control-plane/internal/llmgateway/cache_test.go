@@ -0,0 +1,251 @@
+package llmgateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// countingUpstream answers with body and counts the requests it receives.
+func countingUpstream(t *testing.T, contentType, body string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func enableCache(t *testing.T, providerID uint, ttlSeconds int) {
+	t.Helper()
+	if err := database.DB.Model(&database.LLMProvider{}).Where("id = ?", providerID).
+		Update("cache_ttl_seconds", ttlSeconds).Error; err != nil {
+		t.Fatalf("enable cache: %v", err)
+	}
+}
+
+func TestCache_HitServedWithoutUpstream(t *testing.T) {
+	upstream, calls := countingUpstream(t, "application/json",
+		`{"choices":[{"message":{"content":"hello"}}],"usage":{"prompt_tokens":1000,"completion_tokens":500}}`)
+	setupDB(t)
+	p := mustProviderWithModels(t, "openai", "openai-completions", upstream.URL,
+		[]database.ProviderModel{{ID: "gpt-4o", Cost: &database.ProviderModelCost{Input: 2, Output: 8}}})
+	enableCache(t, p.ID, 60)
+	tokenA := mustGatewayKey(t, 1, p.ID)
+	tokenB := mustGatewayKey(t, 2, p.ID)
+
+	first := doBodyRequest(t, "/chat/completions", tokenA, `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"user":"a"}`)
+	if first.Code != http.StatusOK || first.Header().Get("X-Claworc-Cache") != "MISS" {
+		t.Fatalf("first: %d cache=%q", first.Code, first.Header().Get("X-Claworc-Cache"))
+	}
+	// Same request from another instance, with different key order,
+	// whitespace and end-user id.
+	second := doBodyRequest(t, "/chat/completions", tokenB, `{ "messages":[{"content":"hi","role":"user"}], "model":"gpt-4o", "user":"b" }`)
+	if second.Code != http.StatusOK || second.Header().Get("X-Claworc-Cache") != "HIT" {
+		t.Fatalf("second: %d cache=%q", second.Code, second.Header().Get("X-Claworc-Cache"))
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("cached body = %s, want %s", second.Body.String(), first.Body.String())
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("upstream calls = %d, want 1", n)
+	}
+
+	l := lastLog(t)
+	if !l.CacheHit || l.InstanceID != 2 || l.CostUSD != 0 || l.InputTokens != 1000 || l.OutputTokens != 500 {
+		t.Errorf("hit log = %+v", l)
+	}
+	if l.SavedCostUSD != 0.006 {
+		t.Errorf("saved cost = %v, want 0.006", l.SavedCostUSD)
+	}
+}
+
+func TestCache_DisabledByDefault(t *testing.T) {
+	upstream, calls := countingUpstream(t, "application/json", `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	for i := 0; i < 2; i++ {
+		rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+		if rr.Header().Get("X-Claworc-Cache") != "" {
+			t.Errorf("cache header set with caching disabled: %q", rr.Header().Get("X-Claworc-Cache"))
+		}
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+}
+
+func TestCache_DifferentBodiesMiss(t *testing.T) {
+	upstream, calls := countingUpstream(t, "application/json", `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 60)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","temperature":0}`)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","temperature":0.5}`)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","temperature":0,"stream":true}`)
+	if n := atomic.LoadInt32(calls); n != 3 {
+		t.Errorf("upstream calls = %d, want 3", n)
+	}
+}
+
+func TestCache_StreamReplayedAsEvents(t *testing.T) {
+	sse := "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n" +
+		"data: [DONE]\n\n"
+	upstream, calls := countingUpstream(t, "text/event-stream", sse)
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 60)
+	token := mustGatewayKey(t, 1, p.ID)
+	body := `{"model":"m","stream":true}`
+
+	doBodyRequest(t, "/chat/completions", token, body)
+
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	fr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handleProxy(fr, req)
+
+	if atomic.LoadInt32(calls) != 1 || fr.Header().Get("X-Claworc-Cache") != "HIT" {
+		t.Fatalf("expected a cache hit, upstream calls = %d", atomic.LoadInt32(calls))
+	}
+	if fr.Body.String() != sse {
+		t.Errorf("replayed stream = %q", fr.Body.String())
+	}
+	if ct := fr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type = %q", ct)
+	}
+	if fr.flushCount != 4 {
+		t.Errorf("flushes = %d, want one per event (4)", fr.flushCount)
+	}
+	if l := lastLog(t); !l.CacheHit || l.InputTokens != 5 || l.OutputTokens != 2 {
+		t.Errorf("hit log = %+v", l)
+	}
+}
+
+func TestCache_IncompleteStreamNotCached(t *testing.T) {
+	upstream, calls := countingUpstream(t, "text/event-stream", "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 60)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","stream":true}`)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","stream":true}`)
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+}
+
+func TestCache_ErrorsNotCached(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad"}}`))
+	}))
+	defer upstream.Close()
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 60)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+}
+
+func TestCache_ExpiresAfterTTL(t *testing.T) {
+	upstream, calls := countingUpstream(t, "application/json", `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 30)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	prev := cacheNow
+	cacheNow = func() time.Time { return now }
+	defer func() { cacheNow = prev }()
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	now = now.Add(29 * time.Second)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Fatalf("upstream calls within TTL = %d, want 1", n)
+	}
+	now = now.Add(2 * time.Second)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("upstream calls after TTL = %d, want 2", n)
+	}
+}
+
+func TestCache_NoCacheHeaderBypasses(t *testing.T) {
+	upstream, calls := countingUpstream(t, "application/json", `{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1}}`)
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	enableCache(t, p.ID, 60)
+	token := mustGatewayKey(t, 1, p.ID)
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	req := httptest.NewRequest("POST", "/chat/completions", strings.NewReader(`{"model":"m"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Cache-Control", "no-cache")
+	handleProxy(httptest.NewRecorder(), req)
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("upstream calls = %d, want 2", n)
+	}
+}
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResponseCache()
+	c.maxBytes = 10
+	expires := time.Now().Add(time.Hour)
+	c.put(&cacheEntry{key: "a", body: []byte("aaaa"), expires: expires})
+	c.put(&cacheEntry{key: "b", body: []byte("bbbb"), expires: expires})
+	c.get("a")
+	c.put(&cacheEntry{key: "c", body: []byte("cccc"), expires: expires})
+
+	if c.get("b") != nil {
+		t.Error("least recently used entry b should have been evicted")
+	}
+	if c.get("a") == nil || c.get("c") == nil {
+		t.Error("entries a and c should still be cached")
+	}
+	if c.size != 8 {
+		t.Errorf("size = %d, want 8", c.size)
+	}
+	c.put(&cacheEntry{key: "big", body: []byte("0123456789x"), expires: expires})
+	if c.get("big") != nil {
+		t.Error("entry larger than the cache must not be stored")
+	}
+}
+
+func TestClearResponseCache(t *testing.T) {
+	respCache = newResponseCache()
+	respCache.maxBytes = 1 << 10
+	expires := time.Now().Add(time.Hour)
+	respCache.put(&cacheEntry{key: "a", requestedProviderID: 1, body: []byte("x"), expires: expires})
+	respCache.put(&cacheEntry{key: "b", requestedProviderID: 2, body: []byte("y"), expires: expires})
+
+	ClearResponseCache(1)
+	if respCache.get("a") != nil || respCache.get("b") == nil {
+		t.Error("only provider 1's entries should be cleared")
+	}
+}
@@ -0,0 +1,357 @@
+// capture.go stores full request/response pairs for instances that opted in
+// with an LLMCapturePolicy. Bodies are redacted before they are written to
+// the logs DB; nothing unredacted is persisted.
+
+package llmgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// maxCaptureBodyBytes caps each stored body. A var so tests can shrink it.
+var maxCaptureBodyBytes = 1 << 20
+
+// captureSkipHeaders are never stored: they carry credentials.
+var captureSkipHeaders = map[string]bool{
+	"Authorization":       true,
+	"X-Api-Key":           true,
+	"X-Goog-Api-Key":      true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// piiPatterns are applied when a policy has RedactPII set, in order, so API
+// keys are caught before the generic digit patterns see them.
+var piiPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+	// valid, when set, must accept the match for it to be redacted.
+	valid func(string) bool
+}{
+	{name: "api_key", re: regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bsk-ant-[A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|\bAIza[0-9A-Za-z_-]{35}|\bgh[pousr]_[A-Za-z0-9]{36}\b|\bclaworc-vk-[A-Za-z0-9_-]+|\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{name: "card", re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid},
+	{name: "ssn", re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{name: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b`)},
+	{name: "ipv4", re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)},
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum, which
+// keeps long non-card numbers (ids, timestamps) out of the card pattern.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// ValidateRedactPatterns compiles every pattern and returns the first error.
+func ValidateRedactPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// redactor applies a policy's redaction to captured text.
+type redactor struct {
+	pii    bool
+	custom []*regexp.Regexp
+}
+
+// compiledPatterns caches custom patterns across requests; policies are
+// re-read per request, so recompiling each time would be wasteful.
+var compiledPatterns sync.Map // string -> *regexp.Regexp
+
+func newRedactor(p *database.LLMCapturePolicy) *redactor {
+	r := &redactor{pii: p.RedactPII}
+	for _, pat := range database.ParseRedactPatterns(p.RedactPatterns) {
+		if re, ok := compiledPatterns.Load(pat); ok {
+			r.custom = append(r.custom, re.(*regexp.Regexp))
+			continue
+		}
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			// Patterns are validated on save, so this only happens if the
+			// row was edited by hand. Skip it rather than store nothing.
+			log.Printf("[gateway] capture policy %d: skipping invalid redact pattern: %v", p.ID, err)
+			continue
+		}
+		compiledPatterns.Store(pat, re)
+		r.custom = append(r.custom, re)
+	}
+	return r
+}
+
+func (r *redactor) redact(s string) string {
+	if r.pii {
+		for _, p := range piiPatterns {
+			repl := "[REDACTED:" + p.name + "]"
+			s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+				if p.valid != nil && !p.valid(m) {
+					return m
+				}
+				return repl
+			})
+		}
+	}
+	for _, re := range r.custom {
+		s = re.ReplaceAllString(s, "[REDACTED]")
+	}
+	return s
+}
+
+// capturePolicyFor returns the instance's capture policy when capture is
+// enabled, nil otherwise. Lookup errors disable capture for the request.
+func capturePolicyFor(instanceID uint) *database.LLMCapturePolicy {
+	if database.DB == nil || database.LogsDB == nil {
+		return nil
+	}
+	p, err := database.GetLLMCapturePolicy(instanceID)
+	if err != nil || !p.Enabled {
+		return nil
+	}
+	return p
+}
+
+// captureWriter tees the response the client receives, up to limit bytes,
+// while passing everything through unchanged. Capture and the response
+// cache each wrap the writer with their own limit.
+type captureWriter struct {
+	http.ResponseWriter
+	limit     int
+	status    int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if room := c.limit - c.buf.Len(); room > 0 {
+		if len(b) > room {
+			c.buf.Write(b[:room])
+			c.truncated = true
+		} else {
+			c.buf.Write(b)
+		}
+	} else if len(b) > 0 {
+		c.truncated = true
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses streaming through the wrapper.
+func (c *captureWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// captureHeaders returns the request headers worth keeping for audit and
+// replay, as JSON.
+func captureHeaders(h http.Header) string {
+	out := map[string]string{}
+	for k, v := range h {
+		if captureSkipHeaders[http.CanonicalHeaderKey(k)] || len(v) == 0 {
+			continue
+		}
+		out[http.CanonicalHeaderKey(k)] = v[0]
+	}
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// saveCapture redacts and stores one exchange. requestedProviderID is the
+// provider behind the virtual key; the hop that answered is read back from
+// the X-Claworc-Fallback-Hop response header.
+func saveCapture(p *database.LLMCapturePolicy, cw *captureWriter, r *http.Request, reqBody []byte, instanceID, requestedProviderID uint, model string, start time.Time) {
+	rd := newRedactor(p)
+	reqTruncated := false
+	if len(reqBody) > maxCaptureBodyBytes {
+		reqBody = reqBody[:maxCaptureBodyBytes]
+		reqTruncated = true
+	}
+	query := r.URL.Query()
+	query.Del("key")
+	hop, _ := strconv.Atoi(cw.Header().Get("X-Claworc-Fallback-Hop"))
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	c := database.LLMCapture{
+		InstanceID:        instanceID,
+		ProviderID:        requestedProviderID,
+		FallbackHop:       hop,
+		ModelID:           model,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Query:             rd.redact(query.Encode()),
+		RequestHeaders:    rd.redact(captureHeaders(r.Header)),
+		RequestBody:       rd.redact(string(reqBody)),
+		RequestTruncated:  reqTruncated,
+		StatusCode:        status,
+		ResponseBody:      rd.redact(cw.buf.String()),
+		ResponseTruncated: cw.truncated,
+		LatencyMs:         time.Since(start).Milliseconds(),
+		RequestedAt:       start.UTC(),
+	}
+	if err := database.LogsDB.Create(&c).Error; err != nil {
+		log.Printf("[gateway] failed to store capture for instance %d: %v", instanceID, err)
+	}
+}
+
+// ReplayResult is the gateway's response to a replayed capture.
+type ReplayResult struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// replayWriter buffers a replayed response in memory.
+type replayWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (rw *replayWriter) Header() http.Header { return rw.header }
+
+func (rw *replayWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+}
+
+func (rw *replayWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return rw.buf.Write(b)
+}
+
+func (rw *replayWriter) Flush() {}
+
+// ReplayCapture sends a captured request through the gateway again with the
+// instance's current virtual key for the same provider. It is a normal
+// gateway request: budgets, rate limits, fallbacks and usage logging all
+// apply. The replayed body is the redacted one, so redacted values are sent
+// as their placeholders.
+func ReplayCapture(ctx context.Context, c *database.LLMCapture) (*ReplayResult, error) {
+	if c.RequestTruncated {
+		return nil, fmt.Errorf("capture %d has a truncated request body and cannot be replayed", c.ID)
+	}
+	var key database.LLMGatewayKey
+	if err := database.DB.Where("instance_id = ? AND provider_id = ?", c.InstanceID, c.ProviderID).First(&key).Error; err != nil {
+		return nil, fmt.Errorf("instance %d no longer has a virtual key for provider %d", c.InstanceID, c.ProviderID)
+	}
+
+	target := (&url.URL{Scheme: "http", Host: "gateway", Path: c.Path, RawQuery: c.Query}).String()
+	req, err := http.NewRequestWithContext(ctx, c.Method, target, strings.NewReader(c.RequestBody))
+	if err != nil {
+		return nil, fmt.Errorf("build replay request: %w", err)
+	}
+	var headers map[string]string
+	json.Unmarshal([]byte(c.RequestHeaders), &headers)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Authorization", "Bearer "+key.GatewayKey)
+	req.Header.Del("Content-Length")
+
+	rw := &replayWriter{header: http.Header{}}
+	handleProxy(rw, req)
+
+	return &ReplayResult{StatusCode: rw.status, ContentType: rw.header.Get("Content-Type"), Body: rw.buf.String()}, nil
+}
+
+// captureRetentionDays reads the llm_capture_retention_days setting.
+func captureRetentionDays() int {
+	days := 30
+	if v, err := database.GetSetting("llm_capture_retention_days"); err == nil {
+		if d, err := strconv.Atoi(v); err == nil && d >= 0 {
+			days = d
+		}
+	}
+	return days
+}
+
+// PurgeExpiredCaptures applies capture retention once: per-instance
+// overrides from capture policies, the llm_capture_retention_days setting
+// for everything else.
+func PurgeExpiredCaptures() (int64, error) {
+	policies, err := database.ListLLMCapturePolicies()
+	if err != nil {
+		return 0, fmt.Errorf("list capture policies: %w", err)
+	}
+	overrides := map[uint]int{}
+	for _, p := range policies {
+		if p.RetentionDays > 0 {
+			overrides[p.InstanceID] = p.RetentionDays
+		}
+	}
+	return database.PurgeLLMCaptures(captureRetentionDays(), overrides)
+}
+
+// StartCaptureRetentionCleanup purges expired captures at startup and then
+// daily until ctx is done.
+func StartCaptureRetentionCleanup(ctx context.Context) {
+	purge := func() {
+		deleted, err := PurgeExpiredCaptures()
+		if err != nil {
+			log.Printf("[gateway] capture retention cleanup error: %v", err)
+		} else if deleted > 0 {
+			log.Printf("[gateway] purged %d expired LLM captures", deleted)
+		}
+	}
+	go func() {
+		purge()
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package llmgateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func mustCapturePolicy(t *testing.T, instanceID uint, redactPII bool, patterns ...string) {
+	t.Helper()
+	raw, _ := json.Marshal(patterns)
+	if patterns == nil {
+		raw = []byte("[]")
+	}
+	p := database.LLMCapturePolicy{InstanceID: instanceID, Enabled: true, RedactPII: redactPII, RedactPatterns: string(raw)}
+	if err := database.UpsertLLMCapturePolicy(&p); err != nil {
+		t.Fatalf("upsert capture policy: %v", err)
+	}
+}
+
+func lastCapture(t *testing.T) database.LLMCapture {
+	t.Helper()
+	var c database.LLMCapture
+	if err := database.LogsDB.Order("id DESC").First(&c).Error; err != nil {
+		t.Fatalf("no capture: %v", err)
+	}
+	return c
+}
+
+func TestCapture_StoresRedactedExchange(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"mail bob@example.com, ticket INC-4242"}}],"usage":{"prompt_tokens":3,"completion_tokens":4}}`))
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	mustCapturePolicy(t, 1, true, `INC-\d+`)
+
+	rr := doBodyRequest(t, "/chat/completions", token,
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"my card is 4111 1111 1111 1111 and key sk-abcdefghijklmnopqrstuv"}]}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "bob@example.com") {
+		t.Fatalf("client must get the unredacted response: %d %s", rr.Code, rr.Body.String())
+	}
+
+	c := lastCapture(t)
+	if c.InstanceID != 1 || c.ProviderID != p.ID || c.ModelID != "gpt-4o" || c.StatusCode != 200 || c.Path != "/chat/completions" {
+		t.Errorf("capture = %+v", c)
+	}
+	for _, leaked := range []string{"4111", "sk-abcdef", "bob@example.com", "INC-4242", token} {
+		if strings.Contains(c.RequestBody+c.ResponseBody+c.RequestHeaders, leaked) {
+			t.Errorf("capture leaks %q:\nreq %s\nresp %s\nheaders %s", leaked, c.RequestBody, c.ResponseBody, c.RequestHeaders)
+		}
+	}
+	for _, want := range []string{"[REDACTED:card]", "[REDACTED:api_key]"} {
+		if !strings.Contains(c.RequestBody, want) {
+			t.Errorf("request body missing %s: %s", want, c.RequestBody)
+		}
+	}
+	if !strings.Contains(c.ResponseBody, "[REDACTED:email]") || !strings.Contains(c.ResponseBody, "[REDACTED]") {
+		t.Errorf("response body = %s", c.ResponseBody)
+	}
+	if !strings.Contains(c.RequestHeaders, "Content-Type") {
+		t.Errorf("request headers = %s", c.RequestHeaders)
+	}
+}
+
+func TestCapture_DisabledByDefault(t *testing.T) {
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", okUpstream(t).URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	database.DB.Create(&database.LLMCapturePolicy{InstanceID: 1, Enabled: false, RedactPatterns: "[]"})
+
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	var count int64
+	database.LogsDB.Model(&database.LLMCapture{}).Count(&count)
+	if count != 0 {
+		t.Errorf("captures = %d, want 0", count)
+	}
+}
+
+func TestCapture_StreamTruncatedAtLimit(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 20; i++ {
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"chunk\"}}]}\n\n")
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	prev := maxCaptureBodyBytes
+	maxCaptureBodyBytes = 100
+	defer func() { maxCaptureBodyBytes = prev }()
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	mustCapturePolicy(t, 1, false)
+
+	rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m","stream":true}`)
+	if !strings.Contains(rr.Body.String(), "[DONE]") {
+		t.Fatalf("client stream cut short: %s", rr.Body.String())
+	}
+	c := lastCapture(t)
+	if len(c.ResponseBody) != 100 || !c.ResponseTruncated || c.RequestTruncated {
+		t.Errorf("response body %d bytes, truncated=%v/%v", len(c.ResponseBody), c.RequestTruncated, c.ResponseTruncated)
+	}
+}
+
+func TestRedactor_CardNeedsLuhn(t *testing.T) {
+	r := &redactor{pii: true}
+	got := r.redact(`{"id":1234567890123456,"card":"4242-4242-4242-4242","ip":"10.1.2.3","ssn":"123-45-6789"}`)
+	if !strings.Contains(got, "1234567890123456") {
+		t.Errorf("non-Luhn number redacted: %s", got)
+	}
+	for _, want := range []string{"[REDACTED:card]", "[REDACTED:ipv4]", "[REDACTED:ssn]"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s: %s", want, got)
+		}
+	}
+}
+
+func TestReplayCapture(t *testing.T) {
+	var bodies []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"again"}}]}`))
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", upstream.URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	mustCapturePolicy(t, 1, true)
+	doBodyRequest(t, "/chat/completions", token, `{"model":"m","messages":[{"role":"user","content":"hi alice@example.com"}]}`)
+	c := lastCapture(t)
+
+	res, err := ReplayCapture(context.Background(), &c)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if res.StatusCode != 200 || !strings.Contains(res.Body, "again") || res.ContentType != "application/json" {
+		t.Errorf("replay result = %+v", res)
+	}
+	if len(bodies) != 2 || !strings.Contains(bodies[1], "[REDACTED:email]") {
+		t.Errorf("upstream bodies = %v", bodies)
+	}
+	var logs int64
+	database.LogsDB.Model(&database.LLMRequestLog{}).Count(&logs)
+	if logs != 2 {
+		t.Errorf("usage logs = %d, want 2 (replay is logged)", logs)
+	}
+
+	c.RequestTruncated = true
+	if _, err := ReplayCapture(context.Background(), &c); err == nil {
+		t.Error("truncated capture must not replay")
+	}
+}
+
+func TestPurgeExpiredCaptures(t *testing.T) {
+	setupDB(t)
+	database.DB.Create(&database.Setting{Key: "llm_capture_retention_days", Value: "30"})
+	database.DB.Create(&database.LLMCapturePolicy{InstanceID: 2, Enabled: true, RetentionDays: 7, RedactPatterns: "[]"})
+	now := time.Now().UTC()
+	for _, c := range []database.LLMCapture{
+		{InstanceID: 1, Method: "POST", Path: "/a", RequestedAt: now.AddDate(0, 0, -10)},
+		{InstanceID: 1, Method: "POST", Path: "/b", RequestedAt: now.AddDate(0, 0, -40)},
+		{InstanceID: 2, Method: "POST", Path: "/c", RequestedAt: now.AddDate(0, 0, -10)},
+		{InstanceID: 2, Method: "POST", Path: "/d", RequestedAt: now.AddDate(0, 0, -1)},
+	} {
+		database.LogsDB.Create(&c)
+	}
+
+	deleted, err := PurgeExpiredCaptures()
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+	var paths []string
+	database.LogsDB.Model(&database.LLMCapture{}).Order("path").Pluck("path", &paths)
+	if strings.Join(paths, ",") != "/a,/d" {
+		t.Errorf("remaining = %v, want /a,/d", paths)
+	}
+}
@@ -0,0 +1,100 @@
+package llmgateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeDialectError writes a gateway-originated error (budget exhausted,
+// rate limited, …) in the error envelope the caller's SDK expects for
+// apiType. Using the native shape matters: the OpenAI, Anthropic and Google
+// SDKs all surface the message (and decide whether to retry) by parsing
+// their own envelope, and fall back to an opaque "unknown error" otherwise.
+//
+// code is a stable machine-readable reason such as "budget_exceeded". The
+// message must not contain user-supplied data.
+func writeDialectError(w http.ResponseWriter, apiType string, status int, code, message string) {
+	var body any
+	switch apiType {
+	case "anthropic-messages":
+		body = map[string]any{
+			"type": "error",
+			"error": map[string]string{
+				"type":    anthropicErrorType(status),
+				"message": message,
+			},
+		}
+	case "google-generative-ai":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    status,
+				"message": message,
+				"status":  googleErrorStatus(status),
+			},
+		}
+	case "ollama":
+		body = map[string]string{"error": message}
+	case "bedrock-converse", "bedrock-converse-stream":
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("x-amzn-ErrorType", "ThrottlingException")
+		}
+		body = map[string]string{"message": message}
+	default:
+		// openai-completions, openai-responses, openai-codex-responses.
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    code,
+				"param":   nil,
+				"code":    code,
+			},
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body) //nolint:errcheck
+}
+
+// anthropicErrorType maps an HTTP status to the Anthropic API error type.
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// googleErrorStatus maps an HTTP status to the google.rpc.Code name the
+// Generative Language API reports in error.status.
+func googleErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,341 @@
+package llmgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
+)
+
+// upstreamHop is one upstream a gateway request may be sent to: the primary
+// provider behind the client's virtual key (index 0) or an entry from the
+// instance's fallback chain for that provider.
+type upstreamHop struct {
+	index       int
+	providerID  uint
+	providerKey string
+	baseURL     string
+	mat         AuthMaterial
+	apiType     string
+	models      []database.ProviderModel
+	model       string // model to request upstream; "" keeps the client's
+}
+
+// errHopUnavailable marks a hop that was skipped before anything was sent
+// upstream (untranslatable request, budget exhausted, missing credentials).
+var errHopUnavailable = errors.New("fallback hop unavailable")
+
+// shouldFailover reports whether an upstream status is worth retrying on
+// the next hop: rate limits and server-side errors.
+func shouldFailover(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// resolveFallbackHops loads the fallback chain configured for instanceID's
+// primary provider and resolves each hop's provider and credentials. Hops
+// pointing at deleted providers, at another instance's private provider, or
+// whose OAuth token cannot be refreshed are dropped with a log line.
+func resolveFallbackHops(ctx context.Context, instanceID, providerID uint) []upstreamHop {
+	chain, err := database.GetLLMFallbackChain(instanceID, providerID)
+	if err != nil {
+		return nil
+	}
+	var hops []upstreamHop
+	for i, h := range database.ParseFallbackHops(chain.Hops) {
+		var p database.LLMProvider
+		if err := database.DB.First(&p, h.ProviderID).Error; err != nil {
+			log.Printf("[gateway] instance=%d fallback hop %d: provider %d not found", instanceID, i+1, h.ProviderID)
+			continue
+		}
+		if p.InstanceID != nil && *p.InstanceID != instanceID {
+			log.Printf("[gateway] instance=%d fallback hop %d: provider %d belongs to another instance", instanceID, i+1, h.ProviderID)
+			continue
+		}
+		hop := upstreamHop{
+			index:       i + 1,
+			providerID:  p.ID,
+			providerKey: p.Key,
+			baseURL:     strings.TrimRight(p.BaseURL, "/"),
+			apiType:     p.APIType,
+			models:      database.ParseProviderModels(p.Models),
+			model:       h.Model,
+		}
+		if hop.apiType == "" {
+			hop.apiType = "openai-completions"
+		}
+		if IsOAuthAPIType(hop.apiType) {
+			access, account, err := EnsureFreshOAuthToken(ctx, p.ID)
+			if err != nil {
+				log.Printf("[gateway] instance=%d fallback hop %d: oauth: %v", instanceID, i+1, err)
+				continue
+			}
+			hop.mat = AuthMaterial{OAuthAccess: access, OAuthAccount: account}
+		} else {
+			hop.mat = AuthMaterial{APIKey: resolveRealAPIKey(p)}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// hopRequest is the upstream request prepared for a single hop. translated
+// is non-nil when the body was converted from the client's dialect, in which
+// case the response must be converted back.
+type hopRequest struct {
+	path       string
+	query      url.Values
+	body       []byte
+	headers    http.Header
+	model      string
+	translated *chatRequest
+}
+
+// prepareHopRequest builds the path, body and headers to send to hop for a
+// client request in clientAPIType. Same-dialect hops get the client's body
+// as-is (with the model swapped when the hop overrides it); other hops get a
+// translated body. Returns errHopUnavailable when translation is impossible.
+func prepareHopRequest(r *http.Request, body []byte, clientAPIType, clientModel string, hop upstreamHop) (*hopRequest, error) {
+	clientDialect := dialectOf(clientAPIType)
+	hopDialect := dialectOf(hop.apiType)
+
+	if hop.apiType == clientAPIType || (clientDialect != "" && clientDialect == hopDialect) {
+		hr := &hopRequest{path: r.URL.Path, query: r.URL.Query(), body: body, headers: r.Header, model: clientModel}
+		if hop.model != "" {
+			hr.path, hr.body = overrideModel(clientDialect, r.URL.Path, body, hop.model)
+			hr.model = hop.model
+		}
+		// For codex providers OpenClaw declares api: "openai-responses" so pi-ai
+		// skips its JWT decode. The body it sends is openai-responses-shaped; the
+		// codex backend requires a different shape (instructions extraction,
+		// extra fields, stripped fields). Translate before forwarding.
+		if hop.apiType == APITypeOpenAICodexResponses {
+			hr.body = rewriteCodexRequestBody(hr.body)
+		}
+		return hr, nil
+	}
+
+	if clientDialect == "" || hopDialect == "" {
+		return nil, fmt.Errorf("%w: %s cannot be translated to %s", errHopUnavailable, clientAPIType, hop.apiType)
+	}
+	req, err := decodeChatRequest(clientDialect, r.URL.Path, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errHopUnavailable, err)
+	}
+	if hop.model != "" {
+		req.Model = hop.model
+	}
+	path, out, err := encodeChatRequest(hopDialect, hop.baseURL, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errHopUnavailable, err)
+	}
+	// The client's query string belongs to its own dialect and is not
+	// forwarded; Gemini streams need alt=sse to get SSE framing.
+	query := url.Values{}
+	headers := http.Header{}
+	switch hopDialect {
+	case dialectAnthropic:
+		headers.Set("anthropic-version", "2023-06-01")
+	case dialectGoogle:
+		if req.Stream {
+			query.Set("alt", "sse")
+		}
+	}
+	return &hopRequest{path: path, query: query, body: out, headers: headers, model: req.Model, translated: req}, nil
+}
+
+// overrideModel swaps the requested model in a same-dialect request. Gemini
+// and Bedrock carry the model in the path; the others in the body.
+func overrideModel(dialect, path string, body []byte, model string) (string, []byte) {
+	switch dialect {
+	case dialectGoogle:
+		if loc := googleModelPath.FindStringSubmatchIndex(path); loc != nil {
+			return path[:loc[2]] + model + path[loc[3]:], body
+		}
+		return path, body
+	case dialectBedrock:
+		if loc := bedrockModelPath.FindStringSubmatchIndex(path); loc != nil {
+			return path[:loc[2]] + model + path[loc[3]:], body
+		}
+		return path, body
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return path, body
+	}
+	doc["model"] = model
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return path, body
+	}
+	return path, out
+}
+
+var (
+	upstreamClientOnce sync.Once
+	upstreamClient     *http.Client
+)
+
+// sharedUpstreamClient returns the client for all upstream requests, built
+// once so hops share one connection pool. With tracing on, each upstream
+// request gets a client span and a traceparent header.
+func sharedUpstreamClient() *http.Client {
+	upstreamClientOnce.Do(func() {
+		upstreamClient = &http.Client{Timeout: 300 * time.Second, Transport: tracing.Transport(nil)}
+	})
+	return upstreamClient
+}
+
+// errHopTimeout is returned when a hop sends no response headers within
+// LLMFallbackTimeout.
+var errHopTimeout = errors.New("no response headers within fallback timeout")
+
+// doHop sends a hop's request. Hops with more hops behind them wait at most
+// LLMFallbackTimeout for response headers, so a hung provider fails over
+// instead of holding the request for the full upstream timeout. Only the
+// wait for headers is bounded: a streaming body may take longer.
+func doHop(req *http.Request, last bool) (*http.Response, error) {
+	client := sharedUpstreamClient()
+	if last || config.Cfg.LLMFallbackTimeout <= 0 {
+		return client.Do(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(config.Cfg.LLMFallbackTimeout, cancel)
+	resp, err := client.Do(req.WithContext(ctx))
+	fired := !timer.Stop()
+	if err != nil {
+		cancel()
+		if fired {
+			return nil, errHopTimeout
+		}
+		return nil, err
+	}
+	if fired {
+		resp.Body.Close()
+		cancel()
+		return nil, errHopTimeout
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a hop's request context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// writeTranslatedResponse converts a hop's response back into the client's
+// dialect and writes it to w. Upstream streams are translated event by
+// event; complete responses are re-encoded, as SSE when the client asked
+// for a stream. Returns the same metrics as processResponse.
+func writeTranslatedResponse(w http.ResponseWriter, resp *http.Response, clientAPIType string, hop upstreamHop, hr *hopRequest) (status, inputTokens, outputTokens, cachedInputTokens int, costUSD float64, errMsg string) {
+	if resp.StatusCode < 400 && hr.translated.Stream && strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return writeTranslatedStream(w, resp, clientAPIType, hop, hr)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeDialectError(w, clientAPIType, http.StatusBadGateway, "upstream_error", "failed to read upstream response")
+		return http.StatusBadGateway, 0, 0, 0, 0, err.Error()
+	}
+	logResponseBody(hr.model, hop.apiType, resp.StatusCode, raw)
+	at := GetAPIType(hop.apiType)
+	inputTokens, outputTokens, cachedInputTokens = at.ParseUsage(raw)
+	costUSD = calculateCost(hop.models, hr.model, inputTokens, outputTokens, cachedInputTokens)
+
+	if resp.StatusCode >= 400 {
+		errMsg = string(raw)
+		if len(errMsg) > 500 {
+			errMsg = errMsg[:500]
+		}
+		writeDialectError(w, clientAPIType, resp.StatusCode, "upstream_error",
+			fmt.Sprintf("upstream provider %s returned HTTP %d", hop.providerKey, resp.StatusCode))
+		return resp.StatusCode, inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg
+	}
+
+	chat, err := decodeChatResponse(dialectOf(hop.apiType), raw)
+	if err != nil {
+		writeDialectError(w, clientAPIType, http.StatusBadGateway, "upstream_error", "upstream response could not be translated")
+		return http.StatusBadGateway, inputTokens, outputTokens, cachedInputTokens, costUSD, err.Error()
+	}
+	if chat.Model == "" {
+		chat.Model = hr.model
+	}
+
+	clientDialect := dialectOf(clientAPIType)
+	var out []byte
+	ct := "application/json"
+	if hr.translated.Stream {
+		out, err = encodeChatStream(clientDialect, chat)
+		ct = "text/event-stream"
+	} else {
+		out, err = encodeChatResponse(clientDialect, chat)
+	}
+	if err != nil {
+		writeDialectError(w, clientAPIType, http.StatusBadGateway, "upstream_error", "upstream response could not be translated")
+		return http.StatusBadGateway, inputTokens, outputTokens, cachedInputTokens, costUSD, err.Error()
+	}
+	setTranslatedHeaders(w, ct)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out) //nolint:errcheck
+	return http.StatusOK, inputTokens, outputTokens, cachedInputTokens, costUSD, ""
+}
+
+// writeTranslatedStream relays an upstream SSE stream to the client in its
+// own dialect, flushing after every event. Usage is taken from the
+// upstream's events as they pass through.
+func writeTranslatedStream(w http.ResponseWriter, resp *http.Response, clientAPIType string, hop upstreamHop, hr *hopRequest) (status, inputTokens, outputTokens, cachedInputTokens int, costUSD float64, errMsg string) {
+	flusher, canFlush := w.(http.Flusher)
+	enc, err := newStreamEncoder(dialectOf(clientAPIType), &flushingWriter{w: w, flusher: flusher, canFlush: canFlush})
+	if err != nil {
+		writeDialectError(w, clientAPIType, http.StatusBadGateway, "upstream_error", "upstream response could not be translated")
+		return http.StatusBadGateway, 0, 0, 0, 0, err.Error()
+	}
+	setTranslatedHeaders(w, "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+
+	var captured bytes.Buffer
+	relay := &streamRelay{enc: enc, model: hr.model}
+	if err := relayChatStream(dialectOf(hop.apiType), io.TeeReader(resp.Body, &captured), relay); err != nil {
+		errMsg = err.Error()
+	}
+	// Finish the client stream even when the upstream broke off, so the
+	// client sees a well-formed end of message.
+	relay.finish()
+	logResponseBody(hr.model, hop.apiType, resp.StatusCode, captured.Bytes())
+	costUSD = calculateCost(hop.models, hr.model, relay.inputTokens, relay.outputTokens, relay.cachedInputTokens)
+	return http.StatusOK, relay.inputTokens, relay.outputTokens, relay.cachedInputTokens, costUSD, errMsg
+}
+
+func setTranslatedHeaders(w http.ResponseWriter, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if contentType == "text/event-stream" {
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+}
+
+// drainErrorBody reads (a prefix of) a failed hop's body for logging and
+// closes it so the connection can be reused.
+func drainErrorBody(resp *http.Response) string {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+	return string(bytes.TrimSpace(b))
+}
@@ -0,0 +1,267 @@
+package llmgateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func mustFallbackChain(t *testing.T, instanceID, providerID uint, hops ...database.FallbackHop) {
+	t.Helper()
+	if _, err := database.SetLLMFallbackChain(instanceID, providerID, hops); err != nil {
+		t.Fatalf("set fallback chain: %v", err)
+	}
+}
+
+func doBodyRequest(t *testing.T, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handleProxy(rr, req)
+	return rr
+}
+
+func lastLog(t *testing.T) database.LLMRequestLog {
+	t.Helper()
+	var l database.LLMRequestLog
+	if err := database.LogsDB.Order("id DESC").First(&l).Error; err != nil {
+		t.Fatalf("no usage log: %v", err)
+	}
+	return l
+}
+
+func TestFallback_SameDialectOnServerError(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"overloaded"}`))
+	}))
+	defer primary.Close()
+	var gotModel string
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		gotModel = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":5,"completion_tokens":2}}`))
+	}))
+	defer backup.Close()
+
+	setupDB(t)
+	p1 := mustProvider(t, "primary", "openai-completions", primary.URL)
+	p2 := mustProvider(t, "backup", "openai-completions", backup.URL)
+	token := mustGatewayKey(t, 1, p1.ID)
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID, Model: "gpt-backup"})
+
+	rr := doBodyRequest(t, "/v1/chat/completions", token, `{"model":"gpt-main","messages":[{"role":"user","content":"hi"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rr.Code, rr.Body.String())
+	}
+	if gotModel != "gpt-backup" {
+		t.Errorf("backup saw model %q, want gpt-backup", gotModel)
+	}
+	if rr.Header().Get("X-Claworc-Fallback-Hop") != "1" {
+		t.Errorf("X-Claworc-Fallback-Hop = %q", rr.Header().Get("X-Claworc-Fallback-Hop"))
+	}
+	l := lastLog(t)
+	if l.ProviderID != p2.ID || l.RequestedProviderID != p1.ID || l.FallbackHop != 1 || l.ModelID != "gpt-backup" || l.InputTokens != 5 {
+		t.Errorf("log = %+v", l)
+	}
+}
+
+func TestFallback_TranslatesOpenAIToAnthropic(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer primary.Close()
+	var gotPath, gotVersion string
+	var gotBody map[string]any
+	anthropic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotVersion = r.Header.Get("anthropic-version")
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","model":"claude-x","content":[{"type":"text","text":"bonjour"}],"stop_reason":"end_turn","usage":{"input_tokens":9,"output_tokens":3}}`))
+	}))
+	defer anthropic.Close()
+
+	setupDB(t)
+	p1 := mustProvider(t, "openai", "openai-completions", primary.URL)
+	p2 := mustProvider(t, "anthropic", "anthropic-messages", anthropic.URL)
+	token := mustGatewayKey(t, 1, p1.ID)
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID, Model: "claude-x"})
+
+	rr := doBodyRequest(t, "/chat/completions", token,
+		`{"model":"gpt-4o","messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	if gotPath != "/v1/messages" || gotVersion == "" {
+		t.Errorf("upstream path=%q anthropic-version=%q", gotPath, gotVersion)
+	}
+	if gotBody["system"] != "sys" || gotBody["model"] != "claude-x" {
+		t.Errorf("translated body = %v", gotBody)
+	}
+	var out struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode client response: %v", err)
+	}
+	if out.Object != "chat.completion" || len(out.Choices) != 1 || out.Choices[0].Message.Content != "bonjour" || out.Choices[0].FinishReason != "stop" {
+		t.Errorf("client response = %s", rr.Body.String())
+	}
+	l := lastLog(t)
+	if l.ProviderID != p2.ID || l.FallbackHop != 1 || l.InputTokens != 9 || l.OutputTokens != 3 {
+		t.Errorf("log = %+v", l)
+	}
+}
+
+func TestFallback_StreamingClientGetsSyntheticSSE(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"hey"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":1}}`))
+	}))
+	defer google.Close()
+
+	setupDB(t)
+	p1 := mustProvider(t, "anthropic", "anthropic-messages", primary.URL)
+	p2 := mustProvider(t, "google", "google-generative-ai", google.URL)
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(
+		`{"model":"claude","stream":true,"max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("x-api-key", mustGatewayKey(t, 1, p1.ID))
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID, Model: "gemini-2.0-flash"})
+
+	rr := httptest.NewRecorder()
+	handleProxy(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"event: message_start", `"text":"hey"`, "event: message_stop"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestFallback_LastHopErrorForwarded(t *testing.T) {
+	calls := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"down"}`))
+	}))
+	defer failing.Close()
+
+	setupDB(t)
+	p1 := mustProvider(t, "a", "openai-completions", failing.URL)
+	p2 := mustProvider(t, "b", "openai-completions", failing.URL)
+	token := mustGatewayKey(t, 1, p1.ID)
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID, Model: "m2"})
+
+	rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m1","messages":[]}`)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rr.Code)
+	}
+	if calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", calls)
+	}
+	if l := lastLog(t); l.FallbackHop != 1 || l.StatusCode != http.StatusBadGateway {
+		t.Errorf("log = %+v", l)
+	}
+}
+
+func TestFallback_UntranslatableHopSkipped(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	called := false
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer ollama.Close()
+
+	setupDB(t)
+	p1 := mustProvider(t, "a", "openai-completions", primary.URL)
+	p2 := mustProvider(t, "b", "ollama", ollama.URL)
+	token := mustGatewayKey(t, 1, p1.ID)
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID})
+
+	rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m1","messages":[]}`)
+	if called {
+		t.Error("untranslatable hop must not be called")
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503 from the primary", rr.Code)
+	}
+	var body map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if _, ok := body["error"]; !ok {
+		t.Errorf("expected dialect error body, got %s", rr.Body.String())
+	}
+}
+
+func TestDoHop_BoundsOnlyTheWaitForHeaders(t *testing.T) {
+	prev := config.Cfg.LLMFallbackTimeout
+	config.Cfg.LLMFallbackTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { config.Cfg.LLMFallbackTimeout = prev })
+
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer slowBody.Close()
+
+	req, _ := http.NewRequest("GET", hung.URL, nil)
+	if _, err := doHop(req, false); err != errHopTimeout {
+		t.Errorf("hung hop err = %v, want errHopTimeout", err)
+	}
+
+	req, _ = http.NewRequest("GET", slowBody.URL, nil)
+	resp, err := doHop(req, false)
+	if err != nil {
+		t.Fatalf("slow body hop: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "done" {
+		t.Errorf("slow body = %q, %v; want the full body past the timeout", body, err)
+	}
+}
@@ -18,12 +18,17 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // safeLog sanitizes a user-provided string before including it in a log line
@@ -73,9 +78,9 @@ func RegisterRoute(pattern string, handler http.HandlerFunc) {
 func Start(ctx context.Context, host string, port int) error {
 	mux := http.NewServeMux()
 	for _, rt := range registeredRoutes {
-		mux.HandleFunc(rt.pattern, rt.handler)
+		mux.Handle(rt.pattern, tracing.Handler(rt.handler, "llmgateway "+rt.pattern))
 	}
-	mux.HandleFunc("/", handleProxy)
+	mux.Handle("/", tracing.Handler(http.HandlerFunc(handleProxy), "llmgateway.handleProxy"))
 
 	addr := fmt.Sprintf("%s:%d", host, port)
 	gatewayServer = &http.Server{
@@ -120,10 +125,11 @@ func extractGatewayToken(r *http.Request) string {
 	return ""
 }
 
-// authAndResolve validates the gateway token and returns provider info, an
-// AuthMaterial containing the credentials to forward upstream, the api type,
-// and provider models.
-func authAndResolve(r *http.Request) (instanceID, providerID uint, providerKey, baseURL string, mat AuthMaterial, apiType string, providerModels []database.ProviderModel, err error) {
+// authAndResolve validates the gateway token and returns the virtual key's
+// ID, provider info, an AuthMaterial containing the credentials to forward
+// upstream, the upstream api type, the api type the client speaks (which
+// differs when the provider has a client_api_type), and provider models.
+func authAndResolve(r *http.Request) (keyID, instanceID, providerID uint, providerKey, baseURL string, mat AuthMaterial, apiType, clientAPIType string, providerModels []database.ProviderModel, err error) {
 	token := extractGatewayToken(r)
 	if token == "" {
 		err = fmt.Errorf("missing or invalid gateway auth token")
@@ -136,6 +142,7 @@ func authAndResolve(r *http.Request) (instanceID, providerID uint, providerKey,
 		return
 	}
 
+	keyID = key.ID
 	instanceID = key.InstanceID
 	providerID = key.ProviderID
 	providerKey = key.Provider.Key
@@ -144,6 +151,10 @@ func authAndResolve(r *http.Request) (instanceID, providerID uint, providerKey,
 	if apiType == "" {
 		apiType = "openai-completions"
 	}
+	clientAPIType = key.Provider.ClientAPIType
+	if clientAPIType == "" {
+		clientAPIType = apiType
+	}
 	providerModels = database.ParseProviderModels(key.Provider.Models)
 
 	if IsOAuthAPIType(apiType) {
@@ -240,7 +251,7 @@ func calculateCost(models []database.ProviderModel, modelID string, inputTokens,
 func handleProxy(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	instanceID, providerID, providerKey, baseURL, mat, apiType, providerModels, err := authAndResolve(r)
+	keyID, instanceID, providerID, providerKey, baseURL, mat, apiType, clientAPIType, providerModels, err := authAndResolve(r)
 	if err != nil {
 		log.Printf("[gateway] auth failed: %s path=%s", err, safeLog(r.URL.Path))
 		w.Header().Set("Content-Type", "application/json")
@@ -254,6 +265,12 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	activity.Touch(instanceID)
+
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(tracing.InstanceID(instanceID),
+		attribute.Int64("llm.provider_id", int64(providerID)),
+		attribute.String("llm.provider", providerKey))
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
@@ -267,38 +284,219 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		Model string `json:"model"`
 	}
 	json.Unmarshal(body, &reqBody)
+	span.SetAttributes(attribute.String("llm.model", reqBody.Model))
+
+	// Instances with capture enabled get the full exchange stored: the
+	// writer tees what the client receives and the capture is written once
+	// the response is complete, whatever path produced it.
+	if policy := capturePolicyFor(instanceID); policy != nil {
+		cw := &captureWriter{ResponseWriter: w, limit: maxCaptureBodyBytes}
+		w = cw
+		defer saveCapture(policy, cw, r, body, instanceID, providerID, reqBody.Model, start)
+	}
+
+	// Providers with a cache TTL answer repeated requests from memory. A hit
+	// costs nothing upstream, so it skips budgets and rate limits; it is
+	// still logged, with zero cost and the original cost as savings.
+	cacheKey, cacheTTL := "", cacheTTLFor(providerID)
+	if cacheTTL > 0 && !cacheBypassed(r) {
+		if key, ok := responseCacheKey(providerID, r, body); ok {
+			if e := respCache.get(key); e != nil {
+				span.SetAttributes(attribute.Bool("llm.cache_hit", true))
+				serveCached(w, e)
+				latencyMs := time.Since(start).Milliseconds()
+				logCacheHit(instanceID, providerID, e, latencyMs)
+				logLine(instanceID, providerKey, e.model, r.URL.Path, http.StatusOK, latencyMs, e.inputTokens, e.outputTokens, e.cachedInputTokens, 0, "")
+				return
+			}
+			cacheKey = key
+			w.Header().Set("X-Claworc-Cache", "MISS")
+		}
+	}
 
-	at := GetAPIType(apiType)
-	targetURL := buildTargetURL(baseURL, r.URL.Path, at, r.URL.Query())
-
-	// For codex providers OpenClaw declares api: "openai-responses" so pi-ai
-	// skips its JWT decode. The body it sends is openai-responses-shaped; the
-	// codex backend requires a different shape (instructions extraction,
-	// extra fields, stripped fields). Translate before forwarding.
-	if apiType == APITypeOpenAICodexResponses {
-		body = rewriteCodexRequestBody(body)
+	// Enforce spend caps before anything is sent upstream. Rejections are
+	// logged like any other request so they show up in usage logs.
+	breach, budgetWarnings := checkBudgets(instanceID, providerID)
+	if breach != nil {
+		if breach.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(breach.retryAfter.Seconds())+1))
+		}
+		msg := breach.message()
+		writeDialectError(w, clientAPIType, http.StatusTooManyRequests, "budget_exceeded", msg)
+		latencyMs := time.Since(start).Milliseconds()
+		logRequest(instanceID, providerID, providerID, 0, reqBody.Model, 0, 0, 0, 0, http.StatusTooManyRequests, latencyMs, msg)
+		logLine(instanceID, providerKey, reqBody.Model, r.URL.Path, http.StatusTooManyRequests, latencyMs, 0, 0, 0, 0, msg)
+		return
+	}
+	if len(budgetWarnings) > 0 {
+		w.Header().Set("X-Claworc-Budget-Warning", strings.Join(budgetWarnings, ", "))
 	}
 
-	// Use context.Background() instead of r.Context() so that a client disconnect
-	// does not cancel the upstream request mid-stream. This is important for streaming
-	// responses: if the client closes the connection before the upstream sends final
-	// token-count events (e.g. Anthropic's message_delta), the captured buffer would
-	// be incomplete and token counts would be recorded as 0.
-	upstreamReq, err := buildUpstreamRequest(context.Background(), r.Method, targetURL, body, r.Header, mat, at)
-	if err != nil {
-		http.Error(w, `{"error":{"message":"failed to build upstream request"}}`, http.StatusInternalServerError)
+	// Rate limits are checked after budgets so a request rejected for spend
+	// does not take a request token. A queued request waits here; the lease
+	// holds its concurrency slots until the response has been written.
+	lease, limited := acquireRateLimits(r.Context(), keyID, instanceID, providerID)
+	if limited != nil {
+		if limited.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(limited.retryAfter.Seconds())+1))
+		}
+		msg := limited.message()
+		writeDialectError(w, clientAPIType, http.StatusTooManyRequests, "rate_limited", msg)
+		latencyMs := time.Since(start).Milliseconds()
+		logRequest(instanceID, providerID, providerID, 0, reqBody.Model, 0, 0, 0, 0, http.StatusTooManyRequests, latencyMs, msg)
+		logLine(instanceID, providerKey, reqBody.Model, r.URL.Path, http.StatusTooManyRequests, latencyMs, 0, 0, 0, 0, msg)
 		return
 	}
+	defer lease.release()
+
+	// The primary provider is hop 0; any fallback chain configured for this
+	// instance and provider follows. A hop is abandoned for the next one on a
+	// transport error/timeout, a 429 or a 5xx — but only before anything has
+	// been written to the client, so a stream that fails midway is not
+	// retried. The last hop's response is forwarded whatever its status.
+	hops := []upstreamHop{{
+		providerID:  providerID,
+		providerKey: providerKey,
+		baseURL:     baseURL,
+		mat:         mat,
+		apiType:     apiType,
+		models:      providerModels,
+	}}
+	hops = append(hops, resolveFallbackHops(r.Context(), instanceID, providerID)...)
+
+	// A cache miss tees the response so it can be stored once complete.
+	var cacheW *captureWriter
+	if cacheKey != "" {
+		cacheW = &captureWriter{ResponseWriter: w, limit: maxCacheEntryBytes}
+		w = cacheW
+	}
+
+	lastStatus, lastErr := 0, ""
+	var translateErr error
+	// hopLease holds the fallback hop provider's rate limit slot; it is
+	// released before moving on to the next hop.
+	var hopLease *rateLease
+	defer func() { hopLease.release() }()
+	for i, hop := range hops {
+		last := i == len(hops)-1
+		hopLease.release()
+		hopLease = nil
+		if hop.index > 0 {
+			if breach, _ := checkBudgets(instanceID, hop.providerID); breach != nil {
+				log.Printf("[gateway] instance=%d fallback hop %d (%s) skipped: budget exceeded", instanceID, hop.index, safeLog(hop.providerKey))
+				continue
+			}
+			var limited *rateBreach
+			if hopLease, limited = tryProviderRateLimit(hop.providerID); limited != nil {
+				log.Printf("[gateway] instance=%d fallback hop %d (%s) skipped: %s", instanceID, hop.index, safeLog(hop.providerKey), limited.message())
+				continue
+			}
+		}
+		hr, err := prepareHopRequest(r, body, clientAPIType, reqBody.Model, hop)
+		if err != nil {
+			log.Printf("[gateway] instance=%d hop %d (%s) skipped: %v", instanceID, hop.index, safeLog(hop.providerKey), err)
+			if translateErr == nil {
+				translateErr = err
+			}
+			continue
+		}
 
-	client := &http.Client{Timeout: 300 * time.Second}
-	resp, err := client.Do(upstreamReq)
-	if err != nil {
+		at := GetAPIType(hop.apiType)
+		targetURL := buildTargetURL(hop.baseURL, hr.path, at, hr.query)
+
+		// Detach from r.Context()'s cancellation so that a client disconnect
+		// does not cancel the upstream request mid-stream. This is important for streaming
+		// responses: if the client closes the connection before the upstream sends final
+		// token-count events (e.g. Anthropic's message_delta), the captured buffer would
+		// be incomplete and token counts would be recorded as 0. The context keeps its
+		// values, so the trace continues into the upstream request.
+		span.AddEvent("upstream attempt", trace.WithAttributes(
+			attribute.Int("llm.hop", hop.index),
+			attribute.Int64("llm.provider_id", int64(hop.providerID))))
+		upstreamReq, err := buildUpstreamRequest(context.WithoutCancel(r.Context()), r.Method, targetURL, hr.body, hr.headers, hop.mat, at)
+		if err != nil {
+			http.Error(w, `{"error":{"message":"failed to build upstream request"}}`, http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := doHop(upstreamReq, last)
+		if err != nil {
+			lastStatus, lastErr = http.StatusBadGateway, err.Error()
+			if !last {
+				log.Printf("[gateway] instance=%d provider=%s hop=%d upstream request failed, trying next hop", instanceID, safeLog(hop.providerKey), hop.index)
+				continue
+			}
+			latencyMs := time.Since(start).Milliseconds()
+			http.Error(w, `{"error":{"message":"upstream request failed"}}`, http.StatusBadGateway)
+			logRequest(instanceID, providerID, hop.providerID, hop.index, hr.model, 0, 0, 0, 0, http.StatusBadGateway, latencyMs, err.Error())
+			logLine(instanceID, hop.providerKey, hr.model, r.URL.Path, http.StatusBadGateway, latencyMs, 0, 0, 0, 0, err.Error())
+			return
+		}
+		if !last && shouldFailover(resp.StatusCode) {
+			lastStatus, lastErr = resp.StatusCode, drainErrorBody(resp)
+			log.Printf("[gateway] instance=%d provider=%s hop=%d status=%d, trying next hop", instanceID, safeLog(hop.providerKey), hop.index, resp.StatusCode)
+			continue
+		}
+
+		if hop.index > 0 {
+			w.Header().Set("X-Claworc-Fallback-Hop", strconv.Itoa(hop.index))
+		}
+		var status, inputTokens, outputTokens, cachedInputTokens int
+		var costUSD float64
+		var errMsg string
+		if hr.translated != nil {
+			status, inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg = writeTranslatedResponse(w, resp, clientAPIType, hop, hr)
+			resp.Body.Close()
+		} else {
+			status = resp.StatusCode
+			inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg = writeUpstreamResponse(w, resp, at, hop.apiType, hop.models, hr.model)
+		}
+		tokens := inputTokens + cachedInputTokens + outputTokens
+		lease.addTokens(tokens, hop.providerID)
+		hopLease.addTokens(tokens, hop.providerID)
 		latencyMs := time.Since(start).Milliseconds()
-		http.Error(w, `{"error":{"message":"upstream request failed"}}`, http.StatusBadGateway)
-		logRequest(instanceID, providerID, reqBody.Model, 0, 0, 0, 0, http.StatusBadGateway, latencyMs, err.Error())
-		logLine(instanceID, providerKey, reqBody.Model, r.URL.Path, http.StatusBadGateway, latencyMs, 0, 0, 0, 0, err.Error())
+		logRequest(instanceID, providerID, hop.providerID, hop.index, hr.model, inputTokens, outputTokens, cachedInputTokens, costUSD, status, latencyMs, errMsg)
+		logLine(instanceID, hop.providerKey, hr.model, r.URL.Path, status, latencyMs, inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg)
+		if cacheW != nil && cacheable(cacheW, status, errMsg, outputTokens) {
+			respCache.put(&cacheEntry{
+				key:                 cacheKey,
+				requestedProviderID: providerID,
+				providerID:          hop.providerID,
+				model:               hr.model,
+				contentType:         cacheW.Header().Get("Content-Type"),
+				body:                bytes.Clone(cacheW.buf.Bytes()),
+				inputTokens:         inputTokens,
+				outputTokens:        outputTokens,
+				cachedInputTokens:   cachedInputTokens,
+				costUSD:             costUSD,
+				expires:             cacheNow().Add(cacheTTL),
+			})
+		}
 		return
 	}
+
+	// Every hop failed or was skipped, and the last attempted one was not
+	// forwarded because more hops were expected behind it.
+	// When nothing was sent at all because the request could not be
+	// translated, that is the client's problem rather than an outage.
+	code, msg := "upstream_error", "all upstream providers failed"
+	if lastStatus == 0 && translateErr != nil {
+		lastStatus, lastErr = http.StatusBadRequest, translateErr.Error()
+		code, msg = "untranslatable_request", "request uses features that cannot be translated for the upstream provider"
+	}
+	if lastStatus == 0 {
+		lastStatus, lastErr = http.StatusBadGateway, "no usable upstream provider"
+	}
+	latencyMs := time.Since(start).Milliseconds()
+	writeDialectError(w, clientAPIType, lastStatus, code, msg)
+	logRequest(instanceID, providerID, providerID, 0, reqBody.Model, 0, 0, 0, 0, lastStatus, latencyMs, lastErr)
+	logLine(instanceID, providerKey, reqBody.Model, r.URL.Path, lastStatus, latencyMs, 0, 0, 0, 0, lastErr)
+}
+
+// writeUpstreamResponse copies a same-dialect upstream response to w with
+// sanitized headers and returns the usage metrics from processResponse.
+// The response body is closed.
+func writeUpstreamResponse(w http.ResponseWriter, resp *http.Response, at APIType, apiType string, providerModels []database.ProviderModel, model string) (inputTokens, outputTokens, cachedInputTokens int, costUSD float64, errMsg string) {
 	defer resp.Body.Close()
 
 	// Copy response headers, skipping headers that could enable XSS or cache poisoning.
@@ -334,10 +532,7 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(resp.StatusCode)
 
-	inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg := processResponse(w, resp.Body, isStreaming, at, apiType, resp.StatusCode, providerModels, reqBody.Model)
-	latencyMs := time.Since(start).Milliseconds()
-	logRequest(instanceID, providerID, reqBody.Model, inputTokens, outputTokens, cachedInputTokens, costUSD, resp.StatusCode, latencyMs, errMsg)
-	logLine(instanceID, providerKey, reqBody.Model, r.URL.Path, resp.StatusCode, latencyMs, inputTokens, outputTokens, cachedInputTokens, costUSD, errMsg)
+	return processResponse(w, resp.Body, isStreaming, at, apiType, resp.StatusCode, providerModels, model)
 }
 
 // logResponseBody appends the raw upstream response body to the file specified by
@@ -413,23 +608,28 @@ func logLine(instanceID uint, providerKey, model, path string, statusCode int, l
 	}
 }
 
-// logRequest records a proxied request in llm-logs.db.
-func logRequest(instanceID, providerID uint, model string, inputTokens, outputTokens, cachedInputTokens int, costUSD float64, statusCode int, latencyMs int64, errMsg string) {
+// logRequest records a proxied request in llm-logs.db. requestedProviderID
+// is the provider behind the client's virtual key; providerID is the one
+// that served the request at fallback hop (0 = primary).
+func logRequest(instanceID, requestedProviderID, providerID uint, hop int, model string, inputTokens, outputTokens, cachedInputTokens int, costUSD float64, statusCode int, latencyMs int64, errMsg string) {
+	observeRequest(instanceID, providerID, model, inputTokens, outputTokens, cachedInputTokens, costUSD, statusCode, latencyMs)
 	if database.LogsDB == nil {
 		return
 	}
 	if err := database.LogsDB.Create(&database.LLMRequestLog{
-		InstanceID:        instanceID,
-		ProviderID:        providerID,
-		ModelID:           model,
-		InputTokens:       inputTokens,
-		OutputTokens:      outputTokens,
-		CachedInputTokens: cachedInputTokens,
-		CostUSD:           costUSD,
-		StatusCode:        statusCode,
-		LatencyMs:         latencyMs,
-		ErrorMessage:      errMsg,
-		RequestedAt:       time.Now().UTC(),
+		InstanceID:          instanceID,
+		ProviderID:          providerID,
+		ModelID:             model,
+		InputTokens:         inputTokens,
+		OutputTokens:        outputTokens,
+		CachedInputTokens:   cachedInputTokens,
+		CostUSD:             costUSD,
+		StatusCode:          statusCode,
+		LatencyMs:           latencyMs,
+		ErrorMessage:        errMsg,
+		RequestedAt:         time.Now().UTC(),
+		RequestedProviderID: requestedProviderID,
+		FallbackHop:         hop,
 	}).Error; err != nil {
 		log.Printf("[gateway] failed to write usage log: %v", err)
 	}
@@ -32,6 +32,10 @@ func setupDB(t *testing.T) {
 		&database.Setting{},
 		&database.LLMProvider{},
 		&database.LLMGatewayKey{},
+		&database.LLMBudget{},
+		&database.LLMFallbackChain{},
+		&database.LLMRateLimit{},
+		&database.LLMCapturePolicy{},
 	); err != nil {
 		t.Fatalf("auto-migrate: %v", err)
 	}
@@ -42,9 +46,12 @@ func setupDB(t *testing.T) {
 	if err != nil {
 		t.Fatalf("open in-memory logs DB: %v", err)
 	}
-	if err := database.LogsDB.AutoMigrate(&database.LLMRequestLog{}); err != nil {
+	if err := database.LogsDB.AutoMigrate(&database.LLMRequestLog{}, &database.LLMCapture{}); err != nil {
 		t.Fatalf("auto-migrate logs DB: %v", err)
 	}
+	limiter = newRateLimiter()
+	respCache = newResponseCache()
+	respCache.maxBytes = 16 << 20
 }
 
 // mustProvider creates an LLMProvider and returns it.
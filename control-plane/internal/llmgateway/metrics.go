@@ -0,0 +1,61 @@
+// metrics.go records gateway traffic in the Prometheus registry served on
+// /metrics. Every row written to llm_request_logs is also counted here, so
+// the two agree; counters start at zero when the control plane restarts.
+
+package llmgateway
+
+import (
+	"strconv"
+
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
+)
+
+var (
+	metricRequests = metrics.NewCounterVec("claworc_llm_requests_total",
+		"LLM gateway requests by instance, serving provider, model and HTTP status.",
+		"instance_id", "provider_id", "model", "status")
+	metricTokens = metrics.NewCounterVec("claworc_llm_tokens_total",
+		"LLM tokens by instance, serving provider, model and type (input, cached_input, output).",
+		"instance_id", "provider_id", "model", "type")
+	metricCost = metrics.NewCounterVec("claworc_llm_cost_usd_total",
+		"Estimated upstream LLM cost in USD by instance, serving provider and model.",
+		"instance_id", "provider_id", "model")
+	metricCacheHits = metrics.NewCounterVec("claworc_llm_cache_hits_total",
+		"LLM requests answered from the gateway response cache.",
+		"instance_id", "provider_id", "model")
+	metricCacheSaved = metrics.NewCounterVec("claworc_llm_cache_saved_cost_usd_total",
+		"Upstream LLM cost in USD avoided by response cache hits.",
+		"instance_id", "provider_id", "model")
+	metricLatency = metrics.NewHistogramVec("claworc_llm_request_duration_seconds",
+		"End-to-end LLM gateway request latency by serving provider and model.",
+		metrics.DefBuckets, "provider_id", "model")
+)
+
+// maxModelLabel bounds the model label; it comes from the request body.
+const maxModelLabel = 100
+
+// observeRequest counts one logged gateway request.
+func observeRequest(instanceID, providerID uint, model string, inputTokens, outputTokens, cachedInputTokens int, costUSD float64, statusCode int, latencyMs int64) {
+	if len(model) > maxModelLabel {
+		model = model[:maxModelLabel]
+	}
+	inst := strconv.FormatUint(uint64(instanceID), 10)
+	prov := strconv.FormatUint(uint64(providerID), 10)
+	metricRequests.Inc(inst, prov, model, strconv.Itoa(statusCode))
+	metricTokens.Add(float64(inputTokens), inst, prov, model, "input")
+	metricTokens.Add(float64(cachedInputTokens), inst, prov, model, "cached_input")
+	metricTokens.Add(float64(outputTokens), inst, prov, model, "output")
+	metricCost.Add(costUSD, inst, prov, model)
+	metricLatency.Observe(float64(latencyMs)/1000, prov, model)
+}
+
+// observeCacheHit counts a response cache hit on top of observeRequest.
+func observeCacheHit(instanceID, providerID uint, model string, savedUSD float64) {
+	if len(model) > maxModelLabel {
+		model = model[:maxModelLabel]
+	}
+	inst := strconv.FormatUint(uint64(instanceID), 10)
+	prov := strconv.FormatUint(uint64(providerID), 10)
+	metricCacheHits.Inc(inst, prov, model)
+	metricCacheSaved.Add(savedUSD, inst, prov, model)
+}
@@ -0,0 +1,352 @@
+// ratelimit.go enforces LLMRateLimit token buckets and concurrency caps.
+// Limit definitions live in the main DB; bucket levels and in-flight counts
+// live in memory, so they are per control-plane process and start full
+// after a restart.
+
+package llmgateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// defaultRateQueueTimeout is how long a queued request waits when its
+// limit has QueueTimeoutSeconds == 0. A var so tests can shorten it.
+var defaultRateQueueTimeout = 30 * time.Second
+
+// rateNow is overridable in tests.
+var rateNow = func() time.Time { return time.Now() }
+
+// tokenBucket holds up to capacity units and refills capacity units per
+// minute. capacity == 0 disables the bucket.
+type tokenBucket struct {
+	capacity float64
+	level    float64
+	last     time.Time
+}
+
+// configure sets the bucket size. A bucket that was disabled starts full;
+// otherwise the current level is kept, clamped to the new size.
+func (b *tokenBucket) configure(perMinute int, now time.Time) {
+	c := float64(perMinute)
+	if b.capacity == 0 {
+		b.level = c
+		b.last = now
+	}
+	b.capacity = c
+	if b.level > c {
+		b.level = c
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.capacity <= 0 {
+		return
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.level = math.Min(b.capacity, b.level+elapsed*b.capacity/60)
+		b.last = now
+	}
+}
+
+// wait returns how long until the bucket holds at least one unit.
+func (b *tokenBucket) wait() time.Duration {
+	if b.capacity <= 0 || b.level >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.level) * 60 / b.capacity * float64(time.Second))
+}
+
+// available returns the whole units in the bucket, or 0 when disabled. The
+// token bucket can be negative after a large response.
+func (b *tokenBucket) available() int {
+	if b.capacity <= 0 {
+		return 0
+	}
+	return int(math.Floor(b.level))
+}
+
+// rateState is the in-memory state of one LLMRateLimit.
+type rateState struct {
+	limit    database.LLMRateLimit
+	requests tokenBucket
+	tokens   tokenBucket
+	inFlight int
+	queued   int
+	rejected uint64
+}
+
+// rateLimiter tracks the state of every limit seen by the gateway.
+type rateLimiter struct {
+	mu     sync.Mutex
+	states map[string]*rateState
+	// wake is closed and replaced whenever a lease is released, so queued
+	// requests waiting on a concurrency slot re-check immediately.
+	wake chan struct{}
+}
+
+var limiter = newRateLimiter()
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{states: map[string]*rateState{}, wake: make(chan struct{})}
+}
+
+// state returns the state for lim, creating it and applying lim's current
+// settings. Callers hold l.mu.
+func (l *rateLimiter) state(lim database.LLMRateLimit, now time.Time) *rateState {
+	key := fmt.Sprintf("%s:%d", lim.Scope, lim.ScopeID)
+	st, ok := l.states[key]
+	if !ok {
+		st = &rateState{}
+		l.states[key] = st
+	}
+	st.limit = lim
+	st.requests.configure(lim.RequestsPerMinute, now)
+	st.tokens.configure(lim.TokensPerMinute, now)
+	st.requests.refill(now)
+	st.tokens.refill(now)
+	return st
+}
+
+// rateBreach describes the limit that stopped a request.
+type rateBreach struct {
+	scope   string
+	scopeID uint
+	what    string
+	limit   int
+	// retryAfter estimates when the bucket refills; zero for the
+	// concurrency cap, which frees up whenever a request finishes.
+	retryAfter time.Duration
+	timedOut   bool
+	st         *rateState
+}
+
+func (b *rateBreach) message() string {
+	msg := fmt.Sprintf("LLM rate limit exceeded: %s %d %s limit of %d reached", b.scope, b.scopeID, b.what, b.limit)
+	if b.timedOut {
+		msg += " (timed out in queue)"
+	}
+	return msg
+}
+
+// blocked returns the first limit among states that a new request would
+// exceed, or nil.
+func blocked(states []*rateState) *rateBreach {
+	for _, st := range states {
+		lim := st.limit
+		switch {
+		case lim.MaxConcurrent > 0 && st.inFlight >= lim.MaxConcurrent:
+			return &rateBreach{scope: lim.Scope, scopeID: lim.ScopeID, what: "concurrent requests", limit: lim.MaxConcurrent, st: st}
+		case st.requests.wait() > 0:
+			return &rateBreach{scope: lim.Scope, scopeID: lim.ScopeID, what: "requests per minute", limit: lim.RequestsPerMinute, retryAfter: st.requests.wait(), st: st}
+		case st.tokens.wait() > 0:
+			return &rateBreach{scope: lim.Scope, scopeID: lim.ScopeID, what: "tokens per minute", limit: lim.TokensPerMinute, retryAfter: st.tokens.wait(), st: st}
+		}
+	}
+	return nil
+}
+
+// acquire admits a request against limits, taking one request from every
+// requests bucket and a concurrency slot from every limit. When a limit is
+// hit and canQueue is set, the request waits if the breached limit is in
+// queue mode, until it fits, its queue timeout passes or ctx is done.
+//
+// The returned lease must be released when the response has been written.
+// A nil lease (no limits apply) is valid.
+func (l *rateLimiter) acquire(ctx context.Context, limits []database.LLMRateLimit, canQueue bool) (*rateLease, *rateBreach) {
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	var deadline time.Time
+	var states []*rateState
+	queued := false
+	dequeue := func() {
+		if queued {
+			for _, st := range states {
+				st.queued--
+			}
+			queued = false
+		}
+	}
+
+	for {
+		l.mu.Lock()
+		now := rateNow()
+		states = states[:0]
+		for _, lim := range limits {
+			states = append(states, l.state(lim, now))
+		}
+		breach := blocked(states)
+		if breach == nil {
+			dequeue()
+			for _, st := range states {
+				st.inFlight++
+				if st.requests.capacity > 0 {
+					st.requests.level--
+				}
+			}
+			l.mu.Unlock()
+			return &rateLease{l: l, states: append([]*rateState(nil), states...)}, nil
+		}
+
+		if !canQueue || breach.st.limit.Mode != database.RateLimitModeQueue {
+			dequeue()
+			breach.st.rejected++
+			l.mu.Unlock()
+			return nil, breach
+		}
+		if !queued {
+			queued = true
+			for _, st := range states {
+				st.queued++
+			}
+			timeout := defaultRateQueueTimeout
+			if s := breach.st.limit.QueueTimeoutSeconds; s > 0 {
+				timeout = time.Duration(s) * time.Second
+			}
+			deadline = now.Add(timeout)
+		}
+		remaining := deadline.Sub(now)
+		if remaining <= 0 {
+			dequeue()
+			breach.st.rejected++
+			breach.timedOut = true
+			l.mu.Unlock()
+			return nil, breach
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		wait := breach.retryAfter
+		if wait <= 0 || wait > remaining {
+			wait = remaining
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.mu.Lock()
+			dequeue()
+			breach.st.rejected++
+			l.mu.Unlock()
+			breach.timedOut = true
+			return nil, breach
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+		}
+	}
+}
+
+// rateLease is a request admitted by acquire.
+type rateLease struct {
+	l        *rateLimiter
+	states   []*rateState
+	released bool
+}
+
+// release frees the lease's concurrency slots and wakes queued requests.
+// Safe to call more than once and on a nil lease.
+func (le *rateLease) release() {
+	if le == nil {
+		return
+	}
+	le.l.mu.Lock()
+	defer le.l.mu.Unlock()
+	if le.released {
+		return
+	}
+	le.released = true
+	for _, st := range le.states {
+		st.inFlight--
+	}
+	close(le.l.wake)
+	le.l.wake = make(chan struct{})
+}
+
+// addTokens debits n tokens from the lease's token buckets. Provider limits
+// are only charged when they belong to servedBy, the provider that actually
+// served the request, so a fallback hop does not consume the primary's
+// provider quota.
+func (le *rateLease) addTokens(n int, servedBy uint) {
+	if le == nil || n <= 0 {
+		return
+	}
+	le.l.mu.Lock()
+	defer le.l.mu.Unlock()
+	now := rateNow()
+	for _, st := range le.states {
+		if st.limit.Scope == database.RateLimitScopeProvider && st.limit.ScopeID != servedBy {
+			continue
+		}
+		if st.tokens.capacity > 0 {
+			st.tokens.refill(now)
+			st.tokens.level -= float64(n)
+		}
+	}
+}
+
+// acquireRateLimits admits a gateway request made with virtual key keyID
+// against every limit for the key, its instance and its provider. Errors
+// loading limits fail open, like budget lookups.
+func acquireRateLimits(ctx context.Context, keyID, instanceID, providerID uint) (*rateLease, *rateBreach) {
+	if database.DB == nil {
+		return nil, nil
+	}
+	limits, err := database.RateLimitsForRequest(keyID, instanceID, providerID)
+	if err != nil {
+		log.Printf("[gateway] rate limit lookup failed (allowing request): %v", err)
+		return nil, nil
+	}
+	return limiter.acquire(ctx, limits, true)
+}
+
+// tryProviderRateLimit admits a fallback hop against its provider's limit
+// without queueing: a throttled hop is skipped instead.
+func tryProviderRateLimit(providerID uint) (*rateLease, *rateBreach) {
+	if database.DB == nil {
+		return nil, nil
+	}
+	limits, err := database.RateLimitsForProvider(providerID)
+	if err != nil {
+		log.Printf("[gateway] rate limit lookup failed (allowing hop): %v", err)
+		return nil, nil
+	}
+	return limiter.acquire(context.Background(), limits, false)
+}
+
+// RateLimitStatus is a rate limit together with its live usage. Remaining
+// counts are 0 for dimensions the limit leaves uncapped; TokensRemaining
+// goes negative while a large response is being paid back.
+type RateLimitStatus struct {
+	Limit             database.LLMRateLimit `json:"limit"`
+	RequestsRemaining int                   `json:"requests_remaining"`
+	TokensRemaining   int                   `json:"tokens_remaining"`
+	InFlight          int                   `json:"in_flight"`
+	Queued            int                   `json:"queued"`
+	// Rejected counts requests refused (or timed out in the queue) by this
+	// limit since the control plane started.
+	Rejected uint64 `json:"rejected"`
+}
+
+// GetRateLimitStatus reports the current bucket levels and in-flight and
+// queued requests for lim.
+func GetRateLimitStatus(lim database.LLMRateLimit) RateLimitStatus {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	st := limiter.state(lim, rateNow())
+	return RateLimitStatus{
+		Limit:             lim,
+		RequestsRemaining: st.requests.available(),
+		TokensRemaining:   st.tokens.available(),
+		InFlight:          st.inFlight,
+		Queued:            st.queued,
+		Rejected:          st.rejected,
+	}
+}
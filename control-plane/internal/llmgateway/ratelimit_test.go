@@ -0,0 +1,163 @@
+package llmgateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func mustRateLimit(t *testing.T, l database.LLMRateLimit) {
+	t.Helper()
+	if l.Mode == "" {
+		l.Mode = database.RateLimitModeReject
+	}
+	if err := database.UpsertLLMRateLimit(&l); err != nil {
+		t.Fatalf("upsert rate limit: %v", err)
+	}
+}
+
+func okUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":40,"completion_tokens":10}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRateLimit_RequestsPerMinuteRejects(t *testing.T) {
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", okUpstream(t).URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	mustRateLimit(t, database.LLMRateLimit{Scope: database.RateLimitScopeInstance, ScopeID: 1, RequestsPerMinute: 2})
+
+	for i := 0; i < 2; i++ {
+		if rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, rr.Code)
+		}
+	}
+	rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After")
+	}
+	if l := lastLog(t); l.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("log = %+v", l)
+	}
+	st := GetRateLimitStatus(database.LLMRateLimit{Scope: database.RateLimitScopeInstance, ScopeID: 1, RequestsPerMinute: 2})
+	if st.Rejected != 1 || st.RequestsRemaining != 0 || st.InFlight != 0 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestRateLimit_TokensPerMinuteChargedAfterResponse(t *testing.T) {
+	setupDB(t)
+	p := mustProvider(t, "openai", "openai-completions", okUpstream(t).URL)
+	token := mustGatewayKey(t, 1, p.ID)
+	var key database.LLMGatewayKey
+	database.DB.First(&key)
+	lim := database.LLMRateLimit{Scope: database.RateLimitScopeKey, ScopeID: key.ID, TokensPerMinute: 30}
+	mustRateLimit(t, lim)
+
+	if rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`); rr.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", rr.Code)
+	}
+	if st := GetRateLimitStatus(lim); st.TokensRemaining != -20 {
+		t.Errorf("tokens remaining = %d, want -20", st.TokensRemaining)
+	}
+	if rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("second request: status = %d, want 429", rr.Code)
+	}
+}
+
+func TestRateLimit_ConcurrencyQueues(t *testing.T) {
+	setupDB(t)
+	lim := database.LLMRateLimit{Scope: database.RateLimitScopeProvider, ScopeID: 7, MaxConcurrent: 1, Mode: database.RateLimitModeQueue}
+	limits := []database.LLMRateLimit{lim}
+
+	first, breach := limiter.acquire(context.Background(), limits, true)
+	if breach != nil {
+		t.Fatalf("first acquire: %s", breach.message())
+	}
+	done := make(chan *rateBreach)
+	go func() {
+		lease, b := limiter.acquire(context.Background(), limits, true)
+		lease.release()
+		done <- b
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for GetRateLimitStatus(lim).Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second request never queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	first.release()
+	select {
+	case b := <-done:
+		if b != nil {
+			t.Errorf("queued acquire failed: %s", b.message())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued request not woken by release")
+	}
+	if st := GetRateLimitStatus(lim); st.InFlight != 0 || st.Queued != 0 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestRateLimit_QueueTimeout(t *testing.T) {
+	setupDB(t)
+	prev := defaultRateQueueTimeout
+	defaultRateQueueTimeout = 30 * time.Millisecond
+	defer func() { defaultRateQueueTimeout = prev }()
+	limits := []database.LLMRateLimit{{Scope: database.RateLimitScopeInstance, ScopeID: 1, MaxConcurrent: 1, Mode: database.RateLimitModeQueue}}
+
+	held, _ := limiter.acquire(context.Background(), limits, true)
+	defer held.release()
+	_, breach := limiter.acquire(context.Background(), limits, true)
+	if breach == nil || !breach.timedOut {
+		t.Fatalf("breach = %+v, want queue timeout", breach)
+	}
+	// A fallback hop never queues.
+	if _, breach := limiter.acquire(context.Background(), limits, false); breach == nil || breach.timedOut {
+		t.Errorf("non-queueing acquire: breach = %+v", breach)
+	}
+}
+
+func TestRateLimit_FallbackHopSkippedWhenThrottled(t *testing.T) {
+	setupDB(t)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	called := false
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer backup.Close()
+
+	p1 := mustProvider(t, "a", "openai-completions", primary.URL)
+	p2 := mustProvider(t, "b", "openai-completions", backup.URL)
+	token := mustGatewayKey(t, 1, p1.ID)
+	mustFallbackChain(t, 1, p1.ID, database.FallbackHop{ProviderID: p2.ID})
+	mustRateLimit(t, database.LLMRateLimit{Scope: database.RateLimitScopeProvider, ScopeID: p2.ID, MaxConcurrent: 1, Mode: database.RateLimitModeQueue})
+	held, _ := tryProviderRateLimit(p2.ID)
+	defer held.release()
+
+	rr := doBodyRequest(t, "/chat/completions", token, `{"model":"m"}`)
+	if called {
+		t.Error("throttled hop must be skipped")
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rr.Code)
+	}
+}
@@ -0,0 +1,1569 @@
+package llmgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// translate.go converts chat requests and responses between the wire formats
+// ("dialects") of the upstream APIs the gateway proxies to. It is used when
+// the upstream speaks a different dialect than the client: either a provider
+// whose client_api_type differs from its api_type, or a fallback hop on
+// another vendor. The client's request is decoded into a neutral chatRequest,
+// re-encoded for the upstream, and the upstream's response is decoded and
+// re-encoded in the client's dialect.
+//
+// Text, tool definitions, tool calls and tool results are translated.
+// Images, documents and vendor-specific server tools are not; requests that
+// use them are rejected with errUntranslatable rather than forwarded lossily.
+// Reasoning ("thinking") blocks in the conversation history are dropped.
+//
+// Streaming responses are translated event by event (translate_stream.go).
+// Bedrock is always called non-streaming, and its complete response is
+// replayed to streaming clients as a synthetic stream.
+
+// Wire dialects the translator understands. Several api_type values can map
+// to the same dialect.
+const (
+	dialectOpenAI    = "openai"
+	dialectAnthropic = "anthropic"
+	dialectGoogle    = "google"
+	dialectBedrock   = "bedrock"
+)
+
+// errUntranslatable is returned when a request or response uses a feature
+// the translator does not support. The gateway skips the hop rather than
+// forwarding a lossy translation.
+var errUntranslatable = errors.New("request cannot be translated between API types")
+
+// dialectOf returns the wire dialect for an api_type, or "" when the type
+// cannot take part in translation (responses API, codex, ollama).
+func dialectOf(apiType string) string {
+	switch apiType {
+	case "openai-completions":
+		return dialectOpenAI
+	case "anthropic-messages":
+		return dialectAnthropic
+	case "google-generative-ai":
+		return dialectGoogle
+	case "bedrock-converse", "bedrock-converse-stream":
+		return dialectBedrock
+	}
+	return ""
+}
+
+// CanTranslate reports whether the gateway can serve clients speaking
+// clientAPIType from an upstream speaking upstreamAPIType. Bedrock is
+// accepted upstream but not as a client dialect, because OpenClaw always
+// streams Bedrock requests and the translator does not produce AWS
+// event-stream framing.
+func CanTranslate(clientAPIType, upstreamAPIType string) bool {
+	if clientAPIType == upstreamAPIType {
+		return true
+	}
+	client, upstream := dialectOf(clientAPIType), dialectOf(upstreamAPIType)
+	return client != "" && client != dialectBedrock && upstream != ""
+}
+
+// Block kinds carried by chatMessage and chatResponse.
+const (
+	blockText       = "text"
+	blockToolCall   = "tool_call"
+	blockToolResult = "tool_result"
+)
+
+// chatBlock is one piece of message content. Text blocks use Text; tool
+// calls use ToolCallID, ToolName and Arguments (a JSON object); tool results
+// use ToolCallID, Text and IsError, with ToolName filled in from the matching
+// call when it is known (Gemini addresses results by function name).
+type chatBlock struct {
+	Type       string
+	Text       string
+	ToolCallID string
+	ToolName   string
+	Arguments  json.RawMessage
+	IsError    bool
+}
+
+// chatMessage is a single conversational turn. Role is "user" or "assistant";
+// system prompts are hoisted into chatRequest.System and tool results are
+// carried as blocks of a user turn.
+type chatMessage struct {
+	Role   string
+	Blocks []chatBlock
+}
+
+// Text joins the message's text blocks.
+func (m chatMessage) Text() string { return joinText(m.Blocks, "\n\n") }
+
+// chatTool is a function the model may call. Parameters is a JSON schema.
+type chatTool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// chatToolChoice constrains tool use. Mode is "" (dialect default), "auto",
+// "none", "any" (some tool must be called) or "tool" (Name must be called).
+type chatToolChoice struct {
+	Mode string
+	Name string
+}
+
+// chatRequest is the dialect-neutral form of a chat request.
+type chatRequest struct {
+	Model       string
+	System      string
+	Messages    []chatMessage
+	Tools       []chatTool
+	ToolChoice  chatToolChoice
+	MaxTokens   int
+	Temperature *float64
+	TopP        *float64
+	Stop        []string
+	Stream      bool
+}
+
+// chatResponse is the dialect-neutral form of a complete chat response.
+// StopReason is one of "stop", "length", "tool_use" or "content_filter".
+type chatResponse struct {
+	ID           string
+	Model        string
+	Blocks       []chatBlock
+	StopReason   string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Text joins the response's text blocks.
+func (r *chatResponse) Text() string { return joinText(r.Blocks, "") }
+
+// defaultTranslatedMaxTokens is sent to dialects that require max_tokens
+// (Anthropic) when the client did not set one.
+const defaultTranslatedMaxTokens = 4096
+
+// googleModelPath matches the model and method in Gemini REST paths such as
+// /v1beta/models/gemini-2.0-flash:streamGenerateContent.
+var googleModelPath = regexp.MustCompile(`/models/([^/:]+):([A-Za-z]+)$`)
+
+// googleVersionSuffix matches Gemini base URLs that already carry an API
+// version, including the pre-release ones (/v1beta, /v1alpha).
+var googleVersionSuffix = regexp.MustCompile(`/v\d+(?:alpha|beta)?$`)
+
+// bedrockModelPath matches the model and operation in Bedrock Converse paths
+// such as /model/anthropic.claude-3-haiku/converse.
+var bedrockModelPath = regexp.MustCompile(`/model/([^/]+)/(converse(?:-stream)?)$`)
+
+// --- content helpers ---
+
+func isNull(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// textContent flattens a content field that is either a plain string or a
+// list of typed parts. Only text parts are supported; anything else makes
+// the content untranslatable.
+func textContent(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if isNull(raw) {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	var parts []struct {
+		Type string  `json:"type"`
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.Text == nil || (p.Type != "" && p.Type != "text") {
+			return "", errUntranslatable
+		}
+		sb.WriteString(*p.Text)
+	}
+	return sb.String(), nil
+}
+
+func textBlock(text string) chatBlock { return chatBlock{Type: blockText, Text: text} }
+
+func joinText(blocks []chatBlock, sep string) string {
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == blockText {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// toolArguments validates tool-call arguments and normalizes an empty value
+// to an empty object.
+func toolArguments(raw []byte) (json.RawMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if isNull(raw) {
+		return json.RawMessage("{}"), nil
+	}
+	if !json.Valid(raw) {
+		return nil, errUntranslatable
+	}
+	return json.RawMessage(raw), nil
+}
+
+// appendMessage adds a turn, merging consecutive turns from the same role so
+// the result satisfies dialects that require strict user/assistant
+// alternation. Turns without content are dropped.
+func appendMessage(msgs []chatMessage, role string, blocks ...chatBlock) []chatMessage {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Blocks = append(msgs[n-1].Blocks, blocks...)
+		return msgs
+	}
+	return append(msgs, chatMessage{Role: role, Blocks: blocks})
+}
+
+func joinSystem(existing, text string) string {
+	if existing == "" {
+		return text
+	}
+	return existing + "\n\n" + text
+}
+
+// stopList accepts either a single stop string or a list of them.
+func stopList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		if one == "" {
+			return nil
+		}
+		return []string{one}
+	}
+	var many []string
+	json.Unmarshal(raw, &many)
+	return many
+}
+
+// linkToolResults fills in ToolName on tool results from the tool call they
+// answer, for dialects that only carry the call ID.
+func linkToolResults(msgs []chatMessage) {
+	names := map[string]string{}
+	for i := range msgs {
+		for j := range msgs[i].Blocks {
+			b := &msgs[i].Blocks[j]
+			switch b.Type {
+			case blockToolCall:
+				names[b.ToolCallID] = b.ToolName
+			case blockToolResult:
+				if b.ToolName == "" {
+					b.ToolName = names[b.ToolCallID]
+				}
+			}
+		}
+	}
+}
+
+// finalStopReason reports "tool_use" for responses that ended with tool
+// calls even when the upstream said "stop" (Gemini always does).
+func finalStopReason(stop string, sawToolCall bool) string {
+	if sawToolCall && (stop == "" || stop == "stop") {
+		return "tool_use"
+	}
+	if stop == "" {
+		return "stop"
+	}
+	return stop
+}
+
+func hasToolCall(blocks []chatBlock) bool {
+	for _, b := range blocks {
+		if b.Type == blockToolCall {
+			return true
+		}
+	}
+	return false
+}
+
+// --- request decoding ---
+
+// decodeChatRequest parses a client request in the given dialect. path is
+// the request path, which carries the model (and streaming flag) for Gemini
+// and Bedrock.
+func decodeChatRequest(dialect, path string, body []byte) (*chatRequest, error) {
+	var req *chatRequest
+	var err error
+	switch dialect {
+	case dialectOpenAI:
+		req, err = decodeOpenAIRequest(body)
+	case dialectAnthropic:
+		req, err = decodeAnthropicRequest(body)
+	case dialectGoogle:
+		req, err = decodeGoogleRequest(path, body)
+	case dialectBedrock:
+		req, err = decodeBedrockRequest(path, body)
+	default:
+		return nil, errUntranslatable
+	}
+	if err != nil {
+		return nil, err
+	}
+	linkToolResults(req.Messages)
+	return req, nil
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func openAIToolCallBlocks(calls []openAIToolCall) ([]chatBlock, error) {
+	blocks := make([]chatBlock, 0, len(calls))
+	for _, c := range calls {
+		if c.Type != "" && c.Type != "function" {
+			return nil, errUntranslatable
+		}
+		args, err := toolArguments([]byte(c.Function.Arguments))
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, chatBlock{Type: blockToolCall, ToolCallID: c.ID, ToolName: c.Function.Name, Arguments: args})
+	}
+	return blocks, nil
+}
+
+func decodeOpenAIRequest(body []byte) (*chatRequest, error) {
+	var in struct {
+		Model               string          `json:"model"`
+		MaxTokens           int             `json:"max_tokens"`
+		MaxCompletionTokens int             `json:"max_completion_tokens"`
+		Temperature         *float64        `json:"temperature"`
+		TopP                *float64        `json:"top_p"`
+		Stop                json.RawMessage `json:"stop"`
+		Stream              bool            `json:"stream"`
+		Tools               []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		} `json:"tools"`
+		ToolChoice json.RawMessage `json:"tool_choice"`
+		Messages   []struct {
+			Role       string           `json:"role"`
+			Content    json.RawMessage  `json:"content"`
+			ToolCalls  []openAIToolCall `json:"tool_calls"`
+			ToolCallID string           `json:"tool_call_id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	req := &chatRequest{
+		Model:       in.Model,
+		MaxTokens:   in.MaxTokens,
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		Stop:        stopList(in.Stop),
+		Stream:      in.Stream,
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = in.MaxCompletionTokens
+	}
+	for _, t := range in.Tools {
+		if t.Type != "function" {
+			return nil, errUntranslatable
+		}
+		req.Tools = append(req.Tools, chatTool{Name: t.Function.Name, Description: t.Function.Description, Parameters: t.Function.Parameters})
+	}
+	if !isNull(in.ToolChoice) {
+		var mode string
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		switch {
+		case json.Unmarshal(in.ToolChoice, &mode) == nil:
+			switch mode {
+			case "auto", "none":
+				req.ToolChoice.Mode = mode
+			case "required":
+				req.ToolChoice.Mode = "any"
+			default:
+				return nil, errUntranslatable
+			}
+		case json.Unmarshal(in.ToolChoice, &named) == nil && named.Function.Name != "":
+			req.ToolChoice = chatToolChoice{Mode: "tool", Name: named.Function.Name}
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	for _, m := range in.Messages {
+		text, err := textContent(m.Content)
+		if err != nil {
+			return nil, errUntranslatable
+		}
+		switch m.Role {
+		case "system", "developer":
+			req.System = joinSystem(req.System, text)
+		case "user":
+			req.Messages = appendMessage(req.Messages, "user", textBlock(text))
+		case "assistant":
+			var blocks []chatBlock
+			if text != "" {
+				blocks = append(blocks, textBlock(text))
+			}
+			calls, err := openAIToolCallBlocks(m.ToolCalls)
+			if err != nil {
+				return nil, err
+			}
+			req.Messages = appendMessage(req.Messages, "assistant", append(blocks, calls...)...)
+		case "tool":
+			req.Messages = appendMessage(req.Messages, "user", chatBlock{Type: blockToolResult, ToolCallID: m.ToolCallID, Text: text})
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	return req, nil
+}
+
+// anthropicBlocks parses Anthropic message content (a string or a list of
+// typed blocks).
+func anthropicBlocks(raw json.RawMessage) ([]chatBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if isNull(raw) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		text, err := textContent(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []chatBlock{textBlock(text)}, nil
+	}
+	var parts []struct {
+		Type      string          `json:"type"`
+		Text      string          `json:"text"`
+		ID        string          `json:"id"`
+		Name      string          `json:"name"`
+		Input     json.RawMessage `json:"input"`
+		ToolUseID string          `json:"tool_use_id"`
+		Content   json.RawMessage `json:"content"`
+		IsError   bool            `json:"is_error"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	var blocks []chatBlock
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			blocks = append(blocks, textBlock(p.Text))
+		case "tool_use":
+			args, err := toolArguments(p.Input)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, chatBlock{Type: blockToolCall, ToolCallID: p.ID, ToolName: p.Name, Arguments: args})
+		case "tool_result":
+			if p.ToolUseID == "" {
+				return nil, errUntranslatable
+			}
+			text, err := textContent(p.Content)
+			if err != nil {
+				return nil, errUntranslatable
+			}
+			blocks = append(blocks, chatBlock{Type: blockToolResult, ToolCallID: p.ToolUseID, Text: text, IsError: p.IsError})
+		case "thinking", "redacted_thinking":
+			// Reasoning traces are tied to the vendor that produced them.
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	return blocks, nil
+}
+
+func decodeAnthropicRequest(body []byte) (*chatRequest, error) {
+	var in struct {
+		Model         string          `json:"model"`
+		System        json.RawMessage `json:"system"`
+		MaxTokens     int             `json:"max_tokens"`
+		Temperature   *float64        `json:"temperature"`
+		TopP          *float64        `json:"top_p"`
+		StopSequences []string        `json:"stop_sequences"`
+		Stream        bool            `json:"stream"`
+		Tools         []struct {
+			Type        string          `json:"type"`
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			InputSchema json.RawMessage `json:"input_schema"`
+		} `json:"tools"`
+		ToolChoice *struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"tool_choice"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	system, err := textContent(in.System)
+	if err != nil {
+		return nil, errUntranslatable
+	}
+	req := &chatRequest{
+		Model:       in.Model,
+		System:      system,
+		MaxTokens:   in.MaxTokens,
+		Temperature: in.Temperature,
+		TopP:        in.TopP,
+		Stop:        in.StopSequences,
+		Stream:      in.Stream,
+	}
+	for _, t := range in.Tools {
+		// Server tools (web search, computer use, ...) carry a versioned type
+		// and run on Anthropic's side; they have no equivalent elsewhere.
+		if t.Type != "" && t.Type != "custom" {
+			return nil, errUntranslatable
+		}
+		req.Tools = append(req.Tools, chatTool{Name: t.Name, Description: t.Description, Parameters: t.InputSchema})
+	}
+	if in.ToolChoice != nil {
+		switch in.ToolChoice.Type {
+		case "auto", "none", "any":
+			req.ToolChoice.Mode = in.ToolChoice.Type
+		case "tool":
+			req.ToolChoice = chatToolChoice{Mode: "tool", Name: in.ToolChoice.Name}
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	for _, m := range in.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return nil, errUntranslatable
+		}
+		blocks, err := anthropicBlocks(m.Content)
+		if err != nil {
+			return nil, errUntranslatable
+		}
+		req.Messages = appendMessage(req.Messages, m.Role, blocks...)
+	}
+	return req, nil
+}
+
+type googleFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type googleFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type googlePart struct {
+	Text             *string                 `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	FunctionCall     *googleFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *googleFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type googleContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []googlePart `json:"parts"`
+}
+
+// googleCallIDs assigns IDs to Gemini function calls, which usually have
+// none, and pairs each function response with the oldest unanswered call to
+// the same function.
+type googleCallIDs struct {
+	n       int
+	pending map[string][]string
+}
+
+func (g *googleCallIDs) call(fc *googleFunctionCall) string {
+	id := fc.ID
+	if id == "" {
+		g.n++
+		id = fmt.Sprintf("call_%d", g.n)
+	}
+	if g.pending == nil {
+		g.pending = map[string][]string{}
+	}
+	g.pending[fc.Name] = append(g.pending[fc.Name], id)
+	return id
+}
+
+func (g *googleCallIDs) response(fr *googleFunctionResponse) string {
+	if fr.ID != "" {
+		return fr.ID
+	}
+	if ids := g.pending[fr.Name]; len(ids) > 0 {
+		g.pending[fr.Name] = ids[1:]
+		return ids[0]
+	}
+	g.n++
+	return fmt.Sprintf("call_%d", g.n)
+}
+
+// googleResult extracts the tool output from a functionResponse payload. The
+// translator writes {"content": "..."} or {"error": "..."}; any other shape
+// is passed on as its JSON text.
+func googleResult(raw json.RawMessage) (string, bool) {
+	var wrapped map[string]json.RawMessage
+	if json.Unmarshal(raw, &wrapped) == nil && len(wrapped) == 1 {
+		for k, v := range wrapped {
+			var s string
+			if (k == "content" || k == "error") && json.Unmarshal(v, &s) == nil {
+				return s, k == "error"
+			}
+		}
+	}
+	return string(raw), false
+}
+
+func googleBlocks(c googleContent, ids *googleCallIDs) ([]chatBlock, error) {
+	var blocks []chatBlock
+	for _, p := range c.Parts {
+		switch {
+		case p.Thought:
+		case p.Text != nil:
+			blocks = append(blocks, textBlock(*p.Text))
+		case p.FunctionCall != nil:
+			args, err := toolArguments(p.FunctionCall.Args)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, chatBlock{Type: blockToolCall, ToolCallID: ids.call(p.FunctionCall), ToolName: p.FunctionCall.Name, Arguments: args})
+		case p.FunctionResponse != nil:
+			text, isErr := googleResult(p.FunctionResponse.Response)
+			blocks = append(blocks, chatBlock{Type: blockToolResult, ToolCallID: ids.response(p.FunctionResponse), ToolName: p.FunctionResponse.Name, Text: text, IsError: isErr})
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	return blocks, nil
+}
+
+func decodeGoogleRequest(path string, body []byte) (*chatRequest, error) {
+	m := googleModelPath.FindStringSubmatch(path)
+	if m == nil {
+		return nil, errUntranslatable
+	}
+	var in struct {
+		Contents          []googleContent `json:"contents"`
+		SystemInstruction *googleContent  `json:"systemInstruction"`
+		Tools             []struct {
+			FunctionDeclarations []struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			} `json:"functionDeclarations"`
+		} `json:"tools"`
+		ToolConfig *struct {
+			FunctionCallingConfig struct {
+				Mode                 string   `json:"mode"`
+				AllowedFunctionNames []string `json:"allowedFunctionNames"`
+			} `json:"functionCallingConfig"`
+		} `json:"toolConfig"`
+		GenerationConfig struct {
+			MaxOutputTokens int      `json:"maxOutputTokens"`
+			Temperature     *float64 `json:"temperature"`
+			TopP            *float64 `json:"topP"`
+			StopSequences   []string `json:"stopSequences"`
+		} `json:"generationConfig"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	req := &chatRequest{
+		Model:       m[1],
+		MaxTokens:   in.GenerationConfig.MaxOutputTokens,
+		Temperature: in.GenerationConfig.Temperature,
+		TopP:        in.GenerationConfig.TopP,
+		Stop:        in.GenerationConfig.StopSequences,
+		Stream:      m[2] == "streamGenerateContent",
+	}
+	for _, t := range in.Tools {
+		// Built-in tools (googleSearch, codeExecution, ...) arrive as
+		// entries without function declarations.
+		if len(t.FunctionDeclarations) == 0 {
+			return nil, errUntranslatable
+		}
+		for _, fd := range t.FunctionDeclarations {
+			req.Tools = append(req.Tools, chatTool{Name: fd.Name, Description: fd.Description, Parameters: fd.Parameters})
+		}
+	}
+	if in.ToolConfig != nil {
+		fc := in.ToolConfig.FunctionCallingConfig
+		switch fc.Mode {
+		case "", "AUTO", "MODE_UNSPECIFIED":
+			req.ToolChoice.Mode = "auto"
+		case "NONE":
+			req.ToolChoice.Mode = "none"
+		case "ANY":
+			req.ToolChoice.Mode = "any"
+			if len(fc.AllowedFunctionNames) == 1 {
+				req.ToolChoice = chatToolChoice{Mode: "tool", Name: fc.AllowedFunctionNames[0]}
+			}
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	if in.SystemInstruction != nil {
+		for _, p := range in.SystemInstruction.Parts {
+			if p.Text == nil {
+				return nil, errUntranslatable
+			}
+			req.System += *p.Text
+		}
+	}
+	var ids googleCallIDs
+	for _, c := range in.Contents {
+		blocks, err := googleBlocks(c, &ids)
+		if err != nil {
+			return nil, err
+		}
+		role := "user"
+		if c.Role == "model" {
+			role = "assistant"
+		}
+		req.Messages = appendMessage(req.Messages, role, blocks...)
+	}
+	return req, nil
+}
+
+type bedrockBlock struct {
+	Text    *string `json:"text,omitempty"`
+	ToolUse *struct {
+		ToolUseID string          `json:"toolUseId"`
+		Name      string          `json:"name"`
+		Input     json.RawMessage `json:"input"`
+	} `json:"toolUse,omitempty"`
+	ToolResult *struct {
+		ToolUseID string `json:"toolUseId"`
+		Content   []struct {
+			Text *string         `json:"text"`
+			JSON json.RawMessage `json:"json"`
+		} `json:"content"`
+		Status string `json:"status"`
+	} `json:"toolResult,omitempty"`
+}
+
+func bedrockBlocks(content []bedrockBlock) ([]chatBlock, error) {
+	var blocks []chatBlock
+	for _, b := range content {
+		switch {
+		case b.Text != nil:
+			blocks = append(blocks, textBlock(*b.Text))
+		case b.ToolUse != nil:
+			args, err := toolArguments(b.ToolUse.Input)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, chatBlock{Type: blockToolCall, ToolCallID: b.ToolUse.ToolUseID, ToolName: b.ToolUse.Name, Arguments: args})
+		case b.ToolResult != nil:
+			var sb strings.Builder
+			for _, c := range b.ToolResult.Content {
+				switch {
+				case c.Text != nil:
+					sb.WriteString(*c.Text)
+				case !isNull(c.JSON):
+					sb.Write(c.JSON)
+				default:
+					return nil, errUntranslatable
+				}
+			}
+			blocks = append(blocks, chatBlock{Type: blockToolResult, ToolCallID: b.ToolResult.ToolUseID, Text: sb.String(), IsError: b.ToolResult.Status == "error"})
+		default:
+			return nil, errUntranslatable
+		}
+	}
+	return blocks, nil
+}
+
+func decodeBedrockRequest(path string, body []byte) (*chatRequest, error) {
+	m := bedrockModelPath.FindStringSubmatch(path)
+	// converse-stream replies with AWS event-stream framing, which the
+	// translator does not produce.
+	if m == nil || m[2] != "converse" {
+		return nil, errUntranslatable
+	}
+	var in struct {
+		System   []bedrockBlock `json:"system"`
+		Messages []struct {
+			Role    string         `json:"role"`
+			Content []bedrockBlock `json:"content"`
+		} `json:"messages"`
+		ToolConfig *struct {
+			Tools []struct {
+				ToolSpec *struct {
+					Name        string `json:"name"`
+					Description string `json:"description"`
+					InputSchema struct {
+						JSON json.RawMessage `json:"json"`
+					} `json:"inputSchema"`
+				} `json:"toolSpec"`
+			} `json:"tools"`
+			ToolChoice *struct {
+				Auto *struct{} `json:"auto"`
+				Any  *struct{} `json:"any"`
+				Tool *struct {
+					Name string `json:"name"`
+				} `json:"tool"`
+			} `json:"toolChoice"`
+		} `json:"toolConfig"`
+		InferenceConfig struct {
+			MaxTokens     int      `json:"maxTokens"`
+			Temperature   *float64 `json:"temperature"`
+			TopP          *float64 `json:"topP"`
+			StopSequences []string `json:"stopSequences"`
+		} `json:"inferenceConfig"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	req := &chatRequest{
+		Model:       m[1],
+		MaxTokens:   in.InferenceConfig.MaxTokens,
+		Temperature: in.InferenceConfig.Temperature,
+		TopP:        in.InferenceConfig.TopP,
+		Stop:        in.InferenceConfig.StopSequences,
+	}
+	for _, b := range in.System {
+		if b.Text == nil {
+			return nil, errUntranslatable
+		}
+		req.System += *b.Text
+	}
+	if tc := in.ToolConfig; tc != nil {
+		for _, t := range tc.Tools {
+			if t.ToolSpec == nil {
+				return nil, errUntranslatable
+			}
+			req.Tools = append(req.Tools, chatTool{Name: t.ToolSpec.Name, Description: t.ToolSpec.Description, Parameters: t.ToolSpec.InputSchema.JSON})
+		}
+		if ch := tc.ToolChoice; ch != nil {
+			switch {
+			case ch.Tool != nil:
+				req.ToolChoice = chatToolChoice{Mode: "tool", Name: ch.Tool.Name}
+			case ch.Any != nil:
+				req.ToolChoice.Mode = "any"
+			case ch.Auto != nil:
+				req.ToolChoice.Mode = "auto"
+			}
+		}
+	}
+	for _, msg := range in.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, errUntranslatable
+		}
+		blocks, err := bedrockBlocks(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		req.Messages = appendMessage(req.Messages, msg.Role, blocks...)
+	}
+	return req, nil
+}
+
+// --- request encoding ---
+
+// objectSchema returns a tool's parameter schema, defaulting to an empty
+// object schema for dialects that require one.
+func objectSchema(raw json.RawMessage) json.RawMessage {
+	if isNull(raw) {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return raw
+}
+
+// googleSchema adapts a JSON schema to the OpenAPI subset Gemini accepts,
+// which rejects the $schema and additionalProperties keywords common in
+// schemas written for other vendors.
+func googleSchema(raw json.RawMessage) any {
+	if isNull(raw) {
+		return nil
+	}
+	var v any
+	if json.Unmarshal(raw, &v) != nil {
+		return nil
+	}
+	var strip func(any)
+	strip = func(v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			delete(t, "$schema")
+			delete(t, "additionalProperties")
+			for _, child := range t {
+				strip(child)
+			}
+		case []any:
+			for _, child := range t {
+				strip(child)
+			}
+		}
+	}
+	strip(v)
+	return v
+}
+
+// encodeChatRequest renders req for an upstream in the given dialect and
+// returns the request path to use against baseURL. The upstream request
+// streams when req.Stream is set, except for Bedrock.
+func encodeChatRequest(dialect, baseURL string, req *chatRequest) (string, []byte, error) {
+	switch dialect {
+	case dialectOpenAI:
+		return encodeOpenAIRequest(baseURL, req)
+	case dialectAnthropic:
+		return encodeAnthropicRequest(req)
+	case dialectGoogle:
+		return encodeGoogleRequest(baseURL, req)
+	case dialectBedrock:
+		return encodeBedrockRequest(req)
+	}
+	return "", nil, errUntranslatable
+}
+
+func encodeOpenAIRequest(baseURL string, req *chatRequest) (string, []byte, error) {
+	msgs := make([]map[string]any, 0, len(req.Messages)+1)
+	if req.System != "" {
+		msgs = append(msgs, map[string]any{"role": "system", "content": req.System})
+	}
+	for _, m := range req.Messages {
+		if m.Role == "assistant" {
+			msg := map[string]any{"role": "assistant", "content": nil}
+			if text := m.Text(); text != "" {
+				msg["content"] = text
+			}
+			if calls := openAIToolCalls(m.Blocks); len(calls) > 0 {
+				msg["tool_calls"] = calls
+			}
+			msgs = append(msgs, msg)
+			continue
+		}
+		// Tool results become "tool" messages, which must directly follow
+		// the assistant turn that made the calls.
+		var texts []chatBlock
+		for _, b := range m.Blocks {
+			switch b.Type {
+			case blockToolResult:
+				msgs = append(msgs, map[string]any{"role": "tool", "tool_call_id": b.ToolCallID, "content": b.Text})
+			case blockText:
+				texts = append(texts, b)
+			}
+		}
+		if len(texts) > 0 {
+			msgs = append(msgs, map[string]any{"role": "user", "content": joinText(texts, "\n\n")})
+		}
+	}
+	out := map[string]any{"model": req.Model, "messages": msgs}
+	if req.MaxTokens > 0 {
+		out["max_tokens"] = req.MaxTokens
+	}
+	setOptional(out, "temperature", req.Temperature)
+	setOptional(out, "top_p", req.TopP)
+	if len(req.Stop) > 0 {
+		out["stop"] = req.Stop
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			fn := map[string]any{"name": t.Name, "parameters": objectSchema(t.Parameters)}
+			if t.Description != "" {
+				fn["description"] = t.Description
+			}
+			tools = append(tools, map[string]any{"type": "function", "function": fn})
+		}
+		out["tools"] = tools
+	}
+	switch req.ToolChoice.Mode {
+	case "auto", "none":
+		out["tool_choice"] = req.ToolChoice.Mode
+	case "any":
+		out["tool_choice"] = "required"
+	case "tool":
+		out["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": req.ToolChoice.Name}}
+	}
+	if req.Stream {
+		out["stream"] = true
+		// Usage is only reported in streams when asked for.
+		out["stream_options"] = map[string]any{"include_usage": true}
+	}
+	path := "/v1/chat/completions"
+	if pathEndsWithVersion(baseURL) {
+		path = "/chat/completions"
+	}
+	return marshalRequest(path, out)
+}
+
+func openAIToolCalls(blocks []chatBlock) []map[string]any {
+	var calls []map[string]any
+	for _, b := range blocks {
+		if b.Type == blockToolCall {
+			calls = append(calls, map[string]any{
+				"id": b.ToolCallID, "type": "function",
+				"function": map[string]any{"name": b.ToolName, "arguments": string(b.Arguments)},
+			})
+		}
+	}
+	return calls
+}
+
+func encodeAnthropicRequest(req *chatRequest) (string, []byte, error) {
+	msgs := make([]map[string]any, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if len(m.Blocks) == 1 && m.Blocks[0].Type == blockText {
+			msgs = append(msgs, map[string]any{"role": m.Role, "content": m.Blocks[0].Text})
+			continue
+		}
+		content := make([]map[string]any, 0, len(m.Blocks))
+		for _, b := range m.Blocks {
+			switch b.Type {
+			case blockText:
+				// Anthropic rejects empty text blocks.
+				if b.Text != "" {
+					content = append(content, map[string]any{"type": "text", "text": b.Text})
+				}
+			case blockToolCall:
+				content = append(content, map[string]any{"type": "tool_use", "id": b.ToolCallID, "name": b.ToolName, "input": b.Arguments})
+			case blockToolResult:
+				tr := map[string]any{"type": "tool_result", "tool_use_id": b.ToolCallID, "content": b.Text}
+				if b.IsError {
+					tr["is_error"] = true
+				}
+				content = append(content, tr)
+			}
+		}
+		msgs = append(msgs, map[string]any{"role": m.Role, "content": content})
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultTranslatedMaxTokens
+	}
+	out := map[string]any{"model": req.Model, "messages": msgs, "max_tokens": maxTokens}
+	if req.System != "" {
+		out["system"] = req.System
+	}
+	setOptional(out, "temperature", req.Temperature)
+	setOptional(out, "top_p", req.TopP)
+	if len(req.Stop) > 0 {
+		out["stop_sequences"] = req.Stop
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tool := map[string]any{"name": t.Name, "input_schema": objectSchema(t.Parameters)}
+			if t.Description != "" {
+				tool["description"] = t.Description
+			}
+			tools = append(tools, tool)
+		}
+		out["tools"] = tools
+	}
+	switch req.ToolChoice.Mode {
+	case "auto", "none", "any":
+		out["tool_choice"] = map[string]any{"type": req.ToolChoice.Mode}
+	case "tool":
+		out["tool_choice"] = map[string]any{"type": "tool", "name": req.ToolChoice.Name}
+	}
+	if req.Stream {
+		out["stream"] = true
+	}
+	return marshalRequest("/v1/messages", out)
+}
+
+func encodeGoogleRequest(baseURL string, req *chatRequest) (string, []byte, error) {
+	contents := make([]map[string]any, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		role := "user"
+		if m.Role == "assistant" {
+			role = "model"
+		}
+		parts := make([]map[string]any, 0, len(m.Blocks))
+		for _, b := range m.Blocks {
+			switch b.Type {
+			case blockText:
+				parts = append(parts, map[string]any{"text": b.Text})
+			case blockToolCall:
+				parts = append(parts, map[string]any{"functionCall": map[string]any{"name": b.ToolName, "args": b.Arguments}})
+			case blockToolResult:
+				// Gemini pairs results with calls by function name only.
+				if b.ToolName == "" {
+					return "", nil, errUntranslatable
+				}
+				key := "content"
+				if b.IsError {
+					key = "error"
+				}
+				parts = append(parts, map[string]any{"functionResponse": map[string]any{
+					"name": b.ToolName, "response": map[string]any{key: b.Text},
+				}})
+			}
+		}
+		contents = append(contents, map[string]any{"role": role, "parts": parts})
+	}
+	out := map[string]any{"contents": contents}
+	if req.System != "" {
+		out["systemInstruction"] = map[string]any{"parts": []map[string]any{{"text": req.System}}}
+	}
+	gen := map[string]any{}
+	if req.MaxTokens > 0 {
+		gen["maxOutputTokens"] = req.MaxTokens
+	}
+	setOptional(gen, "temperature", req.Temperature)
+	setOptional(gen, "topP", req.TopP)
+	if len(req.Stop) > 0 {
+		gen["stopSequences"] = req.Stop
+	}
+	if len(gen) > 0 {
+		out["generationConfig"] = gen
+	}
+	if len(req.Tools) > 0 {
+		decls := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			d := map[string]any{"name": t.Name}
+			if t.Description != "" {
+				d["description"] = t.Description
+			}
+			if schema := googleSchema(t.Parameters); schema != nil {
+				d["parameters"] = schema
+			}
+			decls = append(decls, d)
+		}
+		out["tools"] = []map[string]any{{"functionDeclarations": decls}}
+	}
+	switch req.ToolChoice.Mode {
+	case "auto", "none", "any":
+		out["toolConfig"] = map[string]any{"functionCallingConfig": map[string]any{"mode": strings.ToUpper(req.ToolChoice.Mode)}}
+	case "tool":
+		out["toolConfig"] = map[string]any{"functionCallingConfig": map[string]any{
+			"mode": "ANY", "allowedFunctionNames": []string{req.ToolChoice.Name},
+		}}
+	}
+	method := "generateContent"
+	if req.Stream {
+		method = "streamGenerateContent"
+	}
+	path := "/v1beta/models/" + req.Model + ":" + method
+	if googleVersionSuffix.MatchString(baseURL) {
+		path = "/models/" + req.Model + ":" + method
+	}
+	return marshalRequest(path, out)
+}
+
+func encodeBedrockRequest(req *chatRequest) (string, []byte, error) {
+	msgs := make([]map[string]any, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		content := make([]map[string]any, 0, len(m.Blocks))
+		for _, b := range m.Blocks {
+			switch b.Type {
+			case blockText:
+				content = append(content, map[string]any{"text": b.Text})
+			case blockToolCall:
+				content = append(content, map[string]any{"toolUse": map[string]any{"toolUseId": b.ToolCallID, "name": b.ToolName, "input": b.Arguments}})
+			case blockToolResult:
+				tr := map[string]any{"toolUseId": b.ToolCallID, "content": []map[string]any{{"text": b.Text}}}
+				if b.IsError {
+					tr["status"] = "error"
+				}
+				content = append(content, map[string]any{"toolResult": tr})
+			}
+		}
+		msgs = append(msgs, map[string]any{"role": m.Role, "content": content})
+	}
+	out := map[string]any{"messages": msgs}
+	if req.System != "" {
+		out["system"] = []map[string]any{{"text": req.System}}
+	}
+	inf := map[string]any{}
+	if req.MaxTokens > 0 {
+		inf["maxTokens"] = req.MaxTokens
+	}
+	setOptional(inf, "temperature", req.Temperature)
+	setOptional(inf, "topP", req.TopP)
+	if len(req.Stop) > 0 {
+		inf["stopSequences"] = req.Stop
+	}
+	if len(inf) > 0 {
+		out["inferenceConfig"] = inf
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			spec := map[string]any{"name": t.Name, "inputSchema": map[string]any{"json": objectSchema(t.Parameters)}}
+			if t.Description != "" {
+				spec["description"] = t.Description
+			}
+			tools = append(tools, map[string]any{"toolSpec": spec})
+		}
+		cfg := map[string]any{"tools": tools}
+		// Converse has no "none" choice, and dropping the tools instead would
+		// reject a history containing tool blocks, so "none" keeps the default.
+		switch req.ToolChoice.Mode {
+		case "auto":
+			cfg["toolChoice"] = map[string]any{"auto": map[string]any{}}
+		case "any":
+			cfg["toolChoice"] = map[string]any{"any": map[string]any{}}
+		case "tool":
+			cfg["toolChoice"] = map[string]any{"tool": map[string]any{"name": req.ToolChoice.Name}}
+		}
+		out["toolConfig"] = cfg
+	}
+	return marshalRequest("/model/"+req.Model+"/converse", out)
+}
+
+func setOptional(m map[string]any, key string, v *float64) {
+	if v != nil {
+		m[key] = *v
+	}
+}
+
+func marshalRequest(path string, v any) (string, []byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, b, nil
+}
+
+// --- response decoding ---
+
+// decodeChatResponse parses a complete, successful upstream response.
+func decodeChatResponse(dialect string, body []byte) (*chatResponse, error) {
+	var out *chatResponse
+	var err error
+	switch dialect {
+	case dialectOpenAI:
+		out, err = decodeOpenAIResponse(body)
+	case dialectAnthropic:
+		out, err = decodeAnthropicResponse(body)
+	case dialectGoogle:
+		out, err = decodeGoogleResponse(body)
+	case dialectBedrock:
+		out, err = decodeBedrockResponse(body)
+	default:
+		return nil, errUntranslatable
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.StopReason = finalStopReason(out.StopReason, hasToolCall(out.Blocks))
+	return out, nil
+}
+
+func decodeOpenAIResponse(body []byte) (*chatResponse, error) {
+	var in struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   json.RawMessage  `json:"content"`
+				ToolCalls []openAIToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out := &chatResponse{ID: in.ID, Model: in.Model, InputTokens: in.Usage.PromptTokens, OutputTokens: in.Usage.CompletionTokens}
+	if len(in.Choices) > 0 {
+		c := in.Choices[0]
+		text, err := textContent(c.Message.Content)
+		if err != nil {
+			return nil, errUntranslatable
+		}
+		if text != "" {
+			out.Blocks = append(out.Blocks, textBlock(text))
+		}
+		calls, err := openAIToolCallBlocks(c.Message.ToolCalls)
+		if err != nil {
+			return nil, err
+		}
+		out.Blocks = append(out.Blocks, calls...)
+		out.StopReason = normalizeStopReason(c.FinishReason)
+	}
+	return out, nil
+}
+
+func decodeAnthropicResponse(body []byte) (*chatResponse, error) {
+	var in struct {
+		ID         string          `json:"id"`
+		Model      string          `json:"model"`
+		Content    json.RawMessage `json:"content"`
+		StopReason string          `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	blocks, err := anthropicBlocks(in.Content)
+	if err != nil {
+		return nil, errUntranslatable
+	}
+	return &chatResponse{
+		ID: in.ID, Model: in.Model, Blocks: blocks,
+		StopReason:  normalizeStopReason(in.StopReason),
+		InputTokens: in.Usage.InputTokens, OutputTokens: in.Usage.OutputTokens,
+	}, nil
+}
+
+func decodeGoogleResponse(body []byte) (*chatResponse, error) {
+	var in struct {
+		ResponseID   string `json:"responseId"`
+		ModelVersion string `json:"modelVersion"`
+		Candidates   []struct {
+			Content      googleContent `json:"content"`
+			FinishReason string        `json:"finishReason"`
+		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	out := &chatResponse{
+		ID: in.ResponseID, Model: in.ModelVersion,
+		InputTokens: in.UsageMetadata.PromptTokenCount, OutputTokens: in.UsageMetadata.CandidatesTokenCount,
+	}
+	if len(in.Candidates) > 0 {
+		var ids googleCallIDs
+		blocks, err := googleBlocks(in.Candidates[0].Content, &ids)
+		if err != nil {
+			return nil, err
+		}
+		out.Blocks = blocks
+		out.StopReason = normalizeStopReason(in.Candidates[0].FinishReason)
+	}
+	return out, nil
+}
+
+func decodeBedrockResponse(body []byte) (*chatResponse, error) {
+	var in struct {
+		Output struct {
+			Message struct {
+				Content []bedrockBlock `json:"content"`
+			} `json:"message"`
+		} `json:"output"`
+		StopReason string `json:"stopReason"`
+		Usage      struct {
+			InputTokens  int `json:"inputTokens"`
+			OutputTokens int `json:"outputTokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	blocks, err := bedrockBlocks(in.Output.Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &chatResponse{
+		Blocks: blocks, StopReason: normalizeStopReason(in.StopReason),
+		InputTokens: in.Usage.InputTokens, OutputTokens: in.Usage.OutputTokens,
+	}, nil
+}
+
+// normalizeStopReason maps each dialect's finish/stop reason onto the
+// neutral set used by chatResponse. An empty reason stays empty so callers
+// can tell "not reported yet" apart from "stop".
+func normalizeStopReason(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "length", "max_tokens", "MAX_TOKENS":
+		return "length"
+	case "tool_calls", "tool_use", "function_call":
+		return "tool_use"
+	case "content_filter", "content_filtered", "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// --- response encoding ---
+
+// encodeChatResponse renders resp as a complete non-streaming response body
+// in the client's dialect.
+func encodeChatResponse(dialect string, resp *chatResponse) ([]byte, error) {
+	switch dialect {
+	case dialectOpenAI:
+		msg := map[string]any{"role": "assistant", "content": resp.Text()}
+		if calls := openAIToolCalls(resp.Blocks); len(calls) > 0 {
+			msg["tool_calls"] = calls
+			if resp.Text() == "" {
+				msg["content"] = nil
+			}
+		}
+		return json.Marshal(map[string]any{
+			"id":      responseID(resp.ID, "chatcmpl-"),
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   resp.Model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       msg,
+				"finish_reason": openAIFinishReason(resp.StopReason),
+			}},
+			"usage": openAIUsage(resp.InputTokens, resp.OutputTokens),
+		})
+	case dialectAnthropic:
+		content := make([]map[string]any, 0, len(resp.Blocks))
+		for _, b := range resp.Blocks {
+			switch b.Type {
+			case blockText:
+				content = append(content, map[string]any{"type": "text", "text": b.Text})
+			case blockToolCall:
+				content = append(content, map[string]any{"type": "tool_use", "id": b.ToolCallID, "name": b.ToolName, "input": b.Arguments})
+			}
+		}
+		return json.Marshal(map[string]any{
+			"id":            responseID(resp.ID, "msg_"),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         resp.Model,
+			"content":       content,
+			"stop_reason":   anthropicStopReason(resp.StopReason),
+			"stop_sequence": nil,
+			"usage":         map[string]any{"input_tokens": resp.InputTokens, "output_tokens": resp.OutputTokens},
+		})
+	case dialectGoogle:
+		parts := make([]map[string]any, 0, len(resp.Blocks))
+		for _, b := range resp.Blocks {
+			switch b.Type {
+			case blockText:
+				parts = append(parts, map[string]any{"text": b.Text})
+			case blockToolCall:
+				parts = append(parts, map[string]any{"functionCall": map[string]any{"name": b.ToolName, "args": b.Arguments}})
+			}
+		}
+		return json.Marshal(googleResponseBody(resp.Model, parts, resp.StopReason, resp.InputTokens, resp.OutputTokens))
+	case dialectBedrock:
+		content := make([]map[string]any, 0, len(resp.Blocks))
+		for _, b := range resp.Blocks {
+			switch b.Type {
+			case blockText:
+				content = append(content, map[string]any{"text": b.Text})
+			case blockToolCall:
+				content = append(content, map[string]any{"toolUse": map[string]any{"toolUseId": b.ToolCallID, "name": b.ToolName, "input": b.Arguments}})
+			}
+		}
+		return json.Marshal(map[string]any{
+			"output":     map[string]any{"message": map[string]any{"role": "assistant", "content": content}},
+			"stopReason": anthropicStopReason(resp.StopReason),
+			"usage": map[string]any{
+				"inputTokens":  resp.InputTokens,
+				"outputTokens": resp.OutputTokens,
+				"totalTokens":  resp.InputTokens + resp.OutputTokens,
+			},
+		})
+	}
+	return nil, errUntranslatable
+}
+
+// googleResponseBody builds a GenerateContentResponse. It is used both for
+// complete responses and for individual stream chunks; stop is omitted from
+// chunks that do not end the stream.
+func googleResponseBody(model string, parts []map[string]any, stop string, inputTokens, outputTokens int) map[string]any {
+	if len(parts) == 0 {
+		parts = []map[string]any{{"text": ""}}
+	}
+	candidate := map[string]any{
+		"content": map[string]any{"role": "model", "parts": parts},
+		"index":   0,
+	}
+	body := map[string]any{"candidates": []map[string]any{candidate}, "modelVersion": model}
+	if stop != "" {
+		candidate["finishReason"] = googleFinishReason(stop)
+		body["usageMetadata"] = map[string]any{
+			"promptTokenCount":     inputTokens,
+			"candidatesTokenCount": outputTokens,
+			"totalTokenCount":      inputTokens + outputTokens,
+		}
+	}
+	return body
+}
+
+func openAIUsage(inputTokens, outputTokens int) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     inputTokens,
+		"completion_tokens": outputTokens,
+		"total_tokens":      inputTokens + outputTokens,
+	}
+}
+
+func responseID(id, prefix string) string {
+	if id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+}
+
+func openAIFinishReason(stop string) string {
+	switch stop {
+	case "length":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "content_filter":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+func anthropicStopReason(stop string) string {
+	switch stop {
+	case "length":
+		return "max_tokens"
+	case "tool_use":
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+func googleFinishReason(stop string) string {
+	switch stop {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	}
+	return "STOP"
+}
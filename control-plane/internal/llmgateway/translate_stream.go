@@ -0,0 +1,567 @@
+package llmgateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// translate_stream.go translates SSE streams between dialects. An upstream
+// stream is read event by event by a relay function, which reports neutral
+// events (text delta, tool call start, tool argument delta, finish) to a
+// streamRelay; the relay forwards them to a streamEncoder that writes the
+// client's dialect. Events are written as they arrive, so the client sees
+// tokens with the same latency as a same-dialect stream.
+
+// streamEncoder writes a chat stream in one client dialect. Calls arrive in
+// order: start, then any mix of text/toolCall/toolArgs, then finish. Tool
+// calls are identified by a zero-based index; toolArgs fragments for a call
+// follow its toolCall.
+type streamEncoder interface {
+	start(id, model string, inputTokens int)
+	text(s string)
+	toolCall(index int, id, name string)
+	toolArgs(index int, fragment string)
+	finish(stopReason string, inputTokens, outputTokens int)
+}
+
+// newStreamEncoder returns the encoder for a client dialect. Bedrock clients
+// cannot stream through the translator (see CanTranslate).
+func newStreamEncoder(dialect string, w io.Writer) (streamEncoder, error) {
+	switch dialect {
+	case dialectOpenAI:
+		return &openAIStreamEncoder{w: w, created: time.Now().Unix()}, nil
+	case dialectAnthropic:
+		return &anthropicStreamEncoder{w: w, openTool: -1}, nil
+	case dialectGoogle:
+		return &googleStreamEncoder{w: w}, nil
+	}
+	return nil, errUntranslatable
+}
+
+// encodeChatStream renders a complete response as an SSE stream in the
+// client's dialect. Used when the upstream answered without streaming.
+func encodeChatStream(dialect string, resp *chatResponse) ([]byte, error) {
+	var buf bytes.Buffer
+	enc, err := newStreamEncoder(dialect, &buf)
+	if err != nil {
+		return nil, err
+	}
+	enc.start(resp.ID, resp.Model, resp.InputTokens)
+	tool := 0
+	for _, b := range resp.Blocks {
+		switch b.Type {
+		case blockText:
+			enc.text(b.Text)
+		case blockToolCall:
+			enc.toolCall(tool, b.ToolCallID, b.ToolName)
+			enc.toolArgs(tool, string(b.Arguments))
+			tool++
+		}
+	}
+	enc.finish(resp.StopReason, resp.InputTokens, resp.OutputTokens)
+	return buf.Bytes(), nil
+}
+
+func writeSSE(w io.Writer, event string, v any) {
+	b, _ := json.Marshal(v)
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", b)
+}
+
+// --- client encoders ---
+
+type openAIStreamEncoder struct {
+	w       io.Writer
+	id      string
+	model   string
+	created int64
+}
+
+func (e *openAIStreamEncoder) chunk(delta map[string]any, finish any) {
+	writeSSE(e.w, "", map[string]any{
+		"id": e.id, "object": "chat.completion.chunk", "created": e.created, "model": e.model,
+		"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+	})
+}
+
+func (e *openAIStreamEncoder) start(id, model string, _ int) {
+	e.id, e.model = responseID(id, "chatcmpl-"), model
+	e.chunk(map[string]any{"role": "assistant", "content": ""}, nil)
+}
+
+func (e *openAIStreamEncoder) text(s string) {
+	e.chunk(map[string]any{"content": s}, nil)
+}
+
+func (e *openAIStreamEncoder) toolCall(index int, id, name string) {
+	e.chunk(map[string]any{"tool_calls": []map[string]any{{
+		"index": index, "id": id, "type": "function",
+		"function": map[string]any{"name": name, "arguments": ""},
+	}}}, nil)
+}
+
+func (e *openAIStreamEncoder) toolArgs(index int, fragment string) {
+	e.chunk(map[string]any{"tool_calls": []map[string]any{{
+		"index": index, "function": map[string]any{"arguments": fragment},
+	}}}, nil)
+}
+
+func (e *openAIStreamEncoder) finish(stopReason string, inputTokens, outputTokens int) {
+	e.chunk(map[string]any{}, openAIFinishReason(stopReason))
+	// Usage arrives in a trailing chunk with no choices, as OpenAI sends it
+	// for stream_options.include_usage.
+	writeSSE(e.w, "", map[string]any{
+		"id": e.id, "object": "chat.completion.chunk", "created": e.created, "model": e.model,
+		"choices": []any{}, "usage": openAIUsage(inputTokens, outputTokens),
+	})
+	io.WriteString(e.w, "data: [DONE]\n\n")
+}
+
+// anthropicEvent is an Anthropic SSE payload. A struct rather than a map so
+// "type" is serialized first, as Anthropic does and as
+// ParseUsageAnthropicMessagesStream expects.
+type anthropicEvent struct {
+	Type         string `json:"type"`
+	Message      any    `json:"message,omitempty"`
+	Index        *int   `json:"index,omitempty"`
+	ContentBlock any    `json:"content_block,omitempty"`
+	Delta        any    `json:"delta,omitempty"`
+	Usage        any    `json:"usage,omitempty"`
+}
+
+// anthropicStreamEncoder tracks the open content block: Anthropic streams
+// one block at a time, each bracketed by content_block_start/stop.
+type anthropicStreamEncoder struct {
+	w        io.Writer
+	next     int  // index of the next content block
+	open     bool // a block is open at index next-1
+	openText bool
+	openTool int // tool index of the open tool_use block, or -1
+}
+
+func (e *anthropicStreamEncoder) closeBlock() {
+	if e.open {
+		idx := e.next - 1
+		writeSSE(e.w, "content_block_stop", anthropicEvent{Type: "content_block_stop", Index: &idx})
+	}
+	e.open, e.openText, e.openTool = false, false, -1
+}
+
+func (e *anthropicStreamEncoder) openBlock(block map[string]any) {
+	e.closeBlock()
+	idx := e.next
+	e.next++
+	e.open = true
+	writeSSE(e.w, "content_block_start", anthropicEvent{Type: "content_block_start", Index: &idx, ContentBlock: block})
+}
+
+func (e *anthropicStreamEncoder) start(id, model string, inputTokens int) {
+	writeSSE(e.w, "message_start", anthropicEvent{
+		Type: "message_start",
+		Message: map[string]any{
+			"id": responseID(id, "msg_"), "type": "message", "role": "assistant", "model": model,
+			"content": []any{}, "stop_reason": nil, "stop_sequence": nil,
+			"usage": map[string]any{"input_tokens": inputTokens, "output_tokens": 0},
+		},
+	})
+}
+
+func (e *anthropicStreamEncoder) text(s string) {
+	if !e.openText {
+		e.openBlock(map[string]any{"type": "text", "text": ""})
+		e.openText = true
+	}
+	idx := e.next - 1
+	writeSSE(e.w, "content_block_delta", anthropicEvent{
+		Type: "content_block_delta", Index: &idx,
+		Delta: map[string]any{"type": "text_delta", "text": s},
+	})
+}
+
+func (e *anthropicStreamEncoder) toolCall(index int, id, name string) {
+	e.openBlock(map[string]any{"type": "tool_use", "id": id, "name": name, "input": map[string]any{}})
+	e.openTool = index
+}
+
+func (e *anthropicStreamEncoder) toolArgs(index int, fragment string) {
+	// Upstreams stream each call's arguments before starting the next call;
+	// a fragment for any other call has nowhere to go.
+	if index != e.openTool {
+		return
+	}
+	idx := e.next - 1
+	writeSSE(e.w, "content_block_delta", anthropicEvent{
+		Type: "content_block_delta", Index: &idx,
+		Delta: map[string]any{"type": "input_json_delta", "partial_json": fragment},
+	})
+}
+
+func (e *anthropicStreamEncoder) finish(stopReason string, inputTokens, outputTokens int) {
+	e.closeBlock()
+	writeSSE(e.w, "message_delta", anthropicEvent{
+		Type:  "message_delta",
+		Delta: map[string]any{"stop_reason": anthropicStopReason(stopReason), "stop_sequence": nil},
+		Usage: map[string]any{"input_tokens": inputTokens, "output_tokens": outputTokens},
+	})
+	writeSSE(e.w, "message_stop", anthropicEvent{Type: "message_stop"})
+}
+
+// googleStreamEncoder emits text as it arrives but holds tool calls until
+// the end: Gemini sends each functionCall whole, with parsed arguments.
+type googleStreamEncoder struct {
+	w     io.Writer
+	model string
+	calls []*pendingToolCall
+}
+
+type pendingToolCall struct {
+	index int
+	name  string
+	args  strings.Builder
+}
+
+func (e *googleStreamEncoder) start(_, model string, _ int) { e.model = model }
+
+func (e *googleStreamEncoder) text(s string) {
+	writeSSE(e.w, "", googleResponseBody(e.model, []map[string]any{{"text": s}}, "", 0, 0))
+}
+
+func (e *googleStreamEncoder) toolCall(index int, _, name string) {
+	e.calls = append(e.calls, &pendingToolCall{index: index, name: name})
+}
+
+func (e *googleStreamEncoder) toolArgs(index int, fragment string) {
+	for _, c := range e.calls {
+		if c.index == index {
+			c.args.WriteString(fragment)
+			return
+		}
+	}
+}
+
+func (e *googleStreamEncoder) finish(stopReason string, inputTokens, outputTokens int) {
+	parts := make([]map[string]any, 0, len(e.calls))
+	for _, c := range e.calls {
+		args, err := toolArguments([]byte(c.args.String()))
+		if err != nil {
+			args = json.RawMessage("{}")
+		}
+		parts = append(parts, map[string]any{"functionCall": map[string]any{"name": c.name, "args": args}})
+	}
+	writeSSE(e.w, "", googleResponseBody(e.model, parts, finalStopReason(stopReason, false), inputTokens, outputTokens))
+}
+
+// --- upstream relays ---
+
+// streamRelay forwards neutral events to the client encoder, starting the
+// client stream lazily and remembering the stop reason and token usage so
+// the stream can be finished (and logged) once the upstream is done.
+type streamRelay struct {
+	enc      streamEncoder
+	id       string
+	model    string
+	started  bool
+	finished bool
+	sawTool  bool
+	stop     string
+
+	inputTokens       int
+	outputTokens      int
+	cachedInputTokens int
+}
+
+func (s *streamRelay) begin() {
+	if !s.started {
+		s.started = true
+		s.enc.start(s.id, s.model, s.inputTokens+s.cachedInputTokens)
+	}
+}
+
+func (s *streamRelay) text(t string) {
+	if t == "" {
+		return
+	}
+	s.begin()
+	s.enc.text(t)
+}
+
+func (s *streamRelay) toolCall(index int, id, name string) {
+	s.begin()
+	s.sawTool = true
+	s.enc.toolCall(index, id, name)
+}
+
+func (s *streamRelay) toolArgs(index int, fragment string) {
+	if fragment == "" {
+		return
+	}
+	s.begin()
+	s.enc.toolArgs(index, fragment)
+}
+
+// finish ends the client stream. Safe to call more than once.
+func (s *streamRelay) finish() {
+	if s.finished {
+		return
+	}
+	s.begin()
+	s.finished = true
+	s.enc.finish(finalStopReason(s.stop, s.sawTool), s.inputTokens+s.cachedInputTokens, s.outputTokens)
+}
+
+// readSSE calls fn for each event in an SSE stream with the event name (may
+// be empty) and the joined data lines. fn returns io.EOF to stop reading
+// early without error.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []string
+	dispatch := func() error {
+		defer func() { event, data = "", nil }()
+		if len(data) == 0 {
+			return nil
+		}
+		return fn(event, strings.Join(data, "\n"))
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if err := dispatch(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// relayChatStream reads an upstream SSE stream in the given dialect and
+// reports its events to s. The caller finishes s afterwards, whether or not
+// the upstream ended cleanly.
+func relayChatStream(dialect string, body io.Reader, s *streamRelay) error {
+	switch dialect {
+	case dialectOpenAI:
+		return relayOpenAIStream(body, s)
+	case dialectAnthropic:
+		return relayAnthropicStream(body, s)
+	case dialectGoogle:
+		return relayGoogleStream(body, s)
+	}
+	return errUntranslatable
+}
+
+func relayOpenAIStream(body io.Reader, s *streamRelay) error {
+	return readSSE(body, func(_, data string) error {
+		if data == "[DONE]" {
+			return io.EOF
+		}
+		var chunk struct {
+			ID      string `json:"id"`
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content   *string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens        int `json:"prompt_tokens"`
+				CompletionTokens    int `json:"completion_tokens"`
+				PromptTokensDetails struct {
+					CachedTokens int `json:"cached_tokens"`
+				} `json:"prompt_tokens_details"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil
+		}
+		if s.id == "" {
+			s.id = chunk.ID
+		}
+		if chunk.Model != "" {
+			s.model = chunk.Model
+		}
+		if u := chunk.Usage; u != nil {
+			s.cachedInputTokens = u.PromptTokensDetails.CachedTokens
+			s.inputTokens = u.PromptTokens - s.cachedInputTokens
+			s.outputTokens = u.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		c := chunk.Choices[0]
+		if c.Delta.Content != nil {
+			s.text(*c.Delta.Content)
+		}
+		for _, tc := range c.Delta.ToolCalls {
+			if tc.ID != "" {
+				s.toolCall(tc.Index, tc.ID, tc.Function.Name)
+			}
+			s.toolArgs(tc.Index, tc.Function.Arguments)
+		}
+		if c.FinishReason != nil {
+			s.stop = normalizeStopReason(*c.FinishReason)
+		}
+		return nil
+	})
+}
+
+func relayAnthropicStream(body io.Reader, s *streamRelay) error {
+	toolIndex := map[int]int{} // content block index → tool call index
+	return readSSE(body, func(_, data string) error {
+		var ev struct {
+			Type    string `json:"type"`
+			Message struct {
+				ID    string `json:"id"`
+				Model string `json:"model"`
+				Usage struct {
+					InputTokens          int `json:"input_tokens"`
+					CacheReadInputTokens int `json:"cache_read_input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Index        int `json:"index"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+				Text string `json:"text"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil
+		}
+		switch ev.Type {
+		case "message_start":
+			s.id, s.model = ev.Message.ID, ev.Message.Model
+			s.inputTokens = ev.Message.Usage.InputTokens
+			s.cachedInputTokens = ev.Message.Usage.CacheReadInputTokens
+			s.begin()
+		case "content_block_start":
+			switch ev.ContentBlock.Type {
+			case "text":
+				s.text(ev.ContentBlock.Text)
+			case "tool_use":
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				s.toolCall(idx, ev.ContentBlock.ID, ev.ContentBlock.Name)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				s.text(ev.Delta.Text)
+			case "input_json_delta":
+				if idx, ok := toolIndex[ev.Index]; ok {
+					s.toolArgs(idx, ev.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if ev.Delta.StopReason != "" {
+				s.stop = normalizeStopReason(ev.Delta.StopReason)
+			}
+			s.outputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			return io.EOF
+		case "error":
+			return fmt.Errorf("upstream stream error: %s", ev.Error.Message)
+		}
+		return nil
+	})
+}
+
+func relayGoogleStream(body io.Reader, s *streamRelay) error {
+	var ids googleCallIDs
+	tools := 0
+	return readSSE(body, func(_, data string) error {
+		var chunk struct {
+			ResponseID   string `json:"responseId"`
+			ModelVersion string `json:"modelVersion"`
+			Candidates   []struct {
+				Content      googleContent `json:"content"`
+				FinishReason string        `json:"finishReason"`
+			} `json:"candidates"`
+			UsageMetadata *struct {
+				PromptTokenCount        int `json:"promptTokenCount"`
+				CandidatesTokenCount    int `json:"candidatesTokenCount"`
+				CachedContentTokenCount int `json:"cachedContentTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil
+		}
+		if s.id == "" {
+			s.id = chunk.ResponseID
+		}
+		if chunk.ModelVersion != "" {
+			s.model = chunk.ModelVersion
+		}
+		if u := chunk.UsageMetadata; u != nil {
+			// promptTokenCount includes the cached tokens.
+			s.cachedInputTokens = u.CachedContentTokenCount
+			s.inputTokens = u.PromptTokenCount - s.cachedInputTokens
+			s.outputTokens = u.CandidatesTokenCount
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		c := chunk.Candidates[0]
+		for _, p := range c.Content.Parts {
+			switch {
+			case p.Thought:
+			case p.Text != nil:
+				s.text(*p.Text)
+			case p.FunctionCall != nil:
+				args, err := toolArguments(p.FunctionCall.Args)
+				if err != nil {
+					return err
+				}
+				s.toolCall(tools, ids.call(p.FunctionCall), p.FunctionCall.Name)
+				s.toolArgs(tools, string(args))
+				tools++
+			}
+		}
+		if c.FinishReason != "" {
+			s.stop = normalizeStopReason(c.FinishReason)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,227 @@
+package llmgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+func TestRelayAnthropicStream_ToOpenAI(t *testing.T) {
+	upstream := strings.Join([]string{
+		`event: message_start`,
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-x","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me check."}}`,
+		``,
+		`event: content_block_start`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_9","name":"search","input":{}}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		``,
+		`event: content_block_delta`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go\"}"}}`,
+		``,
+		`event: message_delta`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		``,
+		`event: message_stop`,
+		`data: {"type":"message_stop"}`,
+		``,
+	}, "\n")
+
+	var out bytes.Buffer
+	enc, _ := newStreamEncoder(dialectOpenAI, &out)
+	relay := &streamRelay{enc: enc}
+	if err := relayChatStream(dialectAnthropic, strings.NewReader(upstream), relay); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	relay.finish()
+
+	if relay.inputTokens != 12 || relay.outputTokens != 20 {
+		t.Errorf("usage = %d/%d, want 12/20", relay.inputTokens, relay.outputTokens)
+	}
+	s := out.String()
+	for _, want := range []string{
+		`"content":"Let me check."`,
+		`"id":"toolu_9"`,
+		`"name":"search"`,
+		`"arguments":"{\"q\":"`,
+		`"finish_reason":"tool_calls"`,
+		"data: [DONE]",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("openai stream missing %s:\n%s", want, s)
+		}
+	}
+	in, outTok, _ := GetAPIType("openai-completions").ParseStreamingUsage(out.Bytes())
+	if in != 12 || outTok != 20 {
+		t.Errorf("client-visible usage = %d/%d, want 12/20", in, outTok)
+	}
+}
+
+func TestRelayOpenAIStream_ToAnthropic(t *testing.T) {
+	upstream := strings.Join([]string{
+		`data: {"id":"c1","model":"gpt-4o","choices":[{"delta":{"role":"assistant","content":"Hi"}}]}`,
+		``,
+		`data: {"id":"c1","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"f","arguments":""}}]}}]}`,
+		``,
+		`data: {"id":"c1","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]}}]}`,
+		``,
+		`data: {"id":"c1","choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		``,
+		`data: {"id":"c1","choices":[],"usage":{"prompt_tokens":30,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":10}}}`,
+		``,
+		`data: [DONE]`,
+		``,
+	}, "\n")
+
+	var out bytes.Buffer
+	enc, _ := newStreamEncoder(dialectAnthropic, &out)
+	relay := &streamRelay{enc: enc}
+	if err := relayChatStream(dialectOpenAI, strings.NewReader(upstream), relay); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	relay.finish()
+
+	if relay.inputTokens != 20 || relay.cachedInputTokens != 10 || relay.outputTokens != 5 {
+		t.Errorf("usage = %d/%d/%d, want 20/5/10 cached", relay.inputTokens, relay.outputTokens, relay.cachedInputTokens)
+	}
+	s := out.String()
+	order := []string{
+		"event: message_start",
+		`"delta":{"text":"Hi","type":"text_delta"}`,
+		"event: content_block_stop",
+		`"content_block":{"id":"call_a","input":{},"name":"f","type":"tool_use"}`,
+		`"partial_json":"{}"`,
+		`"stop_reason":"tool_use"`,
+		"event: message_stop",
+	}
+	pos := 0
+	for _, want := range order {
+		i := strings.Index(s[pos:], want)
+		if i < 0 {
+			t.Fatalf("anthropic stream missing %s after offset %d:\n%s", want, pos, s)
+		}
+		pos += i + len(want)
+	}
+}
+
+func TestRelayGoogleStream_ToOpenAI(t *testing.T) {
+	upstream := strings.Join([]string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"modelVersion":"gemini-2.0-flash"}`,
+		``,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"},{"functionCall":{"name":"f","args":{"a":1}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":3}}`,
+		``,
+	}, "\n")
+
+	var out bytes.Buffer
+	enc, _ := newStreamEncoder(dialectOpenAI, &out)
+	relay := &streamRelay{enc: enc}
+	if err := relayChatStream(dialectGoogle, strings.NewReader(upstream), relay); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	relay.finish()
+
+	s := out.String()
+	for _, want := range []string{`"content":"Hel"`, `"content":"lo"`, `"id":"call_1"`, `"arguments":"{\"a\":1}"`, `"finish_reason":"tool_calls"`, `"model":"gemini-2.0-flash"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("openai stream missing %s:\n%s", want, s)
+		}
+	}
+	if relay.inputTokens != 8 || relay.outputTokens != 3 {
+		t.Errorf("usage = %d/%d, want 8/3", relay.inputTokens, relay.outputTokens)
+	}
+}
+
+func TestGoogleStreamEncoder_BuffersToolCalls(t *testing.T) {
+	var out bytes.Buffer
+	enc, _ := newStreamEncoder(dialectGoogle, &out)
+	enc.start("", "m", 0)
+	enc.text("ok")
+	enc.toolCall(0, "call_1", "f")
+	enc.toolArgs(0, `{"x":`)
+	enc.toolArgs(0, `2}`)
+	enc.finish("tool_use", 4, 2)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 chunks (text, final), got %d:\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[1], `"functionCall":{"args":{"x":2},"name":"f"}`) || !strings.Contains(lines[1], `"finishReason":"STOP"`) {
+		t.Errorf("final chunk = %s", lines[1])
+	}
+	if strings.Contains(lines[0], "finishReason") {
+		t.Errorf("text chunk must not carry a finish reason: %s", lines[0])
+	}
+}
+
+func TestClientAPIType_StreamsTranslatedEvents(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"claude-x\",\"usage\":{\"input_tokens\":7}}}\n\n"+
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"salut\"}}\n\n"+
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n"+
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	p := mustProvider(t, "anthropic", "anthropic-messages", upstream.URL)
+	database.DB.Model(&p).Update("client_api_type", "openai-completions")
+	token := mustGatewayKey(t, 1, p.ID)
+
+	rr := doBodyRequest(t, "/chat/completions", token,
+		`{"model":"claude-x","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	if gotPath != "/v1/messages" || gotBody["stream"] != true {
+		t.Errorf("upstream path=%q body=%v", gotPath, gotBody)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{`"object":"chat.completion.chunk"`, `"content":"salut"`, `"finish_reason":"stop"`, "data: [DONE]"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("client stream missing %s:\n%s", want, body)
+		}
+	}
+	if l := lastLog(t); l.ProviderID != p.ID || l.FallbackHop != 0 || l.InputTokens != 7 || l.OutputTokens != 2 {
+		t.Errorf("log = %+v", l)
+	}
+}
+
+func TestClientAPIType_UntranslatableRequestRejected(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer upstream.Close()
+
+	setupDB(t)
+	p := mustProvider(t, "anthropic", "anthropic-messages", upstream.URL)
+	database.DB.Model(&p).Update("client_api_type", "openai-completions")
+	token := mustGatewayKey(t, 1, p.ID)
+
+	rr := doBodyRequest(t, "/chat/completions", token,
+		`{"model":"m","tools":[{"type":"custom","custom":{"name":"x"}}],"messages":[{"role":"user","content":"hi"}]}`)
+	if called {
+		t.Error("upstream must not be called for an untranslatable request")
+	}
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "untranslatable_request") {
+		t.Errorf("status = %d body = %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,297 @@
+package llmgateway
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDialectOf(t *testing.T) {
+	tests := map[string]string{
+		"openai-completions":      dialectOpenAI,
+		"anthropic-messages":      dialectAnthropic,
+		"google-generative-ai":    dialectGoogle,
+		"bedrock-converse":        dialectBedrock,
+		"bedrock-converse-stream": dialectBedrock,
+		"openai-responses":        "",
+		"ollama":                  "",
+	}
+	for apiType, want := range tests {
+		if got := dialectOf(apiType); got != want {
+			t.Errorf("dialectOf(%q) = %q, want %q", apiType, got, want)
+		}
+	}
+}
+
+func TestDecodeChatRequest_OpenAI(t *testing.T) {
+	body := `{"model":"gpt-4o","stream":true,"max_tokens":100,"stop":"END","messages":[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":[{"type":"text","text":"hi"}]},
+		{"role":"user","content":"there"},
+		{"role":"assistant","content":"hello"}]}`
+	req, err := decodeChatRequest(dialectOpenAI, "/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if req.Model != "gpt-4o" || !req.Stream || req.MaxTokens != 100 || req.System != "be brief" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if len(req.Stop) != 1 || req.Stop[0] != "END" {
+		t.Errorf("stop = %v", req.Stop)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Text() != "hi\n\nthere" || req.Messages[1].Role != "assistant" {
+		t.Errorf("messages = %+v, want merged user turn then assistant", req.Messages)
+	}
+}
+
+func TestDecodeChatRequest_GoogleModelFromPath(t *testing.T) {
+	body := `{"systemInstruction":{"parts":[{"text":"sys"}]},"contents":[{"role":"user","parts":[{"text":"q"}]},{"role":"model","parts":[{"text":"a"}]}],"generationConfig":{"maxOutputTokens":50}}`
+	req, err := decodeChatRequest(dialectGoogle, "/v1beta/models/gemini-2.0-flash:streamGenerateContent", []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if req.Model != "gemini-2.0-flash" || !req.Stream || req.System != "sys" || req.MaxTokens != 50 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	if len(req.Messages) != 2 || req.Messages[1].Role != "assistant" {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+}
+
+func TestDecodeChatRequest_Untranslatable(t *testing.T) {
+	cases := []struct {
+		dialect, path, body string
+	}{
+		{dialectOpenAI, "/chat/completions", `{"messages":[{"role":"user","content":"x"}],"tools":[{"type":"custom","name":"x"}]}`},
+		{dialectOpenAI, "/chat/completions", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"x"}}]}]}`},
+		{dialectAnthropic, "/v1/messages", `{"messages":[{"role":"user","content":[{"type":"tool_result","content":"x"}]}]}`},
+		{dialectBedrock, "/model/m/converse-stream", `{"messages":[]}`},
+	}
+	for _, tc := range cases {
+		if _, err := decodeChatRequest(tc.dialect, tc.path, []byte(tc.body)); !errors.Is(err, errUntranslatable) {
+			t.Errorf("%s %s: err = %v, want errUntranslatable", tc.dialect, tc.body, err)
+		}
+	}
+}
+
+func TestEncodeChatRequest_Anthropic(t *testing.T) {
+	req := &chatRequest{Model: "claude", System: "sys", Messages: []chatMessage{{Role: "user", Blocks: []chatBlock{textBlock("hi")}}}, Stop: []string{"X"}}
+	path, body, err := encodeChatRequest(dialectAnthropic, "https://api.anthropic.com", req)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if path != "/v1/messages" {
+		t.Errorf("path = %q", path)
+	}
+	var doc map[string]any
+	json.Unmarshal(body, &doc)
+	if doc["system"] != "sys" || doc["max_tokens"] != float64(defaultTranslatedMaxTokens) || doc["stream"] != nil {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestEncodeChatRequest_Paths(t *testing.T) {
+	req := &chatRequest{Model: "m", Messages: []chatMessage{{Role: "user", Blocks: []chatBlock{textBlock("hi")}}}}
+	tests := []struct {
+		dialect, baseURL, want string
+	}{
+		{dialectOpenAI, "https://api.openai.com/v1", "/chat/completions"},
+		{dialectOpenAI, "https://example.com", "/v1/chat/completions"},
+		{dialectGoogle, "https://generativelanguage.googleapis.com", "/v1beta/models/m:generateContent"},
+		{dialectGoogle, "https://generativelanguage.googleapis.com/v1beta", "/models/m:generateContent"},
+		{dialectBedrock, "https://bedrock-runtime.us-east-1.amazonaws.com", "/model/m/converse"},
+	}
+	for _, tc := range tests {
+		path, _, err := encodeChatRequest(tc.dialect, tc.baseURL, req)
+		if err != nil || path != tc.want {
+			t.Errorf("%s %s: path = %q (err %v), want %q", tc.dialect, tc.baseURL, path, err, tc.want)
+		}
+	}
+}
+
+func TestChatResponse_RoundTrip(t *testing.T) {
+	resp := &chatResponse{ID: "r1", Model: "m", Blocks: []chatBlock{textBlock("hello")}, StopReason: "length", InputTokens: 7, OutputTokens: 3}
+	for _, d := range []string{dialectOpenAI, dialectAnthropic, dialectGoogle, dialectBedrock} {
+		body, err := encodeChatResponse(d, resp)
+		if err != nil {
+			t.Fatalf("%s encode: %v", d, err)
+		}
+		got, err := decodeChatResponse(d, body)
+		if err != nil {
+			t.Fatalf("%s decode: %v", d, err)
+		}
+		if got.Text() != "hello" || got.StopReason != "length" || got.InputTokens != 7 || got.OutputTokens != 3 {
+			t.Errorf("%s round trip = %+v", d, got)
+		}
+	}
+}
+
+func TestEncodeChatStream_UsageParseable(t *testing.T) {
+	resp := &chatResponse{Model: "m", Blocks: []chatBlock{textBlock("hi")}, StopReason: "stop", InputTokens: 11, OutputTokens: 4}
+	tests := []struct {
+		dialect, apiType, marker string
+	}{
+		{dialectOpenAI, "openai-completions", "data: [DONE]"},
+		{dialectAnthropic, "anthropic-messages", "event: message_stop"},
+	}
+	for _, tc := range tests {
+		out, err := encodeChatStream(tc.dialect, resp)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dialect, err)
+		}
+		if !strings.Contains(string(out), tc.marker) {
+			t.Errorf("%s stream missing %q:\n%s", tc.dialect, tc.marker, out)
+		}
+		in, outTok, _ := GetAPIType(tc.apiType).ParseStreamingUsage(out)
+		if in != 11 || outTok != 4 {
+			t.Errorf("%s stream usage = %d/%d, want 11/4", tc.dialect, in, outTok)
+		}
+	}
+	if out, _ := encodeChatStream(dialectGoogle, resp); !strings.Contains(string(out), `"text":"hi"`) {
+		t.Errorf("google stream = %s", out)
+	}
+	if _, err := encodeChatStream(dialectBedrock, resp); !errors.Is(err, errUntranslatable) {
+		t.Errorf("bedrock stream err = %v, want errUntranslatable", err)
+	}
+}
+
+func TestTranslateTools_OpenAIToAnthropic(t *testing.T) {
+	body := `{"model":"gpt-4o","tool_choice":"required","tools":[{"type":"function","function":{"name":"get_weather","description":"Look up weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],
+		"messages":[
+		{"role":"user","content":"weather in Paris?"},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"}]}`
+	req, err := decodeChatRequest(dialectOpenAI, "/chat/completions", []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	_, out, err := encodeChatRequest(dialectAnthropic, "https://api.anthropic.com", req)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var doc struct {
+		Tools []struct {
+			Name        string         `json:"name"`
+			InputSchema map[string]any `json:"input_schema"`
+		} `json:"tools"`
+		ToolChoice map[string]any `json:"tool_choice"`
+		Messages   []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(doc.Tools) != 1 || doc.Tools[0].Name != "get_weather" || doc.Tools[0].InputSchema["type"] != "object" {
+		t.Errorf("tools = %+v", doc.Tools)
+	}
+	if doc.ToolChoice["type"] != "any" {
+		t.Errorf("tool_choice = %v, want any", doc.ToolChoice)
+	}
+	if len(doc.Messages) != 3 {
+		t.Fatalf("messages = %s", out)
+	}
+	if s := string(doc.Messages[1].Content); !strings.Contains(s, `"type":"tool_use"`) || !strings.Contains(s, `"id":"call_1"`) || !strings.Contains(s, `"city":"Paris"`) {
+		t.Errorf("assistant content = %s", s)
+	}
+	if s := string(doc.Messages[2].Content); doc.Messages[2].Role != "user" || !strings.Contains(s, `"tool_use_id":"call_1"`) || !strings.Contains(s, `"content":"sunny"`) {
+		t.Errorf("tool result turn = %s %s", doc.Messages[2].Role, s)
+	}
+}
+
+func TestTranslateTools_AnthropicToGoogle(t *testing.T) {
+	body := `{"model":"claude","max_tokens":100,"tool_choice":{"type":"tool","name":"lookup"},
+		"tools":[{"name":"lookup","input_schema":{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","additionalProperties":false,"properties":{"q":{"type":"string"}}}}],
+		"messages":[
+		{"role":"user","content":"find it"},
+		{"role":"assistant","content":[{"type":"thinking","thinking":"hmm"},{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"q":"x"}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"not found"}],"is_error":true}]}]}`
+	req, err := decodeChatRequest(dialectAnthropic, "/v1/messages", []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	path, out, err := encodeChatRequest(dialectGoogle, "https://generativelanguage.googleapis.com", req)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if path != "/v1beta/models/claude:generateContent" {
+		t.Errorf("path = %q", path)
+	}
+	s := string(out)
+	for _, want := range []string{
+		`"functionDeclarations":[{"name":"lookup","parameters":{"properties":{"q":{"type":"string"}},"type":"object"}}]`,
+		`"functionCall":{"args":{"q":"x"},"name":"lookup"}`,
+		`"functionResponse":{"name":"lookup","response":{"error":"not found"}}`,
+		`"allowedFunctionNames":["lookup"]`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("google body missing %s:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "hmm") || strings.Contains(s, "$schema") {
+		t.Errorf("thinking block or $schema leaked: %s", s)
+	}
+}
+
+func TestTranslateTools_GoogleCallIDs(t *testing.T) {
+	body := `{"contents":[
+		{"role":"user","parts":[{"text":"go"}]},
+		{"role":"model","parts":[{"functionCall":{"name":"a","args":{}}},{"functionCall":{"name":"b"}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"b","response":{"content":"B"}}},{"functionResponse":{"name":"a","response":{"n":1}}}]}]}`
+	req, err := decodeChatRequest(dialectGoogle, "/v1beta/models/gemini:generateContent", []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	calls, results := req.Messages[1].Blocks, req.Messages[2].Blocks
+	if calls[0].ToolCallID == calls[1].ToolCallID || string(calls[1].Arguments) != "{}" {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if results[0].ToolCallID != calls[1].ToolCallID || results[0].Text != "B" {
+		t.Errorf("result for b = %+v, want id %s", results[0], calls[1].ToolCallID)
+	}
+	if results[1].ToolCallID != calls[0].ToolCallID || results[1].Text != `{"n":1}` {
+		t.Errorf("result for a = %+v, want id %s", results[1], calls[0].ToolCallID)
+	}
+}
+
+func TestDecodeChatResponse_GoogleToolCallStopReason(t *testing.T) {
+	body := `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"f","args":{"x":1}}}]},"finishReason":"STOP"}]}`
+	resp, err := decodeChatResponse(dialectGoogle, []byte(body))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StopReason != "tool_use" {
+		t.Errorf("stop reason = %q, want tool_use", resp.StopReason)
+	}
+	out, err := encodeChatResponse(dialectOpenAI, resp)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	for _, want := range []string{`"finish_reason":"tool_calls"`, `"arguments":"{\"x\":1}"`, `"content":null`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("openai response missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestCanTranslate(t *testing.T) {
+	tests := []struct {
+		client, upstream string
+		want             bool
+	}{
+		{"openai-completions", "anthropic-messages", true},
+		{"anthropic-messages", "google-generative-ai", true},
+		{"openai-completions", "bedrock-converse", true},
+		{"bedrock-converse-stream", "openai-completions", false},
+		{"openai-responses", "anthropic-messages", false},
+		{"openai-completions", "ollama", false},
+		{"ollama", "ollama", true},
+	}
+	for _, tc := range tests {
+		if got := CanTranslate(tc.client, tc.upstream); got != tc.want {
+			t.Errorf("CanTranslate(%s, %s) = %v, want %v", tc.client, tc.upstream, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Package metrics exposes control-plane metrics in the Prometheus text
+// exposition format (version 0.0.4) on GET /metrics. See docs/metrics.md.
+//
+// Two kinds of metrics are registered:
+//
+//   - Counter and histogram vectors, updated in-process by the code that
+//     observes an event (an LLM request, an SSH gateway login).
+//   - Collectors, which build gauges and counters at scrape time from state
+//     that already lives elsewhere (SSH manager, task manager, database), so
+//     nothing has to be kept in sync.
+package metrics
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types as written in # TYPE lines.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefBuckets are latency buckets in seconds suited to LLM and backup
+// durations, which range from sub-second to minutes.
+var DefBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Sample is one value of a family. Labels are name/value pairs in the
+// order they are written.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// Family is a metric name with its help text, type and samples, as built by
+// a Collector.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector returns families computed at scrape time.
+type Collector func() []Family
+
+// Registry holds vectors and collectors. The zero value is not usable; use
+// NewRegistry.
+type Registry struct {
+	mu         sync.Mutex
+	vecs       []writer
+	collectors []Collector
+}
+
+type writer interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry served by Handler.
+var Default = NewRegistry()
+
+// RegisterCollector adds a scrape-time collector to the default registry.
+func RegisterCollector(c Collector) {
+	Default.RegisterCollector(c)
+}
+
+// RegisterCollector adds a scrape-time collector.
+func (r *Registry) RegisterCollector(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) register(v writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vecs = append(r.vecs, v)
+}
+
+// Write renders every metric in the registry, families sorted by name.
+func (r *Registry) Write(out io.Writer) error {
+	r.mu.Lock()
+	vecs := append([]writer(nil), r.vecs...)
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	type entry struct {
+		name  string
+		write func(w *bufio.Writer)
+	}
+	var entries []entry
+	for _, v := range vecs {
+		entries = append(entries, entry{v.name(), v.write})
+	}
+	for _, c := range collectors {
+		for _, f := range c() {
+			f := f
+			entries = append(entries, entry{f.Name, func(w *bufio.Writer) { writeFamily(w, f) }})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	w := bufio.NewWriter(out)
+	for _, e := range entries {
+		e.write(w)
+	}
+	return w.Flush()
+}
+
+// Handler serves the default registry. When token is non-empty, requests
+// must carry it as "Authorization: Bearer <token>".
+func Handler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w) //nolint:errcheck
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+func writeFamily(w *bufio.Writer, f Family) {
+	writeHeader(w, f.Name, f.Help, f.Type)
+	samples := append([]Sample(nil), f.Samples...)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return formatLabels(samples[i].Labels) < formatLabels(samples[j].Labels)
+	})
+	for _, s := range samples {
+		writeSample(w, f.Name, s.Labels, s.Value)
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, v float64) {
+	w.WriteString(name)
+	w.WriteString(formatLabels(labels))
+	w.WriteByte(' ')
+	w.WriteString(formatValue(v))
+	w.WriteByte('\n')
+}
+
+// formatLabels renders name/value pairs as {a="x",b="y"}, or "" when empty.
+func formatLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+// zip pairs label names with values.
+func zip(names, values []string) []string {
+	pairs := make([]string, 0, 2*len(names))
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, n, v)
+	}
+	return pairs
+}
+
+// labelKey joins label values into a map key.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	fam    string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	v      float64
+}
+
+// NewCounterVec creates a counter vector in the default registry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+
+// NewCounterVec creates a counter vector in r.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{fam: name, help: help, labels: labelNames, values: map[string]*counterValue{}}
+	r.register(c)
+	return c
+}
+
+// Inc adds 1 to the counter for labelValues.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for labelValues. Negative values are ignored:
+// counters only go up.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = cv
+	}
+	cv.v += v
+}
+
+// Value returns the counter for labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cv, ok := c.values[labelKey(labelValues)]; ok {
+		return cv.v
+	}
+	return 0
+}
+
+func (c *CounterVec) name() string { return c.fam }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	f := Family{Name: c.fam, Help: c.help, Type: TypeCounter}
+	for _, cv := range c.values {
+		f.Samples = append(f.Samples, Sample{Labels: zip(c.labels, cv.labels), Value: cv.v})
+	}
+	c.mu.Unlock()
+	writeFamily(w, f)
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	fam     string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram vector in the default registry.
+// buckets are upper bounds in increasing order; +Inf is implied.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// NewHistogramVec creates a histogram vector in r.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{fam: name, help: help, labels: labelNames, buckets: buckets, values: map[string]*histogramValue{}}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the histogram for labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			hv.counts[i]++
+			break
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) name() string { return h.fam }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.fam, h.help, TypeHistogram)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		hv := h.values[k]
+		pairs := zip(h.labels, hv.labels)
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += hv.counts[i]
+			writeSample(w, h.fam+"_bucket", append(append([]string(nil), pairs...), "le", formatValue(ub)), float64(cum))
+		}
+		writeSample(w, h.fam+"_bucket", append(append([]string(nil), pairs...), "le", "+Inf"), float64(hv.count))
+		writeSample(w, h.fam+"_sum", pairs, hv.sum)
+		writeSample(w, h.fam+"_count", pairs, float64(hv.count))
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return b.String()
+}
+
+func TestCounterVec_Exposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("claworc_test_total", "Test counter.", "kind", "name")
+	c.Inc("b", "x")
+	c.Add(2.5, "a", `quo"te\`)
+	c.Add(-1, "a", `quo"te\`)
+
+	want := `# HELP claworc_test_total Test counter.
+# TYPE claworc_test_total counter
+claworc_test_total{kind="a",name="quo\"te\\"} 2.5
+claworc_test_total{kind="b",name="x"} 1
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if v := c.Value("b", "x"); v != 1 {
+		t.Errorf("Value = %v", v)
+	}
+}
+
+func TestHistogramVec_Exposition(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("claworc_test_seconds", "Test histogram.", []float64{1, 5}, "op")
+	h.Observe(0.5, "x")
+	h.Observe(3, "x")
+	h.Observe(10, "x")
+
+	want := `# HELP claworc_test_seconds Test histogram.
+# TYPE claworc_test_seconds histogram
+claworc_test_seconds_bucket{op="x",le="1"} 1
+claworc_test_seconds_bucket{op="x",le="5"} 2
+claworc_test_seconds_bucket{op="x",le="+Inf"} 3
+claworc_test_seconds_sum{op="x"} 13.5
+claworc_test_seconds_count{op="x"} 3
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCollector_SortedWithVectors(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("claworc_b_total", "B.").Inc()
+	r.RegisterCollector(func() []Family {
+		return []Family{
+			{Name: "claworc_c", Help: "C.", Type: TypeGauge, Samples: []Sample{{Value: 3}}},
+			{Name: "claworc_a", Help: "A\nline.", Type: TypeGauge, Samples: []Sample{
+				{Labels: []string{"state", "up"}, Value: 1},
+				{Labels: []string{"state", "down"}, Value: 0},
+			}},
+		}
+	})
+
+	want := `# HELP claworc_a A\nline.
+# TYPE claworc_a gauge
+claworc_a{state="down"} 0
+claworc_a{state="up"} 1
+# HELP claworc_b_total B.
+# TYPE claworc_b_total counter
+claworc_b_total 1
+# HELP claworc_c C.
+# TYPE claworc_c gauge
+claworc_c 3
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHandler_Token(t *testing.T) {
+	h := Handler("s3cret")
+
+	rr := httptest.NewRecorder()
+	h(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr = httptest.NewRecorder()
+	h(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("with token: status = %d, content type = %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
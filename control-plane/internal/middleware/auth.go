@@ -3,7 +3,10 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/auth"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
@@ -12,7 +15,10 @@ import (
 
 type contextKey string
 
-const userContextKey contextKey = "user"
+const (
+	userContextKey     contextKey = "user"
+	apiTokenContextKey contextKey = "api_token"
+)
 
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -34,6 +40,11 @@ func RequireAuth(store *auth.SessionStore) func(http.Handler) http.Handler {
 				return
 			}
 
+			if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+				authenticateToken(w, r, next, strings.TrimPrefix(h, "Bearer "))
+				return
+			}
+
 			cookie, err := r.Cookie(auth.SessionCookie)
 			if err != nil {
 				writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Authentication required"})
@@ -47,7 +58,7 @@ func RequireAuth(store *auth.SessionStore) func(http.Handler) http.Handler {
 			}
 
 			user, err := database.GetUserByID(userID)
-			if err != nil {
+			if err != nil || user.Disabled {
 				writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Authentication required"})
 				return
 			}
@@ -58,6 +69,52 @@ func RequireAuth(store *auth.SessionStore) func(http.Handler) http.Handler {
 	}
 }
 
+// tokenTouchInterval throttles last-used updates so a busy CI token does
+// not write to the database on every request.
+const tokenTouchInterval = time.Minute
+
+// authenticateToken serves r as the owner of an API token, provided the
+// token is valid, unexpired, and carries the scope the route needs.
+func authenticateToken(w http.ResponseWriter, r *http.Request, next http.Handler, raw string) {
+	tok, err := database.GetAPITokenByHash(auth.HashSessionToken(strings.TrimSpace(raw)))
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Invalid API token"})
+		return
+	}
+	if time.Now().After(tok.ExpiresAt) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "API token expired"})
+		return
+	}
+	user, err := database.GetUserByID(tok.UserID)
+	if err != nil || user.Disabled {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"detail": "Invalid API token"})
+		return
+	}
+	required := auth.RequiredScope(r.Method, r.URL.Path)
+	if !auth.ScopeAllows(database.ParseAPITokenScopes(tok.Scopes), required) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"detail": "API token lacks the " + required + " scope"})
+		return
+	}
+	if tok.LastUsedAt == nil || time.Since(*tok.LastUsedAt) > tokenTouchInterval {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		database.TouchAPIToken(tok.ID, ip)
+	}
+
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, apiTokenContextKey, tok)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetAPIToken returns the API token the request authenticated with, or nil
+// for session (cookie) requests.
+func GetAPIToken(r *http.Request) *database.APIToken {
+	tok, _ := r.Context().Value(apiTokenContextKey).(*database.APIToken)
+	return tok
+}
+
 func RequireAdmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gluk-w/claworc/control-plane/internal/auth"
 	"github.com/gluk-w/claworc/control-plane/internal/config"
@@ -22,7 +23,7 @@ func setupTestDB(t *testing.T) {
 	if err != nil {
 		t.Fatalf("open in-memory db: %v", err)
 	}
-	if err := db.AutoMigrate(&database.User{}, &database.UserInstance{}); err != nil {
+	if err := db.AutoMigrate(&database.User{}, &database.UserInstance{}, &database.APIToken{}); err != nil {
 		t.Fatalf("auto-migrate: %v", err)
 	}
 	database.DB = db
@@ -114,6 +115,108 @@ func TestRequireAuth_DeletedUser(t *testing.T) {
 	}
 }
 
+func createTestToken(t *testing.T, userID uint, scopes string, expires time.Time) string {
+	t.Helper()
+	tok, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateAPIToken(&database.APIToken{
+		UserID: userID, Name: "ci", TokenHash: hash, Scopes: scopes, ExpiresAt: expires,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func bearerRequest(method, path, token string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestRequireAuth_APIToken(t *testing.T) {
+	setupTestDB(t)
+	database.CreateUser(&database.User{Username: "ci-bot", Role: "user", AuthSource: auth.AuthSourceService})
+	user, _ := database.GetUserByUsername("ci-bot")
+	tok := createTestToken(t, user.ID, "instances:read,backups", time.Now().Add(time.Hour))
+	handler := RequireAuth(auth.NewSessionStore())(okHandler())
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/v1/instances", http.StatusOK},
+		{"POST", "/api/v1/instances/1/backups", http.StatusOK},
+		{"POST", "/api/v1/instances/1/restart", http.StatusForbidden},
+		{"GET", "/api/v1/llm/usage", http.StatusForbidden},
+		{"POST", "/api/v1/auth/tokens", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, bearerRequest(tc.method, tc.path, tok))
+		if w.Code != tc.want {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+
+	var stored database.APIToken
+	database.DB.First(&stored)
+	if stored.LastUsedAt == nil {
+		t.Errorf("last_used_at not recorded")
+	}
+}
+
+func TestRequireAuth_ReadTokenCannotDriveInstance(t *testing.T) {
+	setupTestDB(t)
+	database.CreateUser(&database.User{Username: "ci-bot", Role: "user", AuthSource: auth.AuthSourceService})
+	user, _ := database.GetUserByUsername("ci-bot")
+	read := createTestToken(t, user.ID, "instances:read", time.Now().Add(time.Hour))
+	write := createTestToken(t, user.ID, "instances:write", time.Now().Add(time.Hour))
+	handler := RequireAuth(auth.NewSessionStore())(okHandler())
+
+	for _, path := range []string{
+		"/api/v1/instances/1/terminal",
+		"/api/v1/instances/1/chat",
+		"/api/v1/instances/1/desktop/websockify",
+		"/openclaw/1/",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, bearerRequest("GET", path, read))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("instances:read GET %s: status = %d, want 403", path, w.Code)
+		}
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, bearerRequest("GET", path, write))
+		if w.Code != http.StatusOK {
+			t.Errorf("instances:write GET %s: status = %d, want 200", path, w.Code)
+		}
+	}
+}
+
+func TestRequireAuth_APITokenRejected(t *testing.T) {
+	setupTestDB(t)
+	database.CreateUser(&database.User{Username: "alice", PasswordHash: "h", Role: "admin"})
+	user, _ := database.GetUserByUsername("alice")
+	expired := createTestToken(t, user.ID, "all", time.Now().Add(-time.Minute))
+	handler := RequireAuth(auth.NewSessionStore())(okHandler())
+
+	for name, tok := range map[string]string{"expired": expired, "unknown": "clw_nope"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, bearerRequest("GET", "/api/v1/instances", tok))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s token: status = %d, want 401", name, w.Code)
+		}
+	}
+
+	valid := createTestToken(t, user.ID, "all", time.Now().Add(time.Hour))
+	database.DB.Model(user).Update("disabled", true)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, bearerRequest("GET", "/api/v1/instances", valid))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("disabled owner: status = %d, want 401", w.Code)
+	}
+}
+
 func TestRequireAuth_AuthDisabled(t *testing.T) {
 	setupTestDB(t)
 	config.Cfg.AuthDisabled = true
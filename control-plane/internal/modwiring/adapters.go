@@ -17,6 +17,7 @@ import (
 	"github.com/coder/websocket"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/moderator"
+	"github.com/gluk-w/claworc/control-plane/internal/notify"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
 	"github.com/gluk-w/claworc/control-plane/internal/utils"
@@ -291,7 +292,35 @@ func (s *Store) GetTask(ctx context.Context, id uint) (moderator.Task, error) {
 }
 
 func (s *Store) UpdateTask(ctx context.Context, id uint, fields map[string]any) error {
-	return s.DB.WithContext(ctx).Model(&database.KanbanTask{}).Where("id = ?", id).Updates(fields).Error
+	if err := s.DB.WithContext(ctx).Model(&database.KanbanTask{}).Where("id = ?", id).Updates(fields).Error; err != nil {
+		return err
+	}
+	if fields["status"] == "failed" {
+		s.notifyTaskFailed(ctx, id)
+	}
+	return nil
+}
+
+// notifyTaskFailed publishes kanban.task_failed, using the task's latest
+// error comment (written by the moderator just before the status flip) as
+// the message.
+func (s *Store) notifyTaskFailed(ctx context.Context, id uint) {
+	var t database.KanbanTask
+	if err := s.DB.WithContext(ctx).First(&t, id).Error; err != nil {
+		return
+	}
+	var c database.KanbanComment
+	s.DB.WithContext(ctx).Where("task_id = ? AND kind = ?", id, "error").Order("id DESC").Limit(1).Find(&c)
+	ev := notify.Event{
+		Type:    notify.EventKanbanTaskFailed,
+		Title:   fmt.Sprintf("Kanban task %q failed", t.Title),
+		Message: c.Body,
+		Details: map[string]string{"task_id": fmt.Sprint(t.ID), "board_id": fmt.Sprint(t.BoardID)},
+	}
+	if t.AssignedInstanceID != nil {
+		ev.InstanceID = *t.AssignedInstanceID
+	}
+	notify.Publish(ev)
 }
 
 func (s *Store) GetBoard(ctx context.Context, id uint) (moderator.Board, error) {
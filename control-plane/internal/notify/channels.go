@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+// Webhook request headers. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	HeaderEvent     = "X-Claworc-Event"
+	HeaderTimestamp = "X-Claworc-Timestamp"
+	HeaderSignature = "X-Claworc-Signature"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Send delivers ev to ch once, without retries.
+func Send(ctx context.Context, ch database.NotificationChannel, ev Event) error {
+	switch ch.Type {
+	case database.NotificationChannelWebhook:
+		secret, err := utils.Decrypt(ch.Secret)
+		if err != nil {
+			return fmt.Errorf("decrypt secret: %w", err)
+		}
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, ch.URL, body, func(h http.Header) {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			h.Set(HeaderEvent, string(ev.Type))
+			h.Set(HeaderTimestamp, ts)
+			if secret != "" {
+				h.Set(HeaderSignature, Sign(secret, ts, body))
+			}
+		})
+	case database.NotificationChannelSlack:
+		body, err := json.Marshal(map[string]string{"text": slackText(ev)})
+		if err != nil {
+			return err
+		}
+		return postJSON(ctx, ch.URL, body, nil)
+	case database.NotificationChannelEmail:
+		return sendEmail(ch.EmailTo, ev)
+	}
+	return fmt.Errorf("unknown channel type %q", ch.Type)
+}
+
+// Sign returns the X-Claworc-Signature value for a webhook body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postJSON(ctx context.Context, url string, body []byte, setHeaders func(http.Header)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "claworc-notify")
+	if setHeaders != nil {
+		setHeaders(req.Header)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// summary is the one-line subject shared by Slack and email.
+func summary(ev Event) string {
+	if ev.InstanceName != "" {
+		return fmt.Sprintf("[%s] %s", ev.InstanceName, ev.Title)
+	}
+	return ev.Title
+}
+
+func slackText(ev Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s*", summary(ev))
+	if ev.Message != "" {
+		fmt.Fprintf(&b, "\n%s", ev.Message)
+	}
+	fmt.Fprintf(&b, "\n_%s · %s_", ev.Type, ev.Time.UTC().Format(time.RFC3339))
+	return b.String()
+}
+
+func sendEmail(to string, ev Event) error {
+	cfg := config.Cfg
+	if cfg.SMTPHost == "" || cfg.SMTPFrom == "" {
+		return fmt.Errorf("SMTP is not configured (CLAWORC_SMTP_HOST, CLAWORC_SMTP_FROM)")
+	}
+	var rcpts []string
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			rcpts = append(rcpts, addr)
+		}
+	}
+	if len(rcpts) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(rcpts, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.ReplaceAll(summary(ev), "\n", " "))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	if ev.Message != "" {
+		msg.WriteString(ev.Message + "\r\n\r\n")
+	}
+	fmt.Fprintf(&msg, "Event: %s\r\n", ev.Type)
+	if ev.InstanceName != "" {
+		fmt.Fprintf(&msg, "Instance: %s (id %d)\r\n", ev.InstanceName, ev.InstanceID)
+	}
+	for k, v := range ev.Details {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
+	}
+
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort))
+	return smtp.SendMail(addr, auth, cfg.SMTPFrom, rcpts, msg.Bytes())
+}
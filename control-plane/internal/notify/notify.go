@@ -0,0 +1,200 @@
+// Package notify delivers fleet events (instance unreachable, failed
+// backups, failed tasks, ...) to admin-configured channels: signed HTTP
+// webhooks, Slack incoming webhooks and email. See docs/notifications.md.
+//
+// Producers call Publish, which returns immediately; matching, throttling
+// and delivery happen on a background goroutine so a slow or broken channel
+// never blocks the SSH manager, the task manager or a request handler.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// EventType names a kind of event that rules subscribe to.
+type EventType string
+
+const (
+	EventInstanceUnreachable EventType = "instance.unreachable"
+	EventInstanceRecovered   EventType = "instance.recovered"
+	EventTaskFailed          EventType = "task.failed"
+	EventBackupCompleted     EventType = "backup.completed"
+	EventBackupFailed        EventType = "backup.failed"
+	EventKeyRotationFailed   EventType = "ssh_key_rotation.failed"
+	EventKanbanTaskFailed    EventType = "kanban.task_failed"
+)
+
+// EventTypes lists every event type, in the order the UI shows them.
+var EventTypes = []EventType{
+	EventInstanceUnreachable,
+	EventInstanceRecovered,
+	EventTaskFailed,
+	EventBackupCompleted,
+	EventBackupFailed,
+	EventKeyRotationFailed,
+	EventKanbanTaskFailed,
+}
+
+// IsValidEventType reports whether t is a known event type or the "*"
+// wildcard.
+func IsValidEventType(t string) bool {
+	if t == "*" {
+		return true
+	}
+	for _, et := range EventTypes {
+		if string(et) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is one notification. InstanceID is zero for fleet-wide events.
+// InstanceName and TeamID are filled in by Publish from the instance row.
+type Event struct {
+	Type         EventType         `json:"type"`
+	InstanceID   uint              `json:"instance_id,omitempty"`
+	InstanceName string            `json:"instance_name,omitempty"`
+	TeamID       uint              `json:"team_id,omitempty"`
+	Title        string            `json:"title"`
+	Message      string            `json:"message,omitempty"`
+	Details      map[string]string `json:"details,omitempty"`
+	Time         time.Time         `json:"time"`
+}
+
+// throttleWindow suppresses repeats of the same event (type, instance and
+// message) so a flapping instance or a retried task does not flood channels.
+const throttleWindow = 5 * time.Minute
+
+var (
+	throttleMu sync.Mutex
+	lastSent   = map[string]time.Time{}
+)
+
+// Publish queues ev for delivery to every enabled channel with a matching
+// rule. It never blocks.
+func Publish(ev Event) {
+	if database.DB == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if throttled(ev) {
+		return
+	}
+	go dispatch(ev)
+}
+
+func throttled(ev Event) bool {
+	key := fmt.Sprintf("%s/%d/%s", ev.Type, ev.InstanceID, ev.Message)
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	now := time.Now()
+	if t, ok := lastSent[key]; ok && now.Sub(t) < throttleWindow {
+		return true
+	}
+	lastSent[key] = now
+	for k, t := range lastSent {
+		if now.Sub(t) >= throttleWindow {
+			delete(lastSent, k)
+		}
+	}
+	return false
+}
+
+func dispatch(ev Event) {
+	if ev.InstanceID != 0 {
+		var inst database.Instance
+		if err := database.DB.Select("id, name, display_name, team_id").First(&inst, ev.InstanceID).Error; err == nil {
+			if ev.InstanceName == "" {
+				ev.InstanceName = inst.DisplayName
+				if ev.InstanceName == "" {
+					ev.InstanceName = inst.Name
+				}
+			}
+			ev.TeamID = inst.TeamID
+		}
+	}
+
+	channels, err := matchingChannels(ev)
+	if err != nil {
+		log.Printf("notify: %s: load rules: %v", ev.Type, err)
+		return
+	}
+	for _, ch := range channels {
+		deliver(context.Background(), ch, ev)
+	}
+}
+
+// matchingChannels returns the enabled channels with at least one rule
+// matching ev, each channel once.
+func matchingChannels(ev Event) ([]database.NotificationChannel, error) {
+	rules, err := database.ListNotificationRules()
+	if err != nil {
+		return nil, err
+	}
+	ids := map[uint]bool{}
+	for _, r := range rules {
+		if ruleMatches(r, ev) {
+			ids[r.ChannelID] = true
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var channels []database.NotificationChannel
+	idList := make([]uint, 0, len(ids))
+	for id := range ids {
+		idList = append(idList, id)
+	}
+	if err := database.DB.Where("id IN ? AND enabled = ?", idList, true).Order("id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// ruleMatches reports whether r subscribes to ev. A team-scoped rule only
+// matches events about an instance in that team.
+func ruleMatches(r database.NotificationRule, ev Event) bool {
+	if r.TeamID != nil && (ev.InstanceID == 0 || *r.TeamID != ev.TeamID) {
+		return false
+	}
+	for _, t := range database.ParseNotificationEventTypes(r.EventTypes) {
+		if t == "*" || t == string(ev.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelays are the waits before the second and third delivery attempts.
+var retryDelays = []time.Duration{2 * time.Second, 10 * time.Second}
+
+// deliver sends ev to ch, retrying transient failures, and records the
+// outcome on the channel row.
+func deliver(ctx context.Context, ch database.NotificationChannel, ev Event) {
+	err := Send(ctx, ch, ev)
+	for _, d := range retryDelays {
+		if err == nil {
+			break
+		}
+		time.Sleep(d)
+		err = Send(ctx, ch, ev)
+	}
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		log.Printf("notify: channel %d (%s): %s: %v", ch.ID, ch.Name, ev.Type, err)
+		updates["last_error"] = err.Error()
+	} else {
+		now := time.Now().UTC()
+		updates["last_sent_at"] = &now
+	}
+	database.DB.Model(&database.NotificationChannel{}).Where("id = ?", ch.ID).Updates(updates)
+}
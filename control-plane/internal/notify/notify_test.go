@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+)
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:notify_%s_%p?mode=memory&cache=shared", t.Name(), t)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Instance{}, &database.Setting{},
+		&database.NotificationChannel{}, &database.NotificationRule{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev })
+}
+
+func uintPtr(v uint) *uint { return &v }
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"backup.failed"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := Sign("s3cret", "1700000000", body); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+	if Sign("other", "1700000000", body) == want {
+		t.Error("signature should depend on the secret")
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	ev := Event{Type: EventBackupFailed, InstanceID: 7, TeamID: 2}
+	global := Event{Type: EventKeyRotationFailed}
+	for _, tc := range []struct {
+		name  string
+		rule  database.NotificationRule
+		ev    Event
+		match bool
+	}{
+		{"all teams, exact type", database.NotificationRule{EventTypes: `["backup.failed"]`}, ev, true},
+		{"all teams, wildcard", database.NotificationRule{EventTypes: `["*"]`}, ev, true},
+		{"all teams, other type", database.NotificationRule{EventTypes: `["task.failed"]`}, ev, false},
+		{"same team", database.NotificationRule{TeamID: uintPtr(2), EventTypes: `["backup.failed"]`}, ev, true},
+		{"other team", database.NotificationRule{TeamID: uintPtr(3), EventTypes: `["*"]`}, ev, false},
+		{"global event, all teams", database.NotificationRule{EventTypes: `["*"]`}, global, true},
+		{"global event, team rule", database.NotificationRule{TeamID: uintPtr(1), EventTypes: `["*"]`}, global, false},
+		{"malformed types", database.NotificationRule{EventTypes: `nope`}, ev, false},
+	} {
+		if got := ruleMatches(tc.rule, tc.ev); got != tc.match {
+			t.Errorf("%s: ruleMatches = %v, want %v", tc.name, got, tc.match)
+		}
+	}
+}
+
+func TestSend_WebhookAndSlack(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	ev := Event{Type: EventInstanceUnreachable, InstanceID: 3, InstanceName: "Bot", Title: "Instance unreachable", Time: time.Now()}
+	if err := Send(context.Background(), database.NotificationChannel{Type: "webhook", URL: srv.URL}, ev); err != nil {
+		t.Fatalf("webhook send: %v", err)
+	}
+	if got.Header.Get(HeaderEvent) != "instance.unreachable" || got.Header.Get(HeaderTimestamp) == "" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if got.Header.Get(HeaderSignature) != "" {
+		t.Error("unsigned channel should not send a signature")
+	}
+	var decoded Event
+	if err := json.Unmarshal(gotBody, &decoded); err != nil || decoded.InstanceID != 3 {
+		t.Errorf("body = %s (%v)", gotBody, err)
+	}
+
+	if err := Send(context.Background(), database.NotificationChannel{Type: "slack", URL: srv.URL}, ev); err != nil {
+		t.Fatalf("slack send: %v", err)
+	}
+	var slack map[string]string
+	json.Unmarshal(gotBody, &slack)
+	if !strings.HasPrefix(slack["text"], "*[Bot] Instance unreachable*") {
+		t.Errorf("slack text = %q", slack["text"])
+	}
+}
+
+func TestSend_HTTPErrorIsReported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	err := Send(context.Background(), database.NotificationChannel{Type: "slack", URL: srv.URL}, Event{Title: "x"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want HTTP 404", err)
+	}
+}
+
+func TestPublish_DeliversToMatchingChannels(t *testing.T) {
+	setupTestDB(t)
+	throttleMu.Lock()
+	lastSent = map[string]time.Time{}
+	throttleMu.Unlock()
+
+	received := make(chan Event, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		received <- ev
+	}))
+	defer srv.Close()
+
+	inst := database.Instance{Name: "bot-a", DisplayName: "Bot A", TeamID: 2}
+	database.DB.Create(&inst)
+	team2 := database.NotificationChannel{Name: "team2", Type: "webhook", URL: srv.URL, Enabled: true}
+	team3 := database.NotificationChannel{Name: "team3", Type: "webhook", URL: srv.URL, Enabled: true}
+	database.DB.Create(&team2)
+	database.DB.Create(&team3)
+	database.DB.Create(&database.NotificationRule{ChannelID: team2.ID, TeamID: uintPtr(2), EventTypes: `["backup.failed"]`})
+	database.DB.Create(&database.NotificationRule{ChannelID: team3.ID, TeamID: uintPtr(3), EventTypes: `["*"]`})
+
+	ev := Event{Type: EventBackupFailed, InstanceID: inst.ID, Title: "Backup failed", Message: "disk full"}
+	Publish(ev)
+	Publish(ev) // throttled
+
+	select {
+	case got := <-received:
+		if got.InstanceName != "Bot A" || got.TeamID != 2 || got.Message != "disk full" {
+			t.Errorf("event = %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	select {
+	case got := <-received:
+		t.Fatalf("unexpected second delivery: %+v", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c, _ := database.GetNotificationChannel(team2.ID)
+		if c.LastSentAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("last_sent_at not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSSHStateChange_UnreachableThenRecovered(t *testing.T) {
+	unreachableMu.Lock()
+	unreachable = map[uint]bool{}
+	unreachableMu.Unlock()
+
+	SSHStateChange(9, sshproxy.StateReconnecting, sshproxy.StateFailed)
+	if !unreachable[9] {
+		t.Fatal("instance should be marked unreachable")
+	}
+	SSHStateChange(9, sshproxy.StateConnecting, sshproxy.StateConnected)
+	if unreachable[9] {
+		t.Fatal("instance should be cleared after reconnecting")
+	}
+}
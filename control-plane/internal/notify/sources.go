@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+)
+
+// WatchTasks turns finished tasks into events until ctx is done: backup
+// tasks become backup.completed or backup.failed, other failed tasks
+// become task.failed.
+func WatchTasks(ctx context.Context, mgr *taskmanager.Manager) {
+	events, unsubscribe := mgr.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if e.Type == taskmanager.EventEnded {
+					taskEnded(e.Task)
+				}
+			}
+		}
+	}()
+}
+
+func taskEnded(t taskmanager.Task) {
+	details := map[string]string{"task_id": t.ID, "task_type": string(t.Type)}
+	if t.Type == taskmanager.TaskBackupCreate {
+		details["backup_id"] = t.ResourceID
+	} else if t.ResourceID != "" {
+		details["resource_id"] = t.ResourceID
+	}
+	switch {
+	case t.Type == taskmanager.TaskBackupCreate && t.State == taskmanager.StateSucceeded:
+		Publish(Event{Type: EventBackupCompleted, InstanceID: t.InstanceID, Title: "Backup completed", Message: t.ResourceName, Details: details})
+	case t.Type == taskmanager.TaskBackupCreate && t.State == taskmanager.StateFailed:
+		Publish(Event{Type: EventBackupFailed, InstanceID: t.InstanceID, Title: "Backup failed", Message: t.Message, Details: details})
+	case t.State == taskmanager.StateFailed:
+		Publish(Event{Type: EventTaskFailed, InstanceID: t.InstanceID, Title: t.Title + " failed", Message: t.Message, Details: details})
+	}
+}
+
+// unreachable holds instances an instance.unreachable event was published
+// for, so the next successful connection can publish instance.recovered.
+var (
+	unreachableMu sync.Mutex
+	unreachable   = map[uint]bool{}
+)
+
+// SSHStateChange is an sshproxy.StateChangeCallback. A connection that
+// gives up reconnecting (StateFailed) publishes instance.unreachable; the
+// next StateConnected for that instance publishes instance.recovered.
+func SSHStateChange(instanceID uint, from, to sshproxy.ConnectionState) {
+	unreachableMu.Lock()
+	defer unreachableMu.Unlock()
+	switch to {
+	case sshproxy.StateFailed:
+		if unreachable[instanceID] {
+			return
+		}
+		unreachable[instanceID] = true
+		Publish(Event{
+			Type:       EventInstanceUnreachable,
+			InstanceID: instanceID,
+			Title:      "Instance unreachable",
+			Message:    fmt.Sprintf("SSH connection went from %s to %s after reconnect attempts were exhausted", from, to),
+		})
+	case sshproxy.StateConnected:
+		if !unreachable[instanceID] {
+			return
+		}
+		delete(unreachable, instanceID)
+		Publish(Event{
+			Type:       EventInstanceRecovered,
+			InstanceID: instanceID,
+			Title:      "Instance reachable again",
+			Message:    "SSH connection re-established",
+		})
+	}
+}
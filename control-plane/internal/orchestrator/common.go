@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
 )
@@ -37,6 +38,26 @@ func configureSSHAccess(ctx context.Context, execFn ExecFunc, name string, publi
 	return nil
 }
 
+// readSSHHostKeys returns the instance's public sshd host keys, one
+// authorized_keys line per key, read over the exec channel so they can be
+// pinned without trusting the network path.
+func readSSHHostKeys(ctx context.Context, execFn ExecFunc, name string) ([]string, error) {
+	stdout, stderr, code, err := execFn(ctx, name, []string{"sh", "-c", "cat /etc/ssh/ssh_host_*_key.pub"})
+	if err != nil {
+		return nil, fmt.Errorf("read host keys: %w", err)
+	}
+	if code != 0 {
+		return nil, fmt.Errorf("read host keys: %s", stderr)
+	}
+	var keys []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
 func updateInstanceConfig(ctx context.Context, execFn ExecFunc, factory sshproxy.InstanceFactory, name string, configJSON string) error {
 	// Write config file via exec (not an openclaw CLI call)
 	b64 := base64.StdEncoding.EncodeToString([]byte(configJSON))
@@ -2,10 +2,13 @@ package orchestrator
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -35,14 +38,38 @@ type DockerOrchestrator struct {
 	client          *dockerclient.Client
 	available       bool
 	InstanceFactory sshproxy.InstanceFactory
+
+	// Host, the TLS fields and SSHHost select the daemon for a named
+	// placement target. Empty Host (the default backend) means the
+	// environment (DOCKER_HOST etc.) or CLAWORC_DOCKER_HOST.
+	Host    string
+	TLSCA   []byte
+	TLSCert []byte
+	TLSKey  []byte
+	// SSHHost is the address on the Docker host that the control plane can
+	// reach. When set, instance sshd ports are published on it and dialled
+	// there instead of loopback or the bridge IP.
+	SSHHost string
 }
 
 func (d *DockerOrchestrator) Initialize(ctx context.Context) error {
 	var opts []dockerclient.Opt
-	opts = append(opts, dockerclient.FromEnv)
-	opts = append(opts, dockerclient.WithAPIVersionNegotiation())
-	if config.Cfg.DockerHost != "" {
-		opts = append(opts, dockerclient.WithHost(config.Cfg.DockerHost))
+	if d.Host != "" {
+		opts = append(opts, dockerclient.WithAPIVersionNegotiation())
+		if len(d.TLSCert) > 0 || len(d.TLSCA) > 0 {
+			httpClient, err := d.tlsHTTPClient()
+			if err != nil {
+				return fmt.Errorf("docker client: %w", err)
+			}
+			opts = append(opts, dockerclient.WithHTTPClient(httpClient))
+		}
+		opts = append(opts, dockerclient.WithHost(d.Host))
+	} else {
+		opts = append(opts, dockerclient.FromEnv)
+		opts = append(opts, dockerclient.WithAPIVersionNegotiation())
+		if config.Cfg.DockerHost != "" {
+			opts = append(opts, dockerclient.WithHost(config.Cfg.DockerHost))
+		}
 	}
 
 	var err error
@@ -65,6 +92,50 @@ func (d *DockerOrchestrator) Initialize(ctx context.Context) error {
 	return nil
 }
 
+// tlsHTTPClient returns an HTTP client that verifies the daemon against
+// TLSCA (system roots when empty) and presents TLSCert/TLSKey.
+func (d *DockerOrchestrator) tlsHTTPClient() (*http.Client, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(d.TLSCA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(d.TLSCA) {
+			return nil, fmt.Errorf("invalid TLS CA certificate")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if len(d.TLSCert) > 0 {
+		cert, err := tls.X509KeyPair(d.TLSCert, d.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("TLS client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}, nil
+}
+
+// publishHost is the host IP instance sshd ports are published on.
+func (d *DockerOrchestrator) publishHost() string {
+	if d.SSHHost != "" {
+		return d.SSHHost
+	}
+	return "127.0.0.1"
+}
+
+// publishedSSHAddress returns SSHHost and the published port for
+// containerPort when SSHHost is set; ok is false otherwise.
+func (d *DockerOrchestrator) publishedSSHAddress(inspect container.InspectResponse, containerPort int) (string, int, bool) {
+	if d.SSHHost == "" {
+		return "", 0, false
+	}
+	bindings := inspect.NetworkSettings.Ports[nat.Port(fmt.Sprintf("%d/tcp", containerPort))]
+	if len(bindings) == 0 {
+		return "", 0, false
+	}
+	port := 0
+	fmt.Sscanf(bindings[0].HostPort, "%d", &port)
+	return d.SSHHost, port, port > 0
+}
+
 func (d *DockerOrchestrator) ensureNetwork(ctx context.Context) error {
 	_, err := d.client.NetworkInspect(ctx, networkName, network.InspectOptions{})
 	if err == nil {
@@ -314,6 +385,23 @@ func (d *DockerOrchestrator) DeleteInstance(ctx context.Context, name string) er
 	return nil
 }
 
+func (d *DockerOrchestrator) InstanceExists(ctx context.Context, name string) (bool, error) {
+	if _, err := d.client.ContainerInspect(ctx, name); err == nil {
+		return true, nil
+	} else if !dockerclient.IsErrNotFound(err) {
+		return false, fmt.Errorf("inspect container %s: %w", name, err)
+	}
+	for _, suffix := range volumeSuffixes {
+		volName := d.volumeName(name, suffix)
+		if _, err := d.client.VolumeInspect(ctx, volName); err == nil {
+			return true, nil
+		} else if !dockerclient.IsErrNotFound(err) {
+			return false, fmt.Errorf("inspect volume %s: %w", volName, err)
+		}
+	}
+	return false, nil
+}
+
 func (d *DockerOrchestrator) DeleteSharedVolume(ctx context.Context, folderID uint) error {
 	volName := fmt.Sprintf("claworc-shared-%d", folderID)
 	if err := d.client.VolumeRemove(ctx, volName, true); err != nil && !dockerclient.IsErrNotFound(err) {
@@ -468,7 +556,7 @@ func (d *DockerOrchestrator) createContainer(ctx context.Context, params CreateP
 			Memory:   memLimit,
 		},
 		PortBindings: nat.PortMap{
-			"22/tcp": []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: ""}},
+			"22/tcp": []nat.PortBinding{{HostIP: d.publishHost(), HostPort: ""}},
 		},
 		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
 	}
@@ -569,6 +657,14 @@ func (d *DockerOrchestrator) ConfigureSSHAccess(ctx context.Context, instanceID
 	return configureSSHAccess(ctx, d.ExecInInstance, inst.Name, publicKey)
 }
 
+func (d *DockerOrchestrator) ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error) {
+	var inst database.Instance
+	if err := database.DB.First(&inst, instanceID).Error; err != nil {
+		return nil, fmt.Errorf("instance %d not found: %w", instanceID, err)
+	}
+	return readSSHHostKeys(ctx, d.ExecInInstance, inst.Name)
+}
+
 func (d *DockerOrchestrator) GetSSHAddress(ctx context.Context, instanceID uint) (string, int, error) {
 	var inst database.Instance
 	if err := database.DB.First(&inst, instanceID).Error; err != nil {
@@ -578,6 +674,9 @@ func (d *DockerOrchestrator) GetSSHAddress(ctx context.Context, instanceID uint)
 	if err != nil {
 		return "", 0, fmt.Errorf("inspect container for instance %d: %w", instanceID, err)
 	}
+	if host, port, ok := d.publishedSSHAddress(inspect, 22); ok {
+		return host, port, nil
+	}
 
 	// Detect whether the control-plane itself is running inside a Docker container.
 	// /.dockerenv is created by the Docker runtime in every container.
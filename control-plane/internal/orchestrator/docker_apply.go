@@ -102,6 +102,9 @@ func (d *DockerOrchestrator) WorkloadSSHAddress(ctx context.Context, name string
 		return "", 0, fmt.Errorf("inspect container %s: %w", name, err)
 	}
 
+	if host, port, ok := d.publishedSSHAddress(inspect, 22); ok {
+		return host, port, nil
+	}
 	if _, err := os.Stat("/.dockerenv"); err == nil {
 		if ep, ok := inspect.NetworkSettings.Networks[networkName]; ok && ep.IPAddress != "" {
 			return ep.IPAddress, 22, nil
@@ -190,7 +193,7 @@ func (d *DockerOrchestrator) buildContainerConfig(spec WorkloadSpec) (*container
 		// container per the SSH-tunnel design. Publishing 22 lets the host
 		// reach SSH when the control plane runs outside Docker.
 		if p.ContainerPort == 22 {
-			bindings[key] = []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: ""}}
+			bindings[key] = []nat.PortBinding{{HostIP: d.publishHost(), HostPort: ""}}
 		}
 	}
 
@@ -39,11 +39,24 @@ type KubernetesOrchestrator struct {
 	available       bool
 	inCluster       bool
 	InstanceFactory sshproxy.InstanceFactory
+
+	// Kubeconfig, Context and Namespace select the cluster for a named
+	// placement target. All empty (the default backend) means in-cluster
+	// config or the default kubeconfig, in CLAWORC_K8S_NAMESPACE.
+	Kubeconfig []byte
+	Context    string
+	Namespace  string
 }
 
 func (k *KubernetesOrchestrator) Initialize(ctx context.Context) error {
-	cfg, err := rest.InClusterConfig()
-	if err == nil {
+	var cfg *rest.Config
+	var err error
+	if len(k.Kubeconfig) > 0 || k.Context != "" {
+		cfg, err = k.targetConfig()
+		if err != nil {
+			return fmt.Errorf("k8s config: %w", err)
+		}
+	} else if cfg, err = rest.InClusterConfig(); err == nil {
 		k.inCluster = true
 	} else {
 		kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
@@ -62,7 +75,7 @@ func (k *KubernetesOrchestrator) Initialize(ctx context.Context) error {
 		return fmt.Errorf("k8s clientset: %w", err)
 	}
 
-	_, err = k.clientset.CoreV1().Namespaces().Get(ctx, config.Cfg.K8sNamespace, metav1.GetOptions{})
+	_, err = k.clientset.CoreV1().Namespaces().Get(ctx, k.ns(), metav1.GetOptions{})
 	if err != nil {
 		return fmt.Errorf("k8s namespace check: %w", err)
 	}
@@ -92,7 +105,25 @@ func (k *KubernetesOrchestrator) VolumeNameFor(name, suffix string) string {
 // per-workload data as not preserved on K8s clones.
 func (k *KubernetesOrchestrator) CloneVolume(_ context.Context, _, _ string) error { return nil }
 
+// targetConfig builds the REST config from Kubeconfig, or from the default
+// kubeconfig loading rules when only Context is set.
+func (k *KubernetesOrchestrator) targetConfig() (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: k.Context}
+	if len(k.Kubeconfig) == 0 {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	}
+	raw, err := clientcmd.Load(k.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.NewNonInteractiveClientConfig(*raw, k.Context, overrides, nil).ClientConfig()
+}
+
 func (k *KubernetesOrchestrator) ns() string {
+	if k.Namespace != "" {
+		return k.Namespace
+	}
 	return config.Cfg.K8sNamespace
 }
 
@@ -286,6 +317,24 @@ func (k *KubernetesOrchestrator) DeleteInstance(ctx context.Context, name string
 	return nil
 }
 
+func (k *KubernetesOrchestrator) InstanceExists(ctx context.Context, name string) (bool, error) {
+	ns := k.ns()
+	if _, err := k.clientset.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		return true, nil
+	} else if !errors.IsNotFound(err) {
+		return false, fmt.Errorf("get deployment: %w", err)
+	}
+	for _, suffix := range []string{"homebrew", "home"} {
+		pvcName := fmt.Sprintf("%s-%s", name, suffix)
+		if _, err := k.clientset.CoreV1().PersistentVolumeClaims(ns).Get(ctx, pvcName, metav1.GetOptions{}); err == nil {
+			return true, nil
+		} else if !errors.IsNotFound(err) {
+			return false, fmt.Errorf("get PVC %s: %w", suffix, err)
+		}
+	}
+	return false, nil
+}
+
 func (k *KubernetesOrchestrator) DeleteSharedVolume(ctx context.Context, folderID uint) error {
 	ns := k.ns()
 	pvcName := fmt.Sprintf("shared-folder-%d", folderID)
@@ -498,6 +547,14 @@ func (k *KubernetesOrchestrator) ConfigureSSHAccess(ctx context.Context, instanc
 	return configureSSHAccess(ctx, k.ExecInInstance, inst.Name, publicKey)
 }
 
+func (k *KubernetesOrchestrator) ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error) {
+	var inst database.Instance
+	if err := database.DB.First(&inst, instanceID).Error; err != nil {
+		return nil, fmt.Errorf("instance %d not found: %w", instanceID, err)
+	}
+	return readSSHHostKeys(ctx, k.ExecInInstance, inst.Name)
+}
+
 func (k *KubernetesOrchestrator) GetSSHAddress(ctx context.Context, instanceID uint) (string, int, error) {
 	var inst database.Instance
 	if err := database.DB.First(&inst, instanceID).Error; err != nil {
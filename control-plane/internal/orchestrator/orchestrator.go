@@ -20,6 +20,10 @@ type ContainerOrchestrator interface {
 	StopInstance(ctx context.Context, name string) error
 	RestartInstance(ctx context.Context, name string, params CreateParams) error
 	GetInstanceStatus(ctx context.Context, name string) (string, error)
+	// InstanceExists reports whether the named instance's workload or any
+	// of its data volumes exist, running or not. GetInstanceStatus reports
+	// a missing instance as "stopped"; this tells the two apart.
+	InstanceExists(ctx context.Context, name string) (bool, error)
 	GetInstanceImageInfo(ctx context.Context, name string) (string, error)
 
 	// Config
@@ -51,6 +55,7 @@ type ContainerOrchestrator interface {
 	// SSH
 	ConfigureSSHAccess(ctx context.Context, instanceID uint, publicKey string) error
 	GetSSHAddress(ctx context.Context, instanceID uint) (host string, port int, err error)
+	ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error)
 
 	// Workload (generic, name-scoped). These are the primitives feature
 	// packages use to spin up a container without the orchestrator knowing
@@ -27,12 +27,19 @@ type InitStatus struct {
 	Available   bool             `json:"available"`
 	LastAttempt time.Time        `json:"last_attempt"`
 	Attempts    []BackendAttempt `json:"attempts,omitempty"`
+	// Targets is the result of the most recent InitTargets run, one entry
+	// per named placement target.
+	Targets []TargetStatus `json:"targets,omitempty"`
 }
 
 var (
 	current ContainerOrchestrator
 	status  InitStatus
 	mu      sync.RWMutex
+
+	// instanceFactory is applied to the default backend and every target
+	// backend, including ones connected after SetInstanceFactory.
+	instanceFactory sshproxy.InstanceFactory
 )
 
 func InitOrchestrator(ctx context.Context) error {
@@ -121,7 +128,9 @@ func InitOrchestrator(ctx context.Context) error {
 func setCurrent(o ContainerOrchestrator, s InitStatus) {
 	mu.Lock()
 	defer mu.Unlock()
-	current = o
+	applyInstanceFactory(o)
+	current = withTracing(o)
+	s.Targets = status.Targets
 	status = s
 }
 
@@ -146,10 +155,16 @@ func classify(err error) (reason, message string) {
 	}
 }
 
+// Get returns the orchestrator, or nil when neither a default backend nor
+// any placement target is available. Calls are routed per instance to the
+// backend of its placement target (see router).
 func Get() ContainerOrchestrator {
 	mu.RLock()
 	defer mu.RUnlock()
-	return current
+	if current == nil && len(targets) == 0 {
+		return nil
+	}
+	return router{}
 }
 
 // Status returns a snapshot of the most recent init attempt.
@@ -160,6 +175,9 @@ func Status() InitStatus {
 	if len(status.Attempts) > 0 {
 		out.Attempts = append([]BackendAttempt(nil), status.Attempts...)
 	}
+	if len(status.Targets) > 0 {
+		out.Targets = append([]TargetStatus(nil), status.Targets...)
+	}
 	return out
 }
 
@@ -167,7 +185,7 @@ func Status() InitStatus {
 func Set(o ContainerOrchestrator) {
 	mu.Lock()
 	defer mu.Unlock()
-	current = o
+	current = withTracing(o)
 	if o != nil {
 		status = InitStatus{Backend: o.BackendName(), Available: true, LastAttempt: time.Now()}
 	} else {
@@ -175,14 +193,23 @@ func Set(o ContainerOrchestrator) {
 	}
 }
 
-// SetInstanceFactory configures the InstanceFactory on the active orchestrator.
+// SetInstanceFactory configures the InstanceFactory on the default backend
+// and every placement target backend.
 func SetInstanceFactory(factory sshproxy.InstanceFactory) {
-	mu.RLock()
-	defer mu.RUnlock()
-	switch o := current.(type) {
+	mu.Lock()
+	defer mu.Unlock()
+	instanceFactory = factory
+	applyInstanceFactory(current)
+	for _, o := range targets {
+		applyInstanceFactory(o)
+	}
+}
+
+func applyInstanceFactory(o ContainerOrchestrator) {
+	switch o := unwrap(o).(type) {
 	case *DockerOrchestrator:
-		o.InstanceFactory = factory
+		o.InstanceFactory = instanceFactory
 	case *KubernetesOrchestrator:
-		o.InstanceFactory = factory
+		o.InstanceFactory = instanceFactory
 	}
 }
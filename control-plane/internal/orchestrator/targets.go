@@ -0,0 +1,502 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/utils"
+)
+
+// targetInitTimeout bounds how long one placement target may take to
+// connect, so an unreachable cluster does not stall startup.
+const targetInitTimeout = 20 * time.Second
+
+// TargetStatus records one placement target's init result for diagnostics.
+type TargetStatus struct {
+	Name      string    `json:"name"`
+	Backend   string    `json:"backend"`
+	Available bool      `json:"available"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// targets holds the connected backend of every available placement target,
+// keyed by name. Guarded by mu, like current.
+var targets map[string]ContainerOrchestrator
+
+// InitTargets connects every OrchestratorTarget in the database and swaps in
+// the new set. A target that fails to connect is recorded in
+// Status().Targets and its instances fail with an error until the next
+// successful InitTargets. The default backend is not touched.
+func InitTargets(ctx context.Context) error {
+	rows, err := database.ListOrchestratorTargets()
+	if err != nil {
+		return fmt.Errorf("list orchestrator targets: %w", err)
+	}
+
+	built := make(map[string]ContainerOrchestrator, len(rows))
+	statuses := make([]TargetStatus, 0, len(rows))
+	for i := range rows {
+		t := &rows[i]
+		st := TargetStatus{Name: t.Name, Backend: t.Backend, At: time.Now()}
+		o, err := newTargetBackend(t)
+		if err == nil {
+			initCtx, cancel := context.WithTimeout(ctx, targetInitTimeout)
+			err = o.Initialize(initCtx)
+			cancel()
+		}
+		if err != nil {
+			st.Reason, st.Message = classify(err)
+			log.Printf("Orchestrator target %s (%s) unavailable: %v", t.Name, t.Backend, err)
+		} else {
+			st.Available = true
+			built[t.Name] = withTracing(o)
+			log.Printf("Orchestrator target %s: using %s backend", t.Name, t.Backend)
+		}
+		statuses = append(statuses, st)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, o := range built {
+		applyInstanceFactory(o)
+	}
+	targets = built
+	status.Targets = statuses
+	return nil
+}
+
+// newTargetBackend builds an uninitialized backend from a target's settings,
+// decrypting its stored credentials.
+func newTargetBackend(t *database.OrchestratorTarget) (ContainerOrchestrator, error) {
+	switch t.Backend {
+	case database.OrchestratorTargetKubernetes:
+		k := &KubernetesOrchestrator{Context: t.KubeContext, Namespace: t.Namespace}
+		if t.Kubeconfig != "" {
+			raw, err := utils.Decrypt(t.Kubeconfig)
+			if err != nil {
+				return nil, fmt.Errorf("k8s config: decrypt kubeconfig: %w", err)
+			}
+			k.Kubeconfig = []byte(raw)
+		}
+		return k, nil
+	case database.OrchestratorTargetDocker:
+		d := &DockerOrchestrator{
+			Host:    t.DockerHost,
+			TLSCA:   []byte(t.DockerTLSCA),
+			TLSCert: []byte(t.DockerTLSCert),
+			SSHHost: t.SSHHost,
+		}
+		if t.DockerTLSKey != "" {
+			raw, err := utils.Decrypt(t.DockerTLSKey)
+			if err != nil {
+				return nil, fmt.Errorf("docker client: decrypt TLS key: %w", err)
+			}
+			d.TLSKey = []byte(raw)
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", t.Backend)
+	}
+}
+
+// SetTarget installs (or, with nil, removes) the backend for a named
+// placement target. Intended for testing.
+func SetTarget(name string, o ContainerOrchestrator) {
+	mu.Lock()
+	defer mu.Unlock()
+	if o == nil {
+		delete(targets, name)
+		return
+	}
+	if targets == nil {
+		targets = make(map[string]ContainerOrchestrator)
+	}
+	applyInstanceFactory(o)
+	targets[name] = withTracing(o)
+}
+
+// ErrNoDefaultBackend is returned for instances on the default backend
+// when no default backend is available.
+var ErrNoDefaultBackend = errors.New("no default orchestrator backend available")
+
+// ForTarget returns the backend of a placement target ("" = default).
+// Unlike Get, the result is not routed by instance, so callers can address
+// one backend directly, e.g. the destination of a migration.
+func ForTarget(name string) (ContainerOrchestrator, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if name == "" {
+		if current == nil {
+			return nil, ErrNoDefaultBackend
+		}
+		return current, nil
+	}
+	if o := targets[name]; o != nil {
+		return o, nil
+	}
+	return nil, fmt.Errorf("placement target %q is not available", name)
+}
+
+func hasTargets() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(targets) > 0
+}
+
+// forInstance returns the backend of the instance with the given ID.
+func forInstance(instanceID uint) (ContainerOrchestrator, error) {
+	if !hasTargets() {
+		return ForTarget("")
+	}
+	var inst database.Instance
+	if err := database.DB.Select("placement_target").First(&inst, instanceID).Error; err != nil {
+		return nil, fmt.Errorf("instance %d not found: %w", instanceID, err)
+	}
+	return ForTarget(inst.PlacementTarget)
+}
+
+// forName returns the backend for a workload or volume name. Such names are
+// an instance name or derived from one ("<instance>-browser",
+// "claworc-<instance>-home"); the longest instance name they start with
+// decides. Names that match no instance go to the default backend.
+func forName(name string) (ContainerOrchestrator, error) {
+	if !hasTargets() {
+		return ForTarget("")
+	}
+	var insts []database.Instance
+	if err := database.DB.Select("name", "placement_target").
+		Where("name IN ?", instanceNameCandidates(name)).Find(&insts).Error; err != nil {
+		return nil, fmt.Errorf("resolve placement of %s: %w", name, err)
+	}
+	var match *database.Instance
+	for i := range insts {
+		if match == nil || len(insts[i].Name) > len(match.Name) {
+			match = &insts[i]
+		}
+	}
+	if match == nil {
+		return ForTarget("")
+	}
+	return ForTarget(match.PlacementTarget)
+}
+
+// instanceNameCandidates returns the instance names a workload or volume
+// name can derive from: the name itself and each of its prefixes that ends
+// before a "-", with and without the "claworc-" volume prefix. forName
+// looks them up on the unique name index instead of scanning instances.
+func instanceNameCandidates(name string) []string {
+	candidates := []string{name}
+	prefixes := func(s string) {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '-' {
+				candidates = append(candidates, s[:i])
+			}
+		}
+	}
+	prefixes(name)
+	if bare := strings.TrimPrefix(name, "claworc-"); bare != name {
+		prefixes(bare)
+	}
+	return candidates
+}
+
+// BackendNameFor returns the name of the backend that runs the instance
+// ("kubernetes" or "docker"), or "none" when it is unavailable. o is
+// normally Get()'s router; any other backend is its own answer.
+func BackendNameFor(o ContainerOrchestrator, instanceID uint) string {
+	if _, ok := o.(router); !ok {
+		return o.BackendName()
+	}
+	b, err := forInstance(instanceID)
+	if err != nil {
+		return "none"
+	}
+	return b.BackendName()
+}
+
+// router sends each call to the backend of the instance it concerns: the
+// instance's placement target, or the default backend. Get returns it, so
+// callers that keep the orchestrator for the life of the process follow
+// target and default-backend changes.
+type router struct{}
+
+func (router) Initialize(context.Context) error { return nil }
+
+// IsAvailable reports whether any backend, default or target, is usable.
+// The backends are probed after mu is released, since each probe may make
+// a network call.
+func (router) IsAvailable(ctx context.Context) bool {
+	mu.RLock()
+	backends := make([]ContainerOrchestrator, 0, len(targets)+1)
+	if current != nil {
+		backends = append(backends, current)
+	}
+	for _, o := range targets {
+		backends = append(backends, o)
+	}
+	mu.RUnlock()
+
+	for _, o := range backends {
+		if o.IsAvailable(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// BackendName is the default backend's name, or "none" without one. Use
+// BackendNameFor where the backend of a particular instance matters.
+func (router) BackendName() string {
+	if o, err := ForTarget(""); err == nil {
+		return o.BackendName()
+	}
+	return "none"
+}
+
+func (router) CreateInstance(ctx context.Context, params CreateParams) error {
+	o, err := forName(params.Name)
+	if err != nil {
+		return err
+	}
+	return o.CreateInstance(ctx, params)
+}
+
+func (router) DeleteInstance(ctx context.Context, name string) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.DeleteInstance(ctx, name)
+}
+
+func (router) StartInstance(ctx context.Context, name string) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.StartInstance(ctx, name)
+}
+
+func (router) StopInstance(ctx context.Context, name string) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.StopInstance(ctx, name)
+}
+
+func (router) RestartInstance(ctx context.Context, name string, params CreateParams) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.RestartInstance(ctx, name, params)
+}
+
+func (router) GetInstanceStatus(ctx context.Context, name string) (string, error) {
+	o, err := forName(name)
+	if err != nil {
+		return "", err
+	}
+	return o.GetInstanceStatus(ctx, name)
+}
+
+func (router) InstanceExists(ctx context.Context, name string) (bool, error) {
+	o, err := forName(name)
+	if err != nil {
+		return false, err
+	}
+	return o.InstanceExists(ctx, name)
+}
+
+func (router) GetInstanceImageInfo(ctx context.Context, name string) (string, error) {
+	o, err := forName(name)
+	if err != nil {
+		return "", err
+	}
+	return o.GetInstanceImageInfo(ctx, name)
+}
+
+func (router) UpdateInstanceConfig(ctx context.Context, name string, configJSON string) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.UpdateInstanceConfig(ctx, name, configJSON)
+}
+
+func (router) UpdateResources(ctx context.Context, name string, params UpdateResourcesParams) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.UpdateResources(ctx, name, params)
+}
+
+func (router) UpdatePlacementConfig(ctx context.Context, name string, params UpdatePlacementParams) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.UpdatePlacementConfig(ctx, name, params)
+}
+
+func (router) GetContainerStats(ctx context.Context, name string) (*ContainerStats, error) {
+	o, err := forName(name)
+	if err != nil {
+		return nil, err
+	}
+	return o.GetContainerStats(ctx, name)
+}
+
+func (router) UpdateImage(ctx context.Context, name string, params CreateParams) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.UpdateImage(ctx, name, params)
+}
+
+// CloneVolumes requires both instances on the same backend; volumes are not
+// copied between clusters or hosts.
+func (router) CloneVolumes(ctx context.Context, srcName, dstName string) error {
+	src, err := forName(srcName)
+	if err != nil {
+		return err
+	}
+	dst, err := forName(dstName)
+	if err != nil {
+		return err
+	}
+	if src != dst {
+		return fmt.Errorf("cannot clone volumes of %s to %s: instances are on different placement targets", srcName, dstName)
+	}
+	return src.CloneVolumes(ctx, srcName, dstName)
+}
+
+func (router) CloneVolume(ctx context.Context, srcVolName, dstVolName string) error {
+	src, err := forName(srcVolName)
+	if err != nil {
+		return err
+	}
+	dst, err := forName(dstVolName)
+	if err != nil {
+		return err
+	}
+	if src != dst {
+		return fmt.Errorf("cannot clone volume %s to %s: volumes are on different placement targets", srcVolName, dstVolName)
+	}
+	return src.CloneVolume(ctx, srcVolName, dstVolName)
+}
+
+// VolumeNameFor falls back to the Kubernetes convention when the workload's
+// backend is unavailable; the name is then only used in an error path.
+func (router) VolumeNameFor(workloadName, suffix string) string {
+	o, err := forName(workloadName)
+	if err != nil {
+		return fmt.Sprintf("%s-%s", workloadName, suffix)
+	}
+	return o.VolumeNameFor(workloadName, suffix)
+}
+
+func (router) ConfigureSSHAccess(ctx context.Context, instanceID uint, publicKey string) error {
+	o, err := forInstance(instanceID)
+	if err != nil {
+		return err
+	}
+	return o.ConfigureSSHAccess(ctx, instanceID, publicKey)
+}
+
+func (router) GetSSHAddress(ctx context.Context, instanceID uint) (string, int, error) {
+	o, err := forInstance(instanceID)
+	if err != nil {
+		return "", 0, err
+	}
+	return o.GetSSHAddress(ctx, instanceID)
+}
+
+func (router) ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error) {
+	o, err := forInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return o.ReadSSHHostKeys(ctx, instanceID)
+}
+
+func (router) Apply(ctx context.Context, spec WorkloadSpec) error {
+	o, err := forName(spec.Name)
+	if err != nil {
+		return err
+	}
+	return o.Apply(ctx, spec)
+}
+
+func (router) DeleteWorkload(ctx context.Context, spec WorkloadSpec) error {
+	o, err := forName(spec.Name)
+	if err != nil {
+		return err
+	}
+	return o.DeleteWorkload(ctx, spec)
+}
+
+func (router) EnsureSSHAccess(ctx context.Context, name, publicKey string) error {
+	o, err := forName(name)
+	if err != nil {
+		return err
+	}
+	return o.EnsureSSHAccess(ctx, name, publicKey)
+}
+
+func (router) WorkloadSSHAddress(ctx context.Context, name string) (string, int, error) {
+	o, err := forName(name)
+	if err != nil {
+		return "", 0, err
+	}
+	return o.WorkloadSSHAddress(ctx, name)
+}
+
+func (router) ExecInInstance(ctx context.Context, name string, cmd []string) (string, string, int, error) {
+	o, err := forName(name)
+	if err != nil {
+		return "", "", -1, err
+	}
+	return o.ExecInInstance(ctx, name, cmd)
+}
+
+func (router) StreamExecInInstance(ctx context.Context, name string, cmd []string, stdout io.Writer) (string, int, error) {
+	o, err := forName(name)
+	if err != nil {
+		return "", -1, err
+	}
+	return o.StreamExecInInstance(ctx, name, cmd, stdout)
+}
+
+// DeleteSharedVolume removes the shared folder's volume on every backend,
+// since instances on any of them may have mounted it.
+func (router) DeleteSharedVolume(ctx context.Context, folderID uint) error {
+	mu.RLock()
+	backends := make([]ContainerOrchestrator, 0, len(targets)+1)
+	if current != nil {
+		backends = append(backends, current)
+	}
+	for _, o := range targets {
+		backends = append(backends, o)
+	}
+	mu.RUnlock()
+
+	var errs []error
+	for _, o := range backends {
+		if err := o.DeleteSharedVolume(ctx, folderID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,166 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+)
+
+// namedBackend records which backend served a call. Methods the test does
+// not override panic through the nil embedded interface.
+type namedBackend struct {
+	ContainerOrchestrator
+	name    string
+	volumes string
+}
+
+func (b *namedBackend) BackendName() string { return b.name }
+
+func (b *namedBackend) GetInstanceStatus(_ context.Context, n string) (string, error) {
+	return b.name + ":" + n, nil
+}
+
+func (b *namedBackend) GetSSHAddress(_ context.Context, id uint) (string, int, error) {
+	return b.name, int(id), nil
+}
+
+func (b *namedBackend) VolumeNameFor(n, suffix string) string {
+	return fmt.Sprintf(b.volumes, n, suffix)
+}
+
+func (b *namedBackend) CloneVolumes(context.Context, string, string) error { return nil }
+
+func setupRouterTest(t *testing.T) (def, eu *namedBackend) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	db.AutoMigrate(&database.Instance{})
+	prev := database.DB
+	database.DB = db
+
+	def = &namedBackend{name: "default", volumes: "%s-%s"}
+	eu = &namedBackend{name: "eu", volumes: "claworc-%s-%s"}
+	Set(def)
+	SetTarget("eu", eu)
+	t.Cleanup(func() {
+		SetTarget("eu", nil)
+		Set(nil)
+		database.DB = prev
+	})
+	return def, eu
+}
+
+func TestRouter_RoutesByPlacementTarget(t *testing.T) {
+	setupRouterTest(t)
+	database.DB.Create(&database.Instance{Name: "bot-a", DisplayName: "A"})
+	database.DB.Create(&database.Instance{Name: "bot-a-eu", DisplayName: "A EU", PlacementTarget: "eu"})
+	database.DB.Create(&database.Instance{Name: "bot-gone", DisplayName: "Gone", PlacementTarget: "us"})
+
+	o := Get()
+	ctx := context.Background()
+	for name, want := range map[string]string{
+		"bot-a":                    "default:bot-a",
+		"bot-a-eu":                 "eu:bot-a-eu",
+		"bot-a-eu-browser":         "eu:bot-a-eu-browser",
+		"claworc-bot-a-eu-browser": "eu:claworc-bot-a-eu-browser",
+		"bot-a-browser":            "default:bot-a-browser",
+		"unrelated":                "default:unrelated",
+	} {
+		if got, err := o.GetInstanceStatus(ctx, name); err != nil || got != want {
+			t.Errorf("GetInstanceStatus(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if got := o.VolumeNameFor("bot-a-eu", "home"); got != "claworc-bot-a-eu-home" {
+		t.Errorf("VolumeNameFor = %q, want the eu backend's naming", got)
+	}
+	if host, _, err := o.GetSSHAddress(ctx, 2); err != nil || host != "eu" {
+		t.Errorf("GetSSHAddress(2) = %q, %v; want eu", host, err)
+	}
+	if _, _, err := o.GetSSHAddress(ctx, 3); err == nil {
+		t.Error("an instance on an unavailable target should fail")
+	}
+	if err := o.CloneVolumes(ctx, "bot-a", "bot-a-eu"); err == nil {
+		t.Error("cloning across targets should fail")
+	}
+	if o.BackendName() != "default" {
+		t.Errorf("BackendName = %q, want the default backend's", o.BackendName())
+	}
+	for id, want := range map[uint]string{1: "default", 2: "eu", 3: "none"} {
+		if got := BackendNameFor(o, id); got != want {
+			t.Errorf("BackendNameFor(%d) = %q, want %q", id, got, want)
+		}
+	}
+	if got := BackendNameFor(&namedBackend{name: "docker"}, 2); got != "docker" {
+		t.Errorf("BackendNameFor(plain backend) = %q, want its own name", got)
+	}
+}
+
+func TestRouter_NoDefaultBackend(t *testing.T) {
+	setupRouterTest(t)
+	Set(nil)
+	database.DB.Create(&database.Instance{Name: "bot-a", DisplayName: "A"})
+	database.DB.Create(&database.Instance{Name: "bot-b", DisplayName: "B", PlacementTarget: "eu"})
+
+	o := Get()
+	if o == nil {
+		t.Fatal("Get should return the router while a target is available")
+	}
+	if _, err := o.GetInstanceStatus(context.Background(), "bot-a"); err != ErrNoDefaultBackend {
+		t.Errorf("default-bound instance err = %v, want ErrNoDefaultBackend", err)
+	}
+	if got, err := o.GetInstanceStatus(context.Background(), "bot-b"); err != nil || got != "eu:bot-b" {
+		t.Errorf("target-bound instance = %q, %v", got, err)
+	}
+
+	SetTarget("eu", nil)
+	if Get() != nil {
+		t.Error("Get should be nil with no backend at all")
+	}
+}
+
+// probingBackend takes the registry lock from IsAvailable, so a probe made
+// while the router still holds it deadlocks.
+type probingBackend struct{ namedBackend }
+
+func (b *probingBackend) IsAvailable(context.Context) bool {
+	SetTarget("other", nil)
+	return true
+}
+
+func TestRouter_IsAvailableProbesWithoutLock(t *testing.T) {
+	setupRouterTest(t)
+	Set(nil)
+	SetTarget("eu", &probingBackend{namedBackend{name: "eu"}})
+
+	done := make(chan bool, 1)
+	go func() { done <- Get().IsAvailable(context.Background()) }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("IsAvailable = false, want true")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("IsAvailable held the registry lock while probing")
+	}
+}
+
+func TestInstanceNameCandidates(t *testing.T) {
+	got := instanceNameCandidates("claworc-bot-a-home")
+	want := []string{"claworc-bot-a-home", "claworc", "claworc-bot", "claworc-bot-a", "bot", "bot-a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+}
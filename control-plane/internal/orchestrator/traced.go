@@ -0,0 +1,205 @@
+package orchestrator
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
+)
+
+// traced wraps a backend so every context-taking call is recorded as a
+// span named "orchestrator.<Method>". Get returns the wrapped backend when
+// tracing is enabled; SetInstanceFactory unwraps it.
+type traced struct {
+	ContainerOrchestrator
+}
+
+// withTracing returns o wrapped in spans when tracing is enabled.
+func withTracing(o ContainerOrchestrator) ContainerOrchestrator {
+	if o == nil || !tracing.Enabled() {
+		return o
+	}
+	if _, ok := o.(*traced); ok {
+		return o
+	}
+	return &traced{o}
+}
+
+// unwrap returns the backend behind a traced wrapper.
+func unwrap(o ContainerOrchestrator) ContainerOrchestrator {
+	if t, ok := o.(*traced); ok {
+		return t.ContainerOrchestrator
+	}
+	return o
+}
+
+func (t *traced) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	attrs = append(attrs, attribute.String("orchestrator.backend", t.BackendName()))
+	ctx, span := tracing.Start(ctx, "orchestrator."+method, attrs...)
+	return ctx, func(err error) { tracing.End(span, err) }
+}
+
+func nameAttr(n string) attribute.KeyValue {
+	return attribute.String("orchestrator.name", n)
+}
+
+func (t *traced) CreateInstance(ctx context.Context, params CreateParams) (err error) {
+	ctx, end := t.start(ctx, "CreateInstance", nameAttr(params.Name))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.CreateInstance(ctx, params)
+}
+
+func (t *traced) DeleteInstance(ctx context.Context, n string) (err error) {
+	ctx, end := t.start(ctx, "DeleteInstance", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.DeleteInstance(ctx, n)
+}
+
+func (t *traced) StartInstance(ctx context.Context, n string) (err error) {
+	ctx, end := t.start(ctx, "StartInstance", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.StartInstance(ctx, n)
+}
+
+func (t *traced) StopInstance(ctx context.Context, n string) (err error) {
+	ctx, end := t.start(ctx, "StopInstance", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.StopInstance(ctx, n)
+}
+
+func (t *traced) RestartInstance(ctx context.Context, n string, params CreateParams) (err error) {
+	ctx, end := t.start(ctx, "RestartInstance", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.RestartInstance(ctx, n, params)
+}
+
+func (t *traced) GetInstanceStatus(ctx context.Context, n string) (status string, err error) {
+	ctx, end := t.start(ctx, "GetInstanceStatus", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.GetInstanceStatus(ctx, n)
+}
+
+func (t *traced) InstanceExists(ctx context.Context, n string) (exists bool, err error) {
+	ctx, end := t.start(ctx, "InstanceExists", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.InstanceExists(ctx, n)
+}
+
+func (t *traced) GetInstanceImageInfo(ctx context.Context, n string) (info string, err error) {
+	ctx, end := t.start(ctx, "GetInstanceImageInfo", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.GetInstanceImageInfo(ctx, n)
+}
+
+func (t *traced) UpdateInstanceConfig(ctx context.Context, n string, configJSON string) (err error) {
+	ctx, end := t.start(ctx, "UpdateInstanceConfig", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.UpdateInstanceConfig(ctx, n, configJSON)
+}
+
+func (t *traced) UpdateResources(ctx context.Context, n string, params UpdateResourcesParams) (err error) {
+	ctx, end := t.start(ctx, "UpdateResources", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.UpdateResources(ctx, n, params)
+}
+
+func (t *traced) UpdatePlacementConfig(ctx context.Context, n string, params UpdatePlacementParams) (err error) {
+	ctx, end := t.start(ctx, "UpdatePlacementConfig", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.UpdatePlacementConfig(ctx, n, params)
+}
+
+func (t *traced) GetContainerStats(ctx context.Context, n string) (stats *ContainerStats, err error) {
+	ctx, end := t.start(ctx, "GetContainerStats", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.GetContainerStats(ctx, n)
+}
+
+func (t *traced) UpdateImage(ctx context.Context, n string, params CreateParams) (err error) {
+	ctx, end := t.start(ctx, "UpdateImage", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.UpdateImage(ctx, n, params)
+}
+
+func (t *traced) CloneVolumes(ctx context.Context, srcName, dstName string) (err error) {
+	ctx, end := t.start(ctx, "CloneVolumes", nameAttr(dstName), attribute.String("orchestrator.source", srcName))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.CloneVolumes(ctx, srcName, dstName)
+}
+
+func (t *traced) CloneVolume(ctx context.Context, srcVolName, dstVolName string) (err error) {
+	ctx, end := t.start(ctx, "CloneVolume", nameAttr(dstVolName), attribute.String("orchestrator.source", srcVolName))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.CloneVolume(ctx, srcVolName, dstVolName)
+}
+
+func (t *traced) ConfigureSSHAccess(ctx context.Context, instanceID uint, publicKey string) (err error) {
+	ctx, end := t.start(ctx, "ConfigureSSHAccess", tracing.InstanceID(instanceID))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.ConfigureSSHAccess(ctx, instanceID, publicKey)
+}
+
+func (t *traced) GetSSHAddress(ctx context.Context, instanceID uint) (host string, port int, err error) {
+	ctx, end := t.start(ctx, "GetSSHAddress", tracing.InstanceID(instanceID))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.GetSSHAddress(ctx, instanceID)
+}
+
+func (t *traced) ReadSSHHostKeys(ctx context.Context, instanceID uint) (keys []string, err error) {
+	ctx, end := t.start(ctx, "ReadSSHHostKeys", tracing.InstanceID(instanceID))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.ReadSSHHostKeys(ctx, instanceID)
+}
+
+func (t *traced) Apply(ctx context.Context, spec WorkloadSpec) (err error) {
+	ctx, end := t.start(ctx, "Apply", nameAttr(spec.Name))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.Apply(ctx, spec)
+}
+
+func (t *traced) DeleteWorkload(ctx context.Context, spec WorkloadSpec) (err error) {
+	ctx, end := t.start(ctx, "DeleteWorkload", nameAttr(spec.Name))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.DeleteWorkload(ctx, spec)
+}
+
+func (t *traced) EnsureSSHAccess(ctx context.Context, n, publicKey string) (err error) {
+	ctx, end := t.start(ctx, "EnsureSSHAccess", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.EnsureSSHAccess(ctx, n, publicKey)
+}
+
+func (t *traced) WorkloadSSHAddress(ctx context.Context, n string) (host string, port int, err error) {
+	ctx, end := t.start(ctx, "WorkloadSSHAddress", nameAttr(n))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.WorkloadSSHAddress(ctx, n)
+}
+
+// ExecInInstance records the program name only; arguments may carry
+// file contents or secrets.
+func (t *traced) ExecInInstance(ctx context.Context, n string, cmd []string) (stdout string, stderr string, exitCode int, err error) {
+	ctx, end := t.start(ctx, "ExecInInstance", nameAttr(n), attribute.String("orchestrator.program", program(cmd)))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.ExecInInstance(ctx, n, cmd)
+}
+
+func (t *traced) StreamExecInInstance(ctx context.Context, n string, cmd []string, stdout io.Writer) (stderr string, exitCode int, err error) {
+	ctx, end := t.start(ctx, "StreamExecInInstance", nameAttr(n), attribute.String("orchestrator.program", program(cmd)))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.StreamExecInInstance(ctx, n, cmd, stdout)
+}
+
+func (t *traced) DeleteSharedVolume(ctx context.Context, folderID uint) (err error) {
+	ctx, end := t.start(ctx, "DeleteSharedVolume", attribute.Int64("orchestrator.shared_folder_id", int64(folderID)))
+	defer func() { end(err) }()
+	return t.ContainerOrchestrator.DeleteSharedVolume(ctx, folderID)
+}
+
+func program(cmd []string) string {
+	if len(cmd) == 0 {
+		return ""
+	}
+	return cmd[0]
+}
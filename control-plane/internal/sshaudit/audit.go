@@ -29,12 +29,33 @@ const (
 	EventTerminalSession EventType = "terminal_session"
 	EventKeyUpload       EventType = "key_upload"
 	EventKeyRotation     EventType = "key_rotation"
+	EventHostKeyPinned   EventType = "host_key_pinned"
+	EventHostKeyMismatch EventType = "host_key_mismatch"
+	EventHostKeyCleared  EventType = "host_key_cleared"
 
 	// Inbound SSH gateway events (user -> control plane -> instance).
 	EventGatewayLogin       EventType = "gateway_login"
 	EventGatewayLoginFailed EventType = "gateway_login_failed"
 	EventGatewaySession     EventType = "gateway_session"
 	EventGatewayDisconnect  EventType = "gateway_disconnection"
+	EventGatewayForward     EventType = "gateway_forward"
+
+	// REST API credentials (personal access tokens and service accounts).
+	EventAPITokenCreated       EventType = "api_token_created"
+	EventAPITokenRevoked       EventType = "api_token_revoked"
+	EventServiceAccountCreated EventType = "service_account_created"
+	EventServiceAccountDeleted EventType = "service_account_deleted"
+
+	// Second-factor (TOTP) lifecycle.
+	EventTOTPEnabled          EventType = "totp_enabled"
+	EventTOTPDisabled         EventType = "totp_disabled"
+	EventTOTPRecoveryCodeUsed EventType = "totp_recovery_code_used"
+	EventTOTPSetupAllowed     EventType = "totp_setup_allowed"
+	EventTOTPSetupRefused     EventType = "totp_setup_refused"
+	EventTOTPSetupAttempt     EventType = "totp_setup_attempt"
+
+	// Terminal recordings downloaded or replayed through the API.
+	EventRecordingAccessed EventType = "recording_accessed"
 )
 
 // AuditEntry is the GORM model for the ssh_audit_logs table.
@@ -19,6 +19,7 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 )
 
@@ -40,6 +41,11 @@ const (
 
 var errAuthFailed = errors.New("unknown user or key")
 
+// metricLogins counts login attempts by result: "success", "denied" (valid
+// key, instance missing or not accessible) or "failed" (rejected key).
+var metricLogins = metrics.NewCounterVec("claworc_ssh_gateway_logins_total",
+	"SSH gateway login attempts by result (success, denied, failed).", "result")
+
 func (g *Gateway) authenticate(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 	username, instancePart := ParseSSHUser(cm.User())
 	if username == "" {
@@ -75,8 +81,10 @@ func (g *Gateway) authenticate(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Per
 	instanceID, denyReason := g.authorizeInstance(user, instancePart)
 	if denyReason != "" {
 		perms.Extensions[extDenyReason] = denyReason
+		metricLogins.Inc("denied")
 	} else {
 		perms.Extensions[extInstanceID] = strconv.FormatUint(uint64(instanceID), 10)
+		metricLogins.Inc("success")
 	}
 
 	g.audit(sshaudit.EventGatewayLogin, instanceID, user.Username,
@@ -1,7 +1,8 @@
 // bridge.go splices an authenticated inbound SSH connection onto the
 // control plane's existing outbound SSH connection to the target instance.
-// Each inbound "session" channel becomes one new channel on the shared
-// per-instance *ssh.Client — never a new TCP/SSH connection.
+// Each inbound "session" (or "direct-tcpip", see forward.go) channel becomes
+// one new channel on the shared per-instance *ssh.Client — never a new
+// TCP/SSH connection.
 
 package sshgateway
 
@@ -14,12 +15,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
 )
 
 func (g *Gateway) handleConn(nc net.Conn) {
@@ -36,7 +41,7 @@ func (g *Gateway) handleConn(nc net.Conn) {
 
 func (g *Gateway) serveConn(sc *ssh.ServerConn, chans <-chan ssh.NewChannel, reqs <-chan *ssh.Request) {
 	// Global requests (tcpip-forward, client keepalives, ...) are refused;
-	// only session channels are supported in v1.
+	// only session and direct-tcpip (ssh -L) channels are supported.
 	go ssh.DiscardRequests(reqs)
 
 	username := sc.Permissions.Extensions[extUsername]
@@ -59,14 +64,20 @@ func (g *Gateway) serveConn(sc *ssh.ServerConn, chans <-chan ssh.NewChannel, req
 
 	var wg sync.WaitGroup
 	for nc := range chans {
-		if nc.ChannelType() != "session" {
-			nc.Reject(ssh.Prohibited, "only sessions are supported by the claworc gateway")
+		var handle func(*ssh.ServerConn, ssh.NewChannel, <-chan struct{})
+		switch nc.ChannelType() {
+		case "session":
+			handle = g.handleSession
+		case "direct-tcpip":
+			handle = g.handleDirectTCPIP
+		default:
+			nc.Reject(ssh.Prohibited, "only sessions and local port forwards are supported by the claworc gateway")
 			continue
 		}
 		wg.Add(1)
 		go func(nc ssh.NewChannel) {
 			defer wg.Done()
-			g.handleSession(sc, nc, connDone)
+			handle(sc, nc, connDone)
 		}(nc)
 	}
 	wg.Wait()
@@ -94,7 +105,7 @@ func (g *Gateway) handleSession(sc *ssh.ServerConn, nc ssh.NewChannel, connDone
 		return
 	}
 
-	client, err := g.cfg.Clients(g.ctx, inst)
+	client, err := g.connect(inst, in.Stderr())
 	if err != nil {
 		log.Printf("SSH gateway: connect to instance %d failed: %v", instanceID, err)
 		failSession(in, inReqs, "claworc: instance not reachable")
@@ -137,17 +148,57 @@ func (g *Gateway) bridgeChannels(in ssh.Channel, inReqs <-chan *ssh.Request, out
 	// remote can emit output + exit-status and close before SendRequest for
 	// the triggering exec/shell even returns, and closing the inbound
 	// channel before its Reply is sent makes the client fail with EOF.
+	//
+	// An "sftp" subsystem installs an sftpProxy before the request is
+	// forwarded, so the client's first SFTP packet (sent only after the
+	// reply) already goes through it. Likewise a shell or exec with a PTY
+	// starts its recording before the remote process can produce output.
 	var pendingReqs sync.WaitGroup
+	var sftp atomic.Pointer[sftpProxy]
+	var rec atomic.Pointer[sshterminal.Recorder]
 	go func() {
 		audited := false
+		var pty *ptyRequestMsg
 		for req := range inReqs {
 			pendingReqs.Add(1)
 			switch req.Type {
 			case "pty-req", "shell", "exec", "subsystem", "env",
 				"window-change", "signal", "eow@openssh.com", "break":
+				if req.Type == "pty-req" {
+					var msg ptyRequestMsg
+					if ssh.Unmarshal(req.Payload, &msg) == nil {
+						pty = &msg
+					}
+				}
+				if req.Type == "window-change" {
+					var msg windowChangeMsg
+					if ssh.Unmarshal(req.Payload, &msg) == nil {
+						rec.Load().Resize(int(msg.Cols), int(msg.Rows))
+					}
+				}
 				if !audited && (req.Type == "shell" || req.Type == "exec" || req.Type == "subsystem") {
 					audited = true
-					g.audit(sshaudit.EventGatewaySession, instanceID, username, sessionDetails(req))
+					details := sessionDetails(req)
+					if pty != nil && req.Type != "subsystem" {
+						if r := g.startRecording(instanceID, username, req, pty); r != nil {
+							rec.Store(r)
+							details += ", recording=" + r.ID
+						}
+					}
+					g.audit(sshaudit.EventGatewaySession, instanceID, username, details)
+				}
+				if req.Type == "subsystem" && parseSSHString(req.Payload) == "sftp" {
+					sftp.Store(g.newSFTPProxy(instanceID, username, loadFileRules(instanceID, username), in, out))
+				}
+				if req.Type == "exec" {
+					if denied := g.checkSCP(instanceID, username, parseSSHString(req.Payload)); denied != "" {
+						fmt.Fprintf(in.Stderr(), "claworc: %s\r\n", denied)
+						if req.WantReply {
+							req.Reply(false, nil)
+						}
+						pendingReqs.Done()
+						continue
+					}
 				}
 				ok, _ := out.SendRequest(req.Type, req.WantReply, req.Payload)
 				if req.WantReply {
@@ -179,16 +230,90 @@ func (g *Gateway) bridgeChannels(in ssh.Channel, inReqs <-chan *ssh.Request, out
 
 	var wg sync.WaitGroup
 	wg.Add(2)
-	go func() { defer wg.Done(); io.Copy(in, out) }()                   // stdout
+	go func() { // stdout
+		defer wg.Done()
+		pump(out, func(b []byte) error {
+			if s := sftp.Load(); s != nil {
+				return s.fromServer(b)
+			}
+			rec.Load().Output(b)
+			_, err := in.Write(b)
+			return err
+		})
+	}()
 	go func() { defer wg.Done(); io.Copy(in.Stderr(), out.Stderr()) }() // stderr
 	go func() {
-		io.Copy(out, in) // stdin; propagate client-side EOF
+		pump(in, func(b []byte) error { // stdin; propagate client-side EOF
+			if s := sftp.Load(); s != nil {
+				return s.fromClient(b)
+			}
+			rec.Load().Input(b)
+			activity.Touch(instanceID)
+			_, err := out.Write(b)
+			return err
+		})
 		out.CloseWrite()
 	}()
 
 	wg.Wait()
 	<-exitForwarded
 	pendingReqs.Wait()
+	if s := sftp.Load(); s != nil {
+		s.finish()
+	}
+	rec.Load().Close()
+}
+
+// ptyRequestMsg and windowChangeMsg are the RFC 4254 §6.2 and §6.7
+// request payloads.
+type ptyRequestMsg struct {
+	Term                      string
+	Cols, Rows, Width, Height uint32
+	Modes                     string
+}
+
+type windowChangeMsg struct {
+	Cols, Rows, Width, Height uint32
+}
+
+// startRecording starts the recording of a PTY session, or returns nil when
+// recording is off or the file cannot be created (the session goes ahead
+// unrecorded).
+func (g *Gateway) startRecording(instanceID uint, username string, req *ssh.Request, pty *ptyRequestMsg) *sshterminal.Recorder {
+	if g.cfg.Recordings == nil {
+		return nil
+	}
+	command := ""
+	if req.Type == "exec" {
+		command = parseSSHString(req.Payload)
+	}
+	r, err := g.cfg.Recordings.Start(sshterminal.RecordingMeta{
+		Source:     sshterminal.RecordingSourceGateway,
+		InstanceID: instanceID,
+		SessionID:  uuid.New().String(),
+		User:       username,
+	}, command, int(pty.Cols), int(pty.Rows), map[string]string{"TERM": pty.Term})
+	if err != nil {
+		log.Printf("SSH gateway: recording for instance %d failed: %v", instanceID, err)
+		return nil
+	}
+	return r
+}
+
+// pump reads src until EOF or error, handing each chunk to write.
+func pump(src io.Reader, write func([]byte) error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if werr := write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
 }
 
 // denySession handles a session whose key authenticated but whose instance
@@ -0,0 +1,247 @@
+// forward.go bridges local port forwards (`ssh -L`, "direct-tcpip"
+// channels) onto the instance. Each forward becomes one direct-tcpip
+// channel on the shared per-instance client, so it reaches a service
+// listening on the agent's loopback interface. Forwarding is off unless an
+// admin enables it globally (database.GatewayPortForwardingSetting) and the
+// instance's ForwardPorts allowlist contains the target port. The agent's
+// sshd enforces the same allowlist through its PermitOpen list, which
+// sshproxy keeps in sync (see sshproxy/permitopen.go).
+
+package sshgateway
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+)
+
+// metricForwards counts direct-tcpip requests by result: "opened",
+// "denied" (policy) or "failed" (instance unreachable or refused).
+var metricForwards = metrics.NewCounterVec("claworc_ssh_gateway_forwards_total",
+	"SSH gateway port-forward requests by result (opened, denied, failed).", "result")
+
+// directTCPIPMsg is the RFC 4254 §7.2 direct-tcpip channel payload.
+type directTCPIPMsg struct {
+	Host     string
+	Port     uint32
+	OrigHost string
+	OrigPort uint32
+}
+
+// loopbackHosts are the only forward targets accepted: the agent itself.
+var loopbackHosts = map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+
+// portRange is an inclusive range of TCP ports.
+type portRange struct{ lo, hi uint32 }
+
+// PortAllowlist is a parsed Instance.ForwardPorts value.
+type PortAllowlist []portRange
+
+// MaxForwardPorts caps how many ports one allowlist may cover: each port
+// is written into the agent sshd's PermitOpen list.
+const MaxForwardPorts = 256
+
+// ParsePortAllowlist parses a comma-separated list of ports and ranges,
+// e.g. "3000, 5173, 8000-8100". An empty string yields an empty list.
+func ParsePortAllowlist(s string) (PortAllowlist, error) {
+	var list PortAllowlist
+	total := 0
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		loS, hiS, isRange := strings.Cut(part, "-")
+		lo, err := parsePort(loS)
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parsePort(hiS); err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		if total += int(hi-lo) + 1; total > MaxForwardPorts {
+			return nil, fmt.Errorf("allowlist covers more than %d ports", MaxForwardPorts)
+		}
+		list = append(list, portRange{lo, hi})
+	}
+	return list, nil
+}
+
+func parsePort(s string) (uint32, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint32(n), nil
+}
+
+// Allows reports whether port is in the list.
+func (l PortAllowlist) Allows(port uint32) bool {
+	for _, r := range l {
+		if port >= r.lo && port <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// Ports returns every port in the list.
+func (l PortAllowlist) Ports() []uint16 {
+	var ports []uint16
+	for _, r := range l {
+		for p := r.lo; p <= r.hi; p++ {
+			ports = append(ports, uint16(p))
+		}
+	}
+	return ports
+}
+
+// ForwardPortsFor returns the instance's allowlisted forward ports, for
+// sshproxy.SSHManager.SetPermitOpen. The agent's sshd permits them even
+// while forwarding is globally disabled; the gateway still refuses then.
+func ForwardPortsFor(instanceID uint) []uint16 {
+	inst, err := database.GetInstance(instanceID)
+	if err != nil {
+		return nil
+	}
+	allow, err := ParsePortAllowlist(inst.ForwardPorts)
+	if err != nil {
+		log.Printf("SSH gateway: instance %d has an invalid forward_ports value: %v", instanceID, err)
+	}
+	return allow.Ports()
+}
+
+// forwardDenied returns why a forward to host:port on inst is not allowed,
+// or "" when it is.
+func forwardDenied(inst *database.Instance, host string, port uint32) string {
+	if !database.GatewayPortForwardingEnabled() {
+		return "port forwarding is disabled"
+	}
+	if !loopbackHosts[host] {
+		return "only localhost targets can be forwarded"
+	}
+	allow, err := ParsePortAllowlist(inst.ForwardPorts)
+	if err != nil {
+		log.Printf("SSH gateway: instance %d has an invalid forward_ports value: %v", inst.ID, err)
+	}
+	if !allow.Allows(port) {
+		return fmt.Sprintf("port %d is not in the instance's forward allowlist", port)
+	}
+	return ""
+}
+
+func (g *Gateway) handleDirectTCPIP(sc *ssh.ServerConn, nc ssh.NewChannel, connDone <-chan struct{}) {
+	var msg directTCPIPMsg
+	if err := ssh.Unmarshal(nc.ExtraData(), &msg); err != nil {
+		nc.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+	if sc.Permissions.Extensions[extDenyReason] != "" {
+		nc.Reject(ssh.Prohibited, "instance not found or not authorized")
+		return
+	}
+
+	username := sc.Permissions.Extensions[extUsername]
+	instanceID := permsUint(sc.Permissions, extInstanceID)
+	target := net.JoinHostPort(msg.Host, strconv.FormatUint(uint64(msg.Port), 10))
+	details := fmt.Sprintf("target=%s, originator=%s", target,
+		net.JoinHostPort(msg.OrigHost, strconv.FormatUint(uint64(msg.OrigPort), 10)))
+
+	inst, err := database.GetInstance(instanceID)
+	if err != nil {
+		nc.Reject(ssh.ConnectionFailed, "instance no longer exists")
+		return
+	}
+	if reason := forwardDenied(inst, msg.Host, msg.Port); reason != "" {
+		metricForwards.Inc("denied")
+		g.audit(sshaudit.EventGatewayForward, instanceID, username, details+", denied: "+reason)
+		nc.Reject(ssh.Prohibited, "claworc: "+reason)
+		return
+	}
+
+	client, err := g.connect(inst, nil)
+	if err != nil {
+		log.Printf("SSH gateway: connect to instance %d failed: %v", instanceID, err)
+		metricForwards.Inc("failed")
+		nc.Reject(ssh.ConnectionFailed, "claworc: instance not reachable")
+		return
+	}
+	// A direct-tcpip channel on the shared client; the agent's sshd connects
+	// to its own loopback.
+	remote, err := client.Dial("tcp", target)
+	if err != nil {
+		metricForwards.Inc("failed")
+		g.audit(sshaudit.EventGatewayForward, instanceID, username, details+", failed: "+err.Error())
+		nc.Reject(ssh.ConnectionFailed, fmt.Sprintf("claworc: nothing accepted the connection on %s", target))
+		return
+	}
+	defer remote.Close()
+
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+
+	metricForwards.Inc("opened")
+	g.audit(sshaudit.EventGatewayForward, instanceID, username, details+", opened")
+
+	sent, received := spliceForward(ch, remote, connDone)
+	g.audit(sshaudit.EventGatewayForward, instanceID, username,
+		fmt.Sprintf("%s, closed, sent=%d, received=%d", details, sent, received))
+}
+
+// spliceForward copies between the user's channel and the instance-side
+// connection until both directions finish or the inbound connection dies.
+func spliceForward(ch ssh.Channel, remote net.Conn, connDone <-chan struct{}) (sent, received int64) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-connDone:
+			ch.Close()
+			remote.Close()
+		case <-done:
+		}
+	}()
+
+	var s, r atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(remote, ch)
+		s.Store(n)
+		if cw, ok := remote.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			remote.Close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(ch, remote)
+		r.Store(n)
+		ch.CloseWrite()
+	}()
+	wg.Wait()
+	return s.Load(), r.Load()
+}
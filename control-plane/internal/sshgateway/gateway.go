@@ -10,6 +10,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -18,8 +19,10 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
 )
 
 const handshakeTimeout = 30 * time.Second
@@ -30,13 +33,21 @@ const handshakeTimeout = 30 * time.Second
 // connection (already carrying tunnels and web terminals) is reused.
 type ClientProvider func(ctx context.Context, inst *database.Instance) (*ssh.Client, error)
 
+// WakeFunc starts a hibernated instance and returns once it is running.
+type WakeFunc func(ctx context.Context, inst *database.Instance) error
+
+// statusHibernated mirrors handlers.StatusHibernated.
+const statusHibernated = "hibernated"
+
 // Config holds the gateway's dependencies.
 type Config struct {
-	Addr     string // listen address, e.g. ":2222"
-	HostKey  ssh.Signer
-	Clients  ClientProvider
-	Auditor  *sshaudit.Auditor
-	MaxConns int // max concurrent inbound connections; 0 = default 64
+	Addr       string // listen address, e.g. ":2222"
+	HostKey    ssh.Signer
+	Clients    ClientProvider
+	Wake       WakeFunc // wakes hibernated instances on connect; nil = off
+	Auditor    *sshaudit.Auditor
+	Recordings *sshterminal.Recordings // records PTY sessions; nil = off
+	MaxConns   int                     // max concurrent inbound connections; 0 = default 64
 }
 
 // Gateway is the inbound SSH server.
@@ -98,6 +109,24 @@ func (g *Gateway) Start(ctx context.Context) error {
 	return nil
 }
 
+// connect returns the shared client for inst, waking it first if it is
+// hibernated. notice, if not nil, is told about the wake.
+func (g *Gateway) connect(inst *database.Instance, notice io.Writer) (*ssh.Client, error) {
+	if inst.Status == statusHibernated && g.cfg.Wake != nil {
+		if notice != nil {
+			fmt.Fprint(notice, "claworc: waking up instance...\r\n")
+		}
+		if err := g.cfg.Wake(g.ctx, inst); err != nil {
+			return nil, fmt.Errorf("wake: %w", err)
+		}
+	}
+	client, err := g.cfg.Clients(g.ctx, inst)
+	if err == nil {
+		activity.Touch(inst.ID)
+	}
+	return client, err
+}
+
 // Stop closes the listener and waits briefly for in-flight connections.
 func (g *Gateway) Stop() {
 	if g.ln != nil {
@@ -138,6 +167,7 @@ func (g *Gateway) serverConfig() *ssh.ServerConfig {
 			if err != nil && method == "publickey" {
 				ip := hostOnly(cm.RemoteAddr())
 				g.limiter.RecordFailure(ip)
+				metricLogins.Inc("failed")
 				g.audit(sshaudit.EventGatewayLoginFailed, 0, cm.User(),
 					fmt.Sprintf("remote=%s method=%s", ip, method))
 			}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"sync"
@@ -15,12 +16,15 @@ import (
 	"golang.org/x/crypto/ssh"
 
 	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
+	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
 )
 
 // fakeAgentSSHD is an in-process stand-in for an agent container's sshd.
 // It answers exec requests with "ran:<cmd>" and a parseable exit status,
-// and counts accepted TCP connections so tests can assert connection reuse.
+// connects direct-tcpip channels to the requested local address, and counts
+// accepted TCP connections so tests can assert connection reuse.
 type fakeAgentSSHD struct {
 	addr      string
 	connCount atomic.Int64
@@ -84,6 +88,10 @@ func (s *fakeAgentSSHD) handleConn(nc net.Conn, cfg *ssh.ServerConfig) {
 	go ssh.DiscardRequests(reqs)
 
 	for newChan := range chans {
+		if newChan.ChannelType() == "direct-tcpip" {
+			go s.handleDirectTCPIP(newChan)
+			continue
+		}
 		if newChan.ChannelType() != "session" {
 			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
 			continue
@@ -96,6 +104,28 @@ func (s *fakeAgentSSHD) handleConn(nc net.Conn, cfg *ssh.ServerConfig) {
 	}
 }
 
+func (s *fakeAgentSSHD) handleDirectTCPIP(newChan ssh.NewChannel) {
+	var msg directTCPIPMsg
+	if err := ssh.Unmarshal(newChan.ExtraData(), &msg); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, "bad payload")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(msg.Host, fmt.Sprint(msg.Port)))
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+	go func() { io.Copy(conn, ch); conn.(*net.TCPConn).CloseWrite() }()
+	io.Copy(ch, conn)
+}
+
 func (s *fakeAgentSSHD) handleSession(ch ssh.Channel, requests <-chan *ssh.Request) {
 	defer ch.Close()
 	for req := range requests {
@@ -129,6 +159,15 @@ func (s *fakeAgentSSHD) handleSession(ch ssh.Channel, requests <-chan *ssh.Reque
 			}
 			sendExit(ch, code)
 			return
+		case "subsystem":
+			// Echo the subsystem stream back, standing in for sftp-server.
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+			go func() {
+				io.Copy(ch, ch)
+				sendExit(ch, 0)
+			}()
 		default:
 			if req.WantReply {
 				req.Reply(false, nil)
@@ -152,7 +191,9 @@ type testEnv struct {
 	provided atomic.Int64
 }
 
-func setupGateway(t *testing.T) *testEnv {
+// setupGateway starts a gateway in front of a fake agent sshd. opts adjust
+// the gateway Config before it starts.
+func setupGateway(t *testing.T, opts ...func(*Config)) *testEnv {
 	t.Helper()
 	setupTestDB(t)
 
@@ -201,7 +242,16 @@ func setupGateway(t *testing.T) *testEnv {
 	}
 	gwSigner, _ := ssh.ParsePrivateKey(gwKeyPEM)
 
-	gw := New(Config{Addr: "127.0.0.1:0", HostKey: gwSigner, Clients: provider})
+	auditor, err := sshaudit.NewAuditor(database.DB, 0)
+	if err != nil {
+		t.Fatalf("auditor: %v", err)
+	}
+
+	cfg := Config{Addr: "127.0.0.1:0", HostKey: gwSigner, Clients: provider, Auditor: auditor}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	gw := New(cfg)
 	if err := gw.Start(context.Background()); err != nil {
 		t.Fatalf("start gateway: %v", err)
 	}
@@ -244,6 +294,50 @@ func TestGatewayExecBridging(t *testing.T) {
 	}
 }
 
+func TestGatewayRecordsPTYSessions(t *testing.T) {
+	recordings := sshterminal.NewRecordings(t.TempDir())
+	env := setupGateway(t, func(c *Config) { c.Recordings = recordings })
+	inst, _ := database.GetInstanceByName("bot-my-agent")
+	client := env.dial(t, "stan.my-agent", env.signer)
+
+	// Without a PTY (scripted exec) nothing is recorded.
+	sess, _ := client.NewSession()
+	sess.Output("hostname")
+	sess.Close()
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	defer sess.Close()
+	if err := sess.RequestPty("xterm", 30, 100, ssh.TerminalModes{}); err != nil {
+		t.Fatalf("pty: %v", err)
+	}
+	stdin, _ := sess.StdinPipe()
+	var out bytes.Buffer
+	sess.Stdout = &out
+	if err := sess.Shell(); err != nil {
+		t.Fatalf("shell: %v", err)
+	}
+	sess.WindowChange(40, 120)
+	stdin.Write([]byte("hi\n"))
+	sess.Wait()
+
+	recs, err := recordings.List(inst.ID)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("recordings = %v, %v", recs, err)
+	}
+	if recs[0].Source != sshterminal.RecordingSourceGateway || recs[0].User != "stan" || recs[0].Width != 100 || recs[0].Height != 30 {
+		t.Errorf("recording = %+v", recs[0])
+	}
+	f, _ := recordings.Open(inst.ID, recs[0].ID)
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if !strings.Contains(string(data), `"o","echo:hi\n"]`) {
+		t.Errorf("recording missing shell output:\n%s", data)
+	}
+}
+
 func TestGatewayExitStatusForwarded(t *testing.T) {
 	env := setupGateway(t)
 	client := env.dial(t, "stan.my-agent", env.signer)
@@ -374,13 +468,98 @@ func TestGatewayUnknownInstance(t *testing.T) {
 	}
 }
 
+// startEchoListener serves a line-echo TCP service on 127.0.0.1 and
+// returns its port.
+func startEchoListener(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func forwardAudit(t *testing.T) []string {
+	t.Helper()
+	var entries []sshaudit.AuditEntry
+	database.DB.Where("event_type = ?", sshaudit.EventGatewayForward).Order("id").Find(&entries)
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Details)
+	}
+	return out
+}
+
 func TestGatewayRejectsDirectTCPIP(t *testing.T) {
 	env := setupGateway(t)
+	port := startEchoListener(t)
+	target := fmt.Sprintf("127.0.0.1:%d", port)
+	client := env.dial(t, "stan.my-agent", env.signer)
+
+	// Disabled globally (the default).
+	database.DB.Model(&database.Instance{}).Where("name = ?", "bot-my-agent").
+		Update("forward_ports", fmt.Sprint(port))
+	if _, err := client.Dial("tcp", target); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Fatalf("forward while disabled: err = %v", err)
+	}
+
+	// Enabled, but the port is not allowlisted.
+	database.SetSetting(database.GatewayPortForwardingSetting, "true")
+	database.DB.Model(&database.Instance{}).Where("name = ?", "bot-my-agent").
+		Update("forward_ports", "1-1024")
+	if _, err := client.Dial("tcp", target); err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("forward to unlisted port: err = %v", err)
+	}
+
+	// Non-loopback targets are never forwarded.
+	if _, err := client.Dial("tcp", "10.0.0.1:80"); err == nil || !strings.Contains(err.Error(), "localhost") {
+		t.Fatalf("forward to remote host: err = %v", err)
+	}
+
+	if got := forwardAudit(t); len(got) != 3 || !strings.Contains(got[0], "denied: port forwarding is disabled") {
+		t.Errorf("audit = %q", got)
+	}
+}
+
+func TestGatewayForwardsAllowlistedPort(t *testing.T) {
+	env := setupGateway(t)
+	port := startEchoListener(t)
+	database.SetSetting(database.GatewayPortForwardingSetting, "true")
+	database.DB.Model(&database.Instance{}).Where("name = ?", "bot-my-agent").
+		Update("forward_ports", fmt.Sprintf("22, %d-%d", port, port+1))
 	client := env.dial(t, "stan.my-agent", env.signer)
 
-	// direct-tcpip open must be rejected (v1 supports sessions only).
-	if _, err := client.Dial("tcp", "127.0.0.1:80"); err == nil {
-		t.Fatal("expected direct-tcpip to be rejected")
+	conn, err := client.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping\n" {
+		t.Fatalf("read = %q, %v", buf, err)
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(forwardAudit(t)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	got := forwardAudit(t)
+	if len(got) != 2 || !strings.HasSuffix(got[0], ", opened") ||
+		!strings.HasSuffix(got[1], "closed, sent=5, received=5") {
+		t.Errorf("audit = %q", got)
 	}
 }
 
@@ -414,3 +593,26 @@ func TestGatewayRateLimiterBansAfterFailures(t *testing.T) {
 		t.Fatal("expected banned IP to be refused")
 	}
 }
+
+func TestParsePortAllowlist(t *testing.T) {
+	list, err := ParsePortAllowlist(" 3000, 8000-8100 ,,5173")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for port, want := range map[uint32]bool{3000: true, 8000: true, 8050: true, 8100: true, 5173: true, 3001: false, 8101: false} {
+		if list.Allows(port) != want {
+			t.Errorf("Allows(%d) = %v, want %v", port, !want, want)
+		}
+	}
+	if n := len(list.Ports()); n != 103 {
+		t.Errorf("len(Ports()) = %d, want 103", n)
+	}
+	for _, bad := range []string{"0", "65536", "abc", "9000-8000", "1-", "-5", "1000-1256"} {
+		if _, err := ParsePortAllowlist(bad); err == nil {
+			t.Errorf("ParsePortAllowlist(%q) succeeded", bad)
+		}
+	}
+	if list, _ := ParsePortAllowlist(""); list.Allows(22) {
+		t.Error("empty allowlist allows a port")
+	}
+}
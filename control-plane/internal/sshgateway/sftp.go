@@ -0,0 +1,496 @@
+// sftp.go inspects file transfers passing through the gateway. The
+// instance's own sftp-server still does the work: the "sftp" subsystem is
+// bridged like any other session, but its byte stream is split into SFTP
+// (v3) packets so that every open, read, write, rename and remove can be
+// audited, writes under read-only shared folders refused, and per-user
+// upload caps enforced before a request reaches the instance. Legacy scp
+// (exec "scp -t"/"scp -f") gets the same read-only and cap checks at the
+// exec request.
+
+package sshgateway
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+)
+
+// SFTP v3 packet types (draft-ietf-secsh-filexfer-02).
+const (
+	sshFxpInit     = 1
+	sshFxpVersion  = 2
+	sshFxpOpen     = 3
+	sshFxpClose    = 4
+	sshFxpRead     = 5
+	sshFxpWrite    = 6
+	sshFxpSetstat  = 9
+	sshFxpRemove   = 13
+	sshFxpMkdir    = 14
+	sshFxpRmdir    = 15
+	sshFxpRealpath = 16
+	sshFxpRename   = 18
+	sshFxpSymlink  = 20
+	sshFxpStatus   = 101
+	sshFxpHandle   = 102
+	sshFxpData     = 103
+	sshFxpName     = 104
+	sshFxpExtended = 200
+)
+
+// SSH_FXF_* open flags that imply modification.
+const sftpWriteFlags = 0x02 | 0x04 | 0x08 | 0x10 // WRITE | APPEND | CREAT | TRUNC
+
+// SSH_FX_* status codes.
+const (
+	sshFxOK               = 0
+	sshFxPermissionDenied = 3
+)
+
+// sftpMaxPacket bounds a single buffered SFTP packet. OpenSSH caps packets
+// at 256 KiB; anything far beyond that is treated as a protocol error.
+const sftpMaxPacket = 1 << 20
+
+// defaultSFTPHome resolves relative paths until the client's first
+// REALPATH(".") reveals the real one. Agent sessions run as root.
+const defaultSFTPHome = "/root"
+
+var errSFTPPacket = errors.New("sftp: malformed or oversized packet")
+
+// fileRules are the file-transfer restrictions for one gateway session.
+type fileRules struct {
+	readOnly  []string // cleaned mount paths of read-only shared folders
+	maxUpload int64    // bytes; 0 = unlimited
+}
+
+// loadFileRules collects the read-only shared folder mounts of an instance
+// and the user's upload cap.
+func loadFileRules(instanceID uint, username string) fileRules {
+	var rules fileRules
+	folders, err := database.GetSharedFoldersForInstance(instanceID)
+	if err != nil {
+		log.Printf("SSH gateway: load shared folders for instance %d: %v", instanceID, err)
+	}
+	for _, sf := range folders {
+		if sf.ReadOnly {
+			rules.readOnly = append(rules.readOnly, path.Clean(sf.MountPath))
+		}
+	}
+	if user, err := database.GetUserByUsername(username); err == nil && user.SFTPMaxUploadMB > 0 {
+		rules.maxUpload = int64(user.SFTPMaxUploadMB) << 20
+	}
+	return rules
+}
+
+// readOnlyMount returns the read-only mount containing p, or "".
+func (r fileRules) readOnlyMount(p string) string {
+	for _, m := range r.readOnly {
+		if m == "/" || p == m || strings.HasPrefix(p, m+"/") {
+			return m
+		}
+	}
+	return ""
+}
+
+// sftpPending is a client request awaiting the server's reply.
+type sftpPending struct {
+	op     string // audit op name; "" = not audited
+	path   string
+	target string // rename/link destination
+	write  bool   // open for writing
+	handle string // read
+}
+
+// sftpHandle is an open file on the instance.
+type sftpHandle struct {
+	path    string
+	write   bool
+	read    int64
+	written int64
+}
+
+// sftpProxy sits between the user's channel and the instance's sftp-server.
+type sftpProxy struct {
+	g          *Gateway
+	instanceID uint
+	username   string
+	rules      fileRules
+
+	client   io.Writer  // user's channel
+	server   io.Writer  // instance's channel
+	clientMu sync.Mutex // serialises whole packets written to client
+
+	cbuf, sbuf []byte // partial packets per direction
+
+	mu      sync.Mutex
+	home    string
+	pending map[uint32]sftpPending
+	handles map[string]*sftpHandle
+}
+
+func (g *Gateway) newSFTPProxy(instanceID uint, username string, rules fileRules, client, server io.Writer) *sftpProxy {
+	return &sftpProxy{
+		g:          g,
+		instanceID: instanceID,
+		username:   username,
+		rules:      rules,
+		client:     client,
+		server:     server,
+		home:       defaultSFTPHome,
+		pending:    make(map[uint32]sftpPending),
+		handles:    make(map[string]*sftpHandle),
+	}
+}
+
+// fromClient consumes bytes the user sent, forwarding or answering each
+// complete packet.
+func (p *sftpProxy) fromClient(b []byte) error {
+	var err error
+	p.cbuf, err = splitPackets(append(p.cbuf, b...), p.clientPacket)
+	return err
+}
+
+// fromServer consumes bytes the instance sent, relaying each complete
+// packet to the user.
+func (p *sftpProxy) fromServer(b []byte) error {
+	var err error
+	p.sbuf, err = splitPackets(append(p.sbuf, b...), p.serverPacket)
+	return err
+}
+
+// splitPackets calls fn for every complete length-prefixed packet in buf and
+// returns the unconsumed remainder.
+func splitPackets(buf []byte, fn func(pkt []byte) error) ([]byte, error) {
+	for len(buf) >= 4 {
+		n := binary.BigEndian.Uint32(buf)
+		if n == 0 || n > sftpMaxPacket {
+			return nil, errSFTPPacket
+		}
+		if uint32(len(buf)-4) < n {
+			break
+		}
+		if err := fn(buf[:4+n]); err != nil {
+			return nil, err
+		}
+		buf = buf[4+n:]
+	}
+	return append([]byte(nil), buf...), nil
+}
+
+func (p *sftpProxy) clientPacket(pkt []byte) error {
+	typ := pkt[4]
+	if typ == sshFxpInit || len(pkt) < 9 {
+		_, err := p.server.Write(pkt)
+		return err
+	}
+	id := binary.BigEndian.Uint32(pkt[5:])
+	r := &sftpReader{b: pkt[9:]}
+
+	var pend sftpPending
+	var denied string
+	switch typ {
+	case sshFxpOpen:
+		name := p.resolve(r.str())
+		flags := r.u32()
+		pend = sftpPending{op: "open", path: name, write: flags&sftpWriteFlags != 0}
+		if pend.write {
+			denied = p.checkWritable(name)
+		}
+	case sshFxpRead:
+		pend = sftpPending{handle: r.str()}
+	case sshFxpWrite:
+		handle := r.str()
+		off := r.u64()
+		n := int64(r.u32())
+		p.mu.Lock()
+		h := p.handles[handle]
+		if h != nil {
+			if p.rules.maxUpload > 0 && int64(off)+n > p.rules.maxUpload {
+				denied = fmt.Sprintf("upload exceeds %d MB limit", p.rules.maxUpload>>20)
+				pend = sftpPending{op: "write", path: h.path}
+			} else {
+				h.written += n
+			}
+		}
+		p.mu.Unlock()
+	case sshFxpClose:
+		p.closeHandle(r.str())
+	case sshFxpRemove, sshFxpRmdir, sshFxpMkdir, sshFxpSetstat:
+		name := p.resolve(r.str())
+		pend = sftpPending{op: sftpOpName(typ), path: name}
+		denied = p.checkWritable(name)
+	case sshFxpRename, sshFxpSymlink:
+		from, to := p.resolve(r.str()), p.resolve(r.str())
+		pend = sftpPending{op: sftpOpName(typ), path: from, target: to}
+		denied = p.checkWritable(from, to)
+	case sshFxpRealpath:
+		if r.str() == "." {
+			pend = sftpPending{op: "realpath"}
+		}
+	case sshFxpExtended:
+		switch ext := r.str(); ext {
+		case "posix-rename@openssh.com", "hardlink@openssh.com":
+			from, to := p.resolve(r.str()), p.resolve(r.str())
+			pend = sftpPending{op: strings.TrimSuffix(ext, "@openssh.com"), path: from, target: to}
+			denied = p.checkWritable(from, to)
+		case "lsetstat@openssh.com":
+			name := p.resolve(r.str())
+			pend = sftpPending{op: "setstat", path: name}
+			denied = p.checkWritable(name)
+		}
+	}
+	if r.err {
+		return errSFTPPacket
+	}
+
+	if denied != "" {
+		p.audit(pend, "denied: "+denied)
+		return p.writeClient(statusPacket(id, sshFxPermissionDenied, "claworc: "+denied))
+	}
+	if pend.op != "" || pend.handle != "" {
+		p.mu.Lock()
+		p.pending[id] = pend
+		p.mu.Unlock()
+	}
+	_, err := p.server.Write(pkt)
+	return err
+}
+
+func (p *sftpProxy) serverPacket(pkt []byte) error {
+	if len(pkt) >= 9 && pkt[4] != sshFxpVersion {
+		p.reply(pkt[4], binary.BigEndian.Uint32(pkt[5:]), &sftpReader{b: pkt[9:]})
+	}
+	return p.writeClient(pkt)
+}
+
+// reply matches a server reply to its pending request.
+func (p *sftpProxy) reply(typ byte, id uint32, r *sftpReader) {
+	p.mu.Lock()
+	pend, ok := p.pending[id]
+	delete(p.pending, id)
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	switch typ {
+	case sshFxpHandle:
+		if pend.op == "open" {
+			p.handles[r.str()] = &sftpHandle{path: pend.path, write: pend.write}
+		}
+	case sshFxpData:
+		if h := p.handles[pend.handle]; h != nil {
+			h.read += int64(len(r.str()))
+		}
+	case sshFxpName:
+		if pend.op == "realpath" && r.u32() > 0 {
+			if home := r.str(); strings.HasPrefix(home, "/") {
+				p.home = home
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if pend.op == "" || pend.op == "realpath" {
+		return
+	}
+	switch typ {
+	case sshFxpHandle:
+		mode := "read"
+		if pend.write {
+			mode = "write"
+		}
+		p.audit(pend, "mode="+mode)
+	case sshFxpStatus:
+		if code := r.u32(); code == sshFxOK {
+			p.audit(pend, "ok")
+		} else {
+			p.audit(pend, fmt.Sprintf("failed: %s", r.str()))
+		}
+	}
+}
+
+// closeHandle audits the bytes moved through a file handle and forgets it.
+func (p *sftpProxy) closeHandle(handle string) {
+	p.mu.Lock()
+	h := p.handles[handle]
+	delete(p.handles, handle)
+	p.mu.Unlock()
+	if h != nil {
+		p.auditTransfer(h)
+	}
+}
+
+// finish audits handles still open when the session ends.
+func (p *sftpProxy) finish() {
+	p.mu.Lock()
+	handles := p.handles
+	p.handles = make(map[string]*sftpHandle)
+	p.mu.Unlock()
+	for _, h := range handles {
+		p.auditTransfer(h)
+	}
+}
+
+func (p *sftpProxy) auditTransfer(h *sftpHandle) {
+	if h.write {
+		p.g.audit(sshaudit.EventFileOperation, p.instanceID, p.username,
+			fmt.Sprintf("via=sftp, op=write, path=%s, size=%d", h.path, h.written))
+	}
+	if h.read > 0 || !h.write {
+		p.g.audit(sshaudit.EventFileOperation, p.instanceID, p.username,
+			fmt.Sprintf("via=sftp, op=read, path=%s, size=%d", h.path, h.read))
+	}
+}
+
+func (p *sftpProxy) audit(pend sftpPending, result string) {
+	details := fmt.Sprintf("via=sftp, op=%s, path=%s", pend.op, pend.path)
+	if pend.target != "" {
+		details += ", target=" + pend.target
+	}
+	p.g.audit(sshaudit.EventFileOperation, p.instanceID, p.username, details+", "+result)
+}
+
+// checkWritable returns a denial reason when any of paths lies under a
+// read-only shared folder.
+func (p *sftpProxy) checkWritable(paths ...string) string {
+	for _, name := range paths {
+		if m := p.rules.readOnlyMount(name); m != "" {
+			return fmt.Sprintf("%s is a read-only shared folder", m)
+		}
+	}
+	return ""
+}
+
+func (p *sftpProxy) resolve(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		p.mu.Lock()
+		name = path.Join(p.home, name)
+		p.mu.Unlock()
+	}
+	return path.Clean(name)
+}
+
+func (p *sftpProxy) writeClient(pkt []byte) error {
+	p.clientMu.Lock()
+	defer p.clientMu.Unlock()
+	_, err := p.client.Write(pkt)
+	return err
+}
+
+func sftpOpName(typ byte) string {
+	switch typ {
+	case sshFxpRemove:
+		return "remove"
+	case sshFxpRmdir:
+		return "rmdir"
+	case sshFxpMkdir:
+		return "mkdir"
+	case sshFxpSetstat:
+		return "setstat"
+	case sshFxpRename:
+		return "rename"
+	case sshFxpSymlink:
+		return "symlink"
+	}
+	return ""
+}
+
+// statusPacket builds an SSH_FXP_STATUS reply.
+func statusPacket(id, code uint32, msg string) []byte {
+	body := make([]byte, 0, 21+len(msg))
+	body = append(body, 0, 0, 0, 0, sshFxpStatus)
+	body = binary.BigEndian.AppendUint32(body, id)
+	body = binary.BigEndian.AppendUint32(body, code)
+	body = binary.BigEndian.AppendUint32(body, uint32(len(msg)))
+	body = append(body, msg...)
+	body = binary.BigEndian.AppendUint32(body, 0) // language tag
+	binary.BigEndian.PutUint32(body, uint32(len(body)-4))
+	return body
+}
+
+// sftpReader decodes SFTP fields; err latches on short input.
+type sftpReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *sftpReader) take(n int) []byte {
+	if n < 0 || len(r.b) < n {
+		r.b, r.err = nil, true
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *sftpReader) u32() uint32 {
+	if v := r.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *sftpReader) u64() uint64 {
+	if v := r.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (r *sftpReader) str() string {
+	return string(r.take(int(r.u32())))
+}
+
+// checkSCP vets a legacy scp exec ("scp -t <dir>" uploads, "scp -f <path>"
+// downloads). It audits the transfer and returns a denial reason for
+// uploads into read-only shared folders, or any upload while a size cap
+// applies (the scp stream is not inspected, so the cap cannot be enforced
+// per file; SFTP-based scp, the OpenSSH default, is unaffected).
+func (g *Gateway) checkSCP(instanceID uint, username, command string) (denied string) {
+	fields := strings.Fields(command)
+	if len(fields) < 3 || path.Base(fields[0]) != "scp" {
+		return ""
+	}
+	op := ""
+	for _, f := range fields[1 : len(fields)-1] {
+		if f == "--" {
+			break
+		}
+		if strings.HasPrefix(f, "-") && strings.ContainsRune(f, 't') {
+			op = "upload"
+		} else if strings.HasPrefix(f, "-") && strings.ContainsRune(f, 'f') {
+			op = "download"
+		}
+	}
+	if op == "" {
+		return ""
+	}
+	target := fields[len(fields)-1]
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(defaultSFTPHome, target)
+	}
+	target = path.Clean(target)
+
+	if op == "upload" {
+		rules := loadFileRules(instanceID, username)
+		if m := rules.readOnlyMount(target); m != "" {
+			denied = fmt.Sprintf("%s is a read-only shared folder", m)
+		} else if rules.maxUpload > 0 {
+			denied = "legacy scp uploads are disabled while an upload limit applies; use sftp or scp without -O"
+		}
+	}
+	details := fmt.Sprintf("via=scp, op=%s, path=%s", op, target)
+	if denied != "" {
+		details += ", denied: " + denied
+	}
+	g.audit(sshaudit.EventFileOperation, instanceID, username, details)
+	return denied
+}
@@ -0,0 +1,260 @@
+package sshgateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gluk-w/claworc/control-plane/internal/database"
+	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
+)
+
+// sftpPacket builds a length-prefixed SFTP packet from a type, request id
+// and fields (string, uint32 or uint64).
+func sftpPacket(typ byte, id uint32, fields ...interface{}) []byte {
+	b := []byte{0, 0, 0, 0, typ}
+	b = binary.BigEndian.AppendUint32(b, id)
+	for _, f := range fields {
+		switch v := f.(type) {
+		case string:
+			b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+			b = append(b, v...)
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		}
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b
+}
+
+type sftpTestEnv struct {
+	proxy          *sftpProxy
+	client, server bytes.Buffer
+	auditor        *sshaudit.Auditor
+}
+
+func newSFTPTestEnv(t *testing.T, rules fileRules) *sftpTestEnv {
+	t.Helper()
+	setupTestDB(t)
+	auditor, err := sshaudit.NewAuditor(database.DB, 0)
+	if err != nil {
+		t.Fatalf("auditor: %v", err)
+	}
+	env := &sftpTestEnv{auditor: auditor}
+	g := New(Config{Auditor: auditor})
+	env.proxy = g.newSFTPProxy(1, "stan", rules, &env.client, &env.server)
+	return env
+}
+
+func (e *sftpTestEnv) auditDetails(t *testing.T) []string {
+	t.Helper()
+	var entries []sshaudit.AuditEntry
+	if err := database.DB.Where("event_type = ?", sshaudit.EventFileOperation).Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("query audit: %v", err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Details)
+	}
+	return out
+}
+
+func statusCode(t *testing.T, pkt []byte) uint32 {
+	t.Helper()
+	if len(pkt) < 13 || pkt[4] != sshFxpStatus {
+		t.Fatalf("expected STATUS packet, got %x", pkt)
+	}
+	return binary.BigEndian.Uint32(pkt[9:])
+}
+
+func TestSFTPProxyDeniesWritesUnderReadOnlyFolder(t *testing.T) {
+	env := newSFTPTestEnv(t, fileRules{readOnly: []string{"/shared/docs"}})
+
+	cases := [][]byte{
+		sftpPacket(sshFxpOpen, 1, "/shared/docs/a.txt", uint32(0x02|0x08), uint32(0)),
+		sftpPacket(sshFxpRemove, 2, "/shared/docs/b.txt"),
+		sftpPacket(sshFxpRename, 3, "/root/x", "/shared/docs/x"),
+		sftpPacket(sshFxpExtended, 4, "posix-rename@openssh.com", "/shared/docs/y", "/root/y"),
+	}
+	for _, pkt := range cases {
+		env.client.Reset()
+		if err := env.proxy.fromClient(pkt); err != nil {
+			t.Fatalf("fromClient: %v", err)
+		}
+		if code := statusCode(t, env.client.Bytes()); code != sshFxPermissionDenied {
+			t.Errorf("status = %d, want permission denied", code)
+		}
+	}
+	if env.server.Len() != 0 {
+		t.Errorf("denied requests reached the instance: %x", env.server.Bytes())
+	}
+
+	// Reads under the folder and writes elsewhere pass through.
+	env.proxy.fromClient(sftpPacket(sshFxpOpen, 5, "/shared/docs/a.txt", uint32(0x01), uint32(0)))
+	env.proxy.fromClient(sftpPacket(sshFxpMkdir, 6, "/shared/docsnot", uint32(0)))
+	if env.server.Len() == 0 {
+		t.Error("permitted requests were not forwarded")
+	}
+
+	details := env.auditDetails(t)
+	if len(details) != 4 || !strings.Contains(details[0], "op=open, path=/shared/docs/a.txt, denied:") {
+		t.Errorf("audit = %q", details)
+	}
+}
+
+func TestSFTPProxyUploadLimit(t *testing.T) {
+	env := newSFTPTestEnv(t, fileRules{maxUpload: 1 << 20})
+
+	env.proxy.fromClient(sftpPacket(sshFxpOpen, 1, "upload.bin", uint32(0x02|0x08), uint32(0)))
+	env.proxy.fromServer(sftpPacket(sshFxpHandle, 1, "h1"))
+
+	// Within the cap.
+	env.client.Reset()
+	env.proxy.fromClient(sftpPacket(sshFxpWrite, 2, "h1", uint64(0), strings.Repeat("x", 1000)))
+	if env.client.Len() != 0 {
+		t.Fatalf("write within limit was answered by the gateway")
+	}
+
+	// Past the cap.
+	env.proxy.fromClient(sftpPacket(sshFxpWrite, 3, "h1", uint64(1<<20-10), strings.Repeat("x", 100)))
+	if code := statusCode(t, env.client.Bytes()); code != sshFxPermissionDenied {
+		t.Errorf("status = %d, want permission denied", code)
+	}
+
+	env.proxy.fromClient(sftpPacket(sshFxpClose, 4, "h1"))
+	details := env.auditDetails(t)
+	want := []string{
+		"via=sftp, op=open, path=/root/upload.bin, mode=write",
+		"via=sftp, op=write, path=/root/upload.bin, denied: upload exceeds 1 MB limit",
+		"via=sftp, op=write, path=/root/upload.bin, size=1000",
+	}
+	if strings.Join(details, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit =\n%s\nwant\n%s", strings.Join(details, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSFTPProxyAuditsReadsAndMutations(t *testing.T) {
+	env := newSFTPTestEnv(t, fileRules{})
+
+	// REALPATH(".") teaches the proxy the home directory.
+	env.proxy.fromClient(sftpPacket(sshFxpRealpath, 1, "."))
+	env.proxy.fromServer(sftpPacket(sshFxpName, 1, uint32(1), "/home/agent", "", uint32(0)))
+
+	env.proxy.fromClient(sftpPacket(sshFxpOpen, 2, "notes.md", uint32(0x01), uint32(0)))
+	env.proxy.fromServer(sftpPacket(sshFxpHandle, 2, "h"))
+	env.proxy.fromClient(sftpPacket(sshFxpRead, 3, "h", uint64(0), uint32(4096)))
+	env.proxy.fromServer(sftpPacket(sshFxpData, 3, "hello"))
+	env.proxy.fromClient(sftpPacket(sshFxpClose, 4, "h"))
+
+	env.proxy.fromClient(sftpPacket(sshFxpRemove, 5, "/tmp/old"))
+	env.proxy.fromServer(sftpPacket(sshFxpStatus, 5, uint32(sshFxOK), "", ""))
+	env.proxy.fromClient(sftpPacket(sshFxpRename, 6, "/tmp/a", "/tmp/b"))
+	env.proxy.fromServer(sftpPacket(sshFxpStatus, 6, uint32(2), "No such file", ""))
+
+	want := []string{
+		"via=sftp, op=open, path=/home/agent/notes.md, mode=read",
+		"via=sftp, op=read, path=/home/agent/notes.md, size=5",
+		"via=sftp, op=remove, path=/tmp/old, ok",
+		"via=sftp, op=rename, path=/tmp/a, target=/tmp/b, failed: No such file",
+	}
+	if got := env.auditDetails(t); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSFTPProxySplitsPacketsAcrossReads(t *testing.T) {
+	env := newSFTPTestEnv(t, fileRules{})
+	pkt := append(sftpPacket(sshFxpInit, 3), sftpPacket(sshFxpRemove, 7, "/tmp/x")...)
+	for i := range pkt {
+		if err := env.proxy.fromClient(pkt[i : i+1]); err != nil {
+			t.Fatalf("fromClient byte %d: %v", i, err)
+		}
+	}
+	if !bytes.Equal(env.server.Bytes(), pkt) {
+		t.Errorf("forwarded %x, want %x", env.server.Bytes(), pkt)
+	}
+
+	if err := env.proxy.fromClient([]byte{0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Error("oversized packet was accepted")
+	}
+}
+
+func TestCheckSCP(t *testing.T) {
+	setupTestDB(t)
+	inst := seedInstance(t, "bot-scp", 0)
+	user := seedUser(t, "stan", "user")
+	database.CreateSharedFolder(&database.SharedFolder{
+		Name: "docs", MountPath: "/shared/docs", OwnerID: user.ID, ReadOnly: true,
+		InstanceIDs: database.EncodeSharedFolderInstanceIDs([]uint{inst.ID}),
+	})
+	g := New(Config{})
+
+	if d := g.checkSCP(inst.ID, "stan", "scp -t -- /shared/docs/"); !strings.Contains(d, "read-only") {
+		t.Errorf("upload into read-only folder: denied = %q", d)
+	}
+	if d := g.checkSCP(inst.ID, "stan", "scp -f -- /shared/docs/a"); d != "" {
+		t.Errorf("download: denied = %q", d)
+	}
+	if d := g.checkSCP(inst.ID, "stan", "scp -t /tmp"); d != "" {
+		t.Errorf("upload without limit: denied = %q", d)
+	}
+
+	database.DB.Model(user).Update("sftp_max_upload_mb", 5)
+	if d := g.checkSCP(inst.ID, "stan", "scp -t /tmp"); d == "" {
+		t.Error("legacy scp upload allowed while an upload limit applies")
+	}
+	if d := g.checkSCP(inst.ID, "stan", "ls -t /tmp"); d != "" {
+		t.Errorf("non-scp command: denied = %q", d)
+	}
+}
+
+func TestGatewaySFTPSubsystemFiltered(t *testing.T) {
+	env := setupGateway(t)
+	inst, _ := database.GetInstanceByName("bot-my-agent")
+	database.CreateSharedFolder(&database.SharedFolder{
+		Name: "docs", MountPath: "/shared/docs", OwnerID: 1, ReadOnly: true,
+		InstanceIDs: database.EncodeSharedFolderInstanceIDs([]uint{inst.ID}),
+	})
+	client := env.dial(t, "stan.my-agent", env.signer)
+
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	defer sess.Close()
+	stdin, _ := sess.StdinPipe()
+	stdout, _ := sess.StdoutPipe()
+	if err := sess.RequestSubsystem("sftp"); err != nil {
+		t.Fatalf("request subsystem: %v", err)
+	}
+
+	readPacket := func() []byte {
+		t.Helper()
+		hdr := make([]byte, 4)
+		if _, err := io.ReadFull(stdout, hdr); err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+		body := make([]byte, binary.BigEndian.Uint32(hdr))
+		if _, err := io.ReadFull(stdout, body); err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		return append(hdr, body...)
+	}
+
+	// Denied by the gateway: answered with a STATUS, never echoed.
+	stdin.Write(sftpPacket(sshFxpRemove, 1, "/shared/docs/a"))
+	if code := statusCode(t, readPacket()); code != sshFxPermissionDenied {
+		t.Errorf("status = %d, want permission denied", code)
+	}
+
+	// Allowed: forwarded to the (echoing) instance and relayed back.
+	allowed := sftpPacket(sshFxpRemove, 2, "/tmp/a")
+	stdin.Write(allowed)
+	if got := readPacket(); !bytes.Equal(got, allowed) {
+		t.Errorf("relayed %x, want %x", got, allowed)
+	}
+}
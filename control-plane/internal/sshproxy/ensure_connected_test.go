@@ -17,10 +17,21 @@ type mockOrchestrator struct {
 	configureErr error
 	addressErr   error
 
+	// hostKeys, when set, are what ReadSSHHostKeys reports, standing in for
+	// the keys read from the container through the exec path.
+	hostKeys []string
+
 	configureCalls int
 	addressCalls   int
 }
 
+func (m *mockOrchestrator) ReadSSHHostKeys(_ context.Context, _ uint) ([]string, error) {
+	if len(m.hostKeys) == 0 {
+		return nil, fmt.Errorf("no host keys")
+	}
+	return m.hostKeys, nil
+}
+
 func (m *mockOrchestrator) ConfigureSSHAccess(_ context.Context, _ uint, _ string) error {
 	m.configureCalls++
 	return m.configureErr
@@ -214,6 +225,10 @@ func TestEnsureConnected_ReconnectsAfterDeadConnection(t *testing.T) {
 	orch.sshHost = host2
 	orch.sshPort = port2
 
+	// The new server has a different host key; it is only trusted because
+	// the orchestrator confirms it.
+	orch.hostKeys = []string{string(ssh.MarshalAuthorizedKey(ts2.hostKey))}
+
 	// EnsureConnected should detect the dead connection and reconnect
 	client, err := mgr.EnsureConnected(context.Background(), uint(1), orch)
 	if err != nil {
@@ -7,6 +7,7 @@ package sshproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -15,7 +16,10 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
 )
 
 // executeCommand creates a new SSH session, runs cmd, and returns stdout,
@@ -55,7 +59,18 @@ func executeCommand(client *ssh.Client, cmd string) (stdout, stderr string, exit
 
 // RunCommand is the exported equivalent of executeCommand for use outside this package.
 func RunCommand(client *ssh.Client, cmd string) (stdout, stderr string, exitCode int, err error) {
-	return executeCommand(client, cmd)
+	return RunCommandContext(context.Background(), client, cmd)
+}
+
+// RunCommandContext is RunCommand recorded as a child span of any trace in
+// ctx. The command text is not recorded. ctx is used for tracing only; the
+// command runs to completion as with RunCommand.
+func RunCommandContext(ctx context.Context, client *ssh.Client, cmd string) (stdout, stderr string, exitCode int, err error) {
+	_, span := tracing.Start(ctx, "sshproxy.RunCommand")
+	stdout, stderr, exitCode, err = executeCommand(client, cmd)
+	span.SetAttributes(attribute.Int("ssh.exit_code", exitCode))
+	tracing.End(span, err)
+	return stdout, stderr, exitCode, err
 }
 
 // executeCommandWithStdin creates a new SSH session, pipes input to the
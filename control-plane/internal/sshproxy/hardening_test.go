@@ -259,6 +259,24 @@ func TestSecurity_PermitOpenRestrictedToPorts(t *testing.T) {
 	}
 }
 
+// TestSecurity_PermitOpenOverrideIncludedFirst verifies that the control
+// plane's forward-port list can only replace PermitOpen from a file
+// included before it, and that the static list matches BasePermitOpen.
+func TestSecurity_PermitOpenOverrideIncludedFirst(t *testing.T) {
+	config := loadSSHDConfig(t)
+
+	include := strings.Index(config, "\nInclude "+PermitOpenFile+"\n")
+	permitOpen := strings.Index(config, "\nPermitOpen ")
+	if include < 0 || permitOpen < 0 || include > permitOpen {
+		t.Fatalf("SECURITY: claworc.conf must include %s before PermitOpen", PermitOpenFile)
+	}
+
+	val, _ := getConfigDirective(config, "PermitOpen")
+	if val != strings.Join(BasePermitOpen, " ") {
+		t.Errorf("SECURITY: PermitOpen = %q, want BasePermitOpen %q", val, strings.Join(BasePermitOpen, " "))
+	}
+}
+
 // TestSecurity_LoginGraceTimeLimited verifies that the authentication
 // grace period is limited to prevent slow-loris style attacks.
 func TestSecurity_LoginGraceTimeLimited(t *testing.T) {
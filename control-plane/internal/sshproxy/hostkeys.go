@@ -0,0 +1,261 @@
+// hostkeys.go implements host key pinning for agent connections.
+//
+// Each instance's host key is pinned the first time it is seen and, when a
+// HostKeyStore is configured, persisted so the pin survives control-plane
+// restarts. Where the orchestrator can read the container's public host
+// keys over its exec channel (HostKeyReader), the key is pinned from there
+// before the first dial, and a changed key (new container, same instance)
+// is re-pinned only if the orchestrator confirms it. A changed key that
+// cannot be confirmed is rejected, recorded as pending in the store and
+// reported through EventHostKeyMismatch until an admin accepts it.
+
+package sshproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key sources recorded alongside a pinned key.
+const (
+	HostKeySourceTOFU         = "tofu"         // first key presented on the wire
+	HostKeySourceOrchestrator = "orchestrator" // read from the container via exec
+	HostKeySourceAdmin        = "admin"        // accepted by an admin after a mismatch
+)
+
+// Host key events emitted to EventListeners.
+const (
+	EventHostKeyPinned   ConnectionEventType = "host_key_pinned"
+	EventHostKeyMismatch ConnectionEventType = "host_key_mismatch"
+)
+
+// ErrHostKeyMismatch is returned (wrapped) when an instance presents a host
+// key that differs from its pinned key and could not be verified.
+var ErrHostKeyMismatch = errors.New("host key mismatch")
+
+// hostKeyReadTimeout bounds the orchestrator exec used to verify a key.
+const hostKeyReadTimeout = 15 * time.Second
+
+// HostKeyStore persists pinned host keys. Keys are in authorized_keys
+// format. LoadHostKey returns "" when no key is pinned.
+type HostKeyStore interface {
+	LoadHostKey(instanceID uint) (string, error)
+	SaveHostKey(instanceID uint, key, fingerprint, source string) error
+	RecordHostKeyMismatch(instanceID uint, key, fingerprint string) error
+	DeleteHostKey(instanceID uint) error
+}
+
+// HostKeyReader is implemented by orchestrators that can read an
+// instance's public host keys out of band (authorized_keys format, one per
+// entry), which lets the manager pin keys without trusting the network.
+type HostKeyReader interface {
+	ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error)
+}
+
+// SetHostKeyStore configures persistent storage for pinned host keys.
+// Without one, pins live in memory only.
+func (m *SSHManager) SetHostKeyStore(store HostKeyStore) {
+	m.hostKeyMu.Lock()
+	defer m.hostKeyMu.Unlock()
+	m.hostKeyStore = store
+}
+
+// knownHostKey returns the pinned key for an instance, loading it from the
+// store on a cache miss.
+func (m *SSHManager) knownHostKey(instanceID uint) ssh.PublicKey {
+	m.hostKeyMu.RLock()
+	known, ok := m.hostKeys[instanceID]
+	store := m.hostKeyStore
+	m.hostKeyMu.RUnlock()
+	if ok || store == nil {
+		return known
+	}
+
+	raw, err := store.LoadHostKey(instanceID)
+	if err != nil {
+		log.Printf("[ssh] load host key for instance %d: %v", instanceID, err)
+		return nil
+	}
+	if raw == "" {
+		return nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(raw))
+	if err != nil {
+		log.Printf("[ssh] stored host key for instance %d is unparseable: %v", instanceID, err)
+		return nil
+	}
+	m.hostKeyMu.Lock()
+	m.hostKeys[instanceID] = key
+	m.hostKeyMu.Unlock()
+	return key
+}
+
+// SetHostKey pins key for an instance, replacing any previous pin, and
+// persists it when a store is configured.
+func (m *SSHManager) SetHostKey(instanceID uint, key ssh.PublicKey, source string) error {
+	m.hostKeyMu.Lock()
+	m.hostKeys[instanceID] = key
+	store := m.hostKeyStore
+	m.hostKeyMu.Unlock()
+
+	fp := ssh.FingerprintSHA256(key)
+	log.Printf("[ssh] Pinned host key for instance %d (%s %s, source %s)", instanceID, key.Type(), fp, source)
+	m.emitEvent(ConnectionEvent{
+		InstanceID: instanceID,
+		Type:       EventHostKeyPinned,
+		Timestamp:  time.Now(),
+		Details:    fmt.Sprintf("%s %s (source %s)", key.Type(), fp, source),
+	})
+	if store == nil {
+		return nil
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	return store.SaveHostKey(instanceID, line, fp, source)
+}
+
+// ClearHostKey removes the pinned host key for an instance, e.g. when it is
+// deleted. The next connection pins afresh.
+func (m *SSHManager) ClearHostKey(instanceID uint) {
+	m.hostKeyMu.Lock()
+	delete(m.hostKeys, instanceID)
+	store := m.hostKeyStore
+	m.hostKeyMu.Unlock()
+	if store != nil {
+		if err := store.DeleteHostKey(instanceID); err != nil {
+			log.Printf("[ssh] delete host key for instance %d: %v", instanceID, err)
+		}
+	}
+}
+
+// orchestratorHostKeys reads the instance's host keys through the
+// orchestrator exec path. ok is false when no HostKeyReader is available
+// or the read failed.
+func (m *SSHManager) orchestratorHostKeys(ctx context.Context, instanceID uint, orch Orchestrator) (keys []ssh.PublicKey, ok bool) {
+	if orch == nil {
+		m.reconnMu.RLock()
+		orch = m.orch
+		m.reconnMu.RUnlock()
+	}
+	reader, isReader := orch.(HostKeyReader)
+	if !isReader {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, hostKeyReadTimeout)
+	defer cancel()
+	lines, err := reader.ReadSSHHostKeys(ctx, instanceID)
+	if err != nil {
+		log.Printf("[ssh] read host keys for instance %d via orchestrator: %v", instanceID, err)
+		return nil, false
+	}
+	for _, l := range lines {
+		if k, _, _, _, err := ssh.ParseAuthorizedKey([]byte(l)); err == nil {
+			keys = append(keys, k)
+		}
+	}
+	return keys, len(keys) > 0
+}
+
+// pinFromOrchestrator pins the instance's host key from the orchestrator
+// before the first dial, preferring Ed25519. It is a no-op when a key is
+// already pinned or the orchestrator cannot read keys.
+func (m *SSHManager) pinFromOrchestrator(ctx context.Context, instanceID uint, orch Orchestrator) {
+	if m.knownHostKey(instanceID) != nil {
+		return
+	}
+	keys, ok := m.orchestratorHostKeys(ctx, instanceID, orch)
+	if !ok {
+		return
+	}
+	pick := keys[0]
+	for _, k := range keys {
+		if k.Type() == ssh.KeyAlgoED25519 {
+			pick = k
+			break
+		}
+	}
+	if err := m.SetHostKey(instanceID, pick, HostKeySourceOrchestrator); err != nil {
+		log.Printf("[ssh] persist host key for instance %d: %v", instanceID, err)
+	}
+}
+
+// hostKeyAlgorithmsFor restricts negotiation to the pinned key's type, so
+// a server offering several host keys always presents the pinned one.
+func hostKeyAlgorithmsFor(key ssh.PublicKey) []string {
+	if key == nil {
+		return nil
+	}
+	if key.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{key.Type()}
+}
+
+// hostKeyCallback returns the host key check for an instance. A key equal
+// to the pinned one is accepted. With no pin, the key is pinned on first
+// use, unless the orchestrator can list the container's keys and this one
+// is not among them. A key that differs from the pin is accepted (and
+// re-pinned) only when the orchestrator confirms it; otherwise it is
+// recorded as pending and the handshake fails with ErrHostKeyMismatch.
+func (m *SSHManager) hostKeyCallback(ctx context.Context, instanceID uint, orch Orchestrator) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		known := m.knownHostKey(instanceID)
+		if known != nil && string(known.Marshal()) == string(key.Marshal()) {
+			return nil
+		}
+
+		candidates, checked := m.orchestratorHostKeys(ctx, instanceID, orch)
+		for _, c := range candidates {
+			if string(c.Marshal()) == string(key.Marshal()) {
+				if err := m.SetHostKey(instanceID, key, HostKeySourceOrchestrator); err != nil {
+					log.Printf("[ssh] persist host key for instance %d: %v", instanceID, err)
+				}
+				return nil
+			}
+		}
+		if known == nil && !checked {
+			if err := m.SetHostKey(instanceID, key, HostKeySourceTOFU); err != nil {
+				log.Printf("[ssh] persist host key for instance %d: %v", instanceID, err)
+			}
+			return nil
+		}
+
+		return m.rejectHostKey(instanceID, known, key)
+	}
+}
+
+// rejectHostKey records a host key that failed verification and returns
+// the handshake error.
+func (m *SSHManager) rejectHostKey(instanceID uint, known, presented ssh.PublicKey) error {
+	fp := ssh.FingerprintSHA256(presented)
+	expected := "orchestrator-listed key"
+	if known != nil {
+		expected = ssh.FingerprintSHA256(known)
+	}
+
+	m.hostKeyMu.RLock()
+	store := m.hostKeyStore
+	m.hostKeyMu.RUnlock()
+	if store != nil && known != nil {
+		line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(presented)))
+		if err := store.RecordHostKeyMismatch(instanceID, line, fp); err != nil {
+			log.Printf("[ssh] record host key mismatch for instance %d: %v", instanceID, err)
+		}
+	}
+
+	details := fmt.Sprintf("expected %s, got %s %s", expected, presented.Type(), fp)
+	log.Printf("[ssh] SECURITY: host key mismatch for instance %d: %s", instanceID, details)
+	m.emitEvent(ConnectionEvent{
+		InstanceID: instanceID,
+		Type:       EventHostKeyMismatch,
+		Timestamp:  time.Now(),
+		Details:    details,
+	})
+	return fmt.Errorf("%w for instance %d: %s", ErrHostKeyMismatch, instanceID, details)
+}
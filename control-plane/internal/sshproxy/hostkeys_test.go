@@ -0,0 +1,210 @@
+package sshproxy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeHostKeyStore is an in-memory HostKeyStore.
+type fakeHostKeyStore struct {
+	mu      sync.Mutex
+	keys    map[uint]string
+	sources map[uint]string
+	pending map[uint]string
+}
+
+func newFakeHostKeyStore() *fakeHostKeyStore {
+	return &fakeHostKeyStore{
+		keys:    make(map[uint]string),
+		sources: make(map[uint]string),
+		pending: make(map[uint]string),
+	}
+}
+
+func (s *fakeHostKeyStore) LoadHostKey(id uint) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[id], nil
+}
+
+func (s *fakeHostKeyStore) SaveHostKey(id uint, key, _, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = key
+	s.sources[id] = source
+	delete(s.pending, id)
+	return nil
+}
+
+func (s *fakeHostKeyStore) RecordHostKeyMismatch(id uint, key, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[id] = key
+	return nil
+}
+
+func (s *fakeHostKeyStore) DeleteHostKey(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	delete(s.sources, id)
+	delete(s.pending, id)
+	return nil
+}
+
+func authorizedKey(k ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+}
+
+func TestHostKeys_PinSurvivesManagerRestart(t *testing.T) {
+	store := newFakeHostKeyStore()
+
+	mgr1, signer, ts1 := newTestManagerWithPublicKey(t)
+	defer ts1.cleanup()
+	mgr1.SetHostKeyStore(store)
+	host1, port1 := parseHostPort(t, ts1.addr)
+	if _, err := mgr1.Connect(context.Background(), 1, host1, port1); err != nil {
+		t.Fatalf("first Connect() error: %v", err)
+	}
+	mgr1.CloseAll()
+
+	if got := store.keys[1]; got != authorizedKey(ts1.hostKey) {
+		t.Fatalf("stored key = %q, want %q", got, authorizedKey(ts1.hostKey))
+	}
+	if store.sources[1] != HostKeySourceTOFU {
+		t.Errorf("source = %q, want %q", store.sources[1], HostKeySourceTOFU)
+	}
+
+	// A fresh manager (control-plane restart) must still reject a different key.
+	mgr2 := NewSSHManager(signer, "")
+	mgr2.SetHostKeyStore(store)
+	defer mgr2.CloseAll()
+
+	var mismatches int
+	mgr2.OnEvent(func(e ConnectionEvent) {
+		if e.Type == EventHostKeyMismatch {
+			mismatches++
+		}
+	})
+
+	ts2 := testSSHServer(t, signer.PublicKey())
+	defer ts2.cleanup()
+	host2, port2 := parseHostPort(t, ts2.addr)
+	_, err := mgr2.Connect(context.Background(), 1, host2, port2)
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("Connect() error = %v, want ErrHostKeyMismatch", err)
+	}
+	if mismatches != 1 {
+		t.Errorf("mismatch events = %d, want 1", mismatches)
+	}
+	if got := store.pending[1]; got != authorizedKey(ts2.hostKey) {
+		t.Errorf("pending key = %q, want the rejected key", got)
+	}
+	if store.keys[1] != authorizedKey(ts1.hostKey) {
+		t.Error("pinned key must not change on mismatch")
+	}
+
+	// The original server is still accepted from the persisted pin.
+	if _, err := mgr2.Connect(context.Background(), 1, host1, port1); err != nil {
+		t.Fatalf("Connect() to pinned server error: %v", err)
+	}
+}
+
+func TestHostKeys_AdminAcceptReplacesPin(t *testing.T) {
+	store := newFakeHostKeyStore()
+	mgr, signer, ts1 := newTestManagerWithPublicKey(t)
+	defer ts1.cleanup()
+	defer mgr.CloseAll()
+	mgr.SetHostKeyStore(store)
+
+	host1, port1 := parseHostPort(t, ts1.addr)
+	if _, err := mgr.Connect(context.Background(), 1, host1, port1); err != nil {
+		t.Fatalf("first Connect() error: %v", err)
+	}
+	mgr.Close(1)
+
+	ts2 := testSSHServer(t, signer.PublicKey())
+	defer ts2.cleanup()
+	host2, port2 := parseHostPort(t, ts2.addr)
+
+	if err := mgr.SetHostKey(1, ts2.hostKey, HostKeySourceAdmin); err != nil {
+		t.Fatalf("SetHostKey() error: %v", err)
+	}
+	if store.sources[1] != HostKeySourceAdmin {
+		t.Errorf("source = %q, want %q", store.sources[1], HostKeySourceAdmin)
+	}
+	if _, err := mgr.Connect(context.Background(), 1, host2, port2); err != nil {
+		t.Fatalf("Connect() after accepting new key error: %v", err)
+	}
+}
+
+func TestHostKeys_OrchestratorConfirmsChangedKey(t *testing.T) {
+	store := newFakeHostKeyStore()
+	mgr, signer, ts1 := newTestManagerWithPublicKey(t)
+	defer ts1.cleanup()
+	defer mgr.CloseAll()
+	mgr.SetHostKeyStore(store)
+
+	host1, port1 := parseHostPort(t, ts1.addr)
+	orch := &mockOrchestrator{sshHost: host1, sshPort: port1, hostKeys: []string{authorizedKey(ts1.hostKey)}}
+	if _, err := mgr.EnsureConnected(context.Background(), 1, orch); err != nil {
+		t.Fatalf("EnsureConnected() error: %v", err)
+	}
+	if store.sources[1] != HostKeySourceOrchestrator {
+		t.Errorf("source = %q, want %q (pinned before first dial)", store.sources[1], HostKeySourceOrchestrator)
+	}
+	mgr.Close(1)
+
+	// The container is recreated with a new key; the orchestrator vouches for it.
+	ts2 := testSSHServer(t, signer.PublicKey())
+	defer ts2.cleanup()
+	host2, port2 := parseHostPort(t, ts2.addr)
+	orch.sshHost, orch.sshPort = host2, port2
+	orch.hostKeys = []string{authorizedKey(ts2.hostKey)}
+
+	if _, err := mgr.EnsureConnected(context.Background(), 1, orch); err != nil {
+		t.Fatalf("EnsureConnected() after key change error: %v", err)
+	}
+	if store.keys[1] != authorizedKey(ts2.hostKey) {
+		t.Error("confirmed key was not re-pinned")
+	}
+}
+
+func TestHostKeys_RejectsKeyNotListedByOrchestrator(t *testing.T) {
+	store := newFakeHostKeyStore()
+	mgr, signer, ts := newTestManagerWithPublicKey(t)
+	defer ts.cleanup()
+	defer mgr.CloseAll()
+	mgr.SetHostKeyStore(store)
+
+	// The orchestrator reports a key other than the one on the wire.
+	other := testSSHServer(t, signer.PublicKey())
+	other.cleanup()
+
+	host, port := parseHostPort(t, ts.addr)
+	orch := &mockOrchestrator{sshHost: host, sshPort: port, hostKeys: []string{authorizedKey(other.hostKey)}}
+	_, err := mgr.EnsureConnected(context.Background(), 1, orch)
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Fatalf("EnsureConnected() error = %v, want ErrHostKeyMismatch", err)
+	}
+}
+
+func TestHostKeyAlgorithmsFor(t *testing.T) {
+	if got := hostKeyAlgorithmsFor(nil); got != nil {
+		t.Errorf("nil key: got %v, want nil", got)
+	}
+	_, ts := newTestSignerAndServer(t)
+	defer ts.cleanup()
+	want := ts.hostKey.Type()
+	if want == ssh.KeyAlgoRSA {
+		want = ssh.KeyAlgoRSASHA512
+	}
+	if got := hostKeyAlgorithmsFor(ts.hostKey); len(got) == 0 || got[0] != want {
+		t.Errorf("algorithms = %v for %s key, want %s first", got, ts.hostKey.Type(), want)
+	}
+}
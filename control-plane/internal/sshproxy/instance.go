@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
 )
 
 // Instance represents an active connection to a running OpenClaw agent.
@@ -46,5 +48,14 @@ func (i *SSHInstance) ExecOpenclaw(ctx context.Context, args ...string) (string,
 		parts[j+1] = ShellQuote(a)
 	}
 	cmd := "su - claworc -c " + ShellQuote(strings.Join(parts, " "))
-	return RunCommand(i.client, cmd)
+	// Only the openclaw subcommand is recorded; arguments may carry config
+	// values or secrets.
+	var sub string
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	ctx, span := tracing.Start(ctx, "openclaw "+sub)
+	stdout, stderr, code, err := RunCommandContext(ctx, i.client, cmd)
+	tracing.End(span, err)
+	return stdout, stderr, code, err
 }
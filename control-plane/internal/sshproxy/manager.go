@@ -63,6 +63,7 @@ type SSHManager struct {
 	orch           Orchestrator                // orchestrator for reconnection key upload and address lookup
 	eventListeners []EventListener             // connection state change listeners
 	reconnecting   map[uint]context.CancelFunc // active reconnection goroutines, keyed by instance ID
+	permitOpen     PermitOpenFunc              // extra sshd PermitOpen ports per instance (see permitopen.go)
 
 	// Connection state tracking (has its own mutex)
 	stateTracker *stateTracker
@@ -73,10 +74,11 @@ type SSHManager struct {
 	// Connection rate limiter (has its own mutex)
 	rateLimiter *RateLimiter
 
-	// Host key store for Trust On First Use (TOFU) verification.
-	// Maps instance ID to the host key seen on first connection.
-	hostKeyMu sync.RWMutex
-	hostKeys  map[uint]ssh.PublicKey
+	// Pinned host keys (see hostkeys.go). hostKeys caches pins by instance
+	// ID; hostKeyStore, when set, persists them across restarts.
+	hostKeyMu    sync.RWMutex
+	hostKeys     map[uint]ssh.PublicKey
+	hostKeyStore HostKeyStore
 }
 
 // managedConn wraps an SSH client with its cancel function for stopping keepalive.
@@ -93,50 +95,6 @@ func (m *SSHManager) getSigner() ssh.Signer {
 	return m.signer
 }
 
-// hostKeyCallback returns a Trust On First Use (TOFU) host key callback for the
-// given instance. On first connection, the host key is stored. On subsequent
-// connections, the stored key must match the previously seen key. A mismatch
-// returns an error — callers must call ClearHostKey before reconnecting to an
-// instance whose host key has legitimately changed (e.g., container restart).
-func (m *SSHManager) hostKeyCallback(instanceID uint) ssh.HostKeyCallback {
-	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		m.hostKeyMu.RLock()
-		known, exists := m.hostKeys[instanceID]
-		m.hostKeyMu.RUnlock()
-
-		if !exists {
-			m.hostKeyMu.Lock()
-			// Double-check after acquiring write lock.
-			if known2, exists2 := m.hostKeys[instanceID]; exists2 {
-				m.hostKeyMu.Unlock()
-				if string(known2.Marshal()) != string(key.Marshal()) {
-					return fmt.Errorf("host key mismatch for instance %d: expected %s, got %s",
-						instanceID, ssh.FingerprintSHA256(known2), ssh.FingerprintSHA256(key))
-				}
-				return nil
-			}
-			m.hostKeys[instanceID] = key
-			log.Printf("[ssh] Stored host key for instance %d (%s %s)",
-				instanceID, key.Type(), ssh.FingerprintSHA256(key))
-			m.hostKeyMu.Unlock()
-			return nil
-		}
-
-		if string(known.Marshal()) != string(key.Marshal()) {
-			return fmt.Errorf("host key mismatch for instance %d: expected %s, got %s",
-				instanceID, ssh.FingerprintSHA256(known), ssh.FingerprintSHA256(key))
-		}
-		return nil
-	}
-}
-
-// ClearHostKey removes the stored host key for an instance (e.g., when it is deleted).
-func (m *SSHManager) ClearHostKey(instanceID uint) {
-	m.hostKeyMu.Lock()
-	delete(m.hostKeys, instanceID)
-	m.hostKeyMu.Unlock()
-}
-
 // getPublicKey returns the current public key string, safe for concurrent use during key rotation.
 func (m *SSHManager) getPublicKey() string {
 	m.keyMu.RLock()
@@ -181,6 +139,12 @@ func (m *SSHManager) RateLimiter() *RateLimiter {
 // Connection attempts are subject to rate limiting: max 10 attempts per minute
 // per instance, and temporary blocking after 5 consecutive failures.
 func (m *SSHManager) Connect(ctx context.Context, instanceID uint, host string, port int) (*ssh.Client, error) {
+	return m.connect(ctx, instanceID, host, port, nil)
+}
+
+// connect is Connect with the orchestrator used to verify a changed host
+// key; nil falls back to the one set by SetOrchestrator.
+func (m *SSHManager) connect(ctx context.Context, instanceID uint, host string, port int, orch Orchestrator) (*ssh.Client, error) {
 	// Check rate limit before attempting connection.
 	if err := m.rateLimiter.Allow(instanceID); err != nil {
 		return nil, err
@@ -191,42 +155,33 @@ func (m *SSHManager) Connect(ctx context.Context, instanceID uint, host string,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(m.getSigner()),
 		},
-		HostKeyCallback: m.hostKeyCallback(instanceID),
-		Timeout:         connectTimeout,
-	}
-
-	// If reconnecting (existing entry in conns), clear the stored host key
-	// because the container may have restarted with a new host key.
-	m.mu.RLock()
-	_, hadExisting := m.conns[instanceID]
-	m.mu.RUnlock()
-	if hadExisting {
-		m.ClearHostKey(instanceID)
+		HostKeyCallback:   m.hostKeyCallback(ctx, instanceID, orch),
+		HostKeyAlgorithms: hostKeyAlgorithmsFor(m.knownHostKey(instanceID)),
+		Timeout:           connectTimeout,
 	}
 
 	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
 
 	m.stateTracker.setState(instanceID, StateConnecting, fmt.Sprintf("connecting to %s", addr))
 
-	// Use context for connection timeout
-	dialer := net.Dialer{Timeout: connectTimeout}
-	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	client, err := dialSSH(ctx, addr, cfg)
 	if err != nil {
 		m.rateLimiter.RecordFailure(instanceID)
-		m.stateTracker.setState(instanceID, StateDisconnected, fmt.Sprintf("dial failed: %v", err))
-		return nil, fmt.Errorf("dial %s: %w", addr, err)
+		m.stateTracker.setState(instanceID, StateDisconnected, err.Error())
+		return nil, err
 	}
 
-	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, cfg)
-	if err != nil {
-		netConn.Close()
-		m.rateLimiter.RecordFailure(instanceID)
-		m.stateTracker.setState(instanceID, StateDisconnected, fmt.Sprintf("ssh handshake failed: %v", err))
-		return nil, fmt.Errorf("ssh handshake with %s: %w", addr, err)
+	// A changed PermitOpen list only applies to connections authenticated
+	// after sshd reloads, so replace this one.
+	if m.applyPermitOpen(instanceID, client) {
+		client.Close()
+		if client, err = redialAfterReload(ctx, addr, cfg); err != nil {
+			m.rateLimiter.RecordFailure(instanceID)
+			m.stateTracker.setState(instanceID, StateDisconnected, err.Error())
+			return nil, err
+		}
 	}
 
-	client := ssh.NewClient(sshConn, chans, reqs)
-
 	// Connection succeeded — reset failure counters.
 	m.rateLimiter.RecordSuccess(instanceID)
 
@@ -256,6 +211,23 @@ func (m *SSHManager) Connect(ctx context.Context, instanceID uint, host string,
 	return client, nil
 }
 
+// dialSSH opens a TCP connection to addr and completes the SSH handshake.
+func dialSSH(ctx context.Context, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	// Use context for connection timeout
+	dialer := net.Dialer{Timeout: connectTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, cfg)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s: %w", addr, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
 // GetConnection returns an existing SSH connection for the given instance ID.
 // Returns the client and true if found, nil and false otherwise.
 func (m *SSHManager) GetConnection(instanceID uint) (*ssh.Client, bool) {
@@ -373,8 +345,11 @@ func (m *SSHManager) EnsureConnectedWithIPCheck(ctx context.Context, instanceID
 		return nil, fmt.Errorf("configure ssh access for instance %d: %w", instanceID, err)
 	}
 
-	// 5. Establish SSH connection
-	client, err := m.Connect(ctx, instanceID, host, port)
+	// 5. Pin the host key through the orchestrator before the first dial
+	m.pinFromOrchestrator(ctx, instanceID, orch)
+
+	// 6. Establish SSH connection
+	client, err := m.connect(ctx, instanceID, host, port, orch)
 	if err != nil {
 		return nil, fmt.Errorf("ssh connect to instance %d: %w", instanceID, err)
 	}
@@ -15,6 +15,7 @@ import (
 type testServer struct {
 	addr    string
 	cleanup func()
+	hostKey ssh.PublicKey
 
 	mu       sync.Mutex
 	netConns []net.Conn
@@ -59,7 +60,8 @@ func testSSHServer(t *testing.T, authorizedKey ssh.PublicKey) *testServer {
 	}
 
 	ts := &testServer{
-		addr: listener.Addr().String(),
+		addr:    listener.Addr().String(),
+		hostKey: hostSigner.PublicKey(),
 	}
 
 	done := make(chan struct{})
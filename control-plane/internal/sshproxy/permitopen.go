@@ -0,0 +1,165 @@
+// permitopen.go keeps the agent sshd's PermitOpen list in step with the
+// loopback ports an admin allows for SSH gateway `ssh -L` forwards.
+//
+// The agent's claworc.conf permits only the targets the control plane's own
+// tunnels use (BasePermitOpen) and includes PermitOpenFile just before that
+// directive. sshd keeps the first PermitOpen it reads, so when an instance
+// has forward ports the control plane writes the full list (the base
+// targets plus those ports) to PermitOpenFile and sends sshd a SIGHUP.
+// A connection's options are fixed when it authenticates, so the manager
+// reconnects once after the list changes.
+
+package sshproxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PermitOpenFile is the sshd config fragment the control plane manages.
+const PermitOpenFile = "/etc/ssh/claworc-permitopen.conf"
+
+// BasePermitOpen mirrors the PermitOpen directive in the agent's
+// claworc.conf: the Control UI, the gateway and the CDP port.
+var BasePermitOpen = []string{
+	"localhost:3000", "localhost:18789", "127.0.0.1:3000",
+	"127.0.0.1:18789", "localhost:9222", "127.0.0.1:9222",
+}
+
+const (
+	// permitOpenRedialAttempts bounds how long connect waits for sshd to
+	// re-exec after a SIGHUP.
+	permitOpenRedialAttempts = 10
+	permitOpenRedialDelay    = 200 * time.Millisecond
+)
+
+// PermitOpenFunc returns the loopback ports sshd should permit for an
+// instance in addition to BasePermitOpen.
+type PermitOpenFunc func(instanceID uint) []uint16
+
+// SetPermitOpen installs the source of each instance's extra forward
+// ports. Without one, the agent's static PermitOpen list is left alone.
+func (m *SSHManager) SetPermitOpen(fn PermitOpenFunc) {
+	m.reconnMu.Lock()
+	defer m.reconnMu.Unlock()
+	m.permitOpen = fn
+}
+
+func (m *SSHManager) permitOpenFunc() PermitOpenFunc {
+	m.reconnMu.RLock()
+	defer m.reconnMu.RUnlock()
+	return m.permitOpen
+}
+
+// permitOpenTargets returns the PermitOpen targets for the given extra
+// ports, or nil when there are none and the static list applies.
+func permitOpenTargets(ports []uint16) []string {
+	if len(ports) == 0 {
+		return nil
+	}
+	targets := append([]string(nil), BasePermitOpen...)
+	seen := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		seen[t] = true
+	}
+	for _, p := range ports {
+		port := strconv.Itoa(int(p))
+		for _, host := range []string{"localhost", "127.0.0.1", "[::1]"} {
+			if t := host + ":" + port; !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets
+}
+
+// permitOpenScript writes (or removes) PermitOpenFile when it differs from
+// targets and, only then, signals the sshd listener and prints "changed".
+func permitOpenScript(targets []string) string {
+	f := shellQuote(PermitOpenFile)
+	reload := "pkill -HUP -o -x sshd && echo changed"
+	if len(targets) == 0 {
+		return fmt.Sprintf("[ -e %s ] || exit 0; rm -f %s && %s", f, f, reload)
+	}
+	content := shellQuote("# Managed by the Claworc control plane (SSH gateway forward ports).\n" +
+		"PermitOpen " + strings.Join(targets, " "))
+	return fmt.Sprintf(`[ "$(cat %s 2>/dev/null)" = %s ] && exit 0; printf '%%s\n' %s > %s && %s`,
+		f, content, content, f, reload)
+}
+
+// syncPermitOpen brings the agent's PermitOpenFile in line with ports and
+// reports whether sshd was told to reload.
+func syncPermitOpen(client *ssh.Client, ports []uint16) (bool, error) {
+	stdout, stderr, code, err := executeCommand(client, permitOpenScript(permitOpenTargets(ports)))
+	if err != nil {
+		return false, fmt.Errorf("sync sshd PermitOpen: %w", err)
+	}
+	if code != 0 {
+		return false, fmt.Errorf("sync sshd PermitOpen: exit %d: %s", code, strings.TrimSpace(stderr))
+	}
+	return strings.TrimSpace(stdout) == "changed", nil
+}
+
+// applyPermitOpen syncs the instance's PermitOpen list over a freshly
+// authenticated client and reports whether the client must be replaced.
+func (m *SSHManager) applyPermitOpen(instanceID uint, client *ssh.Client) bool {
+	fn := m.permitOpenFunc()
+	if fn == nil {
+		return false
+	}
+	changed, err := syncPermitOpen(client, fn(instanceID))
+	if err != nil {
+		log.Printf("SSH: instance %d: %v", instanceID, err)
+		return false
+	}
+	if changed {
+		log.Printf("SSH: updated sshd PermitOpen on instance %d; reconnecting", instanceID)
+	}
+	return changed
+}
+
+// redialAfterReload reconnects once sshd has re-executed with the new
+// PermitOpen list.
+func redialAfterReload(ctx context.Context, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	var lastErr error
+	for attempt := 0; attempt < permitOpenRedialAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(permitOpenRedialDelay):
+		}
+		client, err := dialSSH(ctx, addr, cfg)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("reconnect after sshd reload: %w", lastErr)
+}
+
+// RefreshPermitOpen re-syncs the PermitOpen list of a connected instance,
+// e.g. after its forward ports changed, and reconnects in the background
+// when sshd reloaded. It is a no-op for instances without a connection;
+// their list is synced when they next connect.
+func (m *SSHManager) RefreshPermitOpen(instanceID uint) error {
+	fn := m.permitOpenFunc()
+	client, ok := m.GetConnection(instanceID)
+	if fn == nil || !ok {
+		return nil
+	}
+	changed, err := syncPermitOpen(client, fn(instanceID))
+	if err != nil {
+		return err
+	}
+	if changed {
+		m.triggerReconnect(instanceID, "sshd PermitOpen changed")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package sshproxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPermitOpenTargets(t *testing.T) {
+	if got := permitOpenTargets(nil); got != nil {
+		t.Errorf("no ports: targets = %v, want nil (static list applies)", got)
+	}
+
+	got := permitOpenTargets([]uint16{3000, 5173})
+	want := append(append([]string(nil), BasePermitOpen...),
+		"[::1]:3000", "localhost:5173", "127.0.0.1:5173", "[::1]:5173")
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+	for _, tok := range got {
+		host := tok[:strings.LastIndex(tok, ":")]
+		if host != "localhost" && host != "127.0.0.1" && host != "[::1]" || strings.Contains(tok, "*") {
+			t.Errorf("SECURITY: target %q is not a single loopback port", tok)
+		}
+	}
+}
+
+func TestPermitOpenScript(t *testing.T) {
+	write := permitOpenScript(permitOpenTargets([]uint16{5173}))
+	if !strings.Contains(write, "PermitOpen "+strings.Join(BasePermitOpen, " ")+" localhost:5173 127.0.0.1:5173 [::1]:5173") {
+		t.Errorf("write script lacks the PermitOpen line: %s", write)
+	}
+	remove := permitOpenScript(nil)
+	if !strings.Contains(remove, "rm -f '"+PermitOpenFile+"'") || strings.Contains(remove, "PermitOpen ") {
+		t.Errorf("remove script = %s", remove)
+	}
+	for _, script := range []string{write, remove} {
+		if !strings.HasSuffix(script, "pkill -HUP -o -x sshd && echo changed") {
+			t.Errorf("script does not reload sshd last: %s", script)
+		}
+	}
+}
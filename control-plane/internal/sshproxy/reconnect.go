@@ -129,12 +129,6 @@ func (m *SSHManager) reconnectWithBackoff(ctx context.Context, instanceID uint,
 
 		log.Printf("SSH reconnect attempt %d/%d for instance %d", attempt, maxRetries, instanceID)
 
-		// Clear the stored host key before each attempt. During a Kubernetes rolling
-		// update, GetSSHAddress may briefly return the old (terminating) pod, whose
-		// SSH key gets stored. Clearing before every attempt ensures a stale key from
-		// a failed attempt never blocks the next one.
-		m.ClearHostKey(instanceID)
-
 		// Re-upload the global public key before each attempt
 		// (agent may have restarted, losing authorized_keys)
 		if err := orch.ConfigureSSHAccess(ctx, instanceID, m.getPublicKey()); err != nil {
@@ -159,8 +153,11 @@ func (m *SSHManager) reconnectWithBackoff(ctx context.Context, instanceID uint,
 				lastErr = fmt.Errorf("get ssh address (attempt %d): %w", attempt, err)
 				log.Printf("SSH address lookup failed for instance %d (attempt %d): %v", instanceID, attempt, err)
 			} else {
-				// Attempt SSH connection
-				_, err = m.Connect(ctx, instanceID, host, port)
+				// Attempt SSH connection. The pinned host key is kept: a
+				// restarted container with a new key is re-pinned only once
+				// the orchestrator confirms it (see hostkeys.go).
+				m.pinFromOrchestrator(ctx, instanceID, orch)
+				_, err = m.connect(ctx, instanceID, host, port, orch)
 				if err != nil {
 					lastErr = fmt.Errorf("connect (attempt %d): %w", attempt, err)
 					log.Printf("SSH connect failed for instance %d (attempt %d): %v", instanceID, attempt, err)
@@ -337,9 +337,10 @@ func TestReconnectWithBackoff_EventEmission(t *testing.T) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Expect: Reconnecting → KeyUploaded → Reconnected
-	if len(events) != 3 {
-		t.Fatalf("expected 3 events, got %d: %v", len(events), eventTypes(events))
+	// Expect: Reconnecting → KeyUploaded → HostKeyPinned → Reconnected
+	// (the host key is pinned on first use during the handshake).
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d: %v", len(events), eventTypes(events))
 	}
 	if events[0].Type != EventReconnecting {
 		t.Errorf("event[0] = %s, want %s", events[0].Type, EventReconnecting)
@@ -347,8 +348,11 @@ func TestReconnectWithBackoff_EventEmission(t *testing.T) {
 	if events[1].Type != EventKeyUploaded {
 		t.Errorf("event[1] = %s, want %s", events[1].Type, EventKeyUploaded)
 	}
-	if events[2].Type != EventReconnected {
-		t.Errorf("event[2] = %s, want %s", events[2].Type, EventReconnected)
+	if events[2].Type != EventHostKeyPinned {
+		t.Errorf("event[2] = %s, want %s", events[2].Type, EventHostKeyPinned)
+	}
+	if events[3].Type != EventReconnected {
+		t.Errorf("event[3] = %s, want %s", events[3].Type, EventReconnected)
 	}
 
 	// Verify instance ID on all events
@@ -20,6 +20,8 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // --- Test Infrastructure for Resilience Tests ---
@@ -34,6 +36,22 @@ type dynamicOrch struct {
 	configureErr   error
 	getAddrErr     error
 	configureCalls int
+	hostKey        ssh.PublicKey // reported by ReadSSHHostKeys when set
+}
+
+func (o *dynamicOrch) ReadSSHHostKeys(_ context.Context, _ uint) ([]string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.hostKey == nil {
+		return nil, fmt.Errorf("no host key")
+	}
+	return []string{string(ssh.MarshalAuthorizedKey(o.hostKey))}, nil
+}
+
+func (o *dynamicOrch) setHostKey(key ssh.PublicKey) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hostKey = key
 }
 
 func (o *dynamicOrch) ConfigureSSHAccess(_ context.Context, _ uint, _ string) error {
@@ -88,6 +106,16 @@ func (o *multiInstanceOrch) ConfigureSSHAccess(ctx context.Context, instanceID u
 	return inst.ConfigureSSHAccess(ctx, instanceID, publicKey)
 }
 
+func (o *multiInstanceOrch) ReadSSHHostKeys(ctx context.Context, instanceID uint) ([]string, error) {
+	o.mu.Lock()
+	inst, ok := o.instances[instanceID]
+	o.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown instance %d", instanceID)
+	}
+	return inst.ReadSSHHostKeys(ctx, instanceID)
+}
+
 func (o *multiInstanceOrch) GetSSHAddress(ctx context.Context, instanceID uint) (string, int, error) {
 	o.mu.Lock()
 	inst, ok := o.instances[instanceID]
@@ -154,6 +182,7 @@ func TestResilience_AgentRestart(t *testing.T) {
 	defer ts2.cleanup()
 	host2, port2 := parseHostPort(t, ts2.addr)
 	orch.setTarget(host2, port2)
+	orch.setHostKey(ts2.hostKey) // the restarted container's new host key
 
 	// Phase 4: Reconnect (key is re-uploaded before each attempt)
 	err = mgr.ReconnectWithBackoff(context.Background(), 1, 5, "agent restart")
@@ -266,6 +295,7 @@ func TestResilience_NetworkPartitionWithTunnels(t *testing.T) {
 	defer ts2.cleanup()
 	host2, port2 := parseHostPort(t, ts2.addr)
 	orch.setTarget(host2, port2)
+	orch.setHostKey(ts2.hostKey)
 
 	// Reconnect
 	err = mgr.ReconnectWithBackoff(context.Background(), 1, 5, "network restored")
@@ -422,7 +452,7 @@ func TestResilience_SimultaneousMultipleFailures(t *testing.T) {
 		ts := startTestSSHServerForTunnel(t, signer.PublicKey())
 		defer ts.cleanup()
 		host, port := parseHostPort(t, ts.addr)
-		multiOrch.setInstance(uint(i+1), &dynamicOrch{host: host, port: port})
+		multiOrch.setInstance(uint(i+1), &dynamicOrch{host: host, port: port, hostKey: ts.hostKey})
 	}
 
 	// Reconnect all instances concurrently
@@ -682,6 +712,7 @@ func TestResilience_StateTransitionsAcrossFailures(t *testing.T) {
 	if err != nil {
 		t.Fatalf("connect: %v", err)
 	}
+	orch.setHostKey(ts2.hostKey) // the replacement's key, confirmed out of band
 
 	state := mgr.GetConnectionState(1)
 	if state != StateConnected {
@@ -754,6 +785,7 @@ func TestResilience_HealthCheckTriggersReconnect(t *testing.T) {
 	if err != nil {
 		t.Fatalf("connect: %v", err)
 	}
+	orch.setHostKey(ts2.hostKey) // the replacement's key, confirmed out of band
 
 	// Track reconnection success
 	var reconnected int32
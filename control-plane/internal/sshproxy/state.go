@@ -178,6 +178,17 @@ func (st *stateTracker) onStateChange(cb StateChangeCallback) {
 	st.callbacks = append(st.callbacks, cb)
 }
 
+// all returns the current state of every tracked instance.
+func (st *stateTracker) all() map[uint]ConnectionState {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	result := make(map[uint]ConnectionState, len(st.states))
+	for id, entry := range st.states {
+		result[id] = entry.current
+	}
+	return result
+}
+
 // remove deletes all state tracking for an instance.
 func (st *stateTracker) remove(instanceID uint) {
 	st.mu.Lock()
@@ -191,6 +202,12 @@ func (m *SSHManager) GetConnectionState(instanceID uint) ConnectionState {
 	return m.stateTracker.getState(instanceID)
 }
 
+// GetAllConnectionStates returns the current connection state of every
+// instance the manager has tracked.
+func (m *SSHManager) GetAllConnectionStates() map[uint]ConnectionState {
+	return m.stateTracker.all()
+}
+
 // SetConnectionState updates the connection state for an instance.
 // Triggers registered state change callbacks and records the transition.
 func (m *SSHManager) SetConnectionState(instanceID uint, state ConnectionState, reason string) {
@@ -236,8 +236,14 @@ func (tm *TunnelManager) agentListenerLoopDial(ctx context.Context, tunnel *Acti
 			}
 			defer local.Close()
 			done := make(chan struct{}, 2)
-			go func() { io.Copy(local, remote); done <- struct{}{} }()
-			go func() { io.Copy(remote, local); done <- struct{}{} }()
+			go func() {
+				io.Copy(&meteredWriter{w: local, m: tunnel.metrics}, remote)
+				done <- struct{}{}
+			}()
+			go func() {
+				io.Copy(&meteredWriter{w: remote, m: tunnel.metrics, toInstance: true}, local)
+				done <- struct{}{}
+			}()
 			<-done
 		}(conn)
 	}
@@ -627,12 +633,12 @@ func (tm *TunnelManager) forwardConnection(ctx context.Context, localConn net.Co
 	done := make(chan struct{}, 2)
 
 	go func() {
-		io.Copy(remoteConn, localConn)
+		io.Copy(&meteredWriter{w: remoteConn, m: tunnel.metrics, toInstance: true}, localConn)
 		done <- struct{}{}
 	}()
 
 	go func() {
-		io.Copy(localConn, remoteConn)
+		io.Copy(&meteredWriter{w: localConn, m: tunnel.metrics}, remoteConn)
 		done <- struct{}{}
 	}()
 
@@ -15,6 +15,7 @@ package sshproxy
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -34,6 +35,9 @@ type TunnelMetrics struct {
 	LastHealthCheck  time.Time `json:"last_health_check"`
 	SuccessfulChecks int64     `json:"successful_checks"`
 	FailedChecks     int64     `json:"failed_checks"`
+	// Bytes forwarded through the tunnel, by direction.
+	BytesToInstance   int64 `json:"bytes_to_instance"`
+	BytesFromInstance int64 `json:"bytes_from_instance"`
 }
 
 // Snapshot returns an immutable copy of the metrics.
@@ -41,10 +45,12 @@ func (m *TunnelMetrics) Snapshot() TunnelMetrics {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return TunnelMetrics{
-		CreatedAt:        m.CreatedAt,
-		LastHealthCheck:  m.LastHealthCheck,
-		SuccessfulChecks: m.SuccessfulChecks,
-		FailedChecks:     m.FailedChecks,
+		CreatedAt:         m.CreatedAt,
+		LastHealthCheck:   m.LastHealthCheck,
+		SuccessfulChecks:  m.SuccessfulChecks,
+		FailedChecks:      m.FailedChecks,
+		BytesToInstance:   m.BytesToInstance,
+		BytesFromInstance: m.BytesFromInstance,
 	}
 }
 
@@ -72,6 +78,31 @@ func (m *TunnelMetrics) recordFailure() {
 	m.FailedChecks++
 }
 
+func (m *TunnelMetrics) addBytes(toInstance bool, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if toInstance {
+		m.BytesToInstance += int64(n)
+	} else {
+		m.BytesFromInstance += int64(n)
+	}
+}
+
+// meteredWriter counts the bytes written through it into a tunnel's metrics.
+type meteredWriter struct {
+	w          io.Writer
+	m          *TunnelMetrics
+	toInstance bool
+}
+
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	if mw.m != nil && n > 0 {
+		mw.m.addBytes(mw.toInstance, n)
+	}
+	return n, err
+}
+
 // TunnelMetricsSnapshot is an immutable snapshot of tunnel metrics for external consumption.
 type TunnelMetricsSnapshot struct {
 	Label             string        `json:"label"`
@@ -84,6 +115,8 @@ type TunnelMetricsSnapshot struct {
 	FailedChecks      int64         `json:"failed_checks"`
 	Uptime            time.Duration `json:"uptime"`
 	ReconnectionCount int64         `json:"reconnection_count"`
+	BytesToInstance   int64         `json:"bytes_to_instance"`
+	BytesFromInstance int64         `json:"bytes_from_instance"`
 }
 
 // CheckTunnelHealth verifies that a specific tunnel is functional by attempting
@@ -276,6 +309,8 @@ func (tm *TunnelManager) GetTunnelMetrics(instanceID uint) []TunnelMetricsSnapsh
 			FailedChecks:      snap.FailedChecks,
 			Uptime:            uptime,
 			ReconnectionCount: reconnCount,
+			BytesToInstance:   snap.BytesToInstance,
+			BytesFromInstance: snap.BytesFromInstance,
 		}
 	}
 	return result
@@ -310,6 +345,8 @@ func (tm *TunnelManager) GetAllTunnelMetrics() map[uint][]TunnelMetricsSnapshot
 				FailedChecks:      snap.FailedChecks,
 				Uptime:            uptime,
 				ReconnectionCount: reconnCount,
+				BytesToInstance:   snap.BytesToInstance,
+				BytesFromInstance: snap.BytesFromInstance,
 			}
 		}
 		result[id] = snapshots
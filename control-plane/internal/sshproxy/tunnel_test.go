@@ -41,7 +41,8 @@ func startTestSSHServerForTunnel(t *testing.T, authorizedKey ssh.PublicKey) *tes
 	}
 
 	ts := &testServer{
-		addr: listener.Addr().String(),
+		addr:    listener.Addr().String(),
+		hostKey: hostSigner.PublicKey(),
 	}
 
 	done := make(chan struct{})
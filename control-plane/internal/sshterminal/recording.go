@@ -0,0 +1,437 @@
+package sshterminal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recording sources: the dashboard web terminal and the inbound SSH gateway.
+const (
+	RecordingSourceTerminal = "terminal"
+	RecordingSourceGateway  = "gateway"
+)
+
+// ErrRecordingNotFound is returned when a recording ID does not name a
+// recording of the requested instance.
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// recordingIDPattern matches "<source>_<instanceID>_<session>_<YYYYMMDD_HHMMSS>".
+var recordingIDPattern = regexp.MustCompile(`^(terminal|gateway)_([0-9]+)_[0-9a-f]{8}_[0-9]{8}_[0-9]{6}$`)
+
+// RecordingMeta describes who and what a recording belongs to. It is stored
+// in the asciicast header under the "claworc" key; players ignore it.
+type RecordingMeta struct {
+	Source     string `json:"source"`
+	InstanceID uint   `json:"instance_id"`
+	SessionID  string `json:"session_id"`
+	User       string `json:"user,omitempty"`
+	Input      bool   `json:"input"` // whether "i" (keystroke) events are captured
+}
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Claworc   *RecordingMeta    `json:"claworc,omitempty"`
+}
+
+// RecordingInfo is a recording as returned by Recordings.List.
+type RecordingInfo struct {
+	ID string `json:"id"`
+	RecordingMeta
+	Command   string    `json:"command,omitempty"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Size      int64     `json:"size"`
+}
+
+// Recordings stores terminal session recordings as asciicast v2 files
+// (https://docs.asciinema.org/manual/asciicast/v2/) in one directory.
+// A nil *Recordings disables recording: Start returns a nil Recorder and
+// List returns nothing.
+type Recordings struct {
+	dir string
+
+	// CaptureInput reports whether keystrokes should be recorded as "i"
+	// events. It is consulted when a recording starts; nil means never.
+	CaptureInput func() bool
+}
+
+// NewRecordings returns a store rooted at dir, or nil when dir is empty.
+func NewRecordings(dir string) *Recordings {
+	if dir == "" {
+		return nil
+	}
+	return &Recordings{dir: dir}
+}
+
+// Dir returns the directory recordings are written to.
+func (rs *Recordings) Dir() string {
+	if rs == nil {
+		return ""
+	}
+	return rs.dir
+}
+
+// Start creates a new recording for a session with the given initial
+// terminal size. command is the program started (empty for a login shell).
+func (rs *Recordings) Start(meta RecordingMeta, command string, cols, rows int, env map[string]string) (*Recorder, error) {
+	if rs == nil {
+		return nil, nil
+	}
+	if err := os.MkdirAll(rs.dir, 0750); err != nil {
+		return nil, fmt.Errorf("create recording dir: %w", err)
+	}
+	meta.Input = rs.CaptureInput != nil && rs.CaptureInput()
+
+	start := time.Now()
+	session := strings.ReplaceAll(meta.SessionID, "-", "")
+	if len(session) < 8 {
+		session += strings.Repeat("0", 8-len(session))
+	}
+	id := fmt.Sprintf("%s_%d_%s_%s", meta.Source, meta.InstanceID, strings.ToLower(session[:8]), start.Format("20060102_150405"))
+	f, err := os.OpenFile(filepath.Join(rs.dir, id+".cast"), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("open recording file: %w", err)
+	}
+
+	title := fmt.Sprintf("%s session on instance %d", meta.Source, meta.InstanceID)
+	if meta.User != "" {
+		title += " by " + meta.User
+	}
+	hdr, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: start.Unix(),
+		Command:   command,
+		Title:     title,
+		Env:       env,
+		Claworc:   &meta,
+	})
+	if _, err := f.Write(append(hdr, '\n')); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write recording header: %w", err)
+	}
+	return &Recorder{ID: id, f: f, start: start, input: meta.Input}, nil
+}
+
+// List returns the recordings of an instance, newest first.
+func (rs *Recordings) List(instanceID uint) ([]RecordingInfo, error) {
+	if rs == nil {
+		return nil, nil
+	}
+	var out []RecordingInfo
+	for _, source := range []string{RecordingSourceTerminal, RecordingSourceGateway} {
+		matches, err := filepath.Glob(filepath.Join(rs.dir, fmt.Sprintf("%s_%d_*.cast", source, instanceID)))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			info, err := readRecordingInfo(path)
+			if err != nil {
+				log.Printf("Skipping unreadable recording %s: %v", filepath.Base(path), err)
+				continue
+			}
+			out = append(out, info)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	return out, nil
+}
+
+// Open opens the recording id of an instance for reading.
+func (rs *Recordings) Open(instanceID uint, id string) (*os.File, error) {
+	if rs == nil {
+		return nil, ErrRecordingNotFound
+	}
+	m := recordingIDPattern.FindStringSubmatch(id)
+	if m == nil || m[2] != fmt.Sprint(instanceID) {
+		return nil, ErrRecordingNotFound
+	}
+	f, err := os.Open(filepath.Join(rs.dir, id+".cast"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRecordingNotFound
+	}
+	return f, err
+}
+
+// Prune deletes recordings last written more than maxAge ago.
+func (rs *Recordings) Prune(maxAge time.Duration) (int, error) {
+	if rs == nil {
+		return 0, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(rs.dir, "*.cast"))
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	deleted := 0
+	for _, path := range matches {
+		if !recordingIDPattern.MatchString(strings.TrimSuffix(filepath.Base(path), ".cast")) {
+			continue
+		}
+		st, err := os.Stat(path)
+		if err != nil || !st.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// StartRetentionCleanup prunes recordings older than retentionDays() at
+// startup and then daily until ctx is done. A value <= 0 keeps recordings
+// forever.
+func (rs *Recordings) StartRetentionCleanup(ctx context.Context, retentionDays func() int) {
+	if rs == nil {
+		return
+	}
+	prune := func() {
+		days := retentionDays()
+		if days <= 0 {
+			return
+		}
+		deleted, err := rs.Prune(time.Duration(days) * 24 * time.Hour)
+		if err != nil {
+			log.Printf("Terminal recording retention cleanup error: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Purged %d terminal recordings older than %d days", deleted, days)
+		}
+	}
+	go func() {
+		prune()
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				prune()
+			}
+		}
+	}()
+}
+
+func readRecordingInfo(path string) (RecordingInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return RecordingInfo{}, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return RecordingInfo{}, err
+	}
+	var hdr castHeader
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		return RecordingInfo{}, fmt.Errorf("parse header: %w", err)
+	}
+	info := RecordingInfo{
+		ID:        strings.TrimSuffix(filepath.Base(path), ".cast"),
+		Command:   hdr.Command,
+		Width:     hdr.Width,
+		Height:    hdr.Height,
+		StartedAt: time.Unix(hdr.Timestamp, 0),
+		UpdatedAt: st.ModTime(),
+		Size:      st.Size(),
+	}
+	if hdr.Claworc != nil {
+		info.RecordingMeta = *hdr.Claworc
+	}
+	return info, nil
+}
+
+// Recorder appends timed events to one asciicast v2 recording. All methods
+// are safe for concurrent use and are no-ops on a nil Recorder, so callers
+// need not check whether recording is enabled.
+type Recorder struct {
+	ID string
+
+	mu     sync.Mutex
+	f      *os.File
+	start  time.Time
+	input  bool
+	closed bool
+	// Trailing bytes of an incomplete UTF-8 sequence, per event type, held
+	// back until the rest arrives in the next chunk.
+	partial map[string][]byte
+}
+
+// Output records terminal output.
+func (r *Recorder) Output(p []byte) { r.event("o", p) }
+
+// Input records keystrokes, if input capture was enabled for the recording.
+func (r *Recorder) Input(p []byte) {
+	if r != nil && r.input {
+		r.event("i", p)
+	}
+}
+
+// Resize records a terminal size change.
+func (r *Recorder) Resize(cols, rows int) {
+	if r == nil {
+		return
+	}
+	r.write("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close flushes any held-back bytes and closes the file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	for code, rest := range r.partial {
+		if len(rest) > 0 {
+			r.writeLocked(code, string(rest))
+		}
+	}
+	r.closed = true
+	return r.f.Close()
+}
+
+func (r *Recorder) event(code string, p []byte) {
+	if r == nil || len(p) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	data := append(r.partial[code], p...)
+	complete, rest := splitIncompleteUTF8(data)
+	if r.partial == nil {
+		r.partial = map[string][]byte{}
+	}
+	r.partial[code] = append([]byte(nil), rest...)
+	if len(complete) > 0 {
+		r.writeLocked(code, string(complete))
+	}
+}
+
+func (r *Recorder) write(code, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.writeLocked(code, data)
+	}
+}
+
+func (r *Recorder) writeLocked(code, data string) {
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]interface{}{elapsed, code, data})
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		log.Printf("Terminal recording %s: write failed: %v", r.ID, err)
+	}
+}
+
+// splitIncompleteUTF8 splits b before a trailing, incomplete multi-byte
+// sequence. Invalid bytes elsewhere are left for JSON encoding to replace.
+func splitIncompleteUTF8(b []byte) (complete, rest []byte) {
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i], b[i:]
+			}
+			break
+		}
+	}
+	return b, nil
+}
+
+// Replay copies an asciicast v2 recording from r to w, pacing events by
+// their timestamps so the client sees the session as it happened. speed
+// scales playback (2 = twice as fast); gaps longer than maxIdle are
+// shortened to maxIdle (0 = no limit). flush, if non-nil, is called after
+// every line.
+func Replay(ctx context.Context, r io.Reader, w io.Writer, speed float64, maxIdle time.Duration, flush func()) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	var prev float64
+	first := true
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if first {
+				first = false
+			} else if t, ok := eventTime(line); ok {
+				wait := time.Duration((t - prev) / speed * float64(time.Second))
+				if maxIdle > 0 && wait > maxIdle {
+					wait = maxIdle
+				}
+				prev = t
+				if wait > 0 {
+					timer := time.NewTimer(wait)
+					select {
+					case <-ctx.Done():
+						timer.Stop()
+						return ctx.Err()
+					case <-timer.C:
+					}
+				}
+			}
+			if _, werr := w.Write(line); werr != nil {
+				return werr
+			}
+			if flush != nil {
+				flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// eventTime extracts the timestamp of an asciicast event line.
+func eventTime(line []byte) (float64, bool) {
+	var ev []json.RawMessage
+	if err := json.Unmarshal(line, &ev); err != nil || len(ev) == 0 {
+		return 0, false
+	}
+	var t float64
+	if err := json.Unmarshal(ev[0], &t); err != nil {
+		return 0, false
+	}
+	return t, true
+}
@@ -0,0 +1,140 @@
+package sshterminal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readCast(t *testing.T, path string) (castHeader, [][]interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read recording: %v", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	if !sc.Scan() {
+		t.Fatal("empty recording")
+	}
+	var hdr castHeader
+	if err := json.Unmarshal(sc.Bytes(), &hdr); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	var events [][]interface{}
+	for sc.Scan() {
+		var ev []interface{}
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("event %q: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return hdr, events
+}
+
+func TestRecorderWritesAsciicastV2(t *testing.T) {
+	rs := NewRecordings(t.TempDir())
+	rec, err := rs.Start(RecordingMeta{Source: RecordingSourceGateway, InstanceID: 7, SessionID: "0123abcd-ffff", User: "bob"},
+		"top", 100, 30, map[string]string{"TERM": "xterm"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	rec.Output([]byte("caf\xc3")) // "é" split across two chunks
+	rec.Output([]byte("\xa9\r\n"))
+	rec.Input([]byte("q")) // input capture is off
+	rec.Resize(90, 20)
+	rec.Close()
+	rec.Output([]byte("after close"))
+
+	hdr, events := readCast(t, filepath.Join(rs.Dir(), rec.ID+".cast"))
+	if hdr.Version != 2 || hdr.Width != 100 || hdr.Height != 30 || hdr.Command != "top" || hdr.Env["TERM"] != "xterm" {
+		t.Errorf("header = %+v", hdr)
+	}
+	if hdr.Claworc == nil || hdr.Claworc.User != "bob" || hdr.Claworc.Input {
+		t.Errorf("header meta = %+v", hdr.Claworc)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev[1].(string)+":"+ev[2].(string))
+	}
+	want := []string{"o:caf", "o:\u00e9\r\n", "r:90x20"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(rec.ID, "gateway_7_0123abcd_") {
+		t.Errorf("ID = %q", rec.ID)
+	}
+}
+
+func TestRecordingsOpenScopedToInstance(t *testing.T) {
+	rs := NewRecordings(t.TempDir())
+	rec, _ := rs.Start(RecordingMeta{Source: RecordingSourceTerminal, InstanceID: 3, SessionID: "aaaaaaaa-1"}, "", 80, 24, nil)
+	rec.Close()
+
+	f, err := rs.Open(3, rec.ID)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	f.Close()
+	for _, tc := range []struct {
+		inst uint
+		id   string
+	}{{4, rec.ID}, {3, "../" + rec.ID}, {3, "terminal_3_aaaaaaaa_20200101_000000"}} {
+		if _, err := rs.Open(tc.inst, tc.id); !errors.Is(err, ErrRecordingNotFound) {
+			t.Errorf("Open(%d, %q) err = %v, want not found", tc.inst, tc.id, err)
+		}
+	}
+	if recs, _ := rs.List(4); len(recs) != 0 {
+		t.Errorf("List(4) = %v", recs)
+	}
+}
+
+func TestRecordingsPrune(t *testing.T) {
+	rs := NewRecordings(t.TempDir())
+	old, _ := rs.Start(RecordingMeta{Source: RecordingSourceTerminal, InstanceID: 1, SessionID: "11111111"}, "", 80, 24, nil)
+	old.Close()
+	fresh, _ := rs.Start(RecordingMeta{Source: RecordingSourceGateway, InstanceID: 1, SessionID: "22222222"}, "", 80, 24, nil)
+	fresh.Close()
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(rs.Dir(), old.ID+".cast"), past, past)
+
+	n, err := rs.Prune(24 * time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("Prune = %d, %v; want 1", n, err)
+	}
+	recs, _ := rs.List(1)
+	if len(recs) != 1 || recs[0].ID != fresh.ID {
+		t.Errorf("remaining = %v", recs)
+	}
+}
+
+func TestReplayPacesEvents(t *testing.T) {
+	cast := "{\"version\":2}\n[0.1,\"o\",\"a\"]\n[5.0,\"o\",\"b\"]\n"
+	var out bytes.Buffer
+	flushes := 0
+	start := time.Now()
+	err := Replay(context.Background(), strings.NewReader(cast), &out, 2, 100*time.Millisecond, func() { flushes++ })
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	// 0.1s at 2x = 50ms, then the 4.9s gap is capped at 100ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("replay took %s", elapsed)
+	}
+	if out.String() != cast || flushes != 3 {
+		t.Errorf("out = %q, flushes = %d", out.String(), flushes)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Replay(ctx, strings.NewReader(cast), &out, 1, 0, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled replay err = %v", err)
+	}
+}
@@ -10,13 +10,13 @@
 //     allowing clients to reconnect and resume where they left off.
 //   - A scrollback buffer captures recent output so reconnecting clients can
 //     replay missed content. Buffer size is configurable (0 disables).
-//   - When recording is enabled, all session output is additionally written
-//     to a timestamped file on disk for audit purposes.
+//   - When recording is enabled, the session is additionally written to an
+//     asciicast v2 file on disk (output, resizes and optionally keystrokes,
+//     with timing) for audit review; see Recordings.
 //   - Idle detached sessions are reaped after a configurable timeout.
 //
 // Limitations:
 //   - Sessions are in-memory only; a control-plane restart loses all sessions.
-//   - Recording files are append-only raw terminal output (no timing metadata).
 //   - The scrollback buffer stores raw bytes; very long lines may consume
 //     disproportionate memory.
 package sshterminal
@@ -25,8 +25,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -41,9 +39,8 @@ type SessionManagerConfig struct {
 	// Set to 0 to disable history.
 	HistoryLines int
 
-	// RecordingDir is the directory where session recordings are written.
-	// Empty string disables recording.
-	RecordingDir string
+	// Recordings stores session recordings. Nil disables recording.
+	Recordings *Recordings
 
 	// IdleTimeout is how long a detached session stays alive before being reaped.
 	IdleTimeout time.Duration
@@ -52,14 +49,15 @@ type SessionManagerConfig struct {
 // ManagedSession wraps a TerminalSession with persistence and history support.
 //
 // A ManagedSession transitions between two states:
-//   - Attached: a WebSocket client is actively reading/writing. Output flows
-//     from SSH stdout through the OutputReader pipe to the WebSocket relay.
+//   - Attached: one or more viewers (WebSocket clients) receive the output.
+//     At most one of them holds input control; the others watch read-only
+//     (see Viewer).
 //   - Detached: no client is connected. Output is still consumed (to prevent
 //     the SSH channel from blocking) and stored in the scrollback buffer,
 //     but there is no active reader on the other end.
 //
-// Callers use Attach/Detach to transition between states and WriteTo to relay
-// output to a writer (typically the WebSocket connection).
+// Callers use Join/Viewer.Leave (or the single-client Attach/Detach) to
+// transition between states.
 type ManagedSession struct {
 	ID         string    `json:"id"`
 	InstanceID uint      `json:"instance_id"`
@@ -72,14 +70,15 @@ type ManagedSession struct {
 	// history stores the scrollback buffer (ring buffer of raw bytes).
 	history *scrollbackBuffer
 
-	// recording is the optional audit file writer. Nil if recording is disabled.
-	recording *os.File
+	// recording is the optional asciicast recorder. Nil if recording is disabled.
+	recording *Recorder
 
-	// mu protects attached, detachedAt, outputWriter, and done.
+	// mu protects viewers, controller, attachViewer, detachedAt and closed.
 	mu           sync.Mutex
-	attached     bool
+	viewers      map[string]*Viewer // keyed by viewer ID
+	controller   string             // ID of the viewer holding input control; "" = nobody
+	attachViewer *Viewer            // viewer created by Attach
 	detachedAt   time.Time
-	outputWriter io.Writer // current writer for output (set during Attach)
 	done         chan struct{}
 
 	// closed tracks whether the session has been fully closed.
@@ -115,6 +114,12 @@ func NewSessionManager(cfg SessionManagerConfig) *SessionManager {
 // Attach to connect a WebSocket client. The shell parameter is validated
 // against AllowedShells before the session is created.
 func (sm *SessionManager) CreateSession(client *ssh.Client, instanceID uint, shell string) (*ManagedSession, error) {
+	return sm.CreateSessionAs(client, instanceID, shell, "")
+}
+
+// CreateSessionAs is CreateSession with the dashboard user who opened the
+// session, recorded in the session's recording.
+func (sm *SessionManager) CreateSessionAs(client *ssh.Client, instanceID uint, shell, user string) (*ManagedSession, error) {
 	ts, err := CreateInteractiveSession(client, shell)
 	if err != nil {
 		return nil, err
@@ -133,27 +138,17 @@ func (sm *SessionManager) CreateSession(client *ssh.Client, instanceID uint, she
 		ms.history = newScrollbackBuffer(sm.config.HistoryLines)
 	}
 
-	if sm.config.RecordingDir != "" {
-		if err := os.MkdirAll(sm.config.RecordingDir, 0750); err != nil {
-			ts.Close()
-			return nil, fmt.Errorf("create recording dir: %w", err)
-		}
-		filename := fmt.Sprintf("terminal_%d_%s_%s.log",
-			instanceID,
-			ms.ID[:8],
-			ms.CreatedAt.Format("20060102_150405"),
-		)
-		f, err := os.OpenFile(
-			filepath.Join(sm.config.RecordingDir, filename),
-			os.O_CREATE|os.O_WRONLY|os.O_APPEND,
-			0640,
-		)
-		if err != nil {
-			ts.Close()
-			return nil, fmt.Errorf("open recording file: %w", err)
-		}
-		ms.recording = f
+	rec, err := sm.config.Recordings.Start(RecordingMeta{
+		Source:     RecordingSourceTerminal,
+		InstanceID: instanceID,
+		SessionID:  ms.ID,
+		User:       user,
+	}, shell, defaultCols, defaultRows, map[string]string{"TERM": defaultTerm})
+	if err != nil {
+		ts.Close()
+		return nil, err
 	}
+	ms.recording = rec
 
 	// Start the output pump goroutine that continuously reads SSH stdout.
 	go ms.pumpOutput()
@@ -256,7 +251,7 @@ func (sm *SessionManager) reapIdle() {
 	now := time.Now()
 	for id, ms := range sm.sessions {
 		ms.mu.Lock()
-		idle := !ms.attached && !ms.detachedAt.IsZero() && now.Sub(ms.detachedAt) > sm.config.IdleTimeout
+		idle := len(ms.viewers) == 0 && !ms.detachedAt.IsZero() && now.Sub(ms.detachedAt) > sm.config.IdleTimeout
 		ms.mu.Unlock()
 		if idle {
 			toClose = append(toClose, ms)
@@ -271,59 +266,81 @@ func (sm *SessionManager) reapIdle() {
 	}
 }
 
-// Attach connects a writer (typically WebSocket) to receive session output.
+// Attach is the single-client form of Join: it joins a viewer (with input
+// control when nobody holds it) whose output is copied to w until Detach.
 // It returns the scrollback history so the client can replay missed output.
 func (ms *ManagedSession) Attach(w io.Writer) []byte {
+	v, history, err := ms.Join("", true)
+	if err != nil {
+		v, history, _ = ms.Join("", false)
+	}
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
-
-	ms.attached = true
-	ms.detachedAt = time.Time{}
-	ms.outputWriter = w
-
-	if ms.history != nil {
-		return ms.history.Bytes()
+	prev := ms.attachViewer
+	ms.attachViewer = v
+	if prev != nil {
+		ms.removeViewerLocked(prev)
 	}
-	return nil
+	ms.mu.Unlock()
+
+	go v.copyTo(w)
+	return history
 }
 
-// Detach disconnects the current writer. The session stays alive and continues
-// buffering output in the scrollback buffer.
+// Detach removes the viewer created by Attach. The session stays alive and
+// continues buffering output in the scrollback buffer.
 func (ms *ManagedSession) Detach() {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-
-	ms.attached = false
-	ms.detachedAt = time.Now()
-	ms.outputWriter = nil
+	if ms.attachViewer != nil {
+		ms.removeViewerLocked(ms.attachViewer)
+		ms.attachViewer = nil
+	}
 }
 
-// IsAttached returns whether a client is currently attached.
+// IsAttached returns whether any viewer is attached.
 func (ms *ManagedSession) IsAttached() bool {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	return ms.attached
+	return len(ms.viewers) > 0
+}
+
+// HasController returns whether a viewer holds input control.
+func (ms *ManagedSession) HasController() bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.controller != ""
 }
 
 // WriteInput sends data to the terminal's stdin.
 func (ms *ManagedSession) WriteInput(data []byte) (int, error) {
+	ms.recording.Input(data)
 	return ms.terminal.Stdin.Write(data)
 }
 
 // Resize changes the terminal dimensions.
 func (ms *ManagedSession) Resize(cols, rows uint16) error {
+	ms.recording.Resize(int(cols), int(rows))
 	return ms.terminal.Resize(cols, rows)
 }
 
+// RecordingID returns the ID of the session's recording, or "" when the
+// session is not recorded.
+func (ms *ManagedSession) RecordingID() string {
+	if ms.recording == nil {
+		return ""
+	}
+	return ms.recording.ID
+}
+
 // Done returns a channel that is closed when the session's SSH process exits.
 func (ms *ManagedSession) Done() <-chan struct{} {
 	return ms.done
 }
 
 // pumpOutput continuously reads from SSH stdout and dispatches output to:
-//   - The attached writer (if any)
+//   - Every attached viewer
 //   - The scrollback buffer (if enabled)
-//   - The recording file (if enabled)
+//   - The recording (if enabled)
 //
 // This goroutine runs for the lifetime of the session, ensuring the SSH channel
 // never blocks even when no client is attached.
@@ -334,25 +351,19 @@ func (ms *ManagedSession) pumpOutput() {
 	for {
 		n, err := ms.terminal.Stdout.Read(buf)
 		if n > 0 {
-			data := buf[:n]
+			// Viewers receive the chunk asynchronously, so it cannot share buf.
+			data := append([]byte(nil), buf[:n]...)
 
 			ms.mu.Lock()
 			// Write to scrollback buffer
 			if ms.history != nil {
 				ms.history.Write(data)
 			}
-			// Write to recording file
-			if ms.recording != nil {
-				ms.recording.Write(data)
-			}
-			// Write to attached client
-			w := ms.outputWriter
+			// Write to recording
+			ms.recording.Output(data)
+			// Queue for attached viewers; slow viewers are dropped
+			ms.broadcastLocked(data)
 			ms.mu.Unlock()
-
-			if w != nil {
-				// Best-effort write to client; errors are handled by the caller
-				w.Write(data)
-			}
 		}
 		if err != nil {
 			return
@@ -369,7 +380,10 @@ func (ms *ManagedSession) close() error {
 	}
 	ms.closed = true
 	rec := ms.recording
-	ms.outputWriter = nil
+	for _, v := range ms.viewers {
+		ms.removeViewerLocked(v)
+	}
+	ms.attachViewer = nil
 	ms.mu.Unlock()
 
 	if rec != nil {
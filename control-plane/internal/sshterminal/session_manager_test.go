@@ -308,13 +308,15 @@ func TestSessionManager_Recording(t *testing.T) {
 	client := newTestClient(t)
 	recordDir := t.TempDir()
 
+	recordings := NewRecordings(recordDir)
+	recordings.CaptureInput = func() bool { return true }
 	sm := NewSessionManager(SessionManagerConfig{
 		HistoryLines: 100,
-		RecordingDir: recordDir,
+		Recordings:   recordings,
 	})
 	defer sm.Stop()
 
-	ms, err := sm.CreateSession(client, 42, "/bin/bash")
+	ms, err := sm.CreateSessionAs(client, 42, "/bin/bash", "alice")
 	if err != nil {
 		t.Fatalf("CreateSession: %v", err)
 	}
@@ -322,9 +324,10 @@ func TestSessionManager_Recording(t *testing.T) {
 	// Wait for PTY output to be recorded
 	waitForHistory(t, ms, "PTY:true", 3*time.Second)
 
-	// Send some input
+	// Send some input and resize
 	ms.WriteInput([]byte("recorded_command"))
 	waitForHistory(t, ms, "echo:recorded_command", 3*time.Second)
+	ms.Resize(120, 40)
 
 	// Close session to flush recording
 	sm.CloseSession(ms.ID)
@@ -346,8 +349,10 @@ func TestSessionManager_Recording(t *testing.T) {
 	if !strings.Contains(string(content), "PTY:true") {
 		t.Error("recording missing PTY:true")
 	}
-	if !strings.Contains(string(content), "recorded_command") {
-		t.Error("recording missing echoed command")
+	for _, want := range []string{`"i","recorded_command"]`, `"o","echo:recorded_command`, `"r","120x40"]`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("recording missing event %s", want)
+		}
 	}
 
 	// Verify filename format
@@ -355,8 +360,16 @@ func TestSessionManager_Recording(t *testing.T) {
 	if !strings.HasPrefix(name, "terminal_42_") {
 		t.Errorf("recording filename %q doesn't have expected prefix", name)
 	}
-	if !strings.HasSuffix(name, ".log") {
-		t.Errorf("recording filename %q doesn't have .log suffix", name)
+	if !strings.HasSuffix(name, ".cast") {
+		t.Errorf("recording filename %q doesn't have .cast suffix", name)
+	}
+
+	recs, err := recordings.List(42)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("List = %v, %v", recs, err)
+	}
+	if recs[0].User != "alice" || recs[0].SessionID != ms.ID || !recs[0].Input || recs[0].Width != 80 {
+		t.Errorf("listed recording = %+v", recs[0])
 	}
 }
 
@@ -364,7 +377,7 @@ func TestSessionManager_NoRecordingWhenDisabled(t *testing.T) {
 	client := newTestClient(t)
 
 	sm := NewSessionManager(SessionManagerConfig{
-		RecordingDir: "", // disabled
+		Recordings: NewRecordings(""), // disabled
 	})
 	defer sm.Stop()
 
@@ -24,6 +24,14 @@ var AllowedShells = map[string]bool{
 // message. Messages exceeding this limit are rejected to prevent DoS.
 const MaxInputMessageSize = 64 * 1024 // 64 KB
 
+// defaultTerm, defaultCols and defaultRows describe the PTY requested for new
+// sessions, until the client sends its first resize.
+const (
+	defaultTerm = "xterm-256color"
+	defaultCols = 80
+	defaultRows = 24
+)
+
 // MaxResizeCols and MaxResizeRows define upper bounds for terminal resize
 // requests. Values beyond these are rejected to prevent abuse.
 const (
@@ -104,7 +112,7 @@ func CreateInteractiveSession(client *ssh.Client, shell string) (*TerminalSessio
 		ssh.TTY_OP_OSPEED: 14400,
 	}
 
-	if err := session.RequestPty("xterm-256color", 24, 80, modes); err != nil {
+	if err := session.RequestPty(defaultTerm, defaultRows, defaultCols, modes); err != nil {
 		session.Close()
 		return nil, fmt.Errorf("request pty: %w", err)
 	}
@@ -0,0 +1,258 @@
+package sshterminal
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// viewerBufferChunks is how many output chunks may queue for one viewer.
+// A viewer that falls further behind is disconnected rather than allowed to
+// stall the session for everyone else.
+const viewerBufferChunks = 256
+
+var (
+	// ErrNotController is returned when a viewer without input control tries
+	// to type, resize or hand control off.
+	ErrNotController = errors.New("viewer does not hold input control")
+	// ErrControlHeld is returned when control is requested while another
+	// viewer holds it.
+	ErrControlHeld = errors.New("input control is held by another viewer")
+	// ErrViewerNotFound is returned when a hand-off targets a viewer that
+	// is not attached to the session.
+	ErrViewerNotFound = errors.New("viewer not found")
+)
+
+// Viewer is one client attached to a ManagedSession. Every viewer receives
+// the session output; at most one viewer per session (the controller) may
+// send input or resize the terminal, and control only moves by an explicit
+// hand-off from the controller, or by a viewer taking it while nobody holds
+// it.
+type Viewer struct {
+	ID       string
+	User     string
+	JoinedAt time.Time
+
+	ms        *ManagedSession
+	out       chan []byte
+	changed   chan struct{}
+	done      chan struct{}
+	requested bool // asked the controller for input control
+}
+
+// ViewerInfo describes a viewer for clients and API responses.
+type ViewerInfo struct {
+	ID               string    `json:"id"`
+	User             string    `json:"user"`
+	JoinedAt         time.Time `json:"joined_at"`
+	Control          bool      `json:"control"`
+	RequestedControl bool      `json:"requested_control"`
+}
+
+// Join attaches a new viewer. With wantControl the viewer becomes the
+// controller, which fails with ErrControlHeld if another viewer holds
+// control. It returns the scrollback history to replay before the viewer's
+// live output.
+func (ms *ManagedSession) Join(user string, wantControl bool) (*Viewer, []byte, error) {
+	v := &Viewer{
+		ID:       uuid.New().String(),
+		User:     user,
+		JoinedAt: time.Now(),
+		ms:       ms,
+		out:      make(chan []byte, viewerBufferChunks),
+		changed:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	ms.mu.Lock()
+	if wantControl && ms.controller != "" {
+		ms.mu.Unlock()
+		return nil, nil, ErrControlHeld
+	}
+	if ms.viewers == nil {
+		ms.viewers = make(map[string]*Viewer)
+	}
+	ms.viewers[v.ID] = v
+	if wantControl {
+		ms.controller = v.ID
+	}
+	ms.detachedAt = time.Time{}
+	var history []byte
+	if ms.history != nil {
+		history = ms.history.Bytes()
+	}
+	ms.notifyLocked()
+	ms.mu.Unlock()
+
+	return v, history, nil
+}
+
+// Leave detaches the viewer. If it held control, control is released and
+// any remaining viewer may take it. The session stays alive and keeps
+// buffering output once the last viewer leaves.
+func (v *Viewer) Leave() {
+	ms := v.ms
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.removeViewerLocked(v)
+}
+
+func (ms *ManagedSession) removeViewerLocked(v *Viewer) {
+	if ms.viewers[v.ID] != v {
+		return
+	}
+	delete(ms.viewers, v.ID)
+	close(v.done)
+	if ms.controller == v.ID {
+		ms.controller = ""
+	}
+	if len(ms.viewers) == 0 {
+		ms.detachedAt = time.Now()
+	}
+	ms.notifyLocked()
+}
+
+// HasControl reports whether the viewer currently holds input control.
+func (v *Viewer) HasControl() bool {
+	v.ms.mu.Lock()
+	defer v.ms.mu.Unlock()
+	return v.ms.controller == v.ID
+}
+
+// WriteInput sends keystrokes to the terminal if the viewer holds control.
+func (v *Viewer) WriteInput(data []byte) (int, error) {
+	if !v.HasControl() {
+		return 0, ErrNotController
+	}
+	return v.ms.WriteInput(data)
+}
+
+// Resize changes the terminal size if the viewer holds control; read-only
+// viewers see the controller's size.
+func (v *Viewer) Resize(cols, rows uint16) error {
+	if !v.HasControl() {
+		return ErrNotController
+	}
+	return v.ms.Resize(cols, rows)
+}
+
+// HandOff gives input control to the viewer toID. Only the current
+// controller may hand off.
+func (v *Viewer) HandOff(toID string) (*Viewer, error) {
+	ms := v.ms
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.controller != v.ID {
+		return nil, ErrNotController
+	}
+	to := ms.viewers[toID]
+	if to == nil {
+		return nil, ErrViewerNotFound
+	}
+	ms.controller = to.ID
+	to.requested = false
+	ms.notifyLocked()
+	return to, nil
+}
+
+// TakeControl makes the viewer the controller when nobody holds control.
+func (v *Viewer) TakeControl() error {
+	ms := v.ms
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.viewers[v.ID] != v {
+		return ErrViewerNotFound
+	}
+	if ms.controller == v.ID {
+		return nil
+	}
+	if ms.controller != "" {
+		return ErrControlHeld
+	}
+	ms.controller = v.ID
+	v.requested = false
+	ms.notifyLocked()
+	return nil
+}
+
+// RequestControl flags the viewer as asking for control so the controller's
+// client can offer a hand-off.
+func (v *Viewer) RequestControl() {
+	ms := v.ms
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.viewers[v.ID] == v && ms.controller != v.ID && !v.requested {
+		v.requested = true
+		ms.notifyLocked()
+	}
+}
+
+// Output delivers session output to the viewer.
+func (v *Viewer) Output() <-chan []byte { return v.out }
+
+// Changed signals (coalesced) that the viewer list or controller changed;
+// read Viewers for the new state.
+func (v *Viewer) Changed() <-chan struct{} { return v.changed }
+
+// Done is closed when the viewer has left or was disconnected for falling
+// too far behind.
+func (v *Viewer) Done() <-chan struct{} { return v.done }
+
+// Viewers returns the attached viewers, oldest first.
+func (ms *ManagedSession) Viewers() []ViewerInfo {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	out := make([]ViewerInfo, 0, len(ms.viewers))
+	for _, v := range ms.viewers {
+		out = append(out, ViewerInfo{
+			ID:               v.ID,
+			User:             v.User,
+			JoinedAt:         v.JoinedAt,
+			Control:          ms.controller == v.ID,
+			RequestedControl: v.requested,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].JoinedAt.Before(out[j].JoinedAt) })
+	return out
+}
+
+// notifyLocked signals every viewer that the viewer list changed.
+func (ms *ManagedSession) notifyLocked() {
+	for _, v := range ms.viewers {
+		select {
+		case v.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// broadcastLocked queues an output chunk for every viewer. data must not be
+// modified afterwards.
+func (ms *ManagedSession) broadcastLocked(data []byte) {
+	for _, v := range ms.viewers {
+		select {
+		case v.out <- data:
+		default:
+			log.Printf("Terminal viewer %s (session %s) fell behind; disconnecting", v.ID, ms.ID)
+			ms.removeViewerLocked(v)
+		}
+	}
+}
+
+// copyTo writes the viewer's output to w until it leaves or a write fails.
+func (v *Viewer) copyTo(w io.Writer) {
+	for {
+		select {
+		case <-v.done:
+			return
+		case data := <-v.out:
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sshterminal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readViewerOutput collects a viewer's output until it contains target.
+func readViewerOutput(t *testing.T, v *Viewer, target string) {
+	t.Helper()
+	var got strings.Builder
+	deadline := time.After(3 * time.Second)
+	for !strings.Contains(got.String(), target) {
+		select {
+		case data := <-v.Output():
+			got.Write(data)
+		case <-deadline:
+			t.Fatalf("timeout waiting for %q, got %q", target, got.String())
+		}
+	}
+}
+
+func TestViewers_SingleControllerAndHandOff(t *testing.T) {
+	client := newTestClient(t)
+	sm := NewSessionManager(SessionManagerConfig{HistoryLines: 100})
+	defer sm.Stop()
+	ms, _ := sm.CreateSession(client, 1, "/bin/bash")
+
+	owner, _, err := ms.Join("alice", true)
+	if err != nil {
+		t.Fatalf("Join owner: %v", err)
+	}
+	if _, _, err := ms.Join("mallory", true); !errors.Is(err, ErrControlHeld) {
+		t.Fatalf("second controller: err = %v, want ErrControlHeld", err)
+	}
+	watcher, _, err := ms.Join("bob", false)
+	if err != nil {
+		t.Fatalf("Join watcher: %v", err)
+	}
+
+	if _, err := watcher.WriteInput([]byte("nope")); !errors.Is(err, ErrNotController) {
+		t.Errorf("watcher input: err = %v, want ErrNotController", err)
+	}
+	if err := watcher.Resize(100, 40); !errors.Is(err, ErrNotController) {
+		t.Errorf("watcher resize: err = %v, want ErrNotController", err)
+	}
+	if _, err := owner.WriteInput([]byte("shared")); err != nil {
+		t.Fatalf("owner input: %v", err)
+	}
+	readViewerOutput(t, owner, "echo:shared")
+	readViewerOutput(t, watcher, "echo:shared")
+
+	watcher.RequestControl()
+	if vs := ms.Viewers(); len(vs) != 2 || !vs[0].Control || !vs[1].RequestedControl {
+		t.Fatalf("viewers = %+v", vs)
+	}
+	if _, err := watcher.HandOff(owner.ID); !errors.Is(err, ErrNotController) {
+		t.Errorf("hand-off by non-controller: err = %v", err)
+	}
+	if _, err := owner.HandOff(watcher.ID); err != nil {
+		t.Fatalf("hand-off: %v", err)
+	}
+	if owner.HasControl() || !watcher.HasControl() {
+		t.Fatal("control did not move to the watcher")
+	}
+	if _, err := owner.WriteInput([]byte("x")); !errors.Is(err, ErrNotController) {
+		t.Errorf("former controller input: err = %v", err)
+	}
+
+	// The controller leaving frees control for anyone to take.
+	watcher.Leave()
+	if ms.HasController() {
+		t.Fatal("control still held after the controller left")
+	}
+	if err := owner.TakeControl(); err != nil {
+		t.Fatalf("take free control: %v", err)
+	}
+	owner.Leave()
+	if ms.IsAttached() {
+		t.Error("session still attached after all viewers left")
+	}
+}
+
+func TestViewers_SlowViewerDisconnected(t *testing.T) {
+	client := newTestClient(t)
+	sm := NewSessionManager(SessionManagerConfig{})
+	defer sm.Stop()
+	ms, _ := sm.CreateSession(client, 1, "/bin/bash")
+
+	slow, _, _ := ms.Join("slow", false)
+	ms.mu.Lock()
+	for i := 0; i <= viewerBufferChunks; i++ {
+		ms.broadcastLocked([]byte("x"))
+	}
+	ms.mu.Unlock()
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("viewer that fell behind was not disconnected")
+	}
+	if ms.IsAttached() {
+		t.Error("disconnected viewer still listed")
+	}
+}
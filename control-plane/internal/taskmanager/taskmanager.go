@@ -21,6 +21,9 @@ const (
 	TaskInstanceRestart     TaskType = "instance.restart"
 	TaskInstanceImageUpdate TaskType = "instance.image_update"
 	TaskInstanceClone       TaskType = "instance.clone"
+	TaskInstanceMigrate     TaskType = "instance.migrate"
+	TaskInstanceStart       TaskType = "instance.start"
+	TaskInstanceStop        TaskType = "instance.stop"
 	TaskBackupCreate        TaskType = "backup.create"
 	TaskSkillDeploy         TaskType = "skill.deploy"
 	// Browser-pod lifecycle tasks (on-demand browser feature).
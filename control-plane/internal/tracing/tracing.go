@@ -0,0 +1,175 @@
+// Package tracing exports OpenTelemetry traces over OTLP/HTTP. See
+// docs/tracing.md.
+//
+// Tracing is off unless CLAWORC_OTLP_ENDPOINT is set. While it is off the
+// global tracer provider is OpenTelemetry's no-op one: Start returns
+// non-recording spans and the HTTP wrappers return their input unchanged,
+// so instrumented code paths cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gluk-w/claworc/control-plane/internal/config"
+)
+
+// instrumentationName identifies spans created by the control plane.
+const instrumentationName = "github.com/gluk-w/claworc/control-plane"
+
+var enabled atomic.Bool
+
+// Enabled reports whether Init installed an exporting tracer provider.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Init installs the global tracer provider and W3C trace-context
+// propagator from config.Cfg. It returns a shutdown func that flushes
+// buffered spans; call it before exit. With no OTLP endpoint configured,
+// Init does nothing and the returned shutdown is a no-op.
+func Init(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+	if config.Cfg.OTLPEndpoint == "" {
+		return noop, nil
+	}
+	endpoint, err := tracesURL(config.Cfg.OTLPEndpoint)
+	if err != nil {
+		return noop, err
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	if len(config.Cfg.OTLPHeaders) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.Cfg.OTLPHeaders))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return noop, fmt.Errorf("otlp exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.Cfg.TracingServiceName),
+	))
+	if err != nil {
+		return noop, fmt.Errorf("trace resource: %w", err)
+	}
+
+	ratio := config.Cfg.TracingSampleRatio
+	if ratio < 0 || ratio > 1 {
+		return noop, fmt.Errorf("CLAWORC_TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", ratio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled.Store(true)
+	return tp.Shutdown, nil
+}
+
+// tracesURL turns the configured endpoint into the OTLP/HTTP traces URL.
+// A bare collector address gets the standard /v1/traces path.
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("CLAWORC_OTLP_ENDPOINT must be an http(s) URL, got %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// Start begins an internal span as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if non-nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware is a chi middleware that starts a server span per request,
+// continuing any trace in the incoming traceparent header. The span is
+// named after the matched route pattern (e.g. "GET /api/v1/instances/{id}")
+// so names stay low-cardinality. Health checks and metric scrapes are not
+// traced.
+func Middleware(next http.Handler) http.Handler {
+	if !Enabled() {
+		return next
+	}
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if pattern := routePattern(r); pattern != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + pattern)
+			span.SetAttributes(attribute.String("http.route", pattern))
+		}
+	})
+	return otelhttp.NewHandler(named, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/health" && r.URL.Path != "/metrics"
+		}),
+		// otelhttp renames the span once routing has set r.Pattern; keep
+		// the full chi pattern, which spans mounted subrouters.
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if pattern := routePattern(r); pattern != "" {
+				return r.Method + " " + pattern
+			}
+			return r.Method
+		}),
+	)
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// Handler wraps h in a server span called operation.
+func Handler(h http.Handler, operation string) http.Handler {
+	if !Enabled() {
+		return h
+	}
+	return otelhttp.NewHandler(h, operation)
+}
+
+// Transport wraps base (http.DefaultTransport when nil) so outgoing
+// requests get a client span and carry the trace context upstream.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !Enabled() {
+		return base
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// InstanceID is the span attribute for the instance a span concerns.
+func InstanceID(id uint) attribute.KeyValue {
+	return attribute.Int64("claworc.instance_id", int64(id))
+}
@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs an in-memory tracer provider and marks tracing enabled
+// for the duration of the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled.Store(true)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+		enabled.Store(false)
+	})
+	return sr
+}
+
+func TestTracesURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://otel-collector:4318":            "http://otel-collector:4318/v1/traces",
+		"https://otlp.example.com/":             "https://otlp.example.com/v1/traces",
+		"https://otlp.example.com/custom/spans": "https://otlp.example.com/custom/spans",
+	} {
+		if got, err := tracesURL(in); err != nil || got != want {
+			t.Errorf("tracesURL(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"otel-collector:4318", "grpc://collector:4317", "http://"} {
+		if _, err := tracesURL(bad); err == nil {
+			t.Errorf("tracesURL(%q) should fail", bad)
+		}
+	}
+}
+
+func TestDisabled_PassThrough(t *testing.T) {
+	h := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	if got := Middleware(h); got == nil {
+		t.Fatal("nil handler")
+	}
+	if Transport(nil) != http.DefaultTransport {
+		t.Error("Transport should return the default transport unchanged while disabled")
+	}
+}
+
+func TestMiddleware_NamesSpanByRoute(t *testing.T) {
+	sr := record(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/instances/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/instances/42", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended spans = %d, want 1 (health checks are not traced)", len(spans))
+	}
+	if name := spans[0].Name(); name != "GET /api/v1/instances/{id}" {
+		t.Errorf("span name = %q", name)
+	}
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	sr := record(t)
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, "POST", upstream.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	End(span, nil)
+
+	traceID := span.SpanContext().TraceID().String()
+	if len(traceparent) < 36 || traceparent[3:35] != traceID {
+		t.Errorf("traceparent = %q, want trace id %s", traceparent, traceID)
+	}
+	if n := len(sr.Ended()); n != 2 {
+		t.Errorf("ended spans = %d, want parent and client span", n)
+	}
+}
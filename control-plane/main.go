@@ -15,7 +15,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/gluk-w/claworc/control-plane/internal/activity"
 	"github.com/gluk-w/claworc/control-plane/internal/analytics"
+	"github.com/gluk-w/claworc/control-plane/internal/audit"
 	"github.com/gluk-w/claworc/control-plane/internal/auth"
 	"github.com/gluk-w/claworc/control-plane/internal/backup"
 	"github.com/gluk-w/claworc/control-plane/internal/browserprov"
@@ -23,15 +25,18 @@ import (
 	"github.com/gluk-w/claworc/control-plane/internal/database"
 	"github.com/gluk-w/claworc/control-plane/internal/handlers"
 	"github.com/gluk-w/claworc/control-plane/internal/llmgateway"
+	"github.com/gluk-w/claworc/control-plane/internal/metrics"
 	"github.com/gluk-w/claworc/control-plane/internal/middleware"
 	"github.com/gluk-w/claworc/control-plane/internal/moderator"
 	"github.com/gluk-w/claworc/control-plane/internal/modwiring"
+	"github.com/gluk-w/claworc/control-plane/internal/notify"
 	"github.com/gluk-w/claworc/control-plane/internal/orchestrator"
 	"github.com/gluk-w/claworc/control-plane/internal/sshaudit"
 	"github.com/gluk-w/claworc/control-plane/internal/sshgateway"
 	"github.com/gluk-w/claworc/control-plane/internal/sshproxy"
 	"github.com/gluk-w/claworc/control-plane/internal/sshterminal"
 	"github.com/gluk-w/claworc/control-plane/internal/taskmanager"
+	"github.com/gluk-w/claworc/control-plane/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 	"golang.org/x/crypto/ssh"
@@ -57,6 +62,15 @@ func main() {
 
 	config.Load()
 
+	// Tracing first so every component started below is instrumented.
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("Tracing init: %v", err)
+	}
+	if tracing.Enabled() {
+		log.Printf("Tracing: exporting spans to %s", config.Cfg.OTLPEndpoint)
+	}
+
 	if err := database.Init(); err != nil {
 		log.Fatalf("Database init: %v", err)
 	}
@@ -81,6 +95,8 @@ func main() {
 		log.Fatalf("SSH key init: %v", err)
 	}
 	sshMgr := sshproxy.NewSSHManager(sshSigner, sshPublicKey)
+	sshMgr.SetHostKeyStore(database.HostKeyStore{})
+	sshMgr.SetPermitOpen(sshgateway.ForwardPortsFor)
 	handlers.SSHMgr = sshMgr
 	tunnelMgr := sshproxy.NewTunnelManager(sshMgr)
 	handlers.TunnelMgr = tunnelMgr
@@ -111,18 +127,47 @@ func main() {
 			auditor.LogDisconnection(event.InstanceID, "system", event.Details)
 		case sshproxy.EventKeyUploaded:
 			auditor.LogKeyUpload(event.InstanceID, event.Details)
+		case sshproxy.EventHostKeyPinned:
+			auditor.Log(sshaudit.EventHostKeyPinned, event.InstanceID, "system", event.Details)
+		case sshproxy.EventHostKeyMismatch:
+			auditor.Log(sshaudit.EventHostKeyMismatch, event.InstanceID, "system", event.Details)
 		}
 	})
 	log.Printf("SSH audit logger initialized (retention=%d days)", retentionDays)
 
+	// Init dashboard/API audit log (every mutating API request)
+	auditEvents, err := audit.NewLogger(database.DB, database.AuditRetentionDays())
+	if err != nil {
+		log.Fatalf("Audit log init: %v", err)
+	}
+	handlers.AuditEvents = auditEvents
+	cancelEventCleanup := auditEvents.StartRetentionCleanup(ctx)
+	_ = cancelEventCleanup
+	auditMutations := audit.Middleware(auditEvents, func(r *http.Request) string {
+		if user := middleware.GetUser(r); user != nil {
+			return user.Username
+		}
+		return ""
+	})
+
+	// Outbound notifications for instances that stop (and resume) answering
+	// over SSH. See docs/notifications.md.
+	sshMgr.OnStateChange(notify.SSHStateChange)
+
 	// Init terminal session manager
 	sessionTimeout, err := time.ParseDuration(config.Cfg.TerminalSessionTimeout)
 	if err != nil {
 		sessionTimeout = 30 * time.Minute
 	}
+	recordings := sshterminal.NewRecordings(config.Cfg.TerminalRecordingDir)
+	if recordings != nil {
+		recordings.CaptureInput = database.TerminalRecordingInputEnabled
+		recordings.StartRetentionCleanup(ctx, database.TerminalRecordingRetentionDays)
+	}
+	handlers.Recordings = recordings
 	termMgr := sshterminal.NewSessionManager(sshterminal.SessionManagerConfig{
 		HistoryLines: config.Cfg.TerminalHistoryLines,
-		RecordingDir: config.Cfg.TerminalRecordingDir,
+		Recordings:   recordings,
 		IdleTimeout:  sessionTimeout,
 	})
 	handlers.TermSessionMgr = termMgr
@@ -133,9 +178,31 @@ func main() {
 	if err := auth.InitWebAuthn(config.Cfg.RPID, config.Cfg.RPOrigins); err != nil {
 		log.Printf("WARNING: WebAuthn init failed: %v", err)
 	}
+	if err := auth.InitOIDC(); err != nil {
+		log.Fatalf("OIDC: %v", err)
+	}
+	if auth.OIDC != nil {
+		log.Printf("OIDC single sign-on enabled (issuer %s)", auth.OIDC.Issuer)
+	}
+	if err := auth.InitLDAP(); err != nil {
+		log.Fatalf("LDAP: %v", err)
+	}
+	if auth.LDAP != nil {
+		log.Printf("LDAP authentication enabled (%s)", auth.LDAP.URL)
+	}
 
-	// Init session store
-	sessionStore := auth.NewSessionStore()
+	// Init session store. The database backend keeps logins across restarts
+	// and shares them between replicas; see docs/auth.md.
+	var sessionBackend auth.SessionBackend
+	switch config.Cfg.SessionBackend {
+	case "memory":
+		sessionBackend = auth.NewMemorySessionBackend()
+	case "database":
+		sessionBackend = auth.NewDBSessionBackend(database.DB)
+	default:
+		log.Fatalf("CLAWORC_SESSION_BACKEND must be \"database\" or \"memory\", got %q", config.Cfg.SessionBackend)
+	}
+	sessionStore := auth.NewSessionStoreWithBackend(sessionBackend)
 	handlers.SessionStore = sessionStore
 
 	// Session cleanup goroutine
@@ -152,6 +219,9 @@ func main() {
 	if err := orchestrator.InitOrchestrator(ctx); err != nil {
 		log.Printf("WARNING: %v", err)
 	}
+	if err := orchestrator.InitTargets(ctx); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
 
 	// Initialize the TaskManager. It owns every long-running goroutine
 	// started by user actions (instance create/restart/clone/update-image,
@@ -160,6 +230,8 @@ func main() {
 	handlers.TaskMgr = taskMgr
 	backup.TaskMgr = taskMgr
 	reconcileStuckTasks()
+	handlers.RegisterMetrics()
+	notify.WatchTasks(ctx, taskMgr)
 
 	// Register the private webhook trigger on the gateway mux before it
 	// binds. The gateway is reachable only from inside instances, so this
@@ -172,6 +244,7 @@ func main() {
 		log.Printf("WARNING: LLM gateway failed to start: %v", err)
 	}
 	tunnelMgr.SetLLMGatewayAddr(fmt.Sprintf("127.0.0.1:%d", config.Cfg.LLMGatewayPort))
+	llmgateway.StartCaptureRetentionCleanup(ctx)
 
 	// Configure SSH manager with orchestrator for automatic reconnection
 	if orch := orchestrator.Get(); orch != nil {
@@ -188,12 +261,14 @@ func main() {
 			log.Printf("WARNING: SSH gateway host key: %v", err)
 		} else {
 			sshGw = sshgateway.New(sshgateway.Config{
-				Addr:    fmt.Sprintf(":%d", config.Cfg.SSHGatewayPort),
-				HostKey: gwHostKey,
-				Auditor: auditor,
+				Addr:       fmt.Sprintf(":%d", config.Cfg.SSHGatewayPort),
+				HostKey:    gwHostKey,
+				Auditor:    auditor,
+				Recordings: recordings,
 				Clients: func(cctx context.Context, inst *database.Instance) (*ssh.Client, error) {
 					return sshMgr.EnsureConnectedWithIPCheck(cctx, inst.ID, orchestrator.Get(), inst.AllowedSourceIPs)
 				},
+				Wake: handlers.WakeInstance,
 			})
 			if err := sshGw.Start(ctx); err != nil {
 				log.Printf("WARNING: SSH gateway failed to start: %v", err)
@@ -303,6 +378,21 @@ func main() {
 	cancelScheduler := backup.StartScheduleExecutor(ctx)
 	_ = cancelScheduler // stopped via context cancellation on shutdown
 
+	// Record instance activity and hibernate idle instances (checks every
+	// minute, see docs/hibernation.md)
+	cancelActivity := activity.Start(ctx)
+	_ = cancelActivity // stopped via context cancellation on shutdown
+	cancelHibernation := handlers.StartHibernationJob(ctx)
+	_ = cancelHibernation // stopped via context cancellation on shutdown
+
+	// Start background power schedule executor (checks every minute)
+	cancelPowerSchedules := handlers.StartPowerScheduleExecutor(ctx)
+	_ = cancelPowerSchedules // stopped via context cancellation on shutdown
+
+	// Start background LDAP directory sync (CLAWORC_LDAP_SYNC_INTERVAL)
+	cancelLDAPSync := handlers.StartLDAPSyncJob(ctx)
+	_ = cancelLDAPSync // stopped via context cancellation on shutdown
+
 	// Daily analytics heartbeat (gated on opt-in inside Track).
 	analytics.StartHeartbeat(ctx)
 
@@ -310,10 +400,14 @@ func main() {
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
 	r.Use(chimw.RealIP)
+	r.Use(tracing.Middleware)
 
 	// Health (no auth)
 	r.Get("/health", handlers.HealthCheck)
 
+	// Prometheus metrics (optional bearer token, see docs/metrics.md)
+	r.Get("/metrics", metrics.Handler(config.Cfg.MetricsToken))
+
 	// API v1
 	r.Route("/api/v1", func(r chi.Router) {
 		// Auth endpoints (no auth required)
@@ -322,14 +416,23 @@ func main() {
 		r.Post("/auth/setup", handlers.SetupCreateAdmin)
 		r.Post("/auth/webauthn/login/begin", handlers.WebAuthnLoginBegin)
 		r.Post("/auth/webauthn/login/finish", handlers.WebAuthnLoginFinish)
+		r.Get("/auth/oidc/config", handlers.GetOIDCConfig)
+		r.Get("/auth/oidc/login", handlers.OIDCLogin)
+		r.Get("/auth/oidc/callback", handlers.OIDCCallback)
+		r.Post("/auth/totp/setup/enroll", handlers.SetupEnrollTOTP)
+		r.Post("/auth/totp/setup/enable", handlers.SetupEnableTOTP)
 
 		// Auth endpoints (auth required)
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.RequireAuth(sessionStore))
+			r.Use(auditMutations)
 
 			r.Post("/auth/logout", handlers.Logout)
 			r.Get("/auth/me", handlers.GetCurrentUser)
 			r.Post("/auth/change-password", handlers.ChangePassword)
+			r.Get("/auth/sessions", handlers.ListSessions)
+			r.Delete("/auth/sessions", handlers.RevokeOtherSessions)
+			r.Delete("/auth/sessions/{sessionId}", handlers.RevokeSession)
 			r.Post("/auth/webauthn/register/begin", handlers.WebAuthnRegisterBegin)
 			r.Post("/auth/webauthn/register/finish", handlers.WebAuthnRegisterFinish)
 			r.Get("/auth/webauthn/credentials", handlers.ListWebAuthnCredentials)
@@ -338,12 +441,22 @@ func main() {
 			r.Post("/auth/ssh-keys", handlers.UploadUserSSHKey)
 			r.Get("/auth/ssh-keys", handlers.ListUserSSHKeys)
 			r.Delete("/auth/ssh-keys/{keyId}", handlers.DeleteUserSSHKey)
+			r.Get("/auth/tokens", handlers.ListMyAPITokens)
+			r.Post("/auth/tokens", handlers.CreateMyAPIToken)
+			r.Get("/auth/tokens/scopes", handlers.ListAPITokenScopes)
+			r.Delete("/auth/tokens/{tokenId}", handlers.RevokeMyAPIToken)
+			r.Get("/auth/totp", handlers.GetTOTPStatus)
+			r.Post("/auth/totp/enroll", handlers.EnrollTOTP)
+			r.Post("/auth/totp/enable", handlers.EnableTOTP)
+			r.Post("/auth/totp/disable", handlers.DisableTOTP)
+			r.Post("/auth/totp/recovery-codes", handlers.RegenerateRecoveryCodes)
 			r.Get("/ssh-gateway/info", handlers.GetSSHGatewayInfo)
 		})
 
 		// Protected routes (require auth)
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.RequireAuth(sessionStore))
+			r.Use(auditMutations)
 
 			// Tasks (long-running goroutine registry)
 			r.Get("/tasks", handlers.ListTasks)
@@ -372,7 +485,11 @@ func main() {
 			r.Get("/instances/{id}/tunnels", handlers.GetTunnelStatus)
 			r.Get("/instances/{id}/stats", handlers.GetInstanceStats)
 			r.Get("/instances/{id}/providers", handlers.ListInstanceProviders)
+			r.Get("/instances/{id}/llm-fallbacks", handlers.ListInstanceFallbackChains)
+			r.Put("/instances/{id}/llm-fallbacks/{providerId}", handlers.SetInstanceFallbackChain)
+			r.Delete("/instances/{id}/llm-fallbacks/{providerId}", handlers.DeleteInstanceFallbackChain)
 			r.Post("/instances/{id}/update-image", handlers.UpdateInstanceImage)
+			r.Get("/instances/{id}/template-diff", handlers.GetInstanceTemplateDiff)
 			r.Get("/ssh-fingerprint", handlers.GetSSHFingerprint)
 
 			// Files
@@ -469,6 +586,16 @@ func main() {
 				r.Post("/instances", handlers.CreateInstance)
 				r.Post("/instances/{id}/clone", handlers.CloneInstance)
 				r.Post("/backups/{backupId}/restore", handlers.RestoreBackupHandler)
+
+				// Instance templates (see docs/instance-templates.md); handlers
+				// check global vs team scope.
+				r.Get("/instance-templates", handlers.ListInstanceTemplates)
+				r.Post("/instance-templates", handlers.CreateInstanceTemplate)
+				r.Get("/instance-templates/{id}", handlers.GetInstanceTemplate)
+				r.Put("/instance-templates/{id}", handlers.UpdateInstanceTemplate)
+				r.Delete("/instance-templates/{id}", handlers.DeleteInstanceTemplate)
+				r.Get("/instance-templates/{id}/versions", handlers.ListInstanceTemplateVersions)
+				r.Post("/instance-templates/{id}/instances", handlers.CreateInstanceFromTemplate)
 			})
 
 			// Admin-only routes
@@ -476,16 +603,48 @@ func main() {
 				r.Use(middleware.RequireAdmin)
 
 				r.Delete("/instances/{id}", handlers.DeleteInstance)
+				r.Post("/instances/{id}/migrate", handlers.MigrateInstance)
+				r.Get("/instances/{id}/ssh-host-key", handlers.GetInstanceHostKey)
+				r.Post("/instances/{id}/ssh-host-key/accept", handlers.AcceptInstanceHostKey)
+				r.Delete("/instances/{id}/ssh-host-key", handlers.ForgetInstanceHostKey)
+
+				// Terminal session recordings (web terminal + SSH gateway)
+				r.Get("/instances/{id}/recordings", handlers.ListInstanceRecordings)
+				r.Get("/instances/{id}/recordings/{recordingId}", handlers.DownloadInstanceRecording)
+				r.Get("/instances/{id}/recordings/{recordingId}/replay", handlers.ReplayInstanceRecording)
 
 				// Settings
 				r.Get("/settings", handlers.GetSettings)
 				r.Put("/settings", handlers.UpdateSettings)
 				r.Post("/settings/rotate-ssh-key", handlers.RotateSSHKey)
 				r.Get("/audit-logs", handlers.GetAuditLogs)
+				r.Get("/audit-events", handlers.ListAuditEvents)
+				r.Get("/audit-events/export", handlers.ExportAuditEvents)
+
+				// Outbound notifications: channels and per-team subscription rules
+				r.Get("/notifications/event-types", handlers.ListNotificationEventTypes)
+				r.Get("/notifications/channels", handlers.ListNotificationChannels)
+				r.Post("/notifications/channels", handlers.CreateNotificationChannel)
+				r.Put("/notifications/channels/{id}", handlers.UpdateNotificationChannel)
+				r.Delete("/notifications/channels/{id}", handlers.DeleteNotificationChannel)
+				r.Post("/notifications/channels/{id}/test", handlers.TestNotificationChannel)
+				r.Get("/notifications/rules", handlers.ListNotificationRules)
+				r.Post("/notifications/rules", handlers.CreateNotificationRule)
+				r.Delete("/notifications/rules/{id}", handlers.DeleteNotificationRule)
 
 				// Container backend (Docker/Kubernetes) diagnostics + recovery
 				r.Get("/orchestrator/status", handlers.GetOrchestratorStatus)
 				r.Post("/orchestrator/reinitialize", handlers.ReinitializeOrchestrator)
+				r.Get("/orchestrator/targets", handlers.ListOrchestratorTargets)
+				r.Post("/orchestrator/targets", handlers.CreateOrchestratorTarget)
+				r.Put("/orchestrator/targets/{id}", handlers.UpdateOrchestratorTarget)
+				r.Delete("/orchestrator/targets/{id}", handlers.DeleteOrchestratorTarget)
+
+				// Scheduled start/stop windows (see docs/power-schedules.md)
+				r.Get("/power-schedules", handlers.ListPowerSchedules)
+				r.Post("/power-schedules", handlers.CreatePowerSchedule)
+				r.Put("/power-schedules/{id}", handlers.UpdatePowerSchedule)
+				r.Delete("/power-schedules/{id}", handlers.DeletePowerSchedule)
 
 				// LLM gateway providers and usage
 				r.Post("/llm/providers/test", handlers.TestProviderKey)
@@ -499,6 +658,27 @@ func main() {
 				r.Delete("/llm/usage", handlers.ResetUsageLogs)
 				r.Get("/llm/usage/stats", handlers.GetUsageStats)
 
+				// LLM spend budgets (instance / team / provider scopes)
+				r.Get("/llm/budgets", handlers.ListLLMBudgets)
+				r.Get("/llm/budgets/{scope}/{scopeId}", handlers.GetLLMBudget)
+				r.Put("/llm/budgets/{scope}/{scopeId}", handlers.SetLLMBudget)
+				r.Delete("/llm/budgets/{scope}/{scopeId}", handlers.DeleteLLMBudget)
+				r.Post("/llm/budgets/{scope}/{scopeId}/reset", handlers.ResetLLMBudget)
+
+				// LLM gateway rate limits (key / instance / provider scopes)
+				r.Get("/llm/rate-limits", handlers.ListLLMRateLimits)
+				r.Get("/llm/rate-limits/{scope}/{scopeId}", handlers.GetLLMRateLimit)
+				r.Put("/llm/rate-limits/{scope}/{scopeId}", handlers.SetLLMRateLimit)
+				r.Delete("/llm/rate-limits/{scope}/{scopeId}", handlers.DeleteLLMRateLimit)
+
+				// LLM request/response capture (per-instance opt-in) and replay
+				r.Get("/instances/{id}/llm-capture", handlers.GetInstanceCapturePolicy)
+				r.Put("/instances/{id}/llm-capture", handlers.SetInstanceCapturePolicy)
+				r.Delete("/instances/{id}/llm-capture", handlers.DeleteInstanceCapturePolicy)
+				r.Get("/llm/captures", handlers.SearchLLMCaptures)
+				r.Get("/llm/captures/{captureId}", handlers.GetLLMCapture)
+				r.Post("/llm/captures/{captureId}/replay", handlers.ReplayLLMCapture)
+
 				// Provider catalog proxy (claworc.com/providers, cached 1h)
 				r.Get("/llm/catalog", handlers.GetCatalogProviders)
 				r.Get("/llm/catalog/{key}", handlers.GetCatalogProviderDetail)
@@ -527,10 +707,24 @@ func main() {
 				r.Post("/users", handlers.CreateUser)
 				r.Delete("/users/{userId}", handlers.DeleteUser)
 				r.Put("/users/{userId}/role", handlers.UpdateUserRole)
+				r.Put("/users/{userId}/sftp-limit", handlers.UpdateUserSFTPLimit)
 				r.Get("/users/{userId}/teams", handlers.GetUserTeamsHandler)
 				r.Get("/users/{userId}/instances", handlers.GetUserAssignedInstances)
 				r.Put("/users/{userId}/instances", handlers.SetUserAssignedInstances)
 				r.Post("/users/{userId}/reset-password", handlers.ResetUserPassword)
+				r.Delete("/users/{userId}/totp", handlers.ResetUserTOTP)
+				r.Put("/users/{userId}/totp/setup-window", handlers.AllowUserTOTPSetup)
+
+				// Service accounts (API-only users) and their tokens
+				r.Get("/service-accounts", handlers.ListServiceAccounts)
+				r.Post("/service-accounts", handlers.CreateServiceAccount)
+				r.Delete("/service-accounts/{userId}", handlers.DeleteServiceAccount)
+				r.Get("/service-accounts/{userId}/tokens", handlers.ListServiceAccountTokens)
+				r.Post("/service-accounts/{userId}/tokens", handlers.CreateServiceAccountToken)
+				r.Delete("/service-accounts/{userId}/tokens/{tokenId}", handlers.RevokeServiceAccountToken)
+
+				// LDAP directory sync (runs periodically; this triggers it now)
+				r.Post("/ldap/sync", handlers.SyncLDAP)
 			})
 		})
 	})
@@ -588,6 +782,9 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Shutdown error: %v", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Tracing shutdown: %v", err)
+	}
 	log.Println("Server stopped")
 }
 
@@ -640,6 +837,9 @@ func runCLICommand(command string) {
 		if err := database.UpdateUserPassword(user.ID, hash); err != nil {
 			log.Fatalf("Failed to update password: %v", err)
 		}
-		fmt.Printf("Password reset for '%s'. Note: existing sessions will expire within 1 hour.\n", *username)
+		// Database-backed sessions can be revoked from here; in-memory ones
+		// live in the server process and expire on their own.
+		auth.NewDBSessionBackend(database.DB).DeleteByUserID(user.ID, "")
+		fmt.Printf("Password reset for '%s'. Existing sessions have been signed out.\n", *username)
 	}
 }